@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// listenFDsStart is the first file descriptor systemd passes to an activated
+// service (SD_LISTEN_FDS_START).
+const listenFDsStart = 3
+
+// activationListener returns the listening socket systemd passed to roj1
+// with socket activation (LISTEN_PID and LISTEN_FDS), for the virtual
+// service to accept on instead of binding its own, or nil if roj1 was not
+// started that way. Only the first socket is used; the others are closed.
+// The variables are unset, so hooks and other children do not take the
+// sockets for theirs.
+//
+// launchd hands its sockets over through its C API only, which roj1 does not
+// use, so it cannot activate roj1.
+func activationListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	raw := os.Getenv("LISTEN_FDS")
+	for _, name := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		os.Unsetenv(name)
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", raw)
+	}
+
+	if n > 1 {
+		util.LogWarning("systemd passed %d sockets — only the first is used", n)
+	}
+	for fd := listenFDsStart + 1; fd < listenFDsStart+n; fd++ {
+		os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd)).Close()
+	}
+	// FileListener works on a duplicate, so the inherited descriptor is
+	// closed either way.
+	f := os.NewFile(listenFDsStart, "LISTEN_FD_"+strconv.Itoa(listenFDsStart))
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("the socket systemd passed is not a listening stream socket: %w", err)
+	}
+	return l, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/transport"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// runBench implements "roj1 bench -local": it pushes data through the
+// adapter and protocol layers over an in-memory transport (no network, no
+// WebRTC) and reports the throughput, to compare builds or machines.
+func runBench(ctx context.Context, sizeMiB, conns int) {
+	spinner := util.StartSpinner(util.Trf("sending %d MiB over %d connection(s)...", sizeMiB, conns))
+
+	elapsed, err := benchLocal(ctx, int64(sizeMiB)<<20, conns)
+	if err != nil {
+		spinner.Fail(util.Tr("benchmark failed"))
+		util.LogError("%v", err)
+		os.Exit(exitRuntime)
+	}
+	spinner.Success(util.Tr("benchmark finished"))
+
+	mibs := float64(sizeMiB) / elapsed.Seconds()
+	util.LogInfo("%d MiB over %d connection(s) in %v — %.1f MiB/s", sizeMiB, conns, elapsed.Round(time.Millisecond), mibs)
+}
+
+// benchLocal sends total bytes, split over conns connections, from a client
+// adapter to a host adapter linked by a transport.Pipe, into a sink that
+// closes each connection once it has read its share. Returns the time until
+// every connection has been closed end to end.
+func benchLocal(ctx context.Context, total int64, conns int) (time.Duration, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	perConn := total / int64(conns)
+
+	sink, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer sink.Close()
+	go func() {
+		for {
+			conn, err := sink.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.CopyN(io.Discard, conn, perConn)
+			}()
+		}
+	}()
+
+	clientTr, hostTr := transport.NewPipe()
+	defer clientTr.Close()
+
+	if _, err := adapter.StartAsHost(ctx, hostTr, sink.Addr().String()); err != nil {
+		return 0, err
+	}
+	h, err := adapter.StartAsClient(ctx, clientTr, "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+
+	payload := make([]byte, 64*1024)
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, conns)
+	for range conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := benchConn(h.Addr().String(), perConn, payload); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
+
+// benchConn writes n bytes through one tunnelled connection, then waits for
+// the far end to close it.
+func benchConn(addr string, n int64, payload []byte) error {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for sent := int64(0); sent < n; {
+		w, err := conn.Write(payload[:min(int64(len(payload)), n-sent)])
+		if err != nil {
+			return err
+		}
+		sent += int64(w)
+	}
+
+	// The sink closes once it has read everything; wait for that to
+	// propagate back through the tunnel.
+	if _, err := io.Copy(io.Discard, conn); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
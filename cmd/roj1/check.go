@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/1ureka/roj1/internal/transport"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// runCheck implements "roj1 check": a preflight probe of STUN reachability
+// and NAT behaviour, with advice on whether a direct P2P tunnel is likely.
+// Exits with exitNegotiation when a direct connection looks unlikely.
+func runCheck(ctx context.Context) {
+	spinner := util.StartSpinner(util.Tr("probing STUN servers..."))
+
+	report, err := transport.ProbeNAT(ctx)
+	if err != nil {
+		spinner.Fail(util.Tr("STUN probe aborted"))
+		util.LogError("%v", err)
+		os.Exit(exitInterrupted)
+	}
+	spinner.Success(util.Tr("STUN probe finished"))
+
+	for _, res := range report.Results {
+		if res.Err != nil {
+			util.LogWarning("%s: %v", res.Server, res.Err)
+			continue
+		}
+		util.LogInfo("%s: mapped to %s (RTT %v)", res.Server, res.Mapped, res.RTT.Round(time.Millisecond))
+	}
+
+	util.LogInfo("UDP egress: %v — NAT type: %s", report.UDPEgress(), report.Type)
+
+	switch report.Type {
+	case transport.NATBlocked:
+		util.LogError("no STUN server answered — UDP is likely blocked on this network")
+		util.LogError("try another network (e.g. a mobile hotspot) or ask the administrator to allow outbound UDP")
+	case transport.NATSymmetric:
+		util.LogWarning("symmetric NAT detected — a direct P2P connection is unlikely")
+		util.LogWarning("it can still work if the peer has an open or full-cone NAT; otherwise try another network")
+	case transport.NATUnknown:
+		util.LogWarning("only one STUN server answered — NAT behaviour could not be determined")
+	default:
+		util.LogSuccess("direct P2P connection is likely to succeed from this side")
+	}
+
+	if !report.P2PLikely() {
+		os.Exit(exitNegotiation)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"unicode"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// envPrefix prefixes the environment variable of each flag, e.g. -wsPort is
+// read from ROJ1_WS_PORT, so a container can be configured without arguments.
+const envPrefix = "ROJ1_"
+
+// envName returns the environment variable for a flag name.
+func envName(flagName string) string {
+	var b strings.Builder
+	b.WriteString(envPrefix)
+	for i, r := range flagName {
+		if unicode.IsUpper(r) && i > 0 {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// applyEnv sets every flag of fs that was not given on the command line from
+// its environment variable (see envName), if that is set. Command-line flags
+// take precedence. Exits with exitUsage on an invalid value.
+func applyEnv(fs *flag.FlagSet) {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	fs.VisitAll(func(f *flag.Flag) {
+		name := envName(f.Name)
+		value, ok := os.LookupEnv(name)
+		if set[f.Name] || !ok {
+			return
+		}
+		if err := fs.Set(f.Name, value); err != nil {
+			util.LogError("invalid %s: %v", name, err)
+			os.Exit(exitUsage)
+		}
+	})
+}
+
+// notifyShutdown returns a context cancelled on Ctrl+C or SIGTERM. The kernel
+// ignores signals without a handler for PID 1 (e.g. roj1 as a container's
+// entrypoint), so the handler stays installed: a second signal exits at once
+// instead of waiting for the graceful shutdown.
+func notifyShutdown() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-sigs
+		cancel()
+		<-sigs
+		util.LogWarning("second signal received — exiting without a graceful shutdown")
+		os.Exit(exitInterrupted)
+	}()
+
+	return ctx, func() {
+		signal.Stop(sigs)
+		cancel()
+	}
+}
+
+// tracePath serves the packet trace of -traceSocket (see adapter.Trace) next
+// to the health probes.
+const tracePath = "/debug/trace"
+
+// serveHealth serves the readiness and liveness probes (see util.HealthHandler)
+// and the packet trace on addr until ctx is cancelled. Exits with exitRuntime if addr cannot be
+// listened on, so a misconfigured probe port fails the pod at once.
+func serveHealth(ctx context.Context, addr string) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		util.LogError("failed to start health endpoint: %v", err)
+		os.Exit(exitRuntime)
+	}
+	util.LogInfo("health endpoint listening on %s (%s, %s)", ln.Addr(), util.ReadyPath, util.LivePath)
+
+	mux := http.NewServeMux()
+	mux.Handle("/", util.HealthHandler())
+	mux.HandleFunc(tracePath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		adapter.DumpTrace(w)
+	})
+
+	srv := &http.Server{Handler: mux}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			util.LogWarning("health endpoint stopped: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// Control socket: a running host or client listens on a Unix socket named
+// after its process ID in the config directory (control/<pid>.sock, readable
+// by this user only), through which commands such as "roj1 msg" reach its
+// tunnel. Requests are plain HTTP.
+
+const (
+	controlDir          = "control"   // under the config directory
+	controlMsgPath      = "/msg"      // POST: the body is sent as a message to the peer
+	controlRetargetPath = "/retarget" // POST: the client asks the host to forward to the port in the body
+	controlReloadPath   = "/reload"   // POST: re-read the -config file (see reload.go)
+	controlEventsPath   = "/events"   // GET: every event of the process as JSON lines, until the request ends
+)
+
+// eventBacklog bounds the events queued for a slow /events reader; beyond it
+// events are dropped rather than holding up the goroutines emitting them.
+const eventBacklog = 256
+
+// controlServer routes control requests to the adapter of the current
+// tunnel, if one is up.
+type controlServer struct {
+	mu sync.Mutex
+	h  *adapter.Handle // nil between tunnels
+}
+
+// attach makes requests reach h's tunnel (nil = no tunnel is up).
+func (c *controlServer) attach(h *adapter.Handle) {
+	c.mu.Lock()
+	c.h = h
+	c.mu.Unlock()
+}
+
+// handle returns the adapter of the current tunnel, or nil.
+func (c *controlServer) handle() *adapter.Handle {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.h
+}
+
+// serveControl listens on this process's control socket until ctx is
+// cancelled, reloading the configuration with reload. Failures are logged but
+// otherwise ignored: the tunnel works without it.
+func serveControl(ctx context.Context, reload func() error) *controlServer {
+	c := &controlServer{}
+
+	path := controlPath(os.Getpid())
+	if path == "" {
+		return c
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		util.LogDebug("control socket disabled: %v", err)
+		return c
+	}
+	os.Remove(path) // left by an earlier process with the same ID
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		util.LogDebug("control socket disabled: %v", err)
+		return c
+	}
+	util.LogDebug("control socket listening on %s", path)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+controlMsgPath, func(w http.ResponseWriter, r *http.Request) {
+		h := c.handle()
+		if h == nil {
+			http.Error(w, "no tunnel is up", http.StatusServiceUnavailable)
+			return
+		}
+		text, err := io.ReadAll(io.LimitReader(r.Body, adapter.MaxMessageLen+1))
+		if err == nil {
+			err = h.SendMessage(string(text))
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST "+controlRetargetPath, func(w http.ResponseWriter, r *http.Request) {
+		h := c.handle()
+		if h == nil {
+			http.Error(w, "no tunnel is up", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(io.LimitReader(r.Body, 16))
+		port, err := strconv.Atoi(strings.TrimSpace(string(body)))
+		if err == nil {
+			rctx, cancel := context.WithTimeout(r.Context(), retargetWait)
+			err = h.Retarget(rctx, port)
+			cancel()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST "+controlReloadPath, func(w http.ResponseWriter, r *http.Request) {
+		if err := reload(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET "+controlEventsPath, streamEvents)
+
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+		os.Remove(path)
+	}()
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			util.LogDebug("control socket stopped: %v", err)
+		}
+	}()
+	return c
+}
+
+// streamEvents writes the events of the process as JSON lines, log messages
+// and statistics included, until the client goes away.
+func streamEvents(w http.ResponseWriter, r *http.Request) {
+	ch := make(chan util.Event, eventBacklog)
+	unsubscribe := util.SubscribeEvents(func(ev util.Event) {
+		select {
+		case ch <- ev:
+		default:
+		}
+	})
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	rc.Flush()
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case ev := <-ch:
+			if enc.Encode(ev) != nil || rc.Flush() != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// controlPath returns the control socket of the process with this ID, or ""
+// if there is no config directory.
+func controlPath(pid int) string {
+	dir := defaultPath(controlDir)
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, strconv.Itoa(pid)+".sock")
+}
+
+// runningTunnels returns the IDs of the processes with a control socket.
+func runningTunnels() []int {
+	entries, _ := os.ReadDir(defaultPath(controlDir))
+	var pids []int
+	for _, e := range entries {
+		if pid, err := strconv.Atoi(strings.TrimSuffix(e.Name(), ".sock")); err == nil && pid > 0 {
+			pids = append(pids, pid)
+		}
+	}
+	slices.Sort(pids)
+	return pids
+}
+
+// controlRequest posts body to path on the control socket of process pid,
+// or of the only running tunnel if pid is 0. Sockets no process listens on
+// any more are removed.
+func controlRequest(pid int, path, body string) error {
+	if pid == 0 {
+		var live []int
+		for _, p := range runningTunnels() {
+			if conn, err := net.Dial("unix", controlPath(p)); err == nil {
+				conn.Close()
+				live = append(live, p)
+			} else {
+				os.Remove(controlPath(p))
+			}
+		}
+		switch len(live) {
+		case 0:
+			return errors.New("no tunnel is running")
+		case 1:
+			pid = live[0]
+		default:
+			return fmt.Errorf("several tunnels are running (processes %s); choose one with -pid", joinInts(live))
+		}
+	}
+
+	socket := controlPath(pid)
+	client := &http.Client{
+		Timeout: retargetWait + 10*time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+	resp, err := client.Post("http://roj1"+path, "text/plain; charset=utf-8", strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("process %d is not running a tunnel: %w", pid, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.New(strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// joinInts formats numbers as a comma-separated list.
+func joinInts(ns []int) string {
+	s := make([]string, len(ns))
+	for i, n := range ns {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ", ")
+}
+
+// runMsg implements "roj1 msg": it sends text to the operator on the other
+// side of a running tunnel.
+func runMsg(pid int, text string) {
+	if err := controlRequest(pid, controlMsgPath, text); err != nil {
+		util.LogError("failed to send the message: %v", err)
+		os.Exit(exitRuntime)
+	}
+	util.LogSuccess("message sent to the peer")
+}
+
+// runReload implements "roj1 reload": it makes a running host or client
+// re-read its -config file, like SIGHUP.
+func runReload(pid int) {
+	if err := controlRequest(pid, controlReloadPath, ""); err != nil {
+		util.LogError("failed to reload the configuration: %v", err)
+		os.Exit(exitRuntime)
+	}
+	util.LogSuccess("configuration reloaded")
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1ureka/roj1/internal/signaling"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// attempt records how far the current establishment got, from the event bus
+// (see watchAttempt), for suggestFix and reportTimeout.
+var attempt struct {
+	sync.Mutex
+	waited               bool                     // host: a client arrived
+	phases               map[string]time.Duration // the phases that ended, the first of each
+	ice                  string                   // the last ICE progress state ("" = none yet)
+	local, srflx, remote int                      // ICE candidates gathered and received
+	pair                 string                   // the selected candidate pair ("" = none)
+}
+
+// watchAttempt keeps attempt up to date, starting over with each
+// establishment.
+func watchAttempt() {
+	attempt.phases = make(map[string]time.Duration)
+	util.SubscribeEvents(func(ev util.Event) {
+		attempt.Lock()
+		defer attempt.Unlock()
+		switch ev.Event {
+		case util.EventStateChanged:
+			if ev.State == util.StateSignaling.String() {
+				attempt.waited = false
+				clear(attempt.phases)
+				attempt.ice, attempt.pair = "", ""
+				attempt.local, attempt.srflx, attempt.remote = 0, 0, 0
+			}
+		case util.EventPhase:
+			if ev.Phase == util.PhaseWait {
+				attempt.waited = true
+			}
+			if _, ok := attempt.phases[ev.Phase]; !ok {
+				attempt.phases[ev.Phase] = ev.Duration
+			}
+		case util.EventICEProgress:
+			attempt.ice = ev.State
+			attempt.local = max(attempt.local, ev.Local)
+			attempt.srflx = max(attempt.srflx, ev.Srflx)
+			attempt.remote = max(attempt.remote, ev.Remote)
+			if ev.Pair != "" {
+				attempt.pair = ev.Pair
+			}
+		}
+	})
+}
+
+// diagnose follows an establishment failure on the host or the client with
+// how far it got, if it timed out, and the likely fix (see suggestFix).
+func diagnose(err error, host bool) {
+	if errors.Is(err, signaling.ErrTimeout) {
+		reportTimeout(host)
+	}
+	suggestFix(err)
+}
+
+// iceLabels describes the ICE progress states in reportTimeout.
+var iceLabels = map[string]string{
+	util.ICEGathering: "gathering candidates",
+	util.ICEChecking:  "checking candidate pairs",
+	util.ICEConnected: "connected",
+}
+
+// reportTimeout logs how far an establishment that timed out got: the first
+// phase that did not end, those that did, and what ICE had to work with.
+func reportTimeout(host bool) {
+	attempt.Lock()
+	var done []string
+	stuck := ""
+	if host && !attempt.waited {
+		stuck = "waiting for a client"
+	}
+	for _, p := range breakdownPhases {
+		if d, ok := attempt.phases[p.phase]; ok {
+			done = append(done, util.Tr(p.label)+" "+formatMillis(d))
+		} else if stuck == "" && !(host && p.phase == util.PhaseConnect) {
+			stuck = p.label
+		}
+	}
+	waited, ice, pair := attempt.waited, attempt.ice, attempt.pair
+	local, srflx, remote := attempt.local, attempt.srflx, attempt.remote
+	attempt.Unlock()
+
+	// Logged once attempt is released, as logging emits an event too.
+	switch {
+	case stuck == "":
+	case len(done) == 0:
+		util.LogInfo("stuck at: %s", util.Tr(stuck))
+	default:
+		util.LogInfo("stuck at: %s, after %s", util.Tr(stuck), strings.Join(done, " | "))
+	}
+	switch {
+	case host && !waited:
+		return
+	case ice == "":
+		util.LogInfo("ICE never started: no session description was exchanged")
+		return
+	}
+	util.LogInfo("ICE %s: %d local candidates (%d server-reflexive), %d from the peer",
+		util.Tr(iceLabels[ice]), local, srflx, remote)
+	if pair != "" {
+		util.LogInfo("ICE pair: %s", pair)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// How often drainClient shows the connections it waits on: live in a
+// terminal, and as log lines otherwise.
+const (
+	drainRefresh = time.Second
+	drainLog     = 5 * time.Second
+)
+
+// drainClient stops the virtual service from accepting once a shutdown signal
+// arrived, and gives the connections in progress up to grace to finish,
+// showing what each one moves, before the rest are torn down. A second
+// signal cuts them at once (see notifyShutdown). plain logs the progress
+// instead of updating it in place.
+func drainClient(h *adapter.Handle, grace time.Duration, plain bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+
+	sockets := h.Sockets()
+	if len(sockets) == 0 || grace <= 0 {
+		h.Close(ctx)
+		return
+	}
+	util.LogInfo("waiting up to %v for %d connections to finish — press Ctrl+C again to cut them", grace, len(sockets))
+
+	done := make(chan error, 1)
+	go func() { done <- h.Close(ctx) }()
+
+	var area *pterm.AreaPrinter
+	if !plain {
+		area, _ = pterm.DefaultArea.WithRemoveWhenDone().Start(drainLines(sockets))
+		defer area.Stop()
+	}
+	ticker := time.NewTicker(drainRefresh)
+	defer ticker.Stop()
+	logged := time.Now()
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				util.LogWarning("grace period over — cut %d connections that had not finished", len(sockets))
+			} else {
+				util.LogSuccess("all connections finished")
+			}
+			return
+		case <-ticker.C:
+			sockets = h.Sockets()
+			switch {
+			case area != nil:
+				area.Update(drainLines(sockets))
+			case time.Since(logged) >= drainLog:
+				logged = time.Now()
+				for _, s := range sockets {
+					util.LogInfo("[%08x] %s: %s in, %s out, idle %v", s.ID, s.Remote,
+						util.FormatBytes(float64(s.BytesIn)), util.FormatBytes(float64(s.BytesOut)), s.Idle.Round(time.Second))
+				}
+			}
+		}
+	}
+}
+
+// drainLines shows the sockets a drain waits on, one per line.
+func drainLines(sockets []adapter.SocketProgress) string {
+	var b strings.Builder
+	fmt.Fprintln(&b, util.Trf("draining %d connections:", len(sockets)))
+	for _, s := range sockets {
+		fmt.Fprintf(&b, "  [%08x] %s  ↓ %s  ↑ %s  %s\n", s.ID, s.Remote,
+			util.FormatBytes(float64(s.BytesIn)), util.FormatBytes(float64(s.BytesOut)),
+			util.Trf("idle %v", s.Idle.Round(time.Second)))
+	}
+	return b.String()
+}
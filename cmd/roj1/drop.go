@@ -0,0 +1,39 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"os"
+	"strings"
+
+	"github.com/1ureka/roj1/internal/signaling"
+	"github.com/1ureka/roj1/internal/transport"
+)
+
+// dropConfig returns the configuration of the -drop dead drop raw: gists are
+// edited with token, buckets reached with the usual AWS_* credentials.
+func dropConfig(raw, token string) signaling.DropConfig {
+	cfg := signaling.DropConfig{URL: raw, Token: token}
+	if strings.HasPrefix(raw, "s3:") {
+		cfg.Token = ""
+		cfg.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		cfg.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		cfg.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+		cfg.Region = cmp.Or(os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"))
+		cfg.Endpoint = cmp.Or(os.Getenv("AWS_ENDPOINT_URL_S3"), os.Getenv("AWS_ENDPOINT_URL"))
+	}
+	return cfg
+}
+
+// establishOverDrop establishes a tunnel as the host or client of the
+// exchange in the -drop dead drop, taking a new session in it for each. The
+// client pins the host's key under the drop's URL.
+func establishOverDrop(ctx context.Context, cfg signaling.DropConfig, host bool, opts signaling.Options) (transport.Carrier, error) {
+	return establishOver(ctx, cfg.URL, host, opts, func(ctx context.Context) (signaling.Signaler, error) {
+		s, err := signaling.DialDrop(ctx, cfg, host)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	})
+}
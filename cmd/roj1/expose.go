@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// exposeTimeout bounds how long a tunnel client may take to print its public
+// URL.
+const exposeTimeout = 30 * time.Second
+
+// exposer is a tunnel client that publishes the host's WS port on localhost
+// at a public URL (see -expose).
+type exposer struct {
+	command string                  // executable, looked up in PATH
+	setup   string                  // how to install and authenticate it
+	args    func(port int) []string // arguments publishing port
+	url     *regexp.Regexp          // matches the public URL in its output
+}
+
+// exposers are the -expose backends by name.
+var exposers = map[string]exposer{
+	"devtunnel": {
+		command: "devtunnel",
+		setup:   "install it from https://aka.ms/devtunnels/cli and run 'devtunnel user login'",
+		args: func(port int) []string {
+			return []string{"host", "-p", strconv.Itoa(port), "--allow-anonymous"}
+		},
+		// e.g. "Connect via browser: https://x1y2z3-9000.usw2.devtunnels.ms"
+		url: regexp.MustCompile(`https://[-a-z0-9.]+\.devtunnels\.ms\b`),
+	},
+	"ngrok": {
+		command: "ngrok",
+		setup:   "install it from https://ngrok.com/download and set NGROK_AUTHTOKEN or run 'ngrok config add-authtoken'",
+		args: func(port int) []string {
+			return []string{"http", strconv.Itoa(port), "--log", "stdout", "--log-format", "logfmt"}
+		},
+		// e.g. `msg="started tunnel" ... url=https://a1b2c3.ngrok-free.app`
+		url: regexp.MustCompile(`https://[-a-z0-9.]+\.ngrok(-free)?\.(app|dev|io)\b`),
+	},
+	"cloudflared": {
+		command: "cloudflared",
+		setup:   "install it from https://developers.cloudflare.com/cloudflare-one/connections/connect-networks/downloads/",
+		args: func(port int) []string {
+			return []string{"tunnel", "--no-autoupdate", "--url", "http://localhost:" + strconv.Itoa(port)}
+		},
+		// e.g. "|  https://some-random-words.trycloudflare.com  |"
+		url: regexp.MustCompile(`https://[-a-z0-9]+\.trycloudflare\.com\b`),
+	},
+}
+
+// exposerNames returns the valid -expose values.
+func exposerNames() []string {
+	names := []string{"none"}
+	for name := range exposers {
+		names = append(names, name)
+	}
+	slices.Sort(names[1:])
+	return names
+}
+
+// Running tunnel clients, stopped by stopExposed.
+var (
+	exposedMu sync.Mutex
+	exposed   []func()
+)
+
+// expose publishes the WS port on localhost with the named exposer, whose
+// tunnel client runs until ctx is done or stopExposed is called, and returns
+// the WebSocket URL, ending in wsPath, the client should use.
+func expose(ctx context.Context, name string, wsPort int, wsPath string) (string, error) {
+	e := exposers[name]
+	if _, err := exec.LookPath(e.command); err != nil {
+		return "", fmt.Errorf("%s not found — %s", e.command, e.setup)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+	cmd := exec.CommandContext(ctx, e.command, e.args(wsPort)...)
+	cmd.Stdout, cmd.Stderr = pw, pw
+	cmd.WaitDelay = time.Second // do not wait on output held open by its children
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return "", fmt.Errorf("failed to start %s: %w", e.command, err)
+	}
+
+	exited := make(chan struct{})
+	var waitErr error
+	go func() {
+		waitErr = cmd.Wait()
+		pw.Close()
+		close(exited)
+	}()
+
+	found := make(chan string, 1)
+	scanned := make(chan struct{})
+	var last string // last output line, for the error if the client exits
+	go func() {
+		defer close(scanned)
+		scanner := bufio.NewScanner(pr)
+		for scanner.Scan() {
+			last = scanner.Text()
+			util.LogDebug("%s: %s", e.command, last)
+			if u := e.url.FindString(last); u != "" && !strings.Contains(u, "-inspect.") {
+				select {
+				case found <- u:
+				default:
+				}
+			}
+		}
+	}()
+
+	timer := time.NewTimer(exposeTimeout)
+	defer timer.Stop()
+
+	select {
+	case u := <-found:
+		stop := func() {
+			cancel()
+			<-exited
+		}
+		exposedMu.Lock()
+		exposed = append(exposed, stop)
+		exposedMu.Unlock()
+
+		go func() {
+			<-exited
+			if ctx.Err() == nil {
+				util.LogWarning("%s exited: %v — the shared URL no longer works", e.command, waitErr)
+			}
+		}()
+		return "wss://" + strings.TrimPrefix(u, "https://") + wsPath, nil
+
+	case <-exited:
+		<-scanned
+		cancel()
+		return "", fmt.Errorf("%s exited: %v: %s", e.command, waitErr, last)
+
+	case <-timer.C:
+		cancel()
+		<-exited
+		return "", fmt.Errorf("%s printed no URL within %v — %s", e.command, exposeTimeout, e.setup)
+
+	case <-ctx.Done():
+		cancel()
+		<-exited
+		return "", ctx.Err()
+	}
+}
+
+// stopExposed stops every tunnel client started by expose and waits for them
+// to exit, so no public URL outlives roj1.
+func stopExposed() {
+	exposedMu.Lock()
+	stops := exposed
+	exposed = nil
+	exposedMu.Unlock()
+
+	for _, stop := range stops {
+		stop()
+	}
+}
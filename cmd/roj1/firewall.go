@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// firewallRule is the name of the Windows Firewall rule created by
+// "roj1 firewall-allow".
+const firewallRule = "roj1"
+
+// Winsock error codes, which syscall only defines on Windows.
+const (
+	wsaEACCES     = 10013 // WSAEACCES: the port is reserved or blocked
+	wsaEADDRINUSE = 10048 // WSAEADDRINUSE
+)
+
+// runFirewallAllow implements "roj1 firewall-allow": it creates (or
+// replaces) an inbound Windows Firewall rule allowing this executable on the
+// given profiles, so listening on all interfaces (-wsListen, -direct, -quic)
+// does not raise the firewall prompt in the middle of a session. The rule
+// covers UDP as well as TCP, for -quic. Without administrator rights the rule
+// is created through a UAC prompt.
+func runFirewallAllow(profile string) {
+	if runtime.GOOS != "windows" {
+		util.LogInfo("firewall-allow only applies to Windows Firewall — nothing to do on %s", runtime.GOOS)
+		return
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		util.LogError("failed to locate the roj1 executable: %v", err)
+		os.Exit(exitRuntime)
+	}
+
+	// The rule is bound to the executable's path, so replace any rule left
+	// by a copy elsewhere.
+	del := []string{"advfirewall", "firewall", "delete", "rule", "name=" + firewallRule}
+	add := []string{"advfirewall", "firewall", "add", "rule", "name=" + firewallRule,
+		"dir=in", "action=allow", "enable=yes", "protocol=any", "profile=" + profile, "program=" + exe}
+
+	exec.Command("netsh", del...).Run()
+	out, err := exec.Command("netsh", add...).CombinedOutput()
+	if err != nil {
+		util.LogDebug("netsh: %v: %s", err, strings.TrimSpace(string(out)))
+		util.LogInfo("administrator rights are needed to change the firewall — approve the Windows prompt")
+		if err := runElevated("netsh", del, add); err != nil {
+			util.LogError("failed to create the firewall rule: %v", err)
+			os.Exit(exitRuntime)
+		}
+	}
+	util.LogSuccess("Windows Firewall now allows incoming connections to %s (%s profiles)", exe, profile)
+}
+
+// validFirewallProfile reports whether profile is "any" or a comma-separated
+// list of Windows network profiles.
+func validFirewallProfile(profile string) bool {
+	if profile == "any" {
+		return true
+	}
+	for p := range strings.SplitSeq(profile, ",") {
+		if p != "private" && p != "domain" && p != "public" {
+			return false
+		}
+	}
+	return true
+}
+
+// runElevated runs each argument list of name in turn from an elevated
+// PowerShell, which shows the UAC prompt, and waits for them. The last one
+// must succeed.
+func runElevated(name string, argLists ...[]string) error {
+	var script strings.Builder
+	script.WriteString("$ErrorActionPreference = 'Stop'; ") // a declined prompt fails
+	for _, args := range argLists {
+		quoted := make([]string, len(args))
+		for i, a := range args {
+			quoted[i] = `'"` + strings.ReplaceAll(a, "'", "''") + `"'`
+		}
+		script.WriteString("$p = Start-Process -FilePath " + name + " -Verb RunAs -Wait -PassThru -WindowStyle Hidden -ArgumentList " +
+			strings.Join(quoted, ",") + "; ")
+	}
+	script.WriteString("exit $p.ExitCode")
+
+	out, err := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script.String()).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return errors.New(msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// firewallRuleMissing reports whether this is Windows and the rule created
+// by "roj1 firewall-allow" does not exist.
+func firewallRuleMissing() bool {
+	if runtime.GOOS != "windows" {
+		return false
+	}
+	return exec.Command("netsh", "advfirewall", "firewall", "show", "rule", "name="+firewallRule).Run() != nil
+}
+
+// suggestFirewallAllow tells Windows users listening on all interfaces how to
+// avoid the firewall prompt, unless the rule already exists.
+func suggestFirewallAllow() {
+	if firewallRuleMissing() {
+		util.LogInfo("Windows may ask whether to allow roj1 through the firewall; run 'roj1 firewall-allow' once to set this up ahead of time")
+	}
+}
+
+// explainBindError logs why a listen most likely failed and what to do about
+// it, if the error is one users commonly hit.
+func explainBindError(err error) {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return
+	}
+
+	switch {
+	case runtime.GOOS == "windows" && errno == wsaEACCES:
+		util.LogInfo("Windows refused the port: it may be reserved (see 'netsh interface ipv4 show excludedportrange protocol=tcp') or blocked by security software — choose another port")
+	case runtime.GOOS == "windows" && errno == wsaEADDRINUSE,
+		runtime.GOOS != "windows" && errno == syscall.EADDRINUSE:
+		util.LogInfo("another program is already listening on that port — stop it or choose another port")
+	case runtime.GOOS != "windows" && errno == syscall.EACCES:
+		util.LogInfo("ports below 1024 need root (or CAP_NET_BIND_SERVICE on Linux) — choose a higher port")
+	}
+}
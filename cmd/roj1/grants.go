@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/pterm/pterm"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// Answers of the -askServices prompt.
+var grantChoices = []string{"Allow once", "Allow always", "Deny once", "Deny always"}
+
+// promptMu serializes -askServices prompts: binds are decided concurrently,
+// but only one prompt can have the terminal.
+var promptMu sync.Mutex
+
+// serviceAuthorizer returns the adapter.HostConfig.AuthorizeService of a
+// session with the client whose key fingerprint is peer ("" = it proved
+// none), deciding with the current options: decisions in -serviceGrants
+// apply first, then -askServices prompts the operator. Without either flag
+// every service is allowed.
+func serviceAuthorizer(current func() runOptions, peer string) func(context.Context, string) error {
+	return func(ctx context.Context, service string) error {
+		opts := current()
+		grants, ask := opts.serviceGrants, opts.askServices
+		if grants == nil && !ask {
+			return nil
+		}
+
+		if grants != nil && peer != "" {
+			if allow, ok := grants.Lookup(peer, service); ok {
+				if !allow {
+					return errors.New("denied by the host's grants")
+				}
+				return nil
+			}
+		}
+		if !ask {
+			return errors.New("not granted by the host")
+		}
+
+		allow, always, err := askGrant(ctx, peer, service)
+		if err != nil {
+			return err
+		}
+		if always && grants != nil {
+			if peer == "" {
+				util.LogWarning("the client proved no key, so this decision is not remembered")
+			} else if err := grants.Record(peer, service, allow); err != nil {
+				util.LogWarning("failed to record the decision: %v", err)
+			}
+		}
+		if !allow {
+			return errors.New("denied by the host's operator")
+		}
+		return nil
+	}
+}
+
+// askGrant asks the operator whether the client may use service. always
+// reports an "always" answer, to be remembered. A prompt that cannot finish
+// before ctx is done counts as a denial.
+func askGrant(ctx context.Context, peer, service string) (allow, always bool, err error) {
+	promptMu.Lock()
+	defer promptMu.Unlock()
+	if ctx.Err() != nil {
+		return false, false, ctx.Err()
+	}
+
+	who := peer
+	if who == "" {
+		who = util.Tr("a client without a key")
+	}
+	options := make([]string, len(grantChoices))
+	for i, c := range grantChoices {
+		options[i] = util.Tr(c)
+	}
+
+	choice, _ := pterm.DefaultInteractiveSelect.
+		WithOptions(options).
+		WithDefaultText(util.Trf("Allow %s to use service %s?", who, service)).
+		Show()
+	pterm.Println()
+
+	switch slices.Index(options, choice) {
+	case 0:
+		return true, false, nil
+	case 1:
+		return true, true, nil
+	case 3:
+		return false, true, nil
+	default:
+		return false, false, nil
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"github.com/1ureka/roj1/internal/identity"
+	"github.com/1ureka/roj1/internal/signaling"
+	"github.com/1ureka/roj1/internal/transport"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// wsaECONNREFUSED is Windows' "connection refused".
+const wsaECONNREFUSED = 10061
+
+// suggestFix logs the most likely cause of an establishment failure and what
+// to do about it, if err is one users commonly hit; the bare error from the
+// WebSocket or WebRTC library rarely says.
+func suggestFix(err error) {
+	if hint := fixFor(err); hint != "" {
+		util.LogInfo("%s", util.Tr(hint))
+	}
+}
+
+// signInPage reports whether a redirect target looks like a sign-in page,
+// such as the one a dev tunnel without anonymous access redirects to.
+func signInPage(location string) bool {
+	location = strings.ToLower(location)
+	return strings.Contains(location, "login") || strings.Contains(location, "signin") || strings.Contains(location, "oauth")
+}
+
+// fixFor returns the hint for err, or "".
+func fixFor(err error) string {
+	var (
+		dnsErr    *net.DNSError
+		handshake *signaling.HandshakeError
+		errno     syscall.Errno
+	)
+	switch {
+	case errors.Is(err, signaling.ErrCancelled):
+		return ""
+
+	case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		return "the host name in the URL does not resolve — check it for typos"
+	case errors.As(err, &dnsErr):
+		return "the host name in the URL could not be looked up — check this machine's network and DNS settings"
+
+	case errors.As(err, &handshake) && (handshake.StatusCode == http.StatusUnauthorized || handshake.StatusCode == http.StatusForbidden):
+		return "the server turned the connection away as unauthorized — check that both sides use the same -pin, and any credentials a proxy or relay in between needs"
+	case errors.As(err, &handshake) && handshake.StatusCode == http.StatusNotFound:
+		return "nothing answers at that URL — check its path, or the room code with -relay"
+	case errors.As(err, &handshake) && handshake.Location != "" && signInPage(handshake.Location):
+		return "the URL leads to a sign-in page — a dev tunnel must allow anonymous access (devtunnel host --allow-anonymous, as -expose devtunnel does)"
+	case errors.As(err, &handshake) && handshake.Location != "":
+		return "the server redirects elsewhere, which WebSockets do not follow — use the URL it redirects to, with wss:// for https://"
+	case errors.As(err, &handshake) && (handshake.StatusCode/100 == 2 || handshake.StatusCode == http.StatusBadRequest && strings.Contains(handshake.Reason, "websocket:")):
+		return "a proxy in between drops the WebSocket upgrade — it must pass the Upgrade and Connection headers on (nginx: proxy_http_version 1.1; proxy_set_header Upgrade $http_upgrade; proxy_set_header Connection upgrade)"
+	case errors.As(err, &handshake) && (handshake.StatusCode == http.StatusBadGateway || handshake.StatusCode == http.StatusServiceUnavailable || handshake.StatusCode == http.StatusGatewayTimeout):
+		return "the proxy in front of the host cannot reach it — check that the host is still running and the proxy forwards to its WS port"
+	case errors.Is(err, signaling.ErrUpgradeStalled):
+		return "a proxy in between holds the WebSocket upgrade back — turn off its buffering for this path (nginx: proxy_buffering off), or put the host's URL behind one that passes WebSockets on"
+
+	case errors.As(err, &errno) && (errno == syscall.ECONNREFUSED || runtime.GOOS == "windows" && errno == wsaECONNREFUSED):
+		return "nothing is listening at that address — check that the host is running and the port is the one it printed"
+
+	case errors.Is(err, signaling.ErrPIN):
+		return "the PINs differ — both sides must use the same -pin, or neither"
+	case errors.Is(err, identity.ErrHostKeyChanged):
+		return "the host's key is not the one pinned on first use — if the host was reinstalled, remove its line from the -knownHosts file; otherwise someone may be impersonating it"
+	case errors.Is(err, signaling.ErrAuth):
+		return "the host did not accept this client's key — send the line 'roj1 key' prints to the host's operator, for its -authorizedKeys file"
+	case errors.Is(err, signaling.ErrVersion):
+		return "the two sides run incompatible versions of roj1 — upgrade the older one"
+	}
+
+	attempt.Lock()
+	local, srflx := attempt.local, attempt.srflx
+	attempt.Unlock()
+	noSrflx := local > 0 && srflx == 0
+	switch {
+	case noSrflx && (errors.Is(err, signaling.ErrNegotiation) || errors.Is(err, transport.ErrICETimeout)):
+		return "no public address was learnt from the STUN servers, so UDP is most likely blocked on this network — allow outbound UDP, or try -direct when both sides share a network; 'roj1 check' tests this"
+	case errors.Is(err, transport.ErrICETimeout):
+		return "no network path between the two sides worked — both may be behind NATs that keep each other out; run 'roj1 check' on each side"
+	}
+	return ""
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/1ureka/roj1/internal/history"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// recordHistory appends every tunnel session of this process to the history
+// file at path ("" = disabled) when it closes. Traffic is measured as the
+// growth of util.Stats over the session.
+func recordHistory(role, path string) {
+	if path == "" {
+		return
+	}
+
+	var (
+		session        *history.Session
+		sent, recv, cn int64 // util.Stats at establishment
+	)
+	util.SubscribeEvents(func(ev util.Event) {
+		switch ev.Event {
+		case util.EventTunnelEstablished:
+			session = &history.Session{Start: ev.Time, Role: role, Addr: ev.Addr, Peer: ev.Peer}
+			sent, recv, cn = util.Stats.BytesSent.Load(), util.Stats.BytesRecv.Load(), util.Stats.TotalConns.Load()
+
+		case util.EventTunnelClosed:
+			if session == nil {
+				return
+			}
+			session.End = ev.Time
+			session.Reason = ev.Reason
+			session.BytesOut = util.Stats.BytesSent.Load() - sent
+			session.BytesIn = util.Stats.BytesRecv.Load() - recv
+			session.Conns = util.Stats.TotalConns.Load() - cn
+			if err := history.Append(path, *session); err != nil {
+				util.LogWarning("failed to record the session in %s: %v", path, err)
+			}
+			session = nil
+		}
+	})
+}
+
+// runHistory implements "roj1 history": it prints the last sessions that
+// ended within since (0 = all), then the totals of every such session.
+func runHistory(path string, since time.Duration, last int) {
+	sessions, err := history.Load(path)
+	if err != nil {
+		util.LogError("failed to read session history: %v", err)
+		os.Exit(exitRuntime)
+	}
+	if since > 0 {
+		sessions = history.Since(sessions, time.Now().Add(-since))
+	}
+	if len(sessions) == 0 {
+		util.LogInfo("no sessions recorded in %s", path)
+		return
+	}
+
+	shown := sessions
+	if last > 0 && len(shown) > last {
+		shown = shown[len(shown)-last:]
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, util.Tr("START\tDURATION\tROLE\tADDRESS\tIN\tOUT\tCONNS\tREASON\tPEER"))
+	for _, s := range shown {
+		fmt.Fprintf(w, "%s\t%v\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			s.Start.Local().Format("2006-01-02 15:04"),
+			s.Duration().Round(time.Second),
+			s.Role, s.Addr,
+			util.FormatBytes(float64(s.BytesIn)),
+			util.FormatBytes(float64(s.BytesOut)),
+			s.Conns, s.Reason, s.Peer,
+		)
+	}
+	w.Flush()
+
+	total := history.Sum(sessions)
+	fmt.Println()
+	util.LogInfo("%d sessions, %v in total — In: %s | Out: %s | Conn: %d",
+		total.Sessions, total.Duration.Round(time.Second),
+		util.FormatBytes(float64(total.BytesIn)), util.FormatBytes(float64(total.BytesOut)), total.Conns)
+}
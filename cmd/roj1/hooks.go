@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// hookTimeout bounds an -onDown command, which roj1 waits for before it goes
+// on (or exits) so the command is not cut short.
+const hookTimeout = 30 * time.Second
+
+// installHooks runs the -onUp command whenever a tunnel is established and
+// the -onDown command whenever it closes, with the tunnel described in
+// ROJ1_TUNNEL_* environment variables:
+//
+//	ROJ1_TUNNEL_ROLE    host or client
+//	ROJ1_TUNNEL_ADDR    address traffic is forwarded to (host) or served on (client)
+//	ROJ1_TUNNEL_PORT    port of ROJ1_TUNNEL_ADDR
+//	ROJ1_TUNNEL_PEER    fingerprint of the peer's key, if it proved one
+//	ROJ1_TUNNEL_REASON  why the tunnel closed (-onDown only, see closeReason)
+//
+// -onUp runs in the background; -onDown is waited for, up to hookTimeout.
+// (The prefix differs from ROJ1_ flag variables, see applyEnv, so a hook can
+// run roj1 itself.)
+func installHooks(role string, opts runOptions) {
+	if opts.onUp == "" && opts.onDown == "" {
+		return
+	}
+
+	var env []string // describes the current tunnel; set on establishment
+	util.SubscribeEvents(func(ev util.Event) {
+		switch ev.Event {
+		case util.EventTunnelEstablished:
+			_, port, _ := net.SplitHostPort(ev.Addr)
+			env = []string{
+				"ROJ1_TUNNEL_ROLE=" + role,
+				"ROJ1_TUNNEL_ADDR=" + ev.Addr,
+				"ROJ1_TUNNEL_PORT=" + port,
+				"ROJ1_TUNNEL_PEER=" + ev.Peer,
+			}
+			if opts.onUp != "" {
+				runHook("-onUp", opts.onUp, env, false)
+			}
+
+		case util.EventTunnelClosed:
+			if opts.onDown != "" && env != nil {
+				runHook("-onDown", opts.onDown, append(env, "ROJ1_TUNNEL_REASON="+ev.Reason), true)
+			}
+			env = nil
+		}
+	})
+}
+
+// runHook runs a hook command line with extra environment variables,
+// waiting for it if wait is set. Its output goes to stderr; failures are
+// logged.
+func runHook(flag, line string, env []string, wait bool) {
+	ctx := context.Background()
+	if wait {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hookTimeout)
+		defer cancel()
+	}
+
+	cmd := shellCommand(ctx, line)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Start(); err != nil {
+		util.LogWarning("failed to run %s: %v", flag, err)
+		return
+	}
+	util.LogDebug("running %s: %s", flag, line)
+
+	if wait {
+		waitHook(flag, cmd)
+	} else {
+		go waitHook(flag, cmd)
+	}
+}
+
+// waitHook waits for a hook command and logs its failure.
+func waitHook(flag string, cmd *exec.Cmd) {
+	if err := cmd.Wait(); err != nil {
+		util.LogWarning("%s failed: %v", flag, err)
+	}
+}
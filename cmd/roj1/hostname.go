@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/1ureka/roj1/internal/hosts"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// registerHostname maps -hostname to the virtual service's address in the
+// system hosts file and returns a function removing the entry again. A
+// failure (usually missing write access) is only logged, since the service
+// is still reachable by its address.
+func registerHostname(name string, addr net.Addr) func() {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if name == "" || !ok {
+		return func() {}
+	}
+
+	ip := tcpAddr.IP
+	switch {
+	case ip.IsUnspecified() && ip.To4() != nil:
+		ip = net.IPv4(127, 0, 0, 1)
+	case ip.IsUnspecified():
+		ip = net.IPv6loopback
+	}
+
+	path := hosts.Path()
+	if err := hosts.Add(path, ip.String(), name); err != nil {
+		util.LogWarning("failed to add %s to %s: %v", name, path, err)
+		return func() {}
+	}
+	util.LogSuccess("virtual service reachable at %s", net.JoinHostPort(name, strconv.Itoa(tcpAddr.Port)))
+
+	return func() {
+		if err := hosts.Remove(path, name); err != nil {
+			util.LogWarning("failed to remove %s from %s: %v", name, path, err)
+		}
+	}
+}
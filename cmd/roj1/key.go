@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/1ureka/roj1/internal/identity"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// defaultPath returns name in the identity directory, or "" if there is no
+// user config directory.
+func defaultPath(name string) string {
+	dir, err := identity.DefaultDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, name)
+}
+
+// loadIdentity loads the identity key at path, creating it on first use.
+// Failures are logged and yield no identity, which only matters when the
+// host requires authentication.
+func loadIdentity(path string) ed25519.PrivateKey {
+	if path == "" {
+		return nil
+	}
+
+	key, created, err := identity.LoadOrCreate(path)
+	if err != nil {
+		util.LogWarning("failed to load identity %s: %v — continuing without one", path, err)
+		return nil
+	}
+
+	pub := key.Public().(ed25519.PublicKey)
+	if created {
+		util.LogInfo("created identity %s — fingerprint %s", path, identity.Fingerprint(pub))
+	} else {
+		util.LogDebug("loaded identity %s (%s)", path, identity.Fingerprint(pub))
+	}
+	return key
+}
+
+// runKey implements "roj1 key": it prints the public key of the identity,
+// creating the identity if needed, for a host's authorized keys file.
+func runKey(path string) {
+	key, created, err := identity.LoadOrCreate(path)
+	if err != nil {
+		util.LogError("failed to load identity %s: %v", path, err)
+		os.Exit(exitRuntime)
+	}
+	if created {
+		util.LogInfo("created identity %s", path)
+	}
+
+	pub := key.Public().(ed25519.PublicKey)
+	fmt.Println(identity.MarshalPublicKey(pub))
+	util.LogInfo("fingerprint %s — add the line above to the host's authorized keys file", identity.Fingerprint(pub))
+}
@@ -4,97 +4,237 @@
 // TCP service to a local port. No relay servers are needed after the signaling
 // phase (which uses WebSocket).
 //
-// It can be launched interactively (no flags) or non-interactively via CLI
-// flags (-role, -port, -wsPort, -wsUrl, -wsListen).
+// It can be launched interactively (no arguments), through subcommands
+// (roj1 host 8080, roj1 client wss://… 9000, ...), or via the original CLI
+// flags (-role, -port, -wsPort, -wsUrl, -wsListen, ...). Every flag can also be
+// set through a ROJ1_* environment variable (see applyEnv) or in the -config
+// file (see applyConfig).
 package main
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
+	"math/big"
+	"net"
 	"net/url"
 	"os"
-	"os/signal"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pterm/pterm"
 
 	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/identity"
 	"github.com/1ureka/roj1/internal/signaling"
+	"github.com/1ureka/roj1/internal/transport"
 	"github.com/1ureka/roj1/internal/util"
 )
 
 var version = "dev"
 
+// defaultRelay is the rendezvous relay used when -relay is not given ("" =
+// none). Builds may set it with -ldflags "-X main.defaultRelay=wss://...".
+var defaultRelay = ""
+
+// Process exit codes, so wrapper scripts can branch on what happened.
+const (
+	exitClean       = 0   // tunnel closed normally
+	exitRuntime     = 1   // tunnel failed after it was established
+	exitUsage       = 2   // invalid or missing flags
+	exitSignaling   = 3   // WebSocket signaling failed
+	exitNegotiation = 4   // WebRTC/ICE negotiation failed
+	exitTimeout     = 5   // establishment did not finish within -timeout or -negotiateTimeout
+	exitInterrupted = 130 // interrupted (Ctrl+C) before the tunnel was established
+)
+
+// runOptions holds the settings shared by every run mode.
+type runOptions struct {
+	persistent      bool                     // host: wait for a new client after the tunnel closes
+	queue           int                      // host: clients that may wait in line while a tunnel is up (0 = refuse them)
+	grpc            bool                     // host: serve signaling over gRPC instead of WebSockets
+	statusPage      bool                     // host: keep the WS server open, serving the tunnel's health at /status
+	server          signaling.Server         // host: signaling server kept open across sessions (nil = a WS server per session)
+	wsListen        bool                     // host: WS server listens on all interfaces
+	wsPath          string                   // host: path the WS server accepts clients at
+	publicURL       string                   // host: URL the client should use (e.g. the forwarded URL)
+	expose          string                   // host: tunnel client publishing the WS port (see exposers), or none
+	relay           string                   // rendezvous relay URL; hosts share a room code instead of a WS URL ("" = none)
+	room            string                   // host: room code on the relay, kept across persistent sessions
+	offerFile       string                   // signal through files: the host's offer ("" = WS signaling)
+	mqtt            string                   // signal through this MQTT broker topic ("" = WS signaling)
+	matrix          signaling.MatrixConfig   // signal through this Matrix room (no Room = WS signaling)
+	drop            signaling.DropConfig     // signal through this dead drop (no URL = WS signaling)
+	answerFile      string                   // signal through files: the client's answer
+	pin             string                   // PIN signaling is encrypted with; auto on the host picks one ("" = none)
+	probe           bool                     // host: check the target port before/after establishment
+	direct          bool                     // host: also offer a direct TLS transport, raced against WebRTC
+	quic            bool                     // host: also offer a direct QUIC transport, raced against WebRTC
+	quicPort        int                      // host: UDP port of the QUIC transport (0 = random)
+	quicPublic      string                   // host: extra public address offered for the QUIC transport
+	interfaces      []string                 // host: bond one PeerConnection per interface
+	bond            transport.BondMode       // host: how packets are spread across bonded paths
+	targetHost      string                   // host: host of the target service (default 127.0.0.1)
+	targetPort      int                      // host: target port from -target (0 = not set)
+	pick            bool                     // host: choose the target port interactively
+	resolveInterval time.Duration            // host: background re-resolution of a named target (0 = per dial)
+	service         adapter.ServiceInfo      // host: label and protocol of the target announced to the client
+	services        map[string]string        // host: named services offered besides the target (name → host:port)
+	uses            map[string]string        // client: services of the host's catalog, or ports of its target's host, to bind (name → local address)
+	serviceGrants   *identity.Grants         // host: per-client service decisions, applied and recorded (nil = none)
+	askServices     bool                     // host: prompt for each service a client binds that has no decision
+	retargetPorts   portRanges               // host: ports the client may switch the target to without asking
+	askRetarget     bool                     // host: prompt for port changes to other ports
+	quotas          adapter.Quotas           // host: limits on what the client can allocate
+	maxSession      time.Duration            // host: close each tunnel this long after it is established (0 = no limit)
+	wakeTimeout     time.Duration            // host: keep redialing a target that is down for this long (0 = no retry)
+	wakeCommand     string                   // host: command starting the target when it is down ("" = none)
+	onUp            string                   // command run when a tunnel is established ("" = none)
+	onDown          string                   // command run when a tunnel closes ("" = none)
+	otlp            string                   // OTLP/HTTP URL spans are exported to ("" = none)
+	validation      adapter.Validation       // checks on inbound packets (Strict is host only)
+	socketChannels  bool                     // client: one ordered DataChannel per socket
+	mux             bool                     // client: multiplex connections as streams of one socket
+	connectTimeout  time.Duration            // client: bound on the host reaching the target (0 = no limit)
+	bind            string                   // client: virtual service listen host (default 127.0.0.1)
+	portBusy        string                   // client: what to do when the virtual service port is taken (see startClient)
+	reusePort       bool                     // client: listen with SO_REUSEPORT
+	drainGrace      time.Duration            // client: how long connections may finish after a shutdown signal
+	network         transport.ICENetwork     // IP families to gather ICE candidates on
+	highWater       int                      // send backpressure high mark in bytes (0 = default)
+	lowWater        int                      // send backpressure low mark in bytes (0 = default)
+	autoTune        bool                     // grow the marks to the bandwidth-delay product
+	pace            bool                     // pace sends to the SCTP congestion window
+	socketQueue     int                      // packets queued per socket before its writer waits (0 = default)
+	queueDrop       bool                     // drop DATA at a full socket queue instead of waiting
+	strictVer       bool                     // refuse a peer with a different major version
+	oneshot         bool                     // never fall back to interactive prompts
+	noTTY           bool                     // no prompts, spinners or styling (containers, log files)
+	healthAddr      string                   // serve readiness/liveness probes on this address ("" = off)
+	pprofAddr       string                   // serve net/http/pprof on this address ("" = off)
+	shape           transport.Shaping        // emulated network path (zero = none)
+	stallTimeout    time.Duration            // report sockets whose data waits this long (0 = never)
+	nack            bool                     // request and answer retransmission of lost packets
+	reassembly      adapter.Reassembly       // reorder buffer limits
+	memLimit        int64                    // degrade gracefully near this much memory (0 = no limit)
+	lowPower        bool                     // smaller buffers and rarer stats for small devices
+	identity        ed25519.PrivateKey       // this side's identity key (nil = none)
+	history         string                   // file completed sessions are recorded in ("" = none)
+	quota           int64                    // transfer quota in bytes (0 = none)
+	quotaMonthly    bool                     // quota covers the calendar month (from history) instead of one session
+	quotaPause      bool                     // pause forwarding once the quota is exceeded
+	authorized      *identity.AuthorizedKeys // host: client keys to accept (nil = anyone)
+	knownHosts      string                   // client: pinned host keys file ("" = no pinning)
+	hostname        string                   // client: name mapped to the virtual service in the hosts file ("" = none)
+	localTLS        *tls.Config              // client: serve TLS on the virtual service (nil = plain TCP)
+	targetTLS       *tls.Config              // host: connect to the target over TLS (nil = plain TCP)
+	sniRoutes       map[string]string        // host: server name → target for TLS connections (nil = none)
+	mirror          *adapter.Mirror          // host: copy of the bridged bytes (nil = none)
+	timeout         time.Duration            // bound on the establishment phase (0 = no limit)
+	negotiate       time.Duration            // bound on the peers connecting once the client arrives (0 = no limit)
+	tcp             adapter.TCPOptions       // socket options for bridged TCP connections
+	config          *configSource            // -config file, re-read on reload (nil = options not from flags)
+}
+
 func main() {
-	// Root context — cancelled on Ctrl+C.
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	// Root context — cancelled on Ctrl+C or SIGTERM.
+	ctx, stop := notifyShutdown()
 	defer stop()
 
-	// CLI flags.
-	role := flag.String("role", "", "Role: host or client")
-	port := flag.Int("port", 0, "Target port (host) or virtual service port (client), 1~65535")
-	wsPortFlag := flag.Int("wsPort", 0, "WebSocket signaling server port (host only)")
-	wsURLFlag := flag.String("wsUrl", "", "WebSocket URL to connect to (client only)")
-	wsListenFlag := flag.Bool("wsListen", false, "Listen on all network interfaces (host only, for LAN access)")
-	debugMode := flag.Bool("debug", false, "Enable debug logging")
-	flag.Parse()
+	// Output language from the locale; -lang overrides it (see sharedFlags).
+	util.SetLang(util.DetectLang())
 
-	if *debugMode {
-		util.EnableDebug()
+	// A leading non-flag argument selects a subcommand; anything else is the
+	// original flag-based mode, kept for compatibility.
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		runCommand(ctx, os.Args[1], os.Args[2:])
+	} else {
+		runFlags(ctx, os.Args[1:])
 	}
+}
 
-	pterm.Info.Println(fmt.Sprintf("Roj1 — v%s", version))
-	pterm.Println()
+// runFlags implements the flag-based CLI (-role, -port, ...). Without -role it
+// falls back to interactive mode.
+func runFlags(ctx context.Context, args []string) {
+	fs := flag.CommandLine
+	role := fs.String("role", "", "Role: host or client")
+	port := fs.Int("port", 0, "Target port (host) or virtual service port (client, 0 = any free port), 1~65535")
+	wsURLFlag := fs.String("wsUrl", "", "WebSocket URL to connect to (client only)")
+	hf := addHostFlags(fs)
+	cf := addClientFlags(fs)
+	sf := addSharedFlags(fs)
+	fs.Parse(args)
+	applyEnv(fs)
+	config := applyConfig(fs, hf)
+
+	opts := sf.apply()
+	opts.config = config
 
 	switch *role {
 	case "":
+		if opts.oneshot {
+			util.LogError("-oneshot requires -role (interactive prompts are disabled)")
+			os.Exit(exitUsage)
+		}
+		if opts.noTTY {
+			util.LogError("-noTty requires -role (interactive prompts are disabled)")
+			os.Exit(exitUsage)
+		}
+
 		// No -role flag → interactive mode.
-		runInteractive(ctx)
+		runInteractive(ctx, cf.apply(hf.apply(opts)))
 
 	case "host":
+		opts = hf.apply(opts)
+		if *port == 0 {
+			*port = opts.targetPort
+		}
+		if *port == 0 && opts.pick {
+			*port = pickPort()
+		}
 		if *port < 1 || *port > 65535 {
 			util.LogError("invalid or missing -port (must be 1~65535)")
-			os.Exit(1)
+			os.Exit(exitUsage)
 		}
 
-		var wsAddr string
+		runHost(ctx, targetPort(opts, *port), hf.wsAddr(), opts)
 
-		switch {
-		case *wsListenFlag:
-			wsAddr = fmt.Sprintf(":%d", *wsPortFlag)
-		case *wsPortFlag > 0:
-			wsAddr = fmt.Sprintf("127.0.0.1:%d", *wsPortFlag)
-		default:
-			wsAddr = ":0"
+	case "client":
+		given := false
+		fs.Visit(func(f *flag.Flag) { given = given || f.Name == "port" })
+		if !given || *port < 0 || *port > 65535 {
+			util.LogError("invalid or missing -port (must be 1~65535, or 0 for any free port)")
+			os.Exit(exitUsage)
 		}
 
-		runHost(ctx, *port, wsAddr)
-
-	case "client":
-		if *port < 1 || *port > 65535 {
-			util.LogError("invalid or missing -port (must be 1~65535)")
-			os.Exit(1)
+		opts = cf.apply(opts)
+		if opts.offerFile != "" || opts.mqtt != "" || opts.matrix.Room != "" || opts.drop.URL != "" {
+			runClient(ctx, *port, "", opts)
+			break
 		}
 
 		if *wsURLFlag == "" {
 			util.LogError("missing -wsUrl for client role")
-			os.Exit(1)
+			os.Exit(exitUsage)
 		}
 
-		wsURL, err := normalizeWSURL(*wsURLFlag)
+		wsURL, err := clientURL(*wsURLFlag, opts.relay)
 
 		if err != nil {
 			util.LogError("%v", err)
-			os.Exit(1)
+			os.Exit(exitUsage)
 		}
 
-		runClient(ctx, *port, wsURL)
+		runClient(ctx, *port, wsURL, opts)
 
 	default:
 		util.LogError("invalid -role: must be 'host' or 'client'")
-		os.Exit(1)
+		os.Exit(exitUsage)
 	}
 
 	util.LogInfo("successfully closed tunnel connection")
@@ -105,84 +245,581 @@ func main() {
 // ---------------------------------------------------------------------------
 
 // runInteractive falls back to the original interactive prompts when no -role
-// flag is provided.
-func runInteractive(ctx context.Context) {
-	role, _ := pterm.DefaultInteractiveSelect.
-		WithOptions([]string{"Host  — Expose a local service", "Client — Connect to a remote host"}).
-		WithDefaultText("Select your role").
-		Show()
+// flag is provided. The previous answers are offered as defaults.
+func runInteractive(ctx context.Context, opts runOptions) {
+	st := loadState()
+
+	hostOption := util.Tr("Host  — Expose a local service")
+	clientOption := util.Tr("Client — Connect to a remote host")
+
+	selectPrinter := pterm.DefaultInteractiveSelect.
+		WithOptions([]string{hostOption, clientOption}).
+		WithDefaultText(util.Tr("Select your role"))
+	if st.Role == "client" {
+		selectPrinter = selectPrinter.WithDefaultOption(clientOption)
+	}
+
+	role, _ := selectPrinter.Show()
 
 	pterm.Println()
 
-	if strings.HasPrefix(role, "Host") {
-		port := askPort("Target port to forward (1 ~ 65535)")
-		runHost(ctx, port, ":0")
+	if role == hostOption {
+		port := askPort(util.Tr("Target port to forward (1 ~ 65535)"), st.HostPort)
+		st.Role, st.HostPort = "host", port
+		saveState(st)
+		runHost(ctx, port, ":0", opts)
+	} else if opts.mqtt != "" || opts.matrix.Room != "" || opts.drop.URL != "" {
+		port := askPort(util.Tr("Local port for virtual service (1 ~ 65535)"), st.ClientPort)
+		runClient(ctx, port, "", opts)
 	} else {
-		wsURL := askURL()
-		port := askPort("Local port for virtual service (1 ~ 65535)")
-		runClient(ctx, port, wsURL)
+		wsURL := askURL(st.WSURL, opts.relay)
+		port := askPort(util.Tr("Local port for virtual service (1 ~ 65535)"), st.ClientPort)
+		st.Role, st.ClientPort, st.WSURL = "client", port, wsURL
+		saveState(st)
+		runClient(ctx, port, wsURL, opts)
 	}
 }
 
-// runHost executes the host-side tunnel logic.
-func runHost(ctx context.Context, port int, wsAddr string) {
-	tr, err := signaling.EstablishAsHost(ctx, wsAddr)
+// establishOptions returns the signaling options for these run options.
+func (o runOptions) establishOptions() signaling.Options {
+	return signaling.Options{
+		Timeout:          o.timeout,
+		NegotiateTimeout: o.negotiate,
+		Direct:           o.direct,
+		QUIC:             o.quic,
+		QUICPort:         o.quicPort,
+		QUICPublic:       o.quicPublic,
+		Interfaces:       o.interfaces,
+		Bond:             o.bond,
+		SocketChannels:   o.socketChannels,
+		Network:          o.network,
+		HighWaterMark:    o.highWater,
+		LowWaterMark:     o.lowWater,
+		AutoTune:         o.autoTune,
+		Pace:             o.pace,
+		LowPower:         o.lowPower,
+		SocketQueue:      o.socketQueue,
+		QueueDrop:        o.queueDrop,
+		Version:          version,
+		StrictVersion:    o.strictVer,
+		Identity:         o.identity,
+		AuthorizedKeys:   o.authorized,
+		KnownHosts:       o.knownHosts,
+		PIN:              o.pin,
+		Server:           o.server,
+		Relay:            o.relay,
+		Room:             o.room,
+		WSPath:           o.wsPath,
+	}
+}
+
+// lowPowerStatsInterval is how often stats are logged with -lowPower.
+const lowPowerStatsInterval = time.Minute
+
+// statsInterval returns how often the stats reporter logs.
+func (o runOptions) statsInterval() time.Duration {
+	if o.lowPower {
+		return lowPowerStatsInterval
+	}
+	return util.StatsInterval
+}
+
+// hostPort joins host (defaulting to IPv4 loopback) and port into an address.
+func hostPort(host string, port int) string {
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// minPINLength is the shortest -pin accepted. Each connection allows one
+// guess, but a PIN of a few characters is still found by a patient attacker.
+const minPINLength = 4
+
+// newPIN returns a random 6-digit PIN for -pin auto.
+func newPIN() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
 	if err != nil {
-		util.LogError("failed to establish tunnel: %v", err)
-		os.Exit(1)
+		return "", err
 	}
-	defer tr.Close()
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
 
-	util.StartStatsReporter(ctx)
-	util.LogSuccess("P2P tunnel established — forwarding traffic to 127.0.0.1:%d", port)
+// runHost executes the host-side tunnel logic. In persistent mode, it returns
+// to waiting for a new client after each tunnel closes, rebinding the same WS
+// port so the published URL stays valid.
+func runHost(ctx context.Context, port int, wsAddr string, opts runOptions) {
+	targetAddr := hostPort(opts.targetHost, port)
 
-	if err := adapter.RunAsHost(ctx, tr, fmt.Sprintf("127.0.0.1:%d", port)); err != nil {
-		util.LogError("failed to handle tunnel connection: %v", err)
-		os.Exit(1)
+	if opts.pin == "auto" {
+		pin, err := newPIN()
+		if err != nil {
+			util.LogError("failed to pick a PIN: %v", err)
+			os.Exit(exitRuntime)
+		}
+		opts.pin = pin
+	}
+
+	if opts.healthAddr != "" {
+		serveHealth(ctx, opts.healthAddr)
+	}
+	if opts.pprofAddr != "" {
+		servePprof(ctx, opts.pprofAddr)
+	}
+	shareOnListening(ctx, port, opts)
+	if opts.wsListen || opts.direct || opts.quic {
+		suggestFirewallAllow()
+	}
+	util.StartStatsReporter(ctx, opts.statsInterval())
+	adapter.WatchMemory(ctx, opts.memLimit)
+
+	if opts.relay != "" {
+		room, err := signaling.NewRoom()
+		if err != nil {
+			util.LogError("failed to create a room code: %v", err)
+			os.Exit(exitRuntime)
+		}
+		opts.room = room
+	}
+	switch {
+	case opts.mqtt != "":
+		printMQTTShare(port, opts)
+	case opts.matrix.Room != "":
+		printMatrixShare(port, opts)
+	case opts.drop.URL != "":
+		printDropShare(port, opts)
+	}
+
+	if opts.grpc || opts.queue > 0 || opts.statusPage {
+		var (
+			l   signaling.Server
+			err error
+		)
+		if opts.grpc {
+			l, err = signaling.ListenGRPC(wsAddr, opts.queue)
+		} else {
+			l, err = signaling.Listen(wsAddr, opts.wsPath, opts.queue)
+		}
+		if err != nil {
+			util.LogError("failed to establish tunnel: %v", err)
+			explainBindError(err)
+			os.Exit(establishExitCode(ctx, err))
+		}
+		defer l.Close()
+		if ws, ok := l.(*signaling.Listener); ok && opts.statusPage {
+			ws.Handle(util.StatusPath, util.StatusHandler())
+		}
+		opts.server = l
+	}
+
+	if opts.probe {
+		probeTarget(targetAddr)
+	}
+
+	var wake func()
+	if opts.wakeCommand != "" {
+		wake = (&waker{ctx: ctx, command: opts.wakeCommand}).wake
+	}
+
+	installHooks("host", opts)
+	exportSpans(ctx, opts.otlp, "host")
+	printBreakdown()
+	watchAttempt()
+	recordHistory("host", opts.history)
+	rl := newReloader(opts)
+	rl.watch(ctx)
+	ctl := serveControl(ctx, rl.reload)
+
+	for {
+		// Settings reloaded between tunnels apply to the next one.
+		opts = rl.options()
+
+		// The authenticated client's policy, if any, applies to this session.
+		var (
+			policy  identity.Policy
+			peer    string
+			peerKey ed25519.PublicKey
+		)
+		estOpts := opts.establishOptions()
+		estOpts.OnAuthenticated = func(key identity.AuthorizedKey) { policy = key.Policy }
+		estOpts.OnPeerKey = func(key ed25519.PublicKey) { peer, peerKey = identity.Fingerprint(key), key }
+
+		var (
+			tr     transport.Carrier
+			wsPort int
+			err    error
+		)
+		switch {
+		case opts.offerFile != "":
+			tr, err = signaling.EstablishAsHostByFile(ctx, opts.offerFile, opts.answerFile, estOpts)
+		case opts.mqtt != "":
+			tr, err = establishOverMQTT(ctx, opts.mqtt, true, estOpts)
+		case opts.matrix.Room != "":
+			tr, err = establishOverMatrix(ctx, opts.matrix, true, estOpts)
+		case opts.drop.URL != "":
+			tr, err = establishOverDrop(ctx, opts.drop, true, estOpts)
+		default:
+			tr, wsPort, err = signaling.EstablishAsHost(ctx, wsAddr, estOpts)
+		}
+		if err != nil {
+			util.EmitEvent(util.Event{Event: util.EventEstablishFailed, Error: err.Error()})
+
+			if !opts.persistent || (wsPort == 0 && opts.relay == "" && opts.mqtt == "" && opts.matrix.Room == "" && opts.drop.URL == "") || ctx.Err() != nil {
+				logEstablishFailure(err, true)
+				explainBindError(err)
+				stopExposed()
+				os.Exit(establishExitCode(ctx, err))
+			}
+
+			util.LogWarning("failed to establish tunnel: %v", err)
+			diagnose(err, true)
+			util.NotifyState(util.StateReconnecting)
+			if opts.relay != "" || opts.mqtt != "" || opts.matrix.Room != "" || opts.drop.URL != "" {
+				// Do not hammer a relay, broker or provider that is down or
+				// refusing us.
+				select {
+				case <-time.After(relayRetryDelay):
+				case <-ctx.Done():
+				}
+				continue
+			}
+			wsAddr = pinPort(wsAddr, wsPort)
+			continue
+		}
+		tr = shape(tr, opts.shape)
+
+		util.EmitEvent(util.Event{Event: util.EventTunnelEstablished, Addr: targetAddr, Peer: peer})
+		util.LogSuccess("P2P tunnel established — forwarding traffic to %s", targetAddr)
+
+		if opts.probe {
+			probeTarget(targetAddr)
+		}
+
+		h, err := adapter.StartAsHostWith(ctx, tr, targetAddr, hostConfig(rl, policy, peer, wake))
+		if err == nil {
+			ctl.attach(h)
+			rl.attach(h, peerKey, policy)
+			err = h.Wait()
+			rl.attach(nil, nil, identity.Policy{})
+			ctl.attach(nil)
+		}
+		tr.Close()
+		util.EmitEvent(util.Event{Event: util.EventTunnelClosed, Reason: closeReason(ctx, tr, err)})
+
+		if errors.Is(err, adapter.ErrSessionLimit) {
+			err = nil // an expected end, like a normal close
+		}
+		if err != nil {
+			util.LogError("failed to handle tunnel connection: %v", err)
+			stopExposed()
+			os.Exit(exitRuntime)
+		}
+
+		if !opts.persistent || ctx.Err() != nil {
+			stopExposed()
+			exitIfFailed(tr)
+			return
+		}
+
+		switch {
+		case opts.relay != "":
+			util.LogInfo("tunnel closed — waiting for a new client in room %s", opts.room)
+		case opts.mqtt != "":
+			util.LogInfo("tunnel closed — waiting for a new client on %s", mqttName(opts.mqtt))
+		case opts.matrix.Room != "":
+			util.LogInfo("tunnel closed — waiting for a new client on %s", opts.matrix.Room)
+		case opts.drop.URL != "":
+			util.LogInfo("tunnel closed — waiting for a new client on %s", opts.drop.URL)
+		default:
+			util.LogInfo("tunnel closed — waiting for a new client on port %d", wsPort)
+		}
+		util.NotifyState(util.StateReconnecting)
+		wsAddr = pinPort(wsAddr, wsPort)
 	}
 }
 
 // runClient executes the client-side tunnel logic.
-func runClient(ctx context.Context, port int, wsURL string) {
-	tr, err := signaling.EstablishAsClient(ctx, wsURL)
+func runClient(ctx context.Context, port int, wsURL string, opts runOptions) {
+	if opts.pin == "auto" {
+		util.LogError("-pin auto only works on the host — give the PIN the host shows")
+		os.Exit(exitUsage)
+	}
+	if opts.healthAddr != "" {
+		serveHealth(ctx, opts.healthAddr)
+	}
+	if opts.pprofAddr != "" {
+		servePprof(ctx, opts.pprofAddr)
+	}
+	// An activated client accepts on the socket systemd holds for it, whose
+	// pending connections wait until the tunnel is up; port is ignored.
+	activated, err := activationListener()
 	if err != nil {
-		util.LogError("failed to establish tunnel: %v", err)
-		os.Exit(1)
+		util.LogError("socket activation: %v", err)
+		os.Exit(exitUsage)
+	}
+	if activated != nil {
+		util.LogInfo("using the socket systemd passed, %s", activated.Addr())
 	}
+
+	installHooks("client", opts)
+	exportSpans(ctx, opts.otlp, "client")
+	printBreakdown()
+	watchAttempt()
+	recordHistory("client", opts.history)
+	rl := newReloader(opts)
+	rl.watch(ctx)
+	ctl := serveControl(ctx, rl.reload)
+
+	tr, peer := establishClient(ctx, wsURL, opts)
 	defer tr.Close()
 
-	util.StartStatsReporter(ctx)
+	util.StartStatsReporter(ctx, opts.statsInterval())
+	adapter.WatchMemory(ctx, opts.memLimit)
 	util.LogSuccess("P2P tunnel established — forwarding traffic to Host")
 
-	if err := adapter.RunAsClient(ctx, tr, fmt.Sprintf("127.0.0.1:%d", port)); err != nil {
+	// The virtual service listens once started, so the event (and -onUp)
+	// can rely on it.
+	h, err := startClient(ctx, tr, port, opts, adapter.ClientConfig{
+		ConnectTimeout: opts.connectTimeout,
+		TCP:            opts.tcp,
+		Validation:     opts.validation,
+		Transfer:       transferQuota(opts),
+		Mux:            opts.mux,
+		LocalTLS:       opts.localTLS,
+		StallTimeout:   opts.stallTimeout,
+		Nack:           opts.nack,
+		Reassembly:     opts.reassembly,
+		Listener:       activated,
+		ReusePort:      opts.reusePort,
+	})
+	if err != nil {
+		util.EmitEvent(util.Event{Event: util.EventTunnelClosed, Reason: closeReason(ctx, tr, err)})
 		util.LogError("failed to handle tunnel connection: %v", err)
-		os.Exit(1)
+		explainBindError(err)
+		os.Exit(exitRuntime)
+	}
+	// With port 0 or another port than asked for, the port is the one
+	// thing a script has to learn.
+	addr := h.Addr().String()
+	_, rawPort, _ := net.SplitHostPort(addr)
+	bound, _ := strconv.Atoi(rawPort)
+	if bound != port && activated == nil {
+		util.LogSuccess("virtual service on local port %d — connect to %s", bound, addr)
+	}
+	util.EmitEvent(util.Event{Event: util.EventTunnelEstablished, Addr: addr, Port: bound, Peer: peer})
+	unregister := registerHostname(opts.hostname, h.Addr())
+	bindServices(ctx, h, opts.uses)
+	ctl.attach(h)
+
+	select {
+	case <-h.Done():
+	case <-ctx.Done():
+		drainClient(h, opts.drainGrace, opts.noTTY || util.JSONEventsEnabled())
 	}
+	unregister()
+	util.EmitEvent(util.Event{Event: util.EventTunnelClosed, Reason: closeReason(ctx, tr, nil)})
+
+	exitIfFailed(tr)
+}
+
+// establishClient establishes the client's transport through the signaling
+// channel selected by opts (wsURL for WebSockets) and returns it with the
+// fingerprint of the host's proven key, if any. It exits on failure.
+func establishClient(ctx context.Context, wsURL string, opts runOptions) (transport.Carrier, string) {
+	var peer string
+	estOpts := opts.establishOptions()
+	estOpts.OnPeerKey = func(key ed25519.PublicKey) { peer = identity.Fingerprint(key) }
+
+	var (
+		tr  transport.Carrier
+		err error
+	)
+	switch {
+	case opts.offerFile != "":
+		tr, err = signaling.EstablishAsClientByFile(ctx, opts.offerFile, opts.answerFile, estOpts)
+	case opts.mqtt != "":
+		tr, err = establishOverMQTT(ctx, opts.mqtt, false, estOpts)
+	case opts.matrix.Room != "":
+		tr, err = establishOverMatrix(ctx, opts.matrix, false, estOpts)
+	case opts.drop.URL != "":
+		tr, err = establishOverDrop(ctx, opts.drop, false, estOpts)
+	default:
+		tr, err = signaling.EstablishAsClient(ctx, wsURL, estOpts)
+	}
+	if err != nil {
+		util.EmitEvent(util.Event{Event: util.EventEstablishFailed, Error: err.Error()})
+		logEstablishFailure(err, false)
+		os.Exit(establishExitCode(ctx, err))
+	}
+	return shape(tr, opts.shape), peer
 }
 
 // ---------------------------------------------------------------------------
 // Helper Functions
 // ---------------------------------------------------------------------------
 
-// normalizeWSURL validates and normalizes a raw WebSocket URL string.
-func normalizeWSURL(raw string) (string, error) {
+// hostConfig returns the host adapter settings for the current run options,
+// narrowed by the authenticated client's policy. peer is the client's key
+// fingerprint ("" = none) and wake the -wakeCommand runner, or nil.
+func hostConfig(rl *reloader, policy identity.Policy, peer string, wake func()) adapter.HostConfig {
+	opts := rl.options()
+	quotas := opts.quotas
+	quotas.MaxSockets = minLimit(quotas.MaxSockets, policy.MaxSockets)
+
+	return adapter.HostConfig{
+		TCP:               opts.tcp,
+		ResolveInterval:   opts.resolveInterval,
+		DialRetry:         opts.wakeTimeout,
+		Wake:              wake,
+		Quotas:            quotas,
+		Validation:        opts.validation,
+		Transfer:          transferQuota(opts),
+		TargetTLS:         opts.targetTLS,
+		SNIRoutes:         opts.sniRoutes,
+		Mirror:            opts.mirror,
+		StallTimeout:      opts.stallTimeout,
+		Nack:              opts.nack,
+		Reassembly:        opts.reassembly,
+		Service:           opts.service,
+		Services:          opts.services,
+		AuthorizeService:  serviceAuthorizer(rl.options, peer),
+		AuthorizeRetarget: retargetAuthorizer(rl.options, peer),
+		AuthorizePort:     portAuthorizer(rl.options, peer),
+		Policy: adapter.Policy{
+			Ports:        policy.Ports,
+			MaxBandwidth: policy.MaxBandwidth,
+			MaxSession:   minLimit(opts.maxSession, policy.MaxSession),
+		},
+	}
+}
+
+// shape wraps tr in the -shape network emulation, if any.
+func shape(tr transport.Carrier, sh transport.Shaping) transport.Carrier {
+	if sh == (transport.Shaping{}) {
+		return tr
+	}
+	util.LogWarning("emulating a slower network through the tunnel: %s", sh)
+	return transport.Shape(tr, sh)
+}
+
+// minLimit returns the stricter of two limits where 0 means unlimited.
+func minLimit[T int | time.Duration](a, b T) T {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// logEstablishFailure reports why establishment failed on the host or the
+// client, with what went wrong and the likely fix (see diagnose), which is no
+// error when the user cancelled it.
+func logEstablishFailure(err error, host bool) {
+	if errors.Is(err, signaling.ErrCancelled) {
+		util.LogWarning("establishment cancelled — everything it started has been shut down")
+		return
+	}
+	util.LogError("failed to establish tunnel: %v", err)
+	diagnose(err, host)
+}
+
+// establishExitCode maps an establishment error to its process exit code.
+func establishExitCode(ctx context.Context, err error) int {
+	switch {
+	case ctx.Err() != nil, errors.Is(err, signaling.ErrCancelled):
+		return exitInterrupted
+	case errors.Is(err, signaling.ErrTimeout):
+		return exitTimeout
+	case errors.Is(err, signaling.ErrNegotiation):
+		return exitNegotiation
+	case errors.Is(err, signaling.ErrSignaling):
+		return exitSignaling
+	default:
+		return exitRuntime
+	}
+}
+
+// closeReason describes why a tunnel session ended, for the tunnel_closed event.
+func closeReason(ctx context.Context, tr transport.Carrier, err error) string {
+	switch {
+	case errors.Is(err, adapter.ErrSessionLimit):
+		return "expired"
+	case err != nil:
+		return "error"
+	case ctx.Err() != nil:
+		return "interrupted"
+	case errors.Is(tr.Err(), transport.ErrConnectionFailed):
+		return "failed"
+	default:
+		return "closed"
+	}
+}
+
+// exitIfFailed exits with exitRuntime when the tunnel was torn down by a
+// connection failure rather than a normal close.
+func exitIfFailed(tr transport.Carrier) {
+	if errors.Is(tr.Err(), transport.ErrConnectionFailed) {
+		util.LogError("tunnel connection lost: %v", tr.Err())
+		os.Exit(exitRuntime)
+	}
+}
+
+// normalizeWSURL validates and normalizes a raw WebSocket URL string: the
+// scheme defaults to wss, and the path to defaultPath (see -wsPath). gRPC URLs
+// (see -grpc) are kept as such.
+func normalizeWSURL(raw, defaultPath string) (string, error) {
 	u, err := url.Parse(strings.TrimSpace(raw))
 	if err != nil || u.Host == "" {
 		return "", fmt.Errorf("invalid WebSocket URL: %s", raw)
 	}
+	if u.Scheme == "grpc" || u.Scheme == "grpcs" {
+		return fmt.Sprintf("%s://%s", u.Scheme, u.Host), nil
+	}
 	scheme := "wss"
 	if u.Scheme == "ws" || u.Scheme == "wss" {
 		scheme = u.Scheme
 	}
-	return fmt.Sprintf("%s://%s/ws", scheme, u.Host), nil
+	p := strings.TrimSuffix(u.Path, "/")
+	if p == "" {
+		p = defaultPath
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, u.Host, p), nil
+}
+
+// probeTimeout bounds the target readiness probe.
+const probeTimeout = 2 * time.Second
+
+// probeTarget dials the target service once and warns if nothing is listening,
+// so the host operator learns about it before the client sees connection resets.
+func probeTarget(addr string) {
+	conn, err := net.DialTimeout("tcp", addr, probeTimeout)
+	if err != nil {
+		util.LogWarning("nothing is listening on %s — clients will be disconnected until the service is started (%v)", addr, err)
+		return
+	}
+	conn.Close()
+	util.LogDebug("target service on %s is reachable", addr)
+}
+
+// pinPort replaces the port in a listen address (e.g. ":0") with the given
+// port, keeping the host part unchanged.
+func pinPort(addr string, port int) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
 }
 
 // askPort prompts the user for a port number until a valid one is entered.
-func askPort(prompt string) int {
+// A non-zero def is pre-filled as the default answer.
+func askPort(prompt string, def int) int {
 	for {
-		raw, _ := pterm.DefaultInteractiveTextInput.
-			WithDefaultText(prompt).
-			Show()
+		input := pterm.DefaultInteractiveTextInput.WithDefaultText(prompt)
+		if def > 0 {
+			input = input.WithDefaultValue(strconv.Itoa(def))
+		}
+
+		raw, _ := input.Show()
 
 		port, err := strconv.Atoi(strings.TrimSpace(raw))
 		if err == nil && port >= 1 && port <= 65535 {
@@ -196,13 +833,23 @@ func askPort(prompt string) int {
 }
 
 // askURL prompts the user for a valid WebSocket URL until one is entered.
-func askURL() string {
+// A non-empty def is pre-filled as the default answer. With a relay, a room
+// code is accepted too.
+func askURL(def, relay string) string {
+	prompt := util.Tr("WebSocket URL (e.g. wss://***.asse.devtunnels.ms/ws)")
+	if relay != "" {
+		prompt = util.Tr("Room code or WebSocket URL (e.g. blue-falcon-421573)")
+	}
 	for {
-		raw, _ := pterm.DefaultInteractiveTextInput.
-			WithDefaultText("WebSocket URL (e.g. wss://***.asse.devtunnels.ms/ws)").
-			Show()
+		input := pterm.DefaultInteractiveTextInput.
+			WithDefaultText(prompt)
+		if def != "" {
+			input = input.WithDefaultValue(def)
+		}
+
+		raw, _ := input.Show()
 
-		wsURL, err := normalizeWSURL(raw)
+		wsURL, err := clientURL(raw, relay)
 		if err == nil {
 			pterm.Println()
 			return wsURL
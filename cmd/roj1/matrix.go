@@ -0,0 +1,21 @@
+package main
+
+import (
+	"context"
+
+	"github.com/1ureka/roj1/internal/signaling"
+	"github.com/1ureka/roj1/internal/transport"
+)
+
+// establishOverMatrix establishes a tunnel as the host or client of the
+// exchange in the -matrix room, joining it anew for each session. The client
+// pins the host's key under the room.
+func establishOverMatrix(ctx context.Context, cfg signaling.MatrixConfig, host bool, opts signaling.Options) (transport.Carrier, error) {
+	return establishOver(ctx, cfg.Room, host, opts, func(ctx context.Context) (signaling.Signaler, error) {
+		s, err := signaling.DialMatrix(ctx, cfg, host)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	})
+}
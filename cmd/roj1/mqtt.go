@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/1ureka/roj1/internal/signaling"
+	"github.com/1ureka/roj1/internal/transport"
+)
+
+// establishOverMQTT establishes a tunnel as the host or client of the
+// exchange on the -mqtt broker topic raw, connecting to the broker anew for
+// each session.
+func establishOverMQTT(ctx context.Context, raw string, host bool, opts signaling.Options) (transport.Carrier, error) {
+	return establishOver(ctx, mqttName(raw), host, opts, func(ctx context.Context) (signaling.Signaler, error) {
+		s, err := signaling.DialMQTT(ctx, raw, host)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	})
+}
+
+// establishOver establishes a tunnel as the host or client of the exchange
+// over the Signaler dial returns; the client pins the host's key under name.
+// The dial counts toward opts.Timeout.
+func establishOver(ctx context.Context, name string, host bool, opts signaling.Options, dial func(context.Context) (signaling.Signaler, error)) (transport.Carrier, error) {
+	dialCtx, cancel := ctx, context.CancelFunc(func() {})
+	if opts.Timeout > 0 {
+		dialCtx, cancel = context.WithTimeoutCause(ctx, opts.Timeout, signaling.ErrTimeout)
+	}
+	s, err := dial(dialCtx)
+	cancel()
+	if err != nil {
+		if dialCtx.Err() != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %w", signaling.ErrSignaling, err)
+	}
+
+	opts.Signaler = s
+	if host {
+		tr, _, err := signaling.EstablishAsHost(ctx, "", opts)
+		return tr, err
+	}
+	return signaling.EstablishAsClient(ctx, name, opts)
+}
+
+// mqttName returns the broker topic URL raw without its credentials, which
+// the host's key is pinned under.
+func mqttName(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	u.User = nil
+	return u.String()
+}
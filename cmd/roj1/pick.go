@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pterm/pterm"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// listening is one listening TCP port and the local addresses bound to it.
+type listening struct {
+	port  int
+	addrs []string
+}
+
+// pickPort lists the listening TCP ports on this machine and lets the user
+// choose one (-pick). Exits if none can be found.
+func pickPort() int {
+	ports, err := listeningPorts()
+	if err != nil {
+		util.LogError("failed to list listening ports: %v", err)
+		os.Exit(exitRuntime)
+	}
+	if len(ports) == 0 {
+		util.LogError("no listening TCP ports found")
+		os.Exit(exitRuntime)
+	}
+
+	options := make([]string, len(ports))
+	for i, l := range ports {
+		options[i] = fmt.Sprintf("%-5d  %s", l.port, strings.Join(l.addrs, ", "))
+	}
+
+	choice, _ := pterm.DefaultInteractiveSelect.
+		WithOptions(options).
+		WithDefaultText(util.Tr("Select the target port to forward")).
+		WithMaxHeight(15).
+		Show()
+	pterm.Println()
+
+	i := slices.Index(options, choice)
+	if i < 0 {
+		util.LogError("no port selected")
+		os.Exit(exitUsage)
+	}
+	return ports[i].port
+}
+
+// listeningPorts returns the listening TCP ports, sorted by port. Linux reads
+// /proc/net/tcp{,6}; other systems parse `netstat -an`.
+func listeningPorts() ([]listening, error) {
+	byPort := make(map[int][]string)
+
+	add := func(ip string, port int) {
+		if !slices.Contains(byPort[port], ip) {
+			byPort[port] = append(byPort[port], ip)
+		}
+	}
+
+	var err error
+	if runtime.GOOS == "linux" {
+		err = procListening(add)
+	} else {
+		err = netstatListening(add)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ports := make([]listening, 0, len(byPort))
+	for port, addrs := range byPort {
+		ports = append(ports, listening{port: port, addrs: addrs})
+	}
+	slices.SortFunc(ports, func(a, b listening) int { return a.port - b.port })
+	return ports, nil
+}
+
+// procListening reads the Linux TCP socket tables. Each line has the local
+// address as hex IP:port in field 1 and the state in field 3 (0A = LISTEN).
+func procListening(add func(ip string, port int)) error {
+	var found bool
+	for _, path := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue // e.g. IPv6 disabled
+		}
+		found = true
+
+		sc := bufio.NewScanner(bytes.NewReader(data))
+		sc.Scan() // header
+		for sc.Scan() {
+			fields := strings.Fields(sc.Text())
+			if len(fields) < 4 || fields[3] != "0A" {
+				continue
+			}
+			rawIP, rawPort, ok := strings.Cut(fields[1], ":")
+			if !ok {
+				continue
+			}
+			ip, err := procIP(rawIP)
+			port, perr := strconv.ParseUint(rawPort, 16, 16)
+			if err != nil || perr != nil {
+				continue
+			}
+			add(ip.String(), int(port))
+		}
+	}
+	if !found {
+		return errors.New("/proc/net/tcp is not readable")
+	}
+	return nil
+}
+
+// procIP decodes a /proc/net/tcp address: the IP bytes in host order, per
+// 32-bit word (little-endian on all common platforms).
+func procIP(s string) (net.IP, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil || (len(b) != net.IPv4len && len(b) != net.IPv6len) {
+		return nil, fmt.Errorf("bad address %q", s)
+	}
+	for i := 0; i < len(b); i += 4 {
+		b[i], b[i+1], b[i+2], b[i+3] = b[i+3], b[i+2], b[i+1], b[i]
+	}
+	return net.IP(b), nil
+}
+
+// netstatListening parses `netstat -an`. The local address is the fourth
+// column on macOS/BSD ("127.0.0.1.5432", "*.5432") and the second on
+// Windows ("0.0.0.0:5432", "[::]:5432").
+func netstatListening(add func(ip string, port int)) error {
+	out, err := exec.Command("netstat", "-an").Output()
+	if err != nil {
+		return err
+	}
+
+	col, sep := 3, "."
+	if runtime.GOOS == "windows" {
+		col, sep = 1, ":"
+	}
+
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) <= col || !strings.HasPrefix(strings.ToLower(fields[0]), "tcp") ||
+			!strings.HasPrefix(fields[len(fields)-1], "LISTEN") {
+			continue
+		}
+
+		local := fields[col]
+		i := strings.LastIndex(local, sep)
+		if i < 0 {
+			continue
+		}
+		port, err := strconv.Atoi(local[i+1:])
+		if err != nil || port < 1 || port > 65535 {
+			continue
+		}
+		add(strings.Trim(local[:i], "[]"), port)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// Handling of a taken virtual service port (see startClient).
+const (
+	busyWait  = 30 * time.Second // -portBusy wait: how long to keep retrying
+	busyRetry = time.Second      // -portBusy wait: between attempts
+	busyNext  = 100              // -portBusy next: how many ports above the one asked for to try
+)
+
+// addrInUse reports whether err is "address already in use".
+func addrInUse(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return errno == wsaEADDRINUSE
+	}
+	return errno == syscall.EADDRINUSE
+}
+
+// startClient starts the client adapter with its virtual service on port of
+// -bind. If the port is taken, -portBusy decides: fail returns the error,
+// wait retries for up to busyWait (e.g. while a previous roj1 shuts down),
+// and next listens on the next free port above it instead. The adapter
+// outlives ctx, so a shutdown can drain it (see drainClient).
+func startClient(ctx context.Context, tr adapter.Transport, port int, opts runOptions, cfg adapter.ClientConfig) (*adapter.Handle, error) {
+	deadline := time.Now().Add(busyWait)
+	asked, warned := port, false
+	for {
+		h, err := adapter.StartAsClientWith(context.WithoutCancel(ctx), tr, hostPort(opts.bind, port), cfg)
+		if err == nil && port != asked {
+			util.LogWarning("local port %d is taken — listening on %d instead", asked, port)
+		}
+		if err == nil || !addrInUse(err) || port == 0 || cfg.Listener != nil {
+			return h, err
+		}
+
+		switch opts.portBusy {
+		case "wait":
+			if time.Now().After(deadline) {
+				return nil, err
+			}
+			if !warned {
+				util.LogWarning("local port %d is taken — retrying for up to %v", port, busyWait)
+				warned = true
+			}
+			select {
+			case <-time.After(busyRetry):
+			case <-ctx.Done():
+				return nil, err
+			}
+		case "next":
+			if port-asked >= busyNext || port == 65535 {
+				return nil, err
+			}
+			port++
+		default:
+			return nil, err
+		}
+	}
+}
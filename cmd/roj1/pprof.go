@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// servePprof serves net/http/pprof on addr until ctx is cancelled. An addr
+// without a host (e.g. ":6060") listens on loopback only, since profiles
+// expose the process's internals. Exits with exitRuntime if addr cannot be
+// listened on.
+func servePprof(ctx context.Context, addr string) {
+	if host, port, err := net.SplitHostPort(addr); err == nil && host == "" {
+		addr = net.JoinHostPort("127.0.0.1", port)
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		util.LogError("failed to start pprof endpoint: %v", err)
+		os.Exit(exitRuntime)
+	}
+	util.LogInfo("pprof endpoint listening on http://%s/debug/pprof/", ln.Addr())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	srv := &http.Server{Handler: mux}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			util.LogWarning("pprof endpoint stopped: %v", err)
+		}
+	}()
+}
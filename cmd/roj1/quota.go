@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/history"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// parseSize parses a byte count with an optional binary suffix, e.g. "512M",
+// "50GiB" or "1T". "" is 0.
+func parseSize(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	num := strings.ToUpper(s)
+	num = strings.TrimSuffix(num, "B")
+	num = strings.TrimSuffix(num, "I")
+
+	mult := int64(1)
+	if num != "" {
+		if i := strings.IndexByte("KMGT", num[len(num)-1]); i >= 0 {
+			mult = 1 << (10 * (i + 1))
+			num = num[:len(num)-1]
+		}
+	}
+
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("want a positive size such as 512M or 50GiB")
+	}
+	return n * mult, nil
+}
+
+// transferQuota returns the -quota settings for a new tunnel. With
+// -quotaPeriod month, the sessions recorded in -history since the start of
+// the month count towards it.
+func transferQuota(opts runOptions) adapter.Transfer {
+	t := adapter.Transfer{Limit: opts.quota, Pause: opts.quotaPause}
+	if t.Limit == 0 || !opts.quotaMonthly {
+		return t
+	}
+
+	sessions, err := history.Load(opts.history)
+	if err != nil {
+		util.LogWarning("failed to read session history: %v", err)
+		return t
+	}
+	now := time.Now()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	used := history.Sum(history.Since(sessions, month))
+	t.Used = used.BytesIn + used.BytesOut
+
+	util.LogInfo("%s of the %s monthly transfer quota used", strings.TrimSpace(util.FormatBytes(float64(t.Used))), strings.TrimSpace(util.FormatBytes(float64(t.Limit))))
+	return t
+}
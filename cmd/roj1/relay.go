@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/1ureka/roj1/internal/signaling"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// relayRetryDelay is how long a persistent host waits before reopening its
+// room after establishment through the relay failed.
+const relayRetryDelay = 5 * time.Second
+
+// runRelay implements "roj1 relay": it serves rooms where hosts and clients
+// meet by code (see signaling.Relay) until ctx is done. Only signaling goes
+// through the relay, so it needs little bandwidth; put a TLS-terminating
+// proxy in front of it to offer a wss:// URL.
+func runRelay(ctx context.Context, addr string) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		util.LogError("failed to start the relay: %v", err)
+		explainBindError(err)
+		os.Exit(exitRuntime)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/rooms/", signaling.NewRelay())
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	context.AfterFunc(ctx, func() { srv.Close() })
+
+	util.LogSuccess("relay listening on %s — hosts and clients use -relay ws://<this machine>:%d",
+		ln.Addr(), ln.Addr().(*net.TCPAddr).Port)
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		util.LogError("relay stopped: %v", err)
+		os.Exit(exitRuntime)
+	}
+}
+
+// clientURL returns the WebSocket URL a client connects to for raw, either a
+// host's URL or a room code on the relay.
+func clientURL(raw, relay string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if !signaling.ValidRoom(raw) {
+		return normalizeWSURL(raw, signaling.DefaultWSPath)
+	}
+	if relay == "" {
+		return "", fmt.Errorf("%s is a room code, which needs -relay (or ROJ1_RELAY)", raw)
+	}
+	return signaling.RoomURL(relay, raw, "client")
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/identity"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// Configuration file (-config): flag settings, one "name = value" per line
+// ("#" starts a comment, a repeatable flag may appear on several lines),
+// below the command line and the ROJ1_* environment variables. A running
+// host or client re-reads it on SIGHUP or "roj1 reload" and applies the
+// settings in reloadable without re-signaling, to the tunnel that is up too;
+// the others take effect on the next start.
+
+// reloadable lists the flags a reload applies.
+var reloadable = map[string]bool{
+	"debug":          true,
+	"authorizedKeys": true,
+	"serviceGrants":  true,
+	"askServices":    true,
+	"service":        true,
+	"retargetPorts":  true,
+	"askRetarget":    true,
+	"maxSockets":     true,
+	"maxBuffer":      true,
+	"maxPacketRate":  true,
+}
+
+// configSetting is one line of a config file.
+type configSetting struct {
+	line        int
+	name, value string
+}
+
+// readConfig parses a config file. A missing file has no settings.
+func readConfig(path string) ([]configSetting, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var settings []configSetting
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimLeft(strings.TrimSpace(name), "-")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("line %d: want name = value", n)
+		}
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(value, `"`) {
+			if value, err = strconv.Unquote(value); err != nil {
+				return nil, fmt.Errorf("line %d: invalid quoted value", n)
+			}
+		}
+		settings = append(settings, configSetting{line: n, name: name, value: value})
+	}
+	return settings, sc.Err()
+}
+
+// configSource is the -config file of a run, with the flags it cannot
+// change.
+type configSource struct {
+	path  string
+	fs    *flag.FlagSet
+	hf    *hostFlags      // nil on a client
+	fixed map[string]bool // given on the command line or through the environment
+}
+
+// applyConfig sets every flag of fs not given on the command line or through
+// the environment from the -config file. hf are the host flags of fs, if
+// any. Exits with exitUsage on an invalid file.
+func applyConfig(fs *flag.FlagSet, hf *hostFlags) *configSource {
+	c := &configSource{fs: fs, hf: hf, fixed: make(map[string]bool)}
+	fs.Visit(func(f *flag.Flag) { c.fixed[f.Name] = true })
+	if f := fs.Lookup("config"); f != nil {
+		c.path = f.Value.String()
+	}
+	if c.path == "" {
+		return c
+	}
+
+	settings, err := readConfig(c.path)
+	if err == nil {
+		for _, s := range settings {
+			if err = c.set(s, false); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		util.LogError("invalid -config %s: %v", c.path, err)
+		os.Exit(exitUsage)
+	}
+	return c
+}
+
+// set applies one setting unless its flag is fixed; with onlyReloadable, the
+// change of any other flag is only reported.
+func (c *configSource) set(s configSetting, onlyReloadable bool) error {
+	f := c.fs.Lookup(s.name)
+	switch {
+	case s.name == "config":
+		return fmt.Errorf("line %d: -config cannot be set in the config file", s.line)
+	case f == nil:
+		util.LogWarning("%s, line %d: unknown setting %q", c.path, s.line, s.name)
+		return nil
+	case c.fixed[s.name]:
+		return nil
+	case onlyReloadable && !reloadable[s.name]:
+		if _, list := f.Value.(*listFlag); !list && f.Value.String() != s.value {
+			util.LogWarning("-%s changed in %s — restart roj1 to apply it", s.name, c.path)
+		}
+		return nil
+	}
+	if err := c.fs.Set(s.name, s.value); err != nil {
+		return fmt.Errorf("line %d: invalid %s: %w", s.line, s.name, err)
+	}
+	return nil
+}
+
+// reloader holds the options of a running host or client, and re-applies
+// its -config file to them and to the tunnel that is up.
+type reloader struct {
+	config *configSource // nil = options not from flags
+
+	mu     sync.Mutex
+	opts   runOptions
+	h      *adapter.Handle   // nil between tunnels
+	peer   ed25519.PublicKey // the client's proven key (host), nil = none
+	policy identity.Policy   // the client's policy from -authorizedKeys (host)
+}
+
+// newReloader returns a reloader starting from opts.
+func newReloader(opts runOptions) *reloader {
+	return &reloader{config: opts.config, opts: opts}
+}
+
+// options returns the current options.
+func (r *reloader) options() runOptions {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.opts
+}
+
+// attach makes reloads apply to h's tunnel (nil = no tunnel is up), with the
+// client's key and policy on a host.
+func (r *reloader) attach(h *adapter.Handle, peer ed25519.PublicKey, policy identity.Policy) {
+	r.mu.Lock()
+	r.h, r.peer, r.policy = h, peer, policy
+	r.mu.Unlock()
+}
+
+// watch reloads on SIGHUP until ctx is cancelled.
+func (r *reloader) watch(ctx context.Context) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(sigs)
+		for {
+			select {
+			case <-sigs:
+				if err := r.reload(); err != nil {
+					util.LogWarning("failed to reload the configuration: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// reload re-reads the config file and applies the reloadable settings to the
+// options and the tunnel that is up. Settings no longer in the file go back
+// to their defaults. On an error nothing is applied.
+func (r *reloader) reload() error {
+	c := r.config
+	if c == nil || c.path == "" {
+		return errors.New("no -config file to reload")
+	}
+	settings, err := readConfig(c.path)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c.fs.VisitAll(func(f *flag.Flag) {
+		if !reloadable[f.Name] || c.fixed[f.Name] {
+			return
+		}
+		if l, ok := f.Value.(*listFlag); ok {
+			*l = nil
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+	})
+	for _, s := range settings {
+		if err := c.set(s, true); err != nil {
+			return err
+		}
+	}
+
+	opts := r.opts
+	if c.hf != nil {
+		if opts, err = c.hf.applyReloadable(opts); err != nil {
+			return err
+		}
+	}
+	if f := c.fs.Lookup("debug"); f != nil {
+		if f.Value.String() == "true" {
+			util.EnableDebug()
+		} else {
+			util.DisableDebug()
+		}
+	}
+	old := r.opts
+	r.opts = opts
+	util.LogSuccess("configuration reloaded from %s", c.path)
+
+	if r.h == nil || c.hf == nil {
+		return nil
+	}
+	if opts.authorized != nil {
+		key, ok := opts.authorized.Lookup(r.peer)
+		if !ok {
+			util.LogWarning("the client's key is no longer in -authorizedKeys — closing the tunnel")
+			go r.h.Close(context.Background())
+			return nil
+		}
+		r.policy = key.Policy
+	}
+	quotas := opts.quotas
+	quotas.MaxSockets = minLimit(quotas.MaxSockets, r.policy.MaxSockets)
+	r.h.SetQuotas(quotas)
+	if !maps.Equal(old.services, opts.services) {
+		r.h.SetServices(opts.services)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// retargetWait bounds how long a client waits for the host to answer a port
+// change, which may need the host's operator.
+const retargetWait = time.Minute
+
+// portRanges is a set of ports given as a comma-separated list of ports and
+// ranges, e.g. 3000-3010,8080.
+type portRanges [][2]int
+
+// parsePortRanges parses a list such as "3000-3010,8080".
+func parsePortRanges(s string) (portRanges, error) {
+	var r portRanges
+	for item := range strings.SplitSeq(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(item, "-")
+		first, err := strconv.Atoi(lo)
+		last := first
+		if err == nil && isRange {
+			last, err = strconv.Atoi(hi)
+		}
+		if err != nil || first < 1 || last > 65535 || first > last {
+			return nil, fmt.Errorf("%q: want a port or a range such as 3000-3010", item)
+		}
+		r = append(r, [2]int{first, last})
+	}
+	return r, nil
+}
+
+// contains reports whether port is in one of the ranges.
+func (r portRanges) contains(port int) bool {
+	return slices.ContainsFunc(r, func(pr [2]int) bool { return port >= pr[0] && port <= pr[1] })
+}
+
+// retargetAuthorizer returns the adapter.HostConfig.AuthorizeRetarget of a
+// session with the client whose key fingerprint is peer, deciding with the
+// current options: ports in -retargetPorts are allowed, and -askRetarget
+// prompts the operator for the others. Without either flag port changes are
+// refused.
+func retargetAuthorizer(current func() runOptions, peer string) func(context.Context, int) error {
+	return otherPortAuthorizer(current, peer, "the host does not allow port changes", "Let %s switch the target to port %d?")
+}
+
+// portAuthorizer returns the adapter.HostConfig.AuthorizePort of a session
+// with the client whose key fingerprint is peer, deciding like
+// retargetAuthorizer: the ports a client may switch the target to are those
+// it may bind with -map too.
+func portAuthorizer(current func() runOptions, peer string) func(context.Context, int) error {
+	return otherPortAuthorizer(current, peer, "the host does not allow other ports", "Let %s connect to port %d of the target's host?")
+}
+
+// otherPortAuthorizer decides on the ports of the target's host besides its
+// own with -retargetPorts and -askRetarget, asking the operator question
+// (formatted with the client and the port). Without either flag, every port
+// is refused with refusal.
+func otherPortAuthorizer(current func() runOptions, peer, refusal, question string) func(context.Context, int) error {
+	return func(ctx context.Context, port int) error {
+		opts := current()
+		ports, ask := opts.retargetPorts, opts.askRetarget
+		if len(ports) == 0 && !ask {
+			return errors.New(refusal)
+		}
+
+		if ports.contains(port) {
+			return nil
+		}
+		if !ask {
+			return errors.New("the port is not in the host's -retargetPorts")
+		}
+		if !askRetarget(ctx, peer, port, question) {
+			return errors.New("denied by the host's operator")
+		}
+		return nil
+	}
+}
+
+// askRetarget asks the operator question about the client and port. A
+// prompt that cannot start before ctx is done counts as a denial.
+func askRetarget(ctx context.Context, peer string, port int, question string) bool {
+	promptMu.Lock()
+	defer promptMu.Unlock()
+	if ctx.Err() != nil {
+		return false
+	}
+
+	who := peer
+	if who == "" {
+		who = util.Tr("the client")
+	}
+	allow, _ := pterm.DefaultInteractiveConfirm.
+		WithDefaultText(util.Trf(question, who, port)).
+		Show()
+	pterm.Println()
+	return allow
+}
+
+// runRetarget implements "roj1 retarget": it asks the host of a running
+// client's tunnel to forward to another port.
+func runRetarget(pid, port int) {
+	if err := controlRequest(pid, controlRetargetPath, strconv.Itoa(port)); err != nil {
+		util.LogError("failed to change the target port: %v", err)
+		os.Exit(exitRuntime)
+	}
+	util.LogSuccess("the host now forwards new connections to port %d", port)
+}
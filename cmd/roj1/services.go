@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/hosts"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// bindTimeout bounds how long the client waits for the host to grant a
+// -use service, and "roj1 services" for the catalog.
+const bindTimeout = 10 * time.Second
+
+// listFlag is a flag that may be repeated; each value may also hold several
+// comma-separated items (as from a ROJ1_* variable).
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(value string) error {
+	for item := range strings.SplitSeq(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// parseServices parses -service (host: name=port or name=host:port, a bare
+// port on targetHost) or -use (client: name=port, a local port on bindHost)
+// into addresses by lower-cased name.
+func parseServices(items []string, host string, remote bool) (map[string]string, error) {
+	want := "name=port"
+	if remote {
+		want = "name=port or name=host:port"
+	}
+
+	services := make(map[string]string, len(items))
+	for _, item := range items {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok || !hosts.ValidName(name) {
+			return nil, fmt.Errorf("%q: want %s", item, want)
+		}
+		addr := value
+		if port, err := strconv.Atoi(value); err == nil {
+			if port < 1 || port > 65535 {
+				return nil, fmt.Errorf("%q: port must be 1~65535", item)
+			}
+			addr = hostPort(host, port)
+		} else if h, p, err := net.SplitHostPort(value); !remote || err != nil || h == "" || p == "" {
+			return nil, fmt.Errorf("%q: want %s", item, want)
+		}
+		name = strings.ToLower(name)
+		if _, dup := services[name]; dup {
+			return nil, fmt.Errorf("%q: service %s given twice", item, name)
+		}
+		services[name] = addr
+	}
+	return services, nil
+}
+
+// parseMaps parses -map items (local:service or local:port, e.g. 2222:ssh or
+// 8080:5173) into local addresses on host by lower-cased service name or port,
+// adding them to uses. A local port of 0 picks any free port.
+func parseMaps(items []string, host string, uses map[string]string) error {
+	for _, item := range items {
+		local, remote, ok := strings.Cut(item, ":")
+		port, err := strconv.Atoi(local)
+		if !ok || err != nil || port < 0 || port > 65535 {
+			return fmt.Errorf("%q: want localPort:service or localPort:port", item)
+		}
+		name := strings.ToLower(remote)
+		if n, err := strconv.Atoi(remote); err == nil {
+			if n < 1 || n > 65535 {
+				return fmt.Errorf("%q: port must be 1~65535", item)
+			}
+			name = strconv.Itoa(n)
+		} else if !hosts.ValidName(remote) {
+			return fmt.Errorf("%q: want localPort:service or localPort:port", item)
+		}
+		if _, dup := uses[name]; dup {
+			return fmt.Errorf("%q: %s is bound twice", item, name)
+		}
+		uses[name] = hostPort(host, port)
+	}
+	return nil
+}
+
+// bindServices binds each -use or -map service of the host's catalog, or
+// port of its target's host, to its local address. A service the host
+// refuses is reported and skipped.
+func bindServices(ctx context.Context, h *adapter.Handle, uses map[string]string) {
+	for name, addr := range uses {
+		bctx, cancel := context.WithTimeout(ctx, bindTimeout)
+		_, err := h.Bind(bctx, name, addr)
+		cancel()
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			util.LogWarning("the host did not answer the request for service %s — it may predate service catalogs", name)
+		case err != nil:
+			util.LogWarning("cannot use service %s: %v", name, err)
+			explainBindError(err)
+		}
+	}
+}
+
+// runServices implements "roj1 services": it connects to the host like a
+// client, prints the services of its catalog and disconnects.
+func runServices(ctx context.Context, wsURL string, opts runOptions) {
+	tr, _ := establishClient(ctx, wsURL, opts)
+	defer tr.Close()
+
+	h, err := adapter.StartAsClientWith(ctx, tr, "", adapter.ClientConfig{Validation: opts.validation})
+	if err != nil {
+		util.LogError("failed to handle tunnel connection: %v", err)
+		os.Exit(exitRuntime)
+	}
+
+	cctx, cancel := context.WithTimeout(ctx, bindTimeout)
+	services, err := h.Catalog(cctx)
+	cancel()
+	if err != nil {
+		util.LogError("the host did not announce its services: %v", err)
+		os.Exit(exitRuntime)
+	}
+
+	target, _ := h.Service()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, util.Tr("NAME\tPORT\tDESCRIPTION"))
+	fmt.Fprintf(w, "%s\t%d\t%s\n", "-", target.Port, target.Description())
+	for _, s := range services {
+		fmt.Fprintf(w, "%s\t%d\t\n", s.Name, s.Port)
+	}
+	w.Flush()
+
+	if len(services) == 0 {
+		util.LogInfo("the host offers no named services, only its main target")
+	}
+	h.Close(ctx)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/pterm/pterm"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// shareOnListening prints the one-line client command once the host's WS
+// signaling server is listening, and copies it to the clipboard when the URL
+// is fully known. It is shown once per process; in persistent mode the WS port
+// (and thus the URL) stays the same across sessions. With -expose, the WS port
+// is first published through a tunnel client that lasts until ctx is done.
+// With -relay, the command names the host's room instead, which also stays the
+// same across sessions.
+func shareOnListening(ctx context.Context, port int, opts runOptions) {
+	var once sync.Once
+
+	util.SubscribeEvents(func(ev util.Event) {
+		if ev.Event == util.EventRoomOpened {
+			once.Do(func() { printRoomShare(port, ev.Room, opts) })
+			return
+		}
+		if ev.Event != util.EventWSListening {
+			return
+		}
+		once.Do(func() {
+			if opts.expose == "none" {
+				printShare(port, ev.Port, opts)
+				return
+			}
+			go func() {
+				wsURL, err := expose(ctx, opts.expose, ev.Port, opts.wsPath)
+				if err != nil {
+					util.LogWarning("failed to publish the WS port with %s: %v", opts.expose, err)
+				} else {
+					util.LogSuccess("WS port %d published at %s", ev.Port, wsURL)
+					opts.publicURL = wsURL
+				}
+				printShare(port, ev.Port, opts)
+			}()
+		})
+	})
+}
+
+// printShare builds and prints the client command for the given WS port.
+func printShare(port, wsPort int, opts runOptions) {
+	wsURL := opts.publicURL
+	switch {
+	case wsURL != "":
+	case opts.wsListen && opts.grpc:
+		wsURL = fmt.Sprintf("grpc://%s", net.JoinHostPort(lanIP(), fmt.Sprint(wsPort)))
+	case opts.wsListen:
+		wsURL = fmt.Sprintf("ws://%s%s", net.JoinHostPort(lanIP(), fmt.Sprint(wsPort)), opts.wsPath)
+	default:
+		wsURL = "<forwarded-url>"
+	}
+
+	cmd := fmt.Sprintf("roj1 -role client -wsUrl %s -port %d", wsURL, port)
+	if opts.pin != "" {
+		cmd += " -pin " + opts.pin
+	}
+
+	var note string
+	switch {
+	case wsURL == "<forwarded-url>":
+		note = util.Trf("Forward port %d (Public) and replace <forwarded-url> with the Forwarded URL.", wsPort)
+	case copyToClipboard(cmd) == nil:
+		note = util.Tr("Copied to clipboard.")
+	default:
+		note = util.Tr("Copy this line and send it to your peer.")
+	}
+	if u := statusURL(wsURL); opts.statusPage && u != "" {
+		note += " " + util.Trf("Tunnel health: %s", u)
+	}
+
+	shareBox(cmd, note)
+}
+
+// statusURL returns the -statusPage URL next to a WS URL, or "" if wsURL is
+// not one.
+func statusURL(wsURL string) string {
+	u, err := url.Parse(wsURL)
+	if err != nil {
+		return ""
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	default:
+		return ""
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/ws") + util.StatusPath
+	u.RawPath, u.RawQuery = "", ""
+	return u.String()
+}
+
+// printRoomShare prints the client command joining room on the relay. The
+// relay is left out when it is the built-in default.
+func printRoomShare(port int, room string, opts runOptions) {
+	cmd := fmt.Sprintf("roj1 client %s %d", room, port)
+	if opts.relay != defaultRelay {
+		cmd = fmt.Sprintf("roj1 client -relay %s %s %d", opts.relay, room, port)
+	}
+	if opts.pin != "" {
+		cmd = strings.Replace(cmd, "roj1 client ", "roj1 client -pin "+opts.pin+" ", 1)
+	}
+
+	note := util.Trf("Or just tell your peer the code %s.", room)
+	if copyToClipboard(cmd) == nil {
+		note = util.Tr("Copied to clipboard.") + " " + note
+	}
+	shareBox(cmd, note)
+}
+
+// printMQTTShare prints the client command signaling through the same broker
+// topic.
+func printMQTTShare(port int, opts runOptions) {
+	cmd := fmt.Sprintf("roj1 client -mqtt %s %d", opts.mqtt, port)
+	if opts.pin != "" {
+		cmd = strings.Replace(cmd, "roj1 client ", "roj1 client -pin "+opts.pin+" ", 1)
+	}
+
+	note := util.Tr("Copy this line and send it to your peer.")
+	if copyToClipboard(cmd) == nil {
+		note = util.Tr("Copied to clipboard.")
+	}
+	shareBox(cmd, note)
+}
+
+// printMatrixShare prints the client command signaling through the same
+// Matrix room. The peer posts with an account of their own, so the token is
+// left out.
+func printMatrixShare(port int, opts runOptions) {
+	cmd := fmt.Sprintf("roj1 client -matrix '%s' %d", opts.matrix.Room, port)
+	if opts.pin != "" {
+		cmd = strings.Replace(cmd, "roj1 client ", "roj1 client -pin "+opts.pin+" ", 1)
+	}
+
+	note := util.Tr("Copy this line and send it to your peer; they need ROJ1_MATRIX_TOKEN set to their own account's access token.")
+	if copyToClipboard(cmd) == nil {
+		note = util.Tr("Copied to clipboard. Your peer needs ROJ1_MATRIX_TOKEN set to their own account's access token.")
+	}
+	shareBox(cmd, note)
+}
+
+// printDropShare prints the client command signaling through the same dead
+// drop. The credentials are left out: the peer brings their own.
+func printDropShare(port int, opts runOptions) {
+	cmd := fmt.Sprintf("roj1 client -drop %s %d", opts.drop.URL, port)
+	if opts.pin != "" {
+		cmd = strings.Replace(cmd, "roj1 client ", "roj1 client -pin "+opts.pin+" ", 1)
+	}
+
+	note := util.Tr("Copy this line and send it to your peer; they need their own credentials for the drop.")
+	if copyToClipboard(cmd) == nil {
+		note = util.Tr("Copied to clipboard. Your peer needs their own credentials for the drop.")
+	}
+	shareBox(cmd, note)
+}
+
+// shareBox prints cmd and a note on how to pass it on.
+func shareBox(cmd, note string) {
+	pterm.DefaultBox.
+		WithTitle(util.Tr("Share with your peer")).
+		Println(cmd + "\n\n" + note)
+}
+
+// lanIP returns the IP of the interface used for outbound traffic, falling
+// back to loopback. No packets are sent: dialing UDP only selects a route.
+func lanIP() string {
+	conn, err := net.Dial("udp", "8.8.8.8:80")
+	if err != nil {
+		return "127.0.0.1"
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String()
+}
+
+// clipboardCommands lists the clipboard tools tried on each OS, in order.
+var clipboardCommands = map[string][][]string{
+	"darwin":  {{"pbcopy"}},
+	"windows": {{"clip"}},
+	"linux":   {{"wl-copy"}, {"xclip", "-selection", "clipboard"}, {"xsel", "--clipboard", "--input"}},
+}
+
+// copyToClipboard pipes text into the first available clipboard tool.
+func copyToClipboard(text string) error {
+	for _, args := range clipboardCommands[runtime.GOOS] {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		return cmd.Run()
+	}
+	return errors.New("no clipboard tool available")
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// lastState holds the most recent interactive-mode choices, offered as
+// defaults the next time the prompts are shown.
+type lastState struct {
+	Role       string `json:"role,omitempty"` // "host" or "client"
+	HostPort   int    `json:"hostPort,omitempty"`
+	ClientPort int    `json:"clientPort,omitempty"`
+	WSURL      string `json:"wsUrl,omitempty"`
+}
+
+// statePath returns the location of the state file
+// (e.g. ~/.config/roj1/state.json on Linux).
+func statePath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "roj1", "state.json"), nil
+}
+
+// loadState reads the state file. A missing or unreadable file yields an
+// empty state — remembered settings are a convenience, never a requirement.
+func loadState() lastState {
+	var st lastState
+
+	path, err := statePath()
+	if err != nil {
+		return st
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return st
+	}
+
+	if err := json.Unmarshal(data, &st); err != nil {
+		util.LogDebug("ignoring malformed state file %s: %v", path, err)
+		return lastState{}
+	}
+	return st
+}
+
+// saveState writes the state file, logging (but otherwise ignoring) failures.
+func saveState(st lastState) {
+	path, err := statePath()
+	if err != nil {
+		util.LogDebug("failed to locate state file: %v", err)
+		return
+	}
+
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		util.LogDebug("failed to create state directory: %v", err)
+		return
+	}
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		util.LogDebug("failed to save state file: %v", err)
+	}
+}
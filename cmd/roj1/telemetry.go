@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// flushTimeout bounds the export of the spans still buffered when a tunnel
+// closes or fails to come up, which roj1 may exit right after.
+const flushTimeout = 5 * time.Second
+
+// parseOTLPEndpoint checks an -otlp collector URL and returns the URL spans
+// are posted to: the path defaults to /v1/traces, as with
+// OTEL_EXPORTER_OTLP_ENDPOINT.
+func parseOTLPEndpoint(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("%q: want an http or https URL such as http://localhost:4318", raw)
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		u.Path = "/v1/traces"
+	}
+	return u.String(), nil
+}
+
+// exportSpans sends OpenTelemetry spans to the OTLP/HTTP collector at
+// endpoint (see parseOTLPEndpoint) until ctx is done, built from the event
+// bus:
+//
+//	roj1.establish    from the start of signaling to the tunnel coming up or failing,
+//	                  with a child span per phase (see util.EventPhase)
+//	roj1.tunnel       from establishment to the tunnel closing, with the phases
+//	                  that end later, such as first_message
+//	roj1.connection   each bridged connection, as a child of roj1.tunnel
+//
+// Export failures are reported by the OpenTelemetry SDK and otherwise
+// ignored.
+func exportSpans(ctx context.Context, endpoint, role string) {
+	if endpoint == "" {
+		return
+	}
+	exp, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		util.LogWarning("OpenTelemetry export disabled: %v", err)
+		return
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "roj1"),
+			attribute.String("service.version", version),
+			attribute.String("roj1.role", role),
+		)),
+	)
+	go func() {
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+		tp.Shutdown(sctx)
+		cancel()
+	}()
+
+	s := &spans{tracer: tp.Tracer("github.com/1ureka/roj1"), conns: make(map[string]trace.Span)}
+	util.SubscribeEvents(func(ev util.Event) {
+		s.handle(ev)
+		if ev.Event == util.EventTunnelClosed || ev.Event == util.EventEstablishFailed {
+			fctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+			tp.ForceFlush(fctx)
+			cancel()
+		}
+	})
+}
+
+// spans turns events into the spans of exportSpans.
+type spans struct {
+	tracer trace.Tracer
+
+	mu        sync.Mutex
+	establish trace.Span // nil outside establishment
+	estCtx    context.Context
+	tunnel    trace.Span // nil while no tunnel is up
+	tunCtx    context.Context
+	conns     map[string]trace.Span // by socket ID
+}
+
+func (s *spans) handle(ev util.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch ev.Event {
+	case util.EventStateChanged:
+		if ev.State == util.StateSignaling.String() && s.establish == nil {
+			s.estCtx, s.establish = s.tracer.Start(context.Background(), "roj1.establish", trace.WithTimestamp(ev.Time))
+		}
+
+	case util.EventPhase:
+		parent := s.estCtx
+		switch {
+		case s.establish != nil && ev.Phase == util.PhaseEstablish:
+			s.establish.End(trace.WithTimestamp(ev.Time))
+			s.establish = nil
+			return
+		case s.establish == nil && s.tunnel != nil:
+			parent = s.tunCtx // e.g. the first message, after establishment
+		case s.establish == nil:
+			return
+		}
+		_, span := s.tracer.Start(parent, "roj1."+ev.Phase, trace.WithTimestamp(ev.Time.Add(-ev.Duration)))
+		span.End(trace.WithTimestamp(ev.Time))
+
+	case util.EventEstablishFailed:
+		if s.establish != nil {
+			s.establish.SetStatus(codes.Error, ev.Error)
+			s.establish.End(trace.WithTimestamp(ev.Time))
+			s.establish = nil
+		}
+
+	case util.EventTunnelEstablished:
+		if s.establish != nil { // not ended by an establish phase
+			s.establish.End(trace.WithTimestamp(ev.Time))
+			s.establish = nil
+		}
+		s.tunCtx, s.tunnel = s.tracer.Start(context.Background(), "roj1.tunnel",
+			trace.WithTimestamp(ev.Time),
+			trace.WithAttributes(attribute.String("roj1.addr", ev.Addr), attribute.String("roj1.peer", ev.Peer)))
+
+	case util.EventTunnelClosed:
+		for id, span := range s.conns {
+			span.End(trace.WithTimestamp(ev.Time))
+			delete(s.conns, id)
+		}
+		if s.tunnel != nil {
+			s.tunnel.SetAttributes(attribute.String("roj1.reason", ev.Reason))
+			if ev.Reason == "failed" || ev.Reason == "error" {
+				s.tunnel.SetStatus(codes.Error, ev.Reason)
+			}
+			s.tunnel.End(trace.WithTimestamp(ev.Time))
+			s.tunnel = nil
+		}
+
+	case util.EventSocketOpened:
+		parent := s.tunCtx
+		if parent == nil {
+			parent = context.Background()
+		}
+		_, s.conns[ev.Socket] = s.tracer.Start(parent, "roj1.connection",
+			trace.WithTimestamp(ev.Time),
+			trace.WithAttributes(attribute.String("roj1.socket", ev.Socket)))
+
+	case util.EventSocketClosed:
+		if span, ok := s.conns[ev.Socket]; ok {
+			span.SetAttributes(attribute.Int64("roj1.bytes_in", ev.BytesIn), attribute.Int64("roj1.bytes_out", ev.BytesOut))
+			span.End(trace.WithTimestamp(ev.Time))
+			delete(s.conns, ev.Socket)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// breakdownPhases are the phases of the establishment breakdown, in order,
+// with their labels.
+var breakdownPhases = []struct{ phase, label string }{
+	{util.PhaseConnect, "signaling connect"},
+	{util.PhaseSDP, "SDP exchange"},
+	{util.PhaseGathering, "ICE gathering"},
+	{util.PhaseICE, "ICE checks"},
+	{util.PhaseDTLS, "DTLS"},
+	{util.PhaseDataChannel, "DataChannel open"},
+	{util.PhaseReady, "peer ready"},
+}
+
+// printBreakdown logs where the time of each establishment went once the
+// tunnel is up, e.g. "connected in 2140 ms — signaling connect 85 ms | SDP
+// exchange 120 ms | ...", and later the time the first message from the peer
+// took. With several paths, the first of each phase counts.
+func printBreakdown() {
+	var (
+		mu        sync.Mutex
+		durations = make(map[string]time.Duration) // of the current establishment
+		printed   bool                             // whether the breakdown of the current tunnel was printed
+	)
+	firstMessage := func(d time.Duration) {
+		util.LogInfo("first message from the peer %s after the DataChannel opened", formatMillis(d))
+	}
+
+	util.SubscribeEvents(func(ev util.Event) {
+		if ev.Event == util.EventStateChanged && ev.State == util.StateSignaling.String() {
+			mu.Lock()
+			clear(durations)
+			printed = false
+			mu.Unlock()
+			return
+		}
+		if ev.Event != util.EventPhase {
+			return
+		}
+
+		// Logged once mu is released, as logging emits an event too.
+		var log []func()
+		mu.Lock()
+		_, seen := durations[ev.Phase]
+		switch {
+		case ev.Phase == util.PhaseEstablish:
+			var parts []string
+			for _, p := range breakdownPhases {
+				if d, ok := durations[p.phase]; ok {
+					parts = append(parts, util.Tr(p.label)+" "+formatMillis(d))
+				}
+			}
+			log = append(log, func() {
+				util.LogInfo("connected in %s — %s", formatMillis(ev.Duration), strings.Join(parts, " | "))
+			})
+			if d, ok := durations[util.PhaseFirstMessage]; ok {
+				log = append(log, func() { firstMessage(d) })
+			}
+			printed = true
+		case seen:
+		default:
+			durations[ev.Phase] = ev.Duration
+			if ev.Phase == util.PhaseFirstMessage && printed {
+				log = append(log, func() { firstMessage(ev.Duration) })
+			}
+		}
+		mu.Unlock()
+
+		for _, fn := range log {
+			fn()
+		}
+	})
+}
+
+// formatMillis formats d in whole milliseconds, e.g. "120 ms".
+func formatMillis(d time.Duration) string {
+	return util.Trf("%d ms", d.Milliseconds())
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/1ureka/roj1/internal/hosts"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// localCertValidity is how long the self-signed -tlsLocal certificate is
+// valid; a new one is made on every run.
+const localCertValidity = 30 * 24 * time.Hour
+
+// localTLSConfig returns the -tlsLocal settings: the certificate in certFile
+// and keyFile, or without them a self-signed one for the names the virtual
+// service is reached by (localhost, the loopbacks, bind and hostname).
+func localTLSConfig(certFile, keyFile, bind, hostname string) (*tls.Config, error) {
+	var (
+		cert tls.Certificate
+		err  error
+	)
+	if certFile != "" {
+		cert, err = tls.LoadX509KeyPair(certFile, keyFile)
+	} else {
+		cert, err = localCert(bind, hostname)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
+
+// localCert creates a self-signed certificate for the virtual service and
+// logs its fingerprint, so it can be checked or pinned by the local client.
+func localCert(bind, hostname string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(now.UnixNano()),
+		Subject:      pkix.Name{CommonName: "roj1 virtual service"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(localCertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	for _, name := range []string{bind, hostname} {
+		switch ip := net.ParseIP(name); {
+		case name == "" || name == "localhost":
+		case ip != nil:
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		default:
+			tmpl.DNSNames = append(tmpl.DNSNames, name)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	sum := sha256.Sum256(der)
+	util.LogInfo("serving TLS with a self-signed certificate (SHA-256 %s)", hex.EncodeToString(sum[:]))
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// parseSNIMap parses -sniMap: comma-separated name=host:port pairs.
+func parseSNIMap(s string) (map[string]string, error) {
+	routes := make(map[string]string)
+	for pair := range strings.SplitSeq(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, addr, ok := strings.Cut(pair, "=")
+		if !ok || !hosts.ValidName(name) {
+			return nil, fmt.Errorf("%q: want name=host:port", pair)
+		}
+		host, port, err := net.SplitHostPort(addr)
+		if n, perr := strconv.Atoi(port); err != nil || host == "" || perr != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("%q: want name=host:port", pair)
+		}
+		routes[strings.ToLower(name)] = addr
+	}
+	return routes, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// waker runs the -wakeCommand when a connection finds the target down, so a
+// dev server can boot on demand. The command is not started again while an
+// earlier run is still going, and is killed when roj1 exits.
+type waker struct {
+	ctx     context.Context
+	command string
+
+	mu      sync.Mutex
+	running bool
+}
+
+// wake starts the command unless it is already running.
+func (w *waker) wake() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.running {
+		return
+	}
+
+	cmd := shellCommand(w.ctx, w.command)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Start(); err != nil {
+		util.LogWarning("failed to run -wakeCommand: %v", err)
+		return
+	}
+	w.running = true
+	util.LogInfo("target is down — started %q", w.command)
+
+	go func() {
+		err := cmd.Wait()
+		util.LogDebug("-wakeCommand exited: %v", err)
+		w.mu.Lock()
+		w.running = false
+		w.mu.Unlock()
+	}()
+}
+
+// shellCommand runs a command line through the platform's shell.
+func shellCommand(ctx context.Context, line string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", line)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", line)
+}
@@ -5,15 +5,26 @@ package adapter
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/1ureka/roj1/internal/mux"
 	"github.com/1ureka/roj1/internal/protocol"
 	"github.com/1ureka/roj1/internal/util"
 )
 
 // Transport defines the capabilities that adapter requires from the
-// underlying data transport layer.
+// underlying data transport layer. Any packet carrier can drive the adapter:
+// transport.Transport (WebRTC DataChannel) and transport.StreamTransport
+// (plain TCP or TLS) both implement it.
+//
+// Send* may block for backpressure and must return once Done is closed.
+// OnPacket may deliver packets out of order; the adapter reorders them per
+// socketID.
 type Transport interface {
 	SendConnect(socketID, seqNum uint32)
 	SendData(socketID, seqNum uint32, payload []byte)
@@ -22,72 +33,250 @@ type Transport interface {
 	Done() <-chan struct{}
 }
 
+// Writable is an optional Transport extension for transports that queue
+// outgoing packets. WaitWritable blocks while the path carrying socketID is
+// congested; sockets call it before each TCP read, so a slow tunnel pauses
+// reading and the sending application is throttled by its TCP window instead
+// of data piling up in memory.
+type Writable interface {
+	WaitWritable(ctx context.Context, socketID uint32) error
+}
+
 // adapter manages the socketID route table and auto-cleanup.
-// It is unexported — callers use RunAsHost / RunAsClient.
+// It is unexported — callers use StartAsHost / StartAsClient (or the blocking
+// RunAsHost / RunAsClient).
 type adapter struct {
-	ctx context.Context
-	tr  Transport
-
-	mu     sync.Mutex
-	routes map[uint32]*Socket
+	ctx   context.Context
+	abort context.CancelFunc // shuts the adapter down (see start)
+	tr    Transport
+
+	mu       sync.Mutex
+	routes   map[uint32]*Socket
+	idle     chan struct{} // closed when routes becomes empty (see waitIdle)
+	draining bool          // no new sockets are accepted once set
+	counter  uint32        // last client socketID counter value (see nextID)
+
+	quotas     Quotas                      // host only
+	packetRate atomic.Pointer[rateLimiter] // host: Quotas.MaxPacketRate, nil = unlimited
+	buffer     *sharedBuffer               // reorder bytes across sockets, nil without MaxBufferedBytes
+	outbound   *rateLimiter                // host: payload bytes sent to the peer, nil without Policy.MaxBandwidth
+	transfer   *transferMeter              // payload bytes in both directions, nil without a Transfer limit
+	mirror     *Mirror                     // host: copy of the bridged bytes, nil without HostConfig.Mirror
+	nack       bool                        // keep sent packets for retransmission (see retransmit.go)
+
+	ctl          *controller                  // control messages (see control.go)
+	service      ServiceInfo                  // host: the announced service (see announce)
+	catalog      *catalog                     // host: named services (see HostConfig.Services), nil on a client or Listener
+	announcement atomic.Pointer[announcement] // client: the host's announcement, nil until received
+	announced    chan struct{}                // client: closed once announcement is set
+
+	client    ClientConfig          // client: settings for Handle.Bind
+	listeners []net.Listener        // client: listeners of bound services (see Handle.Bind)
+	binds     map[string]chan error // client: pending Handle.Bind calls by service name
+	named     bool                  // client: sockets name their service (see Handle.Bind)
+
+	retargeting chan error  // client: the pending Handle.Retarget, if any
+	replies     atomic.Bool // client: the host has answered a CONNECT (see ClientConfig.ConnectTimeout)
+
+	reassembly Reassembly    // reorder buffer limits of every socket
+	total      *sharedBuffer // reorder bytes across sockets, nil without Reassembly.MaxTotalBytes
+
+	validation Validation
+	violations atomic.Int64 // invalid packets received from the peer
+
+	closed  tombstones  // recently closed socketIDs
+	expired atomic.Bool // host: shut down at Policy.MaxSession
+
+	session *mux.Session   // stream multiplexer on muxSocketID, nil unless used (see mux.go)
+	streams sync.WaitGroup // proxied mux streams
 }
 
+// Reasons registerOrGet refuses to create a socket.
+var (
+	errDraining       = errors.New("adapter is draining")
+	errSocketQuota    = errors.New("socket quota reached")
+	errRecentlyClosed = errors.New("socketID was recently closed")
+)
+
 // newAdapter creates an empty adapter bound to the given context and transport.
 func newAdapter(ctx context.Context, tr Transport) *adapter {
 	return &adapter{
 		ctx:    ctx,
 		tr:     tr,
 		routes: make(map[uint32]*Socket),
+		ctl:    newController(tr),
 	}
 }
 
 // registerOrGet (for host) looks up the socketID in the route table. If found, returns the
 // existing Socket and false. If not found, creates a new Socket, registers it, and returns it with true.
-func (a *adapter) registerOrGet(ctx context.Context, id uint32, tr Transport) (*Socket, bool) {
+// Returns errDraining while draining, errRecentlyClosed for a tombstoned socketID,
+// errMemoryPressure at the memory limit (see WatchMemory) and errSocketQuota at
+// Quotas.MaxSockets.
+func (a *adapter) registerOrGet(ctx context.Context, id uint32, tr Transport) (*Socket, bool, error) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
 	if s, ok := a.routes[id]; ok {
-		return s, false
+		return s, false, nil
+	}
+
+	if a.draining {
+		return nil, false, errDraining
+	}
+	if a.closed.buried(id) {
+		return nil, false, errRecentlyClosed
+	}
+	if memoryCritical() {
+		return nil, false, errMemoryPressure
+	}
+	if a.quotas.MaxSockets > 0 && len(a.routes) >= a.quotas.MaxSockets {
+		return nil, false, errSocketQuota
 	}
 
 	s := newSocket(ctx, id, tr)
+	s.reasm.shared = a.buffer
+	s.outbound = a.outbound
+	s.transfer = a.transfer
+	s.mirror = a.mirror.tap(id)
+	a.equip(s)
 	a.routes[id] = s
-	util.Stats.AddConn()
+	a.track(s)
 
-	go func() {
-		<-s.ctx.Done()
-		a.mu.Lock()
-		delete(a.routes, s.id)
-		a.mu.Unlock()
-		util.Stats.RemoveConn()
-	}()
+	return s, true, nil
+}
 
-	return s, true
+// equip applies the settings shared by both roles to a new socket.
+func (a *adapter) equip(s *Socket) {
+	if a.nack {
+		s.sent = &retransmitBuffer{}
+	}
+	if a.reassembly.MaxSocketBytes > 0 {
+		s.reasm.limit = a.reassembly.MaxSocketBytes
+	}
+	s.reasm.total = a.total
+	s.reasmClose = a.reassembly.Close
+	s.replies = &a.replies
 }
 
-// register (for client) adds a socket to the route table and starts an auto-cleanup
-// goroutine that removes the entry when the socket's context is done.
-func (a *adapter) register(ctx context.Context, id uint32, tr Transport, conn net.Conn) *Socket {
-	s := newSocketWithConn(ctx, id, tr, conn)
+// setReassembly applies the reorder buffer limits to sockets created from
+// now on.
+func (a *adapter) setReassembly(r Reassembly) {
+	a.reassembly = r
+	if r.MaxTotalBytes > 0 {
+		a.total = newSharedBuffer(r.MaxTotalBytes)
+	}
+}
+
+// register (for client) allocates a fresh socketID (see mixID), adds a socket
+// to the route table and starts an auto-cleanup goroutine that removes the
+// entry when the socket's cleanup has completed.
+func (a *adapter) register(ctx context.Context, tr Transport, conn net.Conn) *Socket {
 	a.mu.Lock()
+	id := a.nextID()
+	s := newSocketWithConn(ctx, id, tr, conn)
+	s.transfer = a.transfer
+	a.equip(s)
 	a.routes[id] = s
+	a.track(s)
 	a.mu.Unlock()
+
+	return s
+}
+
+// nextID returns the next unused client socketID. Must be called with a.mu
+// held.
+func (a *adapter) nextID() uint32 {
+	for {
+		a.counter++
+		if id := mixID(a.counter); id != 0 {
+			if _, ok := a.routes[id]; !ok {
+				return id
+			}
+		}
+	}
+}
+
+// track records a newly registered socket and arranges for its route to be
+// removed once it is cleaned up; no goroutine waits for that meanwhile. Must
+// be called with a.mu held.
+func (a *adapter) track(s *Socket) {
 	util.Stats.AddConn()
+	util.NotifyConnOpen(s.id)
 
-	go func() {
-		<-s.ctx.Done()
+	context.AfterFunc(s.ctx, func() {
+		<-s.closed
 		a.mu.Lock()
-		delete(a.routes, s.id)
+		if a.routes[s.id] == s {
+			delete(a.routes, s.id)
+			a.closed.bury(s.id)
+		}
+		if len(a.routes) == 0 && a.idle != nil {
+			close(a.idle)
+			a.idle = nil
+		}
 		a.mu.Unlock()
 		util.Stats.RemoveConn()
-	}()
+		util.NotifyConnClose(s.id, s.bytesIn.Load(), s.bytesOut.Load())
+	})
+}
 
-	return s
+// bury tombstones a socketID that has no socket (see tombstones).
+func (a *adapter) bury(id uint32) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.routes[id]; !ok {
+		a.closed.bury(id)
+	}
+}
+
+// buried reports whether a socketID was recently closed.
+func (a *adapter) buried(id uint32) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.closed.buried(id)
+}
+
+// waitIdle returns a channel that is closed once no sockets are registered.
+func (a *adapter) waitIdle() <-chan struct{} {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.routes) == 0 {
+		ch := make(chan struct{})
+		close(ch)
+		return ch
+	}
+	if a.idle == nil {
+		a.idle = make(chan struct{})
+	}
+	return a.idle
+}
+
+// drain stops the adapter from accepting new sockets (and mux streams).
+func (a *adapter) drain() {
+	a.mu.Lock()
+	a.draining = true
+	a.mu.Unlock()
+	a.closeIdleMux()
+}
+
+// isDraining reports whether drain has been called.
+func (a *adapter) isDraining() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.draining
 }
 
 // deliver routes a packet to the matching socket's inbox.
 // Returns true if a route was found.
+//
+// deliver never blocks, so one slow socket cannot stall the transport for
+// the others. pushLoop only does a heap insert per packet and never waits for
+// the local connection to read, so the inbox fills up only under a burst; the packet is then dropped, and counted in Stats.
+// With retransmission it is requested again like an evicted one (see
+// Reassembler.lost); without it the stream would be corrupt, so the socket
+// is reset instead.
 func (a *adapter) deliver(pkt *protocol.Packet) bool {
 	a.mu.Lock()
 	s, ok := a.routes[pkt.SocketID]
@@ -99,9 +288,18 @@ func (a *adapter) deliver(pkt *protocol.Packet) bool {
 
 	select {
 	case s.inbox <- pkt:
+		return true
 	default:
-		util.LogWarning("[%08x] inbox full, dropping packet", pkt.SocketID)
 	}
+
+	util.Stats.AddDropped()
+	if s.sent != nil {
+		s.reasm.lost(pkt.SeqNum)
+		util.LogDebug("[%08x] inbox full, dropped packet %d to request again", pkt.SocketID, pkt.SeqNum)
+		return true
+	}
+	util.LogWarning("[%08x] inbox full, closing socket rather than losing data", pkt.SocketID)
+	s.cancel()
 	return true
 }
 
@@ -109,67 +307,531 @@ func (a *adapter) deliver(pkt *protocol.Packet) bool {
 // Public API
 // ---------------------------------------------------------------------------
 
-// RunAsHost starts the host-side adapter. It listens on the DataChannel for
-// incoming packets; when an unknown socketID appears (with a non-CLOSE packet),
-// it creates a Socket and launches a goroutine that dials targetAddr.
-// Blocks until the transport is done.
-func RunAsHost(ctx context.Context, tr Transport, targetAddr string) error {
-	a := newAdapter(ctx, tr)
+// Handle controls a running adapter started by StartAsHost or StartAsClient.
+type Handle struct {
+	a        *adapter
+	cancel   context.CancelFunc
+	listener net.Listener // client only
+	done     chan struct{}
+}
+
+// start wires the shutdown path shared by both roles: once the transport is
+// done or ctx is cancelled, all sockets are torn down and Done is closed after
+// their cleanup has completed.
+func start(ctx context.Context, tr Transport) (*Handle, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	h := &Handle{
+		a:      newAdapter(ctx, tr),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	h.a.abort = cancel
+	if util.DebugEnabled() {
+		go h.a.watchLeaks(ctx)
+	}
+
+	go func() {
+		select {
+		case <-tr.Done():
+		case <-ctx.Done():
+		}
+		cancel()
+		h.a.drain() // no streams are admitted once a.streams is waited on
+		<-h.a.waitIdle()
+		h.a.streams.Wait()
+		close(h.done)
+	}()
+
+	return h, ctx
+}
+
+// Done returns a channel that is closed when the adapter has stopped and all
+// of its sockets have been cleaned up.
+func (h *Handle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Wait blocks until the adapter has stopped (see Done). It returns
+// ErrSessionLimit if a host's tunnel was closed at Policy.MaxSession.
+func (h *Handle) Wait() error {
+	<-h.done
+	if h.a.expired.Load() {
+		return ErrSessionLimit
+	}
+	return nil
+}
+
+// Addr returns the address the client listener is bound to (useful with port
+// 0), or nil for a host adapter.
+func (h *Handle) Addr() net.Addr {
+	if h.listener == nil {
+		return nil
+	}
+	return h.listener.Addr()
+}
+
+// Service returns the service the host announced it forwards to, on a client
+// adapter once the announcement has arrived. Hosts that predate announcements
+// never send one.
+func (h *Handle) Service() (ServiceInfo, bool) {
+	if info := h.a.announcement.Load(); info != nil {
+		return info.service, true
+	}
+	return ServiceInfo{}, false
+}
+
+// Close shuts the adapter down gracefully: it stops accepting new connections
+// (closing the client listeners), waits for active connections to finish on
+// their own, and returns once everything is cleaned up. If ctx is done first,
+// the remaining connections are torn down and ctx's error is returned.
+func (h *Handle) Close(ctx context.Context) error {
+	h.a.drain()
+	if h.listener != nil {
+		h.listener.Close()
+	}
+	h.a.closeListeners()
+
+	var err error
+	select {
+	case <-h.a.waitIdle():
+	case <-h.done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	h.cancel()
+	<-h.done
+	return err
+}
+
+// HostConfig holds optional host-side settings for StartAsHostWith.
+type HostConfig struct {
+	TCP TCPOptions // applied to each connection dialed to the target
+
+	// ResolveInterval makes the adapter re-resolve a named target in the
+	// background at this interval and dial the cached addresses. Zero
+	// resolves the name on every dial.
+	ResolveInterval time.Duration
+
+	// DialRetry keeps redialing a target that is not up yet, with backoff,
+	// for up to this long before the connection is closed. Zero gives up
+	// after the first attempt. Wake, if set, is called before retrying, e.g.
+	// to start the target on demand; it must not block.
+	DialRetry time.Duration
+	Wake      func()
+
+	// TargetTLS, if set, wraps each connection to the target in TLS, so a
+	// plaintext client can reach a TLS-only service. ServerName defaults to
+	// the target's host.
+	TargetTLS *tls.Config
+
+	// SNIRoutes routes TLS connections by the server name in their
+	// ClientHello to other targets (host:port), e.g. several HTTPS backends
+	// over one tunnel. Other names, and connections that are not TLS, go to
+	// the main target. The host answers CONNECT before the target is dialed.
+	SNIRoutes map[string]string
+
+	// Mirror, if set, copies the bytes of selected connections (see Mirror).
+	// Connections carried by the multiplexer (ClientConfig.Mux) are not
+	// mirrored.
+	Mirror *Mirror
+
+	// StallTimeout reports a socket whose received data has waited this
+	// long without being delivered, with the missing sequence numbers if
+	// any (see stall.go). Zero disables the check.
+	StallTimeout time.Duration
+
+	// Nack keeps each socket's recently sent packets and asks the peer to
+	// resend gaps that persist, e.g. packets lost with a failed path (see
+	// retransmit.go). Both sides need it.
+	Nack bool
+
+	Reassembly Reassembly // reorder buffer limits
+
+	// Service describes the target to the client (see Handle.Service). Port
+	// defaults to the target's port.
+	Service ServiceInfo
+
+	// Services offers named targets (host:port) besides the main one, which
+	// the client binds to local ports by name (see catalog.go). The policy is
+	// checked when the client asks for a service.
+	Services map[string]string
+
+	// AuthorizeService, if set, decides whether the client may use a service
+	// of Services that the policy allows, e.g. by asking the operator; it
+	// returns the reason for a refusal. It runs on its own goroutine and
+	// should return once ctx is done.
+	AuthorizeService func(ctx context.Context, service string) error
+
+	// AuthorizeRetarget, if set, decides whether the client may switch the
+	// main target to another port of its host (see retarget.go) that the
+	// policy allows, returning the reason for a refusal; nil refuses every
+	// change. It runs on its own goroutine and should return once ctx is
+	// done.
+	AuthorizeRetarget func(ctx context.Context, port int) error
+
+	// AuthorizePort, if set, decides whether the client may bind another
+	// port of the main target's host as a service (see Handle.Bind) that the
+	// policy allows, returning the reason for a refusal; nil refuses every
+	// port but the target's own. It runs on its own goroutine and should
+	// return once ctx is done.
+	AuthorizePort func(ctx context.Context, port int) error
+
+	Quotas     Quotas     // limits on what the peer can allocate
+	Validation Validation // checks on inbound packets
+	Policy     Policy     // restrictions on the authenticated peer
+	Transfer   Transfer   // cap on the bytes forwarded
+}
+
+// StartAsHost starts the host-side adapter with the default settings (see
+// StartAsHostWith).
+func StartAsHost(ctx context.Context, tr Transport, targetAddr string) (*Handle, error) {
+	return StartAsHostWith(ctx, tr, targetAddr, HostConfig{})
+}
+
+// StartAsHostWith starts the host-side adapter. It listens on the DataChannel
+// for incoming packets; when an unknown socketID appears (with a non-CLOSE
+// packet), it creates a Socket and launches a goroutine that dials targetAddr
+// (host:port, where host may be an IP address or a name).
+func StartAsHostWith(ctx context.Context, tr Transport, targetAddr string, cfg HostConfig) (*Handle, error) {
+	h, ctx := start(ctx, tr)
+	t := newTarget(ctx, targetAddr, cfg.ResolveInterval)
+	t.retry, t.wake = cfg.DialRetry, cfg.Wake
+	t.tls = targetTLS(cfg.TargetTLS, targetAddr)
+	if cfg.Service.Port == 0 {
+		cfg.Service.Port = t.port()
+	}
+
+	dial, allowed := t.dial, true
+	if len(cfg.SNIRoutes) > 0 {
+		// The policy is checked per connection, once its target is known.
+		dial = newSNIRouter(ctx, t, cfg).dial
+	} else if allowed = cfg.Policy.allows(t.port()); !allowed {
+		util.LogWarning("the peer may not connect to %s — its connections will be refused", targetAddr)
+	}
+	h.a.serveRetarget(ctx, t, cfg, allowed)
+	h.a.catalog = newCatalog(ctx, cfg, t, allowed)
+	h.a.serveHost(ctx, tr, cfg, dial, allowed)
+
+	return h, nil
+}
+
+// serveHost wires the host side's packet dispatch: each socket the peer opens
+// is connected with dial (see runAsHost), or refused unless allowed.
+func (a *adapter) serveHost(ctx context.Context, tr Transport, cfg HostConfig, dial func(context.Context) (net.Conn, error), allowed bool) {
+	a.quotas = cfg.Quotas
+	a.validation = cfg.Validation
+	if cfg.Quotas.MaxBufferedBytes > 0 {
+		a.buffer = newSharedBuffer(cfg.Quotas.MaxBufferedBytes)
+	}
+	a.packetRate.Store(newRateLimiter(int64(cfg.Quotas.MaxPacketRate)))
+	inbound := newRateLimiter(cfg.Policy.MaxBandwidth)
+	a.outbound = newRateLimiter(cfg.Policy.MaxBandwidth)
+	a.transfer = newTransferMeter(cfg.Transfer)
+	a.mirror = cfg.Mirror
+	if cfg.Policy.MaxSession > 0 {
+		go a.limitSession(ctx, cfg.Policy.MaxSession)
+	}
+	if cfg.StallTimeout > 0 {
+		go a.watchStalls(ctx, cfg.StallTimeout)
+	}
+	a.startNack(ctx, tr, cfg.Nack)
+	a.setReassembly(cfg.Reassembly)
+	if a.catalog != nil {
+		a.serveCatalog(ctx)
+	}
+	a.announceService(cfg.Service)
+	a.receiveMessages()
 
 	tr.OnPacket(func(pkt *protocol.Packet) {
+		tracePacket(false, pkt.SocketID, pkt.Type, pkt.SeqNum, len(pkt.Payload))
+		if limiter := a.packetRate.Load(); limiter != nil {
+			d, ok := limiter.wait(ctx, 1)
+			if !ok {
+				return
+			}
+			if d > 0 {
+				util.Stats.AddThrottled(d)
+			}
+		}
+
+		if err := validate(pkt); err != nil {
+			a.violation(pkt, err)
+			return
+		}
+		switch pkt.Type {
+		case protocol.TypeNack:
+			a.retransmit(pkt)
+			return
+		case protocol.TypeControl:
+			a.control(pkt)
+			return
+		}
+		if inbound != nil && len(pkt.Payload) > 0 {
+			d, ok := inbound.wait(ctx, len(pkt.Payload))
+			if !ok {
+				return
+			}
+			if d > 0 {
+				util.Stats.AddThrottled(d)
+			}
+		}
+		if a.transfer != nil && len(pkt.Payload) > 0 && !a.transfer.add(ctx, len(pkt.Payload)) {
+			return
+		}
 		if a.deliver(pkt) {
 			return
 		}
-		// Unknown socketID — create a new socket (unless it's a stale CLOSE).
+
+		// Unknown socketID. A CLOSE means the peer has given up on it: either
+		// it is stale, or it overtook the CONNECT, and the packets before it
+		// must not open a socket that would wait for them forever.
 		if pkt.Type == protocol.TypeClose {
+			a.bury(pkt.SocketID)
+			return
+		}
+		if a.buried(pkt.SocketID) {
+			util.LogDebug("[%08x] socketID was recently closed, dropping packet", pkt.SocketID)
+			return
+		}
+		if cfg.Validation.Strict && pkt.Type != protocol.TypeConnect {
+			a.violation(pkt, errNoConnect)
+			return
+		}
+		// With services, the policy is checked per connection, once its
+		// service is known.
+		named := a.catalog.offers()
+		if !allowed && !named {
+			// Refused like a CONNECT beyond the socket quota (see below).
+			if pkt.Type == protocol.TypeConnect {
+				util.Stats.AddRejected()
+				util.LogDebug("[%08x] target port not allowed by the peer's policy, refusing connection", pkt.SocketID)
+				tracePacket(true, pkt.SocketID, protocol.TypeClose, 1, 0)
+				tr.SendClose(pkt.SocketID, 1)
+			}
 			return
 		}
 
-		s, created := a.registerOrGet(ctx, pkt.SocketID, tr)
+		s, created, err := a.registerOrGet(ctx, pkt.SocketID, tr)
+		if errors.Is(err, errSocketQuota) || errors.Is(err, errMemoryPressure) {
+			// Answer the CONNECT so the client closes its side instead of
+			// waiting for its connect timeout. The host never sent anything
+			// on this socketID, so the CLOSE is its first SeqNum.
+			if pkt.Type == protocol.TypeConnect {
+				util.Stats.AddRejected()
+				util.LogDebug("[%08x] %v, refusing connection", pkt.SocketID, err)
+				tracePacket(true, pkt.SocketID, protocol.TypeClose, 1, 0)
+				tr.SendClose(pkt.SocketID, 1)
+			}
+			return
+		}
+		if err != nil {
+			util.LogDebug("[%08x] %v, dropping packet for new socket", pkt.SocketID, err)
+			return
+		}
 		if created {
 			util.LogDebug("[%08x] new socket created for incoming connection", pkt.SocketID)
-			go s.runAsHost(targetAddr)
+			switch {
+			case pkt.SocketID == muxSocketID:
+				go s.runAsHost(a.muxDialer(dial, cfg.TCP), cfg.TCP)
+			case named:
+				go s.runAsHost(a.catalog.dialer(s.id, a.catalog.guard(dial)), cfg.TCP)
+			default:
+				go s.runAsHost(dial, cfg.TCP)
+			}
 		}
 
 		if !a.deliver(pkt) {
 			util.LogError("[%08x] failed to deliver packet to newly created socket", pkt.SocketID)
 		}
 	})
+}
 
-	<-tr.Done()
-	return nil
+// RunAsHost starts the host-side adapter (see StartAsHost) and blocks until
+// the transport is done; all sockets are torn down on return.
+func RunAsHost(ctx context.Context, tr Transport, targetAddr string) error {
+	return RunAsHostWith(ctx, tr, targetAddr, HostConfig{})
 }
 
-// portToID converts a 16-bit ephemeral port number to a 32-bit socket identifier.
-//
-// On the client side, the TCP listener binds to a fixed address (e.g., 127.0.0.1:8080).
-// Each incoming connection has:
-//   - Fixed local IP and port (the virtual service listener address)
-//   - Fixed remote IP (loopback, because virtual service listener only accepts local connections)
-//   - OS-assigned ephemeral remote port (the only varying component)
+// RunAsHostWith is RunAsHost with explicit host settings. It returns
+// ErrSessionLimit if the tunnel was closed at Policy.MaxSession.
+func RunAsHostWith(ctx context.Context, tr Transport, targetAddr string, cfg HostConfig) error {
+	h, err := StartAsHostWith(ctx, tr, targetAddr, cfg)
+	if err != nil {
+		return err
+	}
+	return h.Wait()
+}
+
+// mixID scrambles a sequential counter value into a 32-bit socket identifier.
 //
-// Therefore, the remote port alone is sufficient as a unique identifier for each socket.
+// On the client side, socket IDs come from a per-adapter counter rather than
+// from anything about the connection (such as its ephemeral port), so a
+// rapidly reused port can never collide with a socket the host is still
+// draining. The counter would only wrap after 2^32 connections.
 //
-// This function applies a simple XOR-based mixing for visual obfuscation,
-// transforming the 16-bit port into a 32-bit value. The transformation is
-// deterministic and collision-free within the port space.
-func portToID(port uint16) uint32 {
-	v := uint32(port)
+// The XOR-shift mixing is only for visual distinction in logs. Each step is
+// invertible, so the mapping is a bijection on uint32 and distinct counter
+// values always yield distinct IDs.
+func mixID(n uint32) uint32 {
+	v := n
 	v ^= v << 13
 	v ^= v >> 17
 	v ^= v << 5
 	return v
 }
 
-// RunAsClient starts the client-side adapter. It listens on localPort for
-// incoming TCP connections; each accepted connection becomes a Socket that
-// sends CONNECT and bridges data through the DataChannel.
-// Blocks until the transport is done.
-func RunAsClient(ctx context.Context, tr Transport, localAddr string) error {
-	a := newAdapter(ctx, tr)
+// DefaultConnectTimeout is the connect timeout used by StartAsClient.
+const DefaultConnectTimeout = 10 * time.Second
+
+// ClientConfig holds optional client-side settings for StartAsClientWith.
+type ClientConfig struct {
+	// ConnectTimeout bounds how long a socket waits for the host to answer
+	// its CONNECT (i.e. to reach the target). On expiry the local TCP
+	// connection is closed and CLOSE is sent. Zero means no limit.
+	//
+	// Hosts older than the CONNECT reply never answer, so the limit only
+	// applies once the host has answered any socket's CONNECT; until then,
+	// quiet connections to such a host are kept.
+	ConnectTimeout time.Duration
+
+	TCP        TCPOptions // applied to each accepted local connection
+	Validation Validation // checks on inbound packets (Strict is host only)
+
+	// LocalTLS, if set, serves TLS on the local listener, so a TLS-only
+	// client can reach a plaintext service. Not used by NewDialer.
+	LocalTLS *tls.Config
+
+	Transfer Transfer // cap on the bytes forwarded
+
+	// Mux carries all connections as streams of one multiplexed socket (see
+	// mux.go) instead of one socket each, adding per-stream flow control and
+	// half-close. The host needs no setting; it follows the client.
+	Mux bool
+
+	StallTimeout time.Duration // see HostConfig.StallTimeout
+	Nack         bool          // see HostConfig.Nack
+	Reassembly   Reassembly    // reorder buffer limits
+
+	// ReusePort opens the local listeners with SO_REUSEPORT, so a client can
+	// bind while another process, such as the client it replaces, still
+	// holds the port; the two then share its connections. Go always sets
+	// SO_REUSEADDR on Unix, so connections left in TIME_WAIT never keep a
+	// port. Not supported on Windows.
+	ReusePort bool
+
+	// Listener, if set, is accepted on instead of listening on localAddr,
+	// e.g. a socket inherited through socket activation. The adapter closes
+	// it like its own.
+	Listener net.Listener
+}
+
+// StartAsClient starts the client-side adapter with DefaultConnectTimeout
+// (see StartAsClientWith).
+func StartAsClient(ctx context.Context, tr Transport, localAddr string) (*Handle, error) {
+	return StartAsClientWith(ctx, tr, localAddr, ClientConfig{ConnectTimeout: DefaultConnectTimeout})
+}
+
+// StartAsClientWith starts the client-side adapter. It listens on localAddr
+// (an IPv4 or IPv6 address or hostname; "localhost" binds both loopback
+// families) for incoming TCP connections; each accepted connection becomes a
+// Socket that sends CONNECT and bridges data through the DataChannel. With
+// an empty localAddr (and no ClientConfig.Listener), only services bound
+// later are listened on (see Handle.Bind).
+func StartAsClientWith(ctx context.Context, tr Transport, localAddr string, cfg ClientConfig) (*Handle, error) {
+	// Start TCP listener.
+	listener := cfg.Listener
+	if listener == nil && localAddr != "" {
+		var err error
+		if listener, err = listen(localAddr, cfg.ReusePort); err != nil {
+			return nil, err
+		}
+	}
+	if listener != nil && cfg.LocalTLS != nil {
+		listener = tls.NewListener(listener, cfg.LocalTLS)
+	}
+
+	h, ctx := start(ctx, tr)
+	h.listener = listener
+	a := h.a
+	a.client = cfg
+	a.serveClient(ctx, tr, cfg)
+
+	go func() {
+		<-ctx.Done()
+		if listener != nil {
+			listener.Close()
+		}
+		a.closeListeners()
+	}()
+
+	if listener != nil {
+		util.LogSuccess("virtual service started, listening on %s", listener.Addr())
+		// Accept loop in a separate goroutine so the caller is not blocked.
+		go a.accept(ctx, listener, "")
+	}
+
+	return h, nil
+}
+
+// accept bridges the connections accepted on listener to service ("" for
+// the main target) until it is closed.
+func (a *adapter) accept(ctx context.Context, listener net.Listener, service string) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil || a.isDraining() {
+				util.LogDebug("virtual service listener closed, stopping accept loop")
+			} else {
+				util.LogError("virtual service accept error: %v", err)
+			}
+			return
+		}
+		if memoryCritical() {
+			util.Stats.AddRejected()
+			util.LogDebug("%v, refusing connection from %s", errMemoryPressure, conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+		a.bridge(ctx, a.tr, conn, a.client, service)
+	}
+}
+
+// serveClient wires the client side's packet dispatch.
+func (a *adapter) serveClient(ctx context.Context, tr Transport, cfg ClientConfig) {
+	a.validation = cfg.Validation
+	a.transfer = newTransferMeter(cfg.Transfer)
+	if cfg.StallTimeout > 0 {
+		go a.watchStalls(ctx, cfg.StallTimeout)
+	}
+	a.startNack(ctx, tr, cfg.Nack)
+	a.setReassembly(cfg.Reassembly)
+	if cfg.Mux {
+		a.startMuxClient(ctx, tr, cfg.ConnectTimeout)
+	}
+	a.awaitService()
+	a.awaitBinds()
+	a.awaitRetarget()
+	a.receiveMessages()
 
 	// Wire up DataChannel → Socket dispatch.
 	tr.OnPacket(func(pkt *protocol.Packet) {
+		tracePacket(false, pkt.SocketID, pkt.Type, pkt.SeqNum, len(pkt.Payload))
+		if err := validate(pkt); err != nil {
+			a.violation(pkt, err)
+			return
+		}
+		switch pkt.Type {
+		case protocol.TypeNack:
+			a.retransmit(pkt)
+			return
+		case protocol.TypeControl:
+			a.control(pkt)
+			return
+		}
+		if a.transfer != nil && len(pkt.Payload) > 0 && !a.transfer.add(ctx, len(pkt.Payload)) {
+			return
+		}
 		if a.deliver(pkt) {
 			return
 		}
@@ -178,43 +840,40 @@ func RunAsClient(ctx context.Context, tr Transport, localAddr string) error {
 			util.LogDebug("[%08x] unknown socketID, dropping DATA packet", pkt.SocketID)
 		}
 	})
+}
 
-	// Start TCP listener.
-	listener, err := net.Listen("tcp", localAddr)
-	if err != nil {
-		return err
+// bridge forwards a local connection to service ("" for the main target)
+// through the tunnel, as a new socket or, with ClientConfig.Mux, as a new
+// stream of the main target (and then returns nil).
+func (a *adapter) bridge(ctx context.Context, tr Transport, conn net.Conn, cfg ClientConfig, service string) *Socket {
+	if cfg.Mux && service == "" {
+		a.openStream(conn, cfg.TCP)
+		return nil
 	}
 
-	go func() {
-		<-ctx.Done()
-		listener.Close()
-	}()
-
-	util.LogSuccess("virtual service started, listening on %s", localAddr)
+	s := a.register(ctx, tr, conn)
+	util.LogDebug("[%08x] new connection from %s", s.id, conn.RemoteAddr())
+	cfg.TCP.apply(s.id, conn)
+	a.nameService(s.id, service)
 
-	// Accept loop in a separate goroutine so we can also wait on tr.Done().
-	go func() {
-		for {
-			conn, err := listener.Accept()
-			if err != nil {
-				select {
-				case <-ctx.Done():
-					util.LogDebug("virtual service listener closed, stopping accept loop")
-				default:
-					util.LogError("virtual service accept error: %v", err)
-				}
-				return
-			}
+	go s.runAsClient(cfg.ConnectTimeout)
+	return s
+}
 
-			addr := conn.RemoteAddr().(*net.TCPAddr)
-			socketID := portToID(uint16(addr.Port))
-			util.LogDebug("[%08x] new connection from %s", socketID, conn.RemoteAddr())
+// RunAsClient starts the client-side adapter (see StartAsClient) and blocks
+// until the transport is done; the listener and all sockets are torn down on
+// return.
+func RunAsClient(ctx context.Context, tr Transport, localAddr string) error {
+	return RunAsClientWith(ctx, tr, localAddr, ClientConfig{ConnectTimeout: DefaultConnectTimeout})
+}
 
-			s := a.register(ctx, socketID, tr, conn)
-			go s.runAsClient()
-		}
-	}()
+// RunAsClientWith is RunAsClient with explicit client settings.
+func RunAsClientWith(ctx context.Context, tr Transport, localAddr string, cfg ClientConfig) error {
+	h, err := StartAsClientWith(ctx, tr, localAddr, cfg)
+	if err != nil {
+		return err
+	}
 
-	<-tr.Done()
+	<-h.Done()
 	return nil
 }
@@ -0,0 +1,452 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// Service catalog (HostConfig.Services): besides its main target, the host
+// may offer named services. The client learns them from the announcement
+// (see Handle.Catalog) and binds the ones it wants to local ports at any time
+// (see Handle.Bind): it asks the host with a bind message and, once granted,
+// listens locally. Every socket the client opens from then on, including
+// those of the main listener, is preceded by an open message naming its
+// service ("" for the main target); the host waits for it, up to openWait,
+// before dialing. Hosts without services never wait. The services may be
+// replaced while the tunnel is up (see Handle.SetServices). A service named
+// by a port number that the catalog lacks is that port of the main target's
+// host, if HostConfig.AuthorizePort grants it.
+
+const (
+	openWait        = 5 * time.Second // how long a host socket waits for its open message
+	maxPendingOpens = 1024            // open messages held for sockets that do not exist yet
+)
+
+// ErrServiceDenied is returned by Handle.Bind when the host refuses the
+// service, wrapped with its reason.
+var ErrServiceDenied = errors.New("service denied by the host")
+
+// errNoControl is returned by Handle.Bind when the transport cannot carry
+// control messages.
+var errNoControl = errors.New("the transport cannot carry control messages")
+
+// catalog holds the host's named services and the client's use of them.
+type catalog struct {
+	ctx           context.Context
+	cfg           HostConfig // target settings (ResolveInterval, DialRetry, Wake, TargetTLS)
+	policy        Policy
+	authorize     func(context.Context, string) error // HostConfig.AuthorizeService, nil allows all
+	authorizePort func(context.Context, int) error    // HostConfig.AuthorizePort, nil refuses other ports
+	main          *target                             // the main target, on whose host ports are bound
+	mainAllowed   bool                                // the peer may connect to the main target
+
+	mu      sync.Mutex
+	targets map[string]*target
+	ports   map[string]*target       // ports of the main target's host the client bound, by number
+	stop    context.CancelFunc       // ends the background resolution of targets
+	bound   map[string]bool          // services the client bound
+	opens   map[uint32]string        // socketID → service, not yet dialed
+	waiters map[uint32]chan struct{} // sockets waiting for their open message
+}
+
+// newCatalog creates the targets of cfg.Services, beside main.
+func newCatalog(ctx context.Context, cfg HostConfig, main *target, mainAllowed bool) *catalog {
+	c := &catalog{
+		ctx:           ctx,
+		cfg:           cfg,
+		policy:        cfg.Policy,
+		authorize:     cfg.AuthorizeService,
+		authorizePort: cfg.AuthorizePort,
+		main:          main,
+		mainAllowed:   mainAllowed,
+		ports:         make(map[string]*target),
+		bound:         make(map[string]bool),
+		opens:         make(map[uint32]string),
+		waiters:       make(map[uint32]chan struct{}),
+	}
+	c.set(cfg.Services)
+	return c
+}
+
+// set replaces the services with the targets of services (name → host:port).
+// Services the client bound stay bound if they are still offered, as do the
+// ports it bound.
+func (c *catalog) set(services map[string]string) {
+	ctx, stop := context.WithCancel(c.ctx)
+	targets := make(map[string]*target, len(services))
+	for name, addr := range services {
+		t := newTarget(ctx, addr, c.cfg.ResolveInterval)
+		t.retry, t.wake = c.cfg.DialRetry, c.cfg.Wake
+		targets[strings.ToLower(name)] = t
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stop != nil {
+		c.stop()
+	}
+	c.targets, c.stop = targets, stop
+	for name := range c.bound {
+		if _, ok := targets[name]; !ok && c.ports[name] == nil {
+			delete(c.bound, name)
+		}
+	}
+}
+
+// offers reports whether there are any services or bound ports, so sockets
+// must wait for their open message. A nil catalog has none.
+func (c *catalog) offers() bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.targets) > 0 || len(c.ports) > 0
+}
+
+// target returns the named service's target, or nil.
+func (c *catalog) target(name string) *target {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.targets[name]
+}
+
+// services returns the catalog as announced to the client, sorted by name.
+// A nil catalog has none.
+func (c *catalog) services() []ServiceInfo {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	list := make([]ServiceInfo, 0, len(c.targets))
+	for name, t := range c.targets {
+		list = append(list, ServiceInfo{Name: name, Port: t.port()})
+	}
+	slices.SortFunc(list, func(a, b ServiceInfo) int { return strings.Compare(a.Name, b.Name) })
+	return list
+}
+
+// bind grants the client a service, or returns why it may not use it. It
+// may block while HostConfig.AuthorizeService decides.
+func (c *catalog) bind(ctx context.Context, name string) error {
+	t := c.target(name)
+	if port, err := strconv.Atoi(name); t == nil && err == nil && strconv.Itoa(port) == name {
+		return c.bindPort(ctx, name, port)
+	}
+	if t == nil {
+		return fmt.Errorf("no service named %q", name)
+	}
+	if !c.policy.allows(t.port()) {
+		return fmt.Errorf("the peer may not connect to %s", t)
+	}
+	if c.authorize != nil {
+		if err := c.authorize(ctx, name); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.targets[name] != t {
+		return fmt.Errorf("service %q was removed", name)
+	}
+	c.bound[name] = true
+	return nil
+}
+
+// bindPort grants the client port of the main target's host as the service
+// name, or returns why it may not use it. The main target's own port needs
+// no authorization.
+func (c *catalog) bindPort(ctx context.Context, name string, port int) error {
+	switch {
+	case port < 1 || port > 65535:
+		return fmt.Errorf("invalid port %d", port)
+	case !c.mainAllowed || !c.policy.allows(port):
+		return fmt.Errorf("the peer may not connect to port %d", port)
+	case port == c.main.port():
+	case c.authorizePort == nil:
+		return errors.New("the host does not allow other ports")
+	default:
+		if err := c.authorizePort(ctx, port); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ports[name] == nil {
+		host, _, _ := net.SplitHostPort(c.main.String())
+		addr := net.JoinHostPort(host, name)
+		t := newTarget(c.ctx, addr, c.cfg.ResolveInterval)
+		t.retry, t.wake = c.cfg.DialRetry, c.cfg.Wake
+		t.tls = targetTLS(c.cfg.TargetTLS, addr)
+		c.ports[name] = t
+	}
+	c.bound[name] = true
+	return nil
+}
+
+// open records the service a socket connects to and wakes its dial.
+func (c *catalog) open(id uint32, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.opens) >= maxPendingOpens {
+		util.LogDebug("[%08x] too many pending open messages, ignoring", id)
+		return
+	}
+	c.opens[id] = name
+	if ch, ok := c.waiters[id]; ok {
+		close(ch)
+		delete(c.waiters, id)
+	}
+}
+
+// serviceOf returns the service a socket connects to: "" for the main
+// target, also if the client has bound no service or its open message does
+// not arrive within openWait.
+func (c *catalog) serviceOf(ctx context.Context, id uint32) string {
+	c.mu.Lock()
+	name, ok := c.opens[id]
+	if len(c.bound) == 0 {
+		delete(c.opens, id)
+		c.mu.Unlock()
+		return ""
+	}
+	if !ok {
+		ch := make(chan struct{})
+		c.waiters[id] = ch
+		c.mu.Unlock()
+
+		timer := time.NewTimer(openWait)
+		select {
+		case <-ch:
+		case <-timer.C:
+			util.LogDebug("[%08x] client did not name the service, using the main target", id)
+		case <-ctx.Done():
+		}
+		timer.Stop()
+
+		c.mu.Lock()
+		delete(c.waiters, id)
+		name = c.opens[id]
+	}
+	delete(c.opens, id)
+	c.mu.Unlock()
+	return name
+}
+
+// guard returns dial, refusing connections if the peer may not connect to
+// the main target.
+func (c *catalog) guard(dial func(context.Context) (net.Conn, error)) func(context.Context) (net.Conn, error) {
+	if c.mainAllowed {
+		return dial
+	}
+	return func(context.Context) (net.Conn, error) {
+		return nil, errors.New("the peer may not connect to the main target")
+	}
+}
+
+// dialer returns the dial function of a host socket: main (see guard) dials
+// the main target, and a bound service's target is dialed if the client
+// names one.
+func (c *catalog) dialer(id uint32, main func(context.Context) (net.Conn, error)) func(context.Context) (net.Conn, error) {
+	return func(ctx context.Context) (net.Conn, error) {
+		name := c.serviceOf(ctx, id)
+		if name == "" {
+			return main(ctx)
+		}
+
+		c.mu.Lock()
+		t, bound := c.targets[name], c.bound[name]
+		if t == nil {
+			t = c.ports[name]
+		}
+		c.mu.Unlock()
+		if !bound {
+			return nil, fmt.Errorf("service %q was not bound", name)
+		}
+		util.LogDebug("[%08x] connecting to service %s", id, name)
+		return t.dial(ctx)
+	}
+}
+
+// serveCatalog makes the host answer the client's bind and open messages.
+// Binds are decided off the dispatch goroutine, as authorization may wait
+// for the operator.
+func (a *adapter) serveCatalog(ctx context.Context) {
+	a.ctl.handle(controlBind, func(msg *controlMessage) {
+		go func() {
+			name := strings.ToLower(msg.Name)
+			if err := a.catalog.bind(ctx, name); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				util.LogWarning("refused the peer's request for service %s: %v", name, err)
+				a.ctl.send(&controlMessage{Kind: controlDenied, Name: msg.Name, Reason: err.Error()})
+				return
+			}
+			util.LogInfo("the peer is using service %s", name)
+			a.ctl.send(&controlMessage{Kind: controlBound, Name: msg.Name})
+		}()
+	})
+	a.ctl.handle(controlOpen, func(msg *controlMessage) {
+		if msg.Socket != 0 {
+			a.catalog.open(msg.Socket, strings.ToLower(msg.Name))
+		}
+	})
+}
+
+// SetServices replaces the named services a host adapter offers (see
+// HostConfig.Services) while it runs, e.g. on a configuration reload, and
+// announces the new catalog. The client keeps the services it bound that are
+// still offered; connections already made are left alone.
+func (h *Handle) SetServices(services map[string]string) error {
+	a := h.a
+	if a.catalog == nil {
+		return errors.New("not a host adapter")
+	}
+	a.catalog.set(services)
+	a.announce()
+	return nil
+}
+
+// awaitBinds makes the client route the host's answers to pending binds.
+func (a *adapter) awaitBinds() {
+	a.binds = make(map[string]chan error)
+
+	reply := func(name string, err error) {
+		a.mu.Lock()
+		ch, ok := a.binds[name]
+		delete(a.binds, name)
+		a.mu.Unlock()
+		if ok {
+			ch <- err
+		}
+	}
+	a.ctl.handle(controlBound, func(msg *controlMessage) { reply(msg.Name, nil) })
+	a.ctl.handle(controlDenied, func(msg *controlMessage) {
+		reply(msg.Name, fmt.Errorf("%w: %s", ErrServiceDenied, msg.Reason))
+	})
+}
+
+// requestBind asks the host for a service and waits for the answer.
+func (a *adapter) requestBind(ctx context.Context, name string) error {
+	ch := make(chan error, 1)
+	a.mu.Lock()
+	if _, pending := a.binds[name]; pending {
+		a.mu.Unlock()
+		return fmt.Errorf("service %s is already being bound", name)
+	}
+	a.binds[name] = ch
+	// Sockets name their service from now on, so none opened while the host
+	// already expects it waits for openWait.
+	a.named = true
+	a.mu.Unlock()
+
+	defer func() {
+		a.mu.Lock()
+		if a.binds[name] == ch {
+			delete(a.binds, name)
+		}
+		a.mu.Unlock()
+	}()
+
+	if !a.ctl.send(&controlMessage{Kind: controlBind, Name: name}) {
+		return errNoControl
+	}
+	select {
+	case err := <-ch:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-a.ctx.Done():
+		return net.ErrClosed
+	}
+}
+
+// Catalog waits for the host's announcement and returns its named services
+// (see HostConfig.Services), or ctx's error if it does not arrive in time.
+// Only a client adapter receives announcements.
+func (h *Handle) Catalog(ctx context.Context) ([]ServiceInfo, error) {
+	if h.a.announced == nil {
+		return nil, errors.New("not a client adapter")
+	}
+	select {
+	case <-h.a.announced:
+		return h.a.announcement.Load().catalog, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-h.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Bind asks the host for the named service of its catalog, or for a port of
+// the host's target machine if name is a port number, and, once granted,
+// listens on localAddr for connections to it, like the main listener of
+// StartAsClientWith (without ClientConfig.LocalTLS and Mux). It returns the
+// address bound, ErrServiceDenied if the host refuses, or ctx's error if it
+// does not answer in time.
+func (h *Handle) Bind(ctx context.Context, name, localAddr string) (net.Addr, error) {
+	a := h.a
+	if a.binds == nil {
+		return nil, errors.New("not a client adapter")
+	}
+	name = strings.ToLower(name)
+	if err := a.requestBind(ctx, name); err != nil {
+		return nil, err
+	}
+
+	listener, err := listen(localAddr, a.client.ReusePort)
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	if a.draining {
+		a.mu.Unlock()
+		listener.Close()
+		return nil, errDraining
+	}
+	a.listeners = append(a.listeners, listener)
+	a.mu.Unlock()
+
+	util.LogSuccess("service %s bound, listening on %s", name, listener.Addr())
+	go a.accept(a.ctx, listener, name)
+	return listener.Addr(), nil
+}
+
+// closeListeners closes the listeners of bound services.
+func (a *adapter) closeListeners() {
+	a.mu.Lock()
+	listeners := a.listeners
+	a.listeners = nil
+	a.mu.Unlock()
+
+	for _, l := range listeners {
+		l.Close()
+	}
+}
+
+// nameService tells the host which service a new client socket connects to,
+// once the client has bound any.
+func (a *adapter) nameService(id uint32, service string) {
+	a.mu.Lock()
+	named := a.named
+	a.mu.Unlock()
+	if named {
+		a.ctl.send(&controlMessage{Kind: controlOpen, Socket: id, Name: service})
+	}
+}
@@ -0,0 +1,230 @@
+package adapter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/1ureka/roj1/internal/protocol"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// Control messages carry tunnel-wide information, outside any socket, in
+// CONTROL packets: one JSON controlMessage each. A side ignores kinds it does
+// not know, so new kinds can be added without breaking older peers; peers
+// that predate CONTROL packets drop them as undecodable.
+//
+// Either side may start its adapter first, and a transport drops packets
+// that arrive before the peer's adapter is listening. Messages that must not
+// be missed are therefore sent at start and also on request (see
+// controlQuery).
+
+// Controller is an optional Transport extension for transports that can send
+// CONTROL packets. Without it, no control messages are exchanged.
+type Controller interface {
+	SendControl(payload []byte)
+}
+
+// Control message kinds.
+const (
+	controlQuery   = "query"   // client: asks the host to announce its service again
+	controlService = "service" // host: describes the forwarded service (Service) and its catalog (Services)
+	controlBind    = "bind"    // client: asks to use a cataloged service (Name)
+	controlBound   = "bound"   // host: grants a bind (Name)
+	controlDenied  = "denied"  // host: refuses a bind (Name, Reason)
+	controlOpen    = "open"    // client: names the service a new socket connects to (Socket, Name)
+	controlText    = "msg"     // either: a message for the other side's operator (Text)
+
+	controlRetarget   = "retarget"   // client: asks to forward to another port of the target's host (Port)
+	controlRetargeted = "retargeted" // host: answers a retarget (Port, and Reason if refused)
+)
+
+// controlMessage is the payload of a CONTROL packet.
+type controlMessage struct {
+	Kind string `json:"kind"`
+
+	// ID numbers the sender's messages, so copies of one (e.g. from a
+	// duplicating bond) are handled once.
+	ID uint64 `json:"id"`
+
+	Service  *ServiceInfo  `json:"service,omitempty"`
+	Services []ServiceInfo `json:"services,omitempty"`
+	Name     string        `json:"name,omitempty"`
+	Socket   uint32        `json:"socket,omitempty"`
+	Port     int           `json:"port,omitempty"`
+	Reason   string        `json:"reason,omitempty"`
+	Text     string        `json:"text,omitempty"`
+}
+
+// ServiceInfo describes the service the host forwards to, as announced to the
+// client once the tunnel is up.
+type ServiceInfo struct {
+	Name     string `json:"name,omitempty"`     // catalog name (see HostConfig.Services)
+	Port     int    `json:"port"`               // target port
+	Label    string `json:"label,omitempty"`    // e.g. "Postgres 16"
+	Protocol string `json:"protocol,omitempty"` // hint such as "postgres" or "http"
+}
+
+// Description returns the label and protocol hint for display, e.g.
+// "Postgres 16 (postgres)", or "" if neither is set.
+func (s ServiceInfo) Description() string {
+	switch {
+	case s.Label != "" && s.Protocol != "":
+		return fmt.Sprintf("%s (%s)", s.Label, s.Protocol)
+	case s.Label != "":
+		return s.Label
+	default:
+		return s.Protocol
+	}
+}
+
+// controlSeen is the number of received message IDs kept for deduplication.
+const controlSeen = 64
+
+var errInvalidControl = errors.New("invalid CONTROL message")
+
+// controller sends and dispatches an adapter's control messages.
+type controller struct {
+	tr       Controller // nil if the transport cannot send CONTROL packets
+	next     atomic.Uint64
+	handlers map[string]func(*controlMessage) // set before the transport delivers packets
+
+	mu   sync.Mutex
+	seen []uint64 // IDs of the last controlSeen messages received
+}
+
+// newController returns a controller sending through tr, if it can.
+func newController(tr Transport) *controller {
+	c := &controller{handlers: make(map[string]func(*controlMessage))}
+	c.tr, _ = tr.(Controller)
+	return c
+}
+
+// handle registers fn for messages of the given kind.
+func (c *controller) handle(kind string, fn func(*controlMessage)) {
+	c.handlers[kind] = fn
+}
+
+// send numbers msg and sends it to the peer. It reports false if the
+// transport cannot carry control messages.
+func (c *controller) send(msg *controlMessage) bool {
+	if c.tr == nil {
+		return false
+	}
+	msg.ID = c.next.Add(1)
+	payload, err := json.Marshal(msg)
+	if err != nil || len(payload) > protocol.MaxControlSize {
+		util.LogDebug("control message %q not sent: %d bytes, %v", msg.Kind, len(payload), err)
+		return false
+	}
+	tracePacket(true, 0, protocol.TypeControl, 0, len(payload))
+	c.tr.SendControl(payload)
+	return true
+}
+
+// receive decodes a CONTROL packet and calls the handler of its kind. It
+// returns an error for a payload that is not a control message.
+func (c *controller) receive(pkt *protocol.Packet) error {
+	var msg controlMessage
+	if err := json.Unmarshal(pkt.Payload, &msg); err != nil || msg.Kind == "" {
+		return fmt.Errorf("%w: %d bytes", errInvalidControl, len(pkt.Payload))
+	}
+	if c.duplicate(msg.ID) {
+		return nil
+	}
+
+	fn, ok := c.handlers[msg.Kind]
+	if !ok {
+		util.LogDebug("ignoring control message of unknown kind %q", msg.Kind)
+		return nil
+	}
+	fn(&msg)
+	return nil
+}
+
+// duplicate reports whether a message with this ID was received lately, and
+// records it otherwise.
+func (c *controller) duplicate(id uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, seen := range c.seen {
+		if seen == id {
+			return true
+		}
+	}
+	if len(c.seen) == controlSeen {
+		c.seen = c.seen[1:]
+	}
+	c.seen = append(c.seen, id)
+	return false
+}
+
+// control handles a CONTROL packet from the peer, counting a malformed one
+// as a violation.
+func (a *adapter) control(pkt *protocol.Packet) {
+	if err := a.ctl.receive(pkt); err != nil {
+		a.violation(pkt, err)
+	}
+}
+
+// announceService makes the host tell the client which service it forwards
+// to, and its catalog if any, now and whenever the client asks.
+func (a *adapter) announceService(info ServiceInfo) {
+	a.mu.Lock()
+	a.service = info
+	a.mu.Unlock()
+
+	a.ctl.handle(controlQuery, func(*controlMessage) { a.announce() })
+	a.announce()
+}
+
+// announce sends the host's service announcement.
+func (a *adapter) announce() {
+	a.mu.Lock()
+	info := a.service
+	a.mu.Unlock()
+	a.ctl.send(&controlMessage{Kind: controlService, Service: &info, Services: a.catalog.services()})
+}
+
+// announcement is what the client learned from the host's announcement.
+type announcement struct {
+	service ServiceInfo
+	catalog []ServiceInfo
+}
+
+// awaitService makes the client record and report the host's service
+// announcement (see Handle.Service), asking the host for it in case the
+// announcement was sent before the client was listening.
+func (a *adapter) awaitService() {
+	a.announced = make(chan struct{})
+	var once sync.Once
+
+	a.ctl.handle(controlService, func(msg *controlMessage) {
+		if msg.Service == nil {
+			return
+		}
+		info := &announcement{service: *msg.Service, catalog: msg.Services}
+		old := a.announcement.Swap(info)
+		once.Do(func() { close(a.announced) })
+		if old != nil && old.service == info.service && slices.Equal(old.catalog, info.catalog) {
+			return
+		}
+
+		if name := info.service.Description(); name != "" {
+			util.LogSuccess("connected to %s on the peer's port %d", name, info.service.Port)
+		} else {
+			util.LogSuccess("connected to the peer's port %d", info.service.Port)
+		}
+		util.EmitEvent(util.Event{
+			Event:    util.EventServiceAnnounced,
+			Port:     info.service.Port,
+			Label:    info.service.Label,
+			Protocol: info.service.Protocol,
+		})
+	})
+	a.ctl.send(&controlMessage{Kind: controlQuery})
+}
@@ -0,0 +1,67 @@
+package adapter
+
+import (
+	"context"
+	"runtime"
+	"time"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// Leak detection timing (see watchLeaks).
+const (
+	leakInterval = 30 * time.Second // report this often
+	leakGrace    = 10 * time.Second // a socket closing for longer is reported
+)
+
+// watchLeaks periodically logs the adapter's resource usage at debug level,
+// and warns about sockets still registered leakGrace after their cleanup
+// started (e.g. their TCP connection closed), until ctx is done.
+func (a *adapter) watchLeaks(ctx context.Context) {
+	ticker := time.NewTicker(leakInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.reportLeaks()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reportLeaks logs one resource report (see watchLeaks).
+func (a *adapter) reportLeaks() {
+	type stale struct {
+		id  uint32
+		age time.Duration
+	}
+
+	a.mu.Lock()
+	sockets := len(a.routes)
+	var buffered int
+	var leaked []stale
+	for id, s := range a.routes {
+		buffered += s.reasm.buffered()
+		if t := s.closing.Load(); t != 0 {
+			if age := time.Since(time.Unix(0, t)); age > leakGrace {
+				leaked = append(leaked, stale{id, age})
+			}
+		}
+	}
+	a.mu.Unlock()
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	util.LogDebug("goroutines: %d | sockets: %d | reorder buffers: %s | heap: %s in use, %s idle",
+		runtime.NumGoroutine(), sockets,
+		util.FormatBytes(float64(buffered)),
+		util.FormatBytes(float64(m.HeapInuse)),
+		util.FormatBytes(float64(m.HeapIdle)),
+	)
+
+	for _, s := range leaked {
+		util.LogWarning("[%08x] socket still registered %v after it started closing — possible leak", s.id, s.age.Round(time.Second))
+	}
+}
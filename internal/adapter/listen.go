@@ -0,0 +1,122 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+)
+
+// listen opens the client's local TCP listener. addr may use an IPv4 or IPv6
+// literal or a hostname. For "localhost" it listens on both loopback families
+// (127.0.0.1 and ::1), so clients resolving localhost to either one connect;
+// it only fails if neither is available. With reusePort, the sockets are
+// opened with SO_REUSEPORT (see ClientConfig.ReusePort).
+func listen(addr string, reusePort bool) (net.Listener, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	var lc net.ListenConfig
+	if reusePort {
+		lc.Control = setReusePort
+	}
+	if host != "localhost" {
+		return lc.Listen(context.Background(), "tcp", addr)
+	}
+
+	var (
+		listeners []net.Listener
+		errs      []error
+	)
+	for _, ip := range []string{"127.0.0.1", "::1"} {
+		l, err := lc.Listen(context.Background(), "tcp", net.JoinHostPort(ip, port))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		listeners = append(listeners, l)
+
+		// With port 0, bind the second family to the port the first one got.
+		port = portOf(l.Addr())
+	}
+
+	switch len(listeners) {
+	case 0:
+		return nil, errors.Join(errs...)
+	case 1:
+		return listeners[0], nil
+	default:
+		return newMultiListener(listeners), nil
+	}
+}
+
+// portOf returns the port of a TCP address as a string.
+func portOf(addr net.Addr) string {
+	_, port, _ := net.SplitHostPort(addr.String())
+	return port
+}
+
+// multiListener merges several listeners into one (private). Accept returns
+// connections from any of them; Close closes all of them.
+type multiListener struct {
+	listeners []net.Listener
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newMultiListener starts an accept goroutine per listener.
+func newMultiListener(listeners []net.Listener) *multiListener {
+	m := &multiListener{
+		listeners: listeners,
+		conns:     make(chan net.Conn),
+		done:      make(chan struct{}),
+	}
+	for _, l := range listeners {
+		go m.acceptLoop(l)
+	}
+	return m
+}
+
+// acceptLoop forwards connections from l until l or m is closed.
+func (m *multiListener) acceptLoop(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		select {
+		case m.conns <- conn:
+		case <-m.done:
+			conn.Close()
+			return
+		}
+	}
+}
+
+// Accept waits for the next connection on any of the listeners.
+func (m *multiListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-m.conns:
+		return conn, nil
+	case <-m.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes all listeners.
+func (m *multiListener) Close() error {
+	m.closeOnce.Do(func() {
+		close(m.done)
+		for _, l := range m.listeners {
+			l.Close()
+		}
+	})
+	return nil
+}
+
+// Addr returns the address of the first listener.
+func (m *multiListener) Addr() net.Addr {
+	return m.listeners[0].Addr()
+}
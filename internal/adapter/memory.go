@@ -0,0 +1,129 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"runtime/debug"
+	"runtime/metrics"
+	"sync/atomic"
+	"time"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// Memory watchdog: WatchMemory samples the memory the Go runtime holds from
+// the OS every memInterval and degrades in steps instead of letting a small
+// host run out of memory. Above memHighRatio of the limit, reorder buffers
+// are capped at pressureSocketBytes, so sockets apply backpressure (see
+// Socket.overflow) instead of buffering; at the limit, new connections are
+// refused as well. Each step is left only once usage has dropped a margin
+// below it, so the level does not flap.
+
+const (
+	memInterval         = time.Second
+	memHighRatio        = 0.8     // shrink reorder buffers from here
+	memMargin           = 0.1     // of the limit, to leave a level again
+	pressureSocketBytes = 1 << 20 // reorder buffer cap above memHighRatio
+)
+
+// Memory pressure levels.
+const (
+	memNormal int32 = iota
+	memHigh
+	memCritical
+)
+
+// memLevel is the current process-wide memory pressure level.
+var memLevel atomic.Int32
+
+// errMemoryPressure is why sockets are refused at the memory limit.
+var errMemoryPressure = errors.New("memory limit reached")
+
+// WatchMemory degrades the adapters of this process gracefully while the
+// memory held by the Go runtime is near limit bytes, until ctx is done. It
+// also sets the runtime's soft memory limit, so the garbage collector works
+// harder before anything is degraded. Zero or negative limits do nothing.
+func WatchMemory(ctx context.Context, limit int64) {
+	if limit <= 0 {
+		return
+	}
+	prev := debug.SetMemoryLimit(limit)
+	updateMemLevel(limit)
+
+	go func() {
+		ticker := time.NewTicker(memInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				updateMemLevel(limit)
+			case <-ctx.Done():
+				debug.SetMemoryLimit(prev)
+				memLevel.Store(memNormal)
+				return
+			}
+		}
+	}()
+}
+
+// updateMemLevel samples the memory in use and moves to the matching level,
+// logging the change.
+func updateMemLevel(limit int64) {
+	used := memoryInUse()
+	level := memLevel.Load()
+	next := nextMemLevel(level, float64(used)/float64(limit))
+	if next == level {
+		return
+	}
+	memLevel.Store(next)
+
+	switch next {
+	case memCritical:
+		util.LogWarning("memory use %s is at the limit of %s — refusing new connections",
+			util.FormatBytes(float64(used)), util.FormatBytes(float64(limit)))
+	case memHigh:
+		util.LogWarning("memory use %s is near the limit of %s — shrinking reorder buffers",
+			util.FormatBytes(float64(used)), util.FormatBytes(float64(limit)))
+	default:
+		util.LogInfo("memory use back to %s — resuming normal operation", util.FormatBytes(float64(used)))
+	}
+}
+
+// nextMemLevel returns the level for a usage ratio of the limit, given the
+// current level.
+func nextMemLevel(level int32, ratio float64) int32 {
+	switch {
+	case ratio >= 1, level == memCritical && ratio >= 1-memMargin:
+		return memCritical
+	case ratio >= memHighRatio, level >= memHigh && ratio >= memHighRatio-memMargin:
+		return memHigh
+	default:
+		return memNormal
+	}
+}
+
+// memoryInUse returns the bytes the Go runtime holds from the OS, excluding
+// heap memory it has already returned.
+func memoryInUse() uint64 {
+	samples := []metrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	metrics.Read(samples)
+	return samples[0].Value.Uint64() - samples[1].Value.Uint64()
+}
+
+// memoryCritical reports whether new connections must be refused.
+func memoryCritical() bool {
+	return memLevel.Load() == memCritical
+}
+
+// memoryCap returns limit, lowered to pressureSocketBytes under memory
+// pressure.
+func memoryCap(limit int) int {
+	if memLevel.Load() >= memHigh {
+		return min(limit, pressureSocketBytes)
+	}
+	return limit
+}
@@ -0,0 +1,85 @@
+package adapter
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// Operator messages: short texts the people running either side of the
+// tunnel send each other (e.g. "rebooting the server"), carried in control
+// messages and shown prominently in the log.
+
+const (
+	MaxMessageLen   = 1024                   // longest message text, in bytes
+	messageInterval = 250 * time.Millisecond // the peer's messages arriving faster are dropped
+)
+
+// SendMessage sends text to the operator of the other side. It fails if the
+// text is empty or longer than MaxMessageLen, or if the transport cannot
+// carry control messages.
+func (h *Handle) SendMessage(text string) error {
+	text = strings.TrimSpace(text)
+	switch {
+	case text == "":
+		return errors.New("empty message")
+	case len(text) > MaxMessageLen:
+		return fmt.Errorf("message longer than %d bytes", MaxMessageLen)
+	}
+
+	select {
+	case <-h.done:
+		return net.ErrClosed
+	default:
+	}
+	if !h.a.ctl.send(&controlMessage{Kind: controlText, Text: text}) {
+		return errNoControl
+	}
+	return nil
+}
+
+// receiveMessages makes the adapter show the peer's messages, at most one per
+// messageInterval so a peer cannot flood the log.
+func (a *adapter) receiveMessages() {
+	var (
+		mu   sync.Mutex
+		last time.Time
+	)
+	a.ctl.handle(controlText, func(msg *controlMessage) {
+		mu.Lock()
+		now := time.Now()
+		early := now.Sub(last) < messageInterval
+		if !early {
+			last = now
+		}
+		mu.Unlock()
+		if early {
+			util.LogDebug("dropping a message from the peer sent too soon after the last")
+			return
+		}
+
+		text := printable(msg.Text)
+		if text == "" || len(text) > MaxMessageLen {
+			return
+		}
+		util.EmitEvent(util.Event{Event: util.EventMessage, Text: text})
+	})
+}
+
+// printable strips the control characters (terminal escapes among them) and
+// bidirectional overrides from text the peer sent, keeping line breaks and
+// tabs.
+func printable(text string) string {
+	return strings.TrimSpace(strings.Map(func(r rune) rune {
+		if r != '\n' && r != '\t' && (unicode.IsControl(r) || unicode.Is(unicode.Bidi_Control, r) || r == unicode.ReplacementChar) {
+			return -1
+		}
+		return r
+	}, text))
+}
@@ -0,0 +1,139 @@
+package adapter
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// mirrorDialTimeout bounds connecting to a tcp:// mirror destination.
+const mirrorDialTimeout = 5 * time.Second
+
+// Mirror copies the bytes bridged by selected host sockets to a file or a
+// TCP port, for debugging or recording. The copy includes whatever the
+// connections carry, passwords and tokens included, so it is only meant for
+// traffic the operator may inspect.
+//
+// A file receives a record per write, a header line followed by the bytes:
+//
+//	15:04:05.000000 [0000abcd] → target 16384
+//
+// where → is the peer's data written to the target and ← the target's data
+// sent to the peer. A tcp://host:port destination instead gets one connection
+// per socket carrying the raw bytes of both directions, e.g. for nc -lk.
+type Mirror struct {
+	all bool
+	id  uint32
+
+	addr string // tcp:// destination, "" for a file
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewMirror starts mirroring the socket with the given ID, or all sockets if
+// all is set, to dest: a file path (appended to) or tcp://host:port.
+func NewMirror(dest string, socketID uint32, all bool) (*Mirror, error) {
+	m := &Mirror{all: all, id: socketID}
+
+	if addr, ok := strings.CutPrefix(dest, "tcp://"); ok {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return nil, err
+		}
+		m.addr = addr
+		return m, nil
+	}
+
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	m.file = f
+	return m, nil
+}
+
+// Close closes the mirror file. Sockets still bridging stop mirroring.
+func (m *Mirror) Close() error {
+	if m.file == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.file.Close()
+}
+
+// tap returns the mirror of one socket, or nil if it is not mirrored. Safe
+// on a nil Mirror. muxSocketID carries mux frames, not a connection's bytes,
+// so it is never mirrored.
+func (m *Mirror) tap(id uint32) *mirrorTap {
+	if m == nil || id == muxSocketID || (!m.all && id != m.id) {
+		return nil
+	}
+	return &mirrorTap{m: m, id: id}
+}
+
+// record appends one record to the mirror file.
+func (m *Mirror) record(id uint32, toTarget bool, b []byte) error {
+	dir := "←"
+	if toTarget {
+		dir = "→"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := fmt.Fprintf(m.file, "%s [%08x] %s target %d\n%s\n", time.Now().Format("15:04:05.000000"), id, dir, len(b), b)
+	return err
+}
+
+// mirrorTap tees one socket's bytes into its Mirror. After a failure it
+// stops mirroring the socket; the connection itself is unaffected.
+type mirrorTap struct {
+	m  *Mirror
+	id uint32
+
+	mu     sync.Mutex
+	conn   io.WriteCloser // tcp:// connection, dialed on first write
+	failed bool
+}
+
+// write mirrors b, written to the target if toTarget, else sent to the peer.
+func (t *mirrorTap) write(toTarget bool, b []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.failed {
+		return
+	}
+
+	var err error
+	if t.m.file != nil {
+		err = t.m.record(t.id, toTarget, b)
+	} else {
+		if t.conn == nil {
+			t.conn, err = net.DialTimeout("tcp", t.m.addr, mirrorDialTimeout)
+		}
+		if err == nil {
+			_, err = t.conn.Write(b)
+		}
+	}
+
+	if err != nil {
+		t.failed = true
+		util.LogWarning("[%08x] mirroring stopped: %v", t.id, err)
+	}
+}
+
+// close closes the tap's tcp:// connection, if any.
+func (t *mirrorTap) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn != nil {
+		t.conn.Close()
+	}
+	t.failed = true
+}
@@ -0,0 +1,202 @@
+package adapter
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/1ureka/roj1/internal/mux"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// muxSocketID is the socket that carries the stream multiplexer when the
+// client runs with ClientConfig.Mux. mixID never yields 0, so it cannot clash
+// with a regular socket.
+//
+// The multiplexed mode leaves the packet framing alone: socket 0 is an
+// ordinary socket whose "TCP connection" is one end of a net.Pipe, and a
+// mux.Session runs on the other end. Each local connection then becomes a
+// mux stream with its own flow control window and half-close, and the host
+// dials the target once per stream instead of once per socket.
+const muxSocketID = 0
+
+// startMuxClient registers muxSocketID and starts the client's mux session
+// on it. The socket sends CONNECT at once, so the host sets up its side
+// before the first stream arrives.
+func (a *adapter) startMuxClient(ctx context.Context, tr Transport, connectTimeout time.Duration) {
+	conn, peer := net.Pipe()
+
+	a.mu.Lock()
+	s := newSocketWithConn(ctx, muxSocketID, tr, conn)
+	s.transfer = a.transfer
+	s.replies = &a.replies
+	a.routes[muxSocketID] = s
+	a.track(s)
+	a.session = mux.Client(peer)
+	a.mu.Unlock()
+
+	go s.runAsClient(connectTimeout)
+}
+
+// openStream forwards an accepted local connection over a new mux stream.
+func (a *adapter) openStream(conn net.Conn, tcp TCPOptions) {
+	st, err := a.muxSession().Open()
+	if err != nil {
+		util.LogWarning("failed to open a stream for the connection from %s: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	if err := a.admitStream(); err != nil {
+		a.refuseStream(st, err)
+		conn.Close()
+		return
+	}
+
+	util.LogDebug("[%08x] new connection from %s", st.ID(), conn.RemoteAddr())
+	tcp.apply(st.ID(), conn)
+	go a.proxy(st, conn)
+}
+
+// muxDialer returns the host's dial function for muxSocketID: instead of
+// dialing the target, it starts a mux session on a pipe and returns the
+// pipe's other end. Each stream is then connected with dial.
+func (a *adapter) muxDialer(dial func(context.Context) (net.Conn, error), tcp TCPOptions) func(context.Context) (net.Conn, error) {
+	return func(context.Context) (net.Conn, error) {
+		conn, peer := net.Pipe()
+		sess := mux.Server(peer)
+
+		a.mu.Lock()
+		a.session = sess
+		a.mu.Unlock()
+
+		util.LogDebug("[%08x] mux session started", muxSocketID)
+		go a.serveMux(sess, dial, tcp)
+		return conn, nil
+	}
+}
+
+// serveMux dials the target for each stream the client opens, subject to the
+// same socket quota and draining as regular sockets.
+func (a *adapter) serveMux(sess *mux.Session, dial func(context.Context) (net.Conn, error), tcp TCPOptions) {
+	for {
+		st, err := sess.Accept()
+		if err != nil {
+			return
+		}
+		if err := a.admitStream(); err != nil {
+			a.refuseStream(st, err)
+			continue
+		}
+
+		go func() {
+			conn, err := dial(a.ctx)
+			if err != nil {
+				util.LogWarning("[%08x] TCP dial failed: %v", st.ID(), err)
+				st.Close()
+				a.streams.Done()
+				a.closeIdleMux()
+				return
+			}
+			tcp.apply(st.ID(), conn)
+			util.LogDebug("[%08x] TCP connected to %s", st.ID(), conn.RemoteAddr())
+			a.proxy(st, conn)
+		}()
+	}
+}
+
+// muxSession returns the mux session, or nil if none was started.
+func (a *adapter) muxSession() *mux.Session {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.session
+}
+
+// admitStream counts a new stream towards a.streams, or returns why it must
+// be refused: errDraining, or errSocketQuota beyond Quotas.MaxSockets streams.
+func (a *adapter) admitStream() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.draining {
+		return errDraining
+	}
+	if memoryCritical() {
+		return errMemoryPressure
+	}
+	if a.quotas.MaxSockets > 0 && a.session.NumStreams() > a.quotas.MaxSockets {
+		return errSocketQuota
+	}
+	a.streams.Add(1)
+	return nil
+}
+
+// refuseStream resets a stream that admitStream refused.
+func (a *adapter) refuseStream(st *mux.Stream, err error) {
+	util.Stats.AddRejected()
+	util.LogDebug("[%08x] %v, refusing stream", st.ID(), err)
+	st.Close()
+	a.closeIdleMux()
+}
+
+// closeIdleMux closes the mux session once the adapter is draining and no
+// streams are left, which closes muxSocketID so that waitIdle can complete.
+func (a *adapter) closeIdleMux() {
+	a.mu.Lock()
+	sess, draining := a.session, a.draining
+	a.mu.Unlock()
+
+	if sess != nil && draining && sess.NumStreams() == 0 {
+		sess.Close()
+	}
+}
+
+// proxy bridges a stream and a TCP connection until both directions are done,
+// passing half-closes through. The stream must have been admitted (see
+// admitStream).
+func (a *adapter) proxy(st *mux.Stream, conn net.Conn) {
+	defer a.streams.Done()
+
+	util.Stats.AddConn()
+	util.NotifyConnOpen(st.ID())
+
+	var in, out int64
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		in = pipe(conn, st, st.ID())
+	}()
+	go func() {
+		defer wg.Done()
+		out = pipe(st, conn, st.ID())
+	}()
+	wg.Wait()
+
+	st.Close()
+	conn.Close()
+	util.Stats.RemoveConn()
+	util.NotifyConnClose(st.ID(), in, out)
+	util.LogDebug("[%08x] stream closed", st.ID())
+	a.closeIdleMux()
+}
+
+// pipe copies src to dst and then half-closes dst. On an error both are
+// closed, which stops the other direction too. Returns the bytes copied.
+func pipe(dst, src net.Conn, id uint32) int64 {
+	n, err := io.Copy(dst, src)
+	if err != nil {
+		util.LogDebug("[%08x] stream copy error: %v", id, err)
+		dst.Close()
+		src.Close()
+		return n
+	}
+
+	if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+	} else {
+		dst.Close()
+	}
+	return n
+}
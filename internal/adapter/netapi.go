@@ -0,0 +1,164 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+)
+
+// ErrRefused is returned by Dialer.DialContext when the host closes a
+// connection without answering it, e.g. because the target is down or the
+// peer's policy does not allow it.
+var ErrRefused = errors.New("connection refused by the host")
+
+// Dialer is the client side of a tunnel for Go programs: instead of listening
+// on a local port, each connection is dialed in-process and carried to the
+// host, like a connection accepted by StartAsClientWith. Its DialContext fits
+// net/http.Transport and other code taking a dial function.
+type Dialer struct {
+	h   *Handle
+	ctx context.Context
+	tr  Transport
+	cfg ClientConfig
+}
+
+// NewDialer starts the client-side adapter without a local listener.
+func NewDialer(ctx context.Context, tr Transport, cfg ClientConfig) *Dialer {
+	h, ctx := start(ctx, tr)
+	h.a.serveClient(ctx, tr, cfg)
+	return &Dialer{h: h, ctx: ctx, tr: tr, cfg: cfg}
+}
+
+// DialContext opens a connection through the tunnel. network and address are
+// ignored: the host decides the target, and its Policy which connections are
+// allowed. It returns once the host has answered, i.e. reached the target,
+// or ErrRefused. With ClientConfig.Mux the stream is returned at once.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if d.h.a.isDraining() {
+		return nil, net.ErrClosed
+	}
+	if memoryCritical() {
+		return nil, errMemoryPressure
+	}
+
+	conn, peer := net.Pipe()
+	s := d.h.a.bridge(d.ctx, d.tr, peer, d.cfg, "")
+	if s == nil {
+		return conn, nil
+	}
+
+	select {
+	case <-s.answered:
+		return conn, nil
+	case <-s.closed:
+		select {
+		case <-s.answered: // answered, then closed at once
+			return conn, nil
+		default:
+		}
+		conn.Close()
+		return nil, ErrRefused
+	case <-ctx.Done():
+		conn.Close()
+		return nil, ctx.Err()
+	}
+}
+
+// Dial is DialContext without a context.
+func (d *Dialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// Done returns a channel that is closed when the adapter has stopped.
+func (d *Dialer) Done() <-chan struct{} {
+	return d.h.Done()
+}
+
+// Close stops dialing and shuts the adapter down gracefully (see
+// Handle.Close).
+func (d *Dialer) Close(ctx context.Context) error {
+	return d.h.Close(ctx)
+}
+
+// Listener is the host side of a tunnel for Go programs: a net.Listener whose
+// Accept returns each connection the peer opens through the tunnel, instead
+// of dialing a target. The HostConfig settings about the target (TCP,
+// ResolveInterval, DialRetry, Wake and Policy.Ports) do not apply.
+type Listener struct {
+	h         *Handle
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Listen starts the host-side adapter, serving connections through the
+// returned Listener.
+func Listen(ctx context.Context, tr Transport, cfg HostConfig) *Listener {
+	h, ctx := start(ctx, tr)
+	l := &Listener{
+		h:      h,
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+	h.a.serveHost(ctx, tr, cfg, l.dial, true)
+	return l
+}
+
+// dial hands one end of a pipe to Accept and returns the other to the socket.
+func (l *Listener) dial(ctx context.Context) (net.Conn, error) {
+	conn, peer := net.Pipe()
+	select {
+	case l.conns <- peer:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Accept waits for the next connection opened by the peer.
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	case <-l.h.Done():
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops accepting connections. Those already accepted keep working
+// until they end or the tunnel closes; see Shutdown.
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		l.h.a.drain()
+	})
+	return nil
+}
+
+// Shutdown closes the listener and shuts the adapter down gracefully (see
+// Handle.Close).
+func (l *Listener) Shutdown(ctx context.Context) error {
+	l.Close()
+	return l.h.Close(ctx)
+}
+
+// Done returns a channel that is closed when the adapter has stopped.
+func (l *Listener) Done() <-chan struct{} {
+	return l.h.Done()
+}
+
+// Addr returns a placeholder address: the listener has no network address.
+func (l *Listener) Addr() net.Addr {
+	return tunnelAddr{}
+}
+
+// tunnelAddr is the net.Addr of a Listener.
+type tunnelAddr struct{}
+
+func (tunnelAddr) Network() string { return "roj1" }
+func (tunnelAddr) String() string  { return "tunnel" }
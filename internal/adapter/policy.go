@@ -0,0 +1,84 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// Policy restricts what the peer of a host adapter may do, typically set
+// from the options of the key it authenticated with. Zero fields are
+// unrestricted; the peer's socket limit is Quotas.MaxSockets.
+type Policy struct {
+	// Ports lists the target ports the peer may connect to. Every CONNECT
+	// to another port is answered with CLOSE. Empty allows any port.
+	Ports []int
+
+	// MaxBandwidth caps the payload bytes per second in each direction,
+	// with a burst of one second's worth. Excess data is delayed.
+	MaxBandwidth int64
+
+	// MaxSession closes the tunnel this long after the adapter started (see
+	// limitSession), and RunAsHostWith then returns ErrSessionLimit.
+	MaxSession time.Duration
+}
+
+// ErrSessionLimit is returned by RunAsHostWith when the adapter was shut down
+// at Policy.MaxSession.
+var ErrSessionLimit = errors.New("session limit reached")
+
+// Session expiry timing (see limitSession).
+const (
+	sessionWarning = time.Minute      // warn this long before the limit
+	sessionGrace   = 10 * time.Second // let active connections finish for this long
+)
+
+// allows reports whether the policy lets the peer connect to port.
+func (p Policy) allows(port int) bool {
+	return len(p.Ports) == 0 || slices.Contains(p.Ports, port)
+}
+
+// limitSession closes the tunnel once d has elapsed, unless ctx is done
+// first. A warning is logged sessionWarning ahead (for limits long enough to
+// make that meaningful). At the limit, new connections are refused and the
+// active ones get sessionGrace to finish before everything is torn down.
+func (a *adapter) limitSession(ctx context.Context, d time.Duration) {
+	if d > 2*sessionWarning {
+		if !sleepCtx(ctx, d-sessionWarning) {
+			return
+		}
+		util.LogWarning("the session ends in %v — the tunnel will then be closed", sessionWarning)
+		d = sessionWarning
+	}
+	if !sleepCtx(ctx, d) {
+		return
+	}
+
+	util.LogWarning("session limit reached — closing the tunnel")
+	a.expired.Store(true)
+	a.drain()
+	grace := time.NewTimer(sessionGrace)
+	defer grace.Stop()
+	select {
+	case <-a.waitIdle():
+	case <-grace.C:
+	case <-ctx.Done():
+	}
+	a.abort()
+}
+
+// sleepCtx sleeps for d and reports whether it did so before ctx was done.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
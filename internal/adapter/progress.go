@@ -0,0 +1,51 @@
+package adapter
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// SocketProgress is a snapshot of an open socket, e.g. to show what a
+// draining adapter still waits on (see Handle.Sockets).
+type SocketProgress struct {
+	ID       uint32
+	Remote   string        // address of the local connection's other end ("" before a host dials)
+	BytesIn  int64         // payload bytes written to the local connection
+	BytesOut int64         // payload bytes read from the local connection
+	Idle     time.Duration // since the socket last moved payload, or opened
+}
+
+// Sockets returns the open sockets, by ID. Streams of ClientConfig.Mux are
+// not included.
+func (h *Handle) Sockets() []SocketProgress {
+	a := h.a
+	a.mu.Lock()
+	sockets := make([]*Socket, 0, len(a.routes))
+	for _, s := range a.routes {
+		sockets = append(sockets, s)
+	}
+	a.mu.Unlock()
+
+	now := time.Now()
+	list := make([]SocketProgress, 0, len(sockets))
+	for _, s := range sockets {
+		if s.id == muxSocketID {
+			continue
+		}
+		p := SocketProgress{
+			ID:       s.id,
+			BytesIn:  s.bytesIn.Load(),
+			BytesOut: s.bytesOut.Load(),
+			Idle:     now.Sub(time.Unix(0, s.active.Load())),
+		}
+		s.connMu.Lock()
+		if s.tcpConn != nil {
+			p.Remote = s.tcpConn.RemoteAddr().String()
+		}
+		s.connMu.Unlock()
+		list = append(list, p)
+	}
+	slices.SortFunc(list, func(x, y SocketProgress) int { return cmp.Compare(x.ID, y.ID) })
+	return list
+}
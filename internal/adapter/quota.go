@@ -0,0 +1,128 @@
+package adapter
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LowPowerMaxSockets is the default Quotas.MaxSockets of the low-power
+// preset (-lowPower). Each socket runs three goroutines on either side, so it
+// also bounds the goroutine count.
+const LowPowerMaxSockets = 64
+
+// Quotas bounds the resources one peer can make the host adapter allocate,
+// so a hostile client cannot exhaust memory or file descriptors. An adapter
+// serves exactly one peer, so the limits apply to the whole tunnel. Zero
+// fields are unlimited.
+type Quotas struct {
+	// MaxSockets caps concurrent sockets (and so dialed target
+	// connections). A CONNECT beyond it is answered with CLOSE.
+	MaxSockets int
+
+	// MaxBufferedBytes caps the reorder buffers of all sockets combined.
+	// The socket whose packet crosses it is torn down.
+	MaxBufferedBytes int64
+
+	// MaxPacketRate caps inbound packets per second, with a burst of one
+	// second's worth. Excess packets are delayed rather than dropped, which
+	// backs pressure up to the peer: retransmission (HostConfig.Nack) is
+	// optional, and even with it a dropped packet costs a NACK round trip.
+	MaxPacketRate int
+}
+
+// sharedBuffer is the reorder-buffer byte count across all sockets of an
+// adapter, checked against Quotas.MaxBufferedBytes.
+type sharedBuffer struct {
+	n     atomic.Int64
+	limit atomic.Int64
+}
+
+// newSharedBuffer returns an empty count with the given limit.
+func newSharedBuffer(limit int64) *sharedBuffer {
+	b := &sharedBuffer{}
+	b.limit.Store(limit)
+	return b
+}
+
+// add adjusts the count by delta and reports whether it is now over the limit.
+func (b *sharedBuffer) add(delta int64) bool {
+	return b.n.Add(delta) > b.limit.Load()
+}
+
+// full reports whether the count is over the limit.
+func (b *sharedBuffer) full() bool {
+	return b.n.Load() > b.limit.Load()
+}
+
+// rateLimiter is a token bucket refilled at rate tokens per second, holding
+// at most rate tokens. A token stands for a packet (Quotas.MaxPacketRate) or a
+// payload byte (Policy.MaxBandwidth).
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a full bucket, or nil if rate is not positive.
+func newRateLimiter(rate int64) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+// wait takes n tokens, sleeping until they are available. It returns false
+// if ctx is done first. The time spent waiting is returned for metrics.
+func (l *rateLimiter) wait(ctx context.Context, n int) (time.Duration, bool) {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.rate, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	deficit := -l.tokens
+	l.mu.Unlock()
+
+	if deficit <= 0 {
+		return 0, true
+	}
+
+	// The tokens are already taken; sleep until the bucket has refilled them.
+	d := time.Duration(deficit / l.rate * float64(time.Second))
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return d, true
+	case <-ctx.Done():
+		return 0, false
+	}
+}
+
+// SetQuotas replaces the quotas of a running host adapter (see
+// HostConfig.Quotas), e.g. on a configuration reload. Sockets beyond a
+// lowered MaxSockets are left open, but no new ones are accepted until the
+// count drops below it; a MaxBufferedBytes set only now covers the sockets
+// created from now on.
+func (h *Handle) SetQuotas(q Quotas) {
+	a := h.a
+	if old := a.packetRate.Load(); old == nil || old.rate != float64(q.MaxPacketRate) {
+		a.packetRate.Store(newRateLimiter(int64(q.MaxPacketRate)))
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.quotas = q
+	switch {
+	case a.buffer != nil && q.MaxBufferedBytes > 0:
+		a.buffer.limit.Store(q.MaxBufferedBytes)
+	case a.buffer != nil:
+		a.buffer.limit.Store(math.MaxInt64)
+	case q.MaxBufferedBytes > 0:
+		a.buffer = newSharedBuffer(q.MaxBufferedBytes)
+	}
+}
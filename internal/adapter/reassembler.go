@@ -2,45 +2,92 @@ package adapter
 
 import (
 	"container/heap"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/1ureka/roj1/internal/protocol"
 	"github.com/1ureka/roj1/internal/util"
 )
 
+// DefaultMaxSocketBytes is the default limit of one socket's reorder buffer.
+const DefaultMaxSocketBytes = 500 * 1024 * 1024
+
+// Reorder buffer limits of the low-power preset (-lowPower), for hosts with
+// a few hundred MiB of memory.
+const (
+	LowPowerMaxSocketBytes = 4 * 1024 * 1024
+	LowPowerMaxTotalBytes  = 32 * 1024 * 1024
+)
+
+// Reassembly bounds the memory of the reorder buffers, on either side. Zero
+// fields keep the defaults.
+//
+// Only out-of-order packets, buffered behind a gap, count against the limits.
+// Packets already in order wait only for the local connection to read them,
+// and would be delivered by waiting, so a slow reader does not trip a limit.
+type Reassembly struct {
+	// MaxSocketBytes caps one socket's reorder buffer; zero is
+	// DefaultMaxSocketBytes.
+	MaxSocketBytes int
+
+	// MaxTotalBytes caps the reorder buffers of all sockets combined; zero
+	// is unlimited.
+	MaxTotalBytes int64
+
+	// Close tears down a socket whose packet crosses a limit. Otherwise,
+	// with HostConfig.Nack, the socket recovers (see Socket.overflow): it
+	// evicts the packets furthest ahead to request them again later. Without
+	// retransmission nothing can be dropped, so the socket is torn down
+	// either way.
+	Close bool
+}
+
 // Reassembler reorders out-of-order packets within a single socketID stream.
 // Push and Drain are designed to run in separate goroutines:
-//   - Push: called from the inbox-consuming goroutine (fast, mutex-guarded heap insert)
-//   - Drain: called from the TCP-writing goroutine (pops consecutive in-order packets)
+//   - Push: called from the inbox-consuming goroutine (fast, mutex-guarded heap
+//     insert, moving packets now in order to the ready queue)
+//   - Drain: called from the TCP-writing goroutine (takes the ready queue)
 //
 // Ready() returns a channel that signals when drainable packets are available.
 type Reassembler struct {
 	mu            sync.Mutex
-	expectedSeq   uint32
-	buffer        packetHeap
-	bufferedBytes int
+	expectedSeq   uint32             // next sequence number to move to ready
+	buffer        packetHeap         // out-of-order packets, behind a gap
+	bufferedBytes int                // bytes in buffer, counted against the limits
+	ready         []*protocol.Packet // in-order packets not drained yet
+	readyBytes    int                // bytes in ready, not counted against the limits
 	notify        chan struct{}
+	limit         int           // per-socket byte limit (Reassembly.MaxSocketBytes)
+	shared        *sharedBuffer // peer-wide byte count (Quotas.MaxBufferedBytes), or nil
+	total         *sharedBuffer // byte count across sockets (Reassembly.MaxTotalBytes), or nil
+	released      bool          // bytes no longer counted in shared and total (see release)
+	progress      time.Time     // last delivery, or when the buffer stopped being empty (see backlog)
+	evicted       uint32        // highest SeqNum evicted and not received again, 0 if none (see evict)
 }
 
-// NewReassembler creates a reassembler expecting sequence numbers starting at 1.
+// NewReassembler creates a reassembler expecting sequence numbers starting at
+// 1, limited to DefaultMaxSocketBytes.
 func NewReassembler() *Reassembler {
 	return &Reassembler{
 		expectedSeq: 1,
 		notify:      make(chan struct{}, 1),
+		limit:       DefaultMaxSocketBytes,
 	}
 }
 
 // Ready returns a channel that receives a signal whenever one or more packets
-// become drainable (i.e. the next expected sequence number is at the front of
-// the buffer). The consumer should call Drain after receiving each signal.
+// become drainable (i.e. the next expected sequence number has arrived and
+// was moved to the ready queue). The consumer should call Drain after receiving each signal.
 func (r *Reassembler) Ready() <-chan struct{} {
 	return r.notify
 }
 
 // Push inserts a packet into the reorder buffer. It is goroutine-safe and
-// designed to be as fast as possible (single mutex-guarded heap push).
-// Returns true if the buffer has exceeded the size limit (caller should
-// treat this as a fatal condition and tear down the socket).
+// designed to be as fast as possible (a mutex-guarded heap push, and a pop for
+// each packet now in order). Returns true if the out-of-order packets have
+// exceeded their size limit, or one shared with other sockets (see
+// Socket.overflow for how the caller recovers).
 func (r *Reassembler) Push(pkt *protocol.Packet) bool {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -51,20 +98,43 @@ func (r *Reassembler) Push(pkt *protocol.Packet) bool {
 		return false
 	}
 
+	if r.buffer.Len() == 0 && len(r.ready) == 0 {
+		r.progress = time.Now()
+	}
+	size := bufferedSize(pkt)
 	heap.Push(&r.buffer, pkt)
-	r.bufferedBytes += len(pkt.Payload)
+	r.bufferedBytes += size
+	r.count(int64(size))
 
-	overflow := r.bufferedBytes > maxBufferedBytes
+	// Move the packets now in order to the ready queue. Duplicates (e.g.
+	// from a bonded transport) are discarded.
+	moved := false
+	for r.buffer.Len() > 0 && r.buffer[0].SeqNum <= r.expectedSeq {
+		popped := heap.Pop(&r.buffer).(*protocol.Packet)
+		size := bufferedSize(popped)
+		r.bufferedBytes -= size
+		r.count(-int64(size))
+		if popped.SeqNum < r.expectedSeq {
+			continue // duplicate of a packet already in order
+		}
+		r.ready = append(r.ready, popped)
+		r.readyBytes += size
+		r.expectedSeq++
+		moved = true
+	}
+	if r.evicted < r.expectedSeq {
+		r.evicted = 0
+	}
 
 	// Notify the drain side if consecutive packets are now available.
-	if r.buffer[0].SeqNum == r.expectedSeq {
+	if moved {
 		select {
 		case r.notify <- struct{}{}:
 		default: // already notified
 		}
 	}
 
-	return overflow
+	return r.over()
 }
 
 // Drain returns all consecutive in-order packets starting from the expected
@@ -74,16 +144,146 @@ func (r *Reassembler) Drain() []*protocol.Packet {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	var result []*protocol.Packet
-	for r.buffer.Len() > 0 && r.buffer[0].SeqNum == r.expectedSeq {
-		popped := heap.Pop(&r.buffer).(*protocol.Packet)
-		r.bufferedBytes -= len(popped.Payload)
-		result = append(result, popped)
-		r.expectedSeq++
+	result := r.ready
+	if result != nil {
+		r.progress = time.Now()
 	}
+	r.ready, r.readyBytes = nil, 0
 	return result
 }
 
+// backlog describes the packets waiting in a reorder buffer (see stalled).
+type backlog struct {
+	expected uint32    // next sequence number to deliver
+	first    uint32    // lowest buffered sequence number
+	packets  int       // packets buffered
+	bytes    int       // bytes buffered
+	progress time.Time // last delivery, or when the backlog started
+}
+
+// missing reports whether the backlog waits for a gap, i.e. packets
+// expected..first-1 have not arrived; otherwise it waits for the drain side.
+func (b backlog) missing() bool {
+	return b.first > b.expected
+}
+
+// backlog returns the buffered packets, in order or not, or false if there
+// are none. Evicted packets still missing count as a gap up to the highest of
+// them.
+func (r *Reassembler) backlog() (backlog, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.ready) > 0 {
+		return backlog{
+			expected: r.ready[0].SeqNum,
+			first:    r.ready[0].SeqNum,
+			packets:  len(r.ready) + r.buffer.Len(),
+			bytes:    r.readyBytes + r.bufferedBytes,
+			progress: r.progress,
+		}, true
+	}
+	if r.buffer.Len() == 0 {
+		if r.evicted == 0 {
+			return backlog{}, false
+		}
+		return backlog{expected: r.expectedSeq, first: r.evicted + 1, progress: r.progress}, true
+	}
+	return backlog{
+		expected: r.expectedSeq,
+		first:    r.buffer[0].SeqNum,
+		packets:  r.buffer.Len(),
+		bytes:    r.bufferedBytes,
+		progress: r.progress,
+	}, true
+}
+
+// buffered returns the bytes held in the reorder buffer, in order or not.
+func (r *Reassembler) buffered() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.readyBytes + r.bufferedBytes
+}
+
+// over reports whether the buffer is above its own limit or a shared one.
+// Must be called with r.mu held.
+func (r *Reassembler) over() bool {
+	if r.bufferedBytes > memoryCap(r.limit) {
+		return true
+	}
+	if r.released {
+		return false
+	}
+	return (r.shared != nil && r.shared.full()) || (r.total != nil && r.total.full())
+}
+
+// evict drops the packets furthest ahead until the buffer is within its
+// limits again, keeping at least the lowest one, and returns the number
+// dropped. They become a gap again once the packets before them are drained.
+//
+// The buffer is sorted first: a sorted slice is still a valid heap, and the
+// packets furthest ahead can then be cut off its end.
+func (r *Reassembler) evict() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sort.Sort(r.buffer)
+	n := 0
+	for r.buffer.Len() > 1 && (r.bufferedBytes > memoryCap(r.limit) || (r.total != nil && r.total.full())) {
+		pkt := r.buffer.Pop().(*protocol.Packet) // the last, not heap.Pop's lowest
+		r.evicted = max(r.evicted, pkt.SeqNum)
+		size := bufferedSize(pkt)
+		r.bufferedBytes -= size
+		r.count(-int64(size))
+		n++
+	}
+	return n
+}
+
+// lost records a packet dropped before it reached the buffer (see
+// adapter.deliver), so that it is requested again like an evicted one.
+func (r *Reassembler) lost(seq uint32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if seq >= r.expectedSeq {
+		r.evicted = max(r.evicted, seq)
+	}
+}
+
+// release returns the bytes still buffered to the shared counts and stops
+// counting further pushes against them. Called when the socket is cleaned up.
+func (r *Reassembler) release() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.count(-int64(r.bufferedBytes))
+	r.released = true
+}
+
+// count adjusts the shared counts by delta, unless released, and reports
+// whether one of them is now over its limit. Must be called with r.mu held.
+func (r *Reassembler) count(delta int64) bool {
+	if r.released {
+		return false
+	}
+	over := false
+	if r.shared != nil && r.shared.add(delta) {
+		over = true
+	}
+	if r.total != nil && r.total.add(delta) {
+		over = true
+	}
+	return over
+}
+
+// bufferedSize is what a buffered packet counts against the limits. The
+// header is included so that a flood of empty packets far ahead of
+// expectedSeq still hits the limit.
+func bufferedSize(pkt *protocol.Packet) int {
+	return protocol.HeaderSize + len(pkt.Payload)
+}
+
 // ---------------------------------------------------------------------------
 // packetHeap implements a min-heap sorted by SeqNum.
 // ---------------------------------------------------------------------------
@@ -0,0 +1,127 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// Retargeting: the client may ask the host to forward to another port of the
+// target's host at runtime (e.g. a dev server that restarted on a new port)
+// with a retarget message. HostConfig.AuthorizeRetarget decides; once granted,
+// new connections go to the new port, those already bridged are left alone,
+// and the host announces the changed service.
+
+// ErrRetargetDenied is returned by Handle.Retarget when the host refuses the
+// port change, wrapped with its reason.
+var ErrRetargetDenied = errors.New("port change denied by the host")
+
+// serveRetarget makes the host answer the client's retarget messages by
+// switching t, the main target, to the requested port. allowed reports
+// whether the peer may connect to the main target at all.
+func (a *adapter) serveRetarget(ctx context.Context, t *target, cfg HostConfig, allowed bool) {
+	a.ctl.handle(controlRetarget, func(msg *controlMessage) {
+		port := msg.Port
+		// Decided off the dispatch goroutine, as authorization may wait for
+		// the operator.
+		go func() {
+			err := a.authorizeRetarget(ctx, t, cfg, allowed, port)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				util.LogWarning("refused the peer's request to forward to port %d: %v", port, err)
+				a.ctl.send(&controlMessage{Kind: controlRetargeted, Port: port, Reason: err.Error()})
+				return
+			}
+
+			t.retarget(port)
+			util.LogSuccess("now forwarding new connections to %s, as the peer asked", t)
+			a.ctl.send(&controlMessage{Kind: controlRetargeted, Port: port})
+			a.mu.Lock()
+			a.service.Port = port
+			a.mu.Unlock()
+			a.announce()
+		}()
+	})
+}
+
+// authorizeRetarget returns why the peer may not switch the main target t to
+// port, or nil if it may.
+func (a *adapter) authorizeRetarget(ctx context.Context, t *target, cfg HostConfig, allowed bool, port int) error {
+	switch {
+	case port < 1 || port > 65535:
+		return fmt.Errorf("invalid port %d", port)
+	case port == t.port():
+		return nil
+	case cfg.AuthorizeRetarget == nil:
+		return errors.New("the host does not allow port changes")
+	case !allowed || !cfg.Policy.allows(port):
+		return fmt.Errorf("the peer may not connect to port %d", port)
+	}
+	return cfg.AuthorizeRetarget(ctx, port)
+}
+
+// awaitRetarget makes the client route the host's answer to a pending
+// Handle.Retarget.
+func (a *adapter) awaitRetarget() {
+	a.ctl.handle(controlRetargeted, func(msg *controlMessage) {
+		var err error
+		if msg.Reason != "" {
+			err = fmt.Errorf("%w: %s", ErrRetargetDenied, msg.Reason)
+		}
+		a.mu.Lock()
+		ch := a.retargeting
+		a.retargeting = nil
+		a.mu.Unlock()
+		if ch != nil {
+			ch <- err
+		}
+	})
+}
+
+// Retarget asks the host to forward new connections to port on its target's
+// host instead. It returns once the host agreed, ErrRetargetDenied if it
+// refuses, or ctx's error if it does not answer in time. Only a client
+// adapter can ask.
+func (h *Handle) Retarget(ctx context.Context, port int) error {
+	a := h.a
+	if a.announced == nil {
+		return errors.New("not a client adapter")
+	}
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("invalid port %d", port)
+	}
+
+	ch := make(chan error, 1)
+	a.mu.Lock()
+	if a.retargeting != nil {
+		a.mu.Unlock()
+		return errors.New("a port change is already pending")
+	}
+	a.retargeting = ch
+	a.mu.Unlock()
+
+	defer func() {
+		a.mu.Lock()
+		if a.retargeting == ch {
+			a.retargeting = nil
+		}
+		a.mu.Unlock()
+	}()
+
+	if !a.ctl.send(&controlMessage{Kind: controlRetarget, Port: port}) {
+		return errNoControl
+	}
+	select {
+	case err := <-ch:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-a.ctx.Done():
+		return net.ErrClosed
+	}
+}
@@ -0,0 +1,149 @@
+package adapter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/1ureka/roj1/internal/protocol"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// Retransmission (HostConfig.Nack): the DataChannel is reliable, but packets
+// still in flight on a path that dies (see transport.Failover and
+// transport.Bond) are lost, leaving a gap the reassembler waits on forever.
+// Each socket keeps its last sent packets, up to retransmitBytes; a receiver
+// whose reorder buffer has waited nackDelay on a gap sends a NACK for it, and
+// again every nackDelay while the gap persists, and the sender resends what
+// it still has. Packets that have been evicted cannot be recovered, and the
+// socket stalls as before (see stall.go).
+
+const (
+	retransmitBytes = 1024 * 1024            // per-socket retransmit buffer
+	nackDelay       = 500 * time.Millisecond // how long a gap may last before it is NACKed
+)
+
+// Nacker is an optional Transport extension for transports that can send
+// NACK packets. Without it, gaps are never requested.
+type Nacker interface {
+	SendNack(socketID, first, last uint32)
+}
+
+// retransmitBuffer holds a socket's most recently sent packets, oldest first.
+// A nil buffer keeps nothing.
+type retransmitBuffer struct {
+	mu      sync.Mutex
+	packets []*protocol.Packet
+	bytes   int
+}
+
+// keep records a sent packet, evicting the oldest ones beyond
+// retransmitBytes. payload must not be modified afterwards.
+func (b *retransmitBuffer) keep(typ uint8, seq uint32, payload []byte) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.packets = append(b.packets, &protocol.Packet{Type: typ, SeqNum: seq, Payload: payload})
+	b.bytes += bufferedSize(b.packets[len(b.packets)-1])
+	for b.bytes > retransmitBytes && len(b.packets) > 1 {
+		b.bytes -= bufferedSize(b.packets[0])
+		b.packets[0] = nil
+		b.packets = b.packets[1:]
+	}
+}
+
+// lookup returns the kept packets with SeqNums first..last.
+func (b *retransmitBuffer) lookup(first, last uint32) []*protocol.Packet {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var found []*protocol.Packet
+	for _, pkt := range b.packets {
+		if pkt.SeqNum >= first && pkt.SeqNum <= last {
+			found = append(found, pkt)
+		}
+	}
+	return found
+}
+
+// retransmit answers a NACK from the peer by resending the requested packets
+// of the socket that are still kept.
+func (a *adapter) retransmit(pkt *protocol.Packet) {
+	a.mu.Lock()
+	s := a.routes[pkt.SocketID]
+	a.mu.Unlock()
+
+	first, last := protocol.NackRange(pkt.Payload)
+	if s == nil || s.sent == nil {
+		util.LogDebug("[%08x] NACK for %d-%d with nothing kept, ignoring", pkt.SocketID, first, last)
+		return
+	}
+
+	found := s.sent.lookup(first, last)
+	for _, p := range found {
+		tracePacket(true, s.id, p.Type, p.SeqNum, len(p.Payload))
+		switch p.Type {
+		case protocol.TypeConnect:
+			s.tr.SendConnect(s.id, p.SeqNum)
+		case protocol.TypeData:
+			s.tr.SendData(s.id, p.SeqNum, p.Payload)
+		case protocol.TypeClose:
+			s.tr.SendClose(s.id, p.SeqNum)
+		}
+	}
+	util.Stats.AddRetransmitted(len(found))
+	if want := int(last-first) + 1; len(found) < want {
+		util.LogWarning("[%08x] peer asked for packets %d-%d again, but only %d of them are still kept",
+			s.id, first, last, len(found))
+		return
+	}
+	util.LogDebug("[%08x] retransmitted packets %d-%d", s.id, first, last)
+}
+
+// startNack enables retransmission if on, requesting gaps through tr if it
+// can send NACKs.
+func (a *adapter) startNack(ctx context.Context, tr Transport, on bool) {
+	if !on {
+		return
+	}
+	a.nack = true
+	if n, ok := tr.(Nacker); ok {
+		go a.watchGaps(ctx, n)
+	}
+}
+
+// watchGaps sends a NACK for every socket whose reorder buffer has waited
+// nackDelay on a gap, and again every nackDelay while it persists, until ctx
+// is done.
+func (a *adapter) watchGaps(ctx context.Context, tr Nacker) {
+	ticker := time.NewTicker(nackDelay / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.mu.Lock()
+			sockets := make([]*Socket, 0, len(a.routes))
+			for _, s := range a.routes {
+				sockets = append(sockets, s)
+			}
+			a.mu.Unlock()
+
+			for _, s := range sockets {
+				b, ok := s.reasm.backlog()
+				if !ok || !b.missing() || time.Since(b.progress) < nackDelay || time.Since(s.nacked) < nackDelay {
+					continue
+				}
+				s.nacked = time.Now()
+				util.LogDebug("[%08x] requesting missing packets %d-%d", s.id, b.expected, b.first-1)
+				tracePacket(true, s.id, protocol.TypeNack, 0, protocol.NackSize)
+				tr.SendNack(s.id, b.expected, b.first-1)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
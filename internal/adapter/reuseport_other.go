@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package adapter
+
+import (
+	"errors"
+	"syscall"
+)
+
+// setReusePort fails: this system has no SO_REUSEPORT.
+func setReusePort(_, _ string, _ syscall.RawConn) error {
+	return errors.New("SO_REUSEPORT is not supported on this system")
+}
@@ -0,0 +1,227 @@
+package adapter
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// maxHelloSize bounds the bytes buffered while waiting for a complete TLS
+// ClientHello (see sniConn).
+const maxHelloSize = 64 * 1024
+
+// errHelloRead aborts the handshake once the ClientHello has been parsed.
+var errHelloRead = errors.New("ClientHello read")
+
+// sniRouter picks the target of each connection by the server name (SNI) in
+// its TLS ClientHello, falling back to the main target for other names and
+// for connections that are not TLS.
+type sniRouter struct {
+	ctx      context.Context
+	routes   map[string]*target // lower-case server name → target
+	fallback *target
+	policy   Policy
+}
+
+// newSNIRouter creates the targets of cfg.SNIRoutes. The connections are
+// passed through as they are, so TargetTLS only applies to the fallback.
+func newSNIRouter(ctx context.Context, fallback *target, cfg HostConfig) *sniRouter {
+	r := &sniRouter{
+		ctx:      ctx,
+		routes:   make(map[string]*target, len(cfg.SNIRoutes)),
+		fallback: fallback,
+		policy:   cfg.Policy,
+	}
+	for name, addr := range cfg.SNIRoutes {
+		t := newTarget(ctx, addr, cfg.ResolveInterval)
+		t.retry, t.wake = cfg.DialRetry, cfg.Wake
+		r.routes[strings.ToLower(name)] = t
+	}
+	return r
+}
+
+// dial returns a connection that is routed once its ClientHello arrives.
+func (r *sniRouter) dial(ctx context.Context) (net.Conn, error) {
+	return &sniConn{ctx: ctx, r: r, ready: make(chan struct{}), closed: make(chan struct{})}, nil
+}
+
+// route returns the target for a server name ("" if none was sent).
+func (r *sniRouter) route(name string) (*target, error) {
+	t, ok := r.routes[strings.ToLower(name)]
+	if !ok {
+		t = r.fallback
+	}
+	if !r.policy.allows(t.port()) {
+		return nil, fmt.Errorf("the peer may not connect to %s", t)
+	}
+	util.LogDebug("routing server name %q to %s", name, t)
+	return t, nil
+}
+
+// sniConn is the connection handed to a host socket under SNI routing. It
+// buffers what the peer writes until the ClientHello is complete, then dials
+// the chosen target and forwards everything to it; Read waits until then.
+type sniConn struct {
+	ctx context.Context
+	r   *sniRouter
+
+	mu   sync.Mutex // held by Write while routing
+	buf  []byte
+	conn net.Conn // set once routed, before ready is closed
+
+	ready     chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *sniConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != nil {
+		return c.conn.Write(b)
+	}
+
+	c.buf = append(c.buf, b...)
+	name, complete := clientHelloSNI(c.buf)
+	if !complete && len(c.buf) < maxHelloSize {
+		return len(b), nil
+	}
+
+	t, err := c.r.route(name)
+	if err != nil {
+		return 0, err
+	}
+	conn, err := t.dial(c.ctx)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := conn.Write(c.buf); err != nil {
+		conn.Close()
+		return 0, err
+	}
+
+	select {
+	case <-c.closed:
+		conn.Close()
+		return 0, net.ErrClosed
+	default:
+	}
+	c.conn, c.buf = conn, nil
+	close(c.ready)
+	return len(b), nil
+}
+
+func (c *sniConn) Read(b []byte) (int, error) {
+	select {
+	case <-c.ready:
+		return c.conn.Read(b)
+	case <-c.closed:
+		return 0, net.ErrClosed
+	}
+}
+
+func (c *sniConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	select {
+	case <-c.ready:
+		return c.conn.Close()
+	default:
+		return nil
+	}
+}
+
+// target returns the routed connection, or nil before routing.
+func (c *sniConn) target() net.Conn {
+	select {
+	case <-c.ready:
+		return c.conn
+	default:
+		return nil
+	}
+}
+
+func (c *sniConn) LocalAddr() net.Addr {
+	if conn := c.target(); conn != nil {
+		return conn.LocalAddr()
+	}
+	return pendingAddr{}
+}
+
+func (c *sniConn) RemoteAddr() net.Addr {
+	if conn := c.target(); conn != nil {
+		return conn.RemoteAddr()
+	}
+	return pendingAddr{}
+}
+
+// Deadlines are not used by sockets; they only apply once routed.
+func (c *sniConn) SetDeadline(t time.Time) error { return c.setDeadline(t, net.Conn.SetDeadline) }
+func (c *sniConn) SetReadDeadline(t time.Time) error {
+	return c.setDeadline(t, net.Conn.SetReadDeadline)
+}
+func (c *sniConn) SetWriteDeadline(t time.Time) error {
+	return c.setDeadline(t, net.Conn.SetWriteDeadline)
+}
+
+func (c *sniConn) setDeadline(t time.Time, set func(net.Conn, time.Time) error) error {
+	if conn := c.target(); conn != nil {
+		return set(conn, t)
+	}
+	return nil
+}
+
+// pendingAddr is the address of an sniConn that is not routed yet.
+type pendingAddr struct{}
+
+func (pendingAddr) Network() string { return "tcp" }
+func (pendingAddr) String() string  { return "(routed by SNI)" }
+
+// clientHelloSNI parses data as the start of a TLS connection. complete is
+// false while the ClientHello is still incomplete; once complete, name is its
+// server name ("" if it has none, or if data is not TLS at all).
+func clientHelloSNI(data []byte) (name string, complete bool) {
+	r := &helloReader{data: data}
+	got := false
+	tls.Server(r, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			name, got = hello.ServerName, true
+			return nil, errHelloRead
+		},
+	}).Handshake()
+
+	return name, got || !r.exhausted
+}
+
+// helloReader feeds buffered bytes to a tls.Server handshake and records
+// whether it ran out of them.
+type helloReader struct {
+	data      []byte
+	exhausted bool
+}
+
+func (r *helloReader) Read(b []byte) (int, error) {
+	if len(r.data) == 0 {
+		r.exhausted = true
+		return 0, io.EOF
+	}
+	n := copy(b, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func (r *helloReader) Write(b []byte) (int, error)      { return len(b), nil }
+func (r *helloReader) Close() error                     { return nil }
+func (r *helloReader) LocalAddr() net.Addr              { return pendingAddr{} }
+func (r *helloReader) RemoteAddr() net.Addr             { return pendingAddr{} }
+func (r *helloReader) SetDeadline(time.Time) error      { return nil }
+func (r *helloReader) SetReadDeadline(time.Time) error  { return nil }
+func (r *helloReader) SetWriteDeadline(time.Time) error { return nil }
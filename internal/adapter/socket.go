@@ -6,6 +6,8 @@ import (
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/1ureka/roj1/internal/protocol"
 	"github.com/1ureka/roj1/internal/util"
@@ -13,8 +15,7 @@ import (
 
 // Tuning constants.
 const (
-	maxPayloadSize   = 16 * 1024         // 16 KB per DATA packet payload
-	maxBufferedBytes = 500 * 1024 * 1024 // per-socketID reassembler buffer limit (to prevent OOM)
+	maxPayloadSize = protocol.MaxPayloadSize // 16 KB per DATA packet payload
 )
 
 // Socket holds the complete lifecycle state for one socketID.
@@ -24,7 +25,8 @@ const (
 //   - inbox is a buffered channel (dispatch → pushLoop)
 //   - Reassembler is mutex-protected (pushLoop ↔ writeOrConnLoop/writeLoop)
 //   - SeqGen uses atomic operations
-//   - tcpConn is set before readLoop is launched (happens-before)
+//   - tcpConn is set before readLoop is launched (happens-before); on the
+//     host it is published under connMu, since cleanup may run meanwhile
 //   - cleanup is guarded by sync.Once
 type Socket struct {
 	// Identity
@@ -34,31 +36,57 @@ type Socket struct {
 	ctx       context.Context
 	cancel    context.CancelFunc
 	closeOnce sync.Once
+	closed    chan struct{} // closed once cleanup has completed
+	closing   atomic.Int64  // UnixNano when cleanup started, 0 before (see watchLeaks)
 
 	// Communication
 	inbox chan *protocol.Packet
 	tr    Transport // shared, thread-safe sender
 
+	// Client only: closed once the host answers CONNECT (see runAsClient).
+	answered     chan struct{}
+	answeredOnce sync.Once
+	replies      *atomic.Bool // client: shared, set once the host answers any CONNECT (nil = assume it does)
+
 	// Per-socket local tools
 	seq   *SeqGen
 	reasm *Reassembler
+	sent  *retransmitBuffer // recently sent packets, for NACKs (nil = none)
+
+	reasmClose bool // tear down instead of recovering from a full reorder buffer (Reassembly.Close)
 
 	// TCP side
-	tcpConn net.Conn
+	tcpConn  net.Conn
+	connMu   sync.Mutex     // host: guards setting tcpConn against cleanup
+	outbound *rateLimiter   // host: shared cap on bytes read from TCP (nil = none)
+	transfer *transferMeter // shared transfer quota (nil = none)
+	mirror   *mirrorTap     // host: copy of the bridged bytes (nil = none)
+
+	stallReported time.Time // progress of the last stall reported (see checkStall)
+	nacked        time.Time // when a gap was last NACKed (see watchGaps)
+
+	// Traffic counters (payload bytes), reported on close.
+	bytesIn  atomic.Int64 // tunnel → TCP
+	bytesOut atomic.Int64 // TCP → tunnel
+	active   atomic.Int64 // UnixNano of the last payload moved, or of creation (see Handle.Sockets)
 }
 
 // newSocket creates a Socket without a TCP connection (used by host mode).
 func newSocket(parentCtx context.Context, id uint32, tr Transport) *Socket {
 	ctx, cancel := context.WithCancel(parentCtx)
-	return &Socket{
-		id:     id,
-		ctx:    ctx,
-		cancel: cancel,
-		inbox:  make(chan *protocol.Packet, 1024), // pushLoop must never block, 1024 is for -race testing
-		tr:     tr,
-		seq:    NewSeqGen(),
-		reasm:  NewReassembler(),
+	s := &Socket{
+		id:       id,
+		ctx:      ctx,
+		cancel:   cancel,
+		closed:   make(chan struct{}),
+		answered: make(chan struct{}),
+		inbox:    make(chan *protocol.Packet, 1024), // deliver never waits for room (see adapter.deliver), 1024 is for -race testing
+		tr:       tr,
+		seq:      NewSeqGen(),
+		reasm:    NewReassembler(),
 	}
+	s.active.Store(time.Now().UnixNano())
+	return s
 }
 
 // newSocketWithConn creates a Socket with an already-established TCP connection
@@ -74,32 +102,50 @@ func newSocketWithConn(parentCtx context.Context, id uint32, tr Transport, conn
 // ---------------------------------------------------------------------------
 
 // runAsHost is the complete lifecycle for a host-side socketID.
-// It launches pushLoop (inbox → Reassembler) and writeOrConnLoop
-// (Reassembler → TCP dial + write) as dedicated goroutines, then blocks
-// until the context is cancelled (triggered by any goroutine calling cleanup).
-func (s *Socket) runAsHost(targetAddr string) {
-	defer s.cleanup()
-
-	go s.pushLoop()
-	go s.writeOrConnLoop(targetAddr)
-
-	<-s.ctx.Done()
+// It launches writeOrConnLoop (Reassembler → TCP dial + write) as a dedicated
+// goroutine and runs pushLoop (inbox → Reassembler) itself, so it returns
+// once the socket is cleaned up (by any goroutine calling cleanup).
+// dial opens the connection on CONNECT: normally target.dial, or a pipe into
+// the stream multiplexer for muxSocketID (see serveMux).
+func (s *Socket) runAsHost(dial func(context.Context) (net.Conn, error), tcp TCPOptions) {
+	go s.writeOrConnLoop(dial, tcp)
+	s.pushLoop()
 }
 
 // runAsClient is the complete lifecycle for a client-side socketID.
 // Already holds a TCP connection from accept; sends CONNECT immediately,
-// then launches pushLoop, writeLoop, and readLoop as dedicated goroutines.
-// Blocks until the context is cancelled.
-func (s *Socket) runAsClient() {
-	defer s.cleanup()
+// then launches writeLoop and readLoop as dedicated goroutines and runs
+// pushLoop itself. If the host has not answered the CONNECT within
+// connectTimeout (0 = no limit), the socket is cleaned up, which closes the
+// TCP connection and sends CLOSE, unless the host has never answered one:
+// it may predate CONNECT replies. Returns once the socket is cleaned up.
+func (s *Socket) runAsClient(connectTimeout time.Duration) {
+	seq := s.seq.Next()
+	tracePacket(true, s.id, protocol.TypeConnect, seq, 0)
+	s.sent.keep(protocol.TypeConnect, seq, nil)
+	s.tr.SendConnect(s.id, seq)
 
-	s.tr.SendConnect(s.id, s.seq.Next())
-
-	go s.pushLoop()
 	go s.writeLoop()
 	go s.readLoop()
 
-	<-s.ctx.Done()
+	if connectTimeout > 0 {
+		timer := time.AfterFunc(connectTimeout, func() {
+			select {
+			case <-s.answered:
+			case <-s.ctx.Done():
+			default:
+				if s.replies != nil && !s.replies.Load() {
+					util.LogDebug("[%08x] host did not answer CONNECT within %v, but never has; keeping", s.id, connectTimeout)
+					return
+				}
+				util.LogWarning("[%08x] host did not answer CONNECT within %v, closing", s.id, connectTimeout)
+				s.cleanup()
+			}
+		})
+		defer timer.Stop()
+	}
+
+	s.pushLoop()
 }
 
 // ---------------------------------------------------------------------------
@@ -109,8 +155,9 @@ func (s *Socket) runAsClient() {
 // writeOrConnLoop is the host-side drain loop. It waits for Reassembler
 // notifications, drains consecutive packets, and handles CONNECT (dial TCP),
 // DATA (write to TCP), and CLOSE (shut down). On receiving CONNECT it starts
-// readLoop for the reverse direction.
-func (s *Socket) writeOrConnLoop(targetAddr string) {
+// readLoop for the reverse direction. A duplicate CONNECT is ignored; DATA
+// before any CONNECT means the stream is broken, so the socket is closed.
+func (s *Socket) writeOrConnLoop(dial func(context.Context) (net.Conn, error), tcp TCPOptions) {
 	defer s.cleanup()
 
 	connected := false
@@ -122,26 +169,43 @@ func (s *Socket) writeOrConnLoop(targetAddr string) {
 				switch d.Type {
 				case protocol.TypeConnect:
 					if connected {
+						util.LogDebug("[%08x] duplicate CONNECT, ignoring", s.id)
 						continue
 					}
-					conn, err := net.Dial("tcp", targetAddr)
+					conn, err := dial(s.ctx)
 					if err != nil {
 						util.LogWarning("[%08x] TCP dial failed: %v", s.id, err)
 						return
 					}
-					s.tcpConn = conn
+					tcp.apply(s.id, conn)
+					if !s.setConn(conn) {
+						return
+					}
 					connected = true
-					util.LogDebug("[%08x] TCP connected to %s", s.id, targetAddr)
+					util.LogDebug("[%08x] TCP connected to %s", s.id, conn.RemoteAddr())
+
+					// Answer the CONNECT so the client knows the target was
+					// reached (see runAsClient).
+					seq := s.seq.Next()
+					tracePacket(true, s.id, protocol.TypeConnect, seq, 0)
+					s.sent.keep(protocol.TypeConnect, seq, nil)
+					s.tr.SendConnect(s.id, seq)
 					go s.readLoop()
 
 				case protocol.TypeData:
 					if !connected {
-						continue
+						util.LogWarning("[%08x] DATA before CONNECT, closing", s.id)
+						return
+					}
+					if s.mirror != nil {
+						s.mirror.write(true, d.Payload)
 					}
 					if _, err := s.tcpConn.Write(d.Payload); err != nil {
 						util.LogWarning("[%08x] TCP write error: %v", s.id, err)
 						return
 					}
+					s.bytesIn.Add(int64(len(d.Payload)))
+					s.active.Store(time.Now().UnixNano())
 
 				case protocol.TypeClose:
 					util.LogDebug("[%08x] received CLOSE", s.id)
@@ -166,11 +230,19 @@ func (s *Socket) writeLoop() {
 		case <-s.reasm.Ready():
 			for _, d := range s.reasm.Drain() {
 				switch d.Type {
+				case protocol.TypeConnect:
+					if s.replies != nil {
+						s.replies.Store(true)
+					}
+					s.markAnswered()
 				case protocol.TypeData:
+					s.markAnswered()
 					if _, err := s.tcpConn.Write(d.Payload); err != nil {
 						util.LogWarning("[%08x] TCP write error: %v", s.id, err)
 						return
 					}
+					s.bytesIn.Add(int64(len(d.Payload)))
+					s.active.Store(time.Now().UnixNano())
 				case protocol.TypeClose:
 					util.LogDebug("[%08x] received CLOSE", s.id)
 					return
@@ -194,9 +266,16 @@ func (s *Socket) pushLoop() {
 		select {
 		case pkt := <-s.inbox:
 			if s.reasm.Push(pkt) {
-				util.LogWarning("[%08x] reassembler buffer exceeded %d MiB, treating as disconnection",
-					s.id, maxBufferedBytes/(1024*1024))
-				return
+				if b := s.reasm.shared; b != nil && b.full() {
+					util.Stats.AddRejected()
+					util.LogWarning("[%08x] peer reassembler buffers exceeded the %d-byte quota, closing socket",
+						s.id, b.limit.Load())
+					return
+				}
+				if !s.overflow() {
+					util.LogWarning("[%08x] reassembler buffer exceeded its limit, treating as disconnection", s.id)
+					return
+				}
 			}
 		case <-s.ctx.Done():
 			return
@@ -204,20 +283,66 @@ func (s *Socket) pushLoop() {
 	}
 }
 
+// overflow recovers from a reorder buffer over its limit (see Reassembly)
+// and reports whether it did; if not, the socket must be torn down. Only
+// packets behind a gap count against the limits, and the missing packets
+// arrive through the same transport, so waiting would not help: pushLoop must
+// keep emptying the inbox. With retransmission the newest packets are
+// evicted, to be NACKed once the packets before them are drained; without it
+// they cannot be dropped. Packets in order that wait for a slow local reader
+// never overflow.
+func (s *Socket) overflow() bool {
+	if s.reasmClose || s.sent == nil {
+		return false
+	}
+	n := s.reasm.evict()
+	util.LogDebug("[%08x] reassembler buffer full, evicted %d packets to request again", s.id, n)
+	return true
+}
+
 // readLoop reads from the TCP connection and sends DATA packets through the
 // DataChannel. It uses a blocking Read; cleanup() closes the TCP connection
-// to unblock it.
+// to unblock it. Reading pauses while the transport is congested (Writable).
 func (s *Socket) readLoop() {
 	defer s.cleanup()
 
+	writable, _ := s.tr.(Writable)
+
 	buf := make([]byte, maxPayloadSize)
 	for {
+		if writable != nil {
+			if err := writable.WaitWritable(s.ctx, s.id); err != nil {
+				return
+			}
+		}
+
 		n, err := s.tcpConn.Read(buf)
 
+		if n > 0 && s.outbound != nil {
+			d, ok := s.outbound.wait(s.ctx, n)
+			if !ok {
+				return
+			}
+			if d > 0 {
+				util.Stats.AddThrottled(d)
+			}
+		}
+		if n > 0 && s.transfer != nil && !s.transfer.add(s.ctx, n) {
+			return
+		}
+
 		if n > 0 {
 			payload := make([]byte, n)
 			copy(payload, buf[:n])
-			s.tr.SendData(s.id, s.seq.Next(), payload)
+			if s.mirror != nil {
+				s.mirror.write(false, payload)
+			}
+			seq := s.seq.Next()
+			tracePacket(true, s.id, protocol.TypeData, seq, n)
+			s.sent.keep(protocol.TypeData, seq, payload)
+			s.tr.SendData(s.id, seq, payload)
+			s.bytesOut.Add(int64(n))
+			s.active.Store(time.Now().UnixNano())
 		}
 
 		if err == nil {
@@ -240,20 +365,50 @@ func (s *Socket) readLoop() {
 	}
 }
 
+// markAnswered records that the host has answered this socket's CONNECT.
+func (s *Socket) markAnswered() {
+	s.answeredOnce.Do(func() { close(s.answered) })
+}
+
 // ---------------------------------------------------------------------------
 // Cleanup
 // ---------------------------------------------------------------------------
 
+// setConn publishes the host's dialed connection for cleanup to close. If the
+// socket was cleaned up during the dial, it closes conn instead and returns
+// false.
+func (s *Socket) setConn(conn net.Conn) bool {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	if s.ctx.Err() != nil {
+		conn.Close()
+		return false
+	}
+	s.tcpConn = conn
+	return true
+}
+
 // cleanup consolidates all shutdown actions behind sync.Once so that
 // regardless of which goroutine exits first, resources are released
 // exactly once and the peer is notified with a single CLOSE packet.
 func (s *Socket) cleanup() {
 	s.closeOnce.Do(func() {
+		s.closing.Store(time.Now().UnixNano())
 		s.cancel()
+		s.connMu.Lock()
 		if s.tcpConn != nil {
 			s.tcpConn.Close()
 		}
-		s.tr.SendClose(s.id, s.seq.Next())
+		s.connMu.Unlock()
+		s.reasm.release()
+		if s.mirror != nil {
+			s.mirror.close()
+		}
+		seq := s.seq.Next()
+		tracePacket(true, s.id, protocol.TypeClose, seq, 0)
+		s.sent.keep(protocol.TypeClose, seq, nil)
+		s.tr.SendClose(s.id, seq)
 		util.LogDebug("[%08x] socket cleanup complete", s.id)
+		close(s.closed)
 	})
 }
@@ -0,0 +1,74 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// DefaultStallTimeout is how long a socket's data may wait undelivered before
+// it is reported as stalled (see HostConfig.StallTimeout).
+const DefaultStallTimeout = 30 * time.Second
+
+// watchStalls reports, once per stall, every socket whose reorder buffer has
+// held packets for longer than after without delivering any, until ctx is
+// done. The report says whether the socket waits for missing sequence numbers
+// (lost on the way in) or for its local connection to read (see stalled).
+func (a *adapter) watchStalls(ctx context.Context, after time.Duration) {
+	ticker := time.NewTicker(after / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.mu.Lock()
+			sockets := make([]*Socket, 0, len(a.routes))
+			for _, s := range a.routes {
+				sockets = append(sockets, s)
+			}
+			a.mu.Unlock()
+
+			for _, s := range sockets {
+				s.checkStall(after)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// checkStall reports the socket if it has stalled for longer than after and
+// was not already reported for the same stall. Only called from watchStalls.
+func (s *Socket) checkStall(after time.Duration) {
+	b, ok := s.reasm.backlog()
+	if !ok || s.ctx.Err() != nil {
+		return
+	}
+	idle := time.Since(b.progress)
+	if idle < after || b.progress.Equal(s.stallReported) {
+		return
+	}
+	s.stallReported = b.progress
+	stalled(s.id, b, idle.Round(time.Second))
+}
+
+// stalled logs and emits a socket_stalled event for the socket's backlog.
+func stalled(id uint32, b backlog, idle time.Duration) {
+	ev := util.Event{
+		Event:    util.EventSocketStalled,
+		Socket:   fmt.Sprintf("%08x", id),
+		Buffered: b.bytes,
+		Idle:     idle.String(),
+	}
+	if b.missing() {
+		ev.Missing = fmt.Sprintf("%d-%d", b.expected, b.first-1)
+		util.LogWarning("[%08x] socket stalled for %v: waiting for missing packets %s, %d packets (%s) buffered behind them",
+			id, idle, ev.Missing, b.packets, util.FormatBytes(float64(b.bytes)))
+	} else {
+		util.LogWarning("[%08x] socket stalled for %v: %d packets (%s) waiting for the local connection to read",
+			id, idle, b.packets, util.FormatBytes(float64(b.bytes)))
+	}
+	util.EmitEvent(ev)
+}
@@ -0,0 +1,218 @@
+package adapter
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// target dials the host's target service (private). A hostname is resolved
+// at dial time by default; with a re-resolution interval it is resolved in
+// the background instead, and connections try the cached addresses in order,
+// so a DNS-based failover is picked up within one interval without adding a
+// lookup to every connection.
+type target struct {
+	retry time.Duration // keep redialing a target that is down for this long (see dial)
+	wake  func()        // called when a dial fails and will be retried (nil = none)
+	tls   *tls.Config   // wrap connections in TLS towards the target (nil = plain TCP)
+
+	mu     sync.Mutex
+	addr   string   // as given, e.g. "db.internal:5432", with the port of the last retarget
+	cached []string // resolved host:port addresses; nil = resolve at dial time
+}
+
+// newTarget creates a target for addr. If interval is positive and addr names
+// a host (not an IP literal), the name is re-resolved every interval until
+// ctx is done.
+func newTarget(ctx context.Context, addr string, interval time.Duration) *target {
+	t := &target{addr: addr}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || interval <= 0 || net.ParseIP(host) != nil {
+		return t
+	}
+
+	t.resolve(ctx, host)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				t.resolve(ctx, host)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return t
+}
+
+// resolve looks host up and updates the cache. On failure the previous
+// addresses are kept.
+func (t *target) resolve(ctx context.Context, host string) {
+	ips, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		if ctx.Err() == nil {
+			util.LogWarning("failed to resolve target %s: %v", host, err)
+		}
+		return
+	}
+
+	t.mu.Lock()
+	_, port, _ := net.SplitHostPort(t.addr)
+	addrs := make([]string, len(ips))
+	for i, ip := range ips {
+		addrs[i] = net.JoinHostPort(ip, port)
+	}
+	changed := t.cached != nil && !slices.Equal(t.cached, addrs)
+	t.cached = addrs
+	t.mu.Unlock()
+
+	if changed {
+		util.LogInfo("target %s now resolves to %v", host, ips)
+	} else {
+		util.LogDebug("target %s resolves to %v", host, ips)
+	}
+}
+
+// Backoff between dial attempts to a target that is down.
+const (
+	dialBackoff    = 100 * time.Millisecond
+	maxDialBackoff = 2 * time.Second
+)
+
+// ErrTargetUnreachable is wrapped when the host cannot connect to its target
+// service, e.g. as nothing listens on the target port.
+var ErrTargetUnreachable = errors.New("target unreachable")
+
+// dial connects to the target (see dialRetry), completing a TLS handshake
+// first if the target speaks TLS. Failures to connect wrap
+// ErrTargetUnreachable, unless ctx ended first.
+func (t *target) dial(ctx context.Context) (net.Conn, error) {
+	conn, err := t.dialRetry(ctx)
+	if err != nil && ctx.Err() == nil {
+		return nil, fmt.Errorf("%w: %w", ErrTargetUnreachable, err)
+	}
+	if err != nil || t.tls == nil {
+		return conn, err
+	}
+
+	tc := tls.Client(conn, t.tls)
+	if err := tc.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake with %s: %w", t, err)
+	}
+	return tc, nil
+}
+
+// targetTLS returns cfg with ServerName defaulting to the host of addr, or
+// nil if cfg is nil.
+func targetTLS(cfg *tls.Config, addr string) *tls.Config {
+	if cfg == nil || cfg.ServerName != "" {
+		return cfg
+	}
+	cfg = cfg.Clone()
+	cfg.ServerName, _, _ = net.SplitHostPort(addr)
+	return cfg
+}
+
+// dialRetry connects to the target (see dialOnce). If that fails and retry is
+// set, the target is woken and redialed with exponential backoff until it
+// answers or retry has elapsed, for targets that start on demand.
+func (t *target) dialRetry(ctx context.Context) (net.Conn, error) {
+	conn, err := t.dialOnce(ctx)
+	if err == nil || t.retry <= 0 {
+		return conn, err
+	}
+
+	util.LogDebug("target %s is not up (%v), retrying for up to %v", t, err, t.retry)
+	if t.wake != nil {
+		t.wake()
+	}
+
+	deadline := time.Now().Add(t.retry)
+	backoff := dialBackoff
+	for {
+		wait := min(backoff, time.Until(deadline))
+		if wait <= 0 {
+			return nil, err
+		}
+		if !sleepCtx(ctx, wait) {
+			return nil, ctx.Err()
+		}
+		if conn, err = t.dialOnce(ctx); err == nil {
+			return conn, nil
+		}
+		backoff = min(2*backoff, maxDialBackoff)
+	}
+}
+
+// dialOnce connects to the target, trying each cached address in order (or
+// letting the dialer resolve the name if nothing is cached).
+func (t *target) dialOnce(ctx context.Context) (net.Conn, error) {
+	t.mu.Lock()
+	addr, addrs := t.addr, t.cached
+	t.mu.Unlock()
+
+	var d net.Dialer
+	if len(addrs) == 0 {
+		return d.DialContext(ctx, "tcp", addr)
+	}
+
+	var errs []error
+	for _, addr := range addrs {
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// port returns the target's port, or 0 if addr has none.
+func (t *target) port() int {
+	_, port, _ := net.SplitHostPort(t.String())
+	n, _ := strconv.Atoi(port)
+	return n
+}
+
+// retarget makes new connections go to port on the same host. Connections
+// already made are left alone.
+func (t *target) retarget(port int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	host, _, _ := net.SplitHostPort(t.addr)
+	t.addr = net.JoinHostPort(host, strconv.Itoa(port))
+	if t.cached == nil {
+		return
+	}
+	cached := make([]string, len(t.cached)) // dialOnce may be reading the old slice
+	for i, addr := range t.cached {
+		ip, _, _ := net.SplitHostPort(addr)
+		cached[i] = net.JoinHostPort(ip, strconv.Itoa(port))
+	}
+	t.cached = cached
+}
+
+// String returns the target address as given, with the port of the last
+// retarget.
+func (t *target) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.addr
+}
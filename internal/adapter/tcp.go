@@ -0,0 +1,55 @@
+package adapter
+
+import (
+	"net"
+	"time"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// TCPOptions tunes the bridged TCP connections: the host's connections to the
+// target and the client's accepted local connections. The zero value keeps
+// Go's defaults (TCP_NODELAY on, 15s keepalive, OS buffer sizes), which suit
+// interactive traffic but not every workload.
+type TCPOptions struct {
+	Nagle       bool          // enable Nagle's algorithm (clear TCP_NODELAY)
+	KeepAlive   time.Duration // keepalive probe interval; 0 = Go default, negative = disabled
+	ReadBuffer  int           // SO_RCVBUF in bytes; 0 = OS default
+	WriteBuffer int           // SO_SNDBUF in bytes; 0 = OS default
+}
+
+// apply sets the options on conn, or on the connection under a TLS one.
+// Failures are logged and otherwise ignored, since the connection still works
+// with the defaults.
+func (o TCPOptions) apply(id uint32, conn net.Conn) {
+	if wrapped, ok := conn.(interface{ NetConn() net.Conn }); ok {
+		conn = wrapped.NetConn()
+	}
+	tc, ok := conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+
+	var errs []error
+	if o.Nagle {
+		errs = append(errs, tc.SetNoDelay(false))
+	}
+	switch {
+	case o.KeepAlive < 0:
+		errs = append(errs, tc.SetKeepAlive(false))
+	case o.KeepAlive > 0:
+		errs = append(errs, tc.SetKeepAlive(true), tc.SetKeepAlivePeriod(o.KeepAlive))
+	}
+	if o.ReadBuffer > 0 {
+		errs = append(errs, tc.SetReadBuffer(o.ReadBuffer))
+	}
+	if o.WriteBuffer > 0 {
+		errs = append(errs, tc.SetWriteBuffer(o.WriteBuffer))
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			util.LogWarning("[%08x] failed to set TCP option: %v", id, err)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package adapter
+
+import "time"
+
+// Tombstone limits. A closed socketID is remembered for tombstoneTTL, long
+// enough for any packets still in flight from the peer to arrive, and at most
+// maxTombstones are kept.
+const (
+	tombstoneTTL  = time.Minute
+	maxTombstones = 1 << 16
+)
+
+// tombstone records when a socketID was closed.
+type tombstone struct {
+	id uint32
+	at time.Time
+}
+
+// tombstones remembers recently closed socketIDs, so that late packets for
+// them are dropped instead of opening a new socket that would wait forever
+// for SeqNums the peer already sent. Client socketIDs are never reused within
+// 2^32 connections, so a tombstoned ID cannot belong to a new connection.
+// Not safe for concurrent use; the adapter guards it with a.mu.
+type tombstones struct {
+	at    map[uint32]time.Time
+	order []tombstone // oldest first
+}
+
+// bury records that id was closed now.
+func (t *tombstones) bury(id uint32) {
+	now := time.Now()
+	if t.at == nil {
+		t.at = make(map[uint32]time.Time)
+	}
+	t.at[id] = now
+	t.order = append(t.order, tombstone{id, now})
+	t.prune(now)
+}
+
+// buried reports whether id was closed within tombstoneTTL.
+func (t *tombstones) buried(id uint32) bool {
+	at, ok := t.at[id]
+	return ok && time.Since(at) < tombstoneTTL
+}
+
+// prune forgets tombstones older than tombstoneTTL, and the oldest ones
+// beyond maxTombstones.
+func (t *tombstones) prune(now time.Time) {
+	i := 0
+	for ; i < len(t.order); i++ {
+		old := t.order[i]
+		if len(t.order)-i <= maxTombstones && now.Sub(old.at) < tombstoneTTL {
+			break
+		}
+		if t.at[old.id] == old.at { // not buried again since
+			delete(t.at, old.id)
+		}
+	}
+	t.order = t.order[i:] // append reallocates, dropping the pruned prefix
+}
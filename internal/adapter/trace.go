@@ -0,0 +1,119 @@
+package adapter
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/1ureka/roj1/internal/protocol"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// TraceSize is the number of packets kept by the trace ring buffer.
+const TraceSize = 4096
+
+// TraceEntry is one packet recorded by EnableTrace.
+type TraceEntry struct {
+	Time     time.Time
+	Out      bool // sent to the peer (false: received from it)
+	SocketID uint32
+	Type     uint8
+	SeqNum   uint32
+	Size     int // payload bytes
+}
+
+// String formats the entry like "15:04:05.000000 [0000abcd] → DATA seq=3 size=16384".
+func (e TraceEntry) String() string {
+	dir := "←"
+	if e.Out {
+		dir = "→"
+	}
+	return fmt.Sprintf("%s [%08x] %s %s seq=%d size=%d",
+		e.Time.Format("15:04:05.000000"), e.SocketID, dir, typeName(e.Type), e.SeqNum, e.Size)
+}
+
+// typeName returns the name of a packet type.
+func typeName(t uint8) string {
+	switch t {
+	case protocol.TypeConnect:
+		return "CONNECT"
+	case protocol.TypeData:
+		return "DATA"
+	case protocol.TypeClose:
+		return "CLOSE"
+	case protocol.TypeNack:
+		return "NACK"
+	case protocol.TypeControl:
+		return "CONTROL"
+	}
+	return fmt.Sprintf("0x%02x", t)
+}
+
+// tracer is the process-wide packet trace (see EnableTrace).
+var tracer struct {
+	enabled atomic.Bool
+
+	mu   sync.Mutex
+	all  bool
+	id   uint32
+	ring []TraceEntry
+	next int // index of the oldest entry once ring is full
+}
+
+// EnableTrace records every packet of the socket with the given ID, or of all
+// sockets if all is set, in both directions: each is logged at debug level
+// and kept in a ring buffer of the last TraceSize packets (see Trace).
+func EnableTrace(socketID uint32, all bool) {
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+
+	tracer.all, tracer.id = all, socketID
+	tracer.ring = make([]TraceEntry, 0, TraceSize)
+	tracer.next = 0
+	tracer.enabled.Store(true)
+}
+
+// tracePacket records a packet if its socket is traced.
+func tracePacket(out bool, socketID uint32, typ uint8, seq uint32, size int) {
+	if !tracer.enabled.Load() {
+		return
+	}
+
+	tracer.mu.Lock()
+	if !tracer.all && socketID != tracer.id {
+		tracer.mu.Unlock()
+		return
+	}
+	e := TraceEntry{Time: time.Now(), Out: out, SocketID: socketID, Type: typ, SeqNum: seq, Size: size}
+	if len(tracer.ring) < TraceSize {
+		tracer.ring = append(tracer.ring, e)
+	} else {
+		tracer.ring[tracer.next] = e
+		tracer.next = (tracer.next + 1) % TraceSize
+	}
+	tracer.mu.Unlock()
+
+	util.LogDebug("trace %s", e)
+}
+
+// Trace returns the recorded packets, oldest first.
+func Trace() []TraceEntry {
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+
+	out := make([]TraceEntry, 0, len(tracer.ring))
+	out = append(out, tracer.ring[tracer.next:]...)
+	return append(out, tracer.ring[:tracer.next]...)
+}
+
+// DumpTrace writes the recorded packets to w, one per line, oldest first.
+func DumpTrace(w io.Writer) error {
+	for _, e := range Trace() {
+		if _, err := fmt.Fprintln(w, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
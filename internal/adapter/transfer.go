@@ -0,0 +1,73 @@
+package adapter
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// Transfer caps the payload bytes a tunnel carries in both directions
+// combined, e.g. on a metered link. A zero Limit is unlimited.
+type Transfer struct {
+	Limit int64 // bytes allowed in the period
+	Used  int64 // bytes already used in the period before this tunnel
+
+	// Pause holds all forwarding once Limit is reached, until the tunnel
+	// closes. Otherwise exceeding it is only logged.
+	Pause bool
+}
+
+// transferWarning is the share of Transfer.Limit (in percent) at which a
+// warning is logged.
+const transferWarning = 80
+
+// transferMeter counts payload bytes against a Transfer. It is shared by all
+// sockets of an adapter.
+type transferMeter struct {
+	cfg      Transfer
+	used     atomic.Int64
+	warned   atomic.Bool
+	exceeded atomic.Bool
+}
+
+// newTransferMeter returns a meter for t, or nil if t is unlimited.
+func newTransferMeter(t Transfer) *transferMeter {
+	if t.Limit <= 0 {
+		return nil
+	}
+	m := &transferMeter{cfg: t}
+	m.used.Store(t.Used)
+	return m
+}
+
+// add counts n bytes about to be forwarded, logging when the warning level
+// and the limit are crossed. Once the limit is reached with Pause set, it
+// blocks until ctx is done and returns false.
+func (m *transferMeter) add(ctx context.Context, n int) bool {
+	if m.cfg.Pause && m.exceeded.Load() {
+		<-ctx.Done()
+		return false
+	}
+
+	used := m.used.Add(int64(n))
+	if used*100 >= m.cfg.Limit*transferWarning && m.warned.CompareAndSwap(false, true) {
+		util.LogWarning("%d%% of the %s transfer quota used", transferWarning, formatQuota(m.cfg.Limit))
+	}
+	if used < m.cfg.Limit || !m.exceeded.CompareAndSwap(false, true) {
+		return true
+	}
+
+	if m.cfg.Pause {
+		util.LogWarning("transfer quota of %s exceeded — forwarding paused until the tunnel closes", formatQuota(m.cfg.Limit))
+	} else {
+		util.LogWarning("transfer quota of %s exceeded", formatQuota(m.cfg.Limit))
+	}
+	return true
+}
+
+// formatQuota formats a byte count without the padding of util.FormatBytes.
+func formatQuota(n int64) string {
+	return strings.TrimSpace(util.FormatBytes(float64(n)))
+}
@@ -0,0 +1,80 @@
+package adapter
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/1ureka/roj1/internal/protocol"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// Validation configures the checks applied to every inbound packet before
+// dispatch. Packets that fail them are dropped and counted against the peer.
+// Unknown types and oversize payloads are always rejected.
+type Validation struct {
+	// Strict makes the host require CONNECT as the first packet of a new
+	// socketID instead of creating the socket from any non-CLOSE packet.
+	// Not suited to striped multipath, where DATA can overtake CONNECT.
+	Strict bool
+
+	// MaxViolations shuts the adapter down once the peer has sent this many
+	// invalid packets. Zero never does.
+	MaxViolations int
+}
+
+// Protocol violations.
+var (
+	errUnknownType       = errors.New("unknown packet type")
+	errOversizePayload   = errors.New("payload exceeds the maximum size")
+	errUnexpectedPayload = errors.New("payload on a non-DATA packet")
+	errNoConnect         = errors.New("new socketID does not start with CONNECT")
+	errInvalidNack       = errors.New("invalid NACK range")
+	errOversizeControl   = errors.New("CONTROL payload empty or over the maximum size")
+)
+
+// validate checks the fields of pkt that do not depend on socket state.
+func validate(pkt *protocol.Packet) error {
+	switch pkt.Type {
+	case protocol.TypeData:
+		if len(pkt.Payload) > protocol.MaxPayloadSize {
+			return fmt.Errorf("%w: %d bytes (limit %d)", errOversizePayload, len(pkt.Payload), protocol.MaxPayloadSize)
+		}
+	case protocol.TypeConnect, protocol.TypeClose:
+		if len(pkt.Payload) > 0 {
+			return fmt.Errorf("%w: %d bytes", errUnexpectedPayload, len(pkt.Payload))
+		}
+	case protocol.TypeNack:
+		if len(pkt.Payload) != protocol.NackSize {
+			return fmt.Errorf("%w: %d-byte payload", errInvalidNack, len(pkt.Payload))
+		}
+		if first, last := protocol.NackRange(pkt.Payload); first == 0 || first > last {
+			return fmt.Errorf("%w: %d-%d", errInvalidNack, first, last)
+		}
+	case protocol.TypeControl:
+		if len(pkt.Payload) == 0 || len(pkt.Payload) > protocol.MaxControlSize {
+			return fmt.Errorf("%w: %d bytes (limit %d)", errOversizeControl, len(pkt.Payload), protocol.MaxControlSize)
+		}
+	default:
+		return fmt.Errorf("%w 0x%02x", errUnknownType, pkt.Type)
+	}
+	return nil
+}
+
+// violation records that the peer sent pkt, which failed validation with err
+// and is dropped. The first violation is logged as a warning, later ones at
+// debug level; at Validation.MaxViolations the adapter is shut down.
+func (a *adapter) violation(pkt *protocol.Packet, err error) {
+	util.Stats.AddViolation()
+	n := a.violations.Add(1)
+
+	if n == 1 {
+		util.LogWarning("[%08x] peer violated the protocol, dropping packet: %v", pkt.SocketID, err)
+	} else {
+		util.LogDebug("[%08x] peer violated the protocol, dropping packet: %v", pkt.SocketID, err)
+	}
+
+	if limit := a.validation.MaxViolations; limit > 0 && n == int64(limit) {
+		util.LogError("peer sent %d invalid packets, closing the tunnel", n)
+		a.abort()
+	}
+}
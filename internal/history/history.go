@@ -0,0 +1,111 @@
+// Package history records completed tunnel sessions in a local JSON-lines
+// file, one object per session, for "roj1 history" to report on.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Session describes one completed tunnel session.
+type Session struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Role     string    `json:"role"`           // "host" or "client"
+	Addr     string    `json:"addr,omitempty"` // target (host) or virtual service (client) address
+	Peer     string    `json:"peer,omitempty"` // fingerprint of the peer's proven key
+	BytesIn  int64     `json:"bytesIn"`        // bytes received from the peer
+	BytesOut int64     `json:"bytesOut"`       // bytes sent to the peer
+	Conns    int64     `json:"conns"`          // connections carried by the tunnel
+	Reason   string    `json:"reason,omitempty"`
+}
+
+// Duration returns how long the session lasted.
+func (s Session) Duration() time.Duration { return s.End.Sub(s.Start) }
+
+// Append adds s to the history file at path, creating the file (and its
+// directory) if needed.
+func Append(path string, s Session) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Load reads the sessions in the history file at path, oldest first. A
+// missing file is an empty history.
+func Load(path string) ([]Session, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sessions []Session
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var s Session
+		if err := json.Unmarshal(sc.Bytes(), &s); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, sc.Err()
+}
+
+// Since returns the sessions that ended at or after t.
+func Since(sessions []Session, t time.Time) []Session {
+	var out []Session
+	for _, s := range sessions {
+		if !s.End.Before(t) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Total sums the usage of a set of sessions.
+type Total struct {
+	Sessions int
+	Duration time.Duration
+	BytesIn  int64
+	BytesOut int64
+	Conns    int64
+}
+
+// Sum returns the total usage of sessions.
+func Sum(sessions []Session) Total {
+	t := Total{Sessions: len(sessions)}
+	for _, s := range sessions {
+		t.Duration += s.Duration()
+		t.BytesIn += s.BytesIn
+		t.BytesOut += s.BytesOut
+		t.Conns += s.Conns
+	}
+	return t
+}
@@ -0,0 +1,153 @@
+// Package hosts adds and removes entries in the system hosts file, so the
+// client's virtual service can be reached under a stable hostname. Entries
+// it writes are tagged with Marker and it never touches other lines.
+package hosts
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Marker tags the lines written by Add.
+const Marker = "# roj1"
+
+// lockSuffix names the lock file next to the hosts file that serializes
+// edits between roj1 processes (see lock).
+const lockSuffix = ".roj1.lock"
+
+// ErrInvalidName is returned for a name that is not a valid hostname.
+var ErrInvalidName = errors.New("invalid hostname")
+
+// Path returns the system hosts file.
+func Path() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("SystemRoot"), "System32", "drivers", "etc", "hosts")
+	}
+	return "/etc/hosts"
+}
+
+// ValidName reports whether name is a valid hostname: dot-separated labels
+// of letters, digits and inner hyphens, at most 253 bytes.
+func ValidName(name string) bool {
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for label := range strings.SplitSeq(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Add maps name to ip in the hosts file at path, replacing an entry for name
+// left behind by an earlier run.
+func Add(path, ip, name string) error {
+	if !ValidName(name) {
+		return ErrInvalidName
+	}
+	return edit(path, name, ip+"\t"+name+"\t"+Marker)
+}
+
+// Remove deletes the entry for name written by Add, if any.
+func Remove(path, name string) error {
+	return edit(path, name, "")
+}
+
+// edit drops the marked entries for name from the hosts file and appends
+// entry, unless it is empty, keeping the file's mode. It holds the lock
+// from reading the file to writing it back, so two roj1 processes editing
+// at once do not lose each other's entries.
+func edit(path, name, entry string) error {
+	unlock, err := lock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	changed := false
+	for line := range strings.SplitAfterSeq(string(data), "\n") {
+		if owned(line, name) {
+			changed = true
+			continue
+		}
+		out.WriteString(line)
+	}
+	if entry != "" {
+		if out.Len() > 0 && !bytes.HasSuffix(out.Bytes(), []byte("\n")) {
+			out.WriteByte('\n')
+		}
+		out.WriteString(entry + "\n")
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return write(path, out.Bytes(), info.Mode().Perm())
+}
+
+// write replaces the file at path with data through a temporary file renamed
+// over it, so a resolver never reads it half written. If that fails, e.g.
+// for a bind mount (as /etc/hosts is in a container) or a directory roj1
+// may not write to, the file is rewritten in place instead.
+func write(path string, data []byte, perm os.FileMode) error {
+	if err := replace(path, data, perm); err == nil {
+		return nil
+	}
+	return os.WriteFile(path, data, perm)
+}
+
+// replace writes data to a temporary file next to path and renames it over
+// path.
+func replace(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".hosts.roj1-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// owned reports whether line is an entry for name written by Add.
+func owned(line, name string) bool {
+	content, ok := strings.CutSuffix(strings.TrimRight(line, "\r\n"), Marker)
+	if !ok {
+		return false
+	}
+	fields := strings.Fields(content)
+	return len(fields) == 2 && strings.EqualFold(fields[1], name)
+}
@@ -0,0 +1,24 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package hosts
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// lock takes an exclusive advisory lock on the lock file next to the hosts
+// file at path, waiting for another roj1 that holds it, and returns the
+// function that releases it.
+func lock(path string) (func(), error) {
+	f, err := os.OpenFile(path+lockSuffix, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() { f.Close() }, nil
+}
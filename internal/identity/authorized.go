@@ -0,0 +1,96 @@
+package identity
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// AuthorizedKey is one entry of an authorized keys file.
+type AuthorizedKey struct {
+	Key     ed25519.PublicKey
+	Comment string // free text after the key, e.g. "alice@laptop"
+	Policy  Policy // from the options before the key
+}
+
+// Name returns the comment, or the fingerprint if there is none.
+func (k AuthorizedKey) Name() string {
+	if k.Comment != "" {
+		return k.Comment
+	}
+	return Fingerprint(k.Key)
+}
+
+// AuthorizedKeys is the set of client keys a host accepts.
+type AuthorizedKeys struct {
+	keys map[string]AuthorizedKey // by fingerprint
+}
+
+// LoadAuthorizedKeys reads an authorized keys file (see ParseAuthorizedKeys).
+func LoadAuthorizedKeys(path string) (*AuthorizedKeys, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	keys, err := ParseAuthorizedKeys(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return keys, nil
+}
+
+// ParseAuthorizedKeys parses one public key per line, in the form
+// "[options] roj1-ed25519 <base64> [comment]" (see Policy for the options).
+// Blank lines and lines starting with '#' are skipped.
+func ParseAuthorizedKeys(r io.Reader) (*AuthorizedKeys, error) {
+	a := &AuthorizedKeys{keys: make(map[string]AuthorizedKey)}
+
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		var policy Policy
+		for len(fields) > 0 && fields[0] != KeyType && strings.Contains(fields[0], "=") {
+			if err := policy.setOption(fields[0]); err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			fields = fields[1:]
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: missing key", n)
+		}
+		key, err := ParsePublicKey(fields[0] + " " + fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		a.keys[Fingerprint(key)] = AuthorizedKey{
+			Key:     key,
+			Comment: strings.Join(fields[2:], " "),
+			Policy:  policy,
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Lookup returns the entry for pub, if it is authorized.
+func (a *AuthorizedKeys) Lookup(pub ed25519.PublicKey) (AuthorizedKey, bool) {
+	k, ok := a.keys[Fingerprint(pub)]
+	return k, ok
+}
+
+// Len returns the number of authorized keys.
+func (a *AuthorizedKeys) Len() int {
+	return len(a.keys)
+}
@@ -0,0 +1,107 @@
+package identity
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// AnyService matches every service in a grants file.
+const AnyService = "*"
+
+// Grants records which services of the host's catalog each client key may
+// use. The file has one decision per line:
+//
+//	SHA256:<fingerprint> web allow
+//	SHA256:<fingerprint> * deny
+//
+// A line for the service itself takes precedence over AnyService; among
+// lines for the same key and service, the last one wins, so decisions can be
+// appended.
+type Grants struct {
+	path string
+
+	mu    sync.Mutex
+	rules map[grantKey]bool // allow or deny
+}
+
+// grantKey identifies a decision by client fingerprint and service.
+type grantKey struct {
+	peer, service string
+}
+
+// LoadGrants reads the grants file at path. A missing file has no grants and
+// is created by the first Record.
+func LoadGrants(path string) (*Grants, error) {
+	g := &Grants{path: path, rules: make(map[grantKey]bool)}
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return g, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 || !strings.HasPrefix(fields[0], "SHA256:") || (fields[2] != "allow" && fields[2] != "deny") {
+			return nil, fmt.Errorf("%s: line %d: want \"SHA256:<fingerprint> <service> allow|deny\"", path, n)
+		}
+		g.rules[grantKey{fields[0], strings.ToLower(fields[1])}] = fields[2] == "allow"
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Lookup returns the decision for peer (a Fingerprint) and service, and
+// whether there is one.
+func (g *Grants) Lookup(peer, service string) (allow, ok bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if allow, ok = g.rules[grantKey{peer, strings.ToLower(service)}]; ok {
+		return allow, true
+	}
+	allow, ok = g.rules[grantKey{peer, AnyService}]
+	return allow, ok
+}
+
+// Record stores a decision for peer and service and appends it to the file.
+func (g *Grants) Record(peer, service string, allow bool) error {
+	service = strings.ToLower(service)
+	decision := "deny"
+	if allow {
+		decision = "allow"
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.rules[grantKey{peer, service}] = allow
+	if err := os.MkdirAll(filepath.Dir(g.path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(g.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f, "%s %s %s\n", peer, service, decision); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,112 @@
+// Package identity implements Ed25519 peer identities: the key file each side
+// keeps, the authorized keys a host accepts clients from, and the known hosts
+// a client pins host keys in on first use (TOFU).
+package identity
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// KeyType prefixes public keys in their text form ("roj1-ed25519 <base64>").
+const KeyType = "roj1-ed25519"
+
+// DefaultDir returns the directory of the default key and lists
+// (e.g. ~/.config/roj1 on Linux).
+func DefaultDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "roj1"), nil
+}
+
+// LoadOrCreate reads the private key at path, or generates one and writes it
+// there (mode 0600) if the file does not exist. created reports the latter.
+func LoadOrCreate(path string) (key ed25519.PrivateKey, created bool, err error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		key, err = create(path)
+		return key, err == nil, err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, false, fmt.Errorf("%s: not a PEM private key", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", path, err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, false, fmt.Errorf("%s: not an Ed25519 key", path)
+	}
+	return key, false, nil
+}
+
+// create generates a key and writes it to path, creating its directory.
+func create(path string) (ed25519.PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	// O_EXCL: never overwrite a key created concurrently by another process.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return key, f.Close()
+}
+
+// MarshalPublicKey returns the text form of pub, as used in the authorized
+// keys and known hosts files.
+func MarshalPublicKey(pub ed25519.PublicKey) string {
+	return KeyType + " " + base64.StdEncoding.EncodeToString(pub)
+}
+
+// ParsePublicKey parses the text form of a public key (see MarshalPublicKey).
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	typ, data, ok := strings.Cut(strings.TrimSpace(s), " ")
+	if !ok || typ != KeyType {
+		return nil, fmt.Errorf("not a %s public key", KeyType)
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("malformed %s public key", KeyType)
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// Fingerprint returns the SHA-256 fingerprint of pub, e.g. "SHA256:q1w2…",
+// for people to compare keys by.
+func Fingerprint(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
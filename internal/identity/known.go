@@ -0,0 +1,95 @@
+package identity
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Known host errors returned by CheckKnownHost.
+var (
+	ErrHostKeyChanged = errors.New("host key changed")
+	ErrHostKeyMissing = errors.New("host presented no key")
+)
+
+// knownMu serializes CheckKnownHost within the process.
+var knownMu sync.Mutex
+
+// CheckKnownHost checks pub, the key a host presented, against the entry for
+// host in the known hosts file at path. On first use the key is pinned: a
+// line "host roj1-ed25519 <base64>" is appended and first is true. A key that
+// differs from the pinned one is ErrHostKeyChanged; a nil pub for a pinned
+// host is ErrHostKeyMissing.
+func CheckKnownHost(path, host string, pub ed25519.PublicKey) (first bool, err error) {
+	knownMu.Lock()
+	defer knownMu.Unlock()
+
+	pinned, err := lookupKnownHost(path, host)
+	if err != nil {
+		return false, err
+	}
+
+	switch {
+	case pinned != nil && pub == nil:
+		return false, fmt.Errorf("%w: %s is pinned to %s", ErrHostKeyMissing, host, Fingerprint(pinned))
+	case pinned != nil && !pinned.Equal(pub):
+		return false, fmt.Errorf("%w: %s presented %s, pinned %s (remove its line from %s if the host was reinstalled)",
+			ErrHostKeyChanged, host, Fingerprint(pub), Fingerprint(pinned), path)
+	case pinned != nil || pub == nil:
+		return false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return false, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return false, err
+	}
+	if _, err := fmt.Fprintf(f, "%s %s\n", host, MarshalPublicKey(pub)); err != nil {
+		f.Close()
+		return false, err
+	}
+	return true, f.Close()
+}
+
+// lookupKnownHost returns the key pinned for host, or nil if there is none
+// (or no file yet). A line that is not an entry, a comment or blank is an
+// error, as it may be a damaged entry for host.
+func lookupKnownHost(path, host string) (ed25519.PublicKey, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, key, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("%s: line %d: not a \"host key\" entry", path, n)
+		}
+		if name != host {
+			continue
+		}
+		pub, err := ParsePublicKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("%s: line %d: %w", path, n, err)
+		}
+		return pub, nil
+	}
+	return nil, sc.Err()
+}
@@ -0,0 +1,82 @@
+package identity
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy restricts what a client may do once authenticated. It is written as
+// options before the key in the authorized keys file, e.g.
+//
+//	ports=5432,6379 bandwidth=10M sockets=8 session=2h roj1-ed25519 <base64> alice
+//
+// Zero fields are unrestricted.
+type Policy struct {
+	Ports        []int         // ports=: target ports the client may connect to
+	MaxBandwidth int64         // bandwidth=: bytes per second in each direction (K, M, G suffixes)
+	MaxSockets   int           // sockets=: concurrent connections
+	MaxSession   time.Duration // session=: tunnel lifetime, e.g. 2h
+}
+
+// setOption parses one "name=value" option into p.
+func (p *Policy) setOption(opt string) error {
+	name, value, ok := strings.Cut(opt, "=")
+	if !ok || value == "" {
+		return fmt.Errorf("malformed option %q (want name=value)", opt)
+	}
+
+	var err error
+	switch name {
+	case "ports":
+		for _, s := range strings.Split(value, ",") {
+			port, perr := strconv.Atoi(s)
+			if perr != nil || port < 1 || port > 65535 {
+				return fmt.Errorf("invalid port %q in ports=", s)
+			}
+			p.Ports = append(p.Ports, port)
+		}
+	case "bandwidth":
+		p.MaxBandwidth, err = parseBytes(value)
+	case "sockets":
+		p.MaxSockets, err = strconv.Atoi(value)
+		if err == nil && p.MaxSockets < 1 {
+			err = fmt.Errorf("must be positive")
+		}
+	case "session":
+		p.MaxSession, err = time.ParseDuration(value)
+		if err == nil && p.MaxSession <= 0 {
+			err = fmt.Errorf("must be positive")
+		}
+	default:
+		return fmt.Errorf("unknown option %q", name)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s=: %w", name, err)
+	}
+	return nil
+}
+
+// parseBytes parses a positive byte count with an optional binary K, M or G
+// suffix, e.g. "512K" or "10M".
+func parseBytes(s string) (int64, error) {
+	mult := int64(1)
+	switch strings.ToUpper(s[len(s)-1:]) {
+	case "K":
+		mult = 1 << 10
+	case "M":
+		mult = 1 << 20
+	case "G":
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("want a positive byte count such as 512K or 10M")
+	}
+	return n * mult, nil
+}
@@ -0,0 +1,313 @@
+// Package mux multiplexes independent, flow-controlled streams over a single
+// reliable, ordered byte stream, in the style of yamux. Each stream is a
+// net.Conn with its own receive window, so a slow reader only stalls its own
+// stream, and supports half-close (CloseWrite).
+//
+// Every frame starts with a 12-byte header:
+//
+//	version (1) | type (1) | flags (2) | stream ID (4) | length (4)
+//
+// A DATA frame carries length bytes of payload; a WINDOW frame grants the
+// peer length more bytes of send window. SYN (on a WINDOW frame) opens a
+// stream and ACK acknowledges it, FIN half-closes a stream and RST aborts it.
+// The client opens odd stream IDs and the server even ones.
+package mux
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Frame types.
+const (
+	typeData   uint8 = 0
+	typeWindow uint8 = 1
+)
+
+// Frame flags.
+const (
+	flagSYN uint16 = 1 << 0
+	flagACK uint16 = 1 << 1
+	flagFIN uint16 = 1 << 2
+	flagRST uint16 = 1 << 3
+)
+
+const (
+	protoVersion = 0
+	headerSize   = 12
+
+	// InitialWindow is the receive window of a new stream, in bytes.
+	InitialWindow = 256 * 1024
+
+	// maxFrameSize bounds the payload of one DATA frame.
+	maxFrameSize = 16 * 1024
+
+	// acceptBacklog bounds the streams opened by the peer and not yet
+	// accepted; further ones are reset.
+	acceptBacklog = 256
+)
+
+// Errors returned by sessions and streams.
+var (
+	ErrSessionClosed = errors.New("mux session closed")
+	ErrStreamReset   = errors.New("mux stream reset")
+	errProtocol      = errors.New("mux protocol error")
+)
+
+// Session multiplexes streams over one connection. Create it with Client or
+// Server on either end of the connection.
+type Session struct {
+	conn io.ReadWriteCloser
+
+	wmu  sync.Mutex // serializes frame writes
+	wbuf []byte
+
+	mu      sync.Mutex
+	streams map[uint32]*Stream
+	nextID  uint32
+
+	accept    chan *Stream
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error // why the session closed, set before done is closed
+}
+
+// Client starts the session of the side that dials, opening odd stream IDs.
+func Client(conn io.ReadWriteCloser) *Session {
+	return newSession(conn, 1)
+}
+
+// Server starts the session of the side that listens, opening even stream
+// IDs.
+func Server(conn io.ReadWriteCloser) *Session {
+	return newSession(conn, 2)
+}
+
+func newSession(conn io.ReadWriteCloser, firstID uint32) *Session {
+	s := &Session{
+		conn:    conn,
+		streams: make(map[uint32]*Stream),
+		nextID:  firstID,
+		accept:  make(chan *Stream, acceptBacklog),
+		done:    make(chan struct{}),
+	}
+	go s.readLoop()
+	return s
+}
+
+// Open opens a new stream. It is usable at once; the peer sees it in Accept.
+func (s *Session) Open() (*Stream, error) {
+	s.mu.Lock()
+	if s.isClosed() {
+		s.mu.Unlock()
+		return nil, ErrSessionClosed
+	}
+	id := s.nextID
+	s.nextID += 2
+	st := newStream(s, id)
+	s.streams[id] = st
+	s.mu.Unlock()
+
+	if err := s.writeFrame(typeWindow, flagSYN, id, nil); err != nil {
+		s.remove(id)
+		return nil, err
+	}
+	return st, nil
+}
+
+// Accept waits for the next stream opened by the peer.
+func (s *Session) Accept() (*Stream, error) {
+	select {
+	case st := <-s.accept:
+		return st, nil
+	case <-s.done:
+		return nil, s.Err()
+	}
+}
+
+// NumStreams returns the number of open streams.
+func (s *Session) NumStreams() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.streams)
+}
+
+// Done returns a channel that is closed when the session is closed.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns why the session closed: ErrSessionClosed after Close, or the
+// error that broke the connection. It is nil while the session is open.
+func (s *Session) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// Close closes the session, its connection and all of its streams.
+func (s *Session) Close() error {
+	s.shutdown(ErrSessionClosed)
+	return nil
+}
+
+// shutdown closes the session with the given cause.
+func (s *Session) shutdown(cause error) {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.err = cause
+		close(s.done)
+		s.mu.Unlock()
+		s.conn.Close()
+	})
+}
+
+// isClosed reports whether the session is closed.
+func (s *Session) isClosed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// remove drops a stream from the session.
+func (s *Session) remove(id uint32) {
+	s.mu.Lock()
+	delete(s.streams, id)
+	s.mu.Unlock()
+}
+
+// writeFrame writes one frame carrying payload.
+func (s *Session) writeFrame(typ uint8, flags uint16, id uint32, payload []byte) error {
+	return s.write(typ, flags, id, uint32(len(payload)), payload)
+}
+
+// writeWindow grants the peer delta more bytes of send window on a stream.
+func (s *Session) writeWindow(flags uint16, id, delta uint32) error {
+	return s.write(typeWindow, flags, id, delta, nil)
+}
+
+func (s *Session) write(typ uint8, flags uint16, id, length uint32, payload []byte) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	if s.isClosed() {
+		return ErrSessionClosed
+	}
+
+	buf := append(s.wbuf[:0], protoVersion, typ)
+	buf = binary.BigEndian.AppendUint16(buf, flags)
+	buf = binary.BigEndian.AppendUint32(buf, id)
+	buf = binary.BigEndian.AppendUint32(buf, length)
+	buf = append(buf, payload...)
+	s.wbuf = buf
+
+	if _, err := s.conn.Write(buf); err != nil {
+		s.shutdown(err)
+		return err
+	}
+	return nil
+}
+
+// readLoop reads and dispatches frames until the connection fails.
+func (s *Session) readLoop() {
+	r := bufio.NewReader(s.conn)
+	hdr := make([]byte, headerSize)
+
+	for {
+		if _, err := io.ReadFull(r, hdr); err != nil {
+			s.shutdown(err)
+			return
+		}
+		if hdr[0] != protoVersion {
+			s.shutdown(fmt.Errorf("%w: unsupported version %d", errProtocol, hdr[0]))
+			return
+		}
+		typ := hdr[1]
+		flags := binary.BigEndian.Uint16(hdr[2:4])
+		id := binary.BigEndian.Uint32(hdr[4:8])
+		length := binary.BigEndian.Uint32(hdr[8:12])
+
+		var err error
+		switch typ {
+		case typeData:
+			err = s.handleData(r, flags, id, length)
+		case typeWindow:
+			err = s.handleWindow(flags, id, length)
+		default:
+			err = fmt.Errorf("%w: unknown frame type %d", errProtocol, typ)
+		}
+		if err != nil {
+			s.shutdown(err)
+			return
+		}
+	}
+}
+
+// handleWindow handles a WINDOW frame, which may open a stream (SYN).
+func (s *Session) handleWindow(flags uint16, id, delta uint32) error {
+	if flags&flagSYN != 0 {
+		return s.handleSYN(id)
+	}
+
+	s.mu.Lock()
+	st := s.streams[id]
+	s.mu.Unlock()
+	if st == nil {
+		return nil // already closed on our side
+	}
+	st.grant(delta, flags)
+	return nil
+}
+
+// handleSYN registers a stream opened by the peer and acknowledges it.
+func (s *Session) handleSYN(id uint32) error {
+	s.mu.Lock()
+	if id%2 == s.nextID%2 || s.streams[id] != nil {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: invalid stream ID %d", errProtocol, id)
+	}
+	st := newStream(s, id)
+	s.streams[id] = st
+	s.mu.Unlock()
+
+	select {
+	case s.accept <- st:
+	default:
+		s.remove(id)
+		return s.writeWindow(flagRST, id, 0)
+	}
+	return s.writeWindow(flagACK, id, 0)
+}
+
+// handleData handles a DATA frame, reading its payload from r.
+func (s *Session) handleData(r io.Reader, flags uint16, id, length uint32) error {
+	if length > maxFrameSize {
+		return fmt.Errorf("%w: %d-byte frame", errProtocol, length)
+	}
+
+	var payload []byte
+	if length > 0 {
+		payload = make([]byte, length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	st := s.streams[id]
+	s.mu.Unlock()
+	if st == nil {
+		return nil // already closed on our side
+	}
+	return st.receive(payload, flags)
+}
@@ -0,0 +1,316 @@
+package mux
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Stream is one bidirectional stream of a Session. It implements net.Conn.
+type Stream struct {
+	s  *Session
+	id uint32
+
+	mu         sync.Mutex
+	recvBuf    bytes.Buffer
+	recvWindow uint32 // bytes the peer may still send
+	consumed   uint32 // bytes read but not yet granted back to the peer
+	sendWindow uint32 // bytes we may still send
+	remoteFIN  bool   // the peer half-closed its side
+	localFIN   bool   // we half-closed our side
+	reset      bool
+	closed     bool
+
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	readReady  chan struct{} // signalled on new data, FIN or a new deadline
+	writeReady chan struct{} // signalled on a window update or a new deadline
+	done       chan struct{} // closed on Close or reset
+	doneOnce   sync.Once
+}
+
+func newStream(s *Session, id uint32) *Stream {
+	return &Stream{
+		s:          s,
+		id:         id,
+		recvWindow: InitialWindow,
+		sendWindow: InitialWindow,
+		readReady:  make(chan struct{}, 1),
+		writeReady: make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+}
+
+// ID returns the stream ID, unique within its session.
+func (st *Stream) ID() uint32 {
+	return st.id
+}
+
+// Read reads data sent by the peer. It returns io.EOF once the peer has
+// half-closed the stream and all of its data has been read.
+func (st *Stream) Read(b []byte) (int, error) {
+	for {
+		st.mu.Lock()
+		if st.recvBuf.Len() > 0 {
+			n, _ := st.recvBuf.Read(b)
+			st.consumed += uint32(n)
+			var delta uint32
+			if st.consumed >= InitialWindow/2 && !st.remoteFIN {
+				delta = st.consumed
+				st.recvWindow += delta
+				st.consumed = 0
+			}
+			st.mu.Unlock()
+
+			if delta > 0 {
+				st.s.writeWindow(0, st.id, delta)
+			}
+			return n, nil
+		}
+		err := st.readErr()
+		deadline := st.readDeadline
+		st.mu.Unlock()
+
+		if err != nil {
+			return 0, err
+		}
+		if err := st.wait(st.readReady, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// readErr returns why Read cannot wait for more data, or nil. Called with
+// st.mu held.
+func (st *Stream) readErr() error {
+	switch {
+	case st.closed:
+		return net.ErrClosed
+	case st.reset:
+		return ErrStreamReset
+	case st.remoteFIN:
+		return io.EOF
+	case st.s.isClosed():
+		return ErrSessionClosed
+	}
+	return nil
+}
+
+// Write sends b to the peer, blocking while the peer's receive window is
+// full.
+func (st *Stream) Write(b []byte) (int, error) {
+	total := 0
+	for total < len(b) {
+		st.mu.Lock()
+		var err error
+		switch {
+		case st.reset:
+			err = ErrStreamReset
+		case st.closed || st.localFIN:
+			err = net.ErrClosed
+		case st.s.isClosed():
+			err = ErrSessionClosed
+		}
+		if err != nil {
+			st.mu.Unlock()
+			return total, err
+		}
+		if st.sendWindow == 0 {
+			deadline := st.writeDeadline
+			st.mu.Unlock()
+			if err := st.wait(st.writeReady, deadline); err != nil {
+				return total, err
+			}
+			continue
+		}
+
+		n := min(len(b)-total, int(st.sendWindow), maxFrameSize)
+		st.sendWindow -= uint32(n)
+		st.mu.Unlock()
+
+		if err := st.s.writeFrame(typeData, 0, st.id, b[total:total+n]); err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// CloseWrite half-closes the stream: the peer reads io.EOF once it has read
+// everything written before, while this side can keep reading.
+func (st *Stream) CloseWrite() error {
+	st.mu.Lock()
+	if st.localFIN || st.closed || st.reset {
+		st.mu.Unlock()
+		return nil
+	}
+	st.localFIN = true
+	finished := st.remoteFIN
+	st.mu.Unlock()
+
+	err := st.s.writeFrame(typeData, flagFIN, st.id, nil)
+	if finished {
+		st.s.remove(st.id)
+	}
+	return err
+}
+
+// Close closes the stream. If the peer may still send data, the stream is
+// reset so that it stops.
+func (st *Stream) Close() error {
+	st.mu.Lock()
+	if st.closed {
+		st.mu.Unlock()
+		return nil
+	}
+	st.closed = true
+	flags := uint16(0)
+	switch {
+	case st.reset:
+	case !st.remoteFIN:
+		flags = flagRST
+	case !st.localFIN:
+		flags = flagFIN
+	}
+	st.mu.Unlock()
+
+	st.finish()
+	if flags != 0 {
+		st.s.writeFrame(typeData, flags, st.id, nil)
+	}
+	return nil
+}
+
+// finish removes the stream from its session and wakes its waiters.
+func (st *Stream) finish() {
+	st.doneOnce.Do(func() { close(st.done) })
+	st.s.remove(st.id)
+}
+
+// receive handles a DATA frame for the stream.
+func (st *Stream) receive(payload []byte, flags uint16) error {
+	st.mu.Lock()
+	if uint32(len(payload)) > st.recvWindow {
+		st.mu.Unlock()
+		return fmt.Errorf("%w: stream %d exceeded its window", errProtocol, st.id)
+	}
+	st.recvWindow -= uint32(len(payload))
+	if !st.closed {
+		st.recvBuf.Write(payload)
+	}
+	finished := st.handleFlags(flags)
+	st.mu.Unlock()
+
+	notify(st.readReady)
+	if finished {
+		st.finish()
+	}
+	return nil
+}
+
+// grant handles a WINDOW frame for the stream.
+func (st *Stream) grant(delta uint32, flags uint16) {
+	st.mu.Lock()
+	st.sendWindow += delta
+	finished := st.handleFlags(flags)
+	st.mu.Unlock()
+
+	notify(st.writeReady)
+	if finished {
+		st.finish()
+	}
+}
+
+// handleFlags applies the FIN and RST flags of a frame, reporting whether the
+// stream is finished. Called with st.mu held.
+func (st *Stream) handleFlags(flags uint16) bool {
+	if flags&flagRST != 0 {
+		st.reset = true
+		return true
+	}
+	if flags&flagFIN != 0 {
+		st.remoteFIN = true
+		return st.localFIN
+	}
+	return false
+}
+
+// wait blocks until ch is signalled, the stream or session is closed, or the
+// deadline passes.
+func (st *Stream) wait(ch <-chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-ch:
+	case <-st.done:
+	case <-st.s.done:
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	}
+	return nil
+}
+
+// notify signals ch without blocking.
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// SetDeadline sets the read and write deadlines.
+func (st *Stream) SetDeadline(t time.Time) error {
+	st.SetReadDeadline(t)
+	st.SetWriteDeadline(t)
+	return nil
+}
+
+// SetReadDeadline sets the deadline for Read.
+func (st *Stream) SetReadDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.readDeadline = t
+	st.mu.Unlock()
+	notify(st.readReady)
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for Write.
+func (st *Stream) SetWriteDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.writeDeadline = t
+	st.mu.Unlock()
+	notify(st.writeReady)
+	return nil
+}
+
+// LocalAddr returns the stream's address; streams have no network address.
+func (st *Stream) LocalAddr() net.Addr {
+	return addr{st.id}
+}
+
+// RemoteAddr returns the stream's address; streams have no network address.
+func (st *Stream) RemoteAddr() net.Addr {
+	return addr{st.id}
+}
+
+// addr is the net.Addr of a stream.
+type addr struct {
+	id uint32
+}
+
+func (a addr) Network() string { return "mux" }
+func (a addr) String() string  { return fmt.Sprintf("mux:%d", a.id) }
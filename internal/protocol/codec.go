@@ -7,22 +7,28 @@ import (
 
 // Encode serializes a Packet into a byte slice for DataChannel transmission.
 func Encode(pkt *Packet) []byte {
-	size := HeaderSize + len(pkt.Payload)
-	buf := make([]byte, size)
-	buf[0] = pkt.Type
-	binary.BigEndian.PutUint32(buf[1:5], pkt.SocketID)
-	binary.BigEndian.PutUint32(buf[5:9], pkt.SeqNum)
-	if len(pkt.Payload) > 0 {
-		copy(buf[HeaderSize:], pkt.Payload)
-	}
-	return buf
+	return AppendEncode(make([]byte, 0, HeaderSize+len(pkt.Payload)), pkt)
+}
+
+// AppendEncode appends the serialized Packet to buf and returns the extended
+// slice, so a sender can reuse one buffer for every packet.
+func AppendEncode(buf []byte, pkt *Packet) []byte {
+	buf = append(buf, pkt.Type)
+	buf = binary.BigEndian.AppendUint32(buf, pkt.SocketID)
+	buf = binary.BigEndian.AppendUint32(buf, pkt.SeqNum)
+	return append(buf, pkt.Payload...)
 }
 
-// Decode deserializes a byte slice into a Packet.
+// Decode deserializes a byte slice into a Packet. Frames shorter than the
+// header or with an unknown type are rejected, so a misbehaving peer cannot
+// make the adapter open sockets for packets it would never handle.
 func Decode(data []byte) (*Packet, error) {
 	if len(data) < HeaderSize {
 		return nil, fmt.Errorf("packet too short: %d bytes (need at least %d)", len(data), HeaderSize)
 	}
+	if t := data[0]; t < TypeConnect || t > TypeControl {
+		return nil, fmt.Errorf("unknown packet type 0x%02x", t)
+	}
 	pkt := &Packet{
 		Type:     data[0],
 		SocketID: binary.BigEndian.Uint32(data[1:5]),
@@ -1,20 +1,45 @@
 // Package protocol defines the packet format and types for the P2P tunnel.
 package protocol
 
+import "encoding/binary"
+
 // Packet type constants.
 const (
-	TypeConnect uint8 = 0x01 // New TCP connection request
+	TypeConnect uint8 = 0x01 // New TCP connection request (client); target reached (host reply)
 	TypeData    uint8 = 0x02 // TCP data payload
 	TypeClose   uint8 = 0x03 // Connection close notification
+	TypeNack    uint8 = 0x04 // Retransmission request for a range of SeqNums
+	TypeControl uint8 = 0x05 // Tunnel-wide control message; SocketID and SeqNum unused
 )
 
 // HeaderSize is the fixed header size: Type(1) + SocketID(4) + SeqNum(4).
 const HeaderSize = 9
 
+// MaxPayloadSize is the largest DATA payload a peer may send. Both sides use
+// the same value, so a larger payload is a protocol violation.
+const MaxPayloadSize = 16 * 1024
+
+// NackSize is the payload size of a NACK packet: First(4) + Last(4), the
+// range of the socketID's SeqNums to send again. Its SeqNum is unused.
+const NackSize = 8
+
+// MaxControlSize is the largest CONTROL payload a peer may send.
+const MaxControlSize = 4 * 1024
+
 // Packet represents a tunnel protocol packet transmitted over the DataChannel.
 type Packet struct {
-	Type     uint8  // TypeConnect, TypeData, or TypeClose
-	SocketID uint32 // Hashed identifier from 4-tuple
+	Type     uint8  // TypeConnect, TypeData, TypeClose, TypeNack, or TypeControl
+	SocketID uint32 // Connection identifier, allocated by the client from a counter
 	SeqNum   uint32 // Per-socketID sequence number
-	Payload  []byte // Only used for TypeData
+	Payload  []byte // TypeData, the range of a TypeNack (see NackPayload), or a TypeControl message
+}
+
+// NackPayload returns the payload of a NACK for SeqNums first..last.
+func NackPayload(first, last uint32) []byte {
+	return binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(make([]byte, 0, NackSize), first), last)
+}
+
+// NackRange returns the SeqNums requested by a NACK payload of NackSize bytes.
+func NackRange(payload []byte) (first, last uint32) {
+	return binary.BigEndian.Uint32(payload[0:4]), binary.BigEndian.Uint32(payload[4:8])
 }
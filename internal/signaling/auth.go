@@ -0,0 +1,233 @@
+package signaling
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/1ureka/roj1/internal/identity"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// Peer authentication rides on the hello exchange. The client's hello carries
+// a random challenge; a host with an identity key answers with its public key
+// and a signature over it, which the client checks against its known hosts.
+// A host with authorized keys adds a challenge of its own to its hello and
+// sends no offer until the client answers it with an auth message signed by
+// an authorized key.
+//
+// The keys are then bound to the WebRTC session: the host signs each offer,
+// and the client each answer, over the other's challenge and the SDPs of the
+// path and the session nonce (see sdpTranscript). The SDPs carry the DTLS fingerprints, so whoever
+// relays the signaling cannot put its own in their place to sit in the
+// middle of the PeerConnection.
+
+// ErrAuth is wrapped (together with ErrSignaling) when a peer fails to prove
+// its identity, is not authorized, or the host's key changed. It matches
+// ErrSignalingAuth.
+var ErrAuth error = authError("peer authentication failed")
+
+const challengeSize = 32 // random bytes in a challenge
+
+// Signed roles, so that a signature made as one side cannot be replayed as
+// the other.
+const (
+	roleHost   = "roj1-auth-v1 host "
+	roleClient = "roj1-auth-v1 client "
+
+	roleHostSDP   = "roj1-sdp-v1 host "
+	roleClientSDP = "roj1-sdp-v1 client "
+)
+
+// newChallenge returns a random challenge, base64-encoded.
+func newChallenge() (string, error) {
+	b := make([]byte, challengeSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to create challenge: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// signChallenge signs a challenge in the given role.
+func signChallenge(key ed25519.PrivateKey, role, challenge string) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, []byte(role+challenge)))
+}
+
+// verifyChallenge checks that sig is a signature over challenge in the given
+// role by the public key pubText, and returns that key.
+func verifyChallenge(pubText, role, challenge, sig string) (ed25519.PublicKey, error) {
+	pub, err := identity.ParsePublicKey(pubText)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil || !ed25519.Verify(pub, []byte(role+challenge), raw) {
+		return nil, fmt.Errorf("invalid signature for key %s", identity.Fingerprint(pub))
+	}
+	return pub, nil
+}
+
+// sdpTranscript returns what is signed for a path's SDPs: the role, the
+// peer's challenge, so that it cannot be replayed into another session, the
+// session nonce, so that a relay cannot swap it (see codec), the path, and
+// its SDPs so far, each prefixed with its length. The host signs the offer;
+// the client, which has both, signs the offer and its answer.
+func sdpTranscript(role, challenge, nonce string, path int, sdps ...string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s%s\nnonce %s\npath %d\n", role, challenge, nonce, path)
+	for _, sdp := range sdps {
+		fmt.Fprintf(&b, "%d\n%s", len(sdp), sdp)
+	}
+	return []byte(b.String())
+}
+
+// signSDP signs a path's SDPs for the peer (see sdpTranscript), or returns
+// "" if this side has no key or the peer sent no challenge.
+func (r *receiver) signSDP(role string, path int, sdps ...string) string {
+	r.mu.Lock()
+	challenge := r.peerChallenge
+	r.mu.Unlock()
+	if r.key == nil || challenge == "" {
+		return ""
+	}
+	transcript := sdpTranscript(role, challenge, r.codec.sessionNonce(), path, sdps...)
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(r.key, transcript))
+}
+
+// checkSDP verifies the peer's signature over a path's SDPs, if the peer
+// proved a key earlier: the host in its hello, the client in its auth.
+func (r *receiver) checkSDP(role, sig string, path int, sdps ...string) error {
+	r.mu.Lock()
+	pub := r.peerKey
+	r.mu.Unlock()
+	if pub == nil || r.challenge == "" {
+		return nil
+	}
+	transcript := sdpTranscript(role, r.challenge, r.codec.sessionNonce(), path, sdps...)
+	raw, err := base64.StdEncoding.DecodeString(sig)
+	if sig == "" || err != nil || !ed25519.Verify(pub, transcript, raw) {
+		return fmt.Errorf("%w: the SDP of path %d is not signed by %s, so the signaling may have been tampered with",
+			ErrAuth, path, identity.Fingerprint(pub))
+	}
+	return nil
+}
+
+// answerClientHello replies to the client's hello with this host's version, a proof
+// of its key if it has one, and a challenge if it requires authentication.
+func (r *receiver) answerClientHello(hello message) error {
+	r.mu.Lock()
+	r.peerChallenge = hello.Challenge
+	r.mu.Unlock()
+
+	reply := message{Version: r.version, Challenge: r.challenge}
+	if r.key != nil && hello.Challenge != "" {
+		reply.PublicKey = identity.MarshalPublicKey(r.key.Public().(ed25519.PublicKey))
+		reply.Signature = signChallenge(r.key, roleHost, hello.Challenge)
+	}
+	return sendHello(r.conn, r.wsMu, r.codec, reply)
+}
+
+// checkHost verifies the host's hello: its key, pinned in the known hosts on
+// first use, and its challenge, answered with this client's key.
+func (r *receiver) checkHost(hello message) error {
+	var pub ed25519.PublicKey
+	if hello.PublicKey != "" {
+		var err error
+		if pub, err = verifyChallenge(hello.PublicKey, roleHost, r.challenge, hello.Signature); err != nil {
+			return fmt.Errorf("%w: host: %w", ErrAuth, err)
+		}
+	}
+
+	if r.knownHosts != "" {
+		first, err := identity.CheckKnownHost(r.knownHosts, r.hostName, pub)
+		switch {
+		case errors.Is(err, identity.ErrHostKeyChanged), errors.Is(err, identity.ErrHostKeyMissing):
+			return fmt.Errorf("%w: %w", ErrAuth, err)
+		case err != nil:
+			// Without the file, a changed key would go unnoticed.
+			return fmt.Errorf("%w: failed to check the host key against %s: %w", ErrAuth, r.knownHosts, err)
+		case first:
+			util.LogInfo("first connection to %s — its key %s is now trusted; later connections must present the same key",
+				r.hostName, identity.Fingerprint(pub))
+		case pub != nil:
+			util.LogDebug("host key %s matches %s", identity.Fingerprint(pub), r.knownHosts)
+		}
+	}
+
+	r.mu.Lock()
+	r.peerKey, r.peerChallenge = pub, hello.Challenge
+	r.mu.Unlock()
+	if pub != nil && r.onPeerKey != nil {
+		r.onPeerKey(pub)
+	}
+
+	if hello.Challenge == "" {
+		return nil
+	}
+	if r.key == nil {
+		return fmt.Errorf("%w: the host requires key authentication, but no identity key is loaded (see -identity)", ErrAuth)
+	}
+	pubText := identity.MarshalPublicKey(r.key.Public().(ed25519.PublicKey))
+	util.LogDebug("authenticating as %s", pubText)
+
+	r.wsMu.Lock()
+	defer r.wsMu.Unlock()
+	return r.codec.writeJSON(r.conn, message{
+		Type:      msgTypeAuth,
+		PublicKey: pubText,
+		Signature: signChallenge(r.key, roleClient, hello.Challenge),
+	})
+}
+
+// checkClient verifies the client's answer to the host's challenge. An
+// unauthorized client is told so in the WebSocket close frame.
+func (r *receiver) checkClient(auth message) error {
+	if r.authorized == nil {
+		return nil
+	}
+	select {
+	case <-r.authed:
+		return nil // already authenticated
+	default:
+	}
+
+	pub, err := verifyChallenge(auth.PublicKey, roleClient, r.challenge, auth.Signature)
+	if err != nil {
+		r.refuse("invalid key signature")
+		return fmt.Errorf("%w: client: %w", ErrAuth, err)
+	}
+
+	key, ok := r.authorized.Lookup(pub)
+	if !ok {
+		r.refuse("key not authorized")
+		util.LogWarning("refused client key %s — to authorize it, add this line to the authorized keys file:\n  %s",
+			identity.Fingerprint(pub), identity.MarshalPublicKey(pub))
+		return fmt.Errorf("%w: client key %s is not authorized", ErrAuth, identity.Fingerprint(pub))
+	}
+
+	util.LogInfo("client authenticated as %s (%s)", key.Name(), identity.Fingerprint(pub))
+	r.mu.Lock()
+	r.peerKey = pub
+	r.mu.Unlock()
+	if r.onAuth != nil {
+		r.onAuth(key)
+	}
+	if r.onPeerKey != nil {
+		r.onPeerKey(pub)
+	}
+	close(r.authed)
+	return nil
+}
+
+// refuse closes the WebSocket with a policy violation stating reason.
+func (r *receiver) refuse(reason string) {
+	r.wsMu.Lock()
+	defer r.wsMu.Unlock()
+	r.conn.WriteMessage(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason))
+}
@@ -0,0 +1,188 @@
+package signaling
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrReplay is wrapped (together with ErrSignaling) when a signaling message
+// belongs to another session or arrives out of order, as a captured message
+// replayed against a persistent host would.
+var ErrReplay = errors.New("stale or replayed signaling message")
+
+// Every message on the WebSocket is numbered from 1 in each direction and
+// carries the session nonce, a random value the host picks for each
+// connection. The client learns it from the host's first message and echoes
+// it in all but its own first one, which goes out before it has heard from
+// the host. A message from an earlier session, or one repeated, dropped or
+// reordered within this one, is refused, so a replayed answer fails on its
+// first message instead of holding the host's single client slot. With a
+// PIN, messages are also sealed and the numbers double as GCM nonces.
+//
+// The nonce itself is only authenticated where something else is: with a PIN
+// it is part of the PAKE transcript (see deriveKeys), and with keys of the
+// signed SDP transcript (see sdpTranscript). Without either, whoever relays
+// the signaling can rewrite it along with the rest of the messages, so plain
+// signaling only refuses replays by someone who cannot also tamper with the
+// live session.
+//
+//	{"type":"offer","sdp":…,"seq":3,"nonce":…}
+//	{"type":"sealed","sealed":…}             (with a PIN; seq and nonce inside)
+
+const nonceSize = 16 // random bytes in a session nonce
+
+// codec reads and writes the signaling messages of one WebSocket connection
+// (private). Callers serialize writes, as for the connection itself; reads
+// happen on a single goroutine.
+type codec struct {
+	host bool
+
+	mu    sync.Mutex
+	nonce string // the session nonce ("" = not yet learned by the client)
+
+	sendSeq, recvSeq uint64      // numbers of the last messages written and read
+	send, recv       cipher.AEAD // PIN keys for each direction (nil = plaintext)
+
+	// onQueued, if set, is called on the client with its place in the
+	// host's queue, and with 0 once its turn has come.
+	onQueued func(position int)
+}
+
+// newHostCodec returns the codec of a host's connection, with a fresh nonce.
+func newHostCodec() (*codec, error) {
+	b := make([]byte, nonceSize)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to create nonce: %w", err)
+	}
+	return &codec{host: true, nonce: base64.RawURLEncoding.EncodeToString(b)}, nil
+}
+
+// newClientCodec returns the codec of a client's connection.
+func newClientCodec() *codec {
+	return &codec{}
+}
+
+// seal makes c encrypt the messages it writes with sendKey and open the ones
+// it reads with recvKey.
+func (c *codec) seal(sendKey, recvKey []byte) error {
+	send, err := newGCM(sendKey)
+	if err != nil {
+		return err
+	}
+	recv, err := newGCM(recvKey)
+	if err != nil {
+		return err
+	}
+	c.send, c.recv = send, recv
+	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// gcmNonce returns the GCM nonce of message number seq.
+func gcmNonce(seq uint64) []byte {
+	return binary.BigEndian.AppendUint64(make([]byte, 4, 12), seq)
+}
+
+// sessionNonce returns the session nonce, "" until the client learns it.
+func (c *codec) sessionNonce() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nonce
+}
+
+// writeJSON numbers msg, stamps it with the session nonce and writes it to
+// conn, sealed if c has PIN keys.
+func (c *codec) writeJSON(conn sigConn, msg message) error {
+	c.sendSeq++
+	msg.Seq = c.sendSeq
+	msg.Nonce = c.sessionNonce()
+	if c.send == nil {
+		return conn.WriteJSON(msg)
+	}
+
+	plain, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	sealed := c.send.Seal(nil, gcmNonce(msg.Seq), plain, nil)
+	return conn.WriteJSON(message{Type: msgTypeSealed, Sealed: base64.StdEncoding.EncodeToString(sealed)})
+}
+
+// readJSON reads the next message from conn into msg, opening it if c has
+// PIN keys, and checks its number and nonce.
+func (c *codec) readJSON(conn sigConn, msg *message) error {
+	if c.recv == nil {
+		for {
+			*msg = message{}
+			if err := conn.ReadJSON(msg); err != nil {
+				return err
+			}
+			// The host's queue speaks before the session starts.
+			if msg.Type != msgTypeQueued || c.host || c.recvSeq > 0 || msg.Seq != 0 {
+				return c.check(*msg)
+			}
+			if c.onQueued != nil {
+				c.onQueued(msg.Position)
+			}
+		}
+	}
+
+	var env message
+	if err := conn.ReadJSON(&env); err != nil {
+		return err
+	}
+	if env.Type != msgTypeSealed {
+		return fmt.Errorf("unsealed %q message", env.Type)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(env.Sealed)
+	if err != nil {
+		return err
+	}
+	plain, err := c.recv.Open(nil, gcmNonce(c.recvSeq+1), sealed, nil)
+	if err != nil {
+		return fmt.Errorf("%w: a sealed message was altered, replayed or reordered", ErrReplay)
+	}
+	if err := json.Unmarshal(plain, msg); err != nil {
+		return err
+	}
+	return c.check(*msg)
+}
+
+// check verifies that msg is the next message of this session.
+func (c *codec) check(msg message) error {
+	switch {
+	case msg.Seq == 0:
+		return fmt.Errorf("%w: unnumbered %q message; the peer is too old for this version", ErrReplay, msg.Type)
+	case msg.Seq != c.recvSeq+1:
+		return fmt.Errorf("%w: %q message %d, expected %d", ErrReplay, msg.Type, msg.Seq, c.recvSeq+1)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case c.host && msg.Seq == 1 && msg.Nonce == "":
+		// The client's first message goes out before it has heard from us.
+	case msg.Nonce == "":
+		return fmt.Errorf("%w: %q message without the session nonce", ErrReplay, msg.Type)
+	case c.nonce == "":
+		c.nonce = msg.Nonce
+	case msg.Nonce != c.nonce:
+		return fmt.Errorf("%w: %q message from another session", ErrReplay, msg.Type)
+	}
+	c.recvSeq = msg.Seq
+	return nil
+}
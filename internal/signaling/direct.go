@@ -0,0 +1,304 @@
+package signaling
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/1ureka/roj1/internal/transport"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// Direct transport: besides WebRTC, the host may listen on a TCP port, a UDP
+// port for QUIC (see quic.go), or both, and offer them to the client over the
+// signaling channel. The connection is TLS-protected with a throwaway
+// self-signed certificate whose fingerprint is pinned by the client, and the
+// client authenticates with a one-time token. Both are exchanged over the
+// (already trusted) signaling channel.
+
+const (
+	directDialTimeout = 2 * time.Second // bound on dialing the host's addresses
+	directAuthTimeout = 5 * time.Second // bound on the TLS handshake and token check
+	directTokenSize   = 16              // random bytes in the session token
+)
+
+// directListener is the host-side listener for the direct transport (private).
+type directListener struct {
+	listener    net.Listener   // TLS over TCP (nil without opts.Direct)
+	quic        *quic.Listener // QUIC over UDP (nil without opts.QUIC)
+	public      string         // QUIC address offered besides the local ones ("" = none)
+	token       string
+	fingerprint string
+}
+
+// listenDirect starts the direct listeners opts asks for: TLS on a random TCP
+// port of all interfaces with opts.Direct, and QUIC on UDP port opts.QUICPort
+// of all interfaces with opts.QUIC.
+func listenDirect(opts Options) (*directListener, error) {
+	cert, fingerprint, err := selfSignedCert()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	token := make([]byte, directTokenSize)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("failed to create token: %w", err)
+	}
+
+	d := &directListener{
+		public:      opts.QUICPublic,
+		token:       hex.EncodeToString(token),
+		fingerprint: fingerprint,
+	}
+	if opts.Direct {
+		d.listener, err = tls.Listen("tcp", ":0", &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS13,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to start direct listener: %w", err)
+		}
+	}
+	if opts.QUIC {
+		if d.quic, err = listenQUIC(cert, opts.QUICPort); err != nil {
+			d.close()
+			return nil, fmt.Errorf("failed to start QUIC listener: %w", err)
+		}
+	}
+	return d, nil
+}
+
+// close closes the listeners.
+func (d *directListener) close() {
+	if d.listener != nil {
+		d.listener.Close()
+	}
+	if d.quic != nil {
+		d.quic.Close()
+	}
+}
+
+// offer builds the direct offer message advertising every usable local
+// address of each listener.
+func (d *directListener) offer() message {
+	msg := message{
+		Type:        msgTypeDirect,
+		Token:       d.token,
+		Fingerprint: d.fingerprint,
+	}
+	if d.listener != nil {
+		msg.Addrs = localAddrs(d.listener.Addr().(*net.TCPAddr).Port)
+	}
+	if d.quic != nil {
+		msg.QUIC = localAddrs(d.quic.Addr().(*net.UDPAddr).Port)
+		if d.public != "" {
+			msg.QUIC = append(msg.QUIC, d.public)
+		}
+	}
+	return msg
+}
+
+// accept waits for the client to dial in and present the session token,
+// returning the resulting StreamTransport (bound to ctx) as a candidate. It
+// gives up once raceCtx is done or the signaling connection has closed.
+func (d *directListener) accept(raceCtx, ctx context.Context, r *receiver) candidate {
+	go func() {
+		select {
+		case <-raceCtx.Done():
+		case <-r.done:
+		}
+		d.listener.Close()
+	}()
+
+	for {
+		conn, err := d.listener.Accept()
+		if err != nil {
+			return candidate{name: directName, err: fmt.Errorf("%w: %w", ErrNegotiation, err)}
+		}
+
+		if err := d.verify(conn); err != nil {
+			util.LogDebug("rejected direct connection from %s: %v", conn.RemoteAddr(), err)
+			conn.Close()
+			continue
+		}
+
+		util.LogDebug("direct connection accepted from %s", conn.RemoteAddr())
+		return candidate{name: directName, tr: transport.NewStreamTransport(ctx, conn)}
+	}
+}
+
+// verify completes the TLS handshake and checks the client's session token.
+func (d *directListener) verify(conn net.Conn) error {
+	conn.SetDeadline(time.Now().Add(directAuthTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	buf := make([]byte, len(d.token))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(buf, []byte(d.token)) != 1 {
+		return errors.New("invalid token")
+	}
+	return nil
+}
+
+// directOffer waits for the host's direct offer. It returns an empty message
+// if the host offered no direct transport.
+func directOffer(raceCtx context.Context, r *receiver) message {
+	select {
+	case msg := <-r.direct:
+		return msg
+	case <-r.done:
+	case <-raceCtx.Done():
+	}
+	return message{}
+}
+
+// dialDirect dials the TLS addresses of the host's direct offer msg,
+// returning the resulting StreamTransport (bound to ctx) as a candidate. It
+// returns an empty candidate if msg offers none.
+func dialDirect(raceCtx, ctx context.Context, msg message) candidate {
+	if len(msg.Addrs) == 0 {
+		return candidate{}
+	}
+
+	conn, err := dialAny(raceCtx, msg)
+	if err != nil {
+		return candidate{name: directName, err: fmt.Errorf("%w: %w", ErrNegotiation, err)}
+	}
+
+	util.LogDebug("direct connection established to %s", conn.RemoteAddr())
+	return candidate{name: directName, tr: transport.NewStreamTransport(ctx, conn)}
+}
+
+// dialAny dials all offered addresses concurrently and keeps the first one
+// that completes the TLS handshake with the pinned certificate and accepts
+// the token.
+func dialAny(ctx context.Context, msg message) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, directDialTimeout)
+	defer cancel()
+
+	dialer := &tls.Dialer{Config: &tls.Config{
+		// The certificate is self-signed; it is verified by fingerprint instead.
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: pinnedCert(msg.Fingerprint),
+		MinVersion:            tls.VersionTLS13,
+	}}
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result, len(msg.Addrs))
+
+	for _, addr := range msg.Addrs {
+		go func() {
+			conn, err := dialer.DialContext(ctx, "tcp", addr)
+			if err == nil {
+				conn.SetWriteDeadline(time.Now().Add(directAuthTimeout))
+				_, err = io.WriteString(conn, msg.Token)
+				conn.SetWriteDeadline(time.Time{})
+				if err != nil {
+					conn.Close()
+				}
+			}
+			results <- result{conn, err}
+		}()
+	}
+
+	var conn net.Conn
+	var lastErr error
+	for range msg.Addrs {
+		res := <-results
+		switch {
+		case res.err != nil:
+			lastErr = res.err
+		case conn == nil:
+			conn = res.conn
+			cancel() // abort the remaining attempts
+		default:
+			res.conn.Close()
+		}
+	}
+
+	if conn == nil {
+		return nil, lastErr
+	}
+	return conn, nil
+}
+
+// pinnedCert returns a VerifyPeerCertificate callback accepting only the
+// certificate with the given hex-encoded SHA-256 fingerprint.
+func pinnedCert(fingerprint string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("no certificate presented")
+		}
+		sum := sha256.Sum256(rawCerts[0])
+		if subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(fingerprint)) != 1 {
+			return errors.New("certificate fingerprint mismatch")
+		}
+		return nil
+	}
+}
+
+// selfSignedCert creates a short-lived ECDSA certificate for one session and
+// returns it with its hex-encoded SHA-256 fingerprint.
+func selfSignedCert() (tls.Certificate, string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, "", err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, "", err
+	}
+
+	sum := sha256.Sum256(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, hex.EncodeToString(sum[:]), nil
+}
+
+// localAddrs returns host:port for every non-loopback, non-link-local unicast
+// address of this machine.
+func localAddrs(port int) []string {
+	ifaceAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		util.LogDebug("failed to list interface addresses: %v", err)
+		return nil
+	}
+
+	var addrs []string
+	for _, a := range ifaceAddrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip := ipNet.IP
+		if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsMulticast() || ip.IsUnspecified() {
+			continue
+		}
+		addrs = append(addrs, net.JoinHostPort(ip.String(), fmt.Sprint(port)))
+	}
+	return addrs
+}
@@ -0,0 +1,422 @@
+package signaling
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dropInterval = 2 * time.Second // how often the peer's file is read, within API rate limits
+	dropRetries  = 3               // failed reads in a row before giving up
+	gistAPI      = "https://api.github.com"
+)
+
+// DropConfig names the dead drop a DropSignaler exchanges files through and
+// the credentials to reach it.
+type DropConfig struct {
+	// URL is gist://<id> for a GitHub gist, or s3://<bucket>/<prefix> for
+	// objects in an S3 bucket.
+	URL string
+
+	// Token is a GitHub token allowed to edit the gist.
+	Token string
+
+	// AccessKey, SecretKey and SessionToken are the AWS credentials for the
+	// bucket, in Region (default: us-east-1).
+	AccessKey, SecretKey, SessionToken, Region string
+
+	// Endpoint replaces the provider's API: the GitHub API for gists, or an
+	// S3-compatible service addressed path-style for buckets.
+	Endpoint string
+
+	// Interval is how often the peer's file is read (default: 2s).
+	Interval time.Duration
+}
+
+// dropStore is where a DropSignaler keeps its files.
+type dropStore interface {
+	// get returns the named file, or nil if there is none.
+	get(ctx context.Context, name string) ([]byte, error)
+
+	// put replaces the named file.
+	put(ctx context.Context, name string, data []byte) error
+}
+
+// dropFile is what each side of a dead drop writes: its session, the peer's
+// once known, and every message it sent so far.
+type dropFile struct {
+	Session  string   `json:"session"`
+	Peer     string   `json:"peer,omitempty"`
+	Messages []string `json:"messages,omitempty"`
+}
+
+// DropSignaler is a Signaler exchanging messages through two files in a dead
+// drop both sides can reach over HTTPS, a gist or an S3 bucket, for networks
+// that let nothing else out: each side rewrites its own file with every
+// message it sends and polls the other's. The host announces a new session in
+// its file; a client answers it with its own, and the host confirms the
+// client it takes. Files left by earlier sessions name other sessions and are
+// ignored. A drop carries one exchange at a time.
+//
+// Whoever can read the drop sees the session descriptions; use a PIN.
+type DropSignaler struct {
+	store    dropStore
+	name     string // this side's file
+	peerName string // the peer's file
+	host     bool
+	interval time.Duration
+
+	mu   sync.Mutex // guards mine and serializes writes, keeping them in order
+	mine dropFile
+
+	peer     string // the peer's session, set before joined is closed
+	read     int    // messages of the peer's file received so far
+	answered string // client: the host session last answered
+
+	in     chan []byte   // the peer's messages, not yet received
+	joined chan struct{} // closed once paired with a peer
+	done   chan struct{} // closed when polling fails or the signaler is closed
+	fail   sync.Once
+	err    error // why done was closed
+	cancel context.CancelFunc
+}
+
+// ValidDropURL reports why raw is not a dead drop DialDrop accepts, or nil.
+func ValidDropURL(raw string) error {
+	_, err := parseDropURL(raw)
+	return err
+}
+
+// parseDropURL checks a drop URL.
+func parseDropURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "gist":
+		if u.Host == "" || strings.Trim(u.Path, "/") != "" {
+			return nil, fmt.Errorf("%s does not name a gist, e.g. gist://aa5a315d61ae9438b18d", raw)
+		}
+	case "s3":
+		if u.Host == "" {
+			return nil, fmt.Errorf("%s names no bucket, e.g. s3://my-bucket/roj1/kiosk", raw)
+		}
+	default:
+		return nil, fmt.Errorf("%s is not a gist:// or s3:// URL", raw)
+	}
+	return u, nil
+}
+
+// DialDrop checks that the drop at cfg.URL can be reached and takes the host
+// or the client side of the exchange in it. ctx bounds the dial only.
+func DialDrop(ctx context.Context, cfg DropConfig, host bool) (*DropSignaler, error) {
+	u, err := parseDropURL(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	s := &DropSignaler{
+		name:     "roj1-client.json",
+		peerName: "roj1-host.json",
+		host:     host,
+		interval: cfg.Interval,
+		mine:     dropFile{Session: hex.EncodeToString(id)},
+		in:       make(chan []byte, 64),
+		joined:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if host {
+		s.name, s.peerName = s.peerName, s.name
+	}
+	if s.interval <= 0 {
+		s.interval = dropInterval
+	}
+	if u.Scheme == "gist" {
+		api := cfg.Endpoint
+		if api == "" {
+			api = gistAPI
+		}
+		s.store = &gistStore{client: &http.Client{}, api: strings.TrimSuffix(api, "/"), id: u.Host, token: cfg.Token}
+	} else {
+		s.store = newS3Store(u, cfg)
+	}
+
+	// Reading the peer's file proves the credentials; the host announces its
+	// session right away, the client once it sees one.
+	if _, err := s.store.get(ctx, s.peerName); err != nil {
+		return nil, fmt.Errorf("failed to read dead drop %s: %w", cfg.URL, err)
+	}
+	if host {
+		if err := s.write(ctx); err != nil {
+			return nil, fmt.Errorf("failed to write dead drop %s: %w", cfg.URL, err)
+		}
+	}
+
+	pollCtx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go s.poll(pollCtx)
+	return s, nil
+}
+
+// write stores this side's file.
+func (s *DropSignaler) write(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := json.Marshal(s.mine)
+	if err != nil {
+		return err
+	}
+	return s.store.put(ctx, s.name, data)
+}
+
+// poll reads the peer's file until ctx is cancelled or reading keeps failing.
+func (s *DropSignaler) poll(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	failures := 0
+	for {
+		data, err := s.store.get(ctx, s.peerName)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			if failures++; failures == dropRetries {
+				s.close(fmt.Errorf("failed to read the dead drop: %w", err))
+				return
+			}
+		default:
+			failures = 0
+			var f dropFile
+			if data != nil && json.Unmarshal(data, &f) == nil {
+				s.receive(ctx, f)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// receive handles the peer's file as last read.
+func (s *DropSignaler) receive(ctx context.Context, f dropFile) {
+	select {
+	case <-s.joined:
+	default:
+		switch {
+		case f.Session == "":
+			return
+		case s.host && f.Peer == s.mine.Session:
+			// A client answered this session: take it, and confirm.
+			s.pair(f.Session)
+			s.mu.Lock()
+			s.mine.Peer = f.Session
+			s.mu.Unlock()
+			s.write(ctx)
+		case !s.host && f.Peer == s.mine.Session:
+			s.pair(f.Session) // the host confirmed this client
+		case !s.host && f.Peer == "" && f.Session != s.answered:
+			s.answered = f.Session
+			s.mu.Lock()
+			s.mine.Peer = f.Session
+			s.mu.Unlock()
+			s.write(ctx)
+			return
+		default:
+			return
+		}
+	}
+
+	if f.Session != s.peer {
+		return // a session this side is not part of
+	}
+	for ; s.read < len(f.Messages); s.read++ {
+		select {
+		case s.in <- []byte(f.Messages[s.read]):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// pair takes the session peer as the peer.
+func (s *DropSignaler) pair(peer string) {
+	s.peer = peer
+	close(s.joined)
+}
+
+// send adds msg to this side's file once paired with a peer.
+func (s *DropSignaler) send(ctx context.Context, msg []byte) error {
+	select {
+	case <-s.joined:
+	case <-s.done:
+		return s.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	s.mu.Lock()
+	s.mine.Messages = append(s.mine.Messages, string(msg))
+	s.mu.Unlock()
+	return s.write(ctx)
+}
+
+// SendOffer writes an offer for the client.
+func (s *DropSignaler) SendOffer(ctx context.Context, msg []byte) error {
+	return s.send(ctx, msg)
+}
+
+// SendAnswer writes an answer for the host.
+func (s *DropSignaler) SendAnswer(ctx context.Context, msg []byte) error {
+	return s.send(ctx, msg)
+}
+
+// SendCandidate writes an ICE candidate for the peer.
+func (s *DropSignaler) SendCandidate(ctx context.Context, msg []byte) error {
+	return s.send(ctx, msg)
+}
+
+// Send writes any other message for the peer.
+func (s *DropSignaler) Send(ctx context.Context, msg []byte) error {
+	return s.send(ctx, msg)
+}
+
+// Recv returns the peer's next message.
+func (s *DropSignaler) Recv(ctx context.Context) ([]byte, error) {
+	select {
+	case msg := <-s.in: // what was read before polling ended is still received
+		return msg, nil
+	default:
+	}
+	select {
+	case msg := <-s.in:
+		return msg, nil
+	case <-s.done:
+		return nil, s.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops polling. The files stay in the drop.
+func (s *DropSignaler) Close() error {
+	s.close(net.ErrClosed)
+	return nil
+}
+
+// close stops polling, reporting err to pending calls.
+func (s *DropSignaler) close(err error) {
+	s.fail.Do(func() {
+		s.err = err
+		close(s.done)
+		s.cancel()
+	})
+}
+
+// gistStore keeps the files of a dead drop in a GitHub gist.
+type gistStore struct {
+	client *http.Client
+	api    string
+	id     string
+	token  string
+}
+
+// gistFile is a file of a gist in the GitHub API.
+type gistFile struct {
+	Content   string `json:"content"`
+	Truncated bool   `json:"truncated,omitempty"`
+	RawURL    string `json:"raw_url,omitempty"`
+}
+
+func (g *gistStore) get(ctx context.Context, name string) ([]byte, error) {
+	var gist struct {
+		Files map[string]gistFile `json:"files"`
+	}
+	if err := g.do(ctx, http.MethodGet, g.api+"/gists/"+url.PathEscape(g.id), nil, &gist); err != nil {
+		return nil, err
+	}
+	f, ok := gist.Files[name]
+	switch {
+	case !ok:
+		return nil, nil
+	case !f.Truncated:
+		return []byte(f.Content), nil
+	}
+
+	// Large files are only listed in part.
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.RawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub: %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, matrixReadLimit))
+}
+
+func (g *gistStore) put(ctx context.Context, name string, data []byte) error {
+	body := map[string]any{"files": map[string]gistFile{name: {Content: string(data)}}}
+	return g.do(ctx, http.MethodPatch, g.api+"/gists/"+url.PathEscape(g.id), body, nil)
+}
+
+// do calls the GitHub API.
+func (g *gistStore) do(ctx context.Context, method, target string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+g.token)
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, matrixReadLimit))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &e) != nil || e.Message == "" {
+			e.Message = resp.Status
+		}
+		return fmt.Errorf("GitHub: %s", e.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
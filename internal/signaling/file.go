@@ -0,0 +1,300 @@
+package signaling
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+
+	"github.com/1ureka/roj1/internal/transport"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// Offer files carry the whole signaling exchange when the peers share no
+// signaling channel: the host writes an offer with every ICE candidate
+// gathered, the offer is carried to the client by any means (e-mail, USB
+// stick), and the client's answer is carried back the same way. Only the
+// tunnel itself needs a network path between the peers. The files hold a
+// single message each; the answer echoes the offer's Token, so a stale
+// answer from an earlier offer is not mistaken for the current one.
+
+// answerPollInterval is how often the host looks for the answer file.
+const answerPollInterval = 500 * time.Millisecond
+
+// writeBundle writes msg to path, through a temporary file so a peer polling
+// for it never reads it half-written.
+func writeBundle(path string, msg message) error {
+	data, err := json.MarshalIndent(msg, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readBundle reads a message of the given type from path.
+func readBundle(path string, typ messageType) (message, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return message{}, err
+	}
+	var msg message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return message{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if msg.Type != typ || msg.SDP == "" {
+		return message{}, fmt.Errorf("%s is not a roj1 %s file", path, typ)
+	}
+	return msg, nil
+}
+
+// awaitOpen waits for tr's DataChannel to open. The Transport is closed if it
+// does not.
+func awaitOpen(ctx context.Context, tr *transport.Transport) error {
+	select {
+	case <-tr.Ready():
+		return nil
+	case <-tr.Done():
+		tr.Close()
+		return fmt.Errorf("%w: %w", ErrNegotiation, tr.Err())
+	case <-ctx.Done():
+		tr.Close()
+		return gaveUp(ctx, tr)
+	}
+}
+
+// EstablishAsHostByFile establishes a tunnel through offer files instead of
+// a WS server:
+//  1. Create a Transport and gather all of its ICE candidates
+//  2. Write the offer to offerPath
+//  3. Wait for the client's answer to appear at answerPath
+//  4. Apply it and wait for the DataChannel to open
+//
+// A single WebRTC path is offered; opts.Direct, opts.Interfaces and peer
+// authentication need a live signaling channel and are not supported. The
+// whole flow, including the time the files are in transit, is bounded by
+// opts.Timeout; cancelling ctx early closes the Transport and returns
+// ErrCancelled.
+func EstablishAsHostByFile(ctx context.Context, offerPath, answerPath string, opts Options) (_ transport.Carrier, err error) {
+	estCtx, cancel := withTimeout(ctx, opts.Timeout)
+	defer cancel()
+	defer func() { err = cancelled(ctx, err) }()
+
+	start := time.Now()
+	util.NotifyState(util.StateSignaling)
+
+	// 1. Create the Transport and gather candidates.
+	spinner := util.StartSpinner(util.Tr("gathering ICE candidates for the offer file..."))
+
+	tr, err := transport.NewTransportWith(ctx, transportConfig(opts, ""))
+	if err != nil {
+		spinner.Fail(util.Tr("failed to create Transport"))
+		return nil, fmt.Errorf("%w: %w", ErrNegotiation, err)
+	}
+	desc, err := gatheredOffer(estCtx, tr)
+	if err != nil {
+		tr.Close()
+		spinner.Fail(util.Tr("failed to create the offer"))
+		return nil, err
+	}
+	token, err := newChallenge()
+	if err != nil {
+		tr.Close()
+		spinner.Fail(util.Tr("failed to create the offer"))
+		return nil, fmt.Errorf("%w: %w", ErrSignaling, err)
+	}
+
+	// 2. Write the offer. An answer left over from an earlier offer would
+	// not match its token anyway.
+	if err := writeBundle(offerPath, message{
+		Type: msgTypeOffer, SDP: desc.SDP, Version: opts.Version, Token: token,
+	}); err != nil {
+		tr.Close()
+		spinner.Fail(util.Tr("failed to write the offer file"))
+		return nil, fmt.Errorf("%w: %w", ErrSignaling, err)
+	}
+	spinner.Stop()
+	util.LogSuccess("offer written to %s — send it to your peer, and put the answer they send back at %s", offerPath, answerPath)
+
+	// 3. Wait for the answer.
+	spinner = util.StartSpinner(util.Trf("waiting for the answer file at %s...", answerPath))
+
+	answer, err := awaitAnswer(estCtx, answerPath, token)
+	if err != nil {
+		tr.Close()
+		spinner.Fail(util.Tr("failed while waiting for the answer file"))
+		return nil, err
+	}
+
+	// 4. Apply it.
+	util.NotifyState(util.StateConnecting)
+	spinner.UpdateText(util.Tr("answer received — connecting..."))
+	if err := checkVersion(opts.Version, answer.Version, opts.StrictVersion); err != nil {
+		tr.Close()
+		spinner.Fail(util.Tr("incompatible peer version"))
+		return nil, fmt.Errorf("%w: %w", ErrSignaling, err)
+	}
+	stopICE := followICE(spinner)
+	if err := tr.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: answer.SDP}); err != nil {
+		stopICE()
+		tr.Close()
+		spinner.Fail(util.Tr("tunnel negotiation failed"))
+		return nil, fmt.Errorf("%w: %w", ErrNegotiation, err)
+	}
+	err = awaitOpen(estCtx, tr)
+	stopICE()
+	if err != nil {
+		spinner.Fail(util.Tr("tunnel negotiation failed"))
+		return nil, err
+	}
+
+	spinner.Success(util.Trf("tunnel established via %s", webrtcName))
+	util.EmitPhase(util.PhaseEstablish, start)
+	util.NotifyState(util.StateEstablished)
+	return tr, nil
+}
+
+// gatheredOffer sets an offer as tr's local description and returns it with
+// every ICE candidate.
+func gatheredOffer(ctx context.Context, tr *transport.Transport) (webrtc.SessionDescription, error) {
+	offer, err := tr.CreateOffer()
+	if err == nil {
+		err = tr.SetLocalDescription(offer)
+	}
+	if err != nil {
+		return offer, fmt.Errorf("%w: %w", ErrNegotiation, err)
+	}
+	desc, err := tr.GatheredDescription(ctx)
+	if err != nil && ctx.Err() == nil {
+		err = fmt.Errorf("%w: %w", ErrNegotiation, err)
+	}
+	return desc, err
+}
+
+// awaitAnswer polls answerPath until it holds the answer to the offer with
+// the given token.
+func awaitAnswer(ctx context.Context, answerPath, token string) (message, error) {
+	ticker := time.NewTicker(answerPollInterval)
+	defer ticker.Stop()
+
+	var stale error // reported once per distinct problem
+	for {
+		answer, err := readBundle(answerPath, msgTypeAnswer)
+		switch {
+		case err == nil && answer.Token == token:
+			return answer, nil
+		case err == nil:
+			err = fmt.Errorf("%s answers an earlier offer", answerPath)
+		case errors.Is(err, os.ErrNotExist):
+			err = nil
+		}
+		if err != nil && (stale == nil || err.Error() != stale.Error()) {
+			util.LogWarning("ignoring the answer file: %v", err)
+		}
+		stale = err
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return message{}, context.Cause(ctx)
+		}
+	}
+}
+
+// EstablishAsClientByFile establishes a tunnel with the host's offer file
+// (see EstablishAsHostByFile):
+//  1. Read the offer from offerPath
+//  2. Create a Transport, answer the offer and gather all ICE candidates
+//  3. Write the answer to answerPath, for the host
+//  4. Wait for the DataChannel to open, once the host has the answer
+//
+// The whole flow is bounded by opts.Timeout; cancelling ctx early closes the
+// Transport and returns ErrCancelled.
+func EstablishAsClientByFile(ctx context.Context, offerPath, answerPath string, opts Options) (_ transport.Carrier, err error) {
+	estCtx, cancel := withTimeout(ctx, opts.Timeout)
+	defer cancel()
+	defer func() { err = cancelled(ctx, err) }()
+
+	start := time.Now()
+	util.NotifyState(util.StateSignaling)
+
+	// 1. Read the offer.
+	offer, err := readBundle(offerPath, msgTypeOffer)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSignaling, err)
+	}
+	if err := checkVersion(opts.Version, offer.Version, opts.StrictVersion); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSignaling, err)
+	}
+
+	// 2. Answer it.
+	spinner := util.StartSpinner(util.Tr("gathering ICE candidates for the answer file..."))
+
+	tr, err := transport.NewTransportWith(ctx, transportConfig(opts, ""))
+	if err != nil {
+		spinner.Fail(util.Tr("failed to create Transport"))
+		return nil, fmt.Errorf("%w: %w", ErrNegotiation, err)
+	}
+	desc, err := gatheredAnswer(estCtx, tr, offer.SDP)
+	if err != nil {
+		tr.Close()
+		spinner.Fail(util.Tr("failed to create the answer"))
+		return nil, err
+	}
+
+	// 3. Write the answer.
+	if err := writeBundle(answerPath, message{
+		Type: msgTypeAnswer, SDP: desc.SDP, Version: opts.Version, Token: offer.Token,
+	}); err != nil {
+		tr.Close()
+		spinner.Fail(util.Tr("failed to write the answer file"))
+		return nil, fmt.Errorf("%w: %w", ErrSignaling, err)
+	}
+	spinner.Stop()
+	util.LogSuccess("answer written to %s — send it back to your peer", answerPath)
+
+	// 4. Wait for the host to apply it.
+	util.NotifyState(util.StateConnecting)
+	spinner = util.StartSpinner(util.Tr("waiting for the host to use the answer..."))
+
+	stopICE := followICE(spinner)
+	err = awaitOpen(estCtx, tr)
+	stopICE()
+	if err != nil {
+		spinner.Fail(util.Tr("tunnel negotiation failed"))
+		return nil, err
+	}
+
+	spinner.Success(util.Trf("tunnel established via %s", webrtcName))
+	util.EmitPhase(util.PhaseEstablish, start)
+	util.NotifyState(util.StateEstablished)
+	return tr, nil
+}
+
+// gatheredAnswer applies offer to tr, sets an answer as its local
+// description and returns it with every ICE candidate.
+func gatheredAnswer(ctx context.Context, tr *transport.Transport, offer string) (webrtc.SessionDescription, error) {
+	err := tr.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer})
+	var answer webrtc.SessionDescription
+	if err == nil {
+		answer, err = tr.CreateAnswer()
+	}
+	if err == nil {
+		err = tr.SetLocalDescription(answer)
+	}
+	if err != nil {
+		return answer, fmt.Errorf("%w: %w", ErrNegotiation, err)
+	}
+	desc, err := tr.GatheredDescription(ctx)
+	if err != nil && ctx.Err() == nil {
+		err = fmt.Errorf("%w: %w", ErrNegotiation, err)
+	}
+	return desc, err
+}
@@ -0,0 +1,902 @@
+package signaling
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/1ureka/roj1/internal/signaling/signalingpb"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// Systems that already speak gRPC can reach the host through a gRPC service
+// instead of the WebSocket server (see signalingpb/signaling.proto):
+//
+//	service Signaling {
+//	  rpc Connect(stream Message) returns (stream Message);
+//	  rpc Offer(OfferRequest) returns (stream SessionDescription);
+//	  rpc Answer(stream SessionDescription) returns (AnswerResponse);
+//	  rpc Candidate(stream IceCandidate) returns (stream IceCandidate);
+//	}
+//
+// A session is a signaling connection like a WebSocket. Connect opens it and
+// carries its messages but offers, answers and candidates, which go through
+// the calls named after them. Each message is numbered across the four calls,
+// so that the receiving side reads them in the order they were written, as
+// from a WebSocket. With a PIN, messages are sealed (see codec.go) and all of
+// them go through Connect. The host ends Connect with a status matching its
+// close frame, so that generic gRPC clients learn why they were refused. Calls
+// are served without TLS; put a TLS-terminating proxy in front for grpcs://
+// URLs.
+
+// grpcSessionKey is the metadata key naming a session, sent in the headers of
+// Connect and with the session's other calls.
+const grpcSessionKey = "roj1-session"
+
+const (
+	grpcQueueLen   = 64  // messages waiting for a call of the host to send them
+	grpcMaxPending = 256 // messages read ahead of their turn
+)
+
+// GRPCListener is a Listener serving the gRPC Signaling service instead of
+// WebSockets. Clients reach it at a grpc:// URL.
+type GRPCListener struct {
+	Listener
+}
+
+// ListenGRPC starts a GRPCListener on addr (see EstablishAsHost) with room
+// for up to queue waiting clients.
+func ListenGRPC(addr string, queue int) (*GRPCListener, error) {
+	srv := &server{connCh: make(chan sigConn, 1), queueLen: queue}
+	srv.grpc = &grpcService{srv: srv, sessions: make(map[string]*grpcConn)}
+	l, err := listen(srv, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &GRPCListener{*l}, nil
+}
+
+// grpcService is the Signaling service of a server (private).
+type grpcService struct {
+	signalingpb.UnimplementedSignalingServer
+
+	srv    *server
+	rpc    *grpc.Server
+	served chan struct{} // closed once rpc stopped serving
+
+	mu       sync.Mutex
+	sessions map[string]*grpcConn // open sessions by ID
+}
+
+// serve serves the Signaling service on listener until stop.
+func (g *grpcService) serve(listener net.Listener) {
+	g.rpc = grpc.NewServer(grpc.MaxRecvMsgSize(relayReadLimit))
+	signalingpb.RegisterSignalingServer(g.rpc, g)
+	g.served = make(chan struct{})
+	go func() {
+		defer close(g.served)
+		_ = g.rpc.Serve(listener)
+	}()
+}
+
+// stop gives the calls still running shutdownGrace to end, then ends them.
+func (g *grpcService) stop() {
+	if g.rpc == nil {
+		return
+	}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		g.rpc.GracefulStop()
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(shutdownGrace):
+		g.rpc.Stop()
+		<-stopped
+	}
+	<-g.served
+}
+
+// Connect opens a session and places it like a new WebSocket, before the
+// headers naming it are sent. The call lasts until either side closes the
+// session.
+func (g *grpcService) Connect(stream signalingpb.Signaling_ConnectServer) error {
+	c := newGRPCConn()
+	id := rand.Text()
+	g.mu.Lock()
+	g.sessions[id] = c
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		delete(g.sessions, id)
+		g.mu.Unlock()
+	}()
+
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		util.LogDebug("signaling over gRPC with %s", p.Addr)
+	}
+	go c.in.receive(func() (grpcFrame, error) {
+		m, err := stream.Recv()
+		switch {
+		case err == io.EOF:
+			err = &websocket.CloseError{Code: websocket.CloseAbnormalClosure, Text: io.ErrUnexpectedEOF.Error()}
+		case err != nil:
+			err = &websocket.CloseError{Code: websocket.CloseAbnormalClosure, Text: grpcError(err).Error()}
+		}
+		return messageFrame(m), err
+	}, true)
+	g.srv.place(c)
+	if err := stream.SendHeader(metadata.Pairs(grpcSessionKey, id)); err != nil {
+		c.lose()
+		return err
+	}
+
+	send(stream.Context(), c, c.connect, stream.Send)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+// Offer sends the session's offers until it closes.
+func (g *grpcService) Offer(_ *signalingpb.OfferRequest, stream signalingpb.Signaling_OfferServer) error {
+	c, err := g.join(stream.Context(), "Offer")
+	if err != nil {
+		return err
+	}
+	send(stream.Context(), c, c.offers, stream.Send)
+	return nil
+}
+
+// Answer reads the session's answers until it closes.
+func (g *grpcService) Answer(stream signalingpb.Signaling_AnswerServer) error {
+	c, err := g.join(stream.Context(), "Answer")
+	if err != nil {
+		return err
+	}
+	go c.in.receive(func() (grpcFrame, error) {
+		d, err := stream.Recv()
+		return descriptionFrame(d, msgTypeAnswer), err
+	}, false)
+
+	select {
+	case <-c.done:
+	case <-stream.Context().Done():
+		c.lose()
+	}
+	return stream.SendAndClose(&signalingpb.AnswerResponse{})
+}
+
+// Candidate reads and sends the session's candidates until it closes.
+func (g *grpcService) Candidate(stream signalingpb.Signaling_CandidateServer) error {
+	c, err := g.join(stream.Context(), "Candidate")
+	if err != nil {
+		return err
+	}
+	go c.in.receive(func() (grpcFrame, error) {
+		ic, err := stream.Recv()
+		return candidateFrame(ic), err
+	}, false)
+
+	send(stream.Context(), c, c.candidates, stream.Send)
+	return nil
+}
+
+// join returns the session named in the metadata of a call to method, which
+// a session takes once.
+func (g *grpcService) join(ctx context.Context, method string) (*grpcConn, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ids := md.Get(grpcSessionKey)
+	if len(ids) != 1 {
+		return nil, status.Errorf(codes.InvalidArgument, "%s takes the %s metadata from Connect", method, grpcSessionKey)
+	}
+	g.mu.Lock()
+	c := g.sessions[ids[0]]
+	g.mu.Unlock()
+	if c == nil {
+		return nil, status.Error(codes.NotFound, "no such session")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.joined[method] {
+		return nil, status.Errorf(codes.AlreadyExists, "the session already has an %s call", method)
+	}
+	c.joined[method] = true
+	return c, nil
+}
+
+// grpcConn is the host's end of a session (private). Each call's handler
+// sends the messages queued for it, so that none is sent once the call ended.
+type grpcConn struct {
+	in grpcInbox
+
+	connect    chan *signalingpb.Message
+	offers     chan *signalingpb.SessionDescription
+	candidates chan *signalingpb.IceCandidate
+
+	quit chan struct{} // closed first by Close, ending waits to queue a message
+	done chan struct{} // closed by Close once nothing more can be queued
+	once sync.Once
+	gone chan struct{} // closed once a call of the client ended, ending the session
+	lost sync.Once
+
+	mu       sync.Mutex // serializes writes, which number the messages
+	frames   uint64     // messages written
+	closed   bool
+	deadline time.Time       // of the writes that follow (zero = none)
+	status   error           // the Connect call's status, from the close frame written
+	joined   map[string]bool // calls of the session besides Connect
+}
+
+func newGRPCConn() *grpcConn {
+	c := &grpcConn{
+		connect:    make(chan *signalingpb.Message, grpcQueueLen),
+		offers:     make(chan *signalingpb.SessionDescription, grpcQueueLen),
+		candidates: make(chan *signalingpb.IceCandidate, grpcQueueLen),
+		quit:       make(chan struct{}),
+		done:       make(chan struct{}),
+		gone:       make(chan struct{}),
+		joined:     make(map[string]bool),
+	}
+	c.in = newGRPCInbox(c.quit, c.gone)
+	return c
+}
+
+// ReadJSON reads the client's next message. A session the client ends
+// without a close frame reads as an abnormal closure, as with a WebSocket.
+func (c *grpcConn) ReadJSON(v any) error {
+	return c.in.read(v)
+}
+
+// write numbers the next message and queues it with enqueue, unless c is
+// closed.
+func (c *grpcConn) write(enqueue func(frame uint64) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	if err := enqueue(c.frames + 1); err != nil {
+		return err
+	}
+	c.frames++
+	return nil
+}
+
+// WriteJSON sends v to the client, on the call for its kind.
+func (c *grpcConn) WriteJSON(v any) error {
+	msg, err := asMessage(v)
+	if err != nil {
+		return err
+	}
+	return c.write(func(frame uint64) error {
+		switch msg.Type {
+		case msgTypeOffer:
+			return queue(c, c.offers, descriptionProto(frame, msg))
+		case msgTypeCandidate:
+			ic, err := candidateProto(frame, msg)
+			if err != nil {
+				return err
+			}
+			return queue(c, c.candidates, ic)
+		default:
+			return queue(c, c.connect, messageProto(frame, msg))
+		}
+	})
+}
+
+// WriteMessage sends a close frame, which also sets the Connect call's
+// status; other messages are written as JSON text.
+func (c *grpcConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != websocket.CloseMessage {
+		return c.WriteJSON(json.RawMessage(data))
+	}
+	cl := closeFrame(data)
+	return c.write(func(frame uint64) error {
+		if err := queue(c, c.connect, closeProto(frame, cl)); err != nil {
+			return err
+		}
+		if code := grpcStatus(cl.Code); code != codes.OK {
+			c.status = status.Error(code, cl.Text)
+		}
+		return nil
+	})
+}
+
+// SetWriteDeadline bounds how long the writes that follow wait for their
+// call to take them.
+func (c *grpcConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	return nil
+}
+
+// lose ends the session for a client gone without a close frame. What it
+// sent before still reads, then an abnormal closure.
+func (c *grpcConn) lose() {
+	c.lost.Do(func() { close(c.gone) })
+}
+
+// Close ends the session; the messages already queued are still sent.
+func (c *grpcConn) Close() error {
+	c.once.Do(func() {
+		close(c.quit)
+		c.mu.Lock()
+		c.closed = true
+		c.mu.Unlock()
+		close(c.done)
+	})
+	return nil
+}
+
+// queue hands m to the handler of the call out belongs to. c.mu must be held.
+func queue[T any](c *grpcConn, out chan<- T, m T) error {
+	var expired <-chan time.Time
+	if !c.deadline.IsZero() {
+		t := time.NewTimer(time.Until(c.deadline))
+		defer t.Stop()
+		expired = t.C
+	}
+	select {
+	case out <- m:
+		return nil
+	case <-c.quit:
+		return net.ErrClosed
+	case <-c.gone:
+		return net.ErrClosed
+	case <-expired:
+		return os.ErrDeadlineExceeded
+	}
+}
+
+// send sends the messages queued on out until c is closed and they are all
+// sent, or the call ends, which loses the session.
+func send[T any](ctx context.Context, c *grpcConn, out <-chan T, sendMsg func(T) error) {
+	for {
+		select {
+		case m := <-out:
+			if sendMsg(m) != nil {
+				c.lose()
+				return
+			}
+		case <-ctx.Done():
+			c.lose()
+			return
+		case <-c.done:
+			for {
+				select {
+				case m := <-out:
+					if sendMsg(m) != nil {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// grpcStatus returns the status a session closed with a WebSocket close code
+// ends its Connect call with.
+func grpcStatus(code int) codes.Code {
+	switch code {
+	case websocket.CloseNormalClosure:
+		return codes.OK
+	case websocket.ClosePolicyViolation:
+		return codes.PermissionDenied
+	case websocket.CloseGoingAway:
+		return codes.Unavailable
+	default:
+		return codes.Unknown
+	}
+}
+
+// grpcClient is the client's end of a session (private).
+type grpcClient struct {
+	in     grpcInbox
+	cc     *grpc.ClientConn
+	cancel context.CancelFunc // ends the calls
+	quit   chan struct{}      // closed by Close
+	once   sync.Once
+
+	connect    signalingpb.Signaling_ConnectClient
+	answers    signalingpb.Signaling_AnswerClient
+	candidates signalingpb.Signaling_CandidateClient
+
+	ended  chan struct{} // closed once Connect ended
+	reason error         // why it ended: the host's close frame, or the call's status
+
+	mu     sync.Mutex // serializes writes, which number the messages
+	frames uint64     // messages written
+}
+
+// dialGRPC opens a session with the Signaling service of the host at u, a
+// grpc:// or grpcs:// (TLS) URL. ctx bounds the dial only, not the session.
+func dialGRPC(ctx context.Context, u *url.URL) (sigConn, error) {
+	creds := insecure.NewCredentials()
+	if u.Scheme == "grpcs" {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+	cc, err := grpc.NewClient(u.Host,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(relayReadLimit)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to gRPC server: %w", err)
+	}
+
+	callCtx, cancel := context.WithCancel(context.Background())
+	c := &grpcClient{cc: cc, cancel: cancel, quit: make(chan struct{}), ended: make(chan struct{})}
+	c.in = newGRPCInbox(c.quit, nil)
+	stop := context.AfterFunc(ctx, cancel)
+	err = c.open(callCtx)
+	if !stop() {
+		err = context.Cause(ctx) // dialing outlasted ctx
+	}
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to connect to gRPC server: %w", err)
+	}
+	return c, nil
+}
+
+// open opens a session with Connect and makes the session's other calls.
+func (c *grpcClient) open(ctx context.Context) error {
+	client := signalingpb.NewSignalingClient(c.cc)
+	connect, err := client.Connect(ctx)
+	if err != nil {
+		return grpcError(err)
+	}
+	md, err := connect.Header()
+	if err != nil {
+		return grpcError(err)
+	}
+	ids := md.Get(grpcSessionKey)
+	if len(ids) != 1 {
+		// The call ended without opening a session; its status tells why.
+		if _, err := connect.Recv(); err != nil && err != io.EOF {
+			return grpcError(err)
+		}
+		return errors.New("the host opened no session")
+	}
+
+	ctx = metadata.AppendToOutgoingContext(ctx, grpcSessionKey, ids[0])
+	offers, err := client.Offer(ctx, &signalingpb.OfferRequest{})
+	if err != nil {
+		return grpcError(err)
+	}
+	if c.answers, err = client.Answer(ctx); err != nil {
+		return grpcError(err)
+	}
+	if c.candidates, err = client.Candidate(ctx); err != nil {
+		return grpcError(err)
+	}
+	c.connect = connect
+
+	go c.in.receive(c.receiveConnect, true)
+	go c.in.receive(func() (grpcFrame, error) {
+		d, err := offers.Recv()
+		return descriptionFrame(d, msgTypeOffer), err
+	}, false)
+	go c.in.receive(func() (grpcFrame, error) {
+		ic, err := c.candidates.Recv()
+		return candidateFrame(ic), err
+	}, false)
+	return nil
+}
+
+// receiveConnect reads the next message of Connect, keeping why the session
+// ended for writes that fail.
+func (c *grpcClient) receiveConnect() (grpcFrame, error) {
+	m, err := c.connect.Recv()
+	switch {
+	case err == io.EOF:
+		err = &websocket.CloseError{Code: websocket.CloseAbnormalClosure, Text: io.ErrUnexpectedEOF.Error()}
+	case err != nil:
+		err = grpcError(err)
+	}
+	f := messageFrame(m)
+	switch {
+	case err != nil:
+		if c.reason == nil {
+			c.reason = err
+		}
+		close(c.ended)
+	case f.close != nil && c.reason == nil:
+		c.reason = f.decode(nil)
+	}
+	return f, err
+}
+
+// grpcError describes a call that ended with a status other than OK.
+func grpcError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	return fmt.Errorf("gRPC call failed with status %s: %s", st.Code(), st.Message())
+}
+
+// ReadJSON reads the host's next message. A session ending without a close
+// frame reads as the Connect call's status, or as an abnormal closure if that
+// is OK.
+func (c *grpcClient) ReadJSON(v any) error {
+	return c.in.read(v)
+}
+
+// WriteJSON sends v to the host, on the call for its kind. Once the host has
+// ended the session, writes fail with why, as the next read would.
+func (c *grpcClient) WriteJSON(v any) error {
+	msg, err := asMessage(v)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	frame := c.frames + 1
+	switch msg.Type {
+	case msgTypeAnswer:
+		err = c.answers.Send(descriptionProto(frame, msg))
+	case msgTypeCandidate:
+		ic, cerr := candidateProto(frame, msg)
+		if cerr != nil {
+			return cerr
+		}
+		err = c.candidates.Send(ic)
+	default:
+		err = c.connect.Send(messageProto(frame, msg))
+	}
+	if err != nil {
+		return c.sendError(err)
+	}
+	c.frames++
+	return nil
+}
+
+// WriteMessage sends a close frame; other messages are written as JSON text.
+func (c *grpcClient) WriteMessage(messageType int, data []byte) error {
+	if messageType != websocket.CloseMessage {
+		return c.WriteJSON(json.RawMessage(data))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.connect.Send(closeProto(c.frames+1, closeFrame(data))); err != nil {
+		return c.sendError(err)
+	}
+	c.frames++
+	return nil
+}
+
+// sendError returns why a send failed. A call the host ended fails sends
+// with io.EOF, and Connect tells why.
+func (c *grpcClient) sendError(err error) error {
+	if err != io.EOF {
+		return grpcError(err)
+	}
+	select {
+	case <-c.ended:
+		return c.reason
+	case <-c.quit:
+		return net.ErrClosed
+	}
+}
+
+// SetWriteDeadline is a no-op: a write only waits for HTTP/2 flow control,
+// and Close unblocks it.
+func (c *grpcClient) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+// Close ends the session.
+func (c *grpcClient) Close() error {
+	var err error
+	c.once.Do(func() {
+		close(c.quit)
+		c.cancel()
+		err = c.cc.Close()
+	})
+	return err
+}
+
+// grpcFrame is a message of a session, as read from one of its calls.
+type grpcFrame struct {
+	n     uint64 // its number among the messages of its sender
+	msg   message
+	close *pollClose // set for a close frame instead of msg
+}
+
+// decode stores f's message in v, or returns f's close frame as a
+// *websocket.CloseError.
+func (f grpcFrame) decode(v any) error {
+	if f.close != nil {
+		return &websocket.CloseError{Code: f.close.Code, Text: f.close.Text}
+	}
+	if m, ok := v.(*message); ok {
+		*m = f.msg
+		return nil
+	}
+	data, err := json.Marshal(f.msg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// grpcInbox puts the messages read from a session's calls back in the order
+// they were written (private). Any goroutine may receive into it; one reads.
+type grpcInbox struct {
+	frames  chan grpcResult
+	quit    <-chan struct{}      // closed when the session is closed
+	lost    <-chan struct{}      // closed when the peer is gone (nil = Connect tells)
+	next    uint64               // the number of the message to read next
+	pending map[uint64]grpcFrame // messages that arrived before their turn
+	err     error                // why Connect ended, once it has
+}
+
+// grpcResult is what a call's receive returned.
+type grpcResult struct {
+	frame grpcFrame
+	err   error
+}
+
+func newGRPCInbox(quit, lost <-chan struct{}) grpcInbox {
+	return grpcInbox{
+		frames:  make(chan grpcResult, grpcQueueLen),
+		quit:    quit,
+		lost:    lost,
+		next:    1,
+		pending: make(map[uint64]grpcFrame),
+	}
+}
+
+// receive passes what recv returns to the inbox until recv fails. The failure
+// of Connect ends the session; the other calls just stop.
+func (in *grpcInbox) receive(recv func() (grpcFrame, error), connect bool) {
+	for {
+		f, err := recv()
+		if err != nil && !connect {
+			return
+		}
+		select {
+		case in.frames <- grpcResult{f, err}:
+		case <-in.quit:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// read reads the next message into v, returning a close frame as a
+// *websocket.CloseError. Once Connect ended, the messages that already
+// arrived are read first.
+func (in *grpcInbox) read(v any) error {
+	for {
+		if f, ok := in.pending[in.next]; ok {
+			delete(in.pending, in.next)
+			in.next++
+			return f.decode(v)
+		}
+		if in.err != nil {
+			return in.err
+		}
+
+		select {
+		case r := <-in.frames:
+			if err := in.add(r); err != nil {
+				return err
+			}
+		case <-in.lost:
+			for len(in.frames) > 0 {
+				if err := in.add(<-in.frames); err != nil {
+					return err
+				}
+			}
+			if in.err == nil {
+				in.err = &websocket.CloseError{Code: websocket.CloseAbnormalClosure, Text: io.ErrUnexpectedEOF.Error()}
+			}
+		case <-in.quit:
+			return net.ErrClosed
+		}
+	}
+}
+
+// add files what a call received until its turn to be read.
+func (in *grpcInbox) add(r grpcResult) error {
+	_, dup := in.pending[r.frame.n]
+	switch {
+	case r.err != nil:
+		if in.err == nil {
+			in.err = r.err
+		}
+	case r.frame.n < in.next || dup:
+		return fmt.Errorf("gRPC: message %d arrived twice", r.frame.n)
+	case len(in.pending) >= grpcMaxPending:
+		return fmt.Errorf("gRPC: message %d is missing", in.next)
+	default:
+		in.pending[r.frame.n] = r.frame
+	}
+	return nil
+}
+
+// asMessage returns v, a message or its JSON encoding, as a message.
+func asMessage(v any) (message, error) {
+	if msg, ok := v.(message); ok {
+		return msg, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return message{}, err
+	}
+	var msg message
+	err = json.Unmarshal(data, &msg)
+	return msg, err
+}
+
+// iceCandidateInit is the JSON form of an ICE candidate in message.Candidate.
+type iceCandidateInit struct {
+	Candidate        string  `json:"candidate"`
+	SDPMid           *string `json:"sdpMid,omitempty"`
+	SDPMLineIndex    *uint16 `json:"sdpMLineIndex,omitempty"`
+	UsernameFragment *string `json:"usernameFragment,omitempty"`
+}
+
+// messageProto returns msg as a Message numbered frame.
+func messageProto(frame uint64, msg message) *signalingpb.Message {
+	return &signalingpb.Message{
+		Frame:       frame,
+		Type:        string(msg.Type),
+		Path:        uint32(msg.Path),
+		Addrs:       msg.Addrs,
+		Quic:        msg.QUIC,
+		Token:       msg.Token,
+		Fingerprint: msg.Fingerprint,
+		Version:     msg.Version,
+		Challenge:   msg.Challenge,
+		PublicKey:   msg.PublicKey,
+		Signature:   msg.Signature,
+		Pake:        msg.Pake,
+		Confirm:     msg.Confirm,
+		Sealed:      msg.Sealed,
+		Position:    uint32(msg.Position),
+		Seq:         msg.Seq,
+		Nonce:       msg.Nonce,
+	}
+}
+
+// closeProto returns a Message numbered frame carrying the close frame cl.
+func closeProto(frame uint64, cl *pollClose) *signalingpb.Message {
+	return &signalingpb.Message{Frame: frame, Close: &signalingpb.Close{Code: uint32(cl.Code), Reason: cl.Text}}
+}
+
+// messageFrame returns the message or close frame m carries (nil = none).
+func messageFrame(m *signalingpb.Message) grpcFrame {
+	if m == nil {
+		return grpcFrame{}
+	}
+	f := grpcFrame{n: m.GetFrame()}
+	if cl := m.GetClose(); cl != nil {
+		f.close = &pollClose{Code: int(cl.GetCode()), Text: cl.GetReason()}
+		return f
+	}
+	f.msg = message{
+		Type:        messageType(m.GetType()),
+		Path:        int(m.GetPath()),
+		Addrs:       m.GetAddrs(),
+		QUIC:        m.GetQuic(),
+		Token:       m.GetToken(),
+		Fingerprint: m.GetFingerprint(),
+		Version:     m.GetVersion(),
+		Challenge:   m.GetChallenge(),
+		PublicKey:   m.GetPublicKey(),
+		Signature:   m.GetSignature(),
+		Pake:        m.GetPake(),
+		Confirm:     m.GetConfirm(),
+		Sealed:      m.GetSealed(),
+		Position:    int(m.GetPosition()),
+		Seq:         m.GetSeq(),
+		Nonce:       m.GetNonce(),
+	}
+	return f
+}
+
+// descriptionProto returns the offer or answer msg as a SessionDescription
+// numbered frame.
+func descriptionProto(frame uint64, msg message) *signalingpb.SessionDescription {
+	return &signalingpb.SessionDescription{
+		Frame:     frame,
+		Sdp:       msg.SDP,
+		Path:      uint32(msg.Path),
+		Paths:     uint32(msg.Paths),
+		Bond:      msg.Bond,
+		Signature: msg.Signature,
+		Seq:       msg.Seq,
+		Nonce:     msg.Nonce,
+	}
+}
+
+// descriptionFrame returns the message of type typ d carries (nil = none).
+func descriptionFrame(d *signalingpb.SessionDescription, typ messageType) grpcFrame {
+	if d == nil {
+		return grpcFrame{}
+	}
+	return grpcFrame{n: d.GetFrame(), msg: message{
+		Type:      typ,
+		SDP:       d.GetSdp(),
+		Path:      int(d.GetPath()),
+		Paths:     int(d.GetPaths()),
+		Bond:      d.GetBond(),
+		Signature: d.GetSignature(),
+		Seq:       d.GetSeq(),
+		Nonce:     d.GetNonce(),
+	}}
+}
+
+// candidateProto returns the candidate msg as an IceCandidate numbered
+// frame.
+func candidateProto(frame uint64, msg message) (*signalingpb.IceCandidate, error) {
+	var init iceCandidateInit
+	if err := json.Unmarshal([]byte(msg.Candidate), &init); err != nil {
+		return nil, fmt.Errorf("invalid candidate: %w", err)
+	}
+	ic := &signalingpb.IceCandidate{
+		Frame:            frame,
+		Candidate:        init.Candidate,
+		SdpMid:           init.SDPMid,
+		UsernameFragment: init.UsernameFragment,
+		Path:             uint32(msg.Path),
+		Seq:              msg.Seq,
+		Nonce:            msg.Nonce,
+	}
+	if init.SDPMLineIndex != nil {
+		i := uint32(*init.SDPMLineIndex)
+		ic.SdpMlineIndex = &i
+	}
+	return ic, nil
+}
+
+// candidateFrame returns the candidate message ic carries (nil = none).
+func candidateFrame(ic *signalingpb.IceCandidate) grpcFrame {
+	if ic == nil {
+		return grpcFrame{}
+	}
+	init := iceCandidateInit{
+		Candidate:        ic.GetCandidate(),
+		SDPMid:           ic.SdpMid,
+		UsernameFragment: ic.UsernameFragment,
+	}
+	if ic.SdpMlineIndex != nil {
+		i := uint16(*ic.SdpMlineIndex)
+		init.SDPMLineIndex = &i
+	}
+	data, _ := json.Marshal(init)
+	return grpcFrame{n: ic.GetFrame(), msg: message{
+		Type:      msgTypeCandidate,
+		Candidate: string(data),
+		Path:      int(ic.GetPath()),
+		Seq:       ic.GetSeq(),
+		Nonce:     ic.GetNonce(),
+	}}
+}
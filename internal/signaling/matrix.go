@@ -0,0 +1,440 @@
+package signaling
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	matrixEventType   = "io.github.1ureka.roj1.signal" // custom events, which chat clients do not show
+	matrixSyncTimeout = 30 * time.Second               // how long the homeserver holds a sync open
+	matrixSyncRetries = 3                              // failed syncs in a row before giving up
+	matrixReadLimit   = 8 << 20                        // largest response read, a sync of up to 100 events
+)
+
+// MatrixConfig names the Matrix room a MatrixSignaler signals through and the
+// account it posts as.
+type MatrixConfig struct {
+	// Room is a room ID like !abc:example.org or an alias like
+	// #roj1:example.org, which the account joins if it has not already.
+	Room string
+
+	// Token is the account's access token.
+	Token string
+
+	// Homeserver is the account's homeserver URL. If empty, it is discovered
+	// through .well-known/matrix/client on the room's server name.
+	Homeserver string
+}
+
+// matrixEvent is the content of a signaling event in the room. Each side
+// posts under a random ID; a message is for the peer whose ID it names.
+type matrixEvent struct {
+	Role string `json:"role"`           // "host" or "client", the sender's
+	From string `json:"from"`           // the sender's ID
+	To   string `json:"to,omitempty"`   // the receiver's ID, once known
+	Kind string `json:"kind,omitempty"` // "join", "ack" or "" for a message
+	Msg  string `json:"msg,omitempty"`  // the signaling message
+}
+
+// MatrixSignaler is a Signaler exchanging messages as custom events in a
+// Matrix room, so that two users who already share a room need no other
+// infrastructure. Each side posts a join event once it follows the room, and
+// the side already there answers it; as the room keeps its events, whichever
+// starts second is seen. A host takes the first client that joins; others
+// wait for the next session.
+//
+// The events are not end-to-end encrypted, even in an encrypted room: the
+// room's members and homeservers can read the session descriptions, so use a
+// PIN.
+type MatrixSignaler struct {
+	client *http.Client
+	base   string // the homeserver's URL
+	token  string
+	room   string // the room ID
+	role   string
+	id     string
+	peer   string // the peer's ID, set before joined is closed
+	txn    atomic.Uint64
+
+	in     chan []byte   // the peer's messages, not yet received
+	joined chan struct{} // closed once paired with a peer
+	done   chan struct{} // closed when syncing fails or the signaler is closed
+	fail   sync.Once
+	err    error // why done was closed
+	cancel context.CancelFunc
+
+	mu sync.Mutex // serializes sends, keeping them in order
+}
+
+// matrixError is an error response from the homeserver.
+type matrixError struct {
+	ErrCode      string `json:"errcode"`
+	Message      string `json:"error"`
+	RetryAfterMS int    `json:"retry_after_ms"`
+}
+
+func (e *matrixError) Error() string {
+	return fmt.Sprintf("homeserver: %s (%s)", e.Message, e.ErrCode)
+}
+
+// ValidMatrixRoom reports why room is not a room ID or alias, or nil.
+func ValidMatrixRoom(room string) error {
+	_, err := matrixServerName(room)
+	return err
+}
+
+// matrixServerName returns the server name of a room ID or alias.
+func matrixServerName(room string) (string, error) {
+	if !strings.HasPrefix(room, "!") && !strings.HasPrefix(room, "#") {
+		return "", fmt.Errorf("%s is not a room ID (!id:server) or alias (#name:server)", room)
+	}
+	_, server, ok := strings.Cut(room, ":")
+	if !ok || len(room) < 4 || server == "" {
+		return "", fmt.Errorf("%s names no server, e.g. #roj1:example.org", room)
+	}
+	return server, nil
+}
+
+// DialMatrix joins cfg.Room as the host or the client of the exchange in it
+// and announces itself. ctx bounds the dial only.
+func DialMatrix(ctx context.Context, cfg MatrixConfig, host bool) (*MatrixSignaler, error) {
+	server, err := matrixServerName(cfg.Room)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	s := &MatrixSignaler{
+		client: &http.Client{},
+		base:   strings.TrimSuffix(cfg.Homeserver, "/"),
+		token:  cfg.Token,
+		role:   "client",
+		id:     hex.EncodeToString(id),
+		in:     make(chan []byte, 64),
+		joined: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if host {
+		s.role = "host"
+	}
+	if s.base == "" {
+		s.base = s.discover(ctx, server)
+	}
+
+	var joined struct {
+		RoomID string `json:"room_id"`
+	}
+	if err := s.do(ctx, http.MethodPost, "/join/"+url.PathEscape(cfg.Room), nil, struct{}{}, &joined); err != nil {
+		return nil, fmt.Errorf("failed to join Matrix room %s: %w", cfg.Room, err)
+	}
+	s.room = joined.RoomID
+
+	// Only what is posted from now on matters: the room's history holds
+	// earlier sessions.
+	since, err := s.sync(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to follow Matrix room %s: %w", cfg.Room, err)
+	}
+	if err := s.post(ctx, matrixEvent{Kind: "join"}); err != nil {
+		return nil, fmt.Errorf("failed to post to Matrix room %s: %w", cfg.Room, err)
+	}
+
+	syncCtx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go s.follow(syncCtx, since)
+	return s, nil
+}
+
+// discover looks up the homeserver of server, falling back to server itself.
+func (s *MatrixSignaler) discover(ctx context.Context, server string) string {
+	base := "https://" + server
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/.well-known/matrix/client", nil)
+	if err != nil {
+		return base
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return base
+	}
+	defer resp.Body.Close()
+	var wk struct {
+		Homeserver struct {
+			BaseURL string `json:"base_url"`
+		} `json:"m.homeserver"`
+	}
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(io.LimitReader(resp.Body, matrixReadLimit)).Decode(&wk) != nil || wk.Homeserver.BaseURL == "" {
+		return base
+	}
+	return strings.TrimSuffix(wk.Homeserver.BaseURL, "/")
+}
+
+// do calls the client-server API at path, waiting out rate limits.
+func (s *MatrixSignaler) do(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	target := s.base + "/_matrix/client/v3" + path
+	if query != nil {
+		target += "?" + query.Encode()
+	}
+
+	for {
+		req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+s.token)
+		if in != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, matrixReadLimit))
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusOK {
+			if out == nil {
+				return nil
+			}
+			return json.Unmarshal(data, out)
+		}
+
+		merr := &matrixError{ErrCode: "HTTP " + strconv.Itoa(resp.StatusCode), Message: resp.Status}
+		json.Unmarshal(data, merr)
+		if resp.StatusCode != http.StatusTooManyRequests {
+			return merr
+		}
+		wait := time.Duration(merr.RetryAfterMS) * time.Millisecond
+		if wait <= 0 {
+			wait = time.Second
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// sync returns the token of the room's latest events after since, handing
+// them to receive; an empty since only returns the token.
+func (s *MatrixSignaler) sync(ctx context.Context, since string) (string, error) {
+	filter, err := json.Marshal(map[string]any{
+		"presence":     map[string]any{"types": []string{}},
+		"account_data": map[string]any{"types": []string{}},
+		"room": map[string]any{
+			"rooms":        []string{s.room},
+			"timeline":     map[string]any{"types": []string{matrixEventType}, "limit": 100},
+			"state":        map[string]any{"types": []string{}},
+			"ephemeral":    map[string]any{"types": []string{}},
+			"account_data": map[string]any{"types": []string{}},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{"filter": {string(filter)}, "timeout": {"0"}}
+	if since != "" {
+		query.Set("since", since)
+		query.Set("timeout", strconv.Itoa(int(matrixSyncTimeout/time.Millisecond)))
+	}
+
+	var resp struct {
+		NextBatch string `json:"next_batch"`
+		Rooms     struct {
+			Join map[string]struct {
+				Timeline struct {
+					Events []struct {
+						Type    string          `json:"type"`
+						Content json.RawMessage `json:"content"`
+					} `json:"events"`
+				} `json:"timeline"`
+			} `json:"join"`
+		} `json:"rooms"`
+	}
+	if err := s.do(ctx, http.MethodGet, "/sync", query, nil, &resp); err != nil {
+		return "", err
+	}
+	if since != "" {
+		for _, ev := range resp.Rooms.Join[s.room].Timeline.Events {
+			if ev.Type == matrixEventType {
+				s.receive(ctx, ev.Content)
+			}
+		}
+	}
+	return resp.NextBatch, nil
+}
+
+// follow syncs with the room until ctx is cancelled or syncing keeps failing.
+func (s *MatrixSignaler) follow(ctx context.Context, since string) {
+	failures := 0
+	for {
+		next, err := s.sync(ctx, since)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err == nil:
+			since, failures = next, 0
+			continue
+		}
+		if failures++; failures == matrixSyncRetries {
+			s.close(fmt.Errorf("failed to follow the Matrix room: %w", err))
+			return
+		}
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// receive handles an event posted to the room.
+func (s *MatrixSignaler) receive(ctx context.Context, content json.RawMessage) {
+	var ev matrixEvent
+	if json.Unmarshal(content, &ev) != nil || ev.Role == s.role || ev.From == "" {
+		return // not the peer's
+	}
+	switch ev.Kind {
+	case "join":
+		if s.pair(ev.From) {
+			s.post(ctx, matrixEvent{Kind: "ack"})
+		}
+	case "ack":
+		if ev.To == s.id {
+			s.pair(ev.From)
+		}
+	case "":
+		if ev.To != s.id || !s.paired(ev.From) {
+			return
+		}
+		select {
+		case s.in <- []byte(ev.Msg):
+		case <-ctx.Done():
+		}
+	}
+}
+
+// pair takes peer as the peer unless there is one, reporting whether it did.
+func (s *MatrixSignaler) pair(peer string) bool {
+	select {
+	case <-s.joined:
+		return false
+	default:
+	}
+	s.peer = peer
+	close(s.joined)
+	return true
+}
+
+// paired reports whether peer is the peer.
+func (s *MatrixSignaler) paired(peer string) bool {
+	select {
+	case <-s.joined:
+		return s.peer == peer
+	default:
+		return false
+	}
+}
+
+// post sends an event to the peer.
+func (s *MatrixSignaler) post(ctx context.Context, ev matrixEvent) error {
+	ev.Role, ev.From = s.role, s.id
+	if ev.Kind != "join" {
+		ev.To = s.peer
+	}
+	txn := s.id + "-" + strconv.FormatUint(s.txn.Add(1), 10)
+	path := "/rooms/" + url.PathEscape(s.room) + "/send/" + matrixEventType + "/" + txn
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.do(ctx, http.MethodPut, path, nil, ev, nil)
+}
+
+// send posts msg once paired with a peer.
+func (s *MatrixSignaler) send(ctx context.Context, msg []byte) error {
+	select {
+	case <-s.joined:
+	case <-s.done:
+		return s.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return s.post(ctx, matrixEvent{Msg: string(msg)})
+}
+
+// SendOffer posts an offer to the client.
+func (s *MatrixSignaler) SendOffer(ctx context.Context, msg []byte) error {
+	return s.send(ctx, msg)
+}
+
+// SendAnswer posts an answer to the host.
+func (s *MatrixSignaler) SendAnswer(ctx context.Context, msg []byte) error {
+	return s.send(ctx, msg)
+}
+
+// SendCandidate posts an ICE candidate to the peer.
+func (s *MatrixSignaler) SendCandidate(ctx context.Context, msg []byte) error {
+	return s.send(ctx, msg)
+}
+
+// Send posts any other message to the peer.
+func (s *MatrixSignaler) Send(ctx context.Context, msg []byte) error {
+	return s.send(ctx, msg)
+}
+
+// Recv returns the peer's next message.
+func (s *MatrixSignaler) Recv(ctx context.Context) ([]byte, error) {
+	select {
+	case msg := <-s.in: // what arrived before syncing ended is still read
+		return msg, nil
+	default:
+	}
+	select {
+	case msg := <-s.in:
+		return msg, nil
+	case <-s.done:
+		return nil, s.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops following the room.
+func (s *MatrixSignaler) Close() error {
+	s.close(net.ErrClosed)
+	return nil
+}
+
+// close stops syncing, reporting err to pending calls.
+func (s *MatrixSignaler) close(err error) {
+	s.fail.Do(func() {
+		s.err = err
+		close(s.done)
+		s.cancel()
+	})
+}
@@ -8,6 +8,14 @@ const (
 	msgTypeAnswer    messageType = "answer"
 	msgTypeCandidate messageType = "candidate"
 	msgTypeReady     messageType = "ready"
+	msgTypeDirect    messageType = "direct" // host → client, sent before the offer
+	msgTypeHello     messageType = "hello"  // both ways, the first message sent
+	msgTypeAuth      messageType = "auth"   // client → host, answers the host's challenge
+	msgTypePaired    messageType = "paired" // relay → host, a client joined its room
+	msgTypePake      messageType = "pake"   // both ways, the PIN exchange (see pake.go)
+	msgTypeSealed    messageType = "sealed" // both ways, any other message encrypted with the PIN's keys
+	msgTypeQueued    messageType = "queued" // host → client, its place in the host's queue; sent before the session
+	msgTypeClose     messageType = "close"  // both ways, a close frame over a Signaler (see signaler.go)
 )
 
 // message is the JSON structure exchanged over the WebSocket during signaling (private).
@@ -15,4 +23,37 @@ type message struct {
 	Type      messageType `json:"type"`
 	SDP       string      `json:"sdp,omitempty"`
 	Candidate string      `json:"candidate,omitempty"` // JSON-encoded ICECandidateInit
+
+	// Multipath: every WebRTC message is addressed to a path (PeerConnection);
+	// offers also announce the total number of paths and the bond mode.
+	Path  int    `json:"path,omitempty"`
+	Paths int    `json:"paths,omitempty"`
+	Bond  string `json:"bond,omitempty"`
+
+	// Direct transport offer (msgTypeDirect only).
+	Addrs       []string `json:"addrs,omitempty"`       // host addresses to dial over TLS
+	QUIC        []string `json:"quic,omitempty"`        // host addresses to dial over QUIC
+	Token       string   `json:"token,omitempty"`       // session token the client must present; in offer files, the offer an answer belongs to
+	Fingerprint string   `json:"fingerprint,omitempty"` // SHA-256 of the host's TLS certificate
+
+	// Sender's binary version (msgTypeHello only).
+	Version string `json:"version,omitempty"`
+
+	// Peer authentication (msgTypeHello and msgTypeAuth, see auth.go), and
+	// the signature of msgTypeOffer and msgTypeAnswer (see sdpTranscript).
+	Challenge string `json:"challenge,omitempty"` // random value the peer must sign
+	PublicKey string `json:"publicKey,omitempty"` // sender's identity key
+	Signature string `json:"signature,omitempty"` // sender's signature over the peer's challenge, or its SDPs
+
+	// PIN exchange and encryption (msgTypePake and msgTypeSealed, see pake.go).
+	Pake    string `json:"pake,omitempty"`    // sender's SPAKE2 share
+	Confirm string `json:"confirm,omitempty"` // proof that the sender derived the same keys
+	Sealed  string `json:"sealed,omitempty"`  // encrypted message
+
+	// Place in the host's queue, 0 once it is the client's turn (msgTypeQueued only).
+	Position int `json:"position,omitempty"`
+
+	// Replay protection, on every message (see codec.go).
+	Seq   uint64 `json:"seq,omitempty"`   // sender's message number, from 1
+	Nonce string `json:"nonce,omitempty"` // the session nonce picked by the host
 }
@@ -0,0 +1,419 @@
+package signaling
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MQTT packet types (MQTT 3.1.1), as in the high nibble of a fixed header.
+const (
+	mqttConnect    = 1
+	mqttConnAck    = 2
+	mqttPublish    = 3
+	mqttPubAck     = 4
+	mqttSubscribe  = 8
+	mqttSubAck     = 9
+	mqttPingReq    = 12
+	mqttPingResp   = 13
+	mqttDisconnect = 14
+)
+
+const (
+	mqttKeepAlive    = 30 * time.Second // the broker drops a client silent for 1.5 times this
+	mqttWriteTimeout = 10 * time.Second // a publish taking longer has failed
+	mqttJoinInterval = time.Second      // how often a side announces itself until the peer answers
+)
+
+// mqttConnectErrors are the broker's reasons for refusing a connection, by
+// CONNACK return code.
+var mqttConnectErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// mqttControl is a message the two MQTTSignalers exchange among themselves,
+// never passed on to Recv: "join" announces a side that subscribed, "ack"
+// answers it.
+type mqttControl struct {
+	MQTT string `json:"mqtt"`
+}
+
+// MQTTSignaler is a Signaler exchanging messages through an MQTT broker, for
+// fleets where a broker already exists and no inbound port can be opened: the
+// host publishes to <topic>/host and subscribes to <topic>/client, the client
+// the other way round. Messages are published with QoS 0 and not retained, so
+// each side announces itself until the other answers before sending anything.
+// A topic carries one exchange at a time.
+//
+// Anyone allowed on the topic can read the session descriptions; use a PIN
+// unless the broker restricts it to the two peers.
+type MQTTSignaler struct {
+	conn  net.Conn
+	topic string // the topic this side publishes to
+
+	in     chan []byte   // the peer's messages, not yet received
+	joined chan struct{} // closed once the peer has been heard from
+	join   sync.Once
+	done   chan struct{} // closed when the connection fails or is closed
+	fail   sync.Once
+	err    error // why done was closed
+
+	mu sync.Mutex // serializes writes
+}
+
+// ValidMQTTURL reports why raw is not a broker URL DialMQTT accepts, or nil.
+func ValidMQTTURL(raw string) error {
+	_, _, err := parseMQTTURL(raw)
+	return err
+}
+
+// parseMQTTURL splits a broker URL into the broker's URL and the topic.
+func parseMQTTURL(raw string) (*url.URL, string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, "", err
+	}
+	if u.Scheme != "mqtt" && u.Scheme != "mqtts" {
+		return nil, "", fmt.Errorf("%s is not an mqtt:// or mqtts:// URL", raw)
+	}
+	topic := strings.Trim(u.Path, "/")
+	switch {
+	case u.Host == "":
+		return nil, "", fmt.Errorf("%s names no broker", raw)
+	case topic == "":
+		return nil, "", fmt.Errorf("%s names no topic, e.g. mqtt://broker/roj1/kiosk", raw)
+	case strings.ContainsAny(topic, "+#") || strings.Contains(raw, "#"): // a # starts the URL's fragment
+		return nil, "", fmt.Errorf("topic %s must not contain wildcards", topic)
+	}
+	return u, topic, nil
+}
+
+// DialMQTT connects to the broker at raw, mqtt://[user:password@]broker[:1883]/topic
+// or mqtts:// for TLS (port 8883 by default), as the host or the client of the
+// exchange on the topic. ctx bounds the dial only.
+func DialMQTT(ctx context.Context, raw string, host bool) (*MQTTSignaler, error) {
+	u, topic, err := parseMQTTURL(raw)
+	if err != nil {
+		return nil, err
+	}
+	pub, sub := topic+"/host", topic+"/client"
+	if !host {
+		pub, sub = sub, pub
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		port := "1883"
+		if u.Scheme == "mqtts" {
+			port = "8883"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MQTT broker: %w", err)
+	}
+	if u.Scheme == "mqtts" {
+		conn = tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	s := &MQTTSignaler{
+		conn:   conn,
+		topic:  pub,
+		in:     make(chan []byte, 64),
+		joined: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	r := bufio.NewReader(conn)
+	if err := s.handshake(r, u.User, sub); err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, context.Cause(ctx)
+		}
+		return nil, fmt.Errorf("failed to connect to MQTT broker: %w", err)
+	}
+	if !stop() {
+		conn.Close()
+		return nil, context.Cause(ctx)
+	}
+
+	go s.read(r)
+	go s.keepAlive()
+	go s.announce()
+	return s, nil
+}
+
+// handshake connects to the broker as user and subscribes to topic.
+func (s *MQTTSignaler) handshake(r *bufio.Reader, user *url.Userinfo, topic string) error {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+
+	body := mqttString(nil, "MQTT")
+	flags := byte(0x02) // clean session
+	if user != nil {
+		flags |= 0x80
+		if _, ok := user.Password(); ok {
+			flags |= 0x40
+		}
+	}
+	body = append(body, 4, flags) // protocol level 4 = MQTT 3.1.1
+	body = binary.BigEndian.AppendUint16(body, uint16(mqttKeepAlive/time.Second))
+	body = mqttString(body, "roj1-"+hex.EncodeToString(id))
+	if user != nil {
+		body = mqttString(body, user.Username())
+		if password, ok := user.Password(); ok {
+			body = mqttString(body, password)
+		}
+	}
+	if err := s.write(mqttConnect<<4, body); err != nil {
+		return err
+	}
+	typ, _, body, err := readMQTT(r)
+	switch {
+	case err != nil:
+		return err
+	case typ != mqttConnAck || len(body) < 2:
+		return errors.New("the broker did not acknowledge the connection")
+	case body[1] != 0:
+		if reason, ok := mqttConnectErrors[body[1]]; ok {
+			return fmt.Errorf("the broker refused the connection: %s", reason)
+		}
+		return fmt.Errorf("the broker refused the connection (code %d)", body[1])
+	}
+
+	body = binary.BigEndian.AppendUint16(nil, 1) // packet identifier
+	body = mqttString(body, topic)
+	body = append(body, 0) // QoS 0
+	if err := s.write(mqttSubscribe<<4|0x02, body); err != nil {
+		return err
+	}
+	typ, _, body, err = readMQTT(r)
+	switch {
+	case err != nil:
+		return err
+	case typ != mqttSubAck || len(body) < 3:
+		return errors.New("the broker did not acknowledge the subscription")
+	case body[2] == 0x80:
+		return fmt.Errorf("the broker refused the subscription to %s", topic)
+	}
+	return nil
+}
+
+// read receives packets until the connection fails.
+func (s *MQTTSignaler) read(r *bufio.Reader) {
+	for {
+		typ, flags, body, err := readMQTT(r)
+		if err != nil {
+			s.close(err)
+			return
+		}
+		if typ != mqttPublish {
+			continue // PINGRESP
+		}
+
+		if len(body) < 2 {
+			s.close(errors.New("malformed MQTT publish"))
+			return
+		}
+		n := 2 + int(binary.BigEndian.Uint16(body))
+		if qos := flags >> 1 & 3; qos > 0 {
+			if len(body) < n+2 {
+				s.close(errors.New("malformed MQTT publish"))
+				return
+			}
+			if qos == 1 {
+				s.write(mqttPubAck<<4, body[n:n+2])
+			}
+			n += 2
+		}
+		if len(body) < n {
+			s.close(errors.New("malformed MQTT publish"))
+			return
+		}
+		s.receive(body[n:])
+	}
+}
+
+// receive handles a message published by the peer.
+func (s *MQTTSignaler) receive(payload []byte) {
+	var ctl mqttControl
+	json.Unmarshal(payload, &ctl)
+	switch ctl.MQTT {
+	case "join":
+		s.publish(mqttControl{MQTT: "ack"})
+	case "ack":
+	default:
+		select {
+		case s.in <- payload:
+		case <-s.done:
+		}
+	}
+	s.join.Do(func() { close(s.joined) })
+}
+
+// announce publishes join messages until the peer has been heard from, as
+// messages published before it subscribed are lost.
+func (s *MQTTSignaler) announce() {
+	ticker := time.NewTicker(mqttJoinInterval)
+	defer ticker.Stop()
+	for {
+		if s.publish(mqttControl{MQTT: "join"}) != nil {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-s.joined:
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// keepAlive pings the broker so that it keeps the connection open.
+func (s *MQTTSignaler) keepAlive() {
+	ticker := time.NewTicker(mqttKeepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if s.write(mqttPingReq<<4, nil) != nil {
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// publish sends a control message to the peer.
+func (s *MQTTSignaler) publish(ctl mqttControl) error {
+	data, err := json.Marshal(ctl)
+	if err != nil {
+		return err
+	}
+	return s.write(mqttPublish<<4, append(mqttString(nil, s.topic), data...))
+}
+
+// write sends a packet with the given first header byte.
+func (s *MQTTSignaler) write(header byte, body []byte) error {
+	packet := append([]byte{header}, binary.AppendUvarint(nil, uint64(len(body)))...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conn.SetWriteDeadline(time.Now().Add(mqttWriteTimeout))
+	_, err := s.conn.Write(append(packet, body...))
+	return err
+}
+
+// send publishes msg once the peer has been heard from.
+func (s *MQTTSignaler) send(ctx context.Context, msg []byte) error {
+	select {
+	case <-s.joined:
+	case <-s.done:
+		return s.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return s.write(mqttPublish<<4, append(mqttString(nil, s.topic), msg...))
+}
+
+// SendOffer publishes an offer to the client.
+func (s *MQTTSignaler) SendOffer(ctx context.Context, msg []byte) error {
+	return s.send(ctx, msg)
+}
+
+// SendAnswer publishes an answer to the host.
+func (s *MQTTSignaler) SendAnswer(ctx context.Context, msg []byte) error {
+	return s.send(ctx, msg)
+}
+
+// SendCandidate publishes an ICE candidate to the peer.
+func (s *MQTTSignaler) SendCandidate(ctx context.Context, msg []byte) error {
+	return s.send(ctx, msg)
+}
+
+// Send publishes any other message to the peer.
+func (s *MQTTSignaler) Send(ctx context.Context, msg []byte) error {
+	return s.send(ctx, msg)
+}
+
+// Recv returns the peer's next message.
+func (s *MQTTSignaler) Recv(ctx context.Context) ([]byte, error) {
+	select {
+	case msg := <-s.in: // what arrived before the connection ended is still read
+		return msg, nil
+	default:
+	}
+	select {
+	case msg := <-s.in:
+		return msg, nil
+	case <-s.done:
+		return nil, s.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close disconnects from the broker.
+func (s *MQTTSignaler) Close() error {
+	s.write(mqttDisconnect<<4, nil)
+	s.close(net.ErrClosed)
+	return nil
+}
+
+// close ends the connection, reporting err to pending calls.
+func (s *MQTTSignaler) close(err error) {
+	s.fail.Do(func() {
+		s.err = err
+		close(s.done)
+		s.conn.Close()
+	})
+}
+
+// mqttString appends s to b as an MQTT length-prefixed string.
+func mqttString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// readMQTT reads a packet, returning its type, flags and body. The remaining
+// length is encoded like a protobuf varint.
+func readMQTT(r *bufio.Reader) (typ, flags byte, body []byte, err error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if n > relayReadLimit {
+		return 0, 0, nil, fmt.Errorf("MQTT packet of %d bytes is too large", n)
+	}
+	body = make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, 0, nil, err
+	}
+	return header >> 4, header & 0x0f, body, nil
+}
@@ -0,0 +1,262 @@
+package signaling
+
+import (
+	"context"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"filippo.io/edwards25519"
+	"github.com/gorilla/websocket"
+)
+
+// ErrPIN is wrapped (together with ErrSignaling) when the peers' PINs differ
+// or only one side uses one. It matches ErrSignalingAuth.
+var ErrPIN error = authError("PIN mismatch")
+
+// With a PIN, the peers run SPAKE2 (RFC 9382) over edwards25519 right after
+// the WebSocket connects: each proves it knows the PIN without revealing it,
+// and both derive keys that encrypt and authenticate every later signaling
+// message. Whoever relays the WebSocket sees only ciphertext, cannot alter it
+// unnoticed, and gets a single online guess at the PIN per connection. The
+// client sends its share first; the host answers with its share and a key
+// confirmation, and the client confirms in turn.
+//
+//	client → host  {"type":"pake","pake":X}
+//	host → client  {"type":"pake","pake":Y,"confirm":…}
+//	client → host  {"type":"pake","confirm":…}
+//	both ways      {"type":"sealed","sealed":…}
+//
+// The group arithmetic is constant time, as the PIN scalar and the private
+// scalars must not leak through timing.
+
+// pakeM and pakeN are SPAKE2's fixed points, derived by hashing a seed onto
+// the curve so that nobody knows their discrete logarithms.
+var pakeM, pakeN = hashToPoint("roj1 SPAKE2 edwards25519 M"), hashToPoint("roj1 SPAKE2 edwards25519 N")
+
+// hashToPoint maps seed to a point of the prime-order subgroup by
+// try-and-increment, clearing the cofactor.
+func hashToPoint(seed string) *edwards25519.Point {
+	for ctr := byte(0); ; ctr++ {
+		h := sha256.Sum256(append([]byte(seed), ctr))
+		p, err := new(edwards25519.Point).SetBytes(h[:])
+		if err != nil {
+			continue
+		}
+		if p.MultByCofactor(p); p.Equal(edwards25519.NewIdentityPoint()) == 0 {
+			return p
+		}
+	}
+}
+
+// pinScalar maps the PIN to SPAKE2's password scalar w.
+func pinScalar(pin string) *edwards25519.Scalar {
+	h := sha512.Sum512([]byte("roj1 PIN\x00" + pin))
+	w, _ := edwards25519.NewScalar().SetUniformBytes(h[:]) // 64 bytes cannot fail
+	return w
+}
+
+// pakeShare returns a random scalar and the share x·G + w·blind to send.
+func pakeShare(w *edwards25519.Scalar, blind *edwards25519.Point) (*edwards25519.Scalar, []byte, error) {
+	x, err := randScalar()
+	if err != nil {
+		return nil, nil, err
+	}
+	share := new(edwards25519.Point).ScalarBaseMult(x)
+	share.Add(share, new(edwards25519.Point).ScalarMult(w, blind))
+	return x, share.Bytes(), nil
+}
+
+// pakeSecret returns h·x·(peer − w·blind), the shared point both sides
+// reach, given our scalar and the peer's share blinded with the peer's
+// point. Multiplying by the cofactor h drops any small-order component a
+// peer may have put in its share.
+func pakeSecret(x, w *edwards25519.Scalar, peer []byte, blind *edwards25519.Point) ([]byte, error) {
+	p, err := new(edwards25519.Point).SetBytes(peer)
+	if err != nil {
+		return nil, errors.New("invalid PAKE share")
+	}
+	p.Subtract(p, new(edwards25519.Point).ScalarMult(w, blind))
+	p.MultByCofactor(p)
+	k := new(edwards25519.Point).ScalarMult(x, p)
+	if k.Equal(edwards25519.NewIdentityPoint()) == 1 {
+		return nil, errors.New("invalid PAKE share")
+	}
+	return k.Bytes(), nil
+}
+
+// randScalar returns a uniformly random scalar.
+func randScalar() (*edwards25519.Scalar, error) {
+	b := make([]byte, 64)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return edwards25519.NewScalar().SetUniformBytes(b)
+}
+
+// pakeKeys are the keys derived from a SPAKE2 run.
+type pakeKeys struct {
+	hostConfirm, clientConfirm []byte
+	hostSeal, clientSeal       []byte
+}
+
+// deriveKeys derives the confirmation and sealing keys from the transcript
+// of the session nonce, shares X (client) and Y (host), the shared point K
+// and w. The nonce travels in the clear during the exchange; binding it here
+// makes the confirmations fail if a relay swapped it.
+func deriveKeys(nonce string, x, y, k, w []byte) (pakeKeys, error) {
+	var tt []byte
+	for _, part := range [][]byte{[]byte("roj1"), []byte(nonce), x, y, k, w} {
+		tt = binary.LittleEndian.AppendUint64(tt, uint64(len(part)))
+		tt = append(tt, part...)
+	}
+	sum := sha256.Sum256(tt)
+
+	var keys pakeKeys
+	for info, key := range map[string]*[]byte{
+		"host confirm": &keys.hostConfirm, "client confirm": &keys.clientConfirm,
+		"host seal": &keys.hostSeal, "client seal": &keys.clientSeal,
+	} {
+		k, err := hkdf.Key(sha256.New, sum[:], nil, "roj1 signaling "+info, 32)
+		if err != nil {
+			return keys, err
+		}
+		*key = k
+	}
+	return keys, nil
+}
+
+// confirmation returns the key confirmation MAC under key.
+func confirmation(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("roj1 PIN confirmed"))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// checkConfirmation reports whether got is the confirmation MAC under key.
+func checkConfirmation(key []byte, got string) bool {
+	return hmac.Equal([]byte(confirmation(key)), []byte(got))
+}
+
+// readPake reads the next message through c, which must be a PAKE message,
+// with ctx closing conn if it ends first.
+func readPake(ctx context.Context, conn sigConn, c *codec) (message, error) {
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	var msg message
+	err := c.readJSON(conn, &msg)
+	if !stop() {
+		return msg, context.Cause(ctx)
+	}
+	if err == nil && msg.Type != msgTypePake {
+		err = fmt.Errorf("unexpected message type %q", msg.Type)
+	}
+	return msg, err
+}
+
+// refusePIN closes conn with a policy violation stating reason.
+func refusePIN(conn sigConn, reason string) {
+	conn.WriteMessage(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason))
+}
+
+// offerPIN runs the client side of the PIN exchange on conn, after which c
+// seals the rest of signaling.
+func offerPIN(ctx context.Context, conn sigConn, c *codec, pin string) error {
+	w := pinScalar(pin)
+	x, share, err := pakeShare(w, pakeM)
+	if err != nil {
+		return err
+	}
+	if err := c.writeJSON(conn, message{Type: msgTypePake, Pake: base64.StdEncoding.EncodeToString(share)}); err != nil {
+		return err
+	}
+
+	reply, err := readPake(ctx, conn, c)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		return fmt.Errorf("%w: the host did not answer with its PIN share, does it use -pin? (%w)", ErrPIN, err)
+	}
+	peer, err := base64.StdEncoding.DecodeString(reply.Pake)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrPIN, err)
+	}
+	k, err := pakeSecret(x, w, peer, pakeN)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrPIN, err)
+	}
+	keys, err := deriveKeys(c.sessionNonce(), share, peer, k, w.Bytes())
+	if err != nil {
+		return err
+	}
+	if !checkConfirmation(keys.hostConfirm, reply.Confirm) {
+		refusePIN(conn, "wrong PIN")
+		return fmt.Errorf("%w: the host's PIN differs (or the signaling was tampered with)", ErrPIN)
+	}
+
+	if err := c.writeJSON(conn, message{Type: msgTypePake, Confirm: confirmation(keys.clientConfirm)}); err != nil {
+		return err
+	}
+	return c.seal(keys.clientSeal, keys.hostSeal)
+}
+
+// acceptPIN runs the host side of the PIN exchange on conn, after which c
+// seals the rest of signaling. A client without a PIN is told so in the
+// WebSocket close frame.
+func acceptPIN(ctx context.Context, conn sigConn, c *codec, pin string) error {
+	first, err := readPake(ctx, conn, c)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		if errors.Is(err, ErrReplay) {
+			refusePIN(conn, ErrReplay.Error())
+			return err
+		}
+		refusePIN(conn, "this host requires a PIN (see -pin)")
+		return fmt.Errorf("%w: the client did not send a PIN share, does it use -pin? (%w)", ErrPIN, err)
+	}
+	peer, err := base64.StdEncoding.DecodeString(first.Pake)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrPIN, err)
+	}
+
+	w := pinScalar(pin)
+	y, share, err := pakeShare(w, pakeN)
+	if err != nil {
+		return err
+	}
+	k, err := pakeSecret(y, w, peer, pakeM)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrPIN, err)
+	}
+	keys, err := deriveKeys(c.sessionNonce(), peer, share, k, w.Bytes())
+	if err != nil {
+		return err
+	}
+	if err := c.writeJSON(conn, message{
+		Type: msgTypePake, Pake: base64.StdEncoding.EncodeToString(share), Confirm: confirmation(keys.hostConfirm),
+	}); err != nil {
+		return err
+	}
+
+	confirm, err := readPake(ctx, conn, c)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		return fmt.Errorf("%w: the client's PIN differs (%w)", ErrPIN, err)
+	}
+	if !checkConfirmation(keys.clientConfirm, confirm.Confirm) {
+		refusePIN(conn, "wrong PIN")
+		return fmt.Errorf("%w: the client's PIN differs (or the signaling was tampered with)", ErrPIN)
+	}
+	return c.seal(keys.hostSeal, keys.clientSeal)
+}
@@ -0,0 +1,158 @@
+package signaling
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+
+	"github.com/1ureka/roj1/internal/transport"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// MaxPaths caps the number of PeerConnections in a multipath session.
+const MaxPaths = 4
+
+// path is one PeerConnection of a session (private). Sessions have a single
+// path unless the host bonds several uplinks.
+type path struct {
+	tr        *transport.Transport
+	sender    *sender
+	peerReady chan struct{}
+}
+
+// newPath wires a Transport into a path whose ICE candidates are trickled
+// over conn through codec, tagged with the path index.
+func newPath(tr *transport.Transport, conn sigConn, mu *sync.Mutex, codec *codec, index int) *path {
+	s := &sender{tr: tr, conn: conn, mu: mu, codec: codec, path: index}
+
+	tr.OnICECandidate(func(c *webrtc.ICECandidate) {
+		if c != nil {
+			data, _ := json.Marshal(c.ToJSON())
+			s.sendCandidate(string(data)) // Error intentionally ignored: sendCandidate is best-effort.
+		}
+	})
+
+	return &path{tr: tr, sender: s, peerReady: make(chan struct{}, 1)}
+}
+
+// closePaths closes the Transports of all given paths.
+func closePaths(paths []*path) {
+	for _, p := range paths {
+		p.tr.Close()
+	}
+}
+
+// acceptPaths (client) collects the paths offered by the host, then
+// negotiates them (see negotiatePaths).
+func acceptPaths(ctx context.Context, r *receiver) candidate {
+	var paths []*path
+	for total := 1; len(paths) < total; {
+		select {
+		case p := <-r.offered:
+			paths = append(paths, p)
+			total, _ = r.announced()
+		case <-r.done:
+			closePaths(paths)
+			return candidate{name: webrtcName, err: fmt.Errorf("%w: %w", ErrSignaling, r.err)}
+		case <-ctx.Done():
+			closePaths(paths)
+			return candidate{name: webrtcName, err: context.Cause(ctx)}
+		}
+	}
+
+	_, mode := r.announced()
+	return negotiatePaths(ctx, r, paths, mode)
+}
+
+// closeStray (client) waits for watch to return, then closes the paths that
+// were offered but never picked up by acceptPaths.
+func (r *receiver) closeStray() {
+	<-r.done
+	for {
+		select {
+		case p := <-r.offered:
+			p.tr.Close()
+		default:
+			return
+		}
+	}
+}
+
+// negotiatePaths negotiates all paths in parallel. A single path that comes
+// up is used as is; several are bonded with the given mode. Like the
+// transport race, stragglers get standbyGrace after the first path is up.
+func negotiatePaths(ctx context.Context, r *receiver, paths []*path, mode transport.BondMode) candidate {
+	results := make(chan candidate, len(paths))
+	for _, p := range paths {
+		go func() { results <- negotiate(ctx, r, p) }()
+	}
+
+	cands, err := gather(ctx, results, len(paths))
+	if err != nil {
+		return candidate{name: webrtcName, err: err}
+	}
+	if len(cands) == 1 {
+		return cands[0]
+	}
+
+	trs := make([]transport.Carrier, len(cands))
+	for i, c := range cands {
+		trs[i] = c.tr
+	}
+	return candidate{
+		name: fmt.Sprintf("%s ×%d (%s)", webrtcName, len(cands), mode),
+		tr:   transport.NewBond(mode, trs...),
+	}
+}
+
+// negotiate waits for the path's DataChannel to open, then performs the
+// dual-flag handshake: wait for both sides to confirm the DataChannel open.
+// The Transport is closed if it does not come up.
+func negotiate(ctx context.Context, r *receiver, p *path) candidate {
+	fail := func(err error) candidate {
+		p.tr.Close()
+		return candidate{name: webrtcName, err: err}
+	}
+
+	select {
+	case <-p.tr.Ready():
+	case <-p.tr.Done():
+		return fail(fmt.Errorf("%w: %w", ErrNegotiation, p.tr.Err()))
+	case <-r.done:
+		return fail(fmt.Errorf("%w: %w", ErrSignaling, r.err))
+	case <-ctx.Done():
+		return fail(gaveUp(ctx, p.tr))
+	}
+
+	open := time.Now()
+	if err := p.sender.sendReady(); err != nil {
+		util.LogDebug("failed to send ready signal: %v", err)
+	}
+
+	select {
+	case <-p.peerReady:
+		util.LogDebug("peer confirmed ready")
+		util.EmitPhase(util.PhaseReady, open)
+	case <-time.After(readyTimeout):
+		util.LogDebug("peer ready timeout — proceeding")
+	case <-ctx.Done():
+		return fail(context.Cause(ctx))
+	}
+
+	return candidate{name: webrtcName, tr: p.tr}
+}
+
+// gaveUp returns why ctx ended while tr was coming up: its cause, noting
+// ErrICETimeout if it timed out during tr's ICE checks.
+func gaveUp(ctx context.Context, tr *transport.Transport) error {
+	err := context.Cause(ctx)
+	if errors.Is(err, ErrTimeout) && tr.ICEChecking() {
+		return fmt.Errorf("%w: %w", err, transport.ErrICETimeout)
+	}
+	return err
+}
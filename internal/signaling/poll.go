@@ -0,0 +1,499 @@
+package signaling
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// Some networks (corporate proxies, captive portals) break WebSockets while
+// plain HTTP still works. The host's WS server therefore also serves the
+// same signaling messages over HTTP long-polling, which the client falls
+// back to when the WebSocket upgrade fails:
+//
+//	POST   /poll       opens a session: {"session":id}
+//	POST   /poll/{id}  sends messages to the host: {"messages":[…]}
+//	GET    /poll/{id}  waits up to pollWait for the host's messages: {"messages":[…],"close":…}
+//	DELETE /poll/{id}  closes the session
+//
+// A session is a signaling connection like any other: it is handed to the
+// host, queued or refused the same way, and a close frame either side writes
+// reaches the other as a *websocket.CloseError.
+
+const (
+	pollWait    = 20 * time.Second          // a GET returns empty after this long, under common proxy timeouts
+	pollIdle    = 60 * time.Second          // a session the client stops polling is closed after this long
+	pollTimeout = pollWait + 15*time.Second // a request taking longer has failed
+
+	pollCloseTimeout = 2 * time.Second // how long closing a session waits for the host
+)
+
+// pollBatch is the body of POST and GET requests on a session.
+type pollBatch struct {
+	Messages []json.RawMessage `json:"messages,omitempty"`
+	Close    *pollClose        `json:"close,omitempty"`
+}
+
+// pollClose is a close frame carried over HTTP.
+type pollClose struct {
+	Code int    `json:"code"`
+	Text string `json:"text,omitempty"`
+}
+
+// closeFrame decodes a close message written with WriteMessage.
+func closeFrame(data []byte) *pollClose {
+	if len(data) < 2 {
+		return &pollClose{Code: websocket.CloseNoStatusReceived}
+	}
+	return &pollClose{Code: int(binary.BigEndian.Uint16(data)), Text: string(data[2:])}
+}
+
+// pollConn is the host's end of a polling session (private).
+type pollConn struct {
+	drop   func() // removes the session from its server
+	idle   *time.Timer
+	finish sync.Once     // runs drop once the session is closed and drained
+	inCh   chan struct{} // signalled when in or peerClose changes
+	outCh  chan struct{} // signalled when out or close changes
+	done   chan struct{} // closed by Close
+
+	mu        sync.Mutex
+	in        []json.RawMessage // client → host, not yet read
+	out       []json.RawMessage // host → client, not yet fetched
+	close     *pollClose        // written by the host, sent after out
+	peerClose *pollClose        // written by the client
+	closed    bool
+}
+
+func newPollConn(drop func()) *pollConn {
+	c := &pollConn{
+		drop: drop,
+		inCh: make(chan struct{}, 1), outCh: make(chan struct{}, 1), done: make(chan struct{}),
+	}
+	c.idle = time.AfterFunc(pollIdle, func() {
+		c.Close()
+		c.end()
+	})
+	return c
+}
+
+// end forgets the session: the client cannot fetch from it anymore.
+func (c *pollConn) end() {
+	c.finish.Do(func() {
+		c.idle.Stop()
+		c.drop()
+	})
+}
+
+// signal wakes a waiter on ch without blocking.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// ReadJSON reads the client's next message.
+func (c *pollConn) ReadJSON(v any) error {
+	for {
+		c.mu.Lock()
+		switch {
+		case len(c.in) > 0:
+			data := c.in[0]
+			c.in = c.in[1:]
+			c.mu.Unlock()
+			return json.Unmarshal(data, v)
+		case c.peerClose != nil:
+			c.mu.Unlock()
+			return &websocket.CloseError{Code: c.peerClose.Code, Text: c.peerClose.Text}
+		case c.closed:
+			c.mu.Unlock()
+			return net.ErrClosed
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-c.inCh:
+		case <-c.done:
+		}
+	}
+}
+
+// WriteJSON queues v for the client's next poll.
+func (c *pollConn) WriteJSON(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || c.close != nil {
+		return net.ErrClosed
+	}
+	c.out = append(c.out, data)
+	signal(c.outCh)
+	return nil
+}
+
+// WriteMessage sends a close frame; other messages are written as JSON text.
+func (c *pollConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != websocket.CloseMessage {
+		return c.WriteJSON(json.RawMessage(data))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || c.close != nil {
+		return net.ErrClosed
+	}
+	c.close = closeFrame(data)
+	signal(c.outCh)
+	return nil
+}
+
+// SetWriteDeadline is a no-op: writes only queue messages.
+func (c *pollConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+// Close ends the session. Messages and a close frame already written can
+// still be fetched, as from a WebSocket closed after writing them.
+func (c *pollConn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	drained := len(c.out) == 0 && c.close == nil
+	c.mu.Unlock()
+
+	if drained {
+		c.end()
+	}
+	return nil
+}
+
+// poll waits up to pollWait, or until ctx is done, for the host's messages.
+// It reports false once the session is closed and nothing is left to fetch.
+func (c *pollConn) poll(ctx context.Context) (pollBatch, bool) {
+	c.idle.Reset(pollIdle)
+	timer := time.NewTimer(pollWait)
+	defer timer.Stop()
+
+	for {
+		c.mu.Lock()
+		if len(c.out) > 0 || c.close != nil {
+			batch := pollBatch{Messages: c.out, Close: c.close}
+			c.out, c.close = nil, nil
+			closed := c.closed
+			c.mu.Unlock()
+			if batch.Close != nil || closed {
+				c.Close()
+				c.end()
+			}
+			return batch, true
+		}
+		closed := c.closed
+		c.mu.Unlock()
+		if closed {
+			c.end()
+			return pollBatch{}, false
+		}
+
+		select {
+		case <-c.outCh:
+		case <-c.done:
+		case <-timer.C:
+			return pollBatch{}, true
+		case <-ctx.Done():
+			return pollBatch{}, true
+		}
+	}
+}
+
+// push delivers the client's messages and close frame to the host. It
+// reports false if the session is closed.
+func (c *pollConn) push(batch pollBatch) bool {
+	c.idle.Reset(pollIdle)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	c.in = append(c.in, batch.Messages...)
+	if batch.Close != nil && c.peerClose == nil {
+		c.peerClose = batch.Close
+	}
+	signal(c.inCh)
+	return true
+}
+
+// handlePolls serves polling sessions on mux under base, next to the
+// WebSocket (see DefaultWSPath).
+func (s *server) handlePolls(mux *http.ServeMux, base string) {
+	s.polls = make(map[string]*pollConn)
+
+	mux.HandleFunc("POST "+base+"/poll", func(w http.ResponseWriter, r *http.Request) {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			http.Error(w, "failed to create session", http.StatusInternalServerError)
+			return
+		}
+		id := base64.RawURLEncoding.EncodeToString(b)
+		c := newPollConn(func() {
+			s.pollMu.Lock()
+			delete(s.polls, id)
+			s.pollMu.Unlock()
+		})
+		s.pollMu.Lock()
+		s.polls[id] = c
+		s.pollMu.Unlock()
+
+		util.LogDebug("signaling over HTTP polling with %s", r.RemoteAddr)
+		s.place(c)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"session": id})
+	})
+
+	session := func(w http.ResponseWriter, r *http.Request) *pollConn {
+		s.pollMu.Lock()
+		c := s.polls[r.PathValue("id")]
+		s.pollMu.Unlock()
+		if c == nil {
+			http.Error(w, "no such session", http.StatusGone)
+		}
+		return c
+	}
+
+	mux.HandleFunc("GET "+base+"/poll/{id}", func(w http.ResponseWriter, r *http.Request) {
+		c := session(w, r)
+		if c == nil {
+			return
+		}
+		batch, ok := c.poll(r.Context())
+		if !ok {
+			http.Error(w, "no such session", http.StatusGone)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(batch)
+	})
+
+	mux.HandleFunc("POST "+base+"/poll/{id}", func(w http.ResponseWriter, r *http.Request) {
+		c := session(w, r)
+		if c == nil {
+			return
+		}
+		var batch pollBatch
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, relayReadLimit)).Decode(&batch); err != nil {
+			http.Error(w, "invalid messages", http.StatusBadRequest)
+			return
+		}
+		if !c.push(batch) {
+			http.Error(w, "no such session", http.StatusGone)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("DELETE "+base+"/poll/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if c := session(w, r); c != nil {
+			c.push(pollBatch{Close: &pollClose{Code: websocket.CloseNormalClosure}})
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+}
+
+// pollURL returns the polling endpoint next to the WebSocket URL wsURL, or
+// "" if wsURL is not a host's WS server.
+func pollURL(wsURL string) string {
+	u, err := url.Parse(wsURL)
+	if err != nil || roomInPath(u.Path) != "" {
+		return "" // relays serve WebSockets only
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	default:
+		return ""
+	}
+	u.Path = basePath(u.Path) + "/poll"
+	u.RawQuery, u.Fragment = "", ""
+	return u.String()
+}
+
+// pollClient is the client's end of a polling session (private).
+type pollClient struct {
+	url    string // the session's endpoint
+	http   *http.Client
+	ctx    context.Context // cancelled by Close
+	cancel context.CancelFunc
+
+	pending []json.RawMessage // fetched, not yet read; only touched by the reader
+	closeBy error             // the host's close frame, returned once pending is read
+}
+
+// openPoll opens a polling session at endpoint.
+func openPoll(ctx context.Context, endpoint string) (*pollClient, error) {
+	c := &pollClient{http: &http.Client{Timeout: pollTimeout}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var opened struct {
+		Session string `json:"session"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP polling refused: %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&opened); err != nil || opened.Session == "" {
+		return nil, fmt.Errorf("HTTP polling refused: invalid session (%v)", err)
+	}
+	c.url = endpoint + "/" + opened.Session
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	return c, nil
+}
+
+// do sends a request on the session and returns the response body.
+func (c *pollClient) do(ctx context.Context, method string, batch *pollBatch) ([]byte, error) {
+	var body io.Reader
+	if batch != nil {
+		data, err := json.Marshal(batch)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.url, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, relayReadLimit))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusGone:
+		return nil, errors.New("HTTP polling session closed")
+	case resp.StatusCode/100 != 2:
+		return nil, fmt.Errorf("HTTP polling: %s", resp.Status)
+	}
+	return data, nil
+}
+
+// ReadJSON reads the host's next message, polling for more as needed.
+func (c *pollClient) ReadJSON(v any) error {
+	for len(c.pending) == 0 {
+		if c.closeBy != nil {
+			return c.closeBy
+		}
+		data, err := c.do(c.ctx, http.MethodGet, nil)
+		if err != nil {
+			return err
+		}
+		var batch pollBatch
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return err
+		}
+		c.pending = batch.Messages
+		if batch.Close != nil {
+			c.closeBy = &websocket.CloseError{Code: batch.Close.Code, Text: batch.Close.Text}
+		}
+	}
+	data := c.pending[0]
+	c.pending = c.pending[1:]
+	return json.Unmarshal(data, v)
+}
+
+// WriteJSON sends v to the host.
+func (c *pollClient) WriteJSON(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = c.do(c.ctx, http.MethodPost, &pollBatch{Messages: []json.RawMessage{data}})
+	return err
+}
+
+// WriteMessage sends a close frame; other messages are written as JSON text.
+func (c *pollClient) WriteMessage(messageType int, data []byte) error {
+	if messageType != websocket.CloseMessage {
+		return c.WriteJSON(json.RawMessage(data))
+	}
+	_, err := c.do(c.ctx, http.MethodPost, &pollBatch{Close: closeFrame(data)})
+	return err
+}
+
+// SetWriteDeadline is a no-op: each request has its own timeout.
+func (c *pollClient) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+// Close ends the session, telling the host unless it is already gone.
+func (c *pollClient) Close() error {
+	if c.ctx.Err() != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, pollCloseTimeout)
+	defer cancel()
+	c.do(ctx, http.MethodDelete, nil) // best effort: the host also expires idle sessions
+	c.cancel()
+	return nil
+}
+
+// dial connects to the host's signaling server at wsURL: over gRPC for
+// grpc:// and grpcs:// URLs (see grpc.go), otherwise over WebSocket, falling
+// back to HTTP polling if the upgrade fails.
+func dial(ctx context.Context, wsURL string) (sigConn, error) {
+	if u, err := url.Parse(wsURL); err == nil && (u.Scheme == "grpc" || u.Scheme == "grpcs") {
+		return dialGRPC(ctx, u)
+	}
+	conn, err := connect(ctx, wsURL)
+	if err == nil {
+		return conn, nil
+	}
+	if ctx.Err() != nil {
+		return nil, err
+	}
+	endpoint := pollURL(wsURL)
+	if endpoint == "" {
+		return nil, err
+	}
+	pc, perr := openPoll(ctx, endpoint)
+	if perr != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("%w; HTTP polling fallback: %w", err, perr)
+	}
+	util.LogWarning("WebSocket unavailable (%v) — signaling over HTTP polling instead", err)
+	return pc, nil
+}
@@ -0,0 +1,47 @@
+package signaling
+
+import (
+	"sync"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// followICE shows the ICE progress of the transports being established
+// (see util.EventICEProgress) on spinner until stop is called, so that a
+// slow establishment does not look like a hang. Without a terminal, where
+// each update prints a line, only changes of state are shown. The events
+// arrive on pion's goroutines while the caller keeps using spinner, which
+// util.Spinner allows.
+func followICE(spinner *util.Spinner) (stop func()) {
+	var (
+		mu    sync.Mutex
+		state string
+		done  bool
+	)
+	unsubscribe := util.SubscribeEvents(func(ev util.Event) {
+		if ev.Event != util.EventICEProgress {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if done || (!spinner.Animated() && ev.State == state) {
+			return
+		}
+		state = ev.State
+
+		switch ev.State {
+		case util.ICEGathering:
+			spinner.UpdateText(util.Trf("gathering ICE candidates — %d found...", ev.Local))
+		case util.ICEChecking:
+			spinner.UpdateText(util.Trf("checking connectivity between %d local and %d remote candidates...", ev.Local, ev.Remote))
+		case util.ICEConnected:
+			spinner.UpdateText(util.Trf("ICE connected via %s — securing the connection...", ev.Pair))
+		}
+	})
+	return func() {
+		unsubscribe()
+		mu.Lock()
+		done = true // events being delivered must not touch the spinner any more
+		mu.Unlock()
+	}
+}
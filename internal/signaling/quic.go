@@ -0,0 +1,183 @@
+package signaling
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/1ureka/roj1/internal/transport"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// QUIC transport: the direct transport over UDP instead of TCP, for peers
+// that can reach each other but not over TCP, or that prefer to skip the
+// TCP head-of-line blocking on lossy links. It shares the certificate and
+// token of the direct offer (see direct.go); the client opens one stream and
+// writes the token on it, and the tunnel then runs on that stream.
+
+const (
+	quicALPN        = "roj1"           // application protocol negotiated in the handshake
+	quicIdleTimeout = 30 * time.Second // a silent connection is dropped after this
+	quicKeepAlive   = 10 * time.Second // keeps NAT bindings open on an idle tunnel
+
+	quicRejected quic.ApplicationErrorCode = 1 // close code for a client with a wrong token
+)
+
+// quicConfig returns the QUIC settings both sides use.
+func quicConfig() *quic.Config {
+	return &quic.Config{
+		MaxIdleTimeout:  quicIdleTimeout,
+		KeepAlivePeriod: quicKeepAlive,
+	}
+}
+
+// listenQUIC starts a QUIC listener serving cert on the given UDP port of all
+// interfaces (0 = random).
+func listenQUIC(cert tls.Certificate, port int) (*quic.Listener, error) {
+	return quic.ListenAddr(fmt.Sprintf(":%d", port), &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{quicALPN},
+		MinVersion:   tls.VersionTLS13,
+	}, quicConfig())
+}
+
+// acceptQUIC waits for the client to connect over QUIC and present the
+// session token, returning the resulting StreamTransport (bound to ctx) as a
+// candidate. It gives up once raceCtx is done or the signaling connection has
+// closed.
+func (d *directListener) acceptQUIC(raceCtx, ctx context.Context, r *receiver) candidate {
+	go func() {
+		select {
+		case <-raceCtx.Done():
+		case <-r.done:
+		}
+		d.quic.Close() // leaves the accepted connection open
+	}()
+
+	for {
+		conn, err := d.quic.Accept(context.Background())
+		if err != nil {
+			return candidate{name: quicName, err: fmt.Errorf("%w: %w", ErrNegotiation, err)}
+		}
+
+		stream, err := d.verifyQUIC(conn)
+		if err != nil {
+			util.LogDebug("rejected QUIC connection from %s: %v", conn.RemoteAddr(), err)
+			conn.CloseWithError(quicRejected, "")
+			continue
+		}
+
+		util.LogDebug("QUIC connection accepted from %s", conn.RemoteAddr())
+		return candidate{name: quicName, tr: transport.NewQUICTransport(ctx, conn, stream)}
+	}
+}
+
+// verifyQUIC accepts the client's stream and checks the session token on it.
+func (d *directListener) verifyQUIC(conn *quic.Conn) (*quic.Stream, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), directAuthTimeout)
+	defer cancel()
+
+	stream, err := conn.AcceptStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stream.SetReadDeadline(time.Now().Add(directAuthTimeout))
+	defer stream.SetReadDeadline(time.Time{})
+
+	buf := make([]byte, len(d.token))
+	if _, err := io.ReadFull(stream, buf); err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(buf, []byte(d.token)) != 1 {
+		return nil, errors.New("invalid token")
+	}
+	return stream, nil
+}
+
+// dialQUIC dials the QUIC addresses of the host's direct offer msg, returning
+// the resulting StreamTransport (bound to ctx) as a candidate. It returns an
+// empty candidate if msg offers none, as from a host without QUIC.
+func dialQUIC(raceCtx, ctx context.Context, msg message) candidate {
+	if len(msg.QUIC) == 0 {
+		return candidate{}
+	}
+
+	conn, stream, err := dialAnyQUIC(raceCtx, msg)
+	if err != nil {
+		return candidate{name: quicName, err: fmt.Errorf("%w: %w", ErrNegotiation, err)}
+	}
+
+	util.LogDebug("QUIC connection established to %s", conn.RemoteAddr())
+	return candidate{name: quicName, tr: transport.NewQUICTransport(ctx, conn, stream)}
+}
+
+// dialAnyQUIC dials all offered QUIC addresses concurrently and keeps the
+// first one that completes the handshake with the pinned certificate and
+// accepts the token.
+func dialAnyQUIC(ctx context.Context, msg message) (*quic.Conn, *quic.Stream, error) {
+	ctx, cancel := context.WithTimeout(ctx, directDialTimeout)
+	defer cancel()
+
+	tlsConf := &tls.Config{
+		// The certificate is self-signed; it is verified by fingerprint instead.
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: pinnedCert(msg.Fingerprint),
+		NextProtos:            []string{quicALPN},
+		MinVersion:            tls.VersionTLS13,
+	}
+
+	type result struct {
+		conn   *quic.Conn
+		stream *quic.Stream
+		err    error
+	}
+	results := make(chan result, len(msg.QUIC))
+
+	for _, addr := range msg.QUIC {
+		go func() {
+			conn, err := quic.DialAddr(ctx, addr, tlsConf, quicConfig())
+			if err != nil {
+				results <- result{err: err}
+				return
+			}
+			stream, err := conn.OpenStreamSync(ctx)
+			if err == nil {
+				stream.SetWriteDeadline(time.Now().Add(directAuthTimeout))
+				_, err = io.WriteString(stream, msg.Token)
+				stream.SetWriteDeadline(time.Time{})
+			}
+			if err != nil {
+				conn.CloseWithError(0, "")
+				results <- result{err: err}
+				return
+			}
+			results <- result{conn, stream, nil}
+		}()
+	}
+
+	var won result
+	var lastErr error
+	for range msg.QUIC {
+		res := <-results
+		switch {
+		case res.err != nil:
+			lastErr = res.err
+		case won.conn == nil:
+			won = res
+			cancel() // abort the remaining attempts
+		default:
+			res.conn.CloseWithError(0, "")
+		}
+	}
+
+	if won.conn == nil {
+		return nil, nil, lastErr
+	}
+	return won.conn, won.stream, nil
+}
@@ -0,0 +1,115 @@
+package signaling
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/1ureka/roj1/internal/transport"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// standbyGrace is how long establishment keeps waiting for the remaining
+// transports once the first one is up, so they can serve as failover standbys.
+const standbyGrace = 2 * time.Second
+
+// Candidate transport names, as shown to the user.
+const (
+	webrtcName = "WebRTC"
+	directName = "direct TLS"
+	quicName   = "QUIC"
+)
+
+// candidate is the outcome of one transport racing to come up (private). A
+// zero candidate means the transport was not offered and is skipped.
+type candidate struct {
+	name string
+	tr   transport.Carrier
+	err  error
+}
+
+// gather collects n candidates from results and returns those that come up,
+// fastest first. Once the first one is up, the others get standbyGrace to
+// join; later arrivals are closed. Each candidate producer must send exactly
+// one result and give up once ctx is done.
+//
+// Returns the first candidate error if none came up, once every candidate has
+// given up.
+func gather(ctx context.Context, results <-chan candidate, n int) ([]candidate, error) {
+	var (
+		up      []candidate
+		first   error
+		grace   <-chan time.Time
+		pending = n
+	)
+
+loop:
+	for pending > 0 {
+		select {
+		case c := <-results:
+			pending--
+			switch {
+			case c.err != nil:
+				util.LogDebug("%s transport failed: %v", c.name, c.err)
+				if first == nil {
+					first = c.err
+				}
+			case c.tr == nil:
+				// Not offered.
+			default:
+				if up == nil {
+					grace = time.After(standbyGrace)
+				}
+				up = append(up, c)
+			}
+		case <-grace:
+			break loop
+		case <-ctx.Done():
+			if up == nil {
+				first = context.Cause(ctx)
+			}
+			break loop
+		}
+	}
+
+	// Candidates still racing have lost; close them if they come up late.
+	// Without a winner, ctx is done and they are about to give up: wait for
+	// them, so nothing of a failed or cancelled race outlives it.
+	drain := func() {
+		for ; pending > 0; pending-- {
+			c := <-results
+			switch {
+			case c.tr != nil:
+				c.tr.Close()
+			case up == nil && c.err != first && errors.Is(c.err, first):
+				first = c.err // more on why ctx ran out, such as ErrICETimeout
+			}
+		}
+	}
+	if up != nil {
+		go drain()
+	} else {
+		drain()
+	}
+
+	if up == nil {
+		if first == nil {
+			first = fmt.Errorf("%w: no transport available", ErrNegotiation)
+		}
+		return nil, first
+	}
+	return up, nil
+}
+
+// bundle wraps the candidates in a Failover, in order of preference, and
+// returns it with their names.
+func bundle(cands []candidate) (*transport.Failover, []string) {
+	f := transport.NewFailover()
+	names := make([]string, len(cands))
+	for i, c := range cands {
+		f.Add(c.tr)
+		names[i] = c.name
+	}
+	return f, names
+}
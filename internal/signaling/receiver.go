@@ -1,67 +1,244 @@
 package signaling
 
 import (
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/pion/webrtc/v4"
 
+	"github.com/1ureka/roj1/internal/identity"
 	"github.com/1ureka/roj1/internal/transport"
+	"github.com/1ureka/roj1/internal/util"
 )
 
 // receiver processes incoming signaling messages from the WebSocket (private).
 type receiver struct {
-	tr        *transport.Transport
-	conn      *websocket.Conn
-	sender    *sender
-	peerReady chan struct{}
+	conn sigConn
+
+	mu    sync.Mutex
+	paths map[int]*path
+	total int                // client: number of paths announced by the host
+	mode  transport.BondMode // client: bond mode announced by the host
+
+	// newPath creates the path for an offer with an unknown index (client
+	// only; nil on host). Created paths are announced on offered.
+	newPath func(index int) (*path, error)
+	offered chan *path
+
+	direct chan message  // client: the host's direct offer, or an empty message if none (nil on host)
+	done   chan struct{} // closed when watch returns
+
+	wsMu          *sync.Mutex // guards writes to conn, shared with the senders
+	codec         *codec      // reads and writes messages on conn, shared with the senders
+	version       string      // this side's version, compared with the peer's hello
+	strictVersion bool        // refuse a peer with a different major version
+	answerHello   bool        // host: reply to the client's hello with ours
+	connected     time.Time   // when the signaling connection came up, the start of the sdp phase
+	onHello       func()      // host: called when the client's hello arrives (nil = none)
+	sdpOnce       sync.Once
+
+	key        ed25519.PrivateKey       // this side's identity (nil = none)
+	challenge  string                   // sent in our hello for the peer to sign ("" = none)
+	authorized *identity.AuthorizedKeys // host: client keys to accept (nil = no authentication)
+	authed     chan struct{}            // host: closed once the client is authenticated
+	onAuth     func(identity.AuthorizedKey)
+	onPeerKey  func(ed25519.PublicKey)
+	knownHosts string // client: known hosts file ("" = do not pin)
+	hostName   string // client: host:port the host's key is pinned for
+
+	// The peer's side of the SDP signatures (see signSDP), guarded by mu.
+	peerChallenge string            // from the peer's hello ("" = it signs nothing of ours)
+	peerKey       ed25519.PublicKey // proven in the peer's hello or auth (nil = its SDPs are not checked)
+	greeted       chan struct{}     // host: closed once the client's hello is answered
+
+	err error // why watch returned; valid once done is closed
 }
 
-// watch reads signaling messages in a loop and applies them to the Transport.
-func (r *receiver) watch() error {
+// watch reads signaling messages in a loop and applies them to their path's
+// Transport, until the connection fails or a message cannot be applied.
+func (r *receiver) watch() {
+	defer close(r.done)
+
 	for {
 		var msg message
-		if err := r.conn.ReadJSON(&msg); err != nil {
-			return fmt.Errorf("failed to read WS message: %w", err)
+		if err := r.codec.readJSON(r.conn, &msg); err != nil {
+			var closed *websocket.CloseError
+			switch {
+			case errors.Is(err, ErrReplay):
+				r.refuse(ErrReplay.Error())
+			case errors.As(err, &closed), errors.Is(err, io.EOF):
+				err = fmt.Errorf("%w: %w", transport.ErrPeerClosed, err)
+			}
+			r.err = fmt.Errorf("failed to read WS message: %w", err)
+			return
+		}
+		if err := r.handle(msg); err != nil {
+			r.err = err
+			return
 		}
+	}
+}
 
-		switch msg.Type {
-		// Handle offer: set as remote description and respond with an answer.
-		case msgTypeOffer:
-			if err := r.tr.SetRemoteDescription(webrtc.SessionDescription{
-				Type: webrtc.SDPTypeOffer, SDP: msg.SDP,
-			}); err != nil {
+// handle applies a single signaling message.
+func (r *receiver) handle(msg message) error {
+	// Handle hello: the peer announces its version and proves its key. The
+	// host answers first, so a client it refuses still learns why.
+	if msg.Type == msgTypeHello {
+		if r.onHello != nil {
+			r.onHello()
+		}
+		if r.answerHello {
+			if err := r.answerClientHello(msg); err != nil {
 				return err
 			}
-			if err := r.sender.sendAnswer(); err != nil {
-				return err
+			if r.greeted != nil {
+				select {
+				case <-r.greeted:
+				default:
+					close(r.greeted)
+				}
 			}
+		}
+		if err := checkVersion(r.version, msg.Version, r.strictVersion); err != nil {
+			return err
+		}
+		if !r.answerHello {
+			return r.checkHost(msg)
+		}
+		return nil
+	}
 
-		// Handle answer: set as remote description.
-		case msgTypeAnswer:
-			if err := r.tr.SetRemoteDescription(webrtc.SessionDescription{
-				Type: webrtc.SDPTypeAnswer, SDP: msg.SDP,
-			}); err != nil {
-				return err
-			}
+	// Handle pake: only sent first, by a client with a PIN to a host that
+	// would have answered it (see acceptPIN).
+	if msg.Type == msgTypePake {
+		r.refuse("this host uses no PIN")
+		return fmt.Errorf("%w: the client uses a PIN, but this host has none (see -pin)", ErrPIN)
+	}
 
-		// Handle ICE candidate: add to the PeerConnection.
-		case msgTypeCandidate:
-			var init webrtc.ICECandidateInit
-			if err := json.Unmarshal([]byte(msg.Candidate), &init); err != nil {
-				return fmt.Errorf("failed to parse ICE candidate: %w", err)
-			}
-			if err := r.tr.AddICECandidate(init); err != nil {
-				return err
-			}
+	// Handle auth: the client answers the host's challenge.
+	if msg.Type == msgTypeAuth {
+		return r.checkClient(msg)
+	}
 
-		// Handle ready: peer's DataChannel is open.
-		case msgTypeReady:
-			select {
-			case r.peerReady <- struct{}{}:
-			default:
-			}
+	// Handle direct: the host offers a direct transport.
+	if msg.Type == msgTypeDirect {
+		select {
+		case r.direct <- msg:
+		default:
+		}
+		return nil
+	}
+
+	p, err := r.path(msg)
+	if err != nil {
+		return err
+	}
+
+	switch msg.Type {
+	// Handle offer: set as remote description and respond with an answer.
+	// The host sends its direct offer first, so an offer without one
+	// means no direct transport is available.
+	case msgTypeOffer:
+		select {
+		case r.direct <- message{}:
+		default:
+		}
+		if err := r.checkSDP(roleHostSDP, msg.Signature, msg.Path, msg.SDP); err != nil {
+			return err
+		}
+		if err := p.tr.SetRemoteDescription(webrtc.SessionDescription{
+			Type: webrtc.SDPTypeOffer, SDP: msg.SDP,
+		}); err != nil {
+			return err
+		}
+		if err := p.sender.sendAnswer(msg.SDP); err != nil {
+			return err
+		}
+		r.sdpDone()
+
+	// Handle answer: set as remote description.
+	case msgTypeAnswer:
+		if err := r.checkSDP(roleClientSDP, msg.Signature, msg.Path, p.sender.sentOffer(), msg.SDP); err != nil {
+			return err
+		}
+		if err := p.tr.SetRemoteDescription(webrtc.SessionDescription{
+			Type: webrtc.SDPTypeAnswer, SDP: msg.SDP,
+		}); err != nil {
+			return err
+		}
+		r.sdpDone()
+
+	// Handle ICE candidate: add to the PeerConnection.
+	case msgTypeCandidate:
+		var init webrtc.ICECandidateInit
+		if err := json.Unmarshal([]byte(msg.Candidate), &init); err != nil {
+			return fmt.Errorf("failed to parse ICE candidate: %w", err)
+		}
+		if err := p.tr.AddICECandidate(init); err != nil {
+			return err
+		}
+
+	// Handle ready: peer's DataChannel is open.
+	case msgTypeReady:
+		select {
+		case p.peerReady <- struct{}{}:
+		default:
 		}
 	}
+	return nil
+}
+
+// sdpDone emits the sdp phase once the first offer and answer have been
+// applied.
+func (r *receiver) sdpDone() {
+	r.sdpOnce.Do(func() { util.EmitPhase(util.PhaseSDP, r.connected) })
+}
+
+// path returns the path a message is addressed to. On the client, the first
+// offer for a new index creates the path.
+func (r *receiver) path(msg message) (*path, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if p, ok := r.paths[msg.Path]; ok {
+		return p, nil
+	}
+	if msg.Type != msgTypeOffer || r.newPath == nil {
+		return nil, fmt.Errorf("%s message for unknown path %d", msg.Type, msg.Path)
+	}
+	if msg.Path < 0 || msg.Path >= MaxPaths || msg.Paths > MaxPaths {
+		return nil, fmt.Errorf("invalid path %d of %d", msg.Path, msg.Paths)
+	}
+
+	mode := transport.BondStripe
+	if msg.Bond != "" {
+		var err error
+		if mode, err = transport.ParseBondMode(msg.Bond); err != nil {
+			return nil, err
+		}
+	}
+
+	p, err := r.newPath(msg.Path)
+	if err != nil {
+		return nil, err
+	}
+	r.paths[msg.Path] = p
+	r.total = max(msg.Paths, 1)
+	r.mode = mode
+	r.offered <- p // never blocks: at most MaxPaths distinct paths
+
+	return p, nil
+}
+
+// announced returns the number of paths and bond mode announced by the host.
+func (r *receiver) announced() (int, transport.BondMode) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.total, r.mode
 }
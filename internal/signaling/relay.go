@@ -0,0 +1,393 @@
+package signaling
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// A rendezvous relay lets a host and a client meet without either reaching
+// the other's WS server: the host opens a room named by a short code, the
+// client joins it by that code, and the relay forwards signaling messages
+// between them until the tunnel is up. Tunnel traffic never goes through the
+// relay.
+
+const (
+	roomWaitTimeout = time.Hour        // an unjoined room is closed after this long
+	roomPairTimeout = 2 * time.Minute  // a joined room is closed after this long; signaling takes seconds
+	roomPingPeriod  = 30 * time.Second // keeps idle rooms open through proxies
+	relayReadLimit  = 1 << 20          // largest signaling message forwarded
+	relayMissLimit  = 20               // joins of missing rooms allowed per client IP per minute
+	relayRoomLimit  = 16               // rooms open at once per host IP
+)
+
+// roomWords are the word lists room codes are built from.
+var roomWords = [2][]string{
+	{"amber", "bold", "blue", "brave", "calm", "clever", "coral", "crisp",
+		"dusty", "eager", "fancy", "gentle", "golden", "green", "happy", "jolly",
+		"kind", "lively", "lucky", "mellow", "misty", "noble", "proud", "quiet",
+		"rapid", "red", "rosy", "shy", "silver", "sunny", "swift", "witty"},
+	{"badger", "bear", "beaver", "bison", "cobra", "crane", "dingo", "eagle",
+		"falcon", "ferret", "gecko", "heron", "ibis", "koala", "lemur", "lynx",
+		"marten", "moose", "newt", "otter", "owl", "panda", "parrot", "puffin",
+		"quail", "raven", "robin", "seal", "tiger", "turtle", "walrus", "zebra"},
+}
+
+// roomPattern matches room codes such as "blue-falcon-421573".
+var roomPattern = regexp.MustCompile(`^[a-z]+-[a-z]+-[1-9][0-9]{5}$`)
+
+// NewRoom returns a random room code such as "blue-falcon-421573", one of
+// about 900 million. Codes are still short enough to read out, and a relay
+// only limits how fast they can be tried, so a host behind a relay also
+// requires a PIN or authorized keys.
+func NewRoom() (string, error) {
+	adj, err := rand.Int(rand.Reader, big.NewInt(int64(len(roomWords[0]))))
+	if err != nil {
+		return "", err
+	}
+	noun, err := rand.Int(rand.Reader, big.NewInt(int64(len(roomWords[1]))))
+	if err != nil {
+		return "", err
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(900000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%s-%d", roomWords[0][adj.Int64()], roomWords[1][noun.Int64()], n.Int64()+100000), nil
+}
+
+// ValidRoom reports whether s has the form of a room code.
+func ValidRoom(s string) bool {
+	return roomPattern.MatchString(s)
+}
+
+// RoomURL returns the WebSocket URL of a room on the relay at base (ws://,
+// wss://, http:// or https://; wss:// when no scheme is given) for the given
+// role, "host" or "client".
+func RoomURL(base, room, role string) (string, error) {
+	base = strings.TrimSpace(base)
+	if !strings.Contains(base, "://") {
+		base = "wss://" + base
+	}
+	u, err := url.Parse(base)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid relay URL: %s", base)
+	}
+	switch u.Scheme {
+	case "ws", "wss":
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("invalid relay URL: %s", base)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/rooms/" + room
+	u.RawQuery = url.Values{"role": {role}}.Encode()
+	u.Fragment = ""
+	return u.String(), nil
+}
+
+// roomInPath returns the room code of a relay URL path ending in
+// "/rooms/<code>", or "" if p is not one.
+func roomInPath(p string) string {
+	i := strings.LastIndex(p, "/rooms/")
+	if i < 0 || !ValidRoom(p[i+len("/rooms/"):]) {
+		return ""
+	}
+	return p[i+len("/rooms/"):]
+}
+
+// awaitRoomClient opens room on the relay and waits for a client to join it,
+// returning the connection signaling continues on.
+func awaitRoomClient(ctx context.Context, spinner *util.Spinner, relay, room string) (*websocket.Conn, error) {
+	roomURL, err := RoomURL(relay, room, "host")
+	if err != nil {
+		spinner.Fail(util.Tr("failed to open a room on the relay"))
+		return nil, fmt.Errorf("%w: %w", ErrSignaling, err)
+	}
+	conn, err := connect(ctx, roomURL)
+	if err != nil {
+		spinner.Fail(util.Tr("failed to open a room on the relay"))
+		if ctx.Err() != nil {
+			return nil, context.Cause(ctx)
+		}
+		return nil, fmt.Errorf("%w: %w", ErrSignaling, err)
+	}
+
+	util.EmitEvent(util.Event{Event: util.EventRoomOpened, Room: room})
+	spinner.UpdateText(util.Trf("room %s open on the relay — waiting for client...", room))
+
+	// The relay sends nothing until a client has joined.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	var msg message
+	err = conn.ReadJSON(&msg)
+	if !stop() {
+		spinner.Fail(util.Tr("failed while waiting for client connection"))
+		return nil, context.Cause(ctx)
+	}
+	if err == nil && msg.Type != msgTypePaired {
+		err = fmt.Errorf("unexpected message type %q", msg.Type)
+	}
+	if err != nil {
+		conn.Close()
+		spinner.Fail(util.Tr("failed while waiting for client connection"))
+		return nil, fmt.Errorf("%w: relay closed room %s: %w", ErrSignaling, room, err)
+	}
+	return conn, nil
+}
+
+// Relay is a rendezvous relay, serving rooms at ".../rooms/<code>?role=host"
+// and "?role=client". A room holds one host until one client joins it; the
+// code is then free again, so a persistent host can reopen it for its next
+// client. The relay sees signaling messages but not tunnel traffic.
+type Relay struct {
+	mu     sync.Mutex
+	rooms  map[string]*room
+	hosts  map[string]int // open rooms per host IP, joined ones included
+	misses map[string]int // joins of missing rooms per client IP in the current window
+	window time.Time      // start of the current misses window
+}
+
+// room is a host waiting on the relay.
+type room struct {
+	host   *websocket.Conn
+	joined chan *websocket.Conn // receives the client that joined
+
+	mu     sync.Mutex
+	client *websocket.Conn // set once joined; the host's messages go here
+}
+
+// NewRelay returns an empty relay.
+func NewRelay() *Relay {
+	return &Relay{rooms: make(map[string]*room), hosts: make(map[string]int), misses: make(map[string]int)}
+}
+
+// remoteIP returns the IP address r came from.
+func remoteIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// ServeHTTP implements http.Handler.
+func (rl *Relay) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	code := roomInPath(r.URL.Path)
+	if code == "" {
+		http.Error(w, "invalid room code", http.StatusNotFound)
+		return
+	}
+
+	switch r.URL.Query().Get("role") {
+	case "host":
+		rl.serveHost(w, r, code)
+	case "client":
+		rl.serveClient(w, r, code)
+	default:
+		http.Error(w, "role must be host or client", http.StatusBadRequest)
+	}
+}
+
+// serveHost opens a room, waits for its client and forwards messages between
+// the two. A host IP may hold relayRoomLimit rooms at once, so that one
+// machine cannot take up the codes.
+func (rl *Relay) serveHost(w http.ResponseWriter, r *http.Request, code string) {
+	rm := &room{joined: make(chan *websocket.Conn, 1)}
+	ip := remoteIP(r)
+
+	rl.mu.Lock()
+	_, taken := rl.rooms[code]
+	full := rl.hosts[ip] >= relayRoomLimit
+	if !taken && !full {
+		rl.rooms[code] = rm
+		rl.hosts[ip]++
+	}
+	rl.mu.Unlock()
+	switch {
+	case taken:
+		http.Error(w, "room "+code+" is already open", http.StatusConflict)
+		return
+	case full:
+		http.Error(w, "too many rooms open from this address", http.StatusTooManyRequests)
+		return
+	}
+	defer func() {
+		rl.mu.Lock()
+		if rl.hosts[ip]--; rl.hosts[ip] == 0 {
+			delete(rl.hosts, ip)
+		}
+		rl.mu.Unlock()
+	}()
+
+	host, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		rl.closeRoom(code, rm)
+		return
+	}
+	rl.mu.Lock()
+	rm.host = host // clients can join from now on
+	rl.mu.Unlock()
+	host.SetReadLimit(relayReadLimit)
+	util.LogDebug("relay: room %s opened by %s", code, r.RemoteAddr)
+
+	// Reading the host notices it leaving; once joined, what it sends is
+	// forwarded to the client.
+	left := make(chan struct{})
+	go func() {
+		defer close(left)
+		rm.forward(host, func() *websocket.Conn {
+			rm.mu.Lock()
+			defer rm.mu.Unlock()
+			return rm.client
+		})
+	}()
+
+	wait := time.NewTimer(roomWaitTimeout)
+	defer wait.Stop()
+	ping := time.NewTicker(roomPingPeriod)
+	defer ping.Stop()
+
+	for {
+		select {
+		case client := <-rm.joined:
+			if client == nil {
+				host.Close()
+				return
+			}
+			ping.Stop()
+			rm.pair(code, client)
+			return
+
+		case <-ping.C:
+			host.WriteControl(websocket.PingMessage, nil, time.Now().Add(roomPingPeriod))
+
+		case <-wait.C:
+			if !rl.closeRoom(code, rm) {
+				continue // a client is joining
+			}
+			util.LogDebug("relay: room %s expired", code)
+			host.WriteMessage(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, "no client joined"))
+			host.Close()
+			return
+
+		case <-left:
+			util.LogDebug("relay: room %s closed by its host", code)
+			if !rl.closeRoom(code, rm) {
+				if client := <-rm.joined; client != nil {
+					client.Close()
+				}
+			}
+			host.Close()
+			return
+		}
+	}
+}
+
+// pair tells the host that client joined and forwards the client's messages
+// to it until either side leaves or roomPairTimeout elapses.
+func (rm *room) pair(code string, client *websocket.Conn) {
+	defer rm.host.Close()
+	defer client.Close()
+
+	util.LogDebug("relay: room %s joined by a client", code)
+	deadline := time.Now().Add(roomPairTimeout)
+	rm.host.SetReadDeadline(deadline)
+	client.SetReadDeadline(deadline)
+	client.SetReadLimit(relayReadLimit)
+
+	// The host hears of the client before any of its messages.
+	if err := rm.host.WriteJSON(message{Type: msgTypePaired}); err != nil {
+		return
+	}
+	rm.mu.Lock()
+	rm.client = client
+	rm.mu.Unlock()
+
+	rm.forward(client, func() *websocket.Conn { return rm.host })
+}
+
+// forward copies messages read from src to dst() until src fails; messages
+// arriving while dst() is nil are dropped. Writing to dst is left to this
+// goroutine alone. When src fails, dst is closed too.
+func (rm *room) forward(src *websocket.Conn, dst func() *websocket.Conn) {
+	for {
+		typ, data, err := src.ReadMessage()
+		if err != nil {
+			if d := dst(); d != nil {
+				d.Close()
+			}
+			return
+		}
+		if d := dst(); d != nil {
+			if err := d.WriteMessage(typ, data); err != nil {
+				src.Close()
+				return
+			}
+		}
+	}
+}
+
+// serveClient joins an open room.
+func (rl *Relay) serveClient(w http.ResponseWriter, r *http.Request, code string) {
+	ip := remoteIP(r)
+
+	rl.mu.Lock()
+	if time.Since(rl.window) > time.Minute {
+		clear(rl.misses)
+		rl.window = time.Now()
+	}
+	if rl.misses[ip] >= relayMissLimit {
+		rl.mu.Unlock()
+		http.Error(w, "too many attempts, try again in a minute", http.StatusTooManyRequests)
+		return
+	}
+	rm, ok := rl.rooms[code]
+	ok = ok && rm.host != nil
+	if ok {
+		delete(rl.rooms, code) // one client per room
+	} else {
+		rl.misses[ip]++
+	}
+	rl.mu.Unlock()
+
+	if !ok {
+		http.Error(w, "no host is waiting in room "+code, http.StatusNotFound)
+		return
+	}
+
+	client, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		rm.joined <- nil // the room is spent; the host opens it again
+		return
+	}
+	rm.joined <- client
+}
+
+// closeRoom removes rm if it is still the room open under code, and reports
+// whether it was; if not, a client has taken it and is about to be sent on
+// rm.joined.
+func (rl *Relay) closeRoom(code string, rm *room) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if rl.rooms[code] != rm {
+		return false
+	}
+	delete(rl.rooms, code)
+	return true
+}
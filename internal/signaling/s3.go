@@ -0,0 +1,159 @@
+package signaling
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// s3Store keeps the files of a dead drop as objects in an S3 bucket, signing
+// its requests with AWS Signature Version 4.
+type s3Store struct {
+	client *http.Client
+	base   string // the bucket's URL
+	prefix string // key prefix, "" or ending in /
+	region string
+
+	accessKey, secretKey, sessionToken string
+}
+
+// newS3Store returns the store for the drop u, s3://<bucket>/<prefix>.
+func newS3Store(u *url.URL, cfg DropConfig) *s3Store {
+	s := &s3Store{
+		client:       &http.Client{},
+		region:       cfg.Region,
+		accessKey:    cfg.AccessKey,
+		secretKey:    cfg.SecretKey,
+		sessionToken: cfg.SessionToken,
+	}
+	if s.region == "" {
+		s.region = "us-east-1"
+	}
+	if prefix := strings.Trim(u.Path, "/"); prefix != "" {
+		s.prefix = prefix + "/"
+	}
+	if cfg.Endpoint != "" {
+		s.base = strings.TrimSuffix(cfg.Endpoint, "/") + "/" + awsEscape(u.Host)
+	} else {
+		s.base = "https://" + u.Host + ".s3." + s.region + ".amazonaws.com"
+	}
+	return s
+}
+
+func (s *s3Store) get(ctx context.Context, name string) ([]byte, error) {
+	data, status, err := s.do(ctx, http.MethodGet, name, nil)
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (s *s3Store) put(ctx context.Context, name string, data []byte) error {
+	_, _, err := s.do(ctx, http.MethodPut, name, data)
+	return err
+}
+
+// do sends a signed request for the object name, returning its body and
+// status.
+func (s *s3Store) do(ctx context.Context, method, name string, body []byte) ([]byte, int, error) {
+	var key []string
+	for _, seg := range strings.Split(s.prefix+name, "/") {
+		key = append(key, awsEscape(seg))
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.base+"/"+strings.Join(key, "/"), bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	s.sign(req, body, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, matrixReadLimit))
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Code    string
+			Message string
+		}
+		if xml.Unmarshal(data, &e) != nil || e.Code == "" {
+			return nil, resp.StatusCode, fmt.Errorf("S3: %s", resp.Status)
+		}
+		return nil, resp.StatusCode, fmt.Errorf("S3: %s (%s)", e.Message, e.Code)
+	}
+	return data, resp.StatusCode, nil
+}
+
+// sign adds the headers of AWS Signature Version 4 to req, whose body is
+// body, at time t.
+func (s *s3Store) sign(req *http.Request, body []byte, t time.Time) {
+	stamp := t.UTC().Format("20060102T150405Z")
+	date := stamp[:8]
+	payload := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	// Header names sort as they are listed.
+	names := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	headers := "host:" + req.URL.Host + "\nx-amz-content-sha256:" + payload + "\nx-amz-date:" + stamp + "\n"
+	if s.sessionToken != "" {
+		names = append(names, "x-amz-security-token")
+		headers += "x-amz-security-token:" + s.sessionToken + "\n"
+	}
+	signed := strings.Join(names, ";")
+	canonical := strings.Join([]string{req.Method, req.URL.EscapedPath(), req.URL.RawQuery, headers, signed, payload}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+	key := []byte("AWS4" + s.secretKey)
+	for _, part := range []string{date, s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signed, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+// awsEscape percent-encodes s as AWS signatures expect: everything but
+// unreserved characters.
+func awsEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
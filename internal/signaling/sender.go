@@ -3,27 +3,34 @@ package signaling
 import (
 	"sync"
 
-	"github.com/gorilla/websocket"
-
 	"github.com/1ureka/roj1/internal/transport"
 )
 
-// sender serializes outgoing signaling messages to the WebSocket (private).
+// sender serializes outgoing signaling messages of one path to the WebSocket
+// (private). All senders on a connection share its mutex.
 type sender struct {
-	tr   *transport.Transport
-	conn *websocket.Conn
-	mu   sync.Mutex
+	tr    *transport.Transport
+	conn  sigConn
+	mu    *sync.Mutex
+	codec *codec // shared by all senders on the connection
+	path  int
+
+	// sign signs the path's SDPs for the peer, "" for none (see
+	// receiver.signSDP); nil signs nothing.
+	sign  func(role string, path int, sdps ...string) string
+	offer string // the offer sent, guarded by mu
 }
 
 // send writes a signaling message to the WebSocket, guarded by a mutex.
 func (s *sender) send(msg message) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return s.conn.WriteJSON(msg)
+	return s.codec.writeJSON(s.conn, msg)
 }
 
-// sendOffer creates an SDP offer, sets it as local description, and sends it.
-func (s *sender) sendOffer() error {
+// sendOffer creates an SDP offer, sets it as local description, and sends it
+// along with the session's path count and bond mode.
+func (s *sender) sendOffer(paths int, mode transport.BondMode) error {
 	offer, err := s.tr.CreateOffer()
 	if err != nil {
 		return err
@@ -33,11 +40,34 @@ func (s *sender) sendOffer() error {
 		return err
 	}
 
-	return s.send(message{Type: msgTypeOffer, SDP: offer.SDP})
+	s.mu.Lock()
+	s.offer = offer.SDP
+	s.mu.Unlock()
+	return s.send(message{
+		Type: msgTypeOffer, SDP: offer.SDP,
+		Path: s.path, Paths: paths, Bond: mode.String(),
+		Signature: s.signed(roleHostSDP, offer.SDP),
+	})
+}
+
+// sentOffer returns the offer sendOffer sent, for the answer's signature.
+func (s *sender) sentOffer() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.offer
+}
+
+// signed signs sdps for the peer in the given role, if it can be.
+func (s *sender) signed(role string, sdps ...string) string {
+	if s.sign == nil {
+		return ""
+	}
+	return s.sign(role, s.path, sdps...)
 }
 
-// sendAnswer creates an SDP answer, sets it as local description, and sends it.
-func (s *sender) sendAnswer() error {
+// sendAnswer creates an SDP answer to offer, sets it as local description,
+// and sends it.
+func (s *sender) sendAnswer(offer string) error {
 	answer, err := s.tr.CreateAnswer()
 	if err != nil {
 		return err
@@ -47,15 +77,23 @@ func (s *sender) sendAnswer() error {
 		return err
 	}
 
-	return s.send(message{Type: msgTypeAnswer, SDP: answer.SDP})
+	return s.send(message{
+		Type: msgTypeAnswer, SDP: answer.SDP, Path: s.path,
+		Signature: s.signed(roleClientSDP, offer, answer.SDP),
+	})
 }
 
 // sendCandidate sends an ICE candidate message over the WebSocket.
 func (s *sender) sendCandidate(candidate string) error {
-	return s.send(message{Type: msgTypeCandidate, Candidate: candidate})
+	return s.send(message{Type: msgTypeCandidate, Candidate: candidate, Path: s.path})
 }
 
 // sendReady sends a ready signal indicating the DataChannel is open.
 func (s *sender) sendReady() error {
-	return s.send(message{Type: msgTypeReady})
+	return s.send(message{Type: msgTypeReady, Path: s.path})
+}
+
+// sendDirect sends the host's direct transport offer.
+func (s *sender) sendDirect(msg message) error {
+	return s.send(msg)
 }
@@ -0,0 +1,111 @@
+package signaling
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Signaler is a custom channel carrying one signaling exchange between the
+// host and a client, for embedders whose peers already share one (MQTT,
+// Firebase, a Matrix room, a shared database, ...). Setting Options.Signaler
+// on both sides replaces the WS server, the relay and the WS URL.
+//
+// Messages are JSON documents the Signaler need not look into. The Send
+// methods tell which kind each is, so that a backend can route them, e.g. to
+// separate topics, but every message sent must reach the peer's Recv in
+// order. With a PIN, all messages after the PIN exchange are encrypted and go
+// through Send.
+type Signaler interface {
+	// SendOffer sends a session description offer, host to client.
+	SendOffer(ctx context.Context, msg []byte) error
+
+	// SendAnswer sends a session description answer, client to host.
+	SendAnswer(ctx context.Context, msg []byte) error
+
+	// SendCandidate sends an ICE candidate, either way.
+	SendCandidate(ctx context.Context, msg []byte) error
+
+	// Send sends any other message: versions, authentication, the PIN
+	// exchange, the end of the exchange, ...
+	Send(ctx context.Context, msg []byte) error
+
+	// Recv returns the peer's next message, whichever method sent it,
+	// blocking until one arrives or ctx is done.
+	Recv(ctx context.Context) ([]byte, error)
+
+	// Close ends the exchange; establishment calls it once done.
+	Close() error
+}
+
+// signalerClose stands in for a WebSocket close frame on a Signaler.
+type signalerClose struct {
+	Type messageType `json:"type"`
+	pollClose
+}
+
+// signalerConn adapts a Signaler to a signaling connection (private).
+type signalerConn struct {
+	s      Signaler
+	ctx    context.Context // cancelled by Close, ending pending sends and receives
+	cancel context.CancelFunc
+}
+
+func newSignalerConn(s Signaler) *signalerConn {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &signalerConn{s: s, ctx: ctx, cancel: cancel}
+}
+
+// ReadJSON receives the peer's next message.
+func (c *signalerConn) ReadJSON(v any) error {
+	data, err := c.s.Recv(c.ctx)
+	if err != nil {
+		return err
+	}
+	var cl signalerClose
+	if json.Unmarshal(data, &cl) == nil && cl.Type == msgTypeClose {
+		return &websocket.CloseError{Code: cl.Code, Text: cl.Text}
+	}
+	return json.Unmarshal(data, v)
+}
+
+// WriteJSON sends v through the Send method for its kind.
+func (c *signalerConn) WriteJSON(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	msg, _ := v.(message)
+	switch msg.Type {
+	case msgTypeOffer:
+		return c.s.SendOffer(c.ctx, data)
+	case msgTypeAnswer:
+		return c.s.SendAnswer(c.ctx, data)
+	case msgTypeCandidate:
+		return c.s.SendCandidate(c.ctx, data)
+	default:
+		return c.s.Send(c.ctx, data)
+	}
+}
+
+// WriteMessage sends a close frame as a close message; other messages are
+// sent as JSON text.
+func (c *signalerConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != websocket.CloseMessage {
+		return c.s.Send(c.ctx, data)
+	}
+	return c.WriteJSON(signalerClose{Type: msgTypeClose, pollClose: *closeFrame(data)})
+}
+
+// SetWriteDeadline is a no-op: sends end with Close.
+func (c *signalerConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+// Close ends the exchange.
+func (c *signalerConn) Close() error {
+	c.cancel()
+	return c.s.Close()
+}
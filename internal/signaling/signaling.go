@@ -1,18 +1,19 @@
 // Package signaling orchestrates the complete signaling phase — from user input
 // to an established P2P tunnel. All WebSocket and SDP/ICE details are internal;
-// callers receive a ready-to-use Transport.
+// callers receive a ready-to-use transport.Carrier.
 package signaling
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/ed25519"
+	"errors"
 	"fmt"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/gorilla/websocket"
-	"github.com/pion/webrtc/v4"
-	"github.com/pterm/pterm"
-
+	"github.com/1ureka/roj1/internal/identity"
 	"github.com/1ureka/roj1/internal/transport"
 	"github.com/1ureka/roj1/internal/util"
 )
@@ -21,176 +22,602 @@ import (
 // after the local DataChannel is open.
 const readyTimeout = 10 * time.Second
 
+// Establishment failure classes. Errors returned by EstablishAsHost and
+// EstablishAsClient wrap one of these, so callers can tell what went wrong
+// with errors.Is.
+var (
+	ErrSignaling   = errors.New("signaling failed")          // WS server/connection or message exchange failed
+	ErrNegotiation = errors.New("WebRTC negotiation failed") // no transport could be brought up (PeerConnection or direct)
+	ErrTimeout     = errors.New("establishment timed out")   // the establishment or negotiation timeout elapsed
+	ErrCancelled   = errors.New("establishment cancelled")   // the caller's context was cancelled, e.g. on Ctrl+C; wraps its cause too
+
+	// ErrSignalingAuth is matched by every authentication failure during
+	// signaling: ErrAuth and ErrPIN.
+	ErrSignalingAuth = errors.New("signaling authentication failed")
+)
+
+// authError is an authentication failure: it matches ErrSignalingAuth as well
+// as itself.
+type authError string
+
+func (e authError) Error() string        { return string(e) }
+func (e authError) Is(target error) bool { return target == ErrSignalingAuth }
+
+// Options configures establishment.
+type Options struct {
+	// Timeout bounds the whole establishment flow (0 = no limit).
+	Timeout time.Duration
+
+	// NegotiateTimeout bounds the part of it the peers spend together
+	// (0 = no limit): signaling, ICE checks and the DataChannel opening. It
+	// starts when the client connects to the host, and stops while the
+	// client waits in the host's queue. The file flows ignore it.
+	NegotiateTimeout time.Duration
+
+	// Direct makes the host additionally offer a direct TLS-over-TCP
+	// transport, raced against WebRTC. Clients always try a direct offer.
+	Direct bool
+
+	// QUIC makes the host additionally offer a direct QUIC transport on UDP
+	// port QUICPort (0 = random), raced against WebRTC like Direct. QUICPublic
+	// is an extra host:port to offer, for a host behind a port forward.
+	QUIC       bool
+	QUICPort   int
+	QUICPublic string
+
+	// Interfaces makes the host open one PeerConnection per named network
+	// interface (at most MaxPaths) and bond them with Bond. Clients follow
+	// the host's choice.
+	Interfaces []string
+	Bond       transport.BondMode
+
+	// SocketChannels opens one ordered DataChannel per socket (see
+	// transport.Config). Only meaningful on the client, which opens sockets.
+	SocketChannels bool
+
+	// Network restricts the IP families this side gathers ICE candidates on.
+	Network transport.ICENetwork
+
+	// HighWaterMark, LowWaterMark, AutoTune, Pace, LowPower, SocketQueue and
+	// QueueDrop set this side's send backpressure (see transport.Config).
+	HighWaterMark int
+	LowWaterMark  int
+	AutoTune      bool
+	Pace          bool
+	LowPower      bool
+	SocketQueue   int
+	QueueDrop     bool
+
+	// Version is this binary's version, exchanged with the peer. A peer with
+	// a different major version is warned about, or refused with
+	// StrictVersion.
+	Version       string
+	StrictVersion bool
+
+	// Identity is this side's key. A host proves it to clients, which pin it
+	// in KnownHosts on first use; a client proves it to a host that requires
+	// AuthorizedKeys. Nil means no identity.
+	Identity ed25519.PrivateKey
+
+	// AuthorizedKeys makes the host refuse clients that cannot prove one of
+	// these keys (nil = no authentication). OnAuthenticated, if set, is
+	// called with the client's entry once it has proven it, before any offer
+	// is sent.
+	AuthorizedKeys  *identity.AuthorizedKeys
+	OnAuthenticated func(key identity.AuthorizedKey)
+
+	// KnownHosts is the client's file of pinned host keys ("" = no pinning).
+	// Hosts reached through a relay room are not pinned, as a room code
+	// names no particular host.
+	KnownHosts string
+
+	// PIN, if set, must be the same on both sides: signaling is then
+	// encrypted with keys derived from it (see pake.go), so a relay of the
+	// WebSocket can neither read nor alter the session descriptions.
+	PIN string
+
+	// Relay makes the host wait for its client in Room, a code from NewRoom,
+	// on the rendezvous relay at this URL instead of starting a WS server.
+	// Clients join the room at RoomURL.
+	Relay string
+	Room  string
+
+	// Signaler, if set, carries the exchange instead of a WS server, relay or
+	// WS URL (see Signaler). Both sides must set one, connected to the other.
+	Signaler Signaler
+
+	// WSPath is where the host's WS server accepts its client ("" =
+	// DefaultWSPath), when it starts one; see Listen.
+	WSPath string
+
+	// Server, if set, is the server the host takes its client from
+	// instead of starting a WS server on wsAddr; it stays open after the
+	// session, so clients arriving meanwhile can wait in its queue.
+	Server Server
+
+	// OnPeerKey, if set, is called with the peer's key once the peer has
+	// proven it: the host's key on the client, an authorized client's key
+	// on the host.
+	OnPeerKey func(key ed25519.PublicKey)
+}
+
+// transportConfig returns the Transport settings for opts on the given
+// network interface ("" = any).
+func transportConfig(opts Options, iface string) transport.Config {
+	return transport.Config{
+		Interface:      iface,
+		SocketChannels: opts.SocketChannels,
+		Network:        opts.Network,
+		HighWaterMark:  opts.HighWaterMark,
+		LowWaterMark:   opts.LowWaterMark,
+		AutoTune:       opts.AutoTune,
+		Pace:           opts.Pace,
+		LowPower:       opts.LowPower,
+		SocketQueue:    opts.SocketQueue,
+		QueueDrop:      opts.QueueDrop,
+	}
+}
+
+// withTimeout derives the establishment context. A non-positive timeout means
+// no limit; otherwise the context is cancelled with ErrTimeout as its cause.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, timeout, ErrTimeout)
+}
+
+// clock bounds the negotiation to Options.NegotiateTimeout: once started, it
+// cancels its context with ErrTimeout unless paused within the timeout. Its
+// methods do nothing on a nil clock (no limit).
+type clock struct {
+	timeout time.Duration
+	cancel  context.CancelCauseFunc
+
+	mu    sync.Mutex
+	timer *time.Timer // nil while paused
+}
+
+// withClock derives the context a clock bounds, with the clock not started.
+func withClock(ctx context.Context, timeout time.Duration) (context.Context, *clock) {
+	if timeout <= 0 {
+		return ctx, nil
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	return ctx, &clock{timeout: timeout, cancel: cancel}
+}
+
+// start (re)starts the countdown from the full timeout.
+func (c *clock) start() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.timer = time.AfterFunc(c.timeout, func() {
+		c.cancel(fmt.Errorf("%w: the peers did not connect within %v", ErrTimeout, c.timeout))
+	})
+}
+
+// pause stops the countdown until the next start.
+func (c *clock) pause() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+}
+
+// cancelled turns a failure into ErrCancelled if ctx, the caller's context,
+// was cancelled meanwhile: whatever broke then broke because of it.
+func cancelled(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil || errors.Is(err, ErrCancelled) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrCancelled, context.Cause(ctx))
+}
+
 // EstablishAsHost executes the full host-side signaling flow:
-//  1. Start a WS server on wsAddr (e.g. ":0" for random port)
+//  1. Start a WS server on wsAddr (e.g. ":0" for random port), or with
+//     opts.Relay, open opts.Room on the relay; with opts.Signaler, use it
+//     instead
 //  2. Wait for the client to connect
-//  3. Create a Transport
+//  3. Create a Transport per path (and, with opts.Direct or opts.QUIC, direct
+//     listeners)
 //  4. Perform SDP/ICE exchange
-//  5. Dual-flag handshake: wait for both sides to confirm DataChannel open
-//  6. Close the WS server and connection (resource cleanup)
-//  7. Return the ready Transport
-func EstablishAsHost(ctx context.Context, wsAddr string) (*transport.Transport, error) {
-	// 1. Start WS server.
-	spinner, _ := pterm.DefaultSpinner.
-		WithRemoveWhenDone(true).
-		Start("starting WebSocket signaling server...")
-
-	srv := &server{connCh: make(chan *websocket.Conn, 1)}
-	wsPort, err := srv.start(wsAddr)
-	if err != nil {
-		spinner.Fail("failed to start WebSocket server")
-		return nil, err
+//  5. Race the transports; for WebRTC, a dual-flag handshake confirms that
+//     both sides have the DataChannel open
+//  6. Close the WS server (unless it is opts.Server) and connection
+//     (resource cleanup)
+//  7. Return the transports that came up, bundled fastest first
+//
+// The whole flow is bounded by opts.Timeout, and the part after the client's
+// arrival by opts.NegotiateTimeout, while the returned Carrier lives on until
+// ctx is cancelled. The port the WS server was bound to is returned
+// alongside the Carrier (or the error, once the server has started) so callers
+// can rebind the same port for subsequent sessions; it is 0 with opts.Relay.
+//
+// If ctx is cancelled before the tunnel is up, the WS server, connection,
+// PeerConnections and every goroutine of the flow are gone by the time
+// EstablishAsHost returns ErrCancelled.
+func EstablishAsHost(ctx context.Context, wsAddr string, opts Options) (_ transport.Carrier, _ int, err error) {
+	estCtx, cancel := withTimeout(ctx, opts.Timeout)
+	defer cancel()
+	estCtx, clk := withClock(estCtx, opts.NegotiateTimeout)
+	defer clk.pause()
+	defer func() { err = cancelled(ctx, err) }()
+	start := time.Now()
+
+	util.NotifyState(util.StateSignaling)
+
+	// 1. Start WS server, or open the room on the relay.
+	startText := util.Tr("starting WebSocket signaling server...")
+	switch {
+	case opts.Signaler != nil:
+		startText = util.Tr("waiting for the client on the signaling channel...")
+	case opts.Relay != "":
+		startText = util.Tr("opening a room on the relay...")
 	}
-	defer srv.close()
+	spinner := util.StartSpinner(startText)
 
-	spinner.UpdateText(
-		fmt.Sprintf("WebSocket server listening on port %d — waiting for client...", wsPort),
+	var (
+		wsConn sigConn
+		wsPort int
 	)
+	switch {
+	case opts.Signaler != nil:
+		// 2. The channel already leads to the client, which has arrived
+		// once its hello has (see receiver.onHello).
+		wsConn = newSignalerConn(opts.Signaler)
+	case opts.Relay != "":
+		// 2. Wait for the client to join.
+		if wsConn, err = awaitRoomClient(estCtx, spinner, opts.Relay, opts.Room); err != nil {
+			return nil, 0, err
+		}
+	default:
+		srv := opts.Server
+		if srv == nil {
+			l, err := Listen(wsAddr, opts.WSPath, 0)
+			if err != nil {
+				spinner.Fail(util.Tr("failed to start WebSocket server"))
+				return nil, 0, err
+			}
+			defer l.Close()
+			srv = l
+		}
+		wsPort = srv.Port()
 
-	// 2. Wait for client
-	wsConn, err := srv.waitForClient(ctx)
-	if err != nil {
-		spinner.Fail("failed while waiting for client connection")
-		return nil, err
+		util.EmitEvent(util.Event{Event: util.EventWSListening, Port: wsPort})
+		listening := util.Trf("WebSocket server listening on port %d — waiting for client...", wsPort)
+		if _, ok := srv.(*GRPCListener); ok {
+			listening = util.Trf("gRPC server listening on port %d — waiting for client...", wsPort)
+		}
+		spinner.UpdateText(listening)
+
+		// 2. Wait for client
+		if wsConn, err = srv.waitForClient(estCtx); err != nil {
+			spinner.Fail(util.Tr("failed while waiting for client connection"))
+			return nil, wsPort, context.Cause(estCtx)
+		}
 	}
 	defer wsConn.Close()
+	if opts.Signaler == nil {
+		clk.start()
+	}
 
-	spinner.UpdateText("client connected — negotiating WebRTC...")
+	util.EmitPhase(util.PhaseWait, start)
+	connected := time.Now()
+	util.EmitEvent(util.Event{Event: util.EventClientConnected, Port: wsPort})
 
-	// 3. Create Transport.
-	tr, err := transport.NewTransport(ctx)
+	codec, err := newHostCodec()
 	if err != nil {
-		spinner.Fail("failed to create Transport")
-		return nil, err
+		spinner.Fail(util.Tr("failed to create nonce"))
+		return nil, wsPort, fmt.Errorf("%w: %w", ErrSignaling, err)
+	}
+	if opts.PIN != "" {
+		spinner.UpdateText(util.Tr("client connected — checking the PIN..."))
+		if err = acceptPIN(estCtx, wsConn, codec, opts.PIN); err != nil {
+			spinner.Fail(util.Tr("PIN check failed"))
+			if estCtx.Err() != nil {
+				return nil, wsPort, context.Cause(estCtx)
+			}
+			return nil, wsPort, fmt.Errorf("%w: %w", ErrSignaling, err)
+		}
+	}
+	spinner.UpdateText(util.Tr("client connected — negotiating WebRTC..."))
+
+	// 3. Create a Transport per path.
+	ifaces := opts.Interfaces
+	if len(ifaces) == 0 {
+		ifaces = []string{""}
 	}
 
-	// 4. Perform SDP/ICE exchange.
-	s := &sender{tr: tr, conn: wsConn}
-	r := &receiver{tr: tr, conn: wsConn, sender: s, peerReady: make(chan struct{}, 1)}
+	var wsMu sync.Mutex
+	r := &receiver{
+		conn:          wsConn,
+		paths:         make(map[int]*path),
+		done:          make(chan struct{}),
+		wsMu:          &wsMu,
+		codec:         codec,
+		version:       opts.Version,
+		strictVersion: opts.StrictVersion,
+		answerHello:   true,
+		connected:     connected,
+		onHello:       clk.start,
 
-	tr.OnICECandidate(func(c *webrtc.ICECandidate) {
-		if c != nil {
-			data, _ := json.Marshal(c.ToJSON())
-			s.sendCandidate(string(data)) // Error intentionally ignored: sendCandidate is best-effort.
+		key:        opts.Identity,
+		authorized: opts.AuthorizedKeys,
+		authed:     make(chan struct{}),
+		onAuth:     opts.OnAuthenticated,
+		onPeerKey:  opts.OnPeerKey,
+		greeted:    make(chan struct{}),
+	}
+	if opts.AuthorizedKeys != nil {
+		if r.challenge, err = newChallenge(); err != nil {
+			spinner.Fail(util.Tr("failed to create challenge"))
+			return nil, wsPort, fmt.Errorf("%w: %w", ErrSignaling, err)
 		}
-	})
+	}
+	paths := make([]*path, 0, len(ifaces))
+	for i, iface := range ifaces {
+		tr, err := transport.NewTransportWith(ctx, transportConfig(opts, iface))
+		if err != nil {
+			closePaths(paths)
+			spinner.Fail(util.Tr("failed to create Transport"))
+			return nil, wsPort, fmt.Errorf("%w: %w", ErrNegotiation, err)
+		}
+		p := newPath(tr, wsConn, &wsMu, codec, i)
+		p.sender.sign = r.signSDP
+		paths = append(paths, p)
+		r.paths[i] = p
+	}
 
-	watchErr := make(chan error, 1)
-	go func() {
-		watchErr <- r.watch()
+	// 4. Perform SDP/ICE exchange, once the client is authenticated.
+	util.NotifyState(util.StateConnecting)
+	go r.watch()
+	defer func() {
+		wsConn.Close()
+		<-r.done
 	}()
 
-	if err := s.sendOffer(); err != nil {
-		tr.Close()
-		spinner.Fail("failed to send Offer")
-		return nil, err
+	if opts.AuthorizedKeys != nil {
+		spinner.UpdateText(util.Tr("client connected — waiting for it to authenticate..."))
+		select {
+		case <-r.authed:
+		case <-r.done:
+			closePaths(paths)
+			spinner.Fail(util.Tr("client authentication failed"))
+			return nil, wsPort, fmt.Errorf("%w: %w", ErrSignaling, r.err)
+		case <-estCtx.Done():
+			closePaths(paths)
+			spinner.Fail(util.Tr("client authentication failed"))
+			return nil, wsPort, context.Cause(estCtx)
+		}
+		spinner.UpdateText(util.Tr("client authenticated — negotiating WebRTC..."))
+	} else if opts.Identity != nil {
+		// The offers are signed over the client's challenge (see signSDP).
+		select {
+		case <-r.greeted:
+		case <-r.done:
+			closePaths(paths)
+			spinner.Fail(util.Tr("tunnel negotiation failed"))
+			return nil, wsPort, fmt.Errorf("%w: %w", ErrSignaling, r.err)
+		case <-estCtx.Done():
+			closePaths(paths)
+			spinner.Fail(util.Tr("tunnel negotiation failed"))
+			return nil, wsPort, context.Cause(estCtx)
+		}
 	}
 
-	// 5. Dual-flag handshake: wait for both sides to confirm DataChannel open.
-	select {
-	case <-tr.Ready():
-	case err := <-watchErr:
-		tr.Close()
-		spinner.Fail("WebRTC negotiation failed")
-		return nil, err
-	case <-ctx.Done():
-		tr.Close()
-		spinner.Fail("WebRTC negotiation failed")
-		return nil, ctx.Err()
+	raceCtx, stopRace := context.WithCancel(estCtx)
+	defer stopRace()
+	results := make(chan candidate, 3)
+	n := 0
+
+	// The direct offer goes out before the SDP offers (see receiver.handle).
+	if opts.Direct || opts.QUIC {
+		d, err := listenDirect(opts)
+		if err != nil {
+			util.LogWarning("direct transport unavailable: %v", err)
+		} else if err := paths[0].sender.sendDirect(d.offer()); err != nil {
+			d.close()
+			closePaths(paths)
+			spinner.Fail(util.Tr("failed to send direct offer"))
+			return nil, wsPort, fmt.Errorf("%w: %w", ErrSignaling, err)
+		} else {
+			if d.listener != nil {
+				n++
+				go func() { results <- d.accept(raceCtx, ctx, r) }()
+			}
+			if d.quic != nil {
+				n++
+				go func() { results <- d.acceptQUIC(raceCtx, ctx, r) }()
+			}
+		}
 	}
 
-	if err := s.sendReady(); err != nil {
-		util.LogDebug("failed to send ready signal: %v", err)
+	for _, p := range paths {
+		if err := p.sender.sendOffer(len(paths), opts.Bond); err != nil {
+			closePaths(paths)
+			spinner.Fail(util.Tr("failed to send Offer"))
+			return nil, wsPort, fmt.Errorf("%w: %w", ErrSignaling, err)
+		}
 	}
 
-	select {
-	case <-r.peerReady:
-		util.LogDebug("peer confirmed ready")
-	case <-time.After(readyTimeout):
-		util.LogDebug("peer ready timeout — proceeding")
-	case <-ctx.Done():
-		tr.Close()
-		spinner.Fail("WebRTC negotiation failed")
-		return nil, ctx.Err()
+	// 5. Race the transports.
+	n++
+	go func() { results <- negotiatePaths(raceCtx, r, paths, opts.Bond) }()
+
+	stopICE := followICE(spinner)
+	cands, err := gather(raceCtx, results, n)
+	stopICE()
+	if err != nil {
+		spinner.Fail(util.Tr("tunnel negotiation failed"))
+		return nil, wsPort, err
 	}
 
-	spinner.Success("WebRTC DataChannel established")
-	return tr, nil
+	carrier, names := bundle(cands)
+	spinner.Success(util.Trf("tunnel established via %s", strings.Join(names, " + ")))
+	util.EmitPhase(util.PhaseEstablish, connected)
+	util.NotifyState(util.StateEstablished)
+	return carrier, wsPort, nil
 }
 
 // EstablishAsClient executes the full client-side signaling flow:
-//  1. Connect to the host's WS server
-//  2. Create a Transport
-//  3. Perform SDP/ICE exchange
-//  4. Dual-flag handshake: wait for both sides to confirm DataChannel open
+//  1. Connect to the host's WS server, unless opts.Signaler is set
+//  2. Create a Transport for each path the host offers
+//  3. Perform SDP/ICE exchange, dialing the host's direct offer if any
+//  4. Race the transports; for WebRTC, a dual-flag handshake confirms that
+//     both sides have the DataChannel open
 //  5. Close the WS connection (resource cleanup)
-//  6. Return the ready Transport
-func EstablishAsClient(ctx context.Context, wsURL string) (*transport.Transport, error) {
+//  6. Return the transports that came up, bundled fastest first
+//
+// The whole flow is bounded by opts.Timeout and opts.NegotiateTimeout, while
+// the returned Carrier lives on until ctx is cancelled. With opts.Signaler, wsURL only names the host
+// its key is pinned under in opts.KnownHosts ("" = no pinning). Cancelling
+// ctx early cleans up as with EstablishAsHost.
+func EstablishAsClient(ctx context.Context, wsURL string, opts Options) (_ transport.Carrier, err error) {
+	estCtx, cancel := withTimeout(ctx, opts.Timeout)
+	defer cancel()
+	estCtx, clk := withClock(estCtx, opts.NegotiateTimeout)
+	defer clk.pause()
+	clk.start()
+	defer func() { err = cancelled(ctx, err) }()
+	start := time.Now()
+
+	util.NotifyState(util.StateSignaling)
+
 	// 1. Connect to WS server.
-	spinner, _ := pterm.DefaultSpinner.
-		WithRemoveWhenDone(true).
-		Start("connecting to Host via WebSocket...")
+	startText := util.Tr("connecting to Host via WebSocket...")
+	if opts.Signaler != nil {
+		startText = util.Tr("connecting to Host via the signaling channel...")
+	}
+	spinner := util.StartSpinner(startText)
 
-	wsConn, err := connect(ctx, wsURL)
-	if err != nil {
-		spinner.Fail("failed to connect to WebSocket server")
-		return nil, err
+	var wsConn sigConn
+	if opts.Signaler != nil {
+		wsConn = newSignalerConn(opts.Signaler)
+	} else if wsConn, err = dial(estCtx, wsURL); err != nil {
+		spinner.Fail(util.Tr("failed to connect to WebSocket server"))
+		if estCtx.Err() != nil {
+			return nil, context.Cause(estCtx)
+		}
+		return nil, fmt.Errorf("%w: %w", ErrSignaling, err)
 	}
 	defer wsConn.Close()
 
-	spinner.UpdateText("WebSocket connected — negotiating WebRTC...")
+	util.EmitPhase(util.PhaseConnect, start)
+	util.EmitEvent(util.Event{Event: util.EventClientConnected, Addr: wsURL})
 
-	// 2. Create Transport.
-	tr, err := transport.NewTransport(ctx)
-	if err != nil {
-		spinner.Fail("failed to create Transport")
-		return nil, err
+	codec := newClientCodec()
+	codec.onQueued = func(position int) {
+		if position == 0 {
+			clk.start()
+			spinner.UpdateText(util.Tr("the host is free — connecting..."))
+			return
+		}
+		clk.pause()
+		util.EmitEvent(util.Event{Event: util.EventQueued, Position: position})
+		spinner.UpdateText(util.Trf("the host is busy — number %d in line...", position))
+	}
+	if opts.PIN != "" {
+		spinner.UpdateText(util.Tr("WebSocket connected — checking the PIN..."))
+		if err = offerPIN(estCtx, wsConn, codec, opts.PIN); err != nil {
+			spinner.Fail(util.Tr("PIN check failed"))
+			if estCtx.Err() != nil {
+				return nil, context.Cause(estCtx)
+			}
+			return nil, fmt.Errorf("%w: %w", ErrSignaling, err)
+		}
 	}
+	spinner.UpdateText(util.Tr("WebSocket connected — negotiating WebRTC..."))
 
-	// 3. Perform SDP/ICE exchange.
-	s := &sender{tr: tr, conn: wsConn}
-	r := &receiver{tr: tr, conn: wsConn, sender: s, peerReady: make(chan struct{}, 1)}
+	// 2. Transports are created as the host's offers arrive.
+	var wsMu sync.Mutex
+	r := &receiver{
+		conn:    wsConn,
+		paths:   make(map[int]*path),
+		offered: make(chan *path, MaxPaths),
+		direct:  make(chan message, 1),
+		done:    make(chan struct{}),
 
-	tr.OnICECandidate(func(c *webrtc.ICECandidate) {
-		if c != nil {
-			data, _ := json.Marshal(c.ToJSON())
-			s.sendCandidate(string(data)) // Error intentionally ignored: sendCandidate is best-effort.
-		}
-	})
+		wsMu:          &wsMu,
+		codec:         codec,
+		version:       opts.Version,
+		strictVersion: opts.StrictVersion,
+		connected:     time.Now(),
 
-	watchErr := make(chan error, 1)
-	go func() {
-		watchErr <- r.watch()
+		key:        opts.Identity,
+		knownHosts: opts.KnownHosts,
+		onPeerKey:  opts.OnPeerKey,
+	}
+	if opts.Signaler != nil {
+		r.hostName = wsURL
+		if wsURL == "" {
+			r.knownHosts = ""
+		}
+	} else if u, err := url.Parse(wsURL); err == nil {
+		r.hostName = u.Host
+		if roomInPath(u.Path) != "" {
+			r.knownHosts = "" // the relay's name says nothing about the host
+		}
+	}
+	if r.challenge, err = newChallenge(); err != nil {
+		spinner.Fail(util.Tr("failed to create challenge"))
+		return nil, fmt.Errorf("%w: %w", ErrSignaling, err)
+	}
+	r.newPath = func(index int) (*path, error) {
+		tr, err := transport.NewTransportWith(ctx, transportConfig(opts, ""))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrNegotiation, err)
+		}
+		p := newPath(tr, wsConn, &wsMu, codec, index)
+		p.sender.sign = r.signSDP
+		return p, nil
+	}
+	defer func() {
+		wsConn.Close()
+		r.closeStray()
 	}()
 
-	// 4. Dual-flag handshake: wait for both sides to confirm DataChannel open.
-	select {
-	case <-tr.Ready():
-	case err := <-watchErr:
-		tr.Close()
-		spinner.Fail("WebRTC negotiation failed")
-		return nil, err
-	case <-ctx.Done():
-		tr.Close()
-		spinner.Fail("WebRTC negotiation failed")
-		return nil, ctx.Err()
-	}
+	// 3. Perform SDP/ICE exchange.
+	util.NotifyState(util.StateConnecting)
+	go r.watch()
 
-	if err := s.sendReady(); err != nil {
-		util.LogDebug("failed to send ready signal: %v", err)
+	if err := sendHello(wsConn, &wsMu, codec, message{Version: opts.Version, Challenge: r.challenge}); err != nil {
+		spinner.Fail(util.Tr("failed to send hello"))
+		return nil, fmt.Errorf("%w: %w", ErrSignaling, err)
 	}
 
-	select {
-	case <-r.peerReady:
-		util.LogDebug("peer confirmed ready")
-	case <-time.After(readyTimeout):
-		util.LogDebug("peer ready timeout — proceeding")
-	case <-ctx.Done():
-		tr.Close()
-		spinner.Fail("WebRTC negotiation failed")
-		return nil, ctx.Err()
+	// 4. Race the transports.
+	raceCtx, stopRace := context.WithCancel(estCtx)
+	defer stopRace()
+	results := make(chan candidate, 3)
+	go func() {
+		msg := directOffer(raceCtx, r)
+		go func() { results <- dialQUIC(raceCtx, ctx, msg) }()
+		results <- dialDirect(raceCtx, ctx, msg)
+	}()
+	go func() { results <- acceptPaths(raceCtx, r) }()
+
+	stopICE := followICE(spinner)
+	cands, err := gather(raceCtx, results, 3)
+	stopICE()
+	if err != nil {
+		spinner.Fail(util.Tr("tunnel negotiation failed"))
+		return nil, err
 	}
 
-	spinner.Success("WebRTC DataChannel established")
-	return tr, nil
+	carrier, names := bundle(cands)
+	spinner.Success(util.Trf("tunnel established via %s", strings.Join(names, " + ")))
+	util.EmitPhase(util.PhaseEstablish, start)
+	util.NotifyState(util.StateEstablished)
+	return carrier, nil
 }
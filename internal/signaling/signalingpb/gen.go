@@ -0,0 +1,5 @@
+// Package signalingpb holds the protocol buffers and gRPC code of the gRPC
+// signaling service (see signaling.proto).
+package signalingpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative signaling.proto
@@ -0,0 +1,698 @@
+// The gRPC signaling service a host started with -grpc serves (see
+// internal/signaling/grpc.go). Regenerate the Go code with go generate.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: signaling.proto
+
+package signalingpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// OfferRequest asks for the offers of the session named in the metadata.
+type OfferRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OfferRequest) Reset() {
+	*x = OfferRequest{}
+	mi := &file_signaling_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OfferRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OfferRequest) ProtoMessage() {}
+
+func (x *OfferRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_signaling_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OfferRequest.ProtoReflect.Descriptor instead.
+func (*OfferRequest) Descriptor() ([]byte, []int) {
+	return file_signaling_proto_rawDescGZIP(), []int{0}
+}
+
+// AnswerResponse ends an Answer call.
+type AnswerResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AnswerResponse) Reset() {
+	*x = AnswerResponse{}
+	mi := &file_signaling_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AnswerResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AnswerResponse) ProtoMessage() {}
+
+func (x *AnswerResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_signaling_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AnswerResponse.ProtoReflect.Descriptor instead.
+func (*AnswerResponse) Descriptor() ([]byte, []int) {
+	return file_signaling_proto_rawDescGZIP(), []int{1}
+}
+
+// SessionDescription is an offer or an answer.
+type SessionDescription struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// frame numbers the message among all its sender sent in the session,
+	// from 1.
+	Frame uint64 `protobuf:"varint,1,opt,name=frame,proto3" json:"frame,omitempty"`
+	// sdp is the session description.
+	Sdp string `protobuf:"bytes,2,opt,name=sdp,proto3" json:"sdp,omitempty"`
+	// path is the PeerConnection the description belongs to, from 0.
+	Path uint32 `protobuf:"varint,3,opt,name=path,proto3" json:"path,omitempty"`
+	// paths is how many PeerConnections the host offers (offers only).
+	Paths uint32 `protobuf:"varint,4,opt,name=paths,proto3" json:"paths,omitempty"`
+	// bond is how the host spreads data over the paths: stripe or duplicate
+	// (offers only).
+	Bond string `protobuf:"bytes,5,opt,name=bond,proto3" json:"bond,omitempty"`
+	// signature is the sender's signature over the descriptions, with
+	// identity keys.
+	Signature string `protobuf:"bytes,6,opt,name=signature,proto3" json:"signature,omitempty"`
+	// seq and nonce number the message within the session and tie it to the
+	// session nonce the host picked, against replays.
+	Seq           uint64 `protobuf:"varint,7,opt,name=seq,proto3" json:"seq,omitempty"`
+	Nonce         string `protobuf:"bytes,8,opt,name=nonce,proto3" json:"nonce,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SessionDescription) Reset() {
+	*x = SessionDescription{}
+	mi := &file_signaling_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SessionDescription) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SessionDescription) ProtoMessage() {}
+
+func (x *SessionDescription) ProtoReflect() protoreflect.Message {
+	mi := &file_signaling_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SessionDescription.ProtoReflect.Descriptor instead.
+func (*SessionDescription) Descriptor() ([]byte, []int) {
+	return file_signaling_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SessionDescription) GetFrame() uint64 {
+	if x != nil {
+		return x.Frame
+	}
+	return 0
+}
+
+func (x *SessionDescription) GetSdp() string {
+	if x != nil {
+		return x.Sdp
+	}
+	return ""
+}
+
+func (x *SessionDescription) GetPath() uint32 {
+	if x != nil {
+		return x.Path
+	}
+	return 0
+}
+
+func (x *SessionDescription) GetPaths() uint32 {
+	if x != nil {
+		return x.Paths
+	}
+	return 0
+}
+
+func (x *SessionDescription) GetBond() string {
+	if x != nil {
+		return x.Bond
+	}
+	return ""
+}
+
+func (x *SessionDescription) GetSignature() string {
+	if x != nil {
+		return x.Signature
+	}
+	return ""
+}
+
+func (x *SessionDescription) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *SessionDescription) GetNonce() string {
+	if x != nil {
+		return x.Nonce
+	}
+	return ""
+}
+
+// IceCandidate is an ICE candidate (RTCIceCandidateInit).
+type IceCandidate struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// frame numbers the message among all its sender sent in the session,
+	// from 1.
+	Frame uint64 `protobuf:"varint,1,opt,name=frame,proto3" json:"frame,omitempty"`
+	// candidate is the candidate line, e.g. "candidate:1 1 udp ...".
+	Candidate string `protobuf:"bytes,2,opt,name=candidate,proto3" json:"candidate,omitempty"`
+	// sdp_mid and sdp_mline_index tell the media section it belongs to.
+	SdpMid        *string `protobuf:"bytes,3,opt,name=sdp_mid,json=sdpMid,proto3,oneof" json:"sdp_mid,omitempty"`
+	SdpMlineIndex *uint32 `protobuf:"varint,4,opt,name=sdp_mline_index,json=sdpMlineIndex,proto3,oneof" json:"sdp_mline_index,omitempty"`
+	// username_fragment is the ICE ufrag the candidate belongs to.
+	UsernameFragment *string `protobuf:"bytes,5,opt,name=username_fragment,json=usernameFragment,proto3,oneof" json:"username_fragment,omitempty"`
+	// path is the PeerConnection the candidate belongs to, from 0.
+	Path uint32 `protobuf:"varint,6,opt,name=path,proto3" json:"path,omitempty"`
+	// seq and nonce number the message within the session and tie it to the
+	// session nonce the host picked, against replays.
+	Seq           uint64 `protobuf:"varint,7,opt,name=seq,proto3" json:"seq,omitempty"`
+	Nonce         string `protobuf:"bytes,8,opt,name=nonce,proto3" json:"nonce,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IceCandidate) Reset() {
+	*x = IceCandidate{}
+	mi := &file_signaling_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IceCandidate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IceCandidate) ProtoMessage() {}
+
+func (x *IceCandidate) ProtoReflect() protoreflect.Message {
+	mi := &file_signaling_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IceCandidate.ProtoReflect.Descriptor instead.
+func (*IceCandidate) Descriptor() ([]byte, []int) {
+	return file_signaling_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *IceCandidate) GetFrame() uint64 {
+	if x != nil {
+		return x.Frame
+	}
+	return 0
+}
+
+func (x *IceCandidate) GetCandidate() string {
+	if x != nil {
+		return x.Candidate
+	}
+	return ""
+}
+
+func (x *IceCandidate) GetSdpMid() string {
+	if x != nil && x.SdpMid != nil {
+		return *x.SdpMid
+	}
+	return ""
+}
+
+func (x *IceCandidate) GetSdpMlineIndex() uint32 {
+	if x != nil && x.SdpMlineIndex != nil {
+		return *x.SdpMlineIndex
+	}
+	return 0
+}
+
+func (x *IceCandidate) GetUsernameFragment() string {
+	if x != nil && x.UsernameFragment != nil {
+		return *x.UsernameFragment
+	}
+	return ""
+}
+
+func (x *IceCandidate) GetPath() uint32 {
+	if x != nil {
+		return x.Path
+	}
+	return 0
+}
+
+func (x *IceCandidate) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *IceCandidate) GetNonce() string {
+	if x != nil {
+		return x.Nonce
+	}
+	return ""
+}
+
+// Message is any other signaling message, or a close frame.
+type Message struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// frame numbers the message among all its sender sent in the session,
+	// from 1.
+	Frame uint64 `protobuf:"varint,1,opt,name=frame,proto3" json:"frame,omitempty"`
+	// type is the kind of message: hello, auth, pake, sealed, queued, ready,
+	// direct, ...
+	Type string `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	// path is the PeerConnection a ready message belongs to, from 0.
+	Path uint32 `protobuf:"varint,3,opt,name=path,proto3" json:"path,omitempty"`
+	// addrs, token and fingerprint describe the host's direct TLS listener
+	// (direct only).
+	Addrs       []string `protobuf:"bytes,4,rep,name=addrs,proto3" json:"addrs,omitempty"`
+	Token       string   `protobuf:"bytes,5,opt,name=token,proto3" json:"token,omitempty"`
+	Fingerprint string   `protobuf:"bytes,6,opt,name=fingerprint,proto3" json:"fingerprint,omitempty"`
+	// version is the sender's roj1 version (hello only).
+	Version string `protobuf:"bytes,7,opt,name=version,proto3" json:"version,omitempty"`
+	// challenge, public_key and signature authenticate the peers with
+	// identity keys (hello and auth only).
+	Challenge string `protobuf:"bytes,8,opt,name=challenge,proto3" json:"challenge,omitempty"`
+	PublicKey string `protobuf:"bytes,9,opt,name=public_key,json=publicKey,proto3" json:"public_key,omitempty"`
+	Signature string `protobuf:"bytes,10,opt,name=signature,proto3" json:"signature,omitempty"`
+	// pake and confirm carry the PIN exchange (pake only), and sealed any other
+	// message encrypted with the PIN's keys (sealed only).
+	Pake    string `protobuf:"bytes,11,opt,name=pake,proto3" json:"pake,omitempty"`
+	Confirm string `protobuf:"bytes,12,opt,name=confirm,proto3" json:"confirm,omitempty"`
+	Sealed  string `protobuf:"bytes,13,opt,name=sealed,proto3" json:"sealed,omitempty"`
+	// position is the client's place in the host's queue, 0 once its turn has
+	// come (queued only).
+	Position uint32 `protobuf:"varint,14,opt,name=position,proto3" json:"position,omitempty"`
+	// seq and nonce number the message within the session and tie it to the
+	// session nonce the host picked, against replays.
+	Seq   uint64 `protobuf:"varint,15,opt,name=seq,proto3" json:"seq,omitempty"`
+	Nonce string `protobuf:"bytes,16,opt,name=nonce,proto3" json:"nonce,omitempty"`
+	// close, if set, ends the session with a reason, like a WebSocket close
+	// frame; the other fields are then unset.
+	Close *Close `protobuf:"bytes,17,opt,name=close,proto3" json:"close,omitempty"`
+	// quic lists the host's direct QUIC addresses, which share token and
+	// fingerprint with addrs (direct only).
+	Quic          []string `protobuf:"bytes,18,rep,name=quic,proto3" json:"quic,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Message) Reset() {
+	*x = Message{}
+	mi := &file_signaling_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Message) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Message) ProtoMessage() {}
+
+func (x *Message) ProtoReflect() protoreflect.Message {
+	mi := &file_signaling_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Message.ProtoReflect.Descriptor instead.
+func (*Message) Descriptor() ([]byte, []int) {
+	return file_signaling_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Message) GetFrame() uint64 {
+	if x != nil {
+		return x.Frame
+	}
+	return 0
+}
+
+func (x *Message) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Message) GetPath() uint32 {
+	if x != nil {
+		return x.Path
+	}
+	return 0
+}
+
+func (x *Message) GetAddrs() []string {
+	if x != nil {
+		return x.Addrs
+	}
+	return nil
+}
+
+func (x *Message) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *Message) GetFingerprint() string {
+	if x != nil {
+		return x.Fingerprint
+	}
+	return ""
+}
+
+func (x *Message) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *Message) GetChallenge() string {
+	if x != nil {
+		return x.Challenge
+	}
+	return ""
+}
+
+func (x *Message) GetPublicKey() string {
+	if x != nil {
+		return x.PublicKey
+	}
+	return ""
+}
+
+func (x *Message) GetSignature() string {
+	if x != nil {
+		return x.Signature
+	}
+	return ""
+}
+
+func (x *Message) GetPake() string {
+	if x != nil {
+		return x.Pake
+	}
+	return ""
+}
+
+func (x *Message) GetConfirm() string {
+	if x != nil {
+		return x.Confirm
+	}
+	return ""
+}
+
+func (x *Message) GetSealed() string {
+	if x != nil {
+		return x.Sealed
+	}
+	return ""
+}
+
+func (x *Message) GetPosition() uint32 {
+	if x != nil {
+		return x.Position
+	}
+	return 0
+}
+
+func (x *Message) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *Message) GetNonce() string {
+	if x != nil {
+		return x.Nonce
+	}
+	return ""
+}
+
+func (x *Message) GetClose() *Close {
+	if x != nil {
+		return x.Close
+	}
+	return nil
+}
+
+func (x *Message) GetQuic() []string {
+	if x != nil {
+		return x.Quic
+	}
+	return nil
+}
+
+// Close is a WebSocket close frame.
+type Close struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// code is the WebSocket close code, e.g. 1008 when the client is refused.
+	Code uint32 `protobuf:"varint,1,opt,name=code,proto3" json:"code,omitempty"`
+	// reason says why, e.g. "already connected".
+	Reason        string `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Close) Reset() {
+	*x = Close{}
+	mi := &file_signaling_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Close) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Close) ProtoMessage() {}
+
+func (x *Close) ProtoReflect() protoreflect.Message {
+	mi := &file_signaling_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Close.ProtoReflect.Descriptor instead.
+func (*Close) Descriptor() ([]byte, []int) {
+	return file_signaling_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Close) GetCode() uint32 {
+	if x != nil {
+		return x.Code
+	}
+	return 0
+}
+
+func (x *Close) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+var File_signaling_proto protoreflect.FileDescriptor
+
+const file_signaling_proto_rawDesc = "" +
+	"\n" +
+	"\x0fsignaling.proto\x12\x11roj1.signaling.v1\"\x0e\n" +
+	"\fOfferRequest\"\x10\n" +
+	"\x0eAnswerResponse\"\xc0\x01\n" +
+	"\x12SessionDescription\x12\x14\n" +
+	"\x05frame\x18\x01 \x01(\x04R\x05frame\x12\x10\n" +
+	"\x03sdp\x18\x02 \x01(\tR\x03sdp\x12\x12\n" +
+	"\x04path\x18\x03 \x01(\rR\x04path\x12\x14\n" +
+	"\x05paths\x18\x04 \x01(\rR\x05paths\x12\x12\n" +
+	"\x04bond\x18\x05 \x01(\tR\x04bond\x12\x1c\n" +
+	"\tsignature\x18\x06 \x01(\tR\tsignature\x12\x10\n" +
+	"\x03seq\x18\a \x01(\x04R\x03seq\x12\x14\n" +
+	"\x05nonce\x18\b \x01(\tR\x05nonce\"\xb1\x02\n" +
+	"\fIceCandidate\x12\x14\n" +
+	"\x05frame\x18\x01 \x01(\x04R\x05frame\x12\x1c\n" +
+	"\tcandidate\x18\x02 \x01(\tR\tcandidate\x12\x1c\n" +
+	"\asdp_mid\x18\x03 \x01(\tH\x00R\x06sdpMid\x88\x01\x01\x12+\n" +
+	"\x0fsdp_mline_index\x18\x04 \x01(\rH\x01R\rsdpMlineIndex\x88\x01\x01\x120\n" +
+	"\x11username_fragment\x18\x05 \x01(\tH\x02R\x10usernameFragment\x88\x01\x01\x12\x12\n" +
+	"\x04path\x18\x06 \x01(\rR\x04path\x12\x10\n" +
+	"\x03seq\x18\a \x01(\x04R\x03seq\x12\x14\n" +
+	"\x05nonce\x18\b \x01(\tR\x05nonceB\n" +
+	"\n" +
+	"\b_sdp_midB\x12\n" +
+	"\x10_sdp_mline_indexB\x14\n" +
+	"\x12_username_fragment\"\xd8\x03\n" +
+	"\aMessage\x12\x14\n" +
+	"\x05frame\x18\x01 \x01(\x04R\x05frame\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x12\n" +
+	"\x04path\x18\x03 \x01(\rR\x04path\x12\x14\n" +
+	"\x05addrs\x18\x04 \x03(\tR\x05addrs\x12\x14\n" +
+	"\x05token\x18\x05 \x01(\tR\x05token\x12 \n" +
+	"\vfingerprint\x18\x06 \x01(\tR\vfingerprint\x12\x18\n" +
+	"\aversion\x18\a \x01(\tR\aversion\x12\x1c\n" +
+	"\tchallenge\x18\b \x01(\tR\tchallenge\x12\x1d\n" +
+	"\n" +
+	"public_key\x18\t \x01(\tR\tpublicKey\x12\x1c\n" +
+	"\tsignature\x18\n" +
+	" \x01(\tR\tsignature\x12\x12\n" +
+	"\x04pake\x18\v \x01(\tR\x04pake\x12\x18\n" +
+	"\aconfirm\x18\f \x01(\tR\aconfirm\x12\x16\n" +
+	"\x06sealed\x18\r \x01(\tR\x06sealed\x12\x1a\n" +
+	"\bposition\x18\x0e \x01(\rR\bposition\x12\x10\n" +
+	"\x03seq\x18\x0f \x01(\x04R\x03seq\x12\x14\n" +
+	"\x05nonce\x18\x10 \x01(\tR\x05nonce\x12.\n" +
+	"\x05close\x18\x11 \x01(\v2\x18.roj1.signaling.v1.CloseR\x05close\x12\x12\n" +
+	"\x04quic\x18\x12 \x03(\tR\x04quic\"3\n" +
+	"\x05Close\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\rR\x04code\x12\x16\n" +
+	"\x06reason\x18\x02 \x01(\tR\x06reason2\xce\x02\n" +
+	"\tSignaling\x12E\n" +
+	"\aConnect\x12\x1a.roj1.signaling.v1.Message\x1a\x1a.roj1.signaling.v1.Message(\x010\x01\x12Q\n" +
+	"\x05Offer\x12\x1f.roj1.signaling.v1.OfferRequest\x1a%.roj1.signaling.v1.SessionDescription0\x01\x12T\n" +
+	"\x06Answer\x12%.roj1.signaling.v1.SessionDescription\x1a!.roj1.signaling.v1.AnswerResponse(\x01\x12Q\n" +
+	"\tCandidate\x12\x1f.roj1.signaling.v1.IceCandidate\x1a\x1f.roj1.signaling.v1.IceCandidate(\x010\x01B7Z5github.com/1ureka/roj1/internal/signaling/signalingpbb\x06proto3"
+
+var (
+	file_signaling_proto_rawDescOnce sync.Once
+	file_signaling_proto_rawDescData []byte
+)
+
+func file_signaling_proto_rawDescGZIP() []byte {
+	file_signaling_proto_rawDescOnce.Do(func() {
+		file_signaling_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_signaling_proto_rawDesc), len(file_signaling_proto_rawDesc)))
+	})
+	return file_signaling_proto_rawDescData
+}
+
+var file_signaling_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_signaling_proto_goTypes = []any{
+	(*OfferRequest)(nil),       // 0: roj1.signaling.v1.OfferRequest
+	(*AnswerResponse)(nil),     // 1: roj1.signaling.v1.AnswerResponse
+	(*SessionDescription)(nil), // 2: roj1.signaling.v1.SessionDescription
+	(*IceCandidate)(nil),       // 3: roj1.signaling.v1.IceCandidate
+	(*Message)(nil),            // 4: roj1.signaling.v1.Message
+	(*Close)(nil),              // 5: roj1.signaling.v1.Close
+}
+var file_signaling_proto_depIdxs = []int32{
+	5, // 0: roj1.signaling.v1.Message.close:type_name -> roj1.signaling.v1.Close
+	4, // 1: roj1.signaling.v1.Signaling.Connect:input_type -> roj1.signaling.v1.Message
+	0, // 2: roj1.signaling.v1.Signaling.Offer:input_type -> roj1.signaling.v1.OfferRequest
+	2, // 3: roj1.signaling.v1.Signaling.Answer:input_type -> roj1.signaling.v1.SessionDescription
+	3, // 4: roj1.signaling.v1.Signaling.Candidate:input_type -> roj1.signaling.v1.IceCandidate
+	4, // 5: roj1.signaling.v1.Signaling.Connect:output_type -> roj1.signaling.v1.Message
+	2, // 6: roj1.signaling.v1.Signaling.Offer:output_type -> roj1.signaling.v1.SessionDescription
+	1, // 7: roj1.signaling.v1.Signaling.Answer:output_type -> roj1.signaling.v1.AnswerResponse
+	3, // 8: roj1.signaling.v1.Signaling.Candidate:output_type -> roj1.signaling.v1.IceCandidate
+	5, // [5:9] is the sub-list for method output_type
+	1, // [1:5] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_signaling_proto_init() }
+func file_signaling_proto_init() {
+	if File_signaling_proto != nil {
+		return
+	}
+	file_signaling_proto_msgTypes[3].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_signaling_proto_rawDesc), len(file_signaling_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_signaling_proto_goTypes,
+		DependencyIndexes: file_signaling_proto_depIdxs,
+		MessageInfos:      file_signaling_proto_msgTypes,
+	}.Build()
+	File_signaling_proto = out.File
+	file_signaling_proto_goTypes = nil
+	file_signaling_proto_depIdxs = nil
+}
@@ -0,0 +1,58 @@
+package signaling
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// ErrVersion is wrapped (together with ErrSignaling) when the peer's major
+// version differs and Options.StrictVersion is set.
+var ErrVersion = errors.New("incompatible peer version")
+
+// sendHello announces this side's version (and authentication, see auth.go).
+// The client sends it first; the host only answers one, since clients that
+// predate the hello would reject it as a message for an unknown path. Hosts
+// that predate it ignore it.
+func sendHello(conn sigConn, mu *sync.Mutex, codec *codec, hello message) error {
+	hello.Type = msgTypeHello
+	mu.Lock()
+	defer mu.Unlock()
+	return codec.writeJSON(conn, hello)
+}
+
+// checkVersion compares the peer's version with ours. A different major
+// version is reported with a warning, or as ErrVersion if strict. Versions
+// without a numeric major (e.g. "dev" builds) are not compared.
+func checkVersion(local, remote string, strict bool) error {
+	lm, lok := majorVersion(local)
+	rm, rok := majorVersion(remote)
+	if !lok || !rok {
+		util.LogDebug("peer version %q, local version %q: not compared", remote, local)
+		return nil
+	}
+	if lm == rm {
+		util.LogDebug("peer version %s is compatible", remote)
+		return nil
+	}
+
+	if strict {
+		return fmt.Errorf("%w: peer runs v%s, this is v%s", ErrVersion, remote, local)
+	}
+	util.LogWarning("the peer runs roj1 v%s but this is v%s — major versions differ and the tunnel may corrupt data; upgrade both sides (-strictVersion refuses such peers)",
+		remote, local)
+	return nil
+}
+
+// majorVersion parses the major number of a version such as "1.4.2" or
+// "v2.0.0-rc1".
+func majorVersion(v string) (int, bool) {
+	v = strings.TrimPrefix(v, "v")
+	major, _, _ := strings.Cut(v, ".")
+	n, err := strconv.Atoi(major)
+	return n, err == nil
+}
@@ -2,9 +2,18 @@ package signaling
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"html"
+	"io"
 	"net"
 	"net/http"
+	"net/url"
+	urlpath "path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 
@@ -15,10 +24,136 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
 
+// sigConn is a signaling connection (private): a WebSocket, or an HTTP
+// polling session standing in for one where WebSockets are blocked (see
+// poll.go). A close frame written with WriteMessage reaches the peer as a
+// *websocket.CloseError either way.
+type sigConn interface {
+	ReadJSON(v any) error
+	WriteJSON(v any) error
+	WriteMessage(messageType int, data []byte) error
+	SetWriteDeadline(t time.Time) error
+	Close() error
+}
+
+// DefaultWSPath is where a host's WS server accepts clients unless told
+// otherwise (see Listen). Polling sessions and handlers added with
+// Listener.Handle live next to it: under the same path without a final /ws,
+// e.g. /custom/poll for /custom/ws.
+const DefaultWSPath = "/ws"
+
+// ValidWSPath reports whether p can be a WS server's path: absolute and
+// clean, without a query, such as /ws or /team-a/roj1/ws.
+func ValidWSPath(p string) bool {
+	return strings.HasPrefix(p, "/") && urlpath.Clean(p) == p && !strings.ContainsAny(p, "?#")
+}
+
+// basePath returns the prefix the endpoints next to the WebSocket at wsPath
+// share (see DefaultWSPath).
+func basePath(wsPath string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(wsPath, "/"), "/ws")
+}
+
+const (
+	queuePingPeriod   = 30 * time.Second // queued clients are re-sent their position this often
+	queueWriteTimeout = 5 * time.Second  // a queued client that takes longer to write to is dropped
+	shutdownGrace     = 2 * time.Second  // requests still running when the server closes get this long to end
+)
+
 // server is the host-side WebSocket server used during signaling (private).
+// The first client is handed to the host; while the host has a client, others
+// wait in a queue of up to queueLen, or are refused.
 type server struct {
 	listener net.Listener
-	connCh   chan *websocket.Conn
+	connCh   chan sigConn // holds at most the client handed to an idle host
+	queueLen int          // clients that may wait while the host is busy (0 = none)
+
+	grpc   *grpcService   // serves the gRPC Signaling service instead of WebSockets (see grpc.go)
+	path   string         // of the WebSocket endpoint ("" = DefaultWSPath)
+	mux    *http.ServeMux // routes WebSocket and polling requests (nil with grpc)
+	http   *http.Server
+	served chan struct{} // closed once http stopped serving
+
+	mu    sync.Mutex
+	idle  bool      // the host has no client and none is on connCh
+	queue []sigConn // waiting clients, first in line first
+
+	pollMu sync.Mutex
+	polls  map[string]*pollConn // HTTP polling sessions by ID (see poll.go)
+}
+
+// Server is a host's signaling server kept open across sessions (see
+// Options.Server): a Listener serving WebSockets, or a GRPCListener serving
+// the gRPC Signaling service. Clients pick the protocol by URL scheme (see
+// dial), and either server hands them to the host, queues or refuses them the
+// same way.
+type Server interface {
+	// Port returns the port the server listens on.
+	Port() int
+
+	// Close shuts the server down, turning away the clients still queued.
+	Close()
+
+	waitForClient(ctx context.Context) (sigConn, error)
+}
+
+// Listener is a host's WS signaling server kept open across sessions, so
+// that clients arriving while a tunnel is up can wait in line for it to end
+// instead of being refused. Queued clients are told their position as it
+// changes.
+type Listener struct {
+	srv     *server
+	port    int
+	done    chan struct{}
+	stopped chan struct{} // closed once the queue is no longer kept
+}
+
+// Listen starts a Listener on addr (see EstablishAsHost), accepting clients
+// at path ("" = DefaultWSPath), with room for up to queue waiting clients.
+func Listen(addr, path string, queue int) (*Listener, error) {
+	if path != "" && !ValidWSPath(path) {
+		return nil, fmt.Errorf("%w: invalid WS path %q", ErrSignaling, path)
+	}
+	return listen(&server{connCh: make(chan sigConn, 1), queueLen: queue, path: path}, addr)
+}
+
+// listen starts srv on addr and keeps its queue.
+func listen(srv *server, addr string) (*Listener, error) {
+	port, err := srv.start(addr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSignaling, err)
+	}
+	l := &Listener{srv: srv, port: port, done: make(chan struct{}), stopped: make(chan struct{})}
+	go func() {
+		defer close(l.stopped)
+		srv.keepQueue(l.done)
+	}()
+	return l, nil
+}
+
+// Port returns the port l listens on.
+func (l *Listener) Port() int {
+	return l.port
+}
+
+// Close shuts l down, turning away the clients still in its queue. It returns
+// once the server and its goroutines are gone; connections already handed to
+// the host are left to it.
+func (l *Listener) Close() {
+	close(l.done)
+	l.srv.close()
+	<-l.stopped
+}
+
+// Handle serves h at name next to the WebSocket endpoint (see
+// DefaultWSPath), for as long as l is open, e.g. a status page at /status for
+// whoever has the host's URL.
+func (l *Listener) Handle(name string, h http.Handler) {
+	l.srv.mux.Handle(basePath(l.srv.wsPath())+name, h)
+}
+
+func (l *Listener) waitForClient(ctx context.Context) (sigConn, error) {
+	return l.srv.waitForClient(ctx)
 }
 
 // start begins listening on the given address (e.g. ":0", "127.0.0.1:9000").
@@ -26,39 +161,142 @@ type server struct {
 func (s *server) start(addr string) (int, error) {
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
+		if s.grpc != nil {
+			return 0, fmt.Errorf("failed to start gRPC server: %w", err)
+		}
 		return 0, fmt.Errorf("failed to start WS server: %w", err)
 	}
 	s.listener = listener
+	s.idle = true
 	port := listener.Addr().(*net.TCPAddr).Port
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/ws", s.handleWS)
+	if s.grpc != nil {
+		s.grpc.serve(listener)
+		return port, nil
+	}
 
-	go func() {
-		_ = http.Serve(listener, mux)
-	}()
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc(s.wsPath(), s.handleWS)
+	s.handlePolls(s.mux, basePath(s.wsPath()))
+	s.serve(listener, &http.Server{Handler: s.mux})
 
 	return port, nil
 }
 
+// wsPath returns the path of s's WebSocket endpoint.
+func (s *server) wsPath() string {
+	if s.path == "" {
+		return DefaultWSPath
+	}
+	return s.path
+}
+
+// serve runs srv on listener until close.
+func (s *server) serve(listener net.Listener, srv *http.Server) {
+	s.http = srv
+	s.served = make(chan struct{})
+	go func() {
+		defer close(s.served)
+		_ = srv.Serve(listener)
+	}()
+}
+
 func (s *server) handleWS(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		return
 	}
+	s.place(conn)
+}
 
-	// Only accept the first client.
-	select {
-	case s.connCh <- conn:
+// place hands a new client to the idle host, queues it, or refuses it.
+func (s *server) place(conn sigConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case s.idle:
+		s.idle = false
+		s.connCh <- conn // never blocks: connCh is empty while idle
+	case len(s.queue) < s.queueLen:
+		s.queue = append(s.queue, conn)
+		util.LogInfo("client queued — %d waiting", len(s.queue))
+		s.tellPositions()
 	default:
+		reason := "already connected"
+		if s.queueLen > 0 {
+			reason = "the queue is full"
+		}
 		conn.WriteMessage(websocket.CloseMessage,
-			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "already connected"))
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason))
 		conn.Close()
 	}
 }
 
-// waitForClient blocks until a client connects or context is cancelled.
-func (s *server) waitForClient(ctx context.Context) (*websocket.Conn, error) {
+// tellPositions sends each queued client its place in line, dropping those
+// that cannot be written to. s.mu must be held.
+func (s *server) tellPositions() {
+	kept := s.queue[:0]
+	for _, conn := range s.queue {
+		if tellPosition(conn, len(kept)+1) == nil {
+			kept = append(kept, conn)
+		} else {
+			conn.Close()
+		}
+	}
+	clear(s.queue[len(kept):])
+	s.queue = kept
+}
+
+// tellPosition sends a client its place in line; 0 means its turn has come.
+func tellPosition(conn sigConn, position int) error {
+	conn.SetWriteDeadline(time.Now().Add(queueWriteTimeout))
+	defer conn.SetWriteDeadline(time.Time{})
+	return conn.WriteJSON(message{Type: msgTypeQueued, Position: position})
+}
+
+// keepQueue re-sends queued clients their positions until the server closes,
+// so that proxies keep their connections open and departed ones are noticed.
+func (s *server) keepQueue(done <-chan struct{}) {
+	ticker := time.NewTicker(queuePingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			s.tellPositions()
+			s.mu.Unlock()
+		case <-done:
+			return
+		}
+	}
+}
+
+// waitForClient blocks until a client connects or context is cancelled. A
+// queued client is taken first, once told its turn has come.
+func (s *server) waitForClient(ctx context.Context) (sigConn, error) {
+	s.mu.Lock()
+	select {
+	case conn := <-s.connCh:
+		s.mu.Unlock()
+		return conn, nil
+	default:
+	}
+	for len(s.queue) > 0 {
+		conn := s.queue[0]
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+		if tellPosition(conn, 0) != nil {
+			conn.Close()
+			continue
+		}
+		s.tellPositions()
+		s.mu.Unlock()
+		return conn, nil
+	}
+	s.idle = true
+	s.mu.Unlock()
+
 	select {
 	case conn := <-s.connCh:
 		return conn, nil
@@ -69,19 +307,155 @@ func (s *server) waitForClient(ctx context.Context) (*websocket.Conn, error) {
 
 // close shuts down the listener, preventing new connections.
 func (s *server) close() {
-	util.LogInfo("Closing WebSocket server...")
+	if s.grpc != nil {
+		util.LogInfo("Closing gRPC server...")
+	} else {
+		util.LogInfo("Closing WebSocket server...")
+	}
 
 	if s.listener != nil {
 		s.listener.Close()
 	}
+
+	s.mu.Lock()
+	select {
+	case conn := <-s.connCh: // arrived after the host stopped waiting
+		conn.Close()
+	default:
+	}
+	for _, conn := range s.queue {
+		conn.WriteMessage(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseGoingAway, "the host is shutting down"))
+		conn.Close()
+	}
+	s.queue = nil
+	s.mu.Unlock()
+
+	s.pollMu.Lock()
+	polls := make([]*pollConn, 0, len(s.polls))
+	for _, c := range s.polls {
+		polls = append(polls, c)
+	}
+	s.pollMu.Unlock()
+	for _, c := range polls {
+		c.Close() // what is left to fetch still can be, over open connections
+	}
+
+	if s.http != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+		if s.http.Shutdown(ctx) != nil {
+			s.http.Close()
+		}
+		cancel()
+		<-s.served
+	}
+	if s.grpc != nil {
+		s.grpc.stop()
+	}
 }
 
+// HandshakeError is returned when a WS server answers the handshake with an
+// HTTP error, such as a relay's 404 for a room nobody waits in, or a 401 from
+// a proxy in front of the host. A proxy that drops the Upgrade header shows
+// as a 200 or 400 with a web page in Reason.
+type HandshakeError struct {
+	StatusCode int
+	Status     string // e.g. "401 Unauthorized"
+	Reason     string // the start of the response body as plain text, if any
+	Server     string // the Server header, e.g. "nginx", if any
+	Location   string // where a redirect points, if it is one
+}
+
+func (e *HandshakeError) Error() string {
+	status := e.Status
+	if e.Server != "" {
+		status += ", " + e.Server
+	}
+	switch {
+	case e.Location != "":
+		return fmt.Sprintf("failed to connect to WS server: redirected to %s (%s)", e.Location, status)
+	case e.Reason == "":
+		return "failed to connect to WS server: " + status
+	default:
+		return fmt.Sprintf("failed to connect to WS server: %s (%s)", e.Reason, status)
+	}
+}
+
+// ErrUpgradeStalled is returned when a WS server never answers the handshake
+// but does answer plain HTTP requests: a proxy in between buffers the
+// upgrade.
+var ErrUpgradeStalled = errors.New("the server answers plain HTTP requests but not the WebSocket upgrade")
+
+const (
+	handshakeTimeout = 15 * time.Second // for the server to answer the WebSocket upgrade
+	probeTimeout     = 5 * time.Second  // for it to answer a plain request, once it did not
+	maxReasonLen     = 200              // runes of a refusing response's body kept in HandshakeError
+)
+
+var (
+	htmlCode = regexp.MustCompile(`(?is)<(script|style)\b.*?</(script|style)>`)
+	htmlTag  = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
 // connect dials the given WebSocket URL and returns the connection (private).
-func connect(ctx context.Context, url string) (*websocket.Conn, error) {
-	dialer := websocket.DefaultDialer
-	conn, _, err := dialer.DialContext(ctx, url, nil)
+// A refused handshake is reported with the server's reason, such as a relay's
+// "no host is waiting in room ...", as a HandshakeError; one that is never
+// answered is probed with a plain request, to tell a stalling proxy
+// (ErrUpgradeStalled) from an unreachable server.
+func connect(ctx context.Context, wsURL string) (*websocket.Conn, error) {
+	dialer := *websocket.DefaultDialer
+	dialer.HandshakeTimeout = handshakeTimeout
+	conn, resp, err := dialer.DialContext(ctx, wsURL, nil)
+	if err == nil {
+		return conn, nil
+	}
+	var netErr net.Error
+	switch {
+	case errors.Is(err, websocket.ErrBadHandshake) && resp != nil:
+		return nil, handshakeError(resp)
+	case errors.As(err, &netErr) && netErr.Timeout() && ctx.Err() == nil && answersPlain(ctx, wsURL):
+		return nil, fmt.Errorf("failed to connect to WS server: %w: %w", ErrUpgradeStalled, err)
+	}
+	return nil, fmt.Errorf("failed to connect to WS server: %w", err)
+}
+
+// handshakeError describes a response other than 101 Switching Protocols.
+func handshakeError(resp *http.Response) *HandshakeError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	reason := string(body)
+	if strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		reason = html.UnescapeString(htmlTag.ReplaceAllString(htmlCode.ReplaceAllString(reason, " "), " "))
+	}
+	reason = strings.Join(strings.Fields(reason), " ")
+	if r := []rune(reason); len(r) > maxReasonLen {
+		reason = string(r[:maxReasonLen]) + "…"
+	}
+	e := &HandshakeError{StatusCode: resp.StatusCode, Status: resp.Status, Reason: reason, Server: resp.Header.Get("Server")}
+	if resp.StatusCode/100 == 3 {
+		e.Location = resp.Header.Get("Location")
+	}
+	return e
+}
+
+// answersPlain reports whether the server of a WebSocket URL answers a plain
+// HTTP request for it within probeTimeout, whatever the answer.
+func answersPlain(ctx context.Context, wsURL string) bool {
+	u, err := url.Parse(wsURL)
+	if err != nil {
+		return false
+	}
+	u.Scheme = strings.Replace(u.Scheme, "ws", "http", 1)
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return false
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to WS server: %w", err)
+		return false
 	}
-	return conn, nil
+	resp.Body.Close()
+	return true
 }
@@ -0,0 +1,188 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/1ureka/roj1/internal/protocol"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// BondMode selects how a Bond spreads packets across its paths.
+type BondMode int
+
+const (
+	// BondStripe sends each packet on one path, round-robin, for throughput.
+	BondStripe BondMode = iota
+	// BondDuplicate sends every packet on all paths, for reliability; the far
+	// side keeps whichever copy arrives first.
+	BondDuplicate
+)
+
+// String returns the mode name as used on the command line.
+func (m BondMode) String() string {
+	if m == BondDuplicate {
+		return "duplicate"
+	}
+	return "stripe"
+}
+
+// ParseBondMode parses a mode name ("stripe" or "duplicate").
+func ParseBondMode(s string) (BondMode, error) {
+	switch s {
+	case "stripe":
+		return BondStripe, nil
+	case "duplicate":
+		return BondDuplicate, nil
+	default:
+		return 0, fmt.Errorf("unknown bond mode %q (want stripe or duplicate)", s)
+	}
+}
+
+// Bond bundles several parallel paths (e.g. PeerConnections bound to
+// different uplinks) into one Carrier. Packets are striped or duplicated
+// across the live paths according to the mode and received from all of them;
+// the adapter's per-socket reassembler restores order and drops duplicates.
+// A dead path is skipped; the Bond is done once every path is done.
+type Bond struct {
+	mode  BondMode
+	paths []Carrier
+	next  atomic.Uint32
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewBond creates a Bond over the given paths. At least one path is required.
+func NewBond(mode BondMode, paths ...Carrier) *Bond {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &Bond{mode: mode, paths: paths, ctx: ctx, cancel: cancel}
+
+	var wg sync.WaitGroup
+	for _, p := range paths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-p.Done()
+			b.mu.Lock()
+			b.err = p.Err()
+			b.mu.Unlock()
+			util.LogDebug("bonded path done: %v", p.Err())
+		}()
+	}
+	go func() {
+		wg.Wait()
+		cancel()
+	}()
+
+	return b
+}
+
+// alive returns the paths that are not done yet.
+func (b *Bond) alive() []Carrier {
+	live := make([]Carrier, 0, len(b.paths))
+	for _, p := range b.paths {
+		select {
+		case <-p.Done():
+		default:
+			live = append(live, p)
+		}
+	}
+	return live
+}
+
+// each calls fn with the path(s) a packet should be sent on.
+func (b *Bond) each(fn func(Carrier)) {
+	live := b.alive()
+	if len(live) == 0 {
+		return
+	}
+
+	if b.mode == BondDuplicate {
+		for _, p := range live {
+			fn(p)
+		}
+		return
+	}
+	fn(live[int(b.next.Add(1))%len(live)])
+}
+
+// SendConnect sends a CONNECT packet according to the bond mode.
+func (b *Bond) SendConnect(socketID, seqNum uint32) {
+	b.each(func(p Carrier) { p.SendConnect(socketID, seqNum) })
+}
+
+// SendData sends a DATA packet according to the bond mode.
+func (b *Bond) SendData(socketID, seqNum uint32, payload []byte) {
+	b.each(func(p Carrier) { p.SendData(socketID, seqNum, payload) })
+}
+
+// SendClose sends a CLOSE packet according to the bond mode.
+func (b *Bond) SendClose(socketID, seqNum uint32) {
+	b.each(func(p Carrier) { p.SendClose(socketID, seqNum) })
+}
+
+// SendNack sends a NACK packet according to the bond mode.
+func (b *Bond) SendNack(socketID, first, last uint32) {
+	b.each(func(p Carrier) { p.SendNack(socketID, first, last) })
+}
+
+// SendControl sends a CONTROL packet according to the bond mode.
+func (b *Bond) SendControl(payload []byte) {
+	b.each(func(p Carrier) { p.SendControl(payload) })
+}
+
+// WaitWritable waits until every live path that queues outgoing packets
+// accepts more data.
+func (b *Bond) WaitWritable(ctx context.Context, socketID uint32) error {
+	for _, p := range b.alive() {
+		if w, ok := p.(writable); ok {
+			if err := w.WaitWritable(ctx, socketID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// OnPacket registers fn on every path.
+func (b *Bond) OnPacket(fn func(*protocol.Packet)) {
+	for _, p := range b.paths {
+		p.OnPacket(fn)
+	}
+}
+
+// Done returns a channel that is closed once every path is done.
+func (b *Bond) Done() <-chan struct{} {
+	return b.ctx.Done()
+}
+
+// Err returns nil while any path is alive. Afterwards it returns the error
+// of the last path to die, or context.Canceled if the Bond was closed.
+func (b *Bond) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case b.ctx.Err() == nil:
+		return nil
+	case b.err != nil:
+		return b.err
+	default:
+		return context.Canceled
+	}
+}
+
+// Close closes every path.
+func (b *Bond) Close() error {
+	for _, p := range b.paths {
+		p.Close()
+	}
+	b.cancel()
+	return nil
+}
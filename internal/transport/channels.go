@@ -0,0 +1,149 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+
+	"github.com/1ureka/roj1/internal/protocol"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// socketChannelPrefix labels per-socket DataChannels, followed by the
+// socketID in hex (e.g. "socket-1a2b3c4d").
+const socketChannelPrefix = "socket-"
+
+// socketChannel is an ordered DataChannel dedicated to one socket, with its
+// own sender. It is released once CLOSE has been both sent and received.
+type socketChannel struct {
+	dc     *webrtc.DataChannel
+	sender *sender
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	sentClose bool
+	recvClose bool
+}
+
+// openChannel creates the ordered DataChannel for socketID. The peer adopts it
+// through OnDataChannel.
+func (t *Transport) openChannel(socketID uint32) {
+	ordered := true
+	dc, err := t.pc.CreateDataChannel(fmt.Sprintf("%s%08x", socketChannelPrefix, socketID), &webrtc.DataChannelInit{
+		Ordered: &ordered,
+	})
+	if err != nil {
+		util.LogWarning("[%08x] failed to open socket channel, using the shared channel: %v", socketID, err)
+		return
+	}
+	t.addChannel(socketID, dc)
+}
+
+// adoptChannel registers a per-socket DataChannel opened by the peer.
+func (t *Transport) adoptChannel(dc *webrtc.DataChannel) {
+	var socketID uint32
+	if _, err := fmt.Sscanf(dc.Label(), socketChannelPrefix+"%08x", &socketID); err != nil {
+		util.LogWarning("ignoring unexpected DataChannel %q", dc.Label())
+		dc.Close()
+		return
+	}
+	t.addChannel(socketID, dc)
+}
+
+// addChannel wires a per-socket DataChannel: once it opens, inbound messages
+// go to the packet callback, and the channel is dropped from the table when
+// it closes.
+func (t *Transport) addChannel(socketID uint32, dc *webrtc.DataChannel) {
+	ctx, cancel := context.WithCancel(t.ctx)
+	open := make(chan struct{})
+	ch := &socketChannel{dc: dc, sender: newSender(ctx, dc, open, t.marks, t.queue, t.pacer, t.lowPower), ctx: ctx, cancel: cancel}
+
+	closed := func() {
+		t.chMu.Lock()
+		if t.channels[socketID] == ch {
+			delete(t.channels, socketID)
+		}
+		t.chMu.Unlock()
+		cancel()
+	}
+
+	onDetached(dc, func(rwc io.ReadWriteCloser) {
+		ch.sender.w = rwc
+		close(open)
+		go func() {
+			readMessages(rwc, func(data []byte) {
+				if pkt := t.receive(data); pkt != nil && pkt.Type == protocol.TypeClose {
+					t.closeReceived(socketID)
+				}
+			})
+			closed()
+		}()
+	})
+	dc.OnClose(closed)
+
+	t.chMu.Lock()
+	if old, ok := t.channels[socketID]; ok {
+		go old.release()
+	}
+	t.channels[socketID] = ch
+	t.chMu.Unlock()
+
+	util.LogDebug("[%08x] socket channel opened", socketID)
+}
+
+// senderFor returns the sender of socketID's channel, or the shared sender.
+func (t *Transport) senderFor(socketID uint32) *sender {
+	t.chMu.Lock()
+	defer t.chMu.Unlock()
+
+	if ch, ok := t.channels[socketID]; ok {
+		return ch.sender
+	}
+	return t.sender
+}
+
+// closeSent records that CLOSE was sent for socketID.
+func (t *Transport) closeSent(socketID uint32) {
+	t.chMu.Lock()
+	defer t.chMu.Unlock()
+
+	if ch, ok := t.channels[socketID]; ok {
+		ch.sentClose = true
+		t.maybeRelease(socketID, ch)
+	}
+}
+
+// closeReceived records that CLOSE was received for socketID.
+func (t *Transport) closeReceived(socketID uint32) {
+	t.chMu.Lock()
+	defer t.chMu.Unlock()
+
+	if ch, ok := t.channels[socketID]; ok {
+		ch.recvClose = true
+		t.maybeRelease(socketID, ch)
+	}
+}
+
+// maybeRelease drops the channel once both sides have sent CLOSE. Must be
+// called with t.chMu held.
+func (t *Transport) maybeRelease(socketID uint32, ch *socketChannel) {
+	if ch.sentClose && ch.recvClose {
+		delete(t.channels, socketID)
+		go ch.release()
+	}
+}
+
+// release closes the channel once everything queued on it has been sent.
+func (ch *socketChannel) release() {
+	ch.sender.finish(ch.ctx, func() {
+		ch.dc.Close()
+		ch.cancel()
+	})
+}
+
+// channelDrainTimeout bounds how long a released channel waits for its
+// buffered data to be sent before closing anyway.
+const channelDrainTimeout = 5 * time.Second
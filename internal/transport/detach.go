@@ -0,0 +1,52 @@
+package transport
+
+import (
+	"io"
+	"sync"
+
+	"github.com/pion/webrtc/v4"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// maxMessageSize bounds an inbound DataChannel message; it is pion's default
+// SCTP maximum message size. Packets are far smaller (protocol.MaxPayloadSize
+// plus the header).
+const maxMessageSize = 64 * 1024
+
+// Every DataChannel is detached (webrtc.SettingEngine.DetachDataChannels):
+// instead of pion's OnMessage callback, which allocates each message, the
+// channel is used as a message-oriented io.ReadWriteCloser. One Read returns
+// one message and one Write sends one, so the stream can be wrapped (e.g. for
+// compression) like any other io.ReadWriteCloser.
+
+// onDetached calls fn once with dc's raw stream when dc opens. A channel
+// that cannot be detached is closed.
+func onDetached(dc *webrtc.DataChannel, fn func(io.ReadWriteCloser)) {
+	var once sync.Once
+	dc.OnOpen(func() {
+		once.Do(func() {
+			rwc, err := dc.Detach()
+			if err != nil {
+				util.LogError("failed to detach DataChannel %q: %v", dc.Label(), err)
+				dc.Close()
+				return
+			}
+			fn(rwc)
+		})
+	})
+}
+
+// readMessages reads messages from r into a reused buffer and passes each to
+// fn, which must not retain it, until r fails (io.EOF once the channel is
+// closed).
+func readMessages(r io.Reader, fn func([]byte)) error {
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			return err
+		}
+		fn(buf[:n])
+	}
+}
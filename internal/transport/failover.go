@@ -0,0 +1,215 @@
+package transport
+
+import (
+	"context"
+	"sync"
+
+	"github.com/1ureka/roj1/internal/protocol"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// Carrier is a packet transport that can drive the adapter layer. Transport
+// (WebRTC DataChannel), StreamTransport (TCP/TLS or QUIC), Bond and Failover
+// implement it.
+type Carrier interface {
+	SendConnect(socketID, seqNum uint32)
+	SendData(socketID, seqNum uint32, payload []byte)
+	SendClose(socketID, seqNum uint32)
+	SendNack(socketID, first, last uint32)
+	SendControl(payload []byte)
+	OnPacket(fn func(*protocol.Packet))
+	Done() <-chan struct{}
+	Err() error
+	Close() error
+}
+
+// writable is implemented by carriers that can report congestion.
+type writable interface {
+	WaitWritable(ctx context.Context, socketID uint32) error
+}
+
+// Failover bundles several Carriers behind one, in order of preference.
+// Packets are sent on the first carrier that is still alive and received from
+// all of them, so both peers may prefer different carriers. When the active
+// carrier dies, sending moves on to the next one. Packets in flight on a dead
+// carrier are lost, so connections that were mid-transfer may stall or reset
+// unless the adapter recovers them (see adapter.HostConfig.Nack); new
+// connections are unaffected.
+//
+// Failover is done once every carrier is done; only then is the tunnel
+// reported as closed.
+type Failover struct {
+	mu       sync.Mutex
+	carriers []Carrier
+	handler  func(*protocol.Packet)
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+	err       error
+}
+
+// NewFailover creates a Failover over the given carriers (most preferred
+// first). At least one carrier is required.
+func NewFailover(carriers ...Carrier) *Failover {
+	ctx, cancel := context.WithCancel(context.Background())
+	f := &Failover{ctx: ctx, cancel: cancel}
+	for _, c := range carriers {
+		f.Add(c)
+	}
+	return f
+}
+
+// Add appends a standby carrier with the lowest preference. Adding to a
+// Failover that is already done closes c instead.
+func (f *Failover) Add(c Carrier) {
+	f.mu.Lock()
+	if f.ctx.Err() != nil {
+		f.mu.Unlock()
+		c.Close()
+		return
+	}
+	f.carriers = append(f.carriers, c)
+	if f.handler != nil {
+		c.OnPacket(f.handler)
+	}
+	f.mu.Unlock()
+
+	go f.watch(c)
+}
+
+// watch waits for c to die, then logs the failover or, if it was the last
+// carrier alive, shuts the Failover down.
+func (f *Failover) watch(c Carrier) {
+	<-c.Done()
+
+	f.mu.Lock()
+	next := f.activeLocked()
+	if next == nil {
+		f.err = c.Err()
+	}
+	f.mu.Unlock()
+
+	if next == nil {
+		f.shutdown()
+		return
+	}
+	util.LogWarning("transport failed (%v) — failing over to standby transport", c.Err())
+}
+
+// activeLocked returns the most preferred carrier that is still alive, or nil.
+// Must be called with f.mu held.
+func (f *Failover) activeLocked() Carrier {
+	for _, c := range f.carriers {
+		select {
+		case <-c.Done():
+		default:
+			return c
+		}
+	}
+	return nil
+}
+
+// active returns the carrier to send on, or nil if none is alive.
+func (f *Failover) active() Carrier {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.activeLocked()
+}
+
+// SendConnect sends a CONNECT packet on the active carrier.
+func (f *Failover) SendConnect(socketID, seqNum uint32) {
+	if c := f.active(); c != nil {
+		c.SendConnect(socketID, seqNum)
+	}
+}
+
+// SendData sends a DATA packet on the active carrier.
+func (f *Failover) SendData(socketID, seqNum uint32, payload []byte) {
+	if c := f.active(); c != nil {
+		c.SendData(socketID, seqNum, payload)
+	}
+}
+
+// SendClose sends a CLOSE packet on the active carrier.
+func (f *Failover) SendClose(socketID, seqNum uint32) {
+	if c := f.active(); c != nil {
+		c.SendClose(socketID, seqNum)
+	}
+}
+
+// SendNack sends a NACK packet on the active carrier.
+func (f *Failover) SendNack(socketID, first, last uint32) {
+	if c := f.active(); c != nil {
+		c.SendNack(socketID, first, last)
+	}
+}
+
+// SendControl sends a CONTROL packet on the active carrier.
+func (f *Failover) SendControl(payload []byte) {
+	if c := f.active(); c != nil {
+		c.SendControl(payload)
+	}
+}
+
+// WaitWritable waits for the active carrier to accept more data, if it
+// queues outgoing packets (see Transport.WaitWritable).
+func (f *Failover) WaitWritable(ctx context.Context, socketID uint32) error {
+	if w, ok := f.active().(writable); ok {
+		return w.WaitWritable(ctx, socketID)
+	}
+	return nil
+}
+
+// OnPacket registers fn on every carrier, current and future.
+func (f *Failover) OnPacket(fn func(*protocol.Packet)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.handler = fn
+	for _, c := range f.carriers {
+		c.OnPacket(fn)
+	}
+}
+
+// Done returns a channel that is closed once every carrier is done.
+func (f *Failover) Done() <-chan struct{} {
+	return f.ctx.Done()
+}
+
+// Err returns nil while any carrier is alive. Afterwards it returns the error
+// of the last carrier to die, or context.Canceled if the Failover was closed.
+func (f *Failover) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case f.ctx.Err() == nil:
+		return nil
+	case f.err != nil:
+		return f.err
+	default:
+		return context.Canceled
+	}
+}
+
+// Close closes every carrier.
+func (f *Failover) Close() error {
+	f.mu.Lock()
+	carriers := f.carriers
+	f.mu.Unlock()
+
+	for _, c := range carriers {
+		c.Close()
+	}
+	f.shutdown()
+	return nil
+}
+
+// shutdown reports the tunnel as closed (once) and cancels the Failover
+// context. The state is notified first so that it is observed before anything
+// waiting on Done resumes.
+func (f *Failover) shutdown() {
+	f.closeOnce.Do(func() { util.NotifyState(util.StateClosed) })
+	f.cancel()
+}
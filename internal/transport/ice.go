@@ -0,0 +1,123 @@
+package transport
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pion/webrtc/v4"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// ICE progress: a Transport reports how its ICE gathering and connectivity
+// checks are getting on as ice_progress events (see util.EventICEProgress),
+// so that a waiting user sees more than a silent spinner.
+
+// iceProgress counts the candidates of a Transport.
+type iceProgress struct {
+	mu          sync.Mutex
+	state       string // one of the util.ICE* states, "" before gathering
+	local       int
+	srflx       int // of local: server-reflexive, learnt from STUN
+	remote      int
+	onCandidate func(*webrtc.ICECandidate) // see Transport.OnICECandidate
+}
+
+// watchICE makes t report its ICE progress.
+func (t *Transport) watchICE() {
+	t.pc.OnICECandidate(func(c *webrtc.ICECandidate) {
+		t.ice.mu.Lock()
+		if c != nil {
+			t.ice.local++
+		}
+		if c != nil && c.Typ == webrtc.ICECandidateTypeSrflx {
+			t.ice.srflx++
+		}
+		fn := t.ice.onCandidate
+		t.ice.mu.Unlock()
+
+		if c != nil {
+			t.reportICE(util.ICEGathering, "")
+		}
+		if fn != nil {
+			fn(c)
+		}
+	})
+	t.pc.SCTP().Transport().ICETransport().OnSelectedCandidatePairChange(func(pair *webrtc.ICECandidatePair) {
+		t.reportICE(util.ICEConnected, describePair(pair))
+	})
+}
+
+// iceFailed shuts t down once ICE has given up. Unless a candidate pair was
+// selected before, the checks timed out.
+func (t *Transport) iceFailed() {
+	t.ice.mu.Lock()
+	connected := t.ice.state == util.ICEConnected
+	t.ice.mu.Unlock()
+
+	if !connected {
+		util.LogWarning("no ICE candidate pair worked — closing transport")
+		t.shutdown(fmt.Errorf("%w: %w", ErrConnectionFailed, ErrICETimeout))
+	}
+}
+
+// ICEChecking reports whether ICE is checking candidate pairs and none has
+// worked yet.
+func (t *Transport) ICEChecking() bool {
+	t.ice.mu.Lock()
+	defer t.ice.mu.Unlock()
+	return t.ice.state == util.ICEChecking
+}
+
+// addRemote counts n remote candidates.
+func (t *Transport) addRemote(n int) {
+	if n == 0 {
+		return
+	}
+	t.ice.mu.Lock()
+	t.ice.remote += n
+	state := t.ice.state
+	t.ice.mu.Unlock()
+
+	if state == util.ICEChecking {
+		t.reportICE(util.ICEChecking, "")
+	}
+}
+
+// reportICE emits an ice_progress event for state, which the checks only
+// leave for a selected pair. Candidates gathered once the checks started
+// change nothing.
+func (t *Transport) reportICE(state, pair string) {
+	t.ice.mu.Lock()
+	switch {
+	case t.ice.state == util.ICEConnected && state != util.ICEConnected,
+		t.ice.state == util.ICEChecking && state == util.ICEGathering:
+		t.ice.mu.Unlock()
+		return
+	}
+	t.ice.state = state
+	ev := util.Event{Event: util.EventICEProgress, State: state, Local: t.ice.local, Srflx: t.ice.srflx, Remote: t.ice.remote, Pair: pair}
+	t.ice.mu.Unlock()
+
+	util.EmitEvent(ev)
+}
+
+// describePair describes a candidate pair as e.g.
+// "host 192.168.1.5:50000 ↔ srflx 203.0.113.7:41000 (udp)".
+func describePair(pair *webrtc.ICECandidatePair) string {
+	if pair == nil || pair.Local == nil || pair.Remote == nil {
+		return ""
+	}
+	end := func(c *webrtc.ICECandidate) string {
+		return c.Typ.String() + " " + net.JoinHostPort(c.Address, strconv.Itoa(int(c.Port)))
+	}
+	return fmt.Sprintf("%s ↔ %s (%s)", end(pair.Local), end(pair.Remote), pair.Local.Protocol)
+}
+
+// sdpCandidates counts the candidates in a session description.
+func sdpCandidates(sdp string) int {
+	return strings.Count(sdp, "a=candidate:")
+}
@@ -0,0 +1,140 @@
+package transport
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// Pacing: the water marks only bound how much a sender may queue in the
+// DataChannel buffer, so during a bulk transfer that buffer sits near the
+// high mark and every packet of an interactive socket waits behind it. With
+// pacing, the SCTP association's congestion window and smoothed RTT are
+// sampled every paceInterval and all senders of the Transport share a token
+// bucket refilled at paceGain × cwnd/SRTT, the rate SCTP can actually send
+// at. Each sender also pauses once its buffer exceeds twice the congestion
+// window (but never below the high mark's floor of twice the low mark), so
+// the queue in front of SCTP stays about one window deep. Until the first
+// usable sample, or when the stats are not exposed, the water marks alone
+// apply.
+
+const (
+	paceInterval = 200 * time.Millisecond
+	paceGain     = 1.25                  // headroom so the pacer does not become the bottleneck
+	paceBurst    = 10 * time.Millisecond // bucket depth, in time at the current rate
+	minPaceBurst = 64 * 1024             // bucket depth floor: one full-size packet
+)
+
+// pacer is a token bucket shared by the senders of one Transport. The zero
+// rate means unpaced.
+type pacer struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second; 0 until the first sample
+	cwnd   uint64  // congestion window in bytes; 0 until the first sample
+	tokens float64
+	last   time.Time
+}
+
+// set updates the rate and window from a stats sample.
+func (p *pacer) set(rate float64, cwnd uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.refill(time.Now())
+	p.rate, p.cwnd = rate, cwnd
+}
+
+// window returns the sampled congestion window, or 0 if there is none.
+func (p *pacer) window() uint64 {
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.cwnd
+}
+
+// refill adds the tokens earned since the last call, up to the bucket depth.
+func (p *pacer) refill(now time.Time) {
+	if !p.last.IsZero() && p.rate > 0 {
+		depth := max(p.rate*paceBurst.Seconds(), minPaceBurst)
+		p.tokens = min(p.tokens+p.rate*now.Sub(p.last).Seconds(), depth)
+	}
+	p.last = now
+}
+
+// take spends n bytes of tokens and returns how long the caller must wait
+// before sending them; the bucket may go into debt by one packet.
+func (p *pacer) take(n int) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.rate <= 0 {
+		return 0
+	}
+	p.refill(time.Now())
+	p.tokens -= float64(n)
+	if p.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-p.tokens / p.rate * float64(time.Second))
+}
+
+// wait blocks until n bytes may be sent, or ctx is done. It returns false
+// if ctx is done. A nil pacer never blocks.
+func (p *pacer) wait(ctx context.Context, n int) bool {
+	if p == nil {
+		return true
+	}
+	d := p.take(n)
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// pace samples the SCTP stats into t.pacer until the Transport is done.
+func (t *Transport) pace() {
+	ticker := time.NewTicker(paceInterval)
+	defer ticker.Stop()
+
+	var logged float64
+	for {
+		select {
+		case <-ticker.C:
+			cwnd, srtt := t.sctpWindow()
+			if cwnd == 0 || srtt <= 0 {
+				continue
+			}
+			rate := paceGain * float64(cwnd) / srtt.Seconds()
+			t.pacer.set(rate, cwnd)
+			// Log only changes of a quarter or more, not every sample.
+			if rate > logged*1.25 || rate < logged*0.75 {
+				logged = rate
+				util.LogDebug("pacing at %.0f KiB/s (cwnd %d KiB, srtt %v)", rate/1024, cwnd/1024, srtt)
+			}
+		case <-t.ctx.Done():
+			return
+		}
+	}
+}
+
+// sctpWindow returns the SCTP association's congestion window and smoothed
+// RTT, or zeros if they are not known yet.
+func (t *Transport) sctpWindow() (uint64, time.Duration) {
+	for _, s := range t.pc.GetStats() {
+		if st, ok := s.(webrtc.SCTPTransportStats); ok {
+			return uint64(st.CongestionWindow), time.Duration(st.SmoothedRoundTripTime * float64(time.Second))
+		}
+	}
+	return 0, 0
+}
@@ -1,7 +1,11 @@
 package transport
 
 import (
+	"fmt"
+
 	"github.com/pion/webrtc/v4"
+
+	"github.com/1ureka/roj1/internal/util"
 )
 
 // STUN servers for ICE candidate gathering. No TURN — the tool is designed
@@ -11,20 +15,90 @@ var stunServers = []string{
 	"stun:stun1.l.google.com:19302",
 }
 
+// ICENetwork selects the IP families ICE gathers candidates on.
+type ICENetwork int
+
+const (
+	// ICEAny gathers IPv4 and IPv6 candidates (dual-stack).
+	ICEAny ICENetwork = iota
+	// ICEIPv4 gathers IPv4 candidates only.
+	ICEIPv4
+	// ICEIPv6 gathers IPv6 candidates only.
+	ICEIPv6
+)
+
+// String returns the network name as used on the command line.
+func (n ICENetwork) String() string {
+	switch n {
+	case ICEIPv4:
+		return "ipv4"
+	case ICEIPv6:
+		return "ipv6"
+	default:
+		return "any"
+	}
+}
+
+// ParseICENetwork parses a network name ("any", "ipv4" or "ipv6").
+func ParseICENetwork(s string) (ICENetwork, error) {
+	switch s {
+	case "any":
+		return ICEAny, nil
+	case "ipv4":
+		return ICEIPv4, nil
+	case "ipv6":
+		return ICEIPv6, nil
+	default:
+		return 0, fmt.Errorf("unknown ICE network %q (want any, ipv4 or ipv6)", s)
+	}
+}
+
+// networkTypes returns the ICE network types for n, or nil for pion's default.
+func (n ICENetwork) networkTypes() []webrtc.NetworkType {
+	switch n {
+	case ICEIPv4:
+		return []webrtc.NetworkType{webrtc.NetworkTypeUDP4}
+	case ICEIPv6:
+		return []webrtc.NetworkType{webrtc.NetworkTypeUDP6}
+	default:
+		return nil
+	}
+}
+
 // newPeerConnection creates a PeerConnection configured with Google STUN servers.
-func newPeerConnection() (*webrtc.PeerConnection, error) {
+// If cfg.Interface is non-empty, ICE only gathers candidates on that network
+// interface; cfg.Network restricts the IP families gathered. pion logs to
+// the debug log (see util.PionLoggerFactory). DataChannels are detached (see
+// detach.go).
+func newPeerConnection(cfg Config) (*webrtc.PeerConnection, error) {
 	config := webrtc.Configuration{
 		ICEServers: []webrtc.ICEServer{
 			{URLs: stunServers},
 		},
 	}
-	return webrtc.NewPeerConnection(config)
+
+	var se webrtc.SettingEngine
+	se.LoggerFactory = util.PionLoggerFactory{}
+	se.DetachDataChannels()
+	if cfg.Interface != "" {
+		se.SetInterfaceFilter(func(name string) bool { return name == cfg.Interface })
+	}
+	if types := cfg.Network.networkTypes(); types != nil {
+		se.SetNetworkTypes(types)
+	}
+	return webrtc.NewAPI(webrtc.WithSettingEngine(se)).NewPeerConnection(config)
 }
 
 // newDataChannel creates a pre-negotiated, unordered DataChannel on the given
 // PeerConnection. Using negotiated mode (ID 0) allows both sides to create
 // the channel independently without relying on OnDataChannel. Unordered mode
 // eliminates head-of-line blocking between different socketIDs.
+//
+// The channel is fully reliable on purpose (no MaxRetransmits or
+// MaxPacketLifeTime): the tunnel's own retransmission (adapter.HostConfig.Nack)
+// is optional and only asks for a gap once it has persisted, so it recovers
+// the odd packet lost with a failed path, not a lossy channel. Without it, a
+// dropped DATA packet would stall or corrupt the TCP stream.
 func newDataChannel(pc *webrtc.PeerConnection) (*webrtc.DataChannel, error) {
 	ordered := false
 	negotiated := true
@@ -0,0 +1,55 @@
+package transport
+
+import (
+	"sync"
+	"time"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// phases records when the establishment phases of a Transport started, to
+// report each as a phase event (see util.EventPhase) once it ends:
+//
+//	gathering      ICE gathering, from its start to the last local candidate
+//	ice            ICE connectivity checks, up to the first working pair
+//	dtls           from ICE connected to the PeerConnection connected
+//	datachannel    from there to the DataChannel open
+//	first_message  from there to the first message from the peer
+type phases struct {
+	mu     sync.Mutex
+	starts map[string]time.Time
+	ended  map[string]bool
+}
+
+func newPhases() *phases {
+	return &phases{starts: make(map[string]time.Time), ended: make(map[string]bool)}
+}
+
+// start marks the start of phase, unless it already started.
+func (p *phases) start(phase string) {
+	p.mu.Lock()
+	if _, ok := p.starts[phase]; !ok {
+		p.starts[phase] = time.Now()
+	}
+	p.mu.Unlock()
+}
+
+// end reports phase, if it started and was not reported yet.
+func (p *phases) end(phase string) {
+	p.mu.Lock()
+	start, ok := p.starts[phase]
+	if !ok || p.ended[phase] {
+		p.mu.Unlock()
+		return
+	}
+	p.ended[phase] = true
+	p.mu.Unlock()
+
+	util.EmitPhase(phase, start)
+}
+
+// next ends phase and starts the one that follows it.
+func (p *phases) next(phase, following string) {
+	p.end(phase)
+	p.start(following)
+}
@@ -0,0 +1,129 @@
+package transport
+
+import (
+	"context"
+	"sync"
+
+	"github.com/1ureka/roj1/internal/protocol"
+)
+
+// pipeQueueSize is the number of encoded packets a Pipe buffers per direction
+// before Send* blocks.
+const pipeQueueSize = 256
+
+// Pipe is an in-memory Carrier, for benchmarks and local testing (see
+// NewPipe). Packets are encoded with the wire protocol and delivered to the
+// peer Pipe in order, with backpressure once its queue is full, so the
+// adapter and protocol layers are exercised without any network.
+type Pipe struct {
+	peer  *Pipe
+	queue chan []byte
+
+	mu      sync.Mutex
+	handler func(*protocol.Packet)
+	ready   chan struct{} // closed once handler is set
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewPipe returns a linked pair of Pipes. Closing either one closes both,
+// like a network link going down.
+func NewPipe() (a, b *Pipe) {
+	ctx, cancel := context.WithCancel(context.Background())
+	a = &Pipe{queue: make(chan []byte, pipeQueueSize), ready: make(chan struct{}), ctx: ctx, cancel: cancel}
+	b = &Pipe{queue: make(chan []byte, pipeQueueSize), ready: make(chan struct{}), ctx: ctx, cancel: cancel}
+	a.peer, b.peer = b, a
+
+	go a.receiveLoop()
+	go b.receiveLoop()
+	return a, b
+}
+
+// send encodes pkt and queues it for the peer.
+func (p *Pipe) send(pkt *protocol.Packet) {
+	select {
+	case p.peer.queue <- protocol.Encode(pkt):
+	case <-p.ctx.Done():
+	}
+}
+
+// SendConnect sends a CONNECT packet to the peer.
+func (p *Pipe) SendConnect(socketID, seqNum uint32) {
+	p.send(&protocol.Packet{Type: protocol.TypeConnect, SocketID: socketID, SeqNum: seqNum})
+}
+
+// SendData sends a DATA packet to the peer.
+func (p *Pipe) SendData(socketID, seqNum uint32, payload []byte) {
+	p.send(&protocol.Packet{Type: protocol.TypeData, SocketID: socketID, SeqNum: seqNum, Payload: payload})
+}
+
+// SendClose sends a CLOSE packet to the peer.
+func (p *Pipe) SendClose(socketID, seqNum uint32) {
+	p.send(&protocol.Packet{Type: protocol.TypeClose, SocketID: socketID, SeqNum: seqNum})
+}
+
+// SendNack sends a NACK packet to the peer.
+func (p *Pipe) SendNack(socketID, first, last uint32) {
+	p.send(&protocol.Packet{Type: protocol.TypeNack, SocketID: socketID, Payload: protocol.NackPayload(first, last)})
+}
+
+// SendControl sends a CONTROL packet to the peer.
+func (p *Pipe) SendControl(payload []byte) {
+	p.send(&protocol.Packet{Type: protocol.TypeControl, Payload: payload})
+}
+
+// OnPacket registers the callback for inbound packets. Packets sent before it
+// is registered are held until then.
+func (p *Pipe) OnPacket(fn func(*protocol.Packet)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	first := p.handler == nil
+	p.handler = fn
+	if first {
+		close(p.ready)
+	}
+}
+
+// receiveLoop decodes queued packets and hands them to the callback.
+func (p *Pipe) receiveLoop() {
+	select {
+	case <-p.ready:
+	case <-p.ctx.Done():
+		return
+	}
+
+	for {
+		select {
+		case data := <-p.queue:
+			pkt, err := protocol.Decode(data)
+			if err != nil {
+				continue
+			}
+			p.mu.Lock()
+			fn := p.handler
+			p.mu.Unlock()
+			fn(pkt)
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+// Done returns a channel that is closed once either side of the pipe is
+// closed.
+func (p *Pipe) Done() <-chan struct{} {
+	return p.ctx.Done()
+}
+
+// Err returns nil while the pipe is open, and context.Canceled afterwards.
+func (p *Pipe) Err() error {
+	return p.ctx.Err()
+}
+
+// Close closes both sides of the pipe.
+func (p *Pipe) Close() error {
+	p.cancel()
+	return nil
+}
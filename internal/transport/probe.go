@@ -0,0 +1,277 @@
+package transport
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// NATType classifies the local NAT mapping behaviour as observed via STUN.
+type NATType string
+
+const (
+	NATBlocked   NATType = "blocked"   // no STUN server answered — UDP egress is likely filtered
+	NATNone      NATType = "none"      // the mapped address is a local address (public IP)
+	NATCone      NATType = "cone"      // same mapping for every destination (endpoint-independent)
+	NATSymmetric NATType = "symmetric" // mapping differs per destination — direct P2P unlikely
+	NATUnknown   NATType = "unknown"   // only one server answered; mapping behaviour unknown
+)
+
+// STUNResult is the outcome of a single STUN binding request.
+type STUNResult struct {
+	Server string        // STUN server address (host:port)
+	Mapped string        // public address observed by the server (ip:port)
+	RTT    time.Duration // round-trip time of the successful request
+	Err    error         // non-nil if the server did not answer
+}
+
+// NATReport summarises a STUN probe.
+type NATReport struct {
+	Results []STUNResult
+	Type    NATType
+}
+
+// UDPEgress reports whether at least one STUN server answered.
+func (r *NATReport) UDPEgress() bool {
+	return r.Type != NATBlocked
+}
+
+// P2PLikely estimates whether a direct (TURN-less) connection is likely to
+// succeed from this side. Symmetric NATs only work against open/full-cone
+// peers, and a blocked network never works.
+func (r *NATReport) P2PLikely() bool {
+	return r.Type == NATNone || r.Type == NATCone || r.Type == NATUnknown
+}
+
+// stunProbeTimeout bounds each binding request attempt.
+const stunProbeTimeout = 2 * time.Second
+
+// ProbeNAT sends STUN binding requests from a single local UDP socket to each
+// server (host:port, optionally prefixed with "stun:") and classifies the NAT
+// by comparing the mapped addresses. With no servers, the STUN servers used
+// for ICE are probed.
+func ProbeNAT(ctx context.Context, servers ...string) (*NATReport, error) {
+	if len(servers) == 0 {
+		servers = stunServers
+	}
+
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open UDP socket: %w", err)
+	}
+	defer conn.Close()
+
+	go func() {
+		<-ctx.Done()
+		conn.SetDeadline(time.Now()) // unblock pending reads
+	}()
+
+	report := &NATReport{}
+	mapped := make(map[string]bool)
+
+	for _, server := range servers {
+		server = strings.TrimPrefix(server, "stun:")
+		res := STUNResult{Server: server}
+
+		start := time.Now()
+		res.Mapped, res.Err = stunBinding(conn, server)
+		if res.Err == nil {
+			res.RTT = time.Since(start)
+			mapped[res.Mapped] = true
+		}
+
+		report.Results = append(report.Results, res)
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	report.Type = classifyNAT(report.Results, mapped)
+	return report, nil
+}
+
+// classifyNAT derives the NAT type from the successful mappings.
+func classifyNAT(results []STUNResult, mapped map[string]bool) NATType {
+	var first string
+	answered := 0
+	for _, res := range results {
+		if res.Err == nil {
+			if answered == 0 {
+				first = res.Mapped
+			}
+			answered++
+		}
+	}
+
+	switch {
+	case answered == 0:
+		return NATBlocked
+	case isLocalAddr(first):
+		return NATNone
+	case len(mapped) > 1:
+		return NATSymmetric
+	case answered == 1:
+		return NATUnknown
+	default:
+		return NATCone
+	}
+}
+
+// isLocalAddr reports whether the IP of hostport belongs to a local interface.
+func isLocalAddr(hostport string) bool {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return false
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.String() == host && !ipnet.IP.IsLoopback() {
+			return true
+		}
+	}
+	return false
+}
+
+// ---------------------------------------------------------------------------
+// Minimal STUN (RFC 5389) binding request
+// ---------------------------------------------------------------------------
+
+const (
+	stunBindingRequest  = 0x0001
+	stunBindingSuccess  = 0x0101
+	stunMagicCookie     = 0x2112A442
+	stunHeaderSize      = 20
+	stunAttrMapped      = 0x0001
+	stunAttrXORMapped   = 0x0020
+	stunProbeMaxRetries = 2
+)
+
+// stunBinding performs a binding request against server and returns the
+// mapped address reported in the response.
+func stunBinding(conn *net.UDPConn, server string) (string, error) {
+	raddr, err := net.ResolveUDPAddr("udp4", server)
+	if err != nil {
+		return "", err
+	}
+
+	req := make([]byte, stunHeaderSize)
+	binary.BigEndian.PutUint16(req[0:2], stunBindingRequest)
+	binary.BigEndian.PutUint32(req[4:8], stunMagicCookie)
+	if _, err := rand.Read(req[8:20]); err != nil {
+		return "", err
+	}
+	txID := req[8:20]
+
+	buf := make([]byte, 1500)
+	for attempt := 0; attempt < stunProbeMaxRetries; attempt++ {
+		if _, err := conn.WriteToUDP(req, raddr); err != nil {
+			return "", err
+		}
+
+		conn.SetReadDeadline(time.Now().Add(stunProbeTimeout))
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break // retransmit
+				}
+				return "", err
+			}
+			if !from.IP.Equal(raddr.IP) || from.Port != raddr.Port {
+				continue // stale answer from an earlier server
+			}
+			if addr, ok := parseBindingResponse(buf[:n], txID); ok {
+				return addr, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("no response from %s", server)
+}
+
+// parseBindingResponse extracts the (XOR-)MAPPED-ADDRESS from a binding
+// success response matching txID.
+func parseBindingResponse(msg, txID []byte) (string, bool) {
+	if len(msg) < stunHeaderSize ||
+		binary.BigEndian.Uint16(msg[0:2]) != stunBindingSuccess ||
+		binary.BigEndian.Uint32(msg[4:8]) != stunMagicCookie ||
+		string(msg[8:20]) != string(txID) {
+		return "", false
+	}
+
+	var fallback string
+	attrs := msg[stunHeaderSize:]
+	for len(attrs) >= 4 {
+		typ := binary.BigEndian.Uint16(attrs[0:2])
+		length := int(binary.BigEndian.Uint16(attrs[2:4]))
+		if len(attrs) < 4+length {
+			break
+		}
+		value := attrs[4 : 4+length]
+
+		switch typ {
+		case stunAttrXORMapped:
+			if addr, ok := decodeSTUNAddr(value, msg[4:20]); ok {
+				return addr, true
+			}
+		case stunAttrMapped:
+			if addr, ok := decodeSTUNAddr(value, nil); ok {
+				fallback = addr
+			}
+		}
+
+		padded := (length + 3) &^ 3
+		if len(attrs) < 4+padded {
+			break
+		}
+		attrs = attrs[4+padded:]
+	}
+
+	return fallback, fallback != ""
+}
+
+// decodeSTUNAddr decodes a (XOR-)MAPPED-ADDRESS value. xorKey is the magic
+// cookie followed by the transaction ID for XOR-MAPPED-ADDRESS, nil otherwise.
+func decodeSTUNAddr(value, xorKey []byte) (string, bool) {
+	if len(value) < 4 {
+		return "", false
+	}
+
+	var ipLen int
+	switch value[1] {
+	case 0x01:
+		ipLen = net.IPv4len
+	case 0x02:
+		ipLen = net.IPv6len
+	default:
+		return "", false
+	}
+	if len(value) < 4+ipLen {
+		return "", false
+	}
+
+	port := binary.BigEndian.Uint16(value[2:4])
+	ip := make(net.IP, ipLen)
+	copy(ip, value[4:4+ipLen])
+
+	if xorKey != nil {
+		port ^= uint16(stunMagicCookie >> 16)
+		for i := range ip {
+			ip[i] ^= xorKey[i]
+		}
+	}
+
+	return net.JoinHostPort(ip.String(), fmt.Sprint(port)), true
+}
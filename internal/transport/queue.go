@@ -0,0 +1,169 @@
+package transport
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/1ureka/roj1/internal/protocol"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// sendQueue holds a sender's outgoing packets in one bounded FIFO per socket
+// and hands them out round-robin, so a socket that writes faster than the
+// DataChannel drains fills only its own queue: other sockets keep their turn
+// instead of waiting behind it.
+//
+// A socket whose queue is full parks its caller until the sender takes one of
+// its packets, or, with Config.QueueDrop, loses the DATA packet instead.
+type sendQueue struct {
+	limit int  // packets per socket
+	drop  bool // drop DATA at the limit instead of parking
+
+	mu      sync.Mutex
+	sockets map[uint32]*socketQueue
+	order   []uint32 // sockets with queued packets, in round-robin order
+	queued  int      // packets across sockets
+	finish  bool     // a finish was requested (see sender.finish)
+	ready   chan struct{}
+}
+
+// queueConfig holds Config.SocketQueue and Config.QueueDrop.
+type queueConfig struct {
+	limit int // 0 = default
+	drop  bool
+}
+
+// socketQueue is one socket's FIFO.
+type socketQueue struct {
+	packets []*protocol.Packet
+	space   chan struct{} // non-nil while callers are parked; closed when a packet is taken
+}
+
+// newSendQueue returns an empty queue holding up to limit packets per socket.
+func newSendQueue(limit int, drop bool) *sendQueue {
+	return &sendQueue{
+		limit:   limit,
+		drop:    drop,
+		sockets: make(map[uint32]*socketQueue),
+		ready:   make(chan struct{}, 1),
+	}
+}
+
+// push queues pkt behind the earlier packets of its socket. At the socket's
+// limit it parks until there is room, or drops a DATA packet with QueueDrop;
+// it returns false if pkt was not queued (dropped, or ctx done meanwhile).
+func (q *sendQueue) push(ctx context.Context, pkt *protocol.Packet) bool {
+	var parked time.Time
+
+	q.mu.Lock()
+	for {
+		sq := q.sockets[pkt.SocketID]
+		if sq == nil {
+			sq = &socketQueue{}
+			q.sockets[pkt.SocketID] = sq
+		}
+		if len(sq.packets) < q.limit {
+			if len(sq.packets) == 0 {
+				q.order = append(q.order, pkt.SocketID)
+			}
+			sq.packets = append(sq.packets, pkt)
+			q.queued++
+			q.mu.Unlock()
+
+			if !parked.IsZero() {
+				util.Stats.AddParked(time.Since(parked))
+			}
+			q.signal()
+			return true
+		}
+
+		// Only DATA can be recovered by a NACK; CONNECT, CLOSE and NACK
+		// packets always wait for room.
+		if q.drop && pkt.Type == protocol.TypeData {
+			q.mu.Unlock()
+			util.Stats.AddQueueDropped()
+			util.LogDebug("[%08x] send queue full, dropping DATA seq=%d", pkt.SocketID, pkt.SeqNum)
+			return false
+		}
+
+		if sq.space == nil {
+			sq.space = make(chan struct{})
+		}
+		space := sq.space
+		q.mu.Unlock()
+
+		if parked.IsZero() {
+			parked = time.Now()
+		}
+		select {
+		case <-space:
+		case <-ctx.Done():
+			util.Stats.AddParked(time.Since(parked))
+			return false
+		}
+		q.mu.Lock()
+	}
+}
+
+// pop takes the next packet round-robin: the oldest one of the socket whose
+// turn it is, which then moves to the back of the order. It returns nil if
+// nothing is queued.
+func (q *sendQueue) pop() *protocol.Packet {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.order) == 0 {
+		return nil
+	}
+	id := q.order[0]
+	q.order = q.order[1:]
+
+	sq := q.sockets[id]
+	pkt := sq.packets[0]
+	sq.packets[0] = nil
+	sq.packets = sq.packets[1:]
+	q.queued--
+
+	if sq.space != nil {
+		close(sq.space)
+		sq.space = nil
+	}
+	if len(sq.packets) > 0 {
+		q.order = append(q.order, id)
+	} else {
+		delete(q.sockets, id)
+	}
+	return pkt
+}
+
+// len returns the number of queued packets across sockets.
+func (q *sendQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.queued
+}
+
+// requestFinish marks the queue as finishing: the sender stops once it has
+// sent everything queued so far.
+func (q *sendQueue) requestFinish() {
+	q.mu.Lock()
+	q.finish = true
+	q.mu.Unlock()
+	q.signal()
+}
+
+// finished reports whether a finish was requested and the queue is empty.
+func (q *sendQueue) finished() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.finish && q.queued == 0
+}
+
+// signal wakes the sender loop.
+func (q *sendQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
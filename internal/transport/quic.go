@@ -0,0 +1,56 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/quic-go/quic-go"
+)
+
+// NewQUICTransport carries tunnel packets over a QUIC stream, framed as on a
+// StreamTransport, for peers that can reach each other directly over UDP.
+// The Transport owns conn: closing it closes the QUIC connection, which the
+// peer reads as the end of the stream.
+func NewQUICTransport(ctx context.Context, conn *quic.Conn, stream *quic.Stream) *StreamTransport {
+	return NewStreamTransport(ctx, &quicStream{Stream: stream, conn: conn})
+}
+
+// quicStream is a QUIC stream as a net.Conn (private).
+type quicStream struct {
+	*quic.Stream
+	conn *quic.Conn
+}
+
+func (s *quicStream) Read(p []byte) (int, error) {
+	n, err := s.Stream.Read(p)
+	return n, quicClosed(err)
+}
+
+func (s *quicStream) Write(p []byte) (int, error) {
+	n, err := s.Stream.Write(p)
+	return n, quicClosed(err)
+}
+
+// Close closes the whole connection, not just the stream.
+func (s *quicStream) Close() error {
+	return s.conn.CloseWithError(0, "")
+}
+
+func (s *quicStream) LocalAddr() net.Addr  { return s.conn.LocalAddr() }
+func (s *quicStream) RemoteAddr() net.Addr { return s.conn.RemoteAddr() }
+
+// quicClosed maps the error of a connection closed with Close to what a TCP
+// connection would return: io.EOF if the peer closed it, net.ErrClosed if it
+// was closed here. Other errors are returned unchanged.
+func quicClosed(err error) error {
+	var appErr *quic.ApplicationError
+	if !errors.As(err, &appErr) || appErr.ErrorCode != 0 {
+		return err
+	}
+	if appErr.Remote {
+		return io.EOF
+	}
+	return net.ErrClosed
+}
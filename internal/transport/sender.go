@@ -2,6 +2,10 @@ package transport
 
 import (
 	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/1ureka/roj1/internal/protocol"
 	"github.com/1ureka/roj1/internal/util"
@@ -9,27 +13,66 @@ import (
 )
 
 const (
-	highWaterMark  = 256 * 1024 // pause sending when bufferedAmount exceeds this
-	lowWaterMark   = 64 * 1024  // resume sending when bufferedAmount drops below this
-	sendBufferSize = 64         // outgoing packet channel capacity
+	highWaterMark  = 256 * 1024 // default: pause sending when bufferedAmount exceeds this
+	lowWaterMark   = 64 * 1024  // default: resume sending when bufferedAmount drops below this
+	sendBufferSize = 64         // default: outgoing packets queued per socket (see sendQueue)
+
+	bufferSampleInterval = 100 * time.Millisecond // how often bufferedAmount is sampled for stats
+
+	// With Config.LowPower.
+	lowPowerHighWaterMark  = 64 * 1024
+	lowPowerLowWaterMark   = 16 * 1024
+	lowPowerSendBufferSize = 16
+	lowPowerSampleInterval = time.Second
 )
 
 // sender is a goroutine-based packet writer that serializes all writes to a
 // single DataChannel, adding open-gate and backpressure control.
 type sender struct {
-	inbox       chan *protocol.Packet
+	dc          *webrtc.DataChannel // for its buffered amount
+	w           io.Writer           // dc's detached stream, set before the open gate opens
+	queue       *sendQueue
 	drainSignal chan struct{}
+	onFinish    func() // set by finish before it marks the queue as finishing
+	pacer       *pacer // shared by the Transport's senders; nil = unpaced (see Config.Pace)
+	sampleEvery time.Duration
+
+	// Backpressure thresholds; raised at runtime by tune (see Config.AutoTune).
+	high atomic.Uint64
+	low  atomic.Uint64
+
+	// Auto-tuning measurements (see tune).
+	sent         atomic.Uint64 // bytes handed to the DataChannel
+	prevSent     uint64        // tune goroutine only
+	prevBuffered uint64        // tune goroutine only
+
+	mu      sync.Mutex
+	resumed chan struct{} // non-nil while paused for backpressure; closed on resume
 }
 
-// newSender creates a sender, wires the backpressure callbacks on dc, and
-// starts the background loop. The loop exits when ctx is cancelled.
-func newSender(ctx context.Context, dc *webrtc.DataChannel, openSignal <-chan struct{}) *sender {
+// newSender creates a sender with the given thresholds, queue settings and
+// pacer, wires the backpressure callbacks on dc, and starts the background
+// loop. The loop exits when ctx is cancelled. lowPower shrinks the default
+// queue and samples the buffer less often (see Config.LowPower).
+func newSender(ctx context.Context, dc *webrtc.DataChannel, openSignal <-chan struct{}, marks waterMarks, qc queueConfig, p *pacer, lowPower bool) *sender {
+	limit, sampleEvery := sendBufferSize, bufferSampleInterval
+	if lowPower {
+		limit, sampleEvery = lowPowerSendBufferSize, lowPowerSampleInterval
+	}
+	if qc.limit > 0 {
+		limit = qc.limit
+	}
 	s := &sender{
-		inbox:       make(chan *protocol.Packet, sendBufferSize),
+		dc:          dc,
+		queue:       newSendQueue(limit, qc.drop),
 		drainSignal: make(chan struct{}, 1),
+		pacer:       p,
+		sampleEvery: sampleEvery,
 	}
+	s.high.Store(marks.high)
+	s.low.Store(marks.low)
 
-	dc.SetBufferedAmountLowThreshold(uint64(lowWaterMark))
+	dc.SetBufferedAmountLowThreshold(marks.low)
 	dc.OnBufferedAmountLow(func() {
 		select {
 		case s.drainSignal <- struct{}{}:
@@ -43,7 +86,7 @@ func newSender(ctx context.Context, dc *webrtc.DataChannel, openSignal <-chan st
 }
 
 // loop is the single-writer goroutine. It waits for the DataChannel to open,
-// then drains the inbox with backpressure awareness.
+// then drains the queue with backpressure awareness.
 func (s *sender) loop(ctx context.Context, dc *webrtc.DataChannel, openSignal <-chan struct{}) {
 	// Phase 1: wait for DC to be open.
 	select {
@@ -52,36 +95,146 @@ func (s *sender) loop(ctx context.Context, dc *webrtc.DataChannel, openSignal <-
 		return
 	}
 
-	// Phase 2: send packets with backpressure.
+	// Phase 2: send packets with backpressure, sampling the buffer and queue
+	// occupancy for the stats reporter. Packets are encoded into one reused
+	// buffer (the SCTP stack copies it into chunks).
+	sample := time.NewTicker(s.sampleEvery)
+	defer sample.Stop()
+
+	var buf []byte
+
 	for {
 		select {
-		case pkt := <-s.inbox:
-			if dc.BufferedAmount() > uint64(highWaterMark) {
-				select {
-				case <-s.drainSignal:
-				case <-ctx.Done():
+		case <-sample.C:
+			util.Stats.SampleBuffered(dc.BufferedAmount())
+			util.Stats.SampleQueued(s.queue.len())
+
+		case <-s.queue.ready:
+			for pkt := s.queue.pop(); pkt != nil; pkt = s.queue.pop() {
+				if !s.write(ctx, dc, pkt, sample.C, &buf) {
 					return
 				}
 			}
-
-			data := protocol.Encode(pkt)
-			if err := dc.Send(data); err != nil {
-				util.LogError("failed to send packet (socketID=%08x, type=%d): %v", pkt.SocketID, pkt.Type, err)
+			if s.queue.finished() {
+				s.drain(ctx, dc)
+				s.onFinish()
 				return
 			}
 
-			util.Stats.AddSent(len(data))
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-// send enqueues a packet for transmission. It blocks if the internal buffer
-// is full and returns silently when ctx is already cancelled.
+// write sends one packet, first waiting while the DataChannel is above the
+// send limit. It returns false once the sender must stop.
+func (s *sender) write(ctx context.Context, dc *webrtc.DataChannel, pkt *protocol.Packet, sample <-chan time.Time, buf *[]byte) bool {
+	if dc.BufferedAmount() > s.limit() {
+		s.pause()
+		since := time.Now()
+	wait:
+		for {
+			select {
+			case <-sample:
+				util.Stats.SampleBuffered(dc.BufferedAmount())
+			case <-s.drainSignal:
+				break wait
+			case <-ctx.Done():
+				return false
+			}
+		}
+		util.Stats.AddCongested(time.Since(since))
+		s.resume()
+	}
+
+	*buf = protocol.AppendEncode((*buf)[:0], pkt)
+	if !s.pacer.wait(ctx, len(*buf)) {
+		return false
+	}
+	if _, err := s.w.Write(*buf); err != nil {
+		util.LogError("failed to send packet (socketID=%08x, type=%d): %v", pkt.SocketID, pkt.Type, err)
+		return false
+	}
+
+	s.sent.Add(uint64(len(*buf)))
+	util.Stats.AddSent(len(*buf))
+	return true
+}
+
+// limit returns the buffered amount above which sending pauses: the high
+// mark, lowered to twice the congestion window while paced (see pace.go).
+func (s *sender) limit() uint64 {
+	high := s.high.Load()
+	if cwnd := s.pacer.window(); cwnd > 0 {
+		high = min(high, max(2*cwnd, 2*s.low.Load()))
+	}
+	return high
+}
+
+// pause marks the sender as congested (see paused).
+func (s *sender) pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.resumed == nil {
+		s.resumed = make(chan struct{})
+	}
+}
+
+// resume clears the congested mark, waking everyone waiting in paused.
+func (s *sender) resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.resumed != nil {
+		close(s.resumed)
+		s.resumed = nil
+	}
+}
+
+// paused returns a channel that is closed once sending resumes, or nil if the
+// sender is not congested.
+func (s *sender) paused() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.resumed
+}
+
+// send enqueues a packet for transmission (see sendQueue.push). It blocks
+// while the packet's socket has a full queue and returns silently when ctx is
+// already cancelled.
 func (s *sender) send(ctx context.Context, pkt *protocol.Packet) {
-	select {
-	case s.inbox <- pkt:
-	case <-ctx.Done():
+	if ctx.Err() != nil {
+		return
+	}
+	s.queue.push(ctx, pkt)
+}
+
+// finish stops the sender once every packet queued so far has been sent and
+// the DataChannel's buffer has drained, then calls fn. If ctx is done first,
+// fn is called right away.
+func (s *sender) finish(ctx context.Context, fn func()) {
+	if ctx.Err() != nil {
+		fn()
+		return
+	}
+	s.onFinish = fn
+	s.queue.requestFinish()
+}
+
+// drain waits until the DataChannel has no buffered data left, ctx is done, or
+// channelDrainTimeout has elapsed.
+func (s *sender) drain(ctx context.Context, dc *webrtc.DataChannel) {
+	deadline := time.After(channelDrainTimeout)
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for dc.BufferedAmount() > 0 {
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			return
+		case <-ctx.Done():
+			return
+		}
 	}
 }
@@ -0,0 +1,227 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1ureka/roj1/internal/protocol"
+)
+
+// shapeQueue bounds the packets held back by a Shaper in each direction;
+// beyond it, sending blocks like on a congested link.
+const shapeQueue = 256
+
+// Shaping describes an emulated network path (see Shape). The zero value
+// adds nothing.
+type Shaping struct {
+	RTT       time.Duration // added round-trip time, half of it per direction
+	Bandwidth int64         // bytes per second in each direction (0 = unlimited)
+}
+
+// String formats the shaping like ParseShaping's input, e.g.
+// "rtt=100ms,bw=5000kbit".
+func (sh Shaping) String() string {
+	s := fmt.Sprintf("rtt=%v", sh.RTT)
+	if sh.Bandwidth > 0 {
+		s += fmt.Sprintf(",bw=%dkbit", sh.Bandwidth*8/1000)
+	}
+	return s
+}
+
+// ParseShaping parses a comma-separated list such as "rtt=100ms,bw=5mbit".
+// Bandwidths are in bit, kbit, mbit or gbit per second (decimal units).
+func ParseShaping(s string) (Shaping, error) {
+	var sh Shaping
+	for part := range strings.SplitSeq(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return Shaping{}, fmt.Errorf("%q: want key=value", part)
+		}
+
+		switch key {
+		case "rtt":
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				return Shaping{}, fmt.Errorf("invalid rtt %q", value)
+			}
+			sh.RTT = d
+		case "bw":
+			bps, err := parseBitRate(value)
+			if err != nil {
+				return Shaping{}, err
+			}
+			sh.Bandwidth = bps / 8
+		default:
+			return Shaping{}, fmt.Errorf("unknown setting %q (want rtt or bw)", key)
+		}
+	}
+	return sh, nil
+}
+
+// parseBitRate parses a rate such as "5mbit" into bits per second.
+func parseBitRate(s string) (int64, error) {
+	lower := strings.ToLower(s)
+	mult := int64(1)
+	for _, u := range []struct {
+		suffix string
+		mult   int64
+	}{{"gbit", 1e9}, {"mbit", 1e6}, {"kbit", 1e3}, {"bit", 1}} {
+		if rest, ok := strings.CutSuffix(lower, u.suffix); ok {
+			lower, mult = rest, u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(lower, 64)
+	if err != nil || n <= 0 || int64(n*float64(mult)) < 8 {
+		return 0, fmt.Errorf("invalid bw %q (want e.g. 5mbit)", s)
+	}
+	return int64(n * float64(mult)), nil
+}
+
+// Shaper wraps a Carrier to emulate a slower, longer network path, for
+// testing applications through the tunnel: every packet is serialized at
+// Shaping.Bandwidth and delayed by half of Shaping.RTT, in each direction.
+// Packet order is kept.
+type Shaper struct {
+	Carrier
+
+	out, in *link
+
+	mu      sync.Mutex
+	handler func(*protocol.Packet)
+}
+
+// Shape wraps c with the given shaping.
+func Shape(c Carrier, sh Shaping) *Shaper {
+	s := &Shaper{
+		Carrier: c,
+		out:     newLink(sh, c.Done()),
+		in:      newLink(sh, c.Done()),
+	}
+	c.OnPacket(func(pkt *protocol.Packet) {
+		s.in.send(len(pkt.Payload), func() {
+			s.mu.Lock()
+			fn := s.handler
+			s.mu.Unlock()
+			if fn != nil {
+				fn(pkt)
+			}
+		})
+	})
+	return s
+}
+
+// SendConnect sends a CONNECT packet through the shaped link.
+func (s *Shaper) SendConnect(socketID, seqNum uint32) {
+	s.out.send(0, func() { s.Carrier.SendConnect(socketID, seqNum) })
+}
+
+// SendData sends a DATA packet through the shaped link.
+func (s *Shaper) SendData(socketID, seqNum uint32, payload []byte) {
+	s.out.send(len(payload), func() { s.Carrier.SendData(socketID, seqNum, payload) })
+}
+
+// SendClose sends a CLOSE packet through the shaped link.
+func (s *Shaper) SendClose(socketID, seqNum uint32) {
+	s.out.send(0, func() { s.Carrier.SendClose(socketID, seqNum) })
+}
+
+// SendNack sends a NACK packet through the shaped link.
+func (s *Shaper) SendNack(socketID, first, last uint32) {
+	s.out.send(0, func() { s.Carrier.SendNack(socketID, first, last) })
+}
+
+// SendControl sends a CONTROL packet through the shaped link.
+func (s *Shaper) SendControl(payload []byte) {
+	s.out.send(0, func() { s.Carrier.SendControl(payload) })
+}
+
+// WaitWritable waits for the wrapped carrier, if it queues outgoing packets.
+func (s *Shaper) WaitWritable(ctx context.Context, socketID uint32) error {
+	if w, ok := s.Carrier.(writable); ok {
+		return w.WaitWritable(ctx, socketID)
+	}
+	return nil
+}
+
+// OnPacket registers the handler for shaped inbound packets.
+func (s *Shaper) OnPacket(fn func(*protocol.Packet)) {
+	s.mu.Lock()
+	s.handler = fn
+	s.mu.Unlock()
+}
+
+// link emulates one direction of a path: a queue drained at the bandwidth,
+// followed by a fixed propagation delay.
+type link struct {
+	sh   Shaping
+	done <-chan struct{}
+
+	mu   sync.Mutex
+	free time.Time // when the link finishes serializing the queued packets
+
+	queue chan shapedPacket
+}
+
+// shapedPacket is a packet waiting for its delivery time.
+type shapedPacket struct {
+	at      time.Time
+	deliver func()
+}
+
+func newLink(sh Shaping, done <-chan struct{}) *link {
+	l := &link{sh: sh, done: done, queue: make(chan shapedPacket, shapeQueue)}
+	go l.run()
+	return l
+}
+
+// send schedules deliver for a packet of size payload bytes. It blocks while
+// the queue is full. The lock is held while queueing, so packets are queued
+// in the order of their delivery times.
+func (l *link) send(size int, deliver func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	departure := time.Now()
+	if l.free.After(departure) {
+		departure = l.free
+	}
+	if l.sh.Bandwidth > 0 {
+		departure = departure.Add(time.Duration(int64(size+protocol.HeaderSize) * int64(time.Second) / l.sh.Bandwidth))
+	}
+	l.free = departure
+
+	select {
+	case l.queue <- shapedPacket{at: departure.Add(l.sh.RTT / 2), deliver: deliver}:
+	case <-l.done:
+	}
+}
+
+// run delivers the queued packets in order, each at its time.
+func (l *link) run() {
+	for {
+		select {
+		case p := <-l.queue:
+			if d := time.Until(p.at); d > 0 {
+				timer := time.NewTimer(d)
+				select {
+				case <-timer.C:
+				case <-l.done:
+					timer.Stop()
+					return
+				}
+			}
+			p.deliver()
+		case <-l.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package transport
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+
+	"github.com/1ureka/roj1/internal/protocol"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// maxFrameSize bounds a single length-prefixed frame on a StreamTransport, so
+// a corrupt or malicious length cannot trigger a huge allocation.
+const maxFrameSize = 1024 * 1024
+
+// StreamTransport carries tunnel packets over a reliable byte stream (plain
+// TCP, TLS when conn is a *tls.Conn, or a QUIC stream, see NewQUICTransport),
+// for peers that can reach each other directly. Each packet is sent as a
+// 4-byte big-endian length followed by the protocol-encoded packet. It offers
+// the same Send*/OnPacket/Done API as Transport, so the adapter layer works
+// unchanged on top of it.
+//
+// Backpressure is provided by the stream itself: Send* blocks while the
+// kernel send buffer, or the QUIC flow control window, is full.
+type StreamTransport struct {
+	conn net.Conn
+
+	ctx       context.Context
+	cancel    context.CancelCauseFunc
+	closeOnce sync.Once
+
+	writeMu  sync.Mutex
+	readOnce sync.Once
+}
+
+// NewStreamTransport wraps an established connection. The Transport is alive
+// until the connection fails, the peer closes it, Close is called, or ctx is
+// cancelled.
+func NewStreamTransport(ctx context.Context, conn net.Conn) *StreamTransport {
+	sCtx, sCancel := context.WithCancelCause(ctx)
+
+	t := &StreamTransport{
+		conn:   conn,
+		ctx:    sCtx,
+		cancel: sCancel,
+	}
+
+	// Unblock pending reads/writes once the transport is done.
+	go func() {
+		<-sCtx.Done()
+		t.shutdown(nil)
+	}()
+
+	return t
+}
+
+// ---------------------------------------------------------------------------
+// Lifecycle
+// ---------------------------------------------------------------------------
+
+// Done returns a channel that is closed when the Transport is shut down.
+func (t *StreamTransport) Done() <-chan struct{} {
+	return t.ctx.Done()
+}
+
+// Err returns nil while the Transport is alive. Once Done is closed, it
+// returns ErrPeerClosed if the peer closed the stream, the stream error that
+// ended it, or the context error (normally context.Canceled) once closed
+// here.
+func (t *StreamTransport) Err() error {
+	return context.Cause(t.ctx)
+}
+
+// Close shuts down the Transport and closes the underlying connection.
+func (t *StreamTransport) Close() error {
+	t.shutdown(nil)
+	return nil
+}
+
+// shutdown closes the connection (once) and cancels the context with the
+// given cause.
+func (t *StreamTransport) shutdown(cause error) {
+	t.closeOnce.Do(func() { t.conn.Close() })
+	t.cancel(cause)
+}
+
+// ---------------------------------------------------------------------------
+// Data
+// ---------------------------------------------------------------------------
+
+// SendConnect writes a CONNECT packet for the given socketID.
+func (t *StreamTransport) SendConnect(socketID, seqNum uint32) {
+	t.send(&protocol.Packet{Type: protocol.TypeConnect, SocketID: socketID, SeqNum: seqNum})
+}
+
+// SendClose writes a CLOSE packet for the given socketID.
+func (t *StreamTransport) SendClose(socketID, seqNum uint32) {
+	t.send(&protocol.Packet{Type: protocol.TypeClose, SocketID: socketID, SeqNum: seqNum})
+}
+
+// SendData writes a DATA packet with the given payload.
+func (t *StreamTransport) SendData(socketID, seqNum uint32, payload []byte) {
+	t.send(&protocol.Packet{Type: protocol.TypeData, SocketID: socketID, SeqNum: seqNum, Payload: payload})
+}
+
+// SendNack writes a NACK packet for the given socketID.
+func (t *StreamTransport) SendNack(socketID, first, last uint32) {
+	t.send(&protocol.Packet{Type: protocol.TypeNack, SocketID: socketID, Payload: protocol.NackPayload(first, last)})
+}
+
+// SendControl writes a CONTROL packet.
+func (t *StreamTransport) SendControl(payload []byte) {
+	t.send(&protocol.Packet{Type: protocol.TypeControl, Payload: payload})
+}
+
+// send frames and writes a packet. It blocks while the stream is congested
+// and returns silently once the Transport is done.
+func (t *StreamTransport) send(pkt *protocol.Packet) {
+	if t.ctx.Err() != nil {
+		return
+	}
+
+	data := protocol.Encode(pkt)
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame[:4], uint32(len(data)))
+	copy(frame[4:], data)
+
+	t.writeMu.Lock()
+	_, err := t.conn.Write(frame)
+	t.writeMu.Unlock()
+
+	if err != nil {
+		if peerClosed(err) {
+			t.shutdown(ErrPeerClosed)
+			return
+		}
+		if t.ctx.Err() == nil {
+			util.LogError("failed to send packet (socketID=%08x, type=%d): %v", pkt.SocketID, pkt.Type, err)
+		}
+		t.shutdown(err)
+		return
+	}
+
+	util.Stats.AddSent(len(data))
+}
+
+// OnPacket registers the callback invoked for every inbound packet and starts
+// reading from the stream. Frames are buffered by the stream until the first
+// registration, so no packet is lost. Only the first registration starts the
+// read loop; later calls are ignored.
+func (t *StreamTransport) OnPacket(fn func(*protocol.Packet)) {
+	t.readOnce.Do(func() {
+		go t.readLoop(fn)
+	})
+}
+
+// readLoop reads frames until the stream ends, decoding and dispatching each.
+func (t *StreamTransport) readLoop(fn func(*protocol.Packet)) {
+	var header [4]byte
+	for {
+		if _, err := io.ReadFull(t.conn, header[:]); err != nil {
+			t.readFailed(err)
+			return
+		}
+
+		size := binary.BigEndian.Uint32(header[:])
+		if size > maxFrameSize {
+			t.readFailed(fmt.Errorf("frame too large: %d bytes (limit %d)", size, maxFrameSize))
+			return
+		}
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(t.conn, data); err != nil {
+			t.readFailed(err)
+			return
+		}
+
+		pkt, err := protocol.Decode(data)
+		if err != nil {
+			util.LogError("failed to decode packet: %v", err)
+			continue
+		}
+
+		util.Stats.AddRecv(len(data))
+		fn(pkt)
+	}
+}
+
+// readFailed shuts the Transport down after a read error. A clean EOF means
+// the peer closed the stream, and so does a reset: a peer that closes with
+// unread data in its receive buffer resets the connection.
+func (t *StreamTransport) readFailed(err error) {
+	if peerClosed(err) || t.ctx.Err() != nil {
+		t.shutdown(ErrPeerClosed) // unless closed here first
+		return
+	}
+
+	util.LogWarning("stream transport read error: %v", err)
+	t.shutdown(err)
+}
+
+// peerClosed reports whether err means the peer closed the stream.
+func peerClosed(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
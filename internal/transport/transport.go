@@ -3,13 +3,30 @@ package transport
 import (
 	"context"
 	"errors"
+	"io"
 	"sync"
+	"sync/atomic"
 
 	"github.com/1ureka/roj1/internal/protocol"
 	"github.com/1ureka/roj1/internal/util"
 	"github.com/pion/webrtc/v4"
 )
 
+// Shutdown causes, as reported by Err.
+var (
+	// ErrConnectionFailed: the PeerConnection entered the failed state.
+	ErrConnectionFailed = errors.New("PeerConnection failed")
+
+	// ErrICETimeout: ICE gave up before any candidate pair worked, e.g. as
+	// both peers are behind NATs that keep each other out. Reported wrapped
+	// in ErrConnectionFailed, or by signaling when establishment timed out
+	// during the checks.
+	ErrICETimeout = errors.New("ICE connectivity checks timed out")
+
+	// ErrPeerClosed: the peer closed the connection.
+	ErrPeerClosed = errors.New("closed by the peer")
+)
+
 // Transport wraps a single PeerConnection + DataChannel pair, providing a
 // high-level API for signaling exchange, packet sending with backpressure,
 // and packet receiving.
@@ -25,10 +42,25 @@ type Transport struct {
 	openSignal chan struct{}
 
 	ctx    context.Context
-	cancel context.CancelFunc
+	cancel context.CancelCauseFunc
 
 	mu      sync.RWMutex
 	pcState webrtc.PeerConnectionState
+
+	phases   *phases     // establishment timing, see watchPhases
+	ice      iceProgress // see watchICE
+	received atomic.Bool // whether a message from the peer arrived
+
+	// Per-socket channels (see Config.SocketChannels and channels.go).
+	socketChannels bool
+	chMu           sync.Mutex
+	channels       map[uint32]*socketChannel
+	handler        func(*protocol.Packet)
+
+	marks    waterMarks  // initial send thresholds for every channel
+	queue    queueConfig // send queue settings of every channel
+	pacer    *pacer      // shared by every channel's sender; nil unless Config.Pace
+	lowPower bool        // see Config.LowPower
 }
 
 // NewTransport creates a Transport backed by a new PeerConnection and a
@@ -39,7 +71,68 @@ type Transport struct {
 // The Transport is considered alive as long as the DataChannel is open and
 // ctx has not been cancelled.
 func NewTransport(ctx context.Context) (*Transport, error) {
-	pc, err := newPeerConnection()
+	return NewTransportWith(ctx, Config{})
+}
+
+// Config tunes a Transport. The zero value is the default: any network
+// interface and a single unordered DataChannel shared by all sockets.
+type Config struct {
+	// Interface binds the PeerConnection to the named network interface
+	// (e.g. "eth0"); empty means any interface.
+	Interface string
+
+	// SocketChannels opens one ordered DataChannel per socket (created on
+	// CONNECT, closed once both sides have sent CLOSE), letting SCTP do the
+	// sequencing instead of the reassembler. Only the side sending CONNECT
+	// needs it; the peer follows automatically.
+	SocketChannels bool
+
+	// Network restricts ICE gathering to IPv4 or IPv6 candidates; the zero
+	// value gathers both.
+	Network ICENetwork
+
+	// HighWaterMark and LowWaterMark set the send backpressure thresholds
+	// in bytes of DataChannel bufferedAmount: sending pauses above the high
+	// mark and resumes below the low one. Zero keeps the defaults (256 KiB
+	// and 64 KiB), which are too small for high bandwidth-delay paths.
+	HighWaterMark int
+	LowWaterMark  int
+
+	// AutoTune grows the thresholds at runtime to the measured
+	// bandwidth-delay product (see tune.go).
+	AutoTune bool
+
+	// Pace paces sends to the SCTP congestion window and RTT instead of
+	// letting the buffer fill to the high mark, keeping latency low for
+	// interactive sockets during bulk transfers (see pace.go).
+	Pace bool
+
+	// LowPower trades throughput for memory on small devices: zero water
+	// marks default to 64 KiB and 16 KiB, and each sender queues fewer
+	// packets and samples its buffer for the stats once a second.
+	LowPower bool
+
+	// SocketQueue bounds the packets each socket may have waiting to be
+	// sent on a DataChannel. Sockets are served round-robin, so one at its
+	// bound holds up only its own writer. Zero keeps the default (64, or 16
+	// with LowPower).
+	SocketQueue int
+
+	// QueueDrop drops the DATA packets of a socket whose queue is full
+	// instead of making its writer wait. The peer asks for them again only
+	// if both sides enable NACKs (see adapter.HostConfig.Nack); otherwise the
+	// connection stalls.
+	QueueDrop bool
+}
+
+// NewTransportWith is like NewTransport, with the given configuration.
+func NewTransportWith(ctx context.Context, cfg Config) (*Transport, error) {
+	marks, err := cfg.waterMarks()
+	if err != nil {
+		return nil, err
+	}
+
+	pc, err := newPeerConnection(cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -50,7 +143,7 @@ func NewTransport(ctx context.Context) (*Transport, error) {
 		return nil, err
 	}
 
-	tCtx, tCancel := context.WithCancel(ctx)
+	tCtx, tCancel := context.WithCancelCause(ctx)
 
 	t := &Transport{
 		pc:         pc,
@@ -59,18 +152,37 @@ func NewTransport(ctx context.Context) (*Transport, error) {
 		ctx:        tCtx,
 		cancel:     tCancel,
 		pcState:    webrtc.PeerConnectionStateNew,
+		phases:     newPhases(),
+
+		socketChannels: cfg.SocketChannels,
+		channels:       make(map[uint32]*socketChannel),
+		marks:          marks,
+		queue:          queueConfig{limit: cfg.SocketQueue, drop: cfg.QueueDrop},
+		lowPower:       cfg.LowPower,
+	}
+	if cfg.Pace {
+		t.pacer = &pacer{}
 	}
 
-	// DC open gate.
-	var openOnce sync.Once
-	dc.OnOpen(func() {
-		openOnce.Do(func() { close(t.openSignal) })
+	// Start the sender goroutine; it waits for the open gate.
+	t.sender = newSender(tCtx, dc, t.openSignal, marks, t.queue, t.pacer, cfg.LowPower)
+
+	// DC open → detach its stream, hand it to the sender, open the gate and
+	// read packets until the channel closes.
+	onDetached(dc, func(rwc io.ReadWriteCloser) {
+		t.sender.w = rwc
+		t.phases.next(util.PhaseDataChannel, util.PhaseFirstMessage)
+		close(t.openSignal)
+		go func() {
+			readMessages(rwc, func(data []byte) { t.receive(data) })
+			t.shutdown(ErrPeerClosed) // unless closed here first
+		}()
 	})
 
 	// DC close → cancel transport context.
 	dc.OnClose(func() {
 		util.LogInfo("DataChannel closed")
-		tCancel()
+		t.shutdown(ErrPeerClosed)
 	})
 
 	// Record PC state; auto-close on "failed" (pion/webrtc does not
@@ -78,17 +190,38 @@ func NewTransport(ctx context.Context) (*Transport, error) {
 	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
 		util.LogInfo("PeerConnection state changed → %s", state)
 		t.mu.Lock()
+		prev := t.pcState
 		t.pcState = state
 		t.mu.Unlock()
 
+		if state == webrtc.PeerConnectionStateConnected {
+			t.phases.next(util.PhaseDTLS, util.PhaseDataChannel)
+		}
+		switch {
+		case state == webrtc.PeerConnectionStateDisconnected:
+			util.NotifyState(util.StateDegraded)
+		case state == webrtc.PeerConnectionStateConnected && prev == webrtc.PeerConnectionStateDisconnected:
+			util.NotifyState(util.StateEstablished)
+		}
+
 		if state == webrtc.PeerConnectionStateFailed {
 			util.LogWarning("PeerConnection entered failed state — closing transport")
-			tCancel()
+			t.shutdown(ErrConnectionFailed)
 		}
 	})
 
-	// Start the sender goroutine.
-	t.sender = newSender(tCtx, dc, t.openSignal)
+	// Channels opened by the peer carry a single socket each.
+	pc.OnDataChannel(t.adoptChannel)
+
+	t.watchPhases()
+	t.watchICE()
+
+	if cfg.AutoTune {
+		go t.autoTune()
+	}
+	if cfg.Pace {
+		go t.pace()
+	}
 
 	return t, nil
 }
@@ -97,6 +230,32 @@ func NewTransport(ctx context.Context) (*Transport, error) {
 // Lifecycle
 // ---------------------------------------------------------------------------
 
+// watchPhases reports the ICE gathering and connectivity checks as phase
+// events; the phases up to the first message are reported as the
+// PeerConnection, the DataChannel and receive get there (see phases).
+func (t *Transport) watchPhases() {
+	t.pc.OnICEGatheringStateChange(func(state webrtc.ICEGatheringState) {
+		switch state {
+		case webrtc.ICEGatheringStateGathering:
+			t.phases.start(util.PhaseGathering)
+			t.reportICE(util.ICEGathering, "")
+		case webrtc.ICEGatheringStateComplete:
+			t.phases.end(util.PhaseGathering)
+		}
+	})
+	t.pc.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
+		switch state {
+		case webrtc.ICEConnectionStateChecking:
+			t.phases.start(util.PhaseICE)
+			t.reportICE(util.ICEChecking, "")
+		case webrtc.ICEConnectionStateConnected:
+			t.phases.next(util.PhaseICE, util.PhaseDTLS)
+		case webrtc.ICEConnectionStateFailed:
+			t.iceFailed()
+		}
+	})
+}
+
 // Ready returns a channel that is closed when the DataChannel is open and
 // the Transport is ready to send and receive.
 func (t *Transport) Ready() <-chan struct{} {
@@ -109,9 +268,24 @@ func (t *Transport) Done() <-chan struct{} {
 	return t.ctx.Done()
 }
 
+// Err returns nil while the Transport is alive. Once Done is closed, it
+// returns ErrConnectionFailed if the PeerConnection failed (wrapping
+// ErrICETimeout if it never connected), ErrPeerClosed if the peer closed the
+// DataChannel, or the context error (normally context.Canceled) once closed
+// here.
+func (t *Transport) Err() error {
+	return context.Cause(t.ctx)
+}
+
+// shutdown cancels the Transport context with the given cause. The tunnel
+// is reported as closed by the Failover bundling this Transport.
+func (t *Transport) shutdown(cause error) {
+	t.cancel(cause)
+}
+
 // Close shuts down the DataChannel and PeerConnection.
 func (t *Transport) Close() error {
-	t.cancel()
+	t.shutdown(nil)
 	return errors.Join(t.dc.Close(), t.pc.Close())
 }
 
@@ -143,27 +317,58 @@ func (t *Transport) SetLocalDescription(sdp webrtc.SessionDescription) error {
 
 // SetRemoteDescription applies the remote SDP.
 func (t *Transport) SetRemoteDescription(sdp webrtc.SessionDescription) error {
-	return t.pc.SetRemoteDescription(sdp)
+	if err := t.pc.SetRemoteDescription(sdp); err != nil {
+		return err
+	}
+	t.addRemote(sdpCandidates(sdp.SDP))
+	return nil
+}
+
+// GatheredDescription waits for ICE gathering to complete after
+// SetLocalDescription and returns the local description with every
+// candidate in it, for signaling that cannot trickle candidates.
+func (t *Transport) GatheredDescription(ctx context.Context) (webrtc.SessionDescription, error) {
+	select {
+	case <-webrtc.GatheringCompletePromise(t.pc):
+	case <-ctx.Done():
+		return webrtc.SessionDescription{}, context.Cause(ctx)
+	}
+
+	desc := t.pc.LocalDescription()
+	if desc == nil {
+		return webrtc.SessionDescription{}, errors.New("no local description")
+	}
+	return *desc, nil
 }
 
 // OnICECandidate registers a callback invoked whenever a new local ICE
 // candidate is gathered. A nil candidate signals the end of gathering.
 func (t *Transport) OnICECandidate(fn func(*webrtc.ICECandidate)) {
-	t.pc.OnICECandidate(fn)
+	t.ice.mu.Lock()
+	t.ice.onCandidate = fn
+	t.ice.mu.Unlock()
 }
 
 // AddICECandidate adds a remote ICE candidate received through signaling.
 func (t *Transport) AddICECandidate(candidate webrtc.ICECandidateInit) error {
-	return t.pc.AddICECandidate(candidate)
+	if err := t.pc.AddICECandidate(candidate); err != nil {
+		return err
+	}
+	t.addRemote(1)
+	return nil
 }
 
 // ---------------------------------------------------------------------------
 // Data
 // ---------------------------------------------------------------------------
 
-// SendConnect enqueues a CONNECT packet for the given socketID.
+// SendConnect enqueues a CONNECT packet for the given socketID. With
+// per-socket channels, it first opens the socket's channel.
 func (t *Transport) SendConnect(socketID, seqNum uint32) {
-	t.sender.send(t.ctx, &protocol.Packet{
+	if t.socketChannels {
+		t.openChannel(socketID)
+	}
+	t.senderFor(socketID).send(t.ctx, &protocol.Packet{
 		Type:     protocol.TypeConnect,
 		SocketID: socketID,
 		SeqNum:   seqNum,
@@ -172,16 +377,17 @@ func (t *Transport) SendConnect(socketID, seqNum uint32) {
 
 // SendClose enqueues a CLOSE packet for the given socketID.
 func (t *Transport) SendClose(socketID, seqNum uint32) {
-	t.sender.send(t.ctx, &protocol.Packet{
+	t.senderFor(socketID).send(t.ctx, &protocol.Packet{
 		Type:     protocol.TypeClose,
 		SocketID: socketID,
 		SeqNum:   seqNum,
 	})
+	t.closeSent(socketID)
 }
 
 // SendData enqueues a DATA packet with the given payload.
 func (t *Transport) SendData(socketID, seqNum uint32, payload []byte) {
-	t.sender.send(t.ctx, &protocol.Packet{
+	t.senderFor(socketID).send(t.ctx, &protocol.Packet{
 		Type:     protocol.TypeData,
 		SocketID: socketID,
 		SeqNum:   seqNum,
@@ -189,18 +395,74 @@ func (t *Transport) SendData(socketID, seqNum uint32, payload []byte) {
 	})
 }
 
-// OnPacket registers a callback invoked for every inbound DataChannel message.
-// The callback receives the decoded packet.
+// SendNack enqueues a NACK packet asking the peer to resend SeqNums
+// first..last of socketID.
+func (t *Transport) SendNack(socketID, first, last uint32) {
+	t.senderFor(socketID).send(t.ctx, &protocol.Packet{
+		Type:     protocol.TypeNack,
+		SocketID: socketID,
+		Payload:  protocol.NackPayload(first, last),
+	})
+}
+
+// SendControl enqueues a CONTROL packet on the shared channel.
+func (t *Transport) SendControl(payload []byte) {
+	t.sender.send(t.ctx, &protocol.Packet{
+		Type:    protocol.TypeControl,
+		Payload: payload,
+	})
+}
+
+// WaitWritable blocks while the DataChannel carrying socketID is above the
+// high-water mark, so callers can stop reading their source (letting its TCP
+// window close) instead of queuing more data. It returns ctx's error if ctx is
+// done first, and nil once the Transport is done.
+func (t *Transport) WaitWritable(ctx context.Context, socketID uint32) error {
+	resumed := t.senderFor(socketID).paused()
+	if resumed == nil {
+		return nil
+	}
+
+	select {
+	case <-resumed:
+		return nil
+	case <-t.ctx.Done():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// OnPacket registers a callback invoked for every inbound DataChannel message
+// (on the shared channel and on every per-socket channel). The callback
+// receives the decoded packet; messages before registration are dropped.
 func (t *Transport) OnPacket(fn func(*protocol.Packet)) {
-	t.dc.OnMessage(func(msg webrtc.DataChannelMessage) {
-		pkt, err := protocol.Decode(msg.Data)
+	t.chMu.Lock()
+	t.handler = fn
+	t.chMu.Unlock()
+}
 
-		if err != nil {
-			util.LogError("failed to decode packet: %v", err)
-			return
-		}
+// receive decodes an inbound message and hands it to the registered callback.
+// data is not retained (protocol.Decode copies the payload). It returns the
+// decoded packet, or nil if it could not be decoded.
+func (t *Transport) receive(data []byte) *protocol.Packet {
+	pkt, err := protocol.Decode(data)
+	if err != nil {
+		util.LogError("failed to decode packet: %v", err)
+		return nil
+	}
+
+	util.Stats.AddRecv(len(data))
+	if !t.received.Load() && !t.received.Swap(true) {
+		t.phases.end(util.PhaseFirstMessage)
+	}
+
+	t.chMu.Lock()
+	fn := t.handler
+	t.chMu.Unlock()
 
-		util.Stats.AddRecv(len(msg.Data))
+	if fn != nil {
 		fn(pkt)
-	})
+	}
+	return pkt
 }
@@ -0,0 +1,124 @@
+package transport
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// Auto-tuning: a sender can keep at most high-water-mark bytes in flight, so
+// its throughput is capped at high/RTT. Every autoTuneInterval, each sender's
+// drain rate (bytes that actually left the DataChannel buffer) is multiplied
+// by the path RTT to estimate the bandwidth-delay product, and the high mark
+// is raised to twice that. While the window is the bottleneck the drain rate
+// tracks high/RTT, so the window doubles each interval; once the path is the
+// bottleneck the estimate stops growing. The marks never shrink.
+
+const (
+	autoTuneInterval = time.Second
+	maxHighWaterMark = 16 * 1024 * 1024 // cap on the auto-tuned high mark
+)
+
+// waterMarks are a sender's backpressure thresholds in bytes (private).
+type waterMarks struct {
+	high, low uint64
+}
+
+// waterMarks returns the configured thresholds, applying the defaults.
+func (cfg Config) waterMarks() (waterMarks, error) {
+	high, low := cfg.HighWaterMark, cfg.LowWaterMark
+	defHigh, defLow := highWaterMark, lowWaterMark
+	if cfg.LowPower {
+		defHigh, defLow = lowPowerHighWaterMark, lowPowerLowWaterMark
+	}
+	if high == 0 {
+		high = max(defHigh, low*4)
+	}
+	if low == 0 {
+		low = min(defLow, high/4)
+	}
+	if low < 0 || high <= low {
+		return waterMarks{}, fmt.Errorf("invalid water marks: need 0 <= low (%d) < high (%d)", low, high)
+	}
+	return waterMarks{high: uint64(high), low: uint64(low)}, nil
+}
+
+// Validate reports whether the configuration is usable.
+func (cfg Config) Validate() error {
+	if cfg.SocketQueue < 0 {
+		return fmt.Errorf("invalid socket queue: %d packets", cfg.SocketQueue)
+	}
+	_, err := cfg.waterMarks()
+	return err
+}
+
+// autoTune tunes every sender of the Transport until it is done.
+func (t *Transport) autoTune() {
+	ticker := time.NewTicker(autoTuneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			rtt := t.rtt()
+			if rtt <= 0 {
+				continue
+			}
+			for _, s := range t.senders() {
+				s.tune(rtt)
+			}
+		case <-t.ctx.Done():
+			return
+		}
+	}
+}
+
+// rtt returns the round-trip time of the nominated ICE candidate pair, or 0
+// if it is not known yet.
+func (t *Transport) rtt() time.Duration {
+	for _, s := range t.pc.GetStats() {
+		if cp, ok := s.(webrtc.ICECandidatePairStats); ok && cp.Nominated && cp.CurrentRoundTripTime > 0 {
+			return time.Duration(cp.CurrentRoundTripTime * float64(time.Second))
+		}
+	}
+	return 0
+}
+
+// senders returns the shared sender and those of all per-socket channels.
+func (t *Transport) senders() []*sender {
+	t.chMu.Lock()
+	defer t.chMu.Unlock()
+
+	senders := make([]*sender, 0, 1+len(t.channels))
+	senders = append(senders, t.sender)
+	for _, ch := range t.channels {
+		senders = append(senders, ch.sender)
+	}
+	return senders
+}
+
+// tune raises the sender's thresholds to twice the bandwidth-delay product
+// measured over the last interval. Only called from autoTune.
+func (s *sender) tune(rtt time.Duration) {
+	sent, buffered := s.sent.Load(), s.dc.BufferedAmount()
+	drained := int64(sent-s.prevSent) - (int64(buffered) - int64(s.prevBuffered))
+	s.prevSent, s.prevBuffered = sent, buffered
+	if drained <= 0 {
+		return
+	}
+
+	rate := float64(drained) / autoTuneInterval.Seconds()
+	high := min(uint64(2*rate*rtt.Seconds()), maxHighWaterMark)
+	if high <= s.high.Load() {
+		return
+	}
+
+	low := high / 4
+	s.low.Store(low)
+	s.high.Store(high)
+	s.dc.SetBufferedAmountLowThreshold(low)
+	util.LogDebug("send window grown to %d KiB (rtt %v, drain rate %.0f KiB/s)", high/1024, rtt, rate/1024)
+}
@@ -0,0 +1,220 @@
+package util
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+// ──────────────────────────────────────────────────────────────────────────────
+// Event bus
+// ──────────────────────────────────────────────────────────────────────────────
+
+// Everything observable about the process goes through EmitEvent: the
+// lifecycle events below, which are also printed as JSON lines with
+// -output json, and the bus-only ones (log messages, stats ticks, bridged
+// connections). The logger, lifecycle hooks, the -onUp/-onDown commands, the
+// session history and the control socket subscribe to it rather than being
+// called directly.
+
+// Lifecycle event names emitted by EmitEvent.
+const (
+	EventWSListening       = "ws_listening"       // host WS signaling server is accepting clients (Port)
+	EventRoomOpened        = "room_opened"        // host is waiting in a room on the rendezvous relay (Room)
+	EventClientConnected   = "client_connected"   // the signaling WebSocket between host and client is up
+	EventQueued            = "queued"             // client waits in the busy host's queue (Position)
+	EventTunnelEstablished = "tunnel_established" // DataChannel open on both sides (Addr, Port on the client, Peer)
+	EventTunnelClosed      = "tunnel_closed"      // tunnel torn down (Reason)
+	EventEstablishFailed   = "establish_failed"   // establishment aborted (Error)
+	EventStateChanged      = "state_changed"      // tunnel state transition (State)
+	EventSocketStalled     = "socket_stalled"     // a socket's data stopped being delivered (Socket, Missing, Buffered, Idle)
+	EventServiceAnnounced  = "service_announced"  // client learned the host's service (Port, Label, Protocol)
+	EventMessage           = "message"            // the peer's operator sent a message (Text)
+)
+
+// Bus-only event names: delivered to subscribers, never printed as JSON
+// lines.
+const (
+	EventLog          = "log"           // a log message (Level, Text)
+	EventStats        = "stats"         // periodic traffic statistics (Stats)
+	EventSocketOpened = "socket_opened" // a bridged connection was created (Socket)
+	EventSocketClosed = "socket_closed" // a bridged connection was torn down (Socket, BytesIn, BytesOut)
+	EventPhase        = "phase"         // an establishment phase ended (Phase, Duration)
+	EventICEProgress  = "ice_progress"  // ICE made progress (State, Local, Srflx, Remote, Pair)
+)
+
+// ICE states of ice_progress events.
+const (
+	ICEGathering = "gathering" // gathering local candidates
+	ICEChecking  = "checking"  // checking candidate pairs
+	ICEConnected = "connected" // a pair was selected (Pair)
+)
+
+// Establishment phases of phase events, in the order they start. ICE
+// gathering overlaps the exchange and the checks.
+const (
+	PhaseWait         = "wait"          // host: waiting for a client to connect
+	PhaseConnect      = "connect"       // client: connecting to the signaling server
+	PhaseSDP          = "sdp"           // offer/answer exchange, from the signaling connection to the answer
+	PhaseGathering    = "gathering"     // ICE gathering of the local candidates
+	PhaseICE          = "ice"           // ICE connectivity checks
+	PhaseDTLS         = "dtls"          // from ICE connected to the PeerConnection connected
+	PhaseDataChannel  = "datachannel"   // from there to the DataChannel open
+	PhaseReady        = "ready"         // from there to the peer confirming its DataChannel open
+	PhaseFirstMessage = "first_message" // from the DataChannel open to the first message from the peer
+	PhaseEstablish    = "establish"     // the whole establishment, from connecting (client) or the client's arrival (host)
+)
+
+// busOnly reports whether events named name stay off the JSON output.
+func busOnly(name string) bool {
+	switch name {
+	case EventLog, EventStats, EventSocketOpened, EventSocketClosed, EventPhase, EventICEProgress:
+		return true
+	}
+	return false
+}
+
+// Log levels of EventLog.
+const (
+	LevelDebug   = "debug"
+	LevelInfo    = "info"
+	LevelSuccess = "success"
+	LevelWarning = "warning"
+	LevelError   = "error"
+)
+
+// Event is a single event, printed as one JSON line on stdout if it is a
+// lifecycle event.
+type Event struct {
+	Event    string    `json:"event"`
+	Time     time.Time `json:"time"`
+	Port     int       `json:"port,omitempty"`
+	Addr     string    `json:"addr,omitempty"`
+	Peer     string    `json:"peer,omitempty"`     // fingerprint of the peer's proven key
+	Room     string    `json:"room,omitempty"`     // rendezvous relay room code
+	Position int       `json:"position,omitempty"` // place in the host's queue
+	State    string    `json:"state,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	Error    string    `json:"error,omitempty"`
+
+	// socket_stalled, socket_opened and socket_closed.
+	Socket   string `json:"socket,omitempty"`   // socketID in hex
+	Missing  string `json:"missing,omitempty"`  // sequence numbers waited for, e.g. "12-15"
+	Buffered int    `json:"buffered,omitempty"` // bytes waiting in the reorder buffer
+	Idle     string `json:"idle,omitempty"`     // time since the last delivery, e.g. "30s"
+	BytesIn  int64  `json:"bytes_in,omitempty"` // received from the tunnel for the connection
+	BytesOut int64  `json:"bytes_out,omitempty"`
+
+	// service_announced only.
+	Label    string `json:"label,omitempty"`    // e.g. "Postgres 16"
+	Protocol string `json:"protocol,omitempty"` // hint such as "postgres"
+
+	// message and log.
+	Text  string `json:"text,omitempty"`
+	Level string `json:"level,omitempty"` // log only: one of the Level constants
+
+	// stats only.
+	Stats *StatsTick `json:"stats,omitempty"`
+
+	// ice_progress only: candidates gathered (Srflx of them server-reflexive)
+	// and received, and the selected pair, e.g.
+	// "host 192.168.1.5:50000 ↔ srflx 203.0.113.7:41000 (udp)".
+	Local  int    `json:"local,omitempty"`
+	Srflx  int    `json:"srflx,omitempty"`
+	Remote int    `json:"remote,omitempty"`
+	Pair   string `json:"pair,omitempty"`
+
+	// phase only: the phase started Duration before Time.
+	Phase    string        `json:"phase,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
+// subscriber is one registered event callback.
+type subscriber struct {
+	fn func(Event)
+}
+
+var events struct {
+	mu          sync.Mutex
+	subscribers []*subscriber // replaced, never modified, so emitters can iterate without the lock
+	json        bool
+}
+
+// SubscribeEvents registers fn to be called synchronously for every emitted
+// event, bus-only ones included, until the returned function is called. fn
+// should return quickly, as it runs on the emitting goroutine. It may log or
+// emit events itself, which reach every subscriber, fn included, before it
+// returns, so it must not hold a lock of its own meanwhile.
+func SubscribeEvents(fn func(Event)) (unsubscribe func()) {
+	sub := &subscriber{fn: fn}
+
+	events.mu.Lock()
+	events.subscribers = append(slices.Clip(events.subscribers), sub)
+	events.mu.Unlock()
+
+	return func() {
+		events.mu.Lock()
+		events.subscribers = slices.DeleteFunc(slices.Clone(events.subscribers), func(s *subscriber) bool { return s == sub })
+		events.mu.Unlock()
+	}
+}
+
+// JSONEventsEnabled reports whether EnableJSONEvents was called, so stdout
+// must not be written to.
+func JSONEventsEnabled() bool {
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	return events.json
+}
+
+// EnableJSONEvents turns on JSON-lines output of the lifecycle events on
+// stdout. All human-oriented output (logs, spinners, prompts) is moved to
+// stderr so that stdout carries nothing but events.
+func EnableJSONEvents() {
+	events.mu.Lock()
+	enabled := events.json
+	events.json = true
+	events.mu.Unlock()
+	if enabled {
+		return
+	}
+
+	pterm.SetDefaultOutput(os.Stderr)
+	var mu sync.Mutex
+	enc := json.NewEncoder(os.Stdout)
+	SubscribeEvents(func(ev Event) {
+		if busOnly(ev.Event) {
+			return
+		}
+		mu.Lock()
+		_ = enc.Encode(ev) // Best-effort: a closed stdout must not take down the tunnel.
+		mu.Unlock()
+	})
+}
+
+// EmitEvent delivers ev to all subscribers, in the order they subscribed.
+// The Time field is filled in when left zero.
+func EmitEvent(ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	events.mu.Lock()
+	subscribers := events.subscribers
+	events.mu.Unlock()
+
+	for _, s := range subscribers {
+		s.fn(ev)
+	}
+}
+
+// EmitPhase emits a phase event for phase, which started at start and ends
+// now.
+func EmitPhase(phase string, start time.Time) {
+	now := time.Now()
+	EmitEvent(Event{Event: EventPhase, Time: now, Phase: phase, Duration: now.Sub(start)})
+}
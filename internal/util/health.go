@@ -0,0 +1,82 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ──────────────────────────────────────────────────────────────────────────────
+// Health probes
+// ──────────────────────────────────────────────────────────────────────────────
+
+// Health probe paths served by HealthHandler, and the status page of
+// StatusHandler.
+const (
+	ReadyPath  = "/readyz"
+	LivePath   = "/livez"
+	StatusPath = "/status"
+)
+
+// HealthHandler serves the tunnel state for orchestrator probes (e.g. a
+// Kubernetes sidecar). ReadyPath answers 200 only while the tunnel is
+// established, i.e. the DataChannel is open and the peer reachable; LivePath
+// answers 200 until the tunnel is closed for good, so a dead tunnel gets the
+// process restarted. Both report the state name in the body.
+func HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(ReadyPath, func(w http.ResponseWriter, r *http.Request) {
+		state := CurrentState()
+		writeProbe(w, state, state == StateEstablished)
+	})
+	mux.HandleFunc(LivePath, func(w http.ResponseWriter, r *http.Request) {
+		state := CurrentState()
+		writeProbe(w, state, state != StateClosed)
+	})
+	return mux
+}
+
+// writeProbe answers a probe with 200, or 503 if !ok, and the state name.
+func writeProbe(w http.ResponseWriter, state TunnelState, ok bool) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	fmt.Fprintln(w, state)
+}
+
+// Status is the tunnel health served by StatusHandler.
+type Status struct {
+	State       string    `json:"state"`             // see TunnelState
+	Since       time.Time `json:"since,omitzero"`    // when the tunnel entered State
+	BytesIn     int64     `json:"bytes_in"`          // read from the DataChannel since the process started
+	BytesOut    int64     `json:"bytes_out"`         // written to the DataChannel since the process started
+	Connections int64     `json:"connections"`       // bridged connections open now
+	TotalConns  int64     `json:"total_connections"` // bridged connections since the process started
+}
+
+// StatusHandler serves the tunnel state and traffic as JSON (see Status), for
+// whoever has the host's URL to check on the tunnel from a browser. It reveals
+// nothing the probes and stats events do not, and changes nothing.
+func StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "read-only", http.StatusMethodNotAllowed)
+			return
+		}
+		state, since := StateSince()
+		total := Stats.TotalConns.Load()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(Status{
+			State:       state.String(),
+			Since:       since,
+			BytesIn:     Stats.BytesRecv.Load(),
+			BytesOut:    Stats.BytesSent.Load(),
+			Connections: total - Stats.ClosedConns.Load(),
+			TotalConns:  total,
+		})
+	})
+}
@@ -0,0 +1,127 @@
+package util
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ──────────────────────────────────────────────────────────────────────────────
+// Tunnel lifecycle hooks
+// ──────────────────────────────────────────────────────────────────────────────
+
+// TunnelState is a coarse lifecycle state of the tunnel.
+type TunnelState int
+
+const (
+	StateSignaling    TunnelState = iota // exchanging signaling over WebSocket (incl. waiting for a client)
+	StateConnecting                      // WebRTC negotiation in progress
+	StateEstablished                     // DataChannel open on both sides
+	StateDegraded                        // PeerConnection disconnected; ICE may still recover
+	StateReconnecting                    // session ended; waiting for a new one (persistent host)
+	StateClosed                          // tunnel torn down
+)
+
+var stateNames = [...]string{"signaling", "connecting", "established", "degraded", "reconnecting", "closed"}
+
+func (s TunnelState) String() string {
+	if int(s) < len(stateNames) {
+		return stateNames[s]
+	}
+	return "unknown"
+}
+
+// Hooks receives tunnel lifecycle notifications. Callbacks run synchronously
+// on internal goroutines and must return quickly. Embed NopHooks to implement
+// only the callbacks of interest.
+type Hooks interface {
+	// OnStateChange is called on every tunnel state transition.
+	OnStateChange(state TunnelState)
+	// OnConnectionOpen is called when a bridged TCP connection is created.
+	OnConnectionOpen(socketID uint32)
+	// OnConnectionClose is called when a bridged TCP connection is torn down,
+	// with the bytes received from and sent to the tunnel on its behalf.
+	OnConnectionClose(socketID uint32, bytesIn, bytesOut int64)
+}
+
+// NopHooks implements Hooks with no-op callbacks.
+type NopHooks struct{}
+
+func (NopHooks) OnStateChange(TunnelState)              {}
+func (NopHooks) OnConnectionOpen(uint32)                {}
+func (NopHooks) OnConnectionClose(uint32, int64, int64) {}
+
+var hooks struct {
+	mu    sync.RWMutex
+	state TunnelState
+	set   bool      // whether state holds a notified value
+	since time.Time // when state was notified (zero = never)
+}
+
+// AddHooks registers h to receive lifecycle notifications, which it takes
+// from the state_changed, socket_opened and socket_closed events, until the
+// returned function is called.
+func AddHooks(h Hooks) (remove func()) {
+	return SubscribeEvents(func(ev Event) {
+		switch ev.Event {
+		case EventStateChanged:
+			if i := slices.Index(stateNames[:], ev.State); i >= 0 {
+				h.OnStateChange(TunnelState(i))
+			}
+		case EventSocketOpened:
+			if id, err := strconv.ParseUint(ev.Socket, 16, 32); err == nil {
+				h.OnConnectionOpen(uint32(id))
+			}
+		case EventSocketClosed:
+			if id, err := strconv.ParseUint(ev.Socket, 16, 32); err == nil {
+				h.OnConnectionClose(uint32(id), ev.BytesIn, ev.BytesOut)
+			}
+		}
+	})
+}
+
+// NotifyState records a state transition and emits a state_changed event.
+// Repeated notifications of the current state are ignored.
+func NotifyState(state TunnelState) {
+	hooks.mu.Lock()
+	if hooks.set && hooks.state == state {
+		hooks.mu.Unlock()
+		return
+	}
+	hooks.state, hooks.set, hooks.since = state, true, time.Now()
+	hooks.mu.Unlock()
+
+	EmitEvent(Event{Event: EventStateChanged, State: state.String()})
+}
+
+// CurrentState returns the last notified state, or StateSignaling if none
+// was notified yet.
+func CurrentState() TunnelState {
+	hooks.mu.RLock()
+	defer hooks.mu.RUnlock()
+
+	return hooks.state // zero value is StateSignaling
+}
+
+// StateSince returns the last notified state, as CurrentState, and when it
+// was notified (zero if it was not).
+func StateSince() (TunnelState, time.Time) {
+	hooks.mu.RLock()
+	defer hooks.mu.RUnlock()
+
+	return hooks.state, hooks.since
+}
+
+// NotifyConnOpen emits a socket_opened event for a bridged connection that
+// was created.
+func NotifyConnOpen(socketID uint32) {
+	EmitEvent(Event{Event: EventSocketOpened, Socket: fmt.Sprintf("%08x", socketID)})
+}
+
+// NotifyConnClose emits a socket_closed event for a bridged connection that
+// was torn down.
+func NotifyConnClose(socketID uint32, bytesIn, bytesOut int64) {
+	EmitEvent(Event{Event: EventSocketClosed, Socket: fmt.Sprintf("%08x", socketID), BytesIn: bytesIn, BytesOut: bytesOut})
+}
@@ -0,0 +1,96 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// User-facing messages are written in English in the code. Tr looks each one
+// up by that text in the catalog of the selected language and falls back to
+// English for anything the catalog lacks. Debug logs are not translated.
+
+// Supported languages for SetLang.
+const (
+	LangEnglish            = "en"
+	LangTraditionalChinese = "zh-TW"
+)
+
+// catalogs maps each supported non-English language to its messages.
+var catalogs = map[string]map[string]string{
+	LangTraditionalChinese: zhTW,
+}
+
+// catalog is the selected language's catalog; nil means English.
+var catalog atomic.Pointer[map[string]string]
+
+// ParseLang normalizes a language tag or locale name such as "zh-TW",
+// "zh_TW.UTF-8", "zh-Hant" or "en_US" to a supported language.
+func ParseLang(s string) (string, error) {
+	tag := strings.ToLower(strings.ReplaceAll(s, "_", "-"))
+	if i := strings.IndexAny(tag, ".@"); i >= 0 {
+		tag = tag[:i] // drop encoding and modifier, e.g. ".UTF-8"
+	}
+
+	switch {
+	case tag == "en" || strings.HasPrefix(tag, "en-") || tag == "c" || tag == "posix":
+		return LangEnglish, nil
+	case tag == "zh-tw" || tag == "zh-hk" || tag == "zh-mo" || strings.HasPrefix(tag, "zh-hant"):
+		return LangTraditionalChinese, nil
+	default:
+		return "", fmt.Errorf("unsupported language %q (want en or zh-TW)", s)
+	}
+}
+
+// DetectLang returns the language named by the first of LC_ALL, LC_MESSAGES
+// and LANG that is set, or English if it is not supported.
+func DetectLang() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			if lang, err := ParseLang(v); err == nil {
+				return lang
+			}
+			return LangEnglish
+		}
+	}
+	return LangEnglish
+}
+
+// SetLang selects the language of user-facing output (see ParseLang).
+func SetLang(lang string) {
+	if c, ok := catalogs[lang]; ok {
+		catalog.Store(&c)
+	} else {
+		catalog.Store(nil)
+	}
+}
+
+// Catalog returns a copy of the catalog for lang, keyed by the English
+// message, or nil for English and unsupported languages.
+func Catalog(lang string) map[string]string {
+	c, ok := catalogs[lang]
+	if !ok {
+		return nil
+	}
+	out := make(map[string]string, len(c))
+	for k, v := range c {
+		out[k] = v
+	}
+	return out
+}
+
+// Tr returns msg in the selected language.
+func Tr(msg string) string {
+	if c := catalog.Load(); c != nil {
+		if t, ok := (*c)[msg]; ok {
+			return t
+		}
+	}
+	return msg
+}
+
+// Trf formats according to the translation of format.
+func Trf(format string, args ...interface{}) string {
+	return fmt.Sprintf(Tr(format), args...)
+}
@@ -0,0 +1,396 @@
+package util
+
+// zhTW is the Traditional Chinese catalog, keyed by the English message.
+var zhTW = map[string]string{
+	// Prompts and banners
+	"Host  — Expose a local service":                       "主機 — 分享本機服務",
+	"Client — Connect to a remote host":                    "客戶端 — 連線到遠端主機",
+	"Select your role":                                     "請選擇角色",
+	"Target port to forward (1 ~ 65535)":                   "要轉發的目標連接埠 (1 ~ 65535)",
+	"Local port for virtual service (1 ~ 65535)":           "虛擬服務的本機連接埠 (1 ~ 65535)",
+	"WebSocket URL (e.g. wss://***.asse.devtunnels.ms/ws)": "WebSocket 網址 (例如 wss://***.asse.devtunnels.ms/ws)",
+	"Select the target port to forward":                    "請選擇要轉發的目標連接埠",
+	"Share with your peer":                                 "分享給對方",
+	"Copied to clipboard.":                                 "已複製到剪貼簿。",
+	"Room code or WebSocket URL (e.g. blue-falcon-421573)": "房間代碼或 WebSocket 網址（例如 blue-falcon-421573）",
+	"Or just tell your peer the code %s.":                  "或直接告訴對方代碼 %s。",
+	"opening a room on the relay...":                       "正在中繼伺服器上開啟房間...",
+	"waiting for the client on the signaling channel...":   "正在信令通道上等待客戶端...",
+	"failed to open a room on the relay":                   "無法在中繼伺服器上開啟房間",
+	"room %s open on the relay — waiting for client...":    "已在中繼伺服器上開啟房間 %s — 等待客戶端中...",
+	"Allow once":                           "允許一次",
+	"Allow always":                         "一律允許",
+	"Deny once":                            "拒絕一次",
+	"Deny always":                          "一律拒絕",
+	"a client without a key":               "未提供金鑰的客戶端",
+	"Allow %s to use service %s?":          "允許 %s 使用服務 %s？",
+	"the client":                           "客戶端",
+	"Let %s switch the target to port %d?": "允許 %s 將目標切換到連接埠 %d？",
+	"Let %s connect to port %d of the target's host?":     "允許 %s 連線到目標主機的連接埠 %d？",
+	"failed to create a room code: %v":                    "無法產生房間代碼：%v",
+	"tunnel closed — waiting for a new client in room %s": "通道已關閉 — 正在房間 %s 等待新的客戶端",
+	"tunnel closed — waiting for a new client on %s":      "通道已關閉 — 正在 %s 等待新的客戶端",
+	"invalid -relay: %v":                                  "無效的 -relay：%v",
+	"invalid -mqtt: %v":                                   "無效的 -mqtt：%v",
+	"-mqtt cannot be combined with -offerFile":            "-mqtt 不能與 -offerFile 同時使用",
+	"-mqtt, -matrix and -drop cannot be combined with -grpc, -expose, -publicUrl, -wsListen, -wsPort, -queue or -statusPage (there is no WS server)": "-mqtt、-matrix 與 -drop 不能與 -grpc、-expose、-publicUrl、-wsListen、-wsPort、-queue 或 -statusPage 同時使用（沒有 WS 伺服器）",
+	"anyone who can read the MQTT topic sees the session descriptions — consider -pin":                                                               "任何能讀取該 MQTT 主題的人都能看到會話描述 — 建議使用 -pin",
+	"room codes can be guessed — picking a PIN for clients to give, as with -pin auto":                                                               "房間代碼可被猜中 — 已自動選取 PIN 供用戶端輸入，如同 -pin auto",
+	"invalid -matrix: %v": "無效的 -matrix：%v",
+	"-matrix needs the access token of a Matrix account (-matrixToken or ROJ1_MATRIX_TOKEN)":                        "-matrix 需要 Matrix 帳號的存取權杖（-matrixToken 或 ROJ1_MATRIX_TOKEN）",
+	"-matrix cannot be combined with -offerFile or -mqtt":                                                           "-matrix 不能與 -offerFile 或 -mqtt 同時使用",
+	"the Matrix room's members and homeservers see the session descriptions — consider -pin":                        "該 Matrix 聊天室的成員與主伺服器都能看到會話描述 — 建議使用 -pin",
+	"Copy this line and send it to your peer; they need ROJ1_MATRIX_TOKEN set to their own account's access token.": "複製此行並傳送給對方；對方需將 ROJ1_MATRIX_TOKEN 設為自己帳號的存取權杖。",
+	"Copied to clipboard. Your peer needs ROJ1_MATRIX_TOKEN set to their own account's access token.":               "已複製到剪貼簿。對方需將 ROJ1_MATRIX_TOKEN 設為自己帳號的存取權杖。",
+	"invalid -drop: %v": "無效的 -drop：%v",
+	"-drop needs a GitHub token allowed to edit the gist (-dropToken or ROJ1_DROP_TOKEN)":                                                                                  "-drop 需要可編輯該 gist 的 GitHub 權杖（-dropToken 或 ROJ1_DROP_TOKEN）",
+	"-drop needs AWS credentials for the bucket (AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY)":                                                                             "-drop 需要該儲存貯體的 AWS 憑證（AWS_ACCESS_KEY_ID 與 AWS_SECRET_ACCESS_KEY）",
+	"-drop cannot be combined with -offerFile, -mqtt or -matrix":                                                                                                           "-drop 不能與 -offerFile、-mqtt 或 -matrix 同時使用",
+	"anyone who can read the dead drop sees the session descriptions — consider -pin":                                                                                      "任何能讀取該投遞點的人都能看到會話描述 — 建議使用 -pin",
+	"Copy this line and send it to your peer; they need their own credentials for the drop.":                                                                               "複製此行並傳送給對方；對方需要自己的投遞點憑證。",
+	"Copied to clipboard. Your peer needs their own credentials for the drop.":                                                                                             "已複製到剪貼簿。對方需要自己的投遞點憑證。",
+	"-relay cannot be combined with -expose, -publicUrl, -wsListen, -wsPort, -grpc, -mqtt, -matrix, -drop, -offerFile, -statusPage or -wsPath (clients join by room code)": "-relay 不能與 -expose、-publicUrl、-wsListen、-wsPort、-grpc、-mqtt、-matrix、-drop、-offerFile、-statusPage 或 -wsPath 同時使用（客戶端以房間代碼加入）",
+	"failed to start the relay: %v": "無法啟動中繼伺服器：%v",
+	"relay listening on %s — hosts and clients use -relay ws://<this machine>:%d": "中繼伺服器正在 %s 監聽 — 主機與客戶端請使用 -relay ws://<本機>:%d",
+	"relay stopped: %v": "中繼伺服器已停止：%v",
+	"gathering ICE candidates for the offer file...": "正在為邀請檔收集 ICE 候選...",
+	"failed to create the offer":                     "無法建立邀請",
+	"failed to write the offer file":                 "無法寫入邀請檔",
+	"offer written to %s — send it to your peer, and put the answer they send back at %s":                           "邀請已寫入 %s — 請傳送給對方，並將對方回傳的回應檔放在 %s",
+	"waiting for the answer file at %s...":                                                                          "正在等待 %s 的回應檔...",
+	"failed while waiting for the answer file":                                                                      "等待回應檔時失敗",
+	"answer received — connecting...":                                                                               "已收到回應 — 連線中...",
+	"incompatible peer version":                                                                                     "對方版本不相容",
+	"ignoring the answer file: %v":                                                                                  "忽略回應檔：%v",
+	"gathering ICE candidates for the answer file...":                                                               "正在為回應檔收集 ICE 候選...",
+	"failed to create the answer":                                                                                   "無法建立回應",
+	"failed to write the answer file":                                                                               "無法寫入回應檔",
+	"answer written to %s — send it back to your peer":                                                              "回應已寫入 %s — 請傳回給對方",
+	"waiting for the host to use the answer...":                                                                     "正在等待主機使用回應...",
+	"-offerFile cannot be combined with -persistent, -direct, -quic, -multipath or -authorizedKeys":                 "-offerFile 不能與 -persistent、-direct、-quic、-multipath 或 -authorizedKeys 同時使用",
+	"-offerFile cannot be combined with -expose or -publicUrl (there is no WS server to share)":                     "-offerFile 不能與 -expose 或 -publicUrl 同時使用（沒有可分享的 WS 伺服器）",
+	"-grpc cannot be combined with -offerFile (there is no signaling server)":                                       "-grpc 不能與 -offerFile 同時使用（沒有信令伺服器）",
+	"-grpc cannot be combined with -expose (tunnel clients publish WebSockets); use -publicUrl with a grpcs:// URL": "-grpc 不能與 -expose 同時使用（通道客戶端只發布 WebSocket）；請改用 -publicUrl 搭配 grpcs:// 網址",
+	"-answerFile requires -offerFile":                                                                               "-answerFile 需要搭配 -offerFile",
+	"-offerFile and -answerFile must be different files":                                                            "-offerFile 與 -answerFile 必須是不同的檔案",
+	"-pin must be at least %d characters":                                                                           "-pin 至少需要 %d 個字元",
+	"-pin cannot be combined with -offerFile (offer files do not go through a relay)":                               "-pin 不能與 -offerFile 同時使用（offer 檔案不經過中繼）",
+	"-pin auto only works on the host — give the PIN the host shows":                                                "-pin auto 只能用於主機端 — 請輸入主機顯示的 PIN",
+	"failed to pick a PIN: %v":                                                                                      "無法產生 PIN：%v",
+	"Tunnel health: %s":                                                                                             "通道狀態：%s",
+	"Copy this line and send it to your peer.":                                                                      "請複製這一行並傳送給對方。",
+	"Forward port %d (Public) and replace <forwarded-url> with the Forwarded URL.":                                  "請轉發連接埠 %d (公開)，並將 <forwarded-url> 換成轉發後的網址。",
+
+	// Signaling
+	"starting WebSocket signaling server...":                           "正在啟動 WebSocket 信令伺服器...",
+	"failed to start WebSocket server":                                 "無法啟動 WebSocket 伺服器",
+	"WebSocket server listening on port %d — waiting for client...":    "WebSocket 伺服器正在監聽連接埠 %d — 等待客戶端連線...",
+	"gRPC server listening on port %d — waiting for client...":         "gRPC 伺服器正在監聽連接埠 %d — 等待客戶端連線...",
+	"failed while waiting for client connection":                       "等待客戶端連線時發生錯誤",
+	"client connected — negotiating WebRTC...":                         "客戶端已連線 — 正在協商 WebRTC...",
+	"failed to create Transport":                                       "無法建立傳輸層",
+	"failed to send direct offer":                                      "無法傳送直連提議",
+	"failed to send Offer":                                             "無法傳送 Offer",
+	"tunnel negotiation failed":                                        "通道協商失敗",
+	"tunnel established via %s":                                        "已透過 %s 建立通道",
+	"connecting to Host via WebSocket...":                              "正在透過 WebSocket 連線到主機...",
+	"connecting to Host via the signaling channel...":                  "正在透過信令通道連線到主機...",
+	"failed to connect to WebSocket server":                            "無法連線到 WebSocket 伺服器",
+	"WebSocket connected — negotiating WebRTC...":                      "WebSocket 已連線 — 正在協商 WebRTC...",
+	"WebSocket connected — checking the PIN...":                        "WebSocket 已連線 — 正在核對 PIN...",
+	"the host is busy — number %d in line...":                          "主機忙碌中 — 你排在第 %d 位...",
+	"the host is free — connecting...":                                 "輪到你了 — 正在連線...",
+	"client queued — %d waiting":                                       "客戶端已排入佇列 — 共 %d 位等待中",
+	"WebSocket unavailable (%v) — signaling over HTTP polling instead": "WebSocket 無法使用（%v）— 改以 HTTP 輪詢進行信令交換",
+	"client connected — checking the PIN...":                           "客戶端已連線 — 正在核對 PIN...",
+	"PIN check failed":                                                 "PIN 核對失敗",
+	"failed to send hello":                                             "無法傳送版本資訊",
+	"the peer runs roj1 v%s but this is v%s — major versions differ and the tunnel may corrupt data; upgrade both sides (-strictVersion refuses such peers)": "對方執行的是 roj1 v%s，本機為 v%s — 主要版本不同，通道可能損毀資料；請將雙方升級 (-strictVersion 會拒絕這類對方)",
+	"Closing WebSocket server...": "正在關閉 WebSocket 伺服器...",
+	"Closing gRPC server...":      "正在關閉 gRPC 伺服器...",
+
+	// Peer authentication
+	"failed to create challenge":                           "無法產生驗證挑戰",
+	"failed to create nonce":                               "無法產生工作階段隨機值",
+	"client connected — waiting for it to authenticate...": "客戶端已連線 — 正在等待其完成驗證...",
+	"client authentication failed":                         "客戶端驗證失敗",
+	"client authenticated — negotiating WebRTC...":         "客戶端已通過驗證 — 正在協商 WebRTC...",
+	"client authenticated as %s (%s)":                      "客戶端已驗證為 %s (%s)",
+	"refused client key %s — to authorize it, add this line to the authorized keys file:\n  %s":       "已拒絕客戶端金鑰 %s — 若要授權，請將下列這行加入授權金鑰檔案：\n  %s",
+	"first connection to %s — its key %s is now trusted; later connections must present the same key": "首次連線到 %s — 已信任其金鑰 %s；之後的連線必須出示相同的金鑰",
+	"failed to load identity %s: %v — continuing without one":                                         "無法載入身分金鑰 %s：%v — 將在沒有身分金鑰的情況下繼續",
+	"failed to load identity %s: %v":                                            "無法載入身分金鑰 %s：%v",
+	"created identity %s — fingerprint %s":                                      "已建立身分金鑰 %s — 指紋 %s",
+	"created identity %s":                                                       "已建立身分金鑰 %s",
+	"fingerprint %s — add the line above to the host's authorized keys file":    "指紋 %s — 請將上面這行加入主機的授權金鑰檔案",
+	"%s lists no keys — every client will be refused":                           "%s 中沒有任何金鑰 — 所有客戶端都會被拒絕",
+	"the peer may not connect to %s — its connections will be refused":          "對方無權連線到 %s — 其連線都會被拒絕",
+	"the session ends in %v — the tunnel will then be closed":                   "工作階段將在 %v 後結束 — 屆時通道會關閉",
+	"session limit reached — closing the tunnel":                                "已達工作階段時間上限 — 正在關閉通道",
+	"%d%% of the %s transfer quota used":                                        "已使用 %d%% 的 %s 傳輸配額",
+	"transfer quota of %s exceeded — forwarding paused until the tunnel closes": "已超出 %s 的傳輸配額 — 在通道關閉前暫停轉發",
+	"transfer quota of %s exceeded":                                             "已超出 %s 的傳輸配額",
+	"%s of the %s monthly transfer quota used":                                  "已使用 %s / %s 的每月傳輸配額",
+
+	// Tunnel lifecycle
+	"P2P tunnel established — forwarding traffic to %s":                     "P2P 通道已建立 — 正在將流量轉發到 %s",
+	"P2P tunnel established — forwarding traffic to Host":                   "P2P 通道已建立 — 正在將流量轉發到主機",
+	"virtual service started, listening on %s":                              "虛擬服務已啟動，正在監聽 %s",
+	"connected to %s on the peer's port %d":                                 "已連線至對方連接埠 %[2]d 上的 %[1]s",
+	"connected to the peer's port %d":                                       "已連線至對方的連接埠 %d",
+	"service %s bound, listening on %s":                                     "服務 %s 已綁定，正在監聽 %s",
+	"refused the peer's request for service %s: %v":                         "已拒絕對方使用服務 %s 的請求：%v",
+	"the peer is using service %s":                                          "對方正在使用服務 %s",
+	"Message from the peer":                                                 "來自對方的訊息",
+	"configuration reloaded":                                                "已重新載入設定",
+	"configuration reloaded from %s":                                        "已從 %s 重新載入設定",
+	"failed to reload the configuration: %v":                                "無法重新載入設定：%v",
+	"invalid -config %s: %v":                                                "無效的 -config %s：%v",
+	"%s, line %d: unknown setting %q":                                       "%s 第 %d 行：未知的設定 %q",
+	"-%s changed in %s — restart roj1 to apply it":                          "%[2]s 中的 -%[1]s 已變更 — 需重新啟動 roj1 才會套用",
+	"the client's key is no longer in -authorizedKeys — closing the tunnel": "客戶端的金鑰已不在 -authorizedKeys 中 — 正在關閉通道",
+	"invalid -otlp: %v":                                                     "無效的 -otlp：%v",
+	"OpenTelemetry export disabled: %v":                                     "已停用 OpenTelemetry 匯出：%v",
+	"connected in %s — %s":                                                  "連線耗時 %s — %s",
+	"first message from the peer %s after the DataChannel opened":           "DataChannel 開啟後 %s 收到對方的第一則訊息",
+	"%d ms":             "%d 毫秒",
+	"signaling connect": "信令連線",
+	"SDP exchange":      "SDP 交換",
+	"ICE gathering":     "ICE 收集",
+	"ICE checks":        "ICE 檢查",
+	"DataChannel open":  "DataChannel 開啟",
+	"peer ready":        "對方就緒",
+	"gathering ICE candidates — %d found...":                                               "正在收集 ICE 候選 — 已找到 %d 個...",
+	"checking connectivity between %d local and %d remote candidates...":                   "正在檢查 %d 個本機與 %d 個遠端候選之間的連通性...",
+	"ICE connected via %s — securing the connection...":                                    "ICE 已經由 %s 連通 — 正在加密連線...",
+	"establishment cancelled — everything it started has been shut down":                   "已取消建立連線 — 已關閉所有啟動的資源",
+	"message sent to the peer":                                                             "已將訊息傳送給對方",
+	"failed to send the message: %v":                                                       "無法傳送訊息：%v",
+	"refused the peer's request to forward to port %d: %v":                                 "已拒絕對方轉發到連接埠 %d 的請求：%v",
+	"now forwarding new connections to %s, as the peer asked":                              "已依對方要求，將新連線轉發到 %s",
+	"failed to change the target port: %v":                                                 "無法變更目標連接埠：%v",
+	"the host now forwards new connections to port %d":                                     "主機現在將新連線轉發到連接埠 %d",
+	"the host did not answer the request for service %s — it may predate service catalogs": "主機未回應服務 %s 的請求 — 主機版本可能不支援服務目錄",
+	"cannot use service %s: %v":                                                            "無法使用服務 %s：%v",
+	"the host did not announce its services: %v":                                           "主機未公布其服務：%v",
+	"the host offers no named services, only its main target":                              "主機未提供具名服務，只有主要目標",
+	"NAME\tPORT\tDESCRIPTION":                                                              "名稱\t連接埠\t說明",
+	"invalid -use: %v":                                                                     "無效的 -use：%v",
+	"invalid -map: %v":                                                                     "無效的 -map：%v",
+	"invalid -portBusy: must be fail, wait or next":                                        "無效的 -portBusy：必須為 fail、wait 或 next",
+	"local port %d is taken — listening on %d instead":                                     "本機連接埠 %d 已被占用 — 改為監聽 %d",
+	"local port %d is taken — retrying for up to %v":                                       "本機連接埠 %d 已被占用 — 將持續重試最多 %v",
+	"invalid -drainGrace: must not be negative":                                            "無效的 -drainGrace：不可為負數",
+	"waiting up to %v for %d connections to finish — press Ctrl+C again to cut them":       "最多等待 %v 讓 %d 個連線完成 — 再按一次 Ctrl+C 立即中斷",
+	"grace period over — cut %d connections that had not finished":                         "等待時間已到 — 已中斷 %d 個尚未完成的連線",
+	"all connections finished":                                                             "所有連線皆已完成",
+	"[%08x] %s: %s in, %s out, idle %v":                                                    "[%08x] %s：流入 %s，流出 %s，閒置 %v",
+	"draining %d connections:":                                                             "正在等待 %d 個連線結束：",
+	"idle %v":                                                                              "閒置 %v",
+	"socket activation: %v":                                                                "socket activation：%v",
+	"using the socket systemd passed, %s":                                                  "使用 systemd 傳入的 socket，%s",
+	"systemd passed %d sockets — only the first is used":                                   "systemd 傳入了 %d 個 socket — 只會使用第一個",
+	"the client proved no key, so this decision is not remembered":                         "客戶端未證明金鑰，因此不會記住此決定",
+	"failed to record the decision: %v":                                                    "無法記錄此決定：%v",
+	"virtual service accept error: %v":                                                     "虛擬服務接受連線時發生錯誤：%v",
+	"successfully closed tunnel connection":                                                "已成功關閉通道連線",
+	"tunnel closed — waiting for a new client on port %d":                                  "通道已關閉 — 正在連接埠 %d 等待新的客戶端",
+	"tunnel connection lost: %v":                                                           "通道連線中斷：%v",
+	"health endpoint listening on %s (%s, %s)":                                             "健康檢查端點正在監聽 %s (%s、%s)",
+	"failed to start health endpoint: %v":                                                  "無法啟動健康檢查端點：%v",
+	"health endpoint stopped: %v":                                                          "健康檢查端點已停止：%v",
+	"pprof endpoint listening on http://%s/debug/pprof/":                                   "pprof 端點正在監聽 http://%s/debug/pprof/",
+	"failed to start pprof endpoint: %v":                                                   "無法啟動 pprof 端點：%v",
+	"pprof endpoint stopped: %v":                                                           "pprof 端點已停止：%v",
+	"second signal received — exiting without a graceful shutdown":                         "再次收到訊號 — 不等待正常關閉，直接結束",
+	"failed to establish tunnel: %v":                                                       "無法建立通道：%v",
+	"failed to handle tunnel connection: %v":                                               "處理通道連線時發生錯誤：%v",
+	"failed to run %s: %v":                                                                 "無法執行 %s：%v",
+	"%s failed: %v":                                                                        "%s 執行失敗：%v",
+	"failed to record the session in %s: %v":                                               "無法將工作階段記錄到 %s：%v",
+	"DataChannel closed":                                                                   "DataChannel 已關閉",
+	"failed to detach DataChannel %q: %v":                                                  "無法分離 DataChannel %q：%v",
+	"PeerConnection state changed → %s":                                                    "PeerConnection 狀態變更 → %s",
+	"PeerConnection entered failed state — closing transport":                              "PeerConnection 進入失敗狀態 — 正在關閉傳輸層",
+	"no ICE candidate pair worked — closing transport":                                     "沒有任何可用的 ICE 候選配對 — 正在關閉傳輸層",
+	"the host name in the URL does not resolve — check it for typos":                       "URL 中的主機名稱無法解析 — 請檢查是否有拼字錯誤",
+	"the host name in the URL could not be looked up — check this machine's network and DNS settings":                                                                                                                  "無法查詢 URL 中的主機名稱 — 請檢查本機的網路與 DNS 設定",
+	"the server turned the connection away as unauthorized — check that both sides use the same -pin, and any credentials a proxy or relay in between needs":                                                           "伺服器以未授權為由拒絕連線 — 請確認雙方使用相同的 -pin，以及中間的代理或中繼所需的憑證",
+	"nothing answers at that URL — check its path, or the room code with -relay":                                                                                                                                       "該 URL 沒有任何回應 — 請檢查路徑，或 -relay 使用的房間代碼",
+	"nothing is listening at that address — check that the host is running and the port is the one it printed":                                                                                                         "該位址沒有任何程式在監聽 — 請確認主機端正在執行，且連接埠與其顯示的相同",
+	"the PINs differ — both sides must use the same -pin, or neither":                                                                                                                                                  "PIN 不一致 — 雙方必須使用相同的 -pin，或都不使用",
+	"the host's key is not the one pinned on first use — if the host was reinstalled, remove its line from the -knownHosts file; otherwise someone may be impersonating it":                                            "主機的金鑰與首次連線時記錄的不同 — 若主機已重新安裝，請從 -knownHosts 檔案中移除其記錄；否則可能有人冒充該主機",
+	"the host did not accept this client's key — send the line 'roj1 key' prints to the host's operator, for its -authorizedKeys file":                                                                                 "主機未接受此客戶端的金鑰 — 請將 'roj1 key' 輸出的內容傳給主機操作者，加入其 -authorizedKeys 檔案",
+	"the URL leads to a sign-in page — a dev tunnel must allow anonymous access (devtunnel host --allow-anonymous, as -expose devtunnel does)":                                                                         "此網址導向登入頁面 — dev tunnel 必須允許匿名存取（devtunnel host --allow-anonymous，-expose devtunnel 即是如此）",
+	"the server redirects elsewhere, which WebSockets do not follow — use the URL it redirects to, with wss:// for https://":                                                                                           "伺服器將連線重新導向他處，而 WebSocket 不會跟隨 — 請改用其導向的網址，https:// 換成 wss://",
+	"a proxy in between drops the WebSocket upgrade — it must pass the Upgrade and Connection headers on (nginx: proxy_http_version 1.1; proxy_set_header Upgrade $http_upgrade; proxy_set_header Connection upgrade)": "中間的代理伺服器丟棄了 WebSocket 升級 — 它必須轉送 Upgrade 與 Connection 標頭（nginx：proxy_http_version 1.1; proxy_set_header Upgrade $http_upgrade; proxy_set_header Connection upgrade）",
+	"the proxy in front of the host cannot reach it — check that the host is still running and the proxy forwards to its WS port":                                                                                      "主機前方的代理伺服器無法連到主機 — 請確認主機仍在執行，且代理伺服器轉送至其 WS 連接埠",
+	"a proxy in between holds the WebSocket upgrade back — turn off its buffering for this path (nginx: proxy_buffering off), or put the host's URL behind one that passes WebSockets on":                              "中間的代理伺服器扣住了 WebSocket 升級 — 請關閉它對此路徑的緩衝（nginx：proxy_buffering off），或改用會轉送 WebSocket 的代理伺服器",
+	"the two sides run incompatible versions of roj1 — upgrade the older one":                                                                                                                                          "雙方執行的 roj1 版本不相容 — 請升級較舊的一方",
+	"no public address was learnt from the STUN servers, so UDP is most likely blocked on this network — allow outbound UDP, or try -direct when both sides share a network; 'roj1 check' tests this":                  "未能從 STUN 伺服器取得公開位址，此網路很可能封鎖了 UDP — 請允許對外 UDP，或在雙方位於同一網路時改用 -direct；可用 'roj1 check' 檢測",
+	"no network path between the two sides worked — both may be behind NATs that keep each other out; run 'roj1 check' on each side":                                                                                   "雙方之間沒有可用的網路路徑 — 兩端可能都位於互相阻擋的 NAT 之後；請在兩端各執行 'roj1 check'",
+	"stuck at: %s":             "卡在：%s",
+	"stuck at: %s, after %s":   "卡在：%s，先前完成 %s",
+	"waiting for a client":     "等待用戶端",
+	"gathering candidates":     "收集候選位址",
+	"checking candidate pairs": "檢查候選位址配對",
+	"connected":                "已連線",
+	"ICE never started: no session description was exchanged":             "ICE 未曾開始：未交換任何工作階段描述",
+	"ICE %s: %d local candidates (%d server-reflexive), %d from the peer": "ICE %s：本機 %d 個候選位址（%d 個伺服器反射），對方 %d 個",
+	"ICE pair: %s": "ICE 配對：%s",
+	"transport failed (%v) — failing over to standby transport": "傳輸層失敗 (%v) — 正在切換到備援傳輸層",
+	"direct transport unavailable: %v":                          "無法使用直連傳輸：%v",
+	"stream transport read error: %v":                           "串流傳輸讀取錯誤：%v",
+	"failed to decode packet: %v":                               "無法解碼封包：%v",
+	"failed to send packet (socketID=%08x, type=%d): %v":        "無法傳送封包 (socketID=%08x, type=%d)：%v",
+	"ignoring unexpected DataChannel %q":                        "忽略非預期的 DataChannel %q",
+
+	// Connections
+	"[%08x] TCP dial failed: %v": "[%08x] TCP 連線失敗：%v",
+	"[%08x] socket still registered %v after it started closing — possible leak":                         "[%08x] socket 開始關閉 %v 後仍未移除 — 可能發生洩漏",
+	"[%08x] socket stalled for %v: waiting for missing packets %s, %d packets (%s) buffered behind them": "[%08x] socket 已停滯 %v：等待遺失的封包 %s，其後已緩衝 %d 個封包（%s）",
+	"[%08x] socket stalled for %v: %d packets (%s) waiting for the local connection to read":             "[%08x] socket 已停滯 %v：%d 個封包（%s）等待本機連線讀取",
+	"[%08x] peer asked for packets %d-%d again, but only %d of them are still kept":                      "[%08x] 對方要求重送封包 %d-%d，但其中僅 %d 個仍保留",
+	"[%08x] TCP read error: %v":                                          "[%08x] TCP 讀取錯誤：%v",
+	"[%08x] TCP write error: %v":                                         "[%08x] TCP 寫入錯誤：%v",
+	"[%08x] DATA before CONNECT, closing":                                "[%08x] 在 CONNECT 之前收到 DATA，正在關閉",
+	"[%08x] failed to deliver packet to newly created socket":            "[%08x] 無法將封包交給新建立的 socket",
+	"[%08x] failed to open socket channel, using the shared channel: %v": "[%08x] 無法開啟 socket 專用通道，改用共用通道：%v",
+	"failed to open a stream for the connection from %s: %v":             "無法為來自 %s 的連線開啟串流：%v",
+	"failed to add %s to %s: %v":                                         "無法將 %[1]s 加入 %[2]s：%[3]v",
+	"failed to remove %s from %s: %v":                                    "無法從 %[2]s 移除 %[1]s：%[3]v",
+	"virtual service reachable at %s":                                    "虛擬服務可透過 %s 連線",
+	"invalid -hostname: %q is not a valid hostname":                      "無效的 -hostname：%q 不是有效的主機名稱",
+	"-tlsSkipVerify requires -tlsTarget":                                 "-tlsSkipVerify 需要搭配 -tlsTarget",
+	"-quicPort and -quicPublic require -quic":                            "-quicPort 與 -quicPublic 需要搭配 -quic",
+	"invalid -quicPort: must be 0~65535":                                 "無效的 -quicPort：必須為 0~65535",
+	"invalid -quicPublic %q (want host:port)":                            "無效的 -quicPublic %q (格式應為 host:port)",
+	"-tlsCert and -tlsKey require -tlsLocal":                             "-tlsCert 與 -tlsKey 需要搭配 -tlsLocal",
+	"-tlsCert and -tlsKey must be given together":                        "-tlsCert 與 -tlsKey 必須同時指定",
+	"invalid -tlsCert or -tlsKey: %v":                                    "無效的 -tlsCert 或 -tlsKey：%v",
+	"invalid -sniMap: %v":                                                "無效的 -sniMap：%v",
+	"invalid -mirror: %v":                                                "無效的 -mirror：%v",
+	"invalid -shape: %v":                                                 "無效的 -shape：%v",
+	"emulating a slower network through the tunnel: %s":                  "正在透過通道模擬較慢的網路：%s",
+	"mirroring connection bytes to %s — the copy may contain passwords, tokens and other secrets": "正在將連線資料鏡像至 %s — 副本可能包含密碼、權杖等機密資訊",
+	"[%08x] mirroring stopped: %v":                                               "[%08x] 已停止鏡像：%v",
+	"serving TLS with a self-signed certificate (SHA-256 %s)":                    "以自簽憑證提供 TLS（SHA-256 %s）",
+	"[%08x] failed to set TCP option: %v":                                        "[%08x] 無法設定 TCP 選項：%v",
+	"[%08x] host did not answer CONNECT within %v, closing":                      "[%08x] 主機未在 %v 內回應 CONNECT，正在關閉",
+	"[%08x] peer reassembler buffers exceeded the %d-byte quota, closing socket": "[%08x] 對方的重組緩衝區超過 %d 位元組配額，正在關閉 socket",
+	"[%08x] peer violated the protocol, dropping packet: %v":                     "[%08x] 對方違反協定，丟棄封包：%v",
+	"[%08x] inbox full, closing socket rather than losing data":                  "[%08x] 收件佇列已滿，關閉 socket 以免遺失資料",
+	"[%08x] reassembler buffer exceeded its limit, treating as disconnection":    "[%08x] 重組緩衝區超過上限，視為斷線",
+	"peer sent %d invalid packets, closing the tunnel":                           "對方傳送了 %d 個無效封包，正在關閉通道",
+
+	// Targets
+	"failed to resolve target %s: %v": "無法解析目標 %s：%v",
+	"target %s now resolves to %v":    "目標 %s 現在解析為 %v",
+	"nothing is listening on %s — clients will be disconnected until the service is started (%v)": "%s 上沒有服務在監聽 — 在服務啟動前，客戶端連線都會被中斷 (%v)",
+	"failed to list listening ports: %v": "無法列出監聽中的連接埠：%v",
+	"no listening TCP ports found":       "找不到監聽中的 TCP 連接埠",
+	"no port selected":                   "未選擇連接埠",
+	"failed to run -wakeCommand: %v":     "無法執行 -wakeCommand：%v",
+	"target is down — started %q":        "目標服務未啟動 — 已執行 %q",
+
+	// Statistics
+	"In: %s/s | Out: %s/s | Conn: %2d↑ %2d↓ | Mem: %s":                  "入：%s/s | 出：%s/s | 連線：%2d↑ %2d↓ | 記憶體：%s",
+	"Send buffer: p50 %s | p95 %s | above high-water %4.1fs":            "傳送緩衝：p50 %s | p95 %s | 高於高水位 %4.1f 秒",
+	"Dropped %d inbound packets for closing sockets (%d total)":         "丟棄了 %d 個送往關閉中 socket 的封包 (共 %d 個)",
+	"Dropped %d invalid packets from the peer (%d total)":               "丟棄了 %d 個對方傳來的無效封包 (共 %d 個)",
+	"Retransmitted %d packets the peer had lost (%d total)":             "已重送 %d 個對方遺失的封包（共 %d 個）",
+	"Send queue: p50 %d | p95 %d packets | writers parked %4.1fs":       "傳送佇列：p50 %d | p95 %d 個封包 | 寫入端等待 %4.1f 秒",
+	"Dropped %d outgoing packets at a full send queue (%d total)":       "傳送佇列已滿，丟棄了 %d 個輸出封包 (共 %d 個)",
+	"memory use %s is at the limit of %s — refusing new connections":    "記憶體用量 %s 已達上限 %s — 拒絕新連線",
+	"memory use %s is near the limit of %s — shrinking reorder buffers": "記憶體用量 %s 接近上限 %s — 縮小重組緩衝區",
+	"memory use back to %s — resuming normal operation":                 "記憶體用量已回落至 %s — 恢復正常運作",
+	"Inbound packets throttled for %.1fs by the packet rate quota":      "封包速率配額使輸入封包延遲了 %.1f 秒",
+	"Rejected %d connections over the peer quota (%d total)":            "拒絕了 %d 個超出對方配額的連線 (共 %d 個)",
+	"START\tDURATION\tROLE\tADDRESS\tIN\tOUT\tCONNS\tREASON\tPEER":      "開始\t時長\t角色\t位址\t入\t出\t連線\t原因\t對方",
+	"%d sessions, %v in total — In: %s | Out: %s | Conn: %d":            "共 %d 個工作階段，總計 %v — 入：%s | 出：%s | 連線：%d",
+	"failed to read session history: %v":                                "無法讀取工作階段紀錄：%v",
+	"no sessions recorded in %s":                                        "%s 中沒有任何工作階段紀錄",
+
+	// check and bench
+	"probing STUN servers...":       "正在探測 STUN 伺服器...",
+	"STUN probe aborted":            "STUN 探測已中止",
+	"STUN probe finished":           "STUN 探測完成",
+	"%s: mapped to %s (RTT %v)":     "%s：對應到 %s (RTT %v)",
+	"UDP egress: %v — NAT type: %s": "UDP 對外連線：%v — NAT 類型：%s",
+	"no STUN server answered — UDP is likely blocked on this network":                            "沒有 STUN 伺服器回應 — 這個網路可能封鎖了 UDP",
+	"only one STUN server answered — NAT behaviour could not be determined":                      "只有一個 STUN 伺服器回應 — 無法判斷 NAT 行為",
+	"symmetric NAT detected — a direct P2P connection is unlikely":                               "偵測到對稱式 NAT — 不太可能建立直接的 P2P 連線",
+	"direct P2P connection is likely to succeed from this side":                                  "從這一端建立直接 P2P 連線應該可以成功",
+	"it can still work if the peer has an open or full-cone NAT; otherwise try another network":  "若對方為開放或全錐形 NAT 仍可能成功；否則請換一個網路",
+	"try another network (e.g. a mobile hotspot) or ask the administrator to allow outbound UDP": "請換一個網路 (例如手機熱點)，或請管理員允許對外的 UDP",
+	"sending %d MiB over %d connection(s)...":                                                    "正在透過 %[2]d 條連線傳送 %[1]d MiB...",
+	"benchmark failed":   "效能測試失敗",
+	"benchmark finished": "效能測試完成",
+	"%d MiB over %d connection(s) in %v — %.1f MiB/s": "%[2]d 條連線傳送 %[1]d MiB，耗時 %[3]v — %.1[4]f MiB/s",
+
+	// Usage errors
+	"unknown command %q":                                                  "未知的指令 %q",
+	"usage: roj1 completion bash|zsh|fish":                                "用法：roj1 completion bash|zsh|fish",
+	"invalid -role: must be 'host' or 'client'":                           "無效的 -role：必須是 'host' 或 'client'",
+	"invalid or missing -port (must be 1~65535)":                          "-port 無效或未指定 (必須為 1~65535)",
+	"invalid or missing -port (must be 1~65535, or 0 for any free port)":  "-port 無效或未指定 (必須為 1~65535，或以 0 自動選擇可用連接埠)",
+	"virtual service on local port %d — connect to %s":                    "虛擬服務使用本機連接埠 %d — 請連線至 %s",
+	"invalid port %q (must be 1~65535)":                                   "無效的連接埠 %q (必須為 1~65535)",
+	"invalid port number: must be 1 ~ 65535":                              "無效的連接埠號碼：必須為 1 ~ 65535",
+	"invalid input: please enter a valid host or URL":                     "輸入無效：請輸入有效的主機或網址",
+	"missing -wsUrl for client role":                                      "客戶端角色缺少 -wsUrl",
+	"-oneshot requires -role (interactive prompts are disabled)":          "-oneshot 需要搭配 -role (互動式提示已停用)",
+	"-oneshot and -persistent cannot be combined":                         "-oneshot 與 -persistent 不能同時使用",
+	"invalid -queue: must not be negative":                                "無效的 -queue：不可為負數",
+	"-queue requires -persistent (the host exits after its first tunnel)": "-queue 需要搭配 -persistent（否則主機在第一條通道後即結束）",
+	"-queue cannot be combined with -relay (a room takes one client)":     "-queue 不能與 -relay 同時使用（一個房間只接受一個客戶端）",
+	"-pick cannot be combined with -oneshot (it prompts for the port)":    "-pick 不能與 -oneshot 同時使用 (它會提示選擇連接埠)",
+	"-noTty requires -role (interactive prompts are disabled)":            "-noTty 需要搭配 -role (互動式提示已停用)",
+	"-pick cannot be combined with -noTty (it prompts for the port)":      "-pick 不能與 -noTty 同時使用 (它會提示選擇連接埠)",
+	"invalid %s: %v": "無效的 %s：%v",
+	"-strict cannot be combined with -multipath (packets may arrive before CONNECT)": "-strict 不能與 -multipath 同時使用 (封包可能比 CONNECT 先到)",
+	"invalid -bond: %v":                             "無效的 -bond：%v",
+	"invalid -connectTimeout: must not be negative": "無效的 -connectTimeout：不可為負數",
+	"invalid -highWater/-lowWater: %v":              "無效的 -highWater/-lowWater：%v",
+	"invalid -iceNetwork: %v":                       "無效的 -iceNetwork：%v",
+	"invalid -lang: %v":                             "無效的 -lang：%v",
+	"invalid -maxSession: must not be negative":     "無效的 -maxSession：不可為負數",
+	"invalid -wakeTimeout: must not be negative":    "無效的 -wakeTimeout：不可為負數",
+	"-wakeCommand requires -wakeTimeout (how long to wait for the target to start)": "-wakeCommand 需要搭配 -wakeTimeout (等待目標啟動的時間)",
+	"invalid -quota: %v":      "無效的 -quota：%v",
+	"invalid -reasmMax: %v":   "無效的 -reasmMax：%v",
+	"invalid -reasmTotal: %v": "無效的 -reasmTotal：%v",
+	"invalid -memLimit: %v":   "無效的 -memLimit：%v",
+	"firewall-allow only applies to Windows Firewall — nothing to do on %s":                                                   "firewall-allow 僅適用於 Windows 防火牆 — 在 %s 上無需設定",
+	"failed to locate the roj1 executable: %v":                                                                                "無法找到 roj1 執行檔：%v",
+	"administrator rights are needed to change the firewall — approve the Windows prompt":                                     "變更防火牆需要系統管理員權限 — 請在 Windows 提示中允許",
+	"failed to create the firewall rule: %v":                                                                                  "無法建立防火牆規則：%v",
+	"Windows Firewall now allows incoming connections to %s (%s profiles)":                                                    "Windows 防火牆現已允許 %s 的連入連線（%s 設定檔）",
+	"Windows may ask whether to allow roj1 through the firewall; run 'roj1 firewall-allow' once to set this up ahead of time": "Windows 可能會詢問是否允許 roj1 通過防火牆；執行一次「roj1 firewall-allow」即可預先設定",
+	"Windows refused the port: it may be reserved (see 'netsh interface ipv4 show excludedportrange protocol=tcp') or blocked by security software — choose another port": "Windows 拒絕了此連接埠：它可能已被保留（參見「netsh interface ipv4 show excludedportrange protocol=tcp」）或遭安全軟體封鎖 — 請改用其他連接埠",
+	"another program is already listening on that port — stop it or choose another port":                                                                                  "已有其他程式在監聽此連接埠 — 請停止該程式或改用其他連接埠",
+	"ports below 1024 need root (or CAP_NET_BIND_SERVICE on Linux) — choose a higher port":                                                                                "1024 以下的連接埠需要 root 權限（Linux 上或 CAP_NET_BIND_SERVICE）— 請改用更大的連接埠",
+	"failed to publish the WS port with %s: %v":                                                                                                                           "無法透過 %s 發布 WS 連接埠：%v",
+	"WS port %d published at %s":                                                                         "WS 連接埠 %d 已發布於 %s",
+	"%s exited: %v — the shared URL no longer works":                                                     "%s 已結束：%v — 分享的 URL 已失效",
+	"invalid -expose %q (want one of %s)":                                                                "無效的 -expose %q（應為 %s 之一）",
+	"-expose and -publicUrl cannot be combined":                                                          "-expose 與 -publicUrl 不可同時使用",
+	"invalid -%s: must be a socket ID such as 0000abcd, or all":                                          "無效的 -%s：必須是 socket ID（例如 0000abcd）或 all",
+	"invalid -quotaPeriod: must be 'session' or 'month'":                                                 "無效的 -quotaPeriod：必須是 'session' 或 'month'",
+	"invalid -reasmPolicy: must be 'recover' or 'close'":                                                 "無效的 -reasmPolicy：必須是 'recover' 或 'close'",
+	"-quotaPeriod month requires -history (past sessions count towards the quota)":                       "-quotaPeriod month 需要搭配 -history (過去的工作階段會計入配額)",
+	"invalid -maxViolations: must not be negative":                                                       "無效的 -maxViolations：不可為負數",
+	"invalid -multipath: at most %d interfaces":                                                          "無效的 -multipath：最多 %d 個網路介面",
+	"invalid -output: must be 'text' or 'json'":                                                          "無效的 -output：必須是 'text' 或 'json'",
+	"invalid -publicUrl: %v":                                                                             "無效的 -publicUrl：%v",
+	"invalid -publicUrl: -grpc needs a grpc:// or grpcs:// URL":                                          "無效的 -publicUrl：-grpc 需要 grpc:// 或 grpcs:// 網址",
+	"invalid -resolveInterval: must not be negative":                                                     "無效的 -resolveInterval：不可為負數",
+	"invalid -target %q (want host:port)":                                                                "無效的 -target %q (格式應為 host:port)",
+	"invalid -tcpBuffer: must not be negative":                                                           "無效的 -tcpBuffer：不可為負數",
+	"invalid -timeout: must not be negative":                                                             "無效的 -timeout：不可為負數",
+	"invalid -wsPath %q: must be an absolute, clean path such as /team-a/ws":                             "無效的 -wsPath %q：必須是絕對且正規化的路徑，例如 /team-a/ws",
+	"-wsPath cannot be combined with -grpc, -offerFile, -mqtt, -matrix or -drop (there is no WS server)": "-wsPath 不可與 -grpc、-offerFile、-mqtt、-matrix 或 -drop 同時使用（沒有 WS 伺服器）",
+	"-statusPage cannot be combined with -grpc or -offerFile (there is no WS server to serve it)":        "-statusPage 不可與 -grpc 或 -offerFile 同時使用（沒有可提供它的 WS 伺服器）",
+	"invalid -negotiateTimeout: must not be negative":                                                    "無效的 -negotiateTimeout：不可為負數",
+	"target port %d conflicts with -target %s":                                                           "目標連接埠 %d 與 -target %s 衝突",
+}
@@ -10,32 +10,81 @@ func init() {
 	pterm.DefaultLogger.ShowTime = true
 	pterm.DefaultLogger.TimeFormat = "02 Jan 15:04:05"
 	pterm.DefaultLogger.MaxWidth = 1000
+
+	SubscribeEvents(printEvent)
 }
 
-// Leveled logging functions backed by pterm prefixed printers.
-// All output goes to stderr by default (pterm's default).
+// Leveled logging functions. Each emits a log event (see EventLog), which
+// printEvent shows with pterm's logger, on stderr by default. Except for
+// debug messages, the format is translated to the selected language (see Tr).
 
 func LogDebug(format string, args ...interface{}) {
-	pterm.DefaultLogger.Debug(fmt.Sprintf(format, args...))
+	if !DebugEnabled() {
+		return
+	}
+	EmitEvent(Event{Event: EventLog, Level: LevelDebug, Text: fmt.Sprintf(format, args...)})
 }
 
 func LogInfo(format string, args ...interface{}) {
-	pterm.DefaultLogger.Info(fmt.Sprintf(format, args...))
+	EmitEvent(Event{Event: EventLog, Level: LevelInfo, Text: Trf(format, args...)})
 }
 
 func LogSuccess(format string, args ...interface{}) {
-	pterm.DefaultLogger.Info(fmt.Sprintf(format, args...))
+	EmitEvent(Event{Event: EventLog, Level: LevelSuccess, Text: Trf(format, args...)})
 }
 
 func LogWarning(format string, args ...interface{}) {
-	pterm.DefaultLogger.Warn(fmt.Sprintf(format, args...))
+	EmitEvent(Event{Event: EventLog, Level: LevelWarning, Text: Trf(format, args...)})
 }
 
 func LogError(format string, args ...interface{}) {
-	pterm.DefaultLogger.Error(fmt.Sprintf(format, args...))
+	EmitEvent(Event{Event: EventLog, Level: LevelError, Text: Trf(format, args...)})
+}
+
+// printEvent is the logger: it shows log events, the statistics of stats
+// events, state transitions (debug) and the peer operator's messages.
+func printEvent(ev Event) {
+	switch ev.Event {
+	case EventLog:
+		switch ev.Level {
+		case LevelDebug:
+			pterm.DefaultLogger.Debug(ev.Text)
+		case LevelWarning:
+			pterm.DefaultLogger.Warn(ev.Text)
+		case LevelError:
+			pterm.DefaultLogger.Error(ev.Text)
+		default:
+			pterm.DefaultLogger.Info(ev.Text)
+		}
+
+	case EventStats:
+		printStats(ev.Stats)
+
+	case EventStateChanged:
+		pterm.DefaultLogger.Debug("tunnel state → " + ev.State)
+
+	case EventMessage:
+		// Shown as is, not translated, and boxed so it stands out from the
+		// log.
+		pterm.DefaultBox.
+			WithTitle(Tr("Message from the peer")).
+			WithTitleTopLeft().
+			Println(ev.Text)
+	}
 }
 
 // EnableDebug configures the logger to show debug messages.
 func EnableDebug() {
 	pterm.DefaultLogger.Level = pterm.LogLevelDebug
 }
+
+// DisableDebug configures the logger to hide debug messages again.
+func DisableDebug() {
+	pterm.DefaultLogger.Level = pterm.LogLevelInfo
+}
+
+// DebugEnabled reports whether debug messages are shown.
+func DebugEnabled() bool {
+	level := pterm.DefaultLogger.Level
+	return level == pterm.LogLevelDebug || level == pterm.LogLevelTrace
+}
@@ -0,0 +1,64 @@
+package util
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/pion/logging"
+)
+
+// ──────────────────────────────────────────────────────────────────────────────
+// pion logging
+// ──────────────────────────────────────────────────────────────────────────────
+
+// webrtcDebug also shows pion's debug messages (see EnableWebRTCDebug).
+var webrtcDebug atomic.Bool
+
+// EnableWebRTCDebug enables debug logging including pion's own debug
+// messages, e.g. ICE candidate gathering and the DTLS and SCTP handshakes.
+func EnableWebRTCDebug() {
+	webrtcDebug.Store(true)
+	EnableDebug()
+}
+
+// PionLoggerFactory routes pion's logs into the roj1 log as debug messages
+// tagged with their scope (e.g. "[ice]"). pion's info, warning and error
+// messages show with -debug; its debug messages only after
+// EnableWebRTCDebug. Trace messages are always dropped.
+type PionLoggerFactory struct{}
+
+// NewLogger returns the logger for a pion scope.
+func (PionLoggerFactory) NewLogger(scope string) logging.LeveledLogger {
+	return pionLogger{scope: scope}
+}
+
+// pionLogger implements logging.LeveledLogger for one scope.
+type pionLogger struct {
+	scope string
+}
+
+func (l pionLogger) log(level, msg string) {
+	LogDebug("[%s] %s: %s", l.scope, level, msg)
+}
+
+func (l pionLogger) Trace(msg string)                  {}
+func (l pionLogger) Tracef(format string, args ...any) {}
+
+func (l pionLogger) Debug(msg string) {
+	if webrtcDebug.Load() {
+		l.log("debug", msg)
+	}
+}
+
+func (l pionLogger) Debugf(format string, args ...any) {
+	if webrtcDebug.Load() {
+		l.log("debug", fmt.Sprintf(format, args...))
+	}
+}
+
+func (l pionLogger) Info(msg string)                   { l.log("info", msg) }
+func (l pionLogger) Infof(format string, args ...any)  { l.log("info", fmt.Sprintf(format, args...)) }
+func (l pionLogger) Warn(msg string)                   { l.log("warning", msg) }
+func (l pionLogger) Warnf(format string, args ...any)  { l.log("warning", fmt.Sprintf(format, args...)) }
+func (l pionLogger) Error(msg string)                  { l.log("error", msg) }
+func (l pionLogger) Errorf(format string, args ...any) { l.log("error", fmt.Sprintf(format, args...)) }
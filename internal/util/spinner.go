@@ -0,0 +1,94 @@
+package util
+
+import (
+	"os"
+	"sync"
+
+	"github.com/pterm/pterm"
+)
+
+// Spinner shows the progress of a long step, like pterm's SpinnerPrinter. It
+// only animates on a terminal: off one, or with styling disabled (-noTty), it
+// starts no goroutine and prints each text once as a plain line instead, so
+// that log files and tests do not see cursor movements.
+//
+// Its methods may be called from any goroutine, e.g. for progress events
+// delivered on pion's (see signaling's followICE); one mutex orders them.
+type Spinner struct {
+	mu sync.Mutex
+	p  *pterm.SpinnerPrinter // nil when not animating
+}
+
+// StartSpinner shows text next to a spinner until Stop, Success or Fail.
+func StartSpinner(text string) *Spinner {
+	if pterm.RawOutput || !terminal() {
+		return &Spinner{}
+	}
+	p, _ := pterm.DefaultSpinner.
+		WithRemoveWhenDone(true).
+		Start(text)
+	return &Spinner{p: p}
+}
+
+// Animated reports whether the spinner animates; otherwise each UpdateText
+// prints a line.
+func (s *Spinner) Animated() bool {
+	return s.p != nil
+}
+
+// UpdateText replaces the text shown next to the spinner.
+func (s *Spinner) UpdateText(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.p == nil {
+		pterm.Println(text)
+		return
+	}
+	s.p.UpdateText(text)
+}
+
+// Success stops the spinner with a success message.
+func (s *Spinner) Success(msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.p == nil {
+		pterm.Success.Println(msg)
+		return
+	}
+	s.p.Success(msg)
+}
+
+// Fail stops the spinner with an error message.
+func (s *Spinner) Fail(msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.p == nil {
+		pterm.Error.Println(msg)
+		return
+	}
+	s.p.Fail(msg)
+}
+
+// Stop removes the spinner without a message.
+func (s *Spinner) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.p != nil {
+		s.p.Stop()
+	}
+}
+
+// terminal reports whether pterm's output, stdout or stderr with JSON events
+// (see EnableJSONEvents), is a terminal.
+func terminal() bool {
+	out := os.Stdout
+	if JSONEventsEnabled() {
+		out = os.Stderr
+	}
+	fi, err := out.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
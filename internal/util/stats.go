@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"runtime"
+	"slices"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -22,46 +24,175 @@ type stats struct {
 	ClosedConns atomic.Int64 // cumulative count of closed connections since process start
 	BytesSent   atomic.Int64 // cumulative bytes written to DataChannel
 	BytesRecv   atomic.Int64 // cumulative bytes read  from DataChannel
+	Dropped     atomic.Int64 // cumulative inbound packets discarded for a closing socket
+	Congested   atomic.Int64 // cumulative nanoseconds senders spent paused above the high-water mark
+	Rejected    atomic.Int64 // cumulative sockets refused or closed for exceeding a peer quota
+	Throttled   atomic.Int64 // cumulative nanoseconds inbound packets were delayed by the packet rate quota
+	Violations  atomic.Int64 // cumulative inbound packets dropped for violating the protocol
+	Resent      atomic.Int64 // cumulative packets sent again at the peer's request (NACK)
+	Parked      atomic.Int64 // cumulative nanoseconds writers waited on a full per-socket send queue
+	QueueDrops  atomic.Int64 // cumulative DATA packets dropped at a full per-socket send queue
+
+	bufMu      sync.Mutex
+	bufSamples []uint64 // DataChannel bufferedAmount samples since the last report
+	queSamples []uint64 // send queue lengths (packets) since the last report
 }
 
+// maxBufSamples bounds the samples kept between two reports.
+const maxBufSamples = 10000
+
 func (s *stats) AddConn()      { s.TotalConns.Add(1) }
 func (s *stats) RemoveConn()   { s.ClosedConns.Add(1) }
 func (s *stats) AddSent(n int) { s.BytesSent.Add(int64(n)) }
 func (s *stats) AddRecv(n int) { s.BytesRecv.Add(int64(n)) }
+func (s *stats) AddDropped()   { s.Dropped.Add(1) }
+func (s *stats) AddRejected()  { s.Rejected.Add(1) }
+func (s *stats) AddViolation() { s.Violations.Add(1) }
+
+func (s *stats) AddQueueDropped() { s.QueueDrops.Add(1) }
+
+func (s *stats) AddRetransmitted(n int) { s.Resent.Add(int64(n)) }
+
+func (s *stats) AddCongested(d time.Duration) { s.Congested.Add(int64(d)) }
+func (s *stats) AddThrottled(d time.Duration) { s.Throttled.Add(int64(d)) }
+func (s *stats) AddParked(d time.Duration)    { s.Parked.Add(int64(d)) }
+
+// SampleBuffered records one bufferedAmount sample of a DataChannel.
+func (s *stats) SampleBuffered(n uint64) {
+	s.bufMu.Lock()
+	if len(s.bufSamples) < maxBufSamples {
+		s.bufSamples = append(s.bufSamples, n)
+	}
+	s.bufMu.Unlock()
+}
+
+// SampleQueued records the number of packets waiting in a sender's queue.
+func (s *stats) SampleQueued(n int) {
+	s.bufMu.Lock()
+	if len(s.queSamples) < maxBufSamples {
+		s.queSamples = append(s.queSamples, uint64(n))
+	}
+	s.bufMu.Unlock()
+}
+
+// takeBuffered returns the p50 and p95 of the bufferedAmount samples recorded
+// since the last call and resets them. ok is false if there were none.
+func (s *stats) takeBuffered() (p50, p95 uint64, ok bool) {
+	s.bufMu.Lock()
+	samples := s.bufSamples
+	s.bufSamples = nil
+	s.bufMu.Unlock()
+	return percentiles(samples)
+}
+
+// takeQueued is takeBuffered for the send queue samples.
+func (s *stats) takeQueued() (p50, p95 uint64, ok bool) {
+	s.bufMu.Lock()
+	samples := s.queSamples
+	s.queSamples = nil
+	s.bufMu.Unlock()
+	return percentiles(samples)
+}
+
+// percentiles returns the p50 and p95 of samples, sorting them in place.
+func percentiles(samples []uint64) (p50, p95 uint64, ok bool) {
+	if len(samples) == 0 {
+		return 0, 0, false
+	}
+	slices.Sort(samples)
+	pct := func(p int) uint64 { return samples[(len(samples)-1)*p/100] }
+	return pct(50), pct(95), true
+}
 
 // ──────────────────────────────────────────────────────────────────────────────
 // Periodic reporter
 // ──────────────────────────────────────────────────────────────────────────────
 
-// StartStatsReporter launches a goroutine that logs tunnel statistics
-// every 10 seconds. It stops when ctx is cancelled.
-func StartStatsReporter(ctx context.Context) {
+// StatsInterval is how often StartStatsReporter reports by default.
+const StatsInterval = 10 * time.Second
+
+// StatsTick is the traffic of one reporting period, as carried by stats
+// events. Counts are for the period unless named total.
+type StatsTick struct {
+	Interval time.Duration `json:"interval"`
+	BytesIn  int64         `json:"bytes_in"`  // read from the DataChannel
+	BytesOut int64         `json:"bytes_out"` // written to the DataChannel
+	Opened   int64         `json:"opened"`    // connections
+	Closed   int64         `json:"closed"`
+
+	// DataChannel bufferedAmount and send queue length (packets) percentiles,
+	// zero without samples.
+	BufferedP50 uint64        `json:"buffered_p50,omitempty"`
+	BufferedP95 uint64        `json:"buffered_p95,omitempty"`
+	Congested   time.Duration `json:"congested,omitempty"` // paused above the high-water mark
+	QueuedP50   uint64        `json:"queued_p50,omitempty"`
+	QueuedP95   uint64        `json:"queued_p95,omitempty"`
+	Parked      time.Duration `json:"parked,omitempty"` // writers waited on a full send queue
+
+	Dropped    int64         `json:"dropped,omitempty"` // inbound packets for closing sockets
+	Rejected   int64         `json:"rejected,omitempty"`
+	Throttled  time.Duration `json:"throttled,omitempty"`
+	Violations int64         `json:"violations,omitempty"`
+	Resent     int64         `json:"resent,omitempty"`
+	QueueDrops int64         `json:"queue_drops,omitempty"`
+
+	// Totals since the process started, for the counts above that are
+	// reported as warnings.
+	TotalDropped    int64 `json:"total_dropped,omitempty"`
+	TotalRejected   int64 `json:"total_rejected,omitempty"`
+	TotalViolations int64 `json:"total_violations,omitempty"`
+	TotalResent     int64 `json:"total_resent,omitempty"`
+	TotalQueueDrops int64 `json:"total_queue_drops,omitempty"`
+}
+
+// StartStatsReporter launches a goroutine that emits a stats event every
+// interval. It stops when ctx is cancelled.
+func StartStatsReporter(ctx context.Context, interval time.Duration) {
 	go func() {
-		ticker := time.NewTicker(10 * time.Second)
+		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 
-		var prevSent, prevRecv, prevTotal, prevClosed int64
+		var prev StatsTick // totals at the last tick
+		var prevCongested, prevThrottled, prevParked int64
 		for {
 			select {
 			case <-ticker.C:
-				total := Stats.TotalConns.Load()
-				closed := Stats.ClosedConns.Load()
-				sent := Stats.BytesSent.Load()
-				recv := Stats.BytesRecv.Load()
-
-				inS := float64(recv-prevRecv) / 10.0
-				outS := float64(sent-prevSent) / 10.0
-				inC := total - prevTotal
-				outC := closed - prevClosed
-
-				if inC > 0 || outC > 0 || inS > 10 || outS > 10 {
-					pterm.DefaultLogger.Info(formatStats(inS, outS, inC, outC))
+				cur := StatsTick{
+					BytesIn:         Stats.BytesRecv.Load(),
+					BytesOut:        Stats.BytesSent.Load(),
+					Opened:          Stats.TotalConns.Load(),
+					Closed:          Stats.ClosedConns.Load(),
+					TotalDropped:    Stats.Dropped.Load(),
+					TotalRejected:   Stats.Rejected.Load(),
+					TotalViolations: Stats.Violations.Load(),
+					TotalResent:     Stats.Resent.Load(),
+					TotalQueueDrops: Stats.QueueDrops.Load(),
 				}
+				congested := Stats.Congested.Load()
+				throttled := Stats.Throttled.Load()
+				parked := Stats.Parked.Load()
+
+				tick := cur
+				tick.Interval = interval
+				tick.BytesIn -= prev.BytesIn
+				tick.BytesOut -= prev.BytesOut
+				tick.Opened -= prev.Opened
+				tick.Closed -= prev.Closed
+				tick.Dropped = cur.TotalDropped - prev.TotalDropped
+				tick.Rejected = cur.TotalRejected - prev.TotalRejected
+				tick.Violations = cur.TotalViolations - prev.TotalViolations
+				tick.Resent = cur.TotalResent - prev.TotalResent
+				tick.QueueDrops = cur.TotalQueueDrops - prev.TotalQueueDrops
+				tick.Congested = time.Duration(congested - prevCongested)
+				tick.Throttled = time.Duration(throttled - prevThrottled)
+				tick.Parked = time.Duration(parked - prevParked)
+				tick.BufferedP50, tick.BufferedP95, _ = Stats.takeBuffered()
+				tick.QueuedP50, tick.QueuedP95, _ = Stats.takeQueued()
 
-				prevSent = sent
-				prevRecv = recv
-				prevTotal = total
-				prevClosed = closed
+				EmitEvent(Event{Event: EventStats, Stats: &tick})
+
+				prev = cur
+				prevCongested, prevThrottled, prevParked = congested, throttled, parked
 
 			case <-ctx.Done():
 				return
@@ -70,12 +201,48 @@ func StartStatsReporter(ctx context.Context) {
 	}()
 }
 
+// printStats logs a stats tick: the traffic if there was any, and a warning
+// for each kind of trouble in the period.
+func printStats(t *StatsTick) {
+	inS := float64(t.BytesIn) / t.Interval.Seconds()
+	outS := float64(t.BytesOut) / t.Interval.Seconds()
+
+	if t.Opened > 0 || t.Closed > 0 || inS > 10 || outS > 10 {
+		pterm.DefaultLogger.Info(formatStats(inS, outS, t.Opened, t.Closed))
+		if t.BufferedP95 > 0 {
+			pterm.DefaultLogger.Info(formatCongestion(t.BufferedP50, t.BufferedP95, t.Congested))
+		}
+		if t.QueuedP95 > 0 {
+			pterm.DefaultLogger.Info(formatQueue(t.QueuedP50, t.QueuedP95, t.Parked))
+		}
+	}
+	warn := func(format string, args ...any) { pterm.DefaultLogger.Warn(Trf(format, args...)) }
+	if t.Dropped > 0 {
+		warn("Dropped %d inbound packets for closing sockets (%d total)", t.Dropped, t.TotalDropped)
+	}
+	if t.Rejected > 0 {
+		warn("Rejected %d connections over the peer quota (%d total)", t.Rejected, t.TotalRejected)
+	}
+	if t.Throttled >= time.Second {
+		warn("Inbound packets throttled for %.1fs by the packet rate quota", t.Throttled.Seconds())
+	}
+	if t.Violations > 0 {
+		warn("Dropped %d invalid packets from the peer (%d total)", t.Violations, t.TotalViolations)
+	}
+	if t.Resent > 0 {
+		warn("Retransmitted %d packets the peer had lost (%d total)", t.Resent, t.TotalResent)
+	}
+	if t.QueueDrops > 0 {
+		warn("Dropped %d outgoing packets at a full send queue (%d total)", t.QueueDrops, t.TotalQueueDrops)
+	}
+}
+
 // byteUnits defines the units for formatting byte counts in a human-readable way.
 var byteUnits = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
 
-// formatBytes formats a byte count into a human-readable string with fixed width (exactly 8 chars)
+// FormatBytes formats a byte count into a human-readable string with fixed width (exactly 8 chars)
 // for example: "99.0   B", " 1.5 KiB", " 0.1 MiB", "98.9 GiB", etc.
-func formatBytes(b float64) string {
+func FormatBytes(b float64) string {
 	unitIdx := 0
 
 	// to prevent "100.0 KiB", which is 9 chars
@@ -92,11 +259,33 @@ func formatStats(inS, outS float64, inC, outC int64) string {
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
 
-	return fmt.Sprintf("In: %s/s | Out: %s/s | Conn: %2d↑ %2d↓ | Mem: %s",
-		formatBytes(inS),
-		formatBytes(outS),
+	return Trf("In: %s/s | Out: %s/s | Conn: %2d↑ %2d↓ | Mem: %s",
+		FormatBytes(inS),
+		FormatBytes(outS),
 		inC,
 		outC,
-		formatBytes(float64(m.Alloc)),
+		FormatBytes(float64(m.Alloc)),
+	)
+}
+
+// formatCongestion returns the DataChannel buffer occupancy and the time spent
+// paused above the high-water mark in the last period. A high p95 with long
+// pauses means throughput is limited by the network path; a low one means it
+// is limited by the application.
+func formatCongestion(p50, p95 uint64, above time.Duration) string {
+	return Trf("Send buffer: p50 %s | p95 %s | above high-water %4.1fs",
+		FormatBytes(float64(p50)),
+		FormatBytes(float64(p95)),
+		above.Seconds(),
+	)
+}
+
+// formatQueue returns the number of packets waiting in the send queues and the
+// time writers spent parked on a full per-socket queue in the last period.
+func formatQueue(p50, p95 uint64, parked time.Duration) string {
+	return Trf("Send queue: p50 %d | p95 %d packets | writers parked %4.1fs",
+		p50,
+		p95,
+		parked.Seconds(),
 	)
 }
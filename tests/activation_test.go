@@ -0,0 +1,55 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+)
+
+// TestClientListener checks that a client adapter accepts on a listener it
+// is handed, as with socket activation, including a connection that was
+// waiting in its backlog before the adapter started.
+func TestClientListener(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	echoAddr := startEchoServer(t, ctx)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	early, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer early.Close()
+
+	clientTr, hostTr := MockTransports()
+	defer clientTr.Close()
+	defer hostTr.Close()
+
+	if _, err := adapter.StartAsHost(ctx, hostTr, echoAddr); err != nil {
+		t.Fatalf("StartAsHost: %v", err)
+	}
+	h, err := adapter.StartAsClientWith(ctx, clientTr, "", adapter.ClientConfig{Listener: l})
+	if err != nil {
+		t.Fatalf("StartAsClientWith: %v", err)
+	}
+	if h.Addr().String() != l.Addr().String() {
+		t.Errorf("Addr = %v, want the listener's %v", h.Addr(), l.Addr())
+	}
+
+	early.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := early.Write([]byte("ping")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(early, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("early connection got %q, %v; want \"ping\"", buf, err)
+	}
+	echoOnce(t, h.Addr().String(), 1)
+}
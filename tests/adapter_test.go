@@ -12,6 +12,7 @@ import (
 
 	"github.com/1ureka/roj1/internal/adapter"
 	"github.com/1ureka/roj1/internal/protocol"
+	"github.com/1ureka/roj1/internal/util"
 )
 
 // Compile-time interface check.
@@ -119,7 +120,7 @@ func (m *mockTransport) deliverToPeer(pkt *protocol.Packet) {
 
 // startEchoServer starts a TCP echo server that copies everything it receives
 // back to the sender. Returns the address (host:port) it is listening on.
-func startEchoServer(t *testing.T, ctx context.Context) string {
+func startEchoServer(t testing.TB, ctx context.Context) string {
 	t.Helper()
 	l, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
@@ -145,7 +146,7 @@ func startEchoServer(t *testing.T, ctx context.Context) string {
 }
 
 // getFreeAddr finds a free TCP port on loopback and returns its address.
-func getFreeAddr(t *testing.T) string {
+func getFreeAddr(t testing.TB) string {
 	t.Helper()
 	l, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
@@ -272,3 +273,149 @@ func TestRunAsHostAndClient(t *testing.T) {
 
 	connWg.Wait()
 }
+
+// connHooks records connection close notifications for TestConnectionHooks.
+type connHooks struct {
+	util.NopHooks
+	closed chan [2]int64
+}
+
+func (h *connHooks) OnConnectionClose(socketID uint32, bytesIn, bytesOut int64) {
+	select {
+	case h.closed <- [2]int64{bytesIn, bytesOut}:
+	default: // never block sockets of later tests
+	}
+}
+
+// TestConnectionHooks verifies that OnConnectionClose reports the payload
+// bytes bridged by each side's socket for a single echoed connection.
+func TestConnectionHooks(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+
+	echoAddr := startEchoServer(t, ctx)
+	clientTr, hostTr := MockTransports()
+	clientAddr := getFreeAddr(t)
+
+	hooks := &connHooks{closed: make(chan [2]int64, 8)}
+	t.Cleanup(util.AddHooks(hooks))
+
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		clientTr.Close()
+		hostTr.Close()
+		wg.Wait()
+	}()
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		adapter.RunAsHost(ctx, hostTr, echoAddr)
+	}()
+	go func() {
+		defer wg.Done()
+		adapter.RunAsClient(ctx, clientTr, clientAddr)
+	}()
+
+	waitForListener(t, clientAddr, 5*time.Second)
+
+	const dataSize = 1000
+	conn, err := net.Dial("tcp", clientAddr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+
+	sent := makeTestData(dataSize, 7)
+	if _, err := conn.Write(sent); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	got := make([]byte, dataSize)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatalf("read echo: %v", err)
+	}
+	conn.Close()
+
+	// Both the client-side and the host-side socket report the same counts.
+	// Empty notifications come from the waitForListener probe connection.
+	for n := 0; n < 2; {
+		select {
+		case c := <-hooks.closed:
+			if c[0] == 0 && c[1] == 0 {
+				continue
+			}
+			n++
+			if c[0] != dataSize || c[1] != dataSize {
+				t.Errorf("byte counts mismatch: got in=%d out=%d, want %d each", c[0], c[1], dataSize)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for OnConnectionClose")
+		}
+	}
+}
+
+// TestHandleClose verifies that Handle.Close stops the client listener, waits
+// for active connections until its context expires, and then tears them down.
+func TestHandleClose(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	echoAddr := startEchoServer(t, ctx)
+	clientTr, hostTr := MockTransports()
+	defer clientTr.Close()
+	defer hostTr.Close()
+	clientAddr := getFreeAddr(t)
+
+	host, err := adapter.StartAsHost(ctx, hostTr, echoAddr)
+	if err != nil {
+		t.Fatalf("StartAsHost: %v", err)
+	}
+	client, err := adapter.StartAsClient(ctx, clientTr, clientAddr)
+	if err != nil {
+		t.Fatalf("StartAsClient: %v", err)
+	}
+
+	// StartAsClient returns with the listener bound, so no waitForListener
+	// probe (whose CONNECT/CLOSE could be reordered) is needed.
+
+	// An active connection keeps the client from draining.
+	conn, err := net.Dial("tcp", clientAddr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("ping"))
+	got := make([]byte, 4)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatalf("read echo: %v", err)
+	}
+
+	closeCtx, closeCancel := context.WithTimeout(ctx, 300*time.Millisecond)
+	defer closeCancel()
+	if err := client.Close(closeCtx); err != context.DeadlineExceeded {
+		t.Errorf("client Close: got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	select {
+	case <-client.Done():
+	default:
+		t.Error("client Done not closed after Close returned")
+	}
+
+	if c, err := net.DialTimeout("tcp", clientAddr, 100*time.Millisecond); err == nil {
+		c.Close()
+		t.Error("client listener still accepting after Close")
+	}
+
+	// The forced teardown closed the bridged connection.
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(got); err == nil {
+		t.Error("expected bridged connection to be closed")
+	}
+
+	// The host side drains once the CLOSE from the client arrived.
+	if err := host.Close(ctx); err != nil {
+		t.Errorf("host Close: %v", err)
+	}
+}
@@ -0,0 +1,304 @@
+package tests
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/1ureka/roj1/internal/identity"
+	"github.com/1ureka/roj1/internal/signaling"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// newKey generates an identity key.
+func newKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// sign signs a challenge as the given side ("host" or "client").
+func sign(key ed25519.PrivateKey, side, challenge string) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, []byte("roj1-auth-v1 "+side+" "+challenge)))
+}
+
+// fakeKeyHost accepts one signaling connection and answers the client's hello
+// like a host with the given key; a non-empty challenge requires the client
+// to authenticate. The client's reply to it is delivered on the channel.
+func fakeKeyHost(t *testing.T, key ed25519.PrivateKey, challenge string) (wsURL string, auth <-chan map[string]any) {
+	t.Helper()
+
+	got := make(chan map[string]any, 1)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var hello map[string]any
+		if err := conn.ReadJSON(&hello); err != nil {
+			return
+		}
+		c, _ := hello["challenge"].(string)
+		conn.WriteJSON(map[string]any{
+			"type":      "hello",
+			"seq":       1,
+			"nonce":     "bm9uY2U",
+			"version":   "1.0.0",
+			"challenge": challenge,
+			"publicKey": identity.MarshalPublicKey(key.Public().(ed25519.PublicKey)),
+			"signature": sign(key, "host", c),
+		})
+
+		var msg map[string]any
+		if err := conn.ReadJSON(&msg); err == nil {
+			got <- msg
+		}
+		conn.ReadJSON(&msg) // hold the connection until the client gives up
+	}))
+	t.Cleanup(srv.Close)
+
+	return "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws", got
+}
+
+// TestAuthorizedKeysFile checks the authorized keys format and lookups.
+func TestAuthorizedKeysFile(t *testing.T) {
+	alice, bob := newKey(t), newKey(t)
+	alicePub := alice.Public().(ed25519.PublicKey)
+
+	keys, err := identity.ParseAuthorizedKeys(strings.NewReader(
+		"# team\n\n" + identity.MarshalPublicKey(alicePub) + " alice@laptop\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k, ok := keys.Lookup(alicePub); !ok || k.Name() != "alice@laptop" {
+		t.Errorf("Lookup(alice) = %+v, %v", k, ok)
+	}
+	if _, ok := keys.Lookup(bob.Public().(ed25519.PublicKey)); ok {
+		t.Error("Lookup(bob) succeeded for an unlisted key")
+	}
+
+	if _, err := identity.ParseAuthorizedKeys(strings.NewReader("ssh-ed25519 AAAA\n")); err == nil {
+		t.Error("foreign key type accepted")
+	}
+}
+
+// TestLoadOrCreate checks that an identity is created once and then reused.
+func TestLoadOrCreate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "roj1", "id_ed25519")
+
+	first, created, err := identity.LoadOrCreate(path)
+	if err != nil || !created {
+		t.Fatalf("LoadOrCreate = %v, %v; want a new key", created, err)
+	}
+	again, created, err := identity.LoadOrCreate(path)
+	if err != nil || created || !first.Equal(again) {
+		t.Fatalf("second LoadOrCreate = %v, %v; want the same key", created, err)
+	}
+}
+
+// TestKnownHostPinning checks that the client pins the host's key on first
+// use and refuses a different key later.
+func TestKnownHostPinning(t *testing.T) {
+	known := filepath.Join(t.TempDir(), "known_hosts")
+	opts := signaling.Options{KnownHosts: known, Timeout: 500 * time.Millisecond}
+
+	// Pinned on first use; establishment then waits for offers.
+	wsURL, _ := fakeKeyHost(t, newKey(t), "")
+	if _, err := signaling.EstablishAsClient(context.Background(), wsURL, opts); !errors.Is(err, signaling.ErrTimeout) {
+		t.Fatalf("first connection error = %v, want ErrTimeout", err)
+	}
+
+	// Same address, different key.
+	host := strings.TrimPrefix(strings.TrimSuffix(wsURL, "/ws"), "ws://")
+	_, err := identity.CheckKnownHost(known, host, newKey(t).Public().(ed25519.PublicKey))
+	if !errors.Is(err, identity.ErrHostKeyChanged) {
+		t.Fatalf("CheckKnownHost with another key = %v, want ErrHostKeyChanged", err)
+	}
+
+	other, _ := fakeKeyHost(t, newKey(t), "")
+	otherHost := strings.TrimPrefix(strings.TrimSuffix(other, "/ws"), "ws://")
+	if _, err := identity.CheckKnownHost(known, otherHost, newKey(t).Public().(ed25519.PublicKey)); err != nil {
+		t.Fatal(err)
+	}
+	_, err = signaling.EstablishAsClient(context.Background(), other, opts)
+	if !errors.Is(err, signaling.ErrAuth) || !errors.Is(err, identity.ErrHostKeyChanged) {
+		t.Fatalf("connection to a host with a changed key: %v, want ErrAuth", err)
+	}
+}
+
+// TestKnownHostsUnusable checks that the client refuses a host it cannot
+// check against an unreadable or corrupt known hosts file.
+func TestKnownHostsUnusable(t *testing.T) {
+	dir := t.TempDir()
+	corrupt := filepath.Join(dir, "known_hosts")
+	if err := os.WriteFile(corrupt, []byte("# pins\ndamaged-entry\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, known := range map[string]string{"unreadable": dir, "corrupt": corrupt} {
+		wsURL, _ := fakeKeyHost(t, newKey(t), "")
+		_, err := signaling.EstablishAsClient(context.Background(), wsURL, signaling.Options{KnownHosts: known, Timeout: 5 * time.Second})
+		if !errors.Is(err, signaling.ErrAuth) {
+			t.Errorf("%s known hosts: %v, want ErrAuth", name, err)
+		}
+	}
+}
+
+// TestOfferSignature checks that the client refuses an offer that the host,
+// having proven its key, did not sign, as one swapped on the way would be.
+func TestOfferSignature(t *testing.T) {
+	key := newKey(t)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var hello map[string]any
+		if err := conn.ReadJSON(&hello); err != nil {
+			return
+		}
+		c, _ := hello["challenge"].(string)
+		conn.WriteJSON(map[string]any{
+			"type":      "hello",
+			"seq":       1,
+			"nonce":     "bm9uY2U",
+			"version":   "1.0.0",
+			"publicKey": identity.MarshalPublicKey(key.Public().(ed25519.PublicKey)),
+			"signature": sign(key, "host", c),
+		})
+		conn.WriteJSON(map[string]any{
+			"type":      "offer",
+			"seq":       2,
+			"nonce":     "bm9uY2U",
+			"sdp":       "v=0\r\n",
+			"paths":     1,
+			"signature": sign(key, "host", c), // over the challenge alone
+		})
+		var msg map[string]any
+		conn.ReadJSON(&msg) // hold the connection until the client gives up
+	}))
+	t.Cleanup(srv.Close)
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+	_, err := signaling.EstablishAsClient(context.Background(), wsURL, signaling.Options{Timeout: 5 * time.Second})
+	if !errors.Is(err, signaling.ErrAuth) {
+		t.Fatalf("unsigned offer: %v, want ErrAuth", err)
+	}
+}
+
+// TestClientAnswersChallenge checks that a client proves its key when the
+// host requires it, and refuses to continue without one.
+func TestClientAnswersChallenge(t *testing.T) {
+	const challenge = "Y2hhbGxlbmdl"
+	key := newKey(t)
+
+	wsURL, auth := fakeKeyHost(t, newKey(t), challenge)
+	signaling.EstablishAsClient(context.Background(), wsURL, signaling.Options{
+		Identity: key,
+		Timeout:  500 * time.Millisecond,
+	})
+	msg := <-auth
+	if msg["type"] != "auth" || msg["publicKey"] != identity.MarshalPublicKey(key.Public().(ed25519.PublicKey)) ||
+		msg["signature"] != sign(key, "client", challenge) {
+		t.Errorf("client's answer = %v", msg)
+	}
+
+	wsURL, _ = fakeKeyHost(t, newKey(t), challenge)
+	_, err := signaling.EstablishAsClient(context.Background(), wsURL, signaling.Options{Timeout: 5 * time.Second})
+	if !errors.Is(err, signaling.ErrAuth) {
+		t.Fatalf("client without identity: %v, want ErrAuth", err)
+	}
+}
+
+// TestHostRefusesUnauthorizedKey checks that the host ends establishment,
+// before any offer, when the client's key is not authorized.
+func TestHostRefusesUnauthorizedKey(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	authorized, err := identity.ParseAuthorizedKeys(strings.NewReader(
+		identity.MarshalPublicKey(newKey(t).Public().(ed25519.PublicKey)) + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listening := make(chan int, 1)
+	t.Cleanup(util.SubscribeEvents(func(ev util.Event) {
+		if ev.Event == util.EventWSListening {
+			select {
+			case listening <- ev.Port:
+			default:
+			}
+		}
+	}))
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := signaling.EstablishAsHost(ctx, "127.0.0.1:0", signaling.Options{AuthorizedKeys: authorized})
+		done <- err
+	}()
+
+	var port int
+	select {
+	case port = <-listening:
+	case <-ctx.Done():
+		t.Fatal("host never listened")
+	}
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, fmt.Sprintf("ws://127.0.0.1:%d/ws", port), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	const challenge = "Y2xpZW50"
+	conn.WriteJSON(map[string]any{"type": "hello", "seq": 1, "version": "1.0.0", "challenge": challenge})
+
+	var hello map[string]any
+	if err := conn.ReadJSON(&hello); err != nil {
+		t.Fatal(err)
+	}
+	hostChallenge, _ := hello["challenge"].(string)
+	if hostChallenge == "" {
+		t.Fatalf("host hello %v carries no challenge", hello)
+	}
+
+	stranger := newKey(t)
+	conn.WriteJSON(map[string]any{
+		"type":      "auth",
+		"seq":       2,
+		"nonce":     hello["nonce"],
+		"publicKey": identity.MarshalPublicKey(stranger.Public().(ed25519.PublicKey)),
+		"signature": sign(stranger, "client", hostChallenge),
+	})
+
+	// No offer: the next thing the client sees is the refusal.
+	var msg map[string]any
+	err = conn.ReadJSON(&msg)
+	if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Errorf("after an unauthorized key, read %v, %v; want a policy violation close", msg, err)
+	}
+	if err := <-done; !errors.Is(err, signaling.ErrAuth) || !errors.Is(err, signaling.ErrSignaling) {
+		t.Errorf("EstablishAsHost error = %v, want ErrAuth", err)
+	}
+}
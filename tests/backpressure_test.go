@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/transport"
+)
+
+// Compile-time interface checks.
+var (
+	_ adapter.Writable = (*transport.Transport)(nil)
+	_ adapter.Writable = (*transport.Failover)(nil)
+	_ adapter.Writable = (*transport.Bond)(nil)
+	_ adapter.Writable = (*gatedTransport)(nil)
+)
+
+// gatedTransport is a mockTransport that reports congestion until open is
+// closed, and counts the DATA packets it sends.
+type gatedTransport struct {
+	*mockTransport
+	open chan struct{}
+	sent atomic.Int64
+}
+
+// WaitWritable blocks until the gate is opened or ctx is done.
+func (g *gatedTransport) WaitWritable(ctx context.Context, socketID uint32) error {
+	select {
+	case <-g.open:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SendData counts the packet and forwards it to the peer.
+func (g *gatedTransport) SendData(socketID, seqNum uint32, payload []byte) {
+	g.sent.Add(1)
+	g.mockTransport.SendData(socketID, seqNum, payload)
+}
+
+// TestBackpressure checks that a socket stops reading from TCP while the
+// transport is congested and resumes once it is writable again.
+func TestBackpressure(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	echoAddr := startEchoServer(t, ctx)
+	clientMock, hostTr := MockTransports()
+	clientTr := &gatedTransport{mockTransport: clientMock, open: make(chan struct{})}
+	defer clientTr.Close()
+	defer hostTr.Close()
+
+	if _, err := adapter.StartAsHost(ctx, hostTr, echoAddr); err != nil {
+		t.Fatalf("StartAsHost: %v", err)
+	}
+	clientAddr := getFreeAddr(t)
+	if _, err := adapter.StartAsClient(ctx, clientTr, clientAddr); err != nil {
+		t.Fatalf("StartAsClient: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", clientAddr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write(makeTestData(64*1024, 1)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	if n := clientTr.sent.Load(); n != 0 {
+		t.Fatalf("sent %d DATA packets while congested, want 0", n)
+	}
+
+	close(clientTr.open)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for clientTr.sent.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no DATA sent after the transport became writable")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/transport"
+)
+
+// Compile-time interface check.
+var _ adapter.Transport = (*transport.Bond)(nil)
+
+// TestBond runs echo traffic over two bonded paths in each mode, then checks
+// that the bond survives losing one path.
+func TestBond(t *testing.T) {
+	for _, mode := range []transport.BondMode{transport.BondStripe, transport.BondDuplicate} {
+		t.Run(mode.String(), func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			echoAddr := startEchoServer(t, ctx)
+			aClient, aHost := streamTransportPair(t, ctx)
+			bClient, bHost := streamTransportPair(t, ctx)
+
+			clientTr := transport.NewBond(mode, aClient, bClient)
+			hostTr := transport.NewBond(mode, aHost, bHost)
+			defer clientTr.Close()
+			defer hostTr.Close()
+
+			if _, err := adapter.StartAsHost(ctx, hostTr, echoAddr); err != nil {
+				t.Fatalf("StartAsHost: %v", err)
+			}
+			clientAddr := getFreeAddr(t)
+			if _, err := adapter.StartAsClient(ctx, clientTr, clientAddr); err != nil {
+				t.Fatalf("StartAsClient: %v", err)
+			}
+
+			for i := range 4 {
+				echoOnce(t, clientAddr, byte(i))
+			}
+
+			aClient.Close()
+			<-aHost.Done()
+
+			echoOnce(t, clientAddr, 9)
+
+			bClient.Close()
+			select {
+			case <-hostTr.Done():
+			case <-time.After(5 * time.Second):
+				t.Fatal("bond not done after all paths died")
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/signaling"
+	"github.com/1ureka/roj1/internal/transport"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// goroutineSettle bounds how long goroutines that were told to stop may take
+// to actually exit.
+const goroutineSettle = 5 * time.Second
+
+// checkGoroutines fails t unless the goroutine count drops back to at most
+// before, listing the goroutines left over.
+func checkGoroutines(t *testing.T, before int) {
+	t.Helper()
+	deadline := time.Now().Add(goroutineSettle)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		var buf bytes.Buffer
+		pprof.Lookup("goroutine").WriteTo(&buf, 1)
+		t.Errorf("%d goroutines after cancelling, %d before:\n%s", n, before, buf.String())
+	}
+}
+
+// cancelOn returns a context cancelled at the first event for which match
+// returns true.
+func cancelOn(t *testing.T, match func(util.Event) bool) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	var once sync.Once
+	t.Cleanup(util.SubscribeEvents(func(ev util.Event) {
+		if match(ev) {
+			once.Do(cancel)
+		}
+	}))
+	return ctx
+}
+
+// eventSeen returns a channel closed at the first event for which match
+// returns true.
+func eventSeen(t *testing.T, match func(util.Event) bool) <-chan struct{} {
+	seen := make(chan struct{})
+	var once sync.Once
+	t.Cleanup(util.SubscribeEvents(func(ev util.Event) {
+		if match(ev) {
+			once.Do(func() { close(seen) })
+		}
+	}))
+	return seen
+}
+
+// sdpExchange returns a context for both sides of a session, cancelled once
+// each applied the other's session description, and check, which fails t
+// unless they did and each then got its tunnel or was cancelled. Whether ICE
+// connects where the tests run does not change the outcome.
+func sdpExchange(t *testing.T) (ctx context.Context, check func(hostErr, clientErr error)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	var sides atomic.Int32
+	t.Cleanup(util.SubscribeEvents(func(ev util.Event) {
+		if ev.Event == util.EventPhase && ev.Phase == util.PhaseSDP && sides.Add(1) == 2 {
+			cancel()
+		}
+	}))
+	return ctx, func(hostErr, clientErr error) {
+		t.Helper()
+		if n := sides.Load(); n != 2 {
+			t.Errorf("%d of 2 sides completed the SDP exchange (host: %v, client: %v)", n, hostErr, clientErr)
+			return
+		}
+		if hostErr != nil {
+			checkCancelled(t, "host", hostErr)
+		}
+		if clientErr != nil {
+			checkCancelled(t, "client", clientErr)
+		}
+	}
+}
+
+// sessionSide is one end of a session run by runSession: the address the host's WS
+// server listens on or the URL the client dials, and its Options.
+type sessionSide struct {
+	addr string
+	opts signaling.Options
+}
+
+// runSession runs a host and a client within ctx and returns both results.
+// A host with a WS server is listening before the client starts. The client
+// outlasts the host, whose result tells how far they got.
+func runSession(t *testing.T, ctx context.Context, host, client sessionSide) (hostErr, clientErr error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	host.opts.Timeout, client.opts.Timeout = 3*time.Second, 5*time.Second
+
+	listening := eventSeen(t, func(ev util.Event) bool { return ev.Event == util.EventWSListening })
+	hostDone := make(chan error, 1)
+	go func() {
+		tr, _, err := signaling.EstablishAsHost(ctx, host.addr, host.opts)
+		closeCarrier(tr)
+		hostDone <- err
+	}()
+
+	if host.addr != "" {
+		select {
+		case <-listening:
+		case err := <-hostDone:
+			t.Fatalf("host: %v", err)
+		}
+	}
+	tr, err := signaling.EstablishAsClient(ctx, client.addr, client.opts)
+	closeCarrier(tr)
+	return <-hostDone, err
+}
+
+// checkCancelled fails t unless err is the ErrCancelled of a cancelled context.
+func checkCancelled(t *testing.T, side string, err error) {
+	t.Helper()
+	if !errors.Is(err, signaling.ErrCancelled) || !errors.Is(err, context.Canceled) {
+		t.Errorf("%s: %v, want ErrCancelled wrapping context.Canceled", side, err)
+	}
+}
+
+// TestCancelWhileWaitingForClient checks that a host cancelled while its WS
+// server waits for a client shuts the server down and leaves no goroutine
+// behind.
+func TestCancelWhileWaitingForClient(t *testing.T) {
+	before := runtime.NumGoroutine()
+	ctx := cancelOn(t, func(ev util.Event) bool { return ev.Event == util.EventWSListening })
+
+	tr, port, err := signaling.EstablishAsHost(ctx, "127.0.0.1:0", signaling.Options{Timeout: 10 * time.Second})
+	if tr != nil {
+		tr.Close()
+	}
+	checkCancelled(t, "host", err)
+	if conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port)); err == nil {
+		conn.Close()
+		t.Errorf("the WS server on port %d still accepts connections", port)
+	}
+	checkGoroutines(t, before)
+}
+
+// TestCancelMidNegotiation checks that cancelling both sides once their
+// PeerConnections are gathering candidates closes them and every goroutine
+// of the flow.
+func TestCancelMidNegotiation(t *testing.T) {
+	before := runtime.NumGoroutine()
+	ctx := cancelOn(t, func(ev util.Event) bool { return ev.Event == util.EventICEProgress })
+
+	host, client := memSignalers()
+	defer host.Close()
+	defer client.Close()
+
+	hostDone := make(chan error, 1)
+	go func() {
+		tr, _, err := signaling.EstablishAsHost(ctx, "", signaling.Options{Signaler: host, Timeout: 10 * time.Second})
+		closeCarrier(tr)
+		hostDone <- err
+	}()
+	tr, clientErr := signaling.EstablishAsClient(ctx, "", signaling.Options{Signaler: client, Timeout: 10 * time.Second})
+	closeCarrier(tr)
+	hostErr := <-hostDone
+
+	checkCancelled(t, "host", hostErr)
+	checkCancelled(t, "client", clientErr)
+	host.Close()
+	checkGoroutines(t, before)
+}
+
+// TestCancelWhileJoining checks that a client cancelled while its hello goes
+// unanswered cleans up too.
+func TestCancelWhileJoining(t *testing.T) {
+	before := runtime.NumGoroutine()
+	ctx := cancelOn(t, func(ev util.Event) bool {
+		return ev.Event == util.EventStateChanged && ev.State == util.StateConnecting.String()
+	})
+
+	host, client := memSignalers() // nobody reads host
+	tr, err := signaling.EstablishAsClient(ctx, "", signaling.Options{Signaler: client, Timeout: 10 * time.Second})
+	closeCarrier(tr)
+	checkCancelled(t, "client", err)
+	host.Close()
+	checkGoroutines(t, before)
+}
+
+// closeCarrier closes tr, if any.
+func closeCarrier(tr transport.Carrier) {
+	if tr != nil {
+		tr.Close()
+	}
+}
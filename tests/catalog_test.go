@@ -0,0 +1,340 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/identity"
+	"github.com/1ureka/roj1/internal/transport"
+)
+
+// startGreeter starts a TCP server that writes greeting to every connection
+// and closes it. Returns its address.
+func startGreeter(t *testing.T, ctx context.Context, greeting string) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("greeter: listen failed: %v", err)
+	}
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte(greeting))
+			conn.Close()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// TestServiceCatalog checks that the client learns the host's catalog, binds
+// a service to a local port whose connections reach that service, and keeps
+// reaching the main target through its main listener.
+func TestServiceCatalog(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	echoAddr := startEchoServer(t, ctx)
+	webAddr := startGreeter(t, ctx, "web")
+	a, b := transport.NewPipe()
+	defer a.Close()
+
+	if _, err := adapter.StartAsHostWith(ctx, b, echoAddr, adapter.HostConfig{
+		Services: map[string]string{"web": webAddr},
+	}); err != nil {
+		t.Fatalf("StartAsHostWith: %v", err)
+	}
+	h, err := adapter.StartAsClientWith(ctx, a, "127.0.0.1:0", adapter.ClientConfig{})
+	if err != nil {
+		t.Fatalf("StartAsClientWith: %v", err)
+	}
+
+	catalog, err := h.Catalog(ctx)
+	if err != nil {
+		t.Fatalf("Catalog: %v", err)
+	}
+	if len(catalog) != 1 || catalog[0].Name != "web" {
+		t.Fatalf("Catalog = %+v, want only web", catalog)
+	}
+
+	if _, err := h.Bind(ctx, "nope", "127.0.0.1:0"); !errors.Is(err, adapter.ErrServiceDenied) {
+		t.Errorf("Bind(nope) = %v, want ErrServiceDenied", err)
+	}
+	addr, err := h.Bind(ctx, "web", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Bind(web): %v", err)
+	}
+
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatalf("dial bound service: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	got, err := io.ReadAll(conn)
+	if err != nil || string(got) != "web" {
+		t.Errorf("bound service sent %q, %v; want \"web\"", got, err)
+	}
+
+	// The main listener still reaches the main target.
+	mainConn, err := net.Dial("tcp", h.Addr().String())
+	if err != nil {
+		t.Fatalf("dial main listener: %v", err)
+	}
+	defer mainConn.Close()
+	mainConn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := mainConn.Write([]byte("ping")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(mainConn, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("main target echoed %q, %v; want \"ping\"", buf, err)
+	}
+}
+
+// TestServiceCatalogPolicy checks that the host refuses services on ports
+// the peer's policy does not allow.
+func TestServiceCatalogPolicy(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	echoAddr := startEchoServer(t, ctx)
+	a, b := transport.NewPipe()
+	defer a.Close()
+
+	if _, err := adapter.StartAsHostWith(ctx, b, echoAddr, adapter.HostConfig{
+		Services: map[string]string{"ssh": "127.0.0.1:22"},
+		Policy:   adapter.Policy{Ports: []int{1}},
+	}); err != nil {
+		t.Fatalf("StartAsHostWith: %v", err)
+	}
+	h, err := adapter.StartAsClientWith(ctx, a, "", adapter.ClientConfig{})
+	if err != nil {
+		t.Fatalf("StartAsClientWith: %v", err)
+	}
+
+	if _, err := h.Bind(ctx, "ssh", "127.0.0.1:0"); !errors.Is(err, adapter.ErrServiceDenied) {
+		t.Errorf("Bind(ssh) = %v, want ErrServiceDenied", err)
+	}
+}
+
+// TestServiceAuthorization checks that the host's AuthorizeService decides
+// each bind, and that its reason reaches the client.
+func TestServiceAuthorization(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	echoAddr := startEchoServer(t, ctx)
+	a, b := transport.NewPipe()
+	defer a.Close()
+
+	asked := make(chan string, 2)
+	if _, err := adapter.StartAsHostWith(ctx, b, echoAddr, adapter.HostConfig{
+		Services: map[string]string{"web": startGreeter(t, ctx, "web"), "ssh": "127.0.0.1:22"},
+		AuthorizeService: func(_ context.Context, service string) error {
+			asked <- service
+			if service == "ssh" {
+				return errors.New("not today")
+			}
+			return nil
+		},
+	}); err != nil {
+		t.Fatalf("StartAsHostWith: %v", err)
+	}
+	h, err := adapter.StartAsClientWith(ctx, a, "", adapter.ClientConfig{})
+	if err != nil {
+		t.Fatalf("StartAsClientWith: %v", err)
+	}
+
+	if _, err := h.Bind(ctx, "web", "127.0.0.1:0"); err != nil {
+		t.Errorf("Bind(web): %v", err)
+	}
+	_, err = h.Bind(ctx, "ssh", "127.0.0.1:0")
+	if !errors.Is(err, adapter.ErrServiceDenied) || !strings.Contains(err.Error(), "not today") {
+		t.Errorf("Bind(ssh) = %v, want ErrServiceDenied with the reason", err)
+	}
+	if got := []string{<-asked, <-asked}; got[0] != "web" || got[1] != "ssh" {
+		t.Errorf("asked about %v, want [web ssh]", got)
+	}
+}
+
+// TestBindPort checks that the client binds another port of the target's
+// host by number once AuthorizePort grants it, next to a named service and
+// the main listener, all over one transport.
+func TestBindPort(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	echoAddr := startEchoServer(t, ctx)
+	_, devPort, _ := net.SplitHostPort(startGreeter(t, ctx, "dev"))
+	a, b := transport.NewPipe()
+	defer a.Close()
+
+	if _, err := adapter.StartAsHostWith(ctx, b, echoAddr, adapter.HostConfig{
+		Services: map[string]string{"web": startGreeter(t, ctx, "web")},
+		AuthorizePort: func(_ context.Context, port int) error {
+			if strconv.Itoa(port) != devPort {
+				return errors.New("not that one")
+			}
+			return nil
+		},
+	}); err != nil {
+		t.Fatalf("StartAsHostWith: %v", err)
+	}
+	h, err := adapter.StartAsClientWith(ctx, a, "127.0.0.1:0", adapter.ClientConfig{})
+	if err != nil {
+		t.Fatalf("StartAsClientWith: %v", err)
+	}
+
+	if _, err := h.Bind(ctx, "1", "127.0.0.1:0"); !errors.Is(err, adapter.ErrServiceDenied) {
+		t.Errorf("Bind(1) = %v, want ErrServiceDenied", err)
+	}
+	for name, want := range map[string]string{devPort: "dev", "web": "web"} {
+		addr, err := h.Bind(ctx, name, "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Bind(%s): %v", name, err)
+		}
+		conn, err := net.Dial("tcp", addr.String())
+		if err != nil {
+			t.Fatalf("dial %s: %v", name, err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		got, err := io.ReadAll(conn)
+		conn.Close()
+		if err != nil || string(got) != want {
+			t.Errorf("%s sent %q, %v; want %q", name, got, err, want)
+		}
+	}
+
+	mainConn, err := net.Dial("tcp", h.Addr().String())
+	if err != nil {
+		t.Fatalf("dial main listener: %v", err)
+	}
+	defer mainConn.Close()
+	mainConn.SetDeadline(time.Now().Add(5 * time.Second))
+	mainConn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(mainConn, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("main target echoed %q, %v; want \"ping\"", buf, err)
+	}
+}
+
+// TestGrantsFile checks that decisions are looked up per key and service, a
+// service's own line winning over "*", and that recorded ones persist.
+func TestGrantsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "grants")
+	os.WriteFile(path, []byte("# decisions\nSHA256:a * deny\nSHA256:a web allow\n"), 0o600)
+
+	g, err := identity.LoadGrants(path)
+	if err != nil {
+		t.Fatalf("LoadGrants: %v", err)
+	}
+	for _, c := range []struct {
+		peer, service string
+		allow, ok     bool
+	}{
+		{"SHA256:a", "web", true, true},
+		{"SHA256:a", "WEB", true, true},
+		{"SHA256:a", "ssh", false, true},
+		{"SHA256:b", "web", false, false},
+	} {
+		if allow, ok := g.Lookup(c.peer, c.service); allow != c.allow || ok != c.ok {
+			t.Errorf("Lookup(%s, %s) = %v, %v; want %v, %v", c.peer, c.service, allow, ok, c.allow, c.ok)
+		}
+	}
+
+	if err := g.Record("SHA256:b", "ssh", true); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	g, err = identity.LoadGrants(path)
+	if err != nil {
+		t.Fatalf("LoadGrants after Record: %v", err)
+	}
+	if allow, ok := g.Lookup("SHA256:b", "ssh"); !allow || !ok {
+		t.Errorf("recorded decision not loaded: %v, %v", allow, ok)
+	}
+
+	os.WriteFile(path, []byte("SHA256:a web maybe\n"), 0o600)
+	if _, err := identity.LoadGrants(path); err == nil {
+		t.Error("malformed line accepted")
+	}
+}
+
+// TestSetServices checks that services replaced while the host runs are
+// announced to the client, that it can bind the new ones, and that a removed
+// service it had bound is no longer reached.
+func TestSetServices(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	echoAddr := startEchoServer(t, ctx)
+	webAddr := startGreeter(t, ctx, "web")
+	apiAddr := startGreeter(t, ctx, "api")
+	a, b := transport.NewPipe()
+	defer a.Close()
+
+	host, err := adapter.StartAsHostWith(ctx, b, echoAddr, adapter.HostConfig{
+		Services: map[string]string{"web": webAddr},
+	})
+	if err != nil {
+		t.Fatalf("StartAsHostWith: %v", err)
+	}
+	h, err := adapter.StartAsClientWith(ctx, a, "", adapter.ClientConfig{})
+	if err != nil {
+		t.Fatalf("StartAsClientWith: %v", err)
+	}
+	web, err := h.Bind(ctx, "web", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Bind(web): %v", err)
+	}
+
+	if err := host.SetServices(map[string]string{"api": apiAddr}); err != nil {
+		t.Fatalf("SetServices: %v", err)
+	}
+	for {
+		catalog, err := h.Catalog(ctx)
+		if err != nil {
+			t.Fatalf("Catalog: %v", err)
+		}
+		if len(catalog) == 1 && catalog[0].Name == "api" {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("Catalog = %+v, want only api", catalog)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+
+	api, err := h.Bind(ctx, "api", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Bind(api): %v", err)
+	}
+	for addr, want := range map[net.Addr]string{api: "api", web: ""} {
+		conn, err := net.Dial("tcp", addr.String())
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		got, _ := io.ReadAll(conn)
+		conn.Close()
+		if string(got) != want {
+			t.Errorf("%s sent %q, want %q", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/protocol"
+)
+
+// TestConnectTimeout checks that a client connection is closed, and CLOSE is
+// sent, when the host does not answer its CONNECT in time, and that a host
+// which never answers any, as before CONNECT replies, keeps it open.
+func TestConnectTimeout(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		answering bool
+	}{
+		{"answering host", true},
+		{"old host", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			clientTr, hostTr := MockTransports()
+			defer clientTr.Close()
+			defer hostTr.Close()
+
+			// No host adapter: the first CONNECT is answered, with a greeting
+			// so the test knows it arrived, if the host answers at all; the
+			// others never are.
+			gotClose := make(chan uint32, 4)
+			first := true
+			hostTr.OnPacket(func(pkt *protocol.Packet) {
+				switch pkt.Type {
+				case protocol.TypeConnect:
+					if tc.answering && first {
+						first = false
+						go func() {
+							hostTr.SendConnect(pkt.SocketID, 1)
+							hostTr.SendData(pkt.SocketID, 2, []byte("hi"))
+						}()
+					}
+				case protocol.TypeClose:
+					gotClose <- pkt.SocketID
+				}
+			})
+
+			clientAddr := getFreeAddr(t)
+			cfg := adapter.ClientConfig{ConnectTimeout: 300 * time.Millisecond}
+			if _, err := adapter.StartAsClientWith(ctx, clientTr, clientAddr, cfg); err != nil {
+				t.Fatalf("StartAsClientWith: %v", err)
+			}
+
+			if tc.answering {
+				answered, err := net.Dial("tcp", clientAddr)
+				if err != nil {
+					t.Fatalf("dial: %v", err)
+				}
+				defer answered.Close()
+				answered.SetReadDeadline(time.Now().Add(5 * time.Second))
+				if _, err := io.ReadFull(answered, make([]byte, 2)); err != nil {
+					t.Fatalf("answered connection: %v", err)
+				}
+			}
+
+			conn, err := net.Dial("tcp", clientAddr)
+			if err != nil {
+				t.Fatalf("dial: %v", err)
+			}
+			defer conn.Close()
+
+			if !tc.answering {
+				conn.SetReadDeadline(time.Now().Add(time.Second))
+				if _, err := conn.Read(make([]byte, 1)); err == nil {
+					t.Fatal("read succeeded, want no data")
+				} else if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+					t.Fatalf("connection closed (%v), want it kept for a host that never answers", err)
+				}
+				select {
+				case id := <-gotClose:
+					t.Fatalf("CLOSE sent for %08x", id)
+				default:
+				}
+				return
+			}
+
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			if _, err := conn.Read(make([]byte, 1)); err == nil {
+				t.Fatal("read succeeded, want the connection closed")
+			} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				t.Fatal("connection not closed after the connect timeout")
+			}
+
+			select {
+			case <-gotClose:
+			case <-time.After(5 * time.Second):
+				t.Fatal("no CLOSE sent after the connect timeout")
+			}
+		})
+	}
+}
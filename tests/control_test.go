@@ -0,0 +1,186 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/protocol"
+	"github.com/1ureka/roj1/internal/transport"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// announcement is the part of a control message the tests look at.
+type announcement struct {
+	Kind    string               `json:"kind"`
+	ID      uint64               `json:"id"`
+	Service *adapter.ServiceInfo `json:"service"`
+}
+
+// expectControl waits for the next CONTROL packet and decodes it.
+func (p *rawPeer) expectControl(t *testing.T) announcement {
+	t.Helper()
+
+	pkt := p.expect(t, 0, protocol.TypeControl)
+	var msg announcement
+	if err := json.Unmarshal(pkt.Payload, &msg); err != nil {
+		t.Fatalf("CONTROL payload %q: %v", pkt.Payload, err)
+	}
+	return msg
+}
+
+// TestServiceAnnouncement checks that the host announces its target when it
+// starts and again when asked.
+func TestServiceAnnouncement(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	p, _ := startRawPeer(t, ctx, adapter.HostConfig{Service: adapter.ServiceInfo{Label: "Echo", Protocol: "echo"}})
+
+	msg := p.expectControl(t)
+	if msg.Kind != "service" || msg.Service == nil {
+		t.Fatalf("first control message = %+v, want a service announcement", msg)
+	}
+	if msg.Service.Label != "Echo" || msg.Service.Protocol != "echo" || msg.Service.Port == 0 {
+		t.Errorf("announced %+v, want label Echo, protocol echo and the echo server's port", *msg.Service)
+	}
+
+	p.SendControl([]byte(`{"kind":"query","id":1}`))
+	again := p.expectControl(t)
+	if again.Kind != "service" || again.Service == nil || *again.Service != *msg.Service {
+		t.Errorf("answer to query = %+v, want the same announcement", again)
+	}
+	if again.ID == msg.ID {
+		t.Errorf("answer reuses ID %d", again.ID)
+	}
+}
+
+// TestServiceAnnouncementClient checks that the client asks for the
+// announcement and records it, ignoring duplicates and unknown kinds.
+func TestServiceAnnouncementClient(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	a, b := transport.NewPipe()
+	defer a.Close()
+	p := &rawPeer{Pipe: a, packets: make(chan *protocol.Packet, 1024)}
+	a.OnPacket(func(pkt *protocol.Packet) { p.packets <- pkt })
+
+	h, err := adapter.StartAsClientWith(ctx, b, "127.0.0.1:0", adapter.ClientConfig{})
+	if err != nil {
+		t.Fatalf("StartAsClientWith: %v", err)
+	}
+	if _, ok := h.Service(); ok {
+		t.Fatal("Service reported before any announcement")
+	}
+
+	if msg := p.expectControl(t); msg.Kind != "query" {
+		t.Fatalf("client sent %q, want a query", msg.Kind)
+	}
+
+	p.SendControl([]byte(`{"kind":"future","id":1}`))
+	service := []byte(`{"kind":"service","id":2,"service":{"port":5432,"label":"Postgres 16","protocol":"postgres"}}`)
+	p.SendControl(service)
+	p.SendControl(service)
+	info := waitService(t, h, 5432)
+	if info.Label != "Postgres 16" || info.Protocol != "postgres" {
+		t.Errorf("Service = %+v, want label Postgres 16 and protocol postgres", info)
+	}
+
+	// A changed announcement replaces the recorded one.
+	p.SendControl([]byte(`{"kind":"service","id":3,"service":{"port":5433}}`))
+	waitService(t, h, 5433)
+}
+
+// waitService waits until the client has recorded an announcement for port.
+func waitService(t *testing.T, h *adapter.Handle, port int) adapter.ServiceInfo {
+	t.Helper()
+
+	tick := time.NewTicker(10 * time.Millisecond)
+	defer tick.Stop()
+	timeout := time.After(5 * time.Second)
+	for {
+		if info, ok := h.Service(); ok && info.Port == port {
+			return info
+		}
+		select {
+		case <-tick.C:
+		case <-timeout:
+			info, _ := h.Service()
+			t.Fatalf("Service = %+v, want port %d", info, port)
+		}
+	}
+}
+
+// TestControlValidation checks that malformed CONTROL packets count as
+// violations.
+func TestControlValidation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	p, _ := startRawPeer(t, ctx, adapter.HostConfig{})
+	p.expectControl(t)
+	violations := util.Stats.Violations.Load()
+
+	p.SendControl(nil)
+	p.SendControl(make([]byte, protocol.MaxControlSize+1))
+	p.SendControl([]byte("not json"))
+	p.SendControl([]byte(`{"id":1}`))
+
+	// A valid query after them is still answered.
+	p.SendControl([]byte(`{"kind":"query","id":2}`))
+	p.expectControl(t)
+
+	if got := util.Stats.Violations.Load() - violations; got != 4 {
+		t.Errorf("Violations grew by %d, want 4", got)
+	}
+}
+
+// TestOperatorMessage checks that a message reaches the peer as a control
+// message, that invalid ones are refused, and that a received message is
+// stripped of terminal escapes and reported.
+func TestOperatorMessage(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	received := make(chan string, 1)
+	t.Cleanup(util.SubscribeEvents(func(ev util.Event) {
+		if ev.Event == util.EventMessage {
+			select {
+			case received <- ev.Text:
+			default:
+			}
+		}
+	}))
+
+	p, h := startRawPeer(t, ctx, adapter.HostConfig{})
+	p.expectControl(t) // the service announcement
+
+	if err := h.SendMessage("  "); err == nil {
+		t.Error("empty message accepted")
+	}
+	if err := h.SendMessage(strings.Repeat("x", adapter.MaxMessageLen+1)); err == nil {
+		t.Error("overlong message accepted")
+	}
+	if err := h.SendMessage("rebooting the server"); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	pkt := p.expect(t, 0, protocol.TypeControl)
+	var msg struct{ Kind, Text string }
+	if err := json.Unmarshal(pkt.Payload, &msg); err != nil || msg.Kind != "msg" || msg.Text != "rebooting the server" {
+		t.Errorf("CONTROL payload %q, %v; want the message", pkt.Payload, err)
+	}
+
+	p.SendControl([]byte(`{"kind":"msg","id":1,"text":"back \u001b[2Jsoon"}`))
+	select {
+	case text := <-received:
+		if text != "back [2Jsoon" {
+			t.Errorf("received %q, want the escape stripped", text)
+		}
+	case <-ctx.Done():
+		t.Fatal("message not reported")
+	}
+}
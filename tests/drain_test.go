@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+)
+
+// TestDrainProgress checks that Handle.Sockets reports what an open
+// connection moved, and that the connection keeps working while Close drains
+// the adapter, which returns once it finished.
+func TestDrainProgress(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	echoAddr := startEchoServer(t, ctx)
+	clientTr, hostTr := MockTransports()
+	defer clientTr.Close()
+	defer hostTr.Close()
+
+	if _, err := adapter.StartAsHost(ctx, hostTr, echoAddr); err != nil {
+		t.Fatalf("StartAsHost: %v", err)
+	}
+	client, err := adapter.StartAsClient(ctx, clientTr, "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("StartAsClient: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", client.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	echo := func(msg string) {
+		t.Helper()
+		conn.Write([]byte(msg))
+		got := make([]byte, len(msg))
+		if _, err := io.ReadFull(conn, got); err != nil || string(got) != msg {
+			t.Fatalf("echo = %q, %v; want %q", got, err, msg)
+		}
+	}
+	echo("ping")
+
+	// The counters are updated right after the bytes moved, so the echo may
+	// be read a moment before.
+	var sockets []adapter.SocketProgress
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if sockets = client.Sockets(); len(sockets) == 1 && sockets[0].BytesIn == 4 {
+			break
+		}
+	}
+	if len(sockets) != 1 || sockets[0].BytesIn != 4 || sockets[0].BytesOut != 4 || sockets[0].Remote != conn.LocalAddr().String() {
+		t.Fatalf("Sockets = %+v, want one with 4 bytes each way from %s", sockets, conn.LocalAddr())
+	}
+
+	closed := make(chan error, 1)
+	go func() { closed <- client.Close(ctx) }()
+	echo("still here")
+	select {
+	case err := <-closed:
+		t.Fatalf("Close returned %v with a connection open", err)
+	default:
+	}
+
+	conn.Close()
+	if err := <-closed; err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
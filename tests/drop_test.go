@@ -0,0 +1,189 @@
+package tests
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/signaling"
+)
+
+// startGistAPI serves the gist API for a single gist, id "abc", editable with
+// the token "good".
+func startGistAPI(t *testing.T) string {
+	t.Helper()
+	var (
+		mu    sync.Mutex
+		files = map[string]map[string]string{"readme.md": {"content": "roj1"}}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"message": "Bad credentials"})
+			return
+		}
+		if r.URL.Path != "/gists/abc" {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"message": "Not Found"})
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodPatch {
+			var edit struct {
+				Files map[string]map[string]string `json:"files"`
+			}
+			json.NewDecoder(r.Body).Decode(&edit)
+			for name, f := range edit.Files {
+				files[name] = f
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"files": files})
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// startS3 serves an S3-compatible bucket, path-style, which checks each
+// request's signature for the key "AKID" with the secret "secret".
+func startS3(t *testing.T) string {
+	t.Helper()
+	var (
+		mu      sync.Mutex
+		objects = map[string][]byte{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !validS3Signature(r, body) {
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, "<Error><Code>SignatureDoesNotMatch</Code><Message>The request signature we calculated does not match the signature you provided.</Message></Error>")
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			objects[r.URL.Path] = body
+		case http.MethodGet:
+			data, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				io.WriteString(w, "<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>")
+				return
+			}
+			w.Write(data)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// validS3Signature checks r against AWS Signature Version 4.
+func validS3Signature(r *http.Request, body []byte) bool {
+	mac := func(key []byte, data string) []byte {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(data))
+		return h.Sum(nil)
+	}
+	sum := sha256.Sum256(body)
+	payload := hex.EncodeToString(sum[:])
+	stamp := r.Header.Get("X-Amz-Date")
+	if r.Header.Get("X-Amz-Content-Sha256") != payload || len(stamp) != 16 {
+		return false
+	}
+
+	canonical := r.Method + "\n" + r.URL.EscapedPath() + "\n\nhost:" + r.Host + "\nx-amz-content-sha256:" + payload +
+		"\nx-amz-date:" + stamp + "\n\nhost;x-amz-content-sha256;x-amz-date\n" + payload
+	scope := stamp[:8] + "/us-east-1/s3/aws4_request"
+	canonicalSum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(canonicalSum[:])
+	key := []byte("AWS4secret")
+	for _, part := range []string{stamp[:8], "us-east-1", "s3", "aws4_request"} {
+		key = mac(key, part)
+	}
+	want := "AWS4-HMAC-SHA256 Credential=AKID/" + scope + ", SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=" +
+		hex.EncodeToString(mac(key, toSign))
+	return r.Header.Get("Authorization") == want
+}
+
+// dropSession runs a host and a client with the given PINs through a dead
+// drop within ctx and returns both results. The client starts first.
+func dropSession(t *testing.T, ctx context.Context, cfg signaling.DropConfig, hostPIN, clientPIN string) (hostErr, clientErr error) {
+	t.Helper()
+	cfg.Interval = 50 * time.Millisecond
+
+	client, err := signaling.DialDrop(ctx, cfg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, err := signaling.DialDrop(ctx, cfg, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return runSession(t, ctx,
+		sessionSide{opts: signaling.Options{Signaler: host, PIN: hostPIN}},
+		sessionSide{addr: cfg.URL, opts: signaling.Options{Signaler: client, PIN: clientPIN}})
+}
+
+// TestDropSignaling checks that signaling runs through a gist and an S3
+// bucket: the PIN exchange and the SDP exchange, which need messages both
+// ways, complete, and a refusal in the next session, which finds the files
+// of the first, reaches the client with its reason.
+func TestDropSignaling(t *testing.T) {
+	for name, cfg := range map[string]signaling.DropConfig{
+		"gist": {URL: "gist://abc", Token: "good", Endpoint: startGistAPI(t)},
+		"s3":   {URL: "s3://bucket/roj1/kiosk", AccessKey: "AKID", SecretKey: "secret", Endpoint: startS3(t)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx, check := sdpExchange(t)
+			check(dropSession(t, ctx, cfg, "482913", "482913"))
+
+			hostErr, clientErr := dropSession(t, context.Background(), cfg, "482913", "111111")
+			if !errors.Is(hostErr, signaling.ErrPIN) {
+				t.Errorf("host: %v, want ErrPIN", hostErr)
+			}
+			if clientErr == nil || !strings.Contains(clientErr.Error(), "PIN") {
+				t.Errorf("client: %v, want a PIN refusal", clientErr)
+			}
+		})
+	}
+}
+
+// TestDropURLs checks which drops DialDrop accepts and that refused
+// credentials are reported with the provider's reason.
+func TestDropURLs(t *testing.T) {
+	for _, raw := range []string{"gist://aa5a315d61ae9438b18d", "s3://bucket", "s3://bucket/roj1/kiosk"} {
+		if err := signaling.ValidDropURL(raw); err != nil {
+			t.Errorf("%s: %v", raw, err)
+		}
+	}
+	for _, raw := range []string{"https://gist.github.com/abc", "gist://", "gist://abc/file", "s3:///roj1"} {
+		if signaling.ValidDropURL(raw) == nil {
+			t.Errorf("%s accepted", raw)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for cfg, want := range map[signaling.DropConfig]string{
+		{URL: "gist://abc", Token: "bad", Endpoint: startGistAPI(t)}:                           "Bad credentials",
+		{URL: "s3://bucket/roj1", AccessKey: "AKID", SecretKey: "wrong", Endpoint: startS3(t)}: "SignatureDoesNotMatch",
+	} {
+		if _, err := signaling.DialDrop(ctx, cfg, true); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("dial %s with refused credentials: %v, want %q", cfg.URL, err, want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// TestEventBus verifies that log messages and bridged connections reach
+// subscribers as events, and that unsubscribing stops the delivery.
+func TestEventBus(t *testing.T) {
+	var got []util.Event
+	unsubscribe := util.SubscribeEvents(func(ev util.Event) {
+		switch ev.Event {
+		case util.EventLog, util.EventSocketOpened, util.EventSocketClosed:
+			got = append(got, ev)
+		}
+	})
+
+	util.LogWarning("event bus test %d", 1)
+	util.LogDebug("hidden without -debug")
+	util.NotifyConnOpen(0x2a)
+	util.NotifyConnClose(0x2a, 10, 20)
+	unsubscribe()
+	util.LogWarning("event bus test %d", 2)
+
+	if len(got) != 3 {
+		t.Fatalf("got %d events, want 3: %+v", len(got), got)
+	}
+	if ev := got[0]; ev.Level != util.LevelWarning || ev.Text != "event bus test 1" || ev.Time.IsZero() {
+		t.Errorf("log event = %+v, want a timed warning with the formatted text", ev)
+	}
+	if ev := got[1]; ev.Event != util.EventSocketOpened || ev.Socket != "0000002a" {
+		t.Errorf("open event = %+v, want socket_opened for 0000002a", ev)
+	}
+	if ev := got[2]; ev.Event != util.EventSocketClosed || ev.BytesIn != 10 || ev.BytesOut != 20 {
+		t.Errorf("close event = %+v, want socket_closed with 10 bytes in and 20 out", ev)
+	}
+}
+
+// TestEmitPhase verifies that a phase event ends now and covers the time
+// since the phase started.
+func TestEmitPhase(t *testing.T) {
+	var got []util.Event
+	unsubscribe := util.SubscribeEvents(func(ev util.Event) {
+		if ev.Event == util.EventPhase {
+			got = append(got, ev)
+		}
+	})
+	defer unsubscribe()
+
+	start := time.Now().Add(-250 * time.Millisecond)
+	util.EmitPhase(util.PhaseSDP, start)
+
+	if len(got) != 1 {
+		t.Fatalf("got %d phase events, want 1", len(got))
+	}
+	ev := got[0]
+	if ev.Phase != util.PhaseSDP || ev.Duration < 250*time.Millisecond || !ev.Time.Add(-ev.Duration).Equal(start) {
+		t.Errorf("phase event = %+v, want sdp starting at %v", ev, start)
+	}
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/transport"
+)
+
+// Compile-time interface check.
+var _ adapter.Transport = (*transport.Failover)(nil)
+
+// echoOnce opens one connection through the tunnel and checks the echo.
+func echoOnce(t *testing.T, addr string, seed byte) {
+	t.Helper()
+	if err := echo(addr, seed); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// echo is echoOnce for use outside the test goroutine.
+func echo(addr string, seed byte) error {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("dial: %w", err)
+	}
+	defer conn.Close()
+
+	sent := makeTestData(64*1024, seed)
+	go conn.Write(sent)
+
+	got := make([]byte, len(sent))
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		return fmt.Errorf("read echo: %w", err)
+	}
+	if !bytes.Equal(sent, got) {
+		return errors.New("echoed data mismatch")
+	}
+	return nil
+}
+
+// TestFailover checks that new connections keep working after the active
+// carrier dies, and that the Failover is done only once all carriers are.
+func TestFailover(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	echoAddr := startEchoServer(t, ctx)
+	primaryClient, primaryHost := streamTransportPair(t, ctx)
+	standbyClient, standbyHost := streamTransportPair(t, ctx)
+
+	// The host prefers the standby, so both carriers carry traffic.
+	clientTr := transport.NewFailover(primaryClient, standbyClient)
+	hostTr := transport.NewFailover(standbyHost, primaryHost)
+	defer clientTr.Close()
+	defer hostTr.Close()
+
+	host, err := adapter.StartAsHost(ctx, hostTr, echoAddr)
+	if err != nil {
+		t.Fatalf("StartAsHost: %v", err)
+	}
+	clientAddr := getFreeAddr(t)
+	client, err := adapter.StartAsClient(ctx, clientTr, clientAddr)
+	if err != nil {
+		t.Fatalf("StartAsClient: %v", err)
+	}
+
+	echoOnce(t, clientAddr, 1)
+
+	// Kill the client's active carrier.
+	primaryClient.Close()
+	<-primaryHost.Done()
+
+	select {
+	case <-clientTr.Done():
+		t.Fatal("failover done while a standby is alive")
+	default:
+	}
+
+	echoOnce(t, clientAddr, 2)
+
+	// Kill the last carrier: both sides shut down.
+	standbyHost.Close()
+	for name, h := range map[string]*adapter.Handle{"host": host, "client": client} {
+		select {
+		case <-h.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s adapter not done after all carriers died", name)
+		}
+	}
+	if err := clientTr.Err(); err == nil {
+		t.Error("client failover: got nil error after all carriers died")
+	}
+}
@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/protocol"
+)
+
+// FuzzDecode feeds arbitrary frames to protocol.Decode. It must never panic,
+// must reject short frames and unknown types, and anything it accepts must
+// re-encode to the exact same bytes.
+//
+//	go test ./tests -run '^$' -fuzz FuzzDecode
+func FuzzDecode(f *testing.F) {
+	for _, pkt := range []*protocol.Packet{
+		{Type: protocol.TypeConnect, SocketID: 1, SeqNum: 1},
+		{Type: protocol.TypeData, SocketID: 0xDEADBEEF, SeqNum: 2, Payload: []byte("hello")},
+		{Type: protocol.TypeClose, SocketID: 0xFFFFFFFF, SeqNum: 0xFFFFFFFF},
+	} {
+		f.Add(protocol.Encode(pkt))
+	}
+	f.Add([]byte{})
+	f.Add([]byte{protocol.TypeData, 0, 0})
+	f.Add([]byte{0x00, 0, 0, 0, 1, 0, 0, 0, 1})
+	f.Add([]byte{0xFF, 0, 0, 0, 1, 0, 0, 0, 1, 0xAA})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		pkt, err := protocol.Decode(data)
+		if len(data) < protocol.HeaderSize {
+			if err == nil {
+				t.Fatalf("Decode accepted a %d-byte frame", len(data))
+			}
+			return
+		}
+		if err != nil {
+			if typ := data[0]; typ >= protocol.TypeConnect && typ <= protocol.TypeClose {
+				t.Fatalf("Decode rejected a valid frame: %v", err)
+			}
+			return
+		}
+
+		if got := protocol.Encode(pkt); !bytes.Equal(got, data) {
+			t.Fatalf("re-encoded frame differs:\n got  %x\n want %x", got, data)
+		}
+		if len(pkt.Payload) > 0 && &pkt.Payload[0] == &data[protocol.HeaderSize] {
+			t.Fatal("Payload aliases the input buffer")
+		}
+	})
+}
+
+// FuzzReassembler pushes an adversarial sequence of packets into a
+// Reassembler — duplicates, gaps, stale and near-wraparound SeqNums, in any
+// order — draining between pushes. Whatever is drained must be the
+// consecutive run 1, 2, 3, … with no duplicates or gaps.
+//
+// Each 5 bytes of input is one packet: a big-endian SeqNum and a flags byte
+// whose low bit skips the drain after that push.
+//
+//	go test ./tests -run '^$' -fuzz FuzzReassembler
+func FuzzReassembler(f *testing.F) {
+	f.Add(seqInput(1, 2, 3, 4))
+	f.Add(seqInput(3, 1, 2, 2, 1, 4))
+	f.Add(seqInput(5, 4, 3, 2, 1))
+	f.Add(seqInput(1, 0xFFFFFFFF, 2, 0xFFFFFFFE, 3))
+	f.Add(seqInput(0, 0, 1, 1, 0x80000000))
+	f.Add(seqInput(2, 1000000, 1, 3))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := adapter.NewReassembler()
+		var next uint32 = 1
+
+		drain := func() {
+			for _, pkt := range r.Drain() {
+				if pkt.SeqNum != next {
+					t.Fatalf("drained SeqNum %d, want %d", pkt.SeqNum, next)
+				}
+				if len(pkt.Payload) != int(pkt.SeqNum%251) {
+					t.Fatalf("SeqNum %d drained with the wrong payload", pkt.SeqNum)
+				}
+				next++
+			}
+		}
+
+		for len(data) >= 5 {
+			seq := binary.BigEndian.Uint32(data)
+			flags := data[4]
+			data = data[5:]
+
+			// The payload length is tied to the SeqNum so a duplicate always
+			// carries the same content, as it would from a bonded transport.
+			pkt := &protocol.Packet{Type: protocol.TypeData, SocketID: 1, SeqNum: seq, Payload: make([]byte, seq%251)}
+			if r.Push(pkt) {
+				t.Fatalf("buffer overflowed after a handful of packets")
+			}
+			if flags&1 == 0 {
+				drain()
+			}
+		}
+		drain()
+	})
+}
+
+// seqInput encodes SeqNums in FuzzReassembler's input format.
+func seqInput(seqs ...uint32) []byte {
+	var buf []byte
+	for _, seq := range seqs {
+		buf = binary.BigEndian.AppendUint32(buf, seq)
+		buf = append(buf, 0)
+	}
+	return buf
+}
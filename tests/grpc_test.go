@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/signaling"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// grpcSession runs a host serving gRPC and a client with the given PINs
+// within ctx and returns both results.
+func grpcSession(t *testing.T, ctx context.Context, hostPIN, clientPIN string) (hostErr, clientErr error) {
+	t.Helper()
+	l, err := signaling.ListenGRPC("127.0.0.1:0", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	return runSession(t, ctx,
+		sessionSide{opts: signaling.Options{Server: l, PIN: hostPIN}},
+		sessionSide{addr: fmt.Sprintf("grpc://127.0.0.1:%d", l.Port()), opts: signaling.Options{PIN: clientPIN}})
+}
+
+// TestGRPCSignaling checks that signaling runs over the gRPC service: the PIN
+// exchange and the SDP exchange, which need messages both ways, complete,
+// and a refusal reaches the client with its reason.
+func TestGRPCSignaling(t *testing.T) {
+	ctx, check := sdpExchange(t)
+	check(grpcSession(t, ctx, "482913", "482913"))
+
+	hostErr, clientErr := grpcSession(t, context.Background(), "482913", "111111")
+	if !errors.Is(hostErr, signaling.ErrPIN) {
+		t.Errorf("host: %v, want ErrPIN", hostErr)
+	}
+	if clientErr == nil || !strings.Contains(clientErr.Error(), "PIN") {
+		t.Errorf("client: %v, want a PIN refusal", clientErr)
+	}
+}
+
+// TestGRPCRefusesWhenBusy checks that a gRPC host with a client refuses the
+// next one as its WS server would.
+func TestGRPCRefusesWhenBusy(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	l, err := signaling.ListenGRPC("127.0.0.1:0", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	url := fmt.Sprintf("grpc://127.0.0.1:%d", l.Port())
+
+	// The first client is handed to the host, which never answers it. The
+	// host places a session before the client learns it is connected.
+	connected := eventSeen(t, func(ev util.Event) bool { return ev.Event == util.EventClientConnected })
+	go signaling.EstablishAsClient(ctx, url, signaling.Options{Timeout: 5 * time.Second})
+	select {
+	case <-connected:
+	case <-ctx.Done():
+		t.Fatal("the first client never connected")
+	}
+
+	_, err = signaling.EstablishAsClient(ctx, url, signaling.Options{Timeout: 5 * time.Second})
+	if err == nil || !strings.Contains(err.Error(), "already connected") {
+		t.Errorf("second client: %v, want an already connected refusal", err)
+	}
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/signaling"
+)
+
+// TestHandshakeDiagnostics checks that a failed WebSocket upgrade is reported
+// with what the server in the way answered: its status, its name and the
+// text of its page, or where it redirects to.
+func TestHandshakeDiagnostics(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		handler http.HandlerFunc
+		check   func(e *signaling.HandshakeError) bool
+	}{
+		{
+			name: "upgrade dropped",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Server", "nginx/1.25.3")
+				w.Header().Set("Content-Type", "text/html")
+				io.WriteString(w, "<html><head><style>body{color:red}</style></head><body><h1>Welcome to nginx!</h1>\n<p>It &amp; works.</p></body></html>")
+			},
+			check: func(e *signaling.HandshakeError) bool {
+				return e.StatusCode == http.StatusOK && e.Server == "nginx/1.25.3" && e.Reason == "Welcome to nginx! It & works."
+			},
+		},
+		{
+			name: "sign-in redirect",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, "https://login.example.com/oauth?next=/ws", http.StatusFound)
+			},
+			check: func(e *signaling.HandshakeError) bool {
+				return e.StatusCode == http.StatusFound && e.Location == "https://login.example.com/oauth?next=/ws"
+			},
+		},
+		{
+			name: "long body",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, strings.Repeat("bad gateway ", 100), http.StatusBadGateway)
+			},
+			check: func(e *signaling.HandshakeError) bool {
+				return e.StatusCode == http.StatusBadGateway && len([]rune(e.Reason)) <= 201 && strings.HasSuffix(e.Reason, "…")
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(tc.handler)
+			defer srv.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			_, err := signaling.EstablishAsClient(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", signaling.Options{})
+			var refused *signaling.HandshakeError
+			if !errors.As(err, &refused) {
+				t.Fatalf("EstablishAsClient error = %v, want a HandshakeError", err)
+			}
+			if !tc.check(refused) {
+				t.Errorf("HandshakeError = %+v", refused)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// TestHealthProbes checks that readiness follows the established state and
+// liveness fails only once the tunnel is closed.
+func TestHealthProbes(t *testing.T) {
+	srv := httptest.NewServer(util.HealthHandler())
+	defer srv.Close()
+	defer util.NotifyState(util.StateSignaling)
+
+	probe := func(path string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		return resp.StatusCode, strings.TrimSpace(string(body))
+	}
+
+	for _, tc := range []struct {
+		state       util.TunnelState
+		ready, live int
+	}{
+		{util.StateConnecting, http.StatusServiceUnavailable, http.StatusOK},
+		{util.StateEstablished, http.StatusOK, http.StatusOK},
+		{util.StateDegraded, http.StatusServiceUnavailable, http.StatusOK},
+		{util.StateReconnecting, http.StatusServiceUnavailable, http.StatusOK},
+		{util.StateClosed, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+	} {
+		util.NotifyState(tc.state)
+
+		if code, body := probe(util.ReadyPath); code != tc.ready || body != tc.state.String() {
+			t.Errorf("%s: readiness = %d %q, want %d %q", tc.state, code, body, tc.ready, tc.state)
+		}
+		if code, _ := probe(util.LivePath); code != tc.live {
+			t.Errorf("%s: liveness = %d, want %d", tc.state, code, tc.live)
+		}
+	}
+}
+
+// TestStatusHandler checks that the status page reports the state and the
+// open connections, and refuses anything but reading it.
+func TestStatusHandler(t *testing.T) {
+	srv := httptest.NewServer(util.StatusHandler())
+	defer srv.Close()
+	defer util.NotifyState(util.StateSignaling)
+
+	util.NotifyState(util.StateEstablished)
+	util.Stats.AddConn()
+	defer util.Stats.RemoveConn()
+
+	resp, err := http.Get(srv.URL + util.StatusPath)
+	if err != nil {
+		t.Fatalf("GET %s: %v", util.StatusPath, err)
+	}
+	defer resp.Body.Close()
+	var status util.Status
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("decoding the status: %v", err)
+	}
+	if status.State != "established" || status.Since.IsZero() {
+		t.Errorf("state = %q since %v, want established since the notification", status.State, status.Since)
+	}
+	if status.Connections < 1 || status.TotalConns < status.Connections {
+		t.Errorf("connections = %d of %d, want at least the one opened", status.Connections, status.TotalConns)
+	}
+
+	resp, err = http.Post(srv.URL+util.StatusPath, "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatalf("POST %s: %v", util.StatusPath, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
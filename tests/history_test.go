@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/history"
+)
+
+// TestHistoryAppendLoad verifies that appended sessions are read back in
+// order, and that a missing file is an empty history.
+func TestHistoryAppendLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "roj1", "history.jsonl")
+
+	sessions, err := history.Load(path)
+	if err != nil || len(sessions) != 0 {
+		t.Fatalf("Load(missing) = %v, %v; want empty", sessions, err)
+	}
+
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	want := []history.Session{
+		{Start: start, End: start.Add(time.Hour), Role: "host", Addr: "127.0.0.1:25565", Peer: "SHA256:abc", BytesIn: 100, BytesOut: 2000, Conns: 3, Reason: "closed"},
+		{Start: start.Add(2 * time.Hour), End: start.Add(150 * time.Minute), Role: "client", Addr: "127.0.0.1:5432", BytesIn: 50, Reason: "expired"},
+	}
+	for _, s := range want {
+		if err := history.Append(path, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := history.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("loaded %d sessions, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !got[i].Start.Equal(want[i].Start) || !got[i].End.Equal(want[i].End) {
+			t.Errorf("session %d times = %v–%v, want %v–%v", i, got[i].Start, got[i].End, want[i].Start, want[i].End)
+		}
+		got[i].Start, got[i].End = want[i].Start, want[i].End
+		if got[i] != want[i] {
+			t.Errorf("session %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+// TestHistoryLoadMalformed verifies that a corrupt line is reported with its
+// position instead of being skipped.
+func TestHistoryLoadMalformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	if err := os.WriteFile(path, []byte("{\"role\":\"host\"}\n\nnot json\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := history.Load(path); err == nil {
+		t.Fatal("Load succeeded on a malformed file")
+	} else if want := path + ":3:"; !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("error = %v, want it to start with %q", err, want)
+	}
+}
+
+// TestHistorySinceSum verifies filtering by end time and the usage totals.
+func TestHistorySinceSum(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	sessions := []history.Session{
+		{Start: start, End: start.Add(time.Hour), BytesIn: 1, BytesOut: 10, Conns: 1},
+		{Start: start.Add(24 * time.Hour), End: start.Add(26 * time.Hour), BytesIn: 2, BytesOut: 20, Conns: 2},
+		{Start: start.Add(48 * time.Hour), End: start.Add(51 * time.Hour), BytesIn: 4, BytesOut: 40, Conns: 4},
+	}
+
+	recent := history.Since(sessions, start.Add(26*time.Hour))
+	if len(recent) != 2 {
+		t.Fatalf("Since kept %d sessions, want 2", len(recent))
+	}
+
+	got := history.Sum(recent)
+	want := history.Total{Sessions: 2, Duration: 5 * time.Hour, BytesIn: 6, BytesOut: 60, Conns: 6}
+	if got != want {
+		t.Errorf("Sum = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/1ureka/roj1/internal/hosts"
+)
+
+// TestHostsAddRemove verifies that Add appends a marked entry, replaces its
+// own stale entry for the same name, and that Remove only deletes its own
+// entries.
+func TestHostsAddRemove(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	const original = "127.0.0.1\tlocalhost\n10.0.0.1\tmyapp.roj1.local\n"
+	if err := os.WriteFile(path, []byte(original), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hosts.Add(path, "127.0.0.1", "myapp.roj1.local"); err != nil {
+		t.Fatal(err)
+	}
+	if err := hosts.Add(path, "::1", "myapp.roj1.local"); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if want := original + "::1\tmyapp.roj1.local\t" + hosts.Marker + "\n"; string(data) != want {
+		t.Fatalf("after Add:\n%s\nwant:\n%s", data, want)
+	}
+
+	if err := hosts.Remove(path, "myapp.roj1.local"); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(path)
+	if string(data) != original {
+		t.Fatalf("after Remove:\n%s\nwant:\n%s", data, original)
+	}
+}
+
+// TestHostsConcurrentAdd checks that concurrent Adds keep each other's
+// entries and leave no temporary files behind.
+func TestHostsConcurrentAdd(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hosts")
+	if err := os.WriteFile(path, []byte("127.0.0.1\tlocalhost\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 16
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Go(func() {
+			if err := hosts.Add(path, "127.0.0.1", fmt.Sprintf("app%d.roj1.local", i)); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+
+	data, _ := os.ReadFile(path)
+	for i := range n {
+		if name := fmt.Sprintf("\tapp%d.roj1.local\t", i); !strings.Contains(string(data), name) {
+			t.Errorf("entry for app%d.roj1.local lost:\n%s", i, data)
+		}
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if e.Name() != "hosts" && !strings.HasSuffix(e.Name(), ".lock") {
+			t.Errorf("left behind %s", e.Name())
+		}
+	}
+}
+
+// TestHostsValidName checks hostname validation.
+func TestHostsValidName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"myapp.roj1.local": true,
+		"a-b.example":      true,
+		"localhost":        true,
+		"":                 false,
+		"-bad.example":     false,
+		"bad-.example":     false,
+		"a..b":             false,
+		"a b":              false,
+		"a\n127.0.0.1 b":   false,
+	} {
+		if got := hosts.ValidName(name); got != want {
+			t.Errorf("ValidName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// TestParseLang checks locale name normalization.
+func TestParseLang(t *testing.T) {
+	for in, want := range map[string]string{
+		"en":          util.LangEnglish,
+		"en_US.UTF-8": util.LangEnglish,
+		"C":           util.LangEnglish,
+		"zh-TW":       util.LangTraditionalChinese,
+		"zh_TW.UTF-8": util.LangTraditionalChinese,
+		"zh_HK":       util.LangTraditionalChinese,
+		"zh-Hant-TW":  util.LangTraditionalChinese,
+	} {
+		got, err := util.ParseLang(in)
+		if err != nil || got != want {
+			t.Errorf("ParseLang(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+
+	for _, in := range []string{"zh-CN", "fr", "xx"} {
+		if _, err := util.ParseLang(in); err == nil {
+			t.Errorf("ParseLang(%q) succeeded, want error", in)
+		}
+	}
+}
+
+// verb matches one fmt verb, with an optional explicit argument index.
+var verb = regexp.MustCompile(`%(\[\d+\])?[-+# 0]*\d*(\.\d+)?([a-zA-Z%])`)
+
+// sampleArgs returns one argument of a suitable type for each verb in format.
+func sampleArgs(format string) []any {
+	var args []any
+	for _, m := range verb.FindAllStringSubmatch(format, -1) {
+		switch m[3] {
+		case "%":
+		case "d", "x":
+			args = append(args, len(args)+1)
+		case "f":
+			args = append(args, 1.5)
+		case "v":
+			args = append(args, time.Second)
+		default:
+			args = append(args, "s")
+		}
+	}
+	return args
+}
+
+// TestCatalogVerbs checks that every translation takes the same arguments
+// as its English message.
+func TestCatalogVerbs(t *testing.T) {
+	catalog := util.Catalog(util.LangTraditionalChinese)
+	if len(catalog) == 0 {
+		t.Fatal("zh-TW catalog is empty")
+	}
+
+	for en, tr := range catalog {
+		args := sampleArgs(en)
+		if got := fmt.Sprintf(tr, args...); strings.Contains(got, "%!") {
+			t.Errorf("translation of %q is incompatible: %q", en, got)
+		}
+	}
+}
+
+// TestTr checks that Tr follows the selected language and falls back to
+// English.
+func TestTr(t *testing.T) {
+	defer util.SetLang(util.LangEnglish)
+
+	const msg = "tunnel negotiation failed"
+	util.SetLang(util.LangTraditionalChinese)
+	if got := util.Tr(msg); got == msg {
+		t.Errorf("Tr(%q) was not translated", msg)
+	}
+	if got := util.Tr("no such message"); got != "no such message" {
+		t.Errorf("untranslated message changed to %q", got)
+	}
+
+	util.SetLang(util.LangEnglish)
+	if got := util.Tr(msg); got != msg {
+		t.Errorf("English Tr(%q) = %q", msg, got)
+	}
+}
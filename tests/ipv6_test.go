@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/transport"
+)
+
+// requireIPv6 skips the test unless IPv6 loopback is available.
+func requireIPv6(t *testing.T) {
+	t.Helper()
+	l, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	l.Close()
+}
+
+// startEchoServerOn is startEchoServer listening on the given address.
+func startEchoServerOn(t *testing.T, ctx context.Context, addr string) string {
+	t.Helper()
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("echo server: listen failed: %v", err)
+	}
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// TestIPv6Tunnel bridges an IPv6 target to an IPv6 client listener, and
+// checks that a "localhost" listener accepts both loopback families.
+func TestIPv6Tunnel(t *testing.T) {
+	requireIPv6(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	echoAddr := startEchoServerOn(t, ctx, "[::1]:0")
+
+	t.Run("v6 only", func(t *testing.T) {
+		clientTr, hostTr := MockTransports()
+		defer clientTr.Close()
+		defer hostTr.Close()
+
+		if _, err := adapter.StartAsHost(ctx, hostTr, echoAddr); err != nil {
+			t.Fatalf("StartAsHost: %v", err)
+		}
+		h, err := adapter.StartAsClient(ctx, clientTr, "[::1]:0")
+		if err != nil {
+			t.Fatalf("StartAsClient: %v", err)
+		}
+		echoOnce(t, h.Addr().String(), 1)
+	})
+
+	t.Run("dual stack", func(t *testing.T) {
+		clientTr, hostTr := MockTransports()
+		defer clientTr.Close()
+		defer hostTr.Close()
+
+		if _, err := adapter.StartAsHost(ctx, hostTr, echoAddr); err != nil {
+			t.Fatalf("StartAsHost: %v", err)
+		}
+		h, err := adapter.StartAsClient(ctx, clientTr, "localhost:0")
+		if err != nil {
+			t.Fatalf("StartAsClient: %v", err)
+		}
+
+		_, port, _ := net.SplitHostPort(h.Addr().String())
+		echoOnce(t, net.JoinHostPort("127.0.0.1", port), 2)
+		echoOnce(t, net.JoinHostPort("::1", port), 3)
+	})
+}
+
+// TestParseICENetwork checks the ICE network names round-trip.
+func TestParseICENetwork(t *testing.T) {
+	for _, n := range []transport.ICENetwork{transport.ICEAny, transport.ICEIPv4, transport.ICEIPv6} {
+		got, err := transport.ParseICENetwork(n.String())
+		if err != nil || got != n {
+			t.Errorf("ParseICENetwork(%q) = %v, %v; want %v", n.String(), got, err, n)
+		}
+	}
+	if _, err := transport.ParseICENetwork("ipx"); err == nil {
+		t.Error("ParseICENetwork(\"ipx\"): got nil error")
+	}
+}
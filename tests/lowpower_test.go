@@ -0,0 +1,193 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/transport"
+)
+
+// Footprint of one open connection with the low-power preset, with both
+// tunnel ends and the echo target in this process, as documented in the
+// README under -lowPower. The memory bound leaves room for GC timing, as
+// the measurement is of the whole process. The goroutines are the adapters'
+// own: three at each end, and one to spare for a timer that fires meanwhile.
+const (
+	lowPowerConnBytes      = 192 * 1024
+	lowPowerConnGoroutines = 7
+)
+
+// TestLowPowerFootprint opens the preset's maximum number of connections
+// through a client and host adapter linked by a transport.Pipe, each after
+// echoing some data, and checks that the heap and stack memory and the
+// adapter goroutines they hold stay within the documented footprint.
+func TestLowPowerFootprint(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	echoAddr := startEchoServer(t, ctx)
+	clientTr, hostTr := transport.NewPipe()
+	defer clientTr.Close()
+
+	reassembly := adapter.Reassembly{
+		MaxSocketBytes: adapter.LowPowerMaxSocketBytes,
+		MaxTotalBytes:  adapter.LowPowerMaxTotalBytes,
+	}
+	if _, err := adapter.StartAsHostWith(ctx, hostTr, echoAddr, adapter.HostConfig{
+		Quotas:     adapter.Quotas{MaxSockets: adapter.LowPowerMaxSockets},
+		Reassembly: reassembly,
+	}); err != nil {
+		t.Fatalf("StartAsHostWith: %v", err)
+	}
+	h, err := adapter.StartAsClientWith(ctx, clientTr, "127.0.0.1:0", adapter.ClientConfig{Reassembly: reassembly})
+	if err != nil {
+		t.Fatalf("StartAsClientWith: %v", err)
+	}
+
+	before, goroutines := footprint()
+
+	data := makeTestData(64*1024, 7)
+	conns := make([]net.Conn, 0, adapter.LowPowerMaxSockets)
+	defer func() {
+		for _, c := range conns {
+			c.Close()
+		}
+	}()
+	for range adapter.LowPowerMaxSockets {
+		c, err := net.Dial("tcp", h.Addr().String())
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		conns = append(conns, c)
+
+		go c.Write(data)
+		got := make([]byte, len(data))
+		c.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := io.ReadFull(c, got); err != nil {
+			t.Fatalf("echo: %v", err)
+		}
+	}
+
+	// The writers above finish on their own; only the adapters' goroutines
+	// are counted, and those are in place once the echo is back.
+	after, goroutinesAfter := footprint()
+	perConn := (int64(after) - int64(before)) / adapter.LowPowerMaxSockets
+	perConnG := float64(goroutinesAfter-goroutines) / adapter.LowPowerMaxSockets
+	t.Logf("per connection: %d KiB, %.1f goroutines", perConn/1024, perConnG)
+
+	if perConn > lowPowerConnBytes {
+		t.Errorf("%d bytes per connection, want at most %d", perConn, lowPowerConnBytes)
+	}
+	if perConnG > lowPowerConnGoroutines {
+		t.Errorf("%.1f goroutines per connection, want at most %d", perConnG, lowPowerConnGoroutines)
+	}
+}
+
+// TestLowPowerSlowReader uploads four times LowPowerMaxSocketBytes without
+// retransmission to a target that reads slowly, and checks that all of it
+// arrives: data in order that waits for the reader must not count against
+// the reorder buffer limits and reset the connection.
+func TestLowPowerSlowReader(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		c.(*net.TCPConn).SetReadBuffer(16 * 1024)
+
+		var got []byte
+		buf := make([]byte, 16*1024)
+		for {
+			n, err := c.Read(buf)
+			got = append(got, buf[:n]...)
+			if err != nil {
+				received <- got
+				return
+			}
+			time.Sleep(2 * time.Millisecond)
+		}
+	}()
+
+	clientTr, hostTr := transport.NewPipe()
+	defer clientTr.Close()
+
+	reassembly := adapter.Reassembly{
+		MaxSocketBytes: adapter.LowPowerMaxSocketBytes,
+		MaxTotalBytes:  adapter.LowPowerMaxTotalBytes,
+	}
+	if _, err := adapter.StartAsHostWith(ctx, hostTr, l.Addr().String(), adapter.HostConfig{Reassembly: reassembly}); err != nil {
+		t.Fatalf("StartAsHostWith: %v", err)
+	}
+	h, err := adapter.StartAsClientWith(ctx, clientTr, "127.0.0.1:0", adapter.ClientConfig{Reassembly: reassembly})
+	if err != nil {
+		t.Fatalf("StartAsClientWith: %v", err)
+	}
+
+	c, err := net.Dial("tcp", h.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	data := makeTestData(4*adapter.LowPowerMaxSocketBytes, 9)
+	if _, err := c.Write(data); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	c.Close()
+
+	select {
+	case got := <-received:
+		if len(got) != len(data) {
+			t.Fatalf("target received %d bytes, want %d", len(got), len(data))
+		}
+		if !bytes.Equal(got, data) {
+			t.Error("received data does not match")
+		}
+	case <-ctx.Done():
+		t.Fatal("upload did not finish")
+	}
+}
+
+// footprint returns the heap and stack memory in use after a GC, and the
+// number of goroutines running adapter code.
+func footprint() (uint64, int) {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapInuse + m.StackInuse, adapterGoroutines()
+}
+
+// adapterGoroutines returns the number of goroutines with internal/adapter
+// code on their stack, leaving out the test's and the echo server's.
+func adapterGoroutines() int {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	n := 0
+	for _, g := range bytes.Split(buf, []byte("\n\n")) {
+		if bytes.Contains(g, []byte("/internal/adapter.")) {
+			n++
+		}
+	}
+	return n
+}
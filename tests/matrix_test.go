@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/signaling"
+)
+
+// matrixHomeserver is a minimal Matrix homeserver with a single room, which
+// accepts the access token "good" and rate-limits every first send.
+type matrixHomeserver struct {
+	mu      sync.Mutex
+	changed chan struct{} // closed and replaced when an event is posted
+	events  []json.RawMessage
+	limited map[string]bool // transactions refused once
+}
+
+func startMatrixHomeserver(t *testing.T) string {
+	t.Helper()
+	hs := &matrixHomeserver{changed: make(chan struct{}), limited: map[string]bool{}}
+	srv := httptest.NewServer(hs)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func (hs *matrixHomeserver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/_matrix/client/v3")
+	if r.Header.Get("Authorization") != "Bearer good" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"errcode": "M_UNKNOWN_TOKEN", "error": "Invalid access token"})
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && strings.HasPrefix(path, "/join/"):
+		json.NewEncoder(w).Encode(map[string]string{"room_id": "!room:test"})
+
+	case r.Method == http.MethodPut && strings.HasPrefix(path, "/rooms/!room:test/send/"):
+		parts := strings.Split(path, "/")
+		txn := parts[len(parts)-1]
+		var content json.RawMessage
+		json.NewDecoder(r.Body).Decode(&content)
+
+		hs.mu.Lock()
+		defer hs.mu.Unlock()
+		if !hs.limited[txn] {
+			hs.limited[txn] = true
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]any{"errcode": "M_LIMIT_EXCEEDED", "error": "Too many requests", "retry_after_ms": 20})
+			return
+		}
+		ev, _ := json.Marshal(map[string]any{"type": parts[len(parts)-2], "content": content})
+		hs.events = append(hs.events, ev)
+		close(hs.changed)
+		hs.changed = make(chan struct{})
+		json.NewEncoder(w).Encode(map[string]string{"event_id": "$" + strconv.Itoa(len(hs.events))})
+
+	case r.Method == http.MethodGet && path == "/sync":
+		since, _ := strconv.Atoi(r.URL.Query().Get("since"))
+		hs.mu.Lock()
+		if r.URL.Query().Has("since") && len(hs.events) == since {
+			changed := hs.changed
+			hs.mu.Unlock()
+			select {
+			case <-changed:
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+			hs.mu.Lock()
+		}
+		events := hs.events[min(since, len(hs.events)):]
+		if !r.URL.Query().Has("since") {
+			events = nil
+		}
+		resp := map[string]any{"next_batch": strconv.Itoa(len(hs.events))}
+		hs.mu.Unlock()
+		resp["rooms"] = map[string]any{"join": map[string]any{"!room:test": map[string]any{"timeline": map[string]any{"events": events}}}}
+		json.NewEncoder(w).Encode(resp)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// matrixSession runs a host and a client with the given PINs through a
+// Matrix room within ctx and returns both results. The client joins first,
+// so that the host only sees its announcement through the answer.
+func matrixSession(t *testing.T, ctx context.Context, hostPIN, clientPIN string) (hostErr, clientErr error) {
+	t.Helper()
+	cfg := signaling.MatrixConfig{Room: "#roj1:test", Token: "good", Homeserver: startMatrixHomeserver(t)}
+
+	client, err := signaling.DialMatrix(ctx, cfg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, err := signaling.DialMatrix(ctx, cfg, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return runSession(t, ctx,
+		sessionSide{opts: signaling.Options{Signaler: host, PIN: hostPIN}},
+		sessionSide{addr: cfg.Room, opts: signaling.Options{Signaler: client, PIN: clientPIN}})
+}
+
+// TestMatrixSignaling checks that signaling runs through a Matrix room,
+// rate limits notwithstanding: the PIN exchange and the SDP exchange, which
+// need messages both ways, complete, and a refusal reaches the client with
+// its reason.
+func TestMatrixSignaling(t *testing.T) {
+	ctx, check := sdpExchange(t)
+	check(matrixSession(t, ctx, "482913", "482913"))
+
+	hostErr, clientErr := matrixSession(t, context.Background(), "482913", "111111")
+	if !errors.Is(hostErr, signaling.ErrPIN) {
+		t.Errorf("host: %v, want ErrPIN", hostErr)
+	}
+	if clientErr == nil || !strings.Contains(clientErr.Error(), "PIN") {
+		t.Errorf("client: %v, want a PIN refusal", clientErr)
+	}
+}
+
+// TestMatrixRooms checks which rooms DialMatrix accepts and that a refused
+// token is reported with the homeserver's reason.
+func TestMatrixRooms(t *testing.T) {
+	for _, room := range []string{"#roj1:example.org", "!abc:example.org:8448"} {
+		if err := signaling.ValidMatrixRoom(room); err != nil {
+			t.Errorf("%s: %v", room, err)
+		}
+	}
+	for _, room := range []string{"roj1:example.org", "#roj1", "#roj1:", "@user:example.org"} {
+		if signaling.ValidMatrixRoom(room) == nil {
+			t.Errorf("%s accepted", room)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cfg := signaling.MatrixConfig{Room: "#roj1:test", Token: "bad", Homeserver: startMatrixHomeserver(t)}
+	if _, err := signaling.DialMatrix(ctx, cfg, true); err == nil || !strings.Contains(err.Error(), "Invalid access token") {
+		t.Errorf("dial with a refused token: %v", err)
+	}
+}
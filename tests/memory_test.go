@@ -0,0 +1,44 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/protocol"
+)
+
+// TestMemoryLimit checks that a CONNECT is refused with CLOSE while memory
+// use is over the limit given to WatchMemory, and accepted again once the
+// watchdog stops.
+func TestMemoryLimit(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	p, _ := startRawPeer(t, ctx, adapter.HostConfig{})
+
+	// Any running process uses more than 1 MiB, so the limit is reached
+	// on the first sample.
+	wctx, stop := context.WithCancel(ctx)
+	adapter.WatchMemory(wctx, 1<<20)
+
+	p.SendConnect(1, 1)
+	if pkt := p.expect(t, 1, protocol.TypeClose); pkt.SeqNum != 1 {
+		t.Errorf("CLOSE SeqNum = %d, want 1", pkt.SeqNum)
+	}
+
+	stop()
+	deadline := time.Now().Add(5 * time.Second)
+	for id := uint32(2); ; id++ {
+		p.SendConnect(id, 1)
+		pkt := p.next(t, id, func(*protocol.Packet) bool { return true })
+		if pkt.Type == protocol.TypeConnect {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("connections still refused after the watchdog stopped")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
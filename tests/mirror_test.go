@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+)
+
+// TestMirrorFile verifies that a mirrored connection's bytes are recorded in
+// both directions.
+func TestMirrorFile(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	path := filepath.Join(t.TempDir(), "mirror.log")
+	mirror, err := adapter.NewMirror(path, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mirror.Close()
+
+	clientTr, hostTr := MockTransports()
+	defer clientTr.Close()
+	defer hostTr.Close()
+
+	host, err := adapter.StartAsHostWith(ctx, hostTr, startEchoServer(t, ctx), adapter.HostConfig{Mirror: mirror})
+	if err != nil {
+		t.Fatalf("StartAsHostWith: %v", err)
+	}
+	client, err := adapter.StartAsClient(ctx, clientTr, "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("StartAsClient: %v", err)
+	}
+	echoOnce(t, client.Addr().String(), 1)
+
+	// Wait for the sockets to close, so that every write was recorded.
+	closeCtx, closeCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer closeCancel()
+	client.Close(closeCtx)
+	host.Close(closeCtx)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := string(makeTestData(64*1024, 1))
+	var in, out strings.Builder
+	for rest := string(data); rest != ""; {
+		header, body, _ := strings.Cut(rest, "\n")
+		fields := strings.Fields(header)
+		if len(fields) != 5 || fields[3] != "target" {
+			t.Fatalf("malformed record header %q", header)
+		}
+		var n int
+		if _, err := fmt.Sscan(fields[4], &n); err != nil || n > len(body) {
+			t.Fatalf("malformed record size in %q", header)
+		}
+		if fields[2] == "→" {
+			in.WriteString(body[:n])
+		} else {
+			out.WriteString(body[:n])
+		}
+		rest = strings.TrimPrefix(body[n:], "\n")
+	}
+	if in.String() != sent || out.String() != sent {
+		t.Fatalf("mirrored %d bytes to the target and %d back, want %d each", in.Len(), out.Len(), len(sent))
+	}
+}
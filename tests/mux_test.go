@@ -0,0 +1,192 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/mux"
+)
+
+// muxPair returns a client and server session over an in-memory pipe.
+func muxPair(t *testing.T) (client, server *mux.Session) {
+	t.Helper()
+	a, b := net.Pipe()
+	client, server = mux.Client(a), mux.Server(b)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+// TestMuxStreams echoes payloads larger than the receive window over several
+// concurrent streams, ending each with a half-close: the echo side must still
+// be able to send after reading EOF.
+func TestMuxStreams(t *testing.T) {
+	client, server := muxPair(t)
+
+	go func() {
+		for {
+			st, err := server.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer st.Close()
+				io.Copy(st, st)
+				st.CloseWrite()
+			}()
+		}
+	}()
+
+	const numStreams = 4
+	const dataSize = 4 * mux.InitialWindow
+
+	var wg sync.WaitGroup
+	for i := range numStreams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			st, err := client.Open()
+			if err != nil {
+				t.Errorf("[stream %d] open: %v", i, err)
+				return
+			}
+			defer st.Close()
+
+			sent := makeTestData(dataSize, byte(i))
+			go func() {
+				st.Write(sent)
+				st.CloseWrite()
+			}()
+
+			st.SetReadDeadline(time.Now().Add(10 * time.Second))
+			got, err := io.ReadAll(st)
+			if err != nil {
+				t.Errorf("[stream %d] read: %v", i, err)
+				return
+			}
+			if !bytes.Equal(sent, got) {
+				t.Errorf("[stream %d] echoed data mismatch (sent %d bytes, got %d bytes)", i, len(sent), len(got))
+			}
+		}()
+	}
+	wg.Wait()
+
+	deadline := time.Now().Add(time.Second)
+	for client.NumStreams() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := client.NumStreams(); n != 0 {
+		t.Errorf("NumStreams = %d after all streams closed, want 0", n)
+	}
+}
+
+// TestMuxFlowControl verifies that a writer blocks once the peer's receive
+// window is full, instead of buffering without bound.
+func TestMuxFlowControl(t *testing.T) {
+	client, server := muxPair(t)
+
+	st, err := client.Open()
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	peer, err := server.Accept()
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+
+	st.SetWriteDeadline(time.Now().Add(200 * time.Millisecond))
+	n, err := st.Write(make([]byte, 2*mux.InitialWindow))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Write error = %v, want a deadline error", err)
+	}
+	if n != mux.InitialWindow {
+		t.Fatalf("wrote %d bytes before blocking, want %d", n, mux.InitialWindow)
+	}
+
+	// Reading frees the window again.
+	st.SetWriteDeadline(time.Time{})
+	go io.Copy(io.Discard, peer)
+	if _, err := st.Write(make([]byte, mux.InitialWindow)); err != nil {
+		t.Fatalf("Write after the peer read: %v", err)
+	}
+}
+
+// TestMuxReset verifies that closing a stream the peer is still writing to
+// resets it.
+func TestMuxReset(t *testing.T) {
+	client, server := muxPair(t)
+
+	st, err := client.Open()
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	peer, err := server.Accept()
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	peer.Close()
+
+	st.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := st.Read(make([]byte, 1)); !errors.Is(err, mux.ErrStreamReset) {
+		t.Fatalf("Read error = %v, want %v", err, mux.ErrStreamReset)
+	}
+	if _, err := st.Write([]byte("x")); !errors.Is(err, mux.ErrStreamReset) {
+		t.Fatalf("Write error = %v, want %v", err, mux.ErrStreamReset)
+	}
+}
+
+// TestMuxTunnel runs the echo test through the adapter in multiplexed mode,
+// then checks that a graceful Close completes once the connections are done.
+func TestMuxTunnel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	echoAddr := startEchoServer(t, ctx)
+	clientTr, hostTr := MockTransports()
+	defer clientTr.Close()
+	defer hostTr.Close()
+
+	host, err := adapter.StartAsHost(ctx, hostTr, echoAddr)
+	if err != nil {
+		t.Fatalf("StartAsHost: %v", err)
+	}
+	client, err := adapter.StartAsClientWith(ctx, clientTr, "127.0.0.1:0", adapter.ClientConfig{
+		ConnectTimeout: adapter.DefaultConnectTimeout,
+		Mux:            true,
+	})
+	if err != nil {
+		t.Fatalf("StartAsClientWith: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := echo(client.Addr().String(), byte(i)); err != nil {
+				t.Errorf("[conn %d] %v", i, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	closeCtx, closeCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer closeCancel()
+	if err := client.Close(closeCtx); err != nil {
+		t.Errorf("client Close: %v", err)
+	}
+	if err := host.Close(closeCtx); err != nil {
+		t.Errorf("host Close: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/protocol"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// TestNack checks both halves of retransmission: the host requests a gap in
+// what it received, and resends what it sent when the peer requests it.
+func TestNack(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	p, _ := startRawPeer(t, ctx, adapter.HostConfig{Nack: true})
+	p.SendConnect(1, 1)
+	p.expect(t, 1, protocol.TypeConnect)
+
+	// Packet 2 is "lost": the host asks for it.
+	p.SendData(1, 3, []byte("world"))
+	nack := p.expect(t, 1, protocol.TypeNack)
+	if first, last := protocol.NackRange(nack.Payload); first != 2 || last != 2 {
+		t.Fatalf("NACK for %d-%d, want 2-2", first, last)
+	}
+	p.SendData(1, 2, []byte("hello "))
+	echo := string(p.expect(t, 1, protocol.TypeData).Payload)
+	for len(echo) < len("hello world") {
+		echo += string(p.expect(t, 1, protocol.TypeData).Payload)
+	}
+	if echo != "hello world" {
+		t.Fatalf("echo = %q, want %q", echo, "hello world")
+	}
+
+	// The host resends its CONNECT answer (SeqNum 1) on request.
+	p.SendNack(1, 1, 1)
+	if got := p.expect(t, 1, protocol.TypeConnect); got.SeqNum != 1 {
+		t.Errorf("resent CONNECT has SeqNum %d, want 1", got.SeqNum)
+	}
+}
+
+// TestNackValidation checks that NACKs for an empty or reversed range count
+// as violations.
+func TestNackValidation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	p, _ := startRawPeer(t, ctx, adapter.HostConfig{Nack: true})
+	violations := util.Stats.Violations.Load()
+
+	p.SendConnect(1, 1)
+	p.expect(t, 1, protocol.TypeConnect)
+	p.SendNack(1, 0, 1)
+	p.SendNack(1, 3, 2)
+	p.expectNone(t, 1, 300*time.Millisecond)
+
+	if got := util.Stats.Violations.Load() - violations; got != 2 {
+		t.Errorf("Violations grew by %d, want 2", got)
+	}
+}
@@ -0,0 +1,44 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/signaling"
+)
+
+// TestNegotiateTimeout checks that a client whose host never answers gives up
+// after NegotiateTimeout rather than the much longer Timeout.
+func TestNegotiateTimeout(t *testing.T) {
+	host, client := memSignalers() // nobody reads host
+	defer host.Close()
+
+	start := time.Now()
+	tr, err := signaling.EstablishAsClient(context.Background(), "", signaling.Options{
+		Signaler:         client,
+		Timeout:          time.Minute,
+		NegotiateTimeout: 300 * time.Millisecond,
+	})
+	closeCarrier(tr)
+	if !errors.Is(err, signaling.ErrTimeout) || errors.Is(err, signaling.ErrCancelled) {
+		t.Fatalf("EstablishAsClient error = %v, want ErrTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("gave up after %v, want about 300ms", elapsed)
+	}
+}
+
+// TestNegotiateTimeoutSparesHostWait checks that the negotiation timeout does
+// not start while the host waits for a client.
+func TestNegotiateTimeoutSparesHostWait(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	tr, _, err := signaling.EstablishAsHost(ctx, "127.0.0.1:0", signaling.Options{NegotiateTimeout: 100 * time.Millisecond})
+	closeCarrier(tr)
+	if !errors.Is(err, signaling.ErrCancelled) || errors.Is(err, signaling.ErrTimeout) {
+		t.Fatalf("EstablishAsHost error = %v, want ErrCancelled once the caller gave up", err)
+	}
+}
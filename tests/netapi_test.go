@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+)
+
+// Compile-time interface check.
+var _ net.Listener = (*adapter.Listener)(nil)
+
+// TestDialerAndListener tunnels an echo between an in-process Dialer and
+// Listener, with one socket per connection and with the multiplexer.
+func TestDialerAndListener(t *testing.T) {
+	for _, useMux := range []bool{false, true} {
+		t.Run(map[bool]string{false: "sockets", true: "mux"}[useMux], func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+			defer cancel()
+
+			clientTr, hostTr := MockTransports()
+			defer clientTr.Close()
+			defer hostTr.Close()
+
+			ln := adapter.Listen(ctx, hostTr, adapter.HostConfig{})
+			defer ln.Close()
+			go func() {
+				for {
+					conn, err := ln.Accept()
+					if err != nil {
+						return
+					}
+					go func() {
+						defer conn.Close()
+						io.Copy(conn, conn)
+					}()
+				}
+			}()
+
+			d := adapter.NewDialer(ctx, clientTr, adapter.ClientConfig{Mux: useMux})
+			for i := range 3 {
+				conn, err := d.DialContext(ctx, "tcp", "ignored:0")
+				if err != nil {
+					t.Fatalf("[conn %d] dial: %v", i, err)
+				}
+
+				sent := makeTestData(64*1024, byte(i))
+				go conn.Write(sent)
+
+				got := make([]byte, len(sent))
+				conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+				if _, err := io.ReadFull(conn, got); err != nil {
+					t.Fatalf("[conn %d] read echo: %v", i, err)
+				}
+				if !bytes.Equal(sent, got) {
+					t.Fatalf("[conn %d] echoed data mismatch", i)
+				}
+				conn.Close()
+			}
+
+			if err := d.Close(ctx); err != nil {
+				t.Errorf("Dialer Close: %v", err)
+			}
+		})
+	}
+}
+
+// TestDialerRefused verifies that dialing fails with ErrRefused when the host
+// cannot reach its target.
+func TestDialerRefused(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	clientTr, hostTr := MockTransports()
+	defer clientTr.Close()
+	defer hostTr.Close()
+
+	if _, err := adapter.StartAsHost(ctx, hostTr, getFreeAddr(t)); err != nil {
+		t.Fatalf("StartAsHost: %v", err)
+	}
+	d := adapter.NewDialer(ctx, clientTr, adapter.ClientConfig{})
+
+	if _, err := d.DialContext(ctx, "tcp", ""); !errors.Is(err, adapter.ErrRefused) {
+		t.Fatalf("DialContext error = %v, want %v", err, adapter.ErrRefused)
+	}
+}
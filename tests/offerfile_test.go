@@ -0,0 +1,51 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/signaling"
+)
+
+// TestOfferFileRejected checks that the client refuses offer files it cannot
+// use before creating a Transport, and writes no answer for them.
+func TestOfferFileRejected(t *testing.T) {
+	dir := t.TempDir()
+	answer := filepath.Join(dir, "reply.json")
+
+	for name, tc := range map[string]struct {
+		content string // "" = no file
+		want    error
+	}{
+		"missing":       {"", signaling.ErrSignaling},
+		"not json":      {"v=0\r\n", signaling.ErrSignaling},
+		"answer":        {`{"type":"answer","sdp":"v=0"}`, signaling.ErrSignaling},
+		"no sdp":        {`{"type":"offer"}`, signaling.ErrSignaling},
+		"major version": {`{"type":"offer","sdp":"v=0","version":"9.0.0"}`, signaling.ErrVersion},
+	} {
+		t.Run(name, func(t *testing.T) {
+			offer := filepath.Join(dir, name+".json")
+			if tc.content != "" {
+				if err := os.WriteFile(offer, []byte(tc.content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err := signaling.EstablishAsClientByFile(context.Background(), offer, answer, signaling.Options{
+				Version:       "1.0.0",
+				StrictVersion: true,
+				Timeout:       5 * time.Second,
+			})
+			if !errors.Is(err, tc.want) {
+				t.Errorf("EstablishAsClientByFile: %v, want %v", err, tc.want)
+			}
+			if _, err := os.Stat(answer); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("an answer was written: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/1ureka/roj1/internal/signaling"
+)
+
+// recordingProxy forwards WebSocket messages between a client and the host's
+// WS server at hostURL, like a relay would, and records the type of each.
+type recordingProxy struct {
+	mu    sync.Mutex
+	types []string // "<direction> <type>", direction being "up" (to the host) or "down"
+}
+
+// record notes a message forwarded in direction dir.
+func (p *recordingProxy) record(dir string, data []byte) {
+	typ := "?"
+	if i := strings.Index(string(data), `"type":"`); i >= 0 {
+		rest := string(data[i+len(`"type":"`):])
+		typ = rest[:strings.IndexByte(rest, '"')]
+	}
+	p.mu.Lock()
+	p.types = append(p.types, dir+" "+typ)
+	p.mu.Unlock()
+}
+
+// seen returns the messages forwarded so far.
+func (p *recordingProxy) seen() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.types...)
+}
+
+// startRecordingProxy starts a recordingProxy to the host at hostURL and
+// returns it with the URL clients dial.
+func startRecordingProxy(t *testing.T, hostURL string) (*recordingProxy, string) {
+	t.Helper()
+
+	p := &recordingProxy{}
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer client.Close()
+		host, _, err := websocket.DefaultDialer.Dial(hostURL, nil)
+		if err != nil {
+			return
+		}
+		defer host.Close()
+
+		pipe := func(dir string, src, dst *websocket.Conn) {
+			for {
+				typ, data, err := src.ReadMessage()
+				if err != nil {
+					if ce, ok := err.(*websocket.CloseError); ok {
+						dst.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(ce.Code, ce.Text))
+					}
+					dst.Close()
+					return
+				}
+				p.record(dir, data)
+				if dst.WriteMessage(typ, data) != nil {
+					src.Close()
+					return
+				}
+			}
+		}
+		go pipe("down", host, client)
+		pipe("up", client, host)
+	}))
+	t.Cleanup(srv.Close)
+
+	return p, "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+}
+
+// freeAddr returns a loopback address with a port nothing listens on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// pinSession runs a host and a client with the given PINs through a
+// recording proxy within ctx and returns both results.
+func pinSession(t *testing.T, ctx context.Context, hostPIN, clientPIN string) (hostErr, clientErr error, p *recordingProxy) {
+	t.Helper()
+	addr := freeAddr(t)
+	p, proxyURL := startRecordingProxy(t, fmt.Sprintf("ws://%s/ws", addr))
+	hostErr, clientErr = runSession(t, ctx,
+		sessionSide{addr: addr, opts: signaling.Options{PIN: hostPIN}},
+		sessionSide{addr: proxyURL, opts: signaling.Options{PIN: clientPIN}})
+	return hostErr, clientErr, p
+}
+
+// TestPINSealsSignaling checks that with matching PINs, the SDP exchange
+// completes and nothing but the PIN exchange crosses the proxy in the clear.
+func TestPINSealsSignaling(t *testing.T) {
+	ctx, check := sdpExchange(t)
+	hostErr, clientErr, p := pinSession(t, ctx, "482913", "482913")
+	check(hostErr, clientErr)
+
+	seen := p.seen()
+	var sealed bool
+	for i, s := range seen {
+		switch {
+		case i < 3 && strings.HasSuffix(s, " pake"):
+		case strings.HasSuffix(s, " sealed"):
+			sealed = true
+		default:
+			t.Errorf("message %d crossed the proxy as %q, want only the PIN exchange in the clear", i, s)
+		}
+	}
+	if !sealed {
+		t.Errorf("no sealed messages crossed the proxy: %v", seen)
+	}
+}
+
+// TestPINMismatch checks that differing or missing PINs fail signaling with
+// ErrPIN before any session description is sent.
+func TestPINMismatch(t *testing.T) {
+	for _, tc := range []struct {
+		name, host, client string
+	}{
+		{"different", "482913", "111111"},
+		{"client without", "482913", ""},
+		{"host without", "", "482913"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hostErr, clientErr, p := pinSession(t, context.Background(), tc.host, tc.client)
+			if !errors.Is(hostErr, signaling.ErrPIN) {
+				t.Errorf("host: %v, want ErrPIN", hostErr)
+			}
+			if clientErr == nil {
+				t.Error("client succeeded")
+			}
+			if tc.host == "" {
+				return // the host's offer is in the clear without a PIN
+			}
+			for _, s := range p.seen() {
+				if strings.HasSuffix(s, " offer") || strings.HasSuffix(s, " sealed") {
+					t.Errorf("%q crossed the proxy despite the PIN mismatch", s)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/identity"
+	"github.com/1ureka/roj1/internal/protocol"
+	"github.com/1ureka/roj1/internal/transport"
+)
+
+// TestAuthorizedKeyPolicy checks that options before a key become its policy.
+func TestAuthorizedKeyPolicy(t *testing.T) {
+	key := newKey(t)
+	pub := key.Public().(ed25519.PublicKey)
+
+	keys, err := identity.ParseAuthorizedKeys(strings.NewReader(
+		"ports=5432,6379 bandwidth=10M sockets=8 session=2h " + identity.MarshalPublicKey(pub) + " ci\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, _ := keys.Lookup(pub)
+	p := k.Policy
+	if len(p.Ports) != 2 || p.Ports[0] != 5432 || p.Ports[1] != 6379 ||
+		p.MaxBandwidth != 10<<20 || p.MaxSockets != 8 || p.MaxSession != 2*time.Hour || k.Comment != "ci" {
+		t.Errorf("parsed %+v", k)
+	}
+
+	for _, opt := range []string{"ports=0", "bandwidth=fast", "sockets=-1", "session=0s", "color=red"} {
+		line := opt + " " + identity.MarshalPublicKey(pub) + "\n"
+		if _, err := identity.ParseAuthorizedKeys(strings.NewReader(line)); err == nil {
+			t.Errorf("option %q accepted", opt)
+		}
+	}
+}
+
+// TestPolicyPorts checks that a CONNECT to a target port outside the policy
+// is answered with CLOSE.
+func TestPolicyPorts(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	p, _ := startRawPeer(t, ctx, adapter.HostConfig{Policy: adapter.Policy{Ports: []int{1}}})
+	p.SendConnect(1, 1)
+	if pkt := p.expect(t, 1, protocol.TypeClose); pkt.SeqNum != 1 {
+		t.Errorf("refusal CLOSE has SeqNum %d, want 1", pkt.SeqNum)
+	}
+}
+
+// TestPolicyBandwidth checks that data from the peer is delayed to the
+// bandwidth cap.
+func TestPolicyBandwidth(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	const chunk = 16 * 1024
+	p, _ := startRawPeer(t, ctx, adapter.HostConfig{Policy: adapter.Policy{MaxBandwidth: 2 * chunk}})
+
+	// A one-second burst (two chunks) passes at once; two more take a second.
+	start := time.Now()
+	p.SendConnect(1, 1)
+	p.expect(t, 1, protocol.TypeConnect)
+	for seq := uint32(2); seq < 6; seq++ {
+		p.SendData(1, seq, make([]byte, chunk))
+	}
+
+	var echoed int
+	for echoed < 4*chunk {
+		echoed += len(p.expect(t, 1, protocol.TypeData).Payload)
+	}
+	if elapsed := time.Since(start); elapsed < 800*time.Millisecond {
+		t.Errorf("4 chunks at 2 chunks/s took %v, want about 1s", elapsed)
+	}
+}
+
+// TestPolicySession checks that the tunnel is closed at the session limit,
+// and that RunAsHostWith reports it.
+func TestPolicySession(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	echoAddr := startEchoServer(t, ctx)
+	a, b := transport.NewPipe()
+	defer a.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- adapter.RunAsHostWith(ctx, b, echoAddr, adapter.HostConfig{
+			Policy: adapter.Policy{MaxSession: 200 * time.Millisecond},
+		})
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, adapter.ErrSessionLimit) {
+			t.Errorf("RunAsHostWith = %v, want ErrSessionLimit", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("adapter still running after its session limit")
+	}
+}
@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/1ureka/roj1/internal/signaling"
+)
+
+// startWSBlockingProxy starts a proxy to the host's WS server at addr that
+// refuses WebSocket upgrades, like some corporate proxies, and returns the
+// URL clients dial.
+func startWSBlockingProxy(t *testing.T, addr string) string {
+	t.Helper()
+	proxy := httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: addr})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "" {
+			http.Error(w, "WebSockets are not allowed", http.StatusForbidden)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+}
+
+// pollSession runs a host and a client with the given PINs through a proxy
+// that blocks WebSockets within ctx and returns both results.
+func pollSession(t *testing.T, ctx context.Context, hostPIN, clientPIN string) (hostErr, clientErr error) {
+	t.Helper()
+	addr := freeAddr(t)
+	return runSession(t, ctx,
+		sessionSide{addr: addr, opts: signaling.Options{PIN: hostPIN}},
+		sessionSide{addr: startWSBlockingProxy(t, addr), opts: signaling.Options{PIN: clientPIN}})
+}
+
+// TestPollingFallback checks that signaling falls back to HTTP polling when
+// the WebSocket upgrade is refused: the PIN exchange and the SDP exchange,
+// which need messages both ways, complete through it.
+func TestPollingFallback(t *testing.T) {
+	ctx, check := sdpExchange(t)
+	check(pollSession(t, ctx, "482913", "482913"))
+}
+
+// TestPollingCloseReason checks that a refusal reaches a polling client with
+// its reason, as a WebSocket close frame would.
+func TestPollingCloseReason(t *testing.T) {
+	hostErr, clientErr := pollSession(t, context.Background(), "482913", "111111")
+	if !errors.Is(hostErr, signaling.ErrPIN) {
+		t.Errorf("host: %v, want ErrPIN", hostErr)
+	}
+	if clientErr == nil || !strings.Contains(fmt.Sprint(clientErr), "PIN") {
+		t.Errorf("client: %v, want a PIN refusal", clientErr)
+	}
+}
@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/transport"
+)
+
+// startFakeSTUNServer starts a UDP server that answers STUN binding requests
+// with an XOR-MAPPED-ADDRESS of the sender (as seen by the server), optionally
+// shifted by portOffset to emulate a symmetric NAT. Returns its address.
+func startFakeSTUNServer(t *testing.T, ctx context.Context, portOffset int) string {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("fake STUN server: listen failed: %v", err)
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if n < 20 {
+				continue
+			}
+
+			resp := make([]byte, 20+12)
+			binary.BigEndian.PutUint16(resp[0:2], 0x0101)
+			binary.BigEndian.PutUint16(resp[2:4], 12)
+			copy(resp[4:20], buf[4:20]) // magic cookie + transaction ID
+
+			attr := resp[20:]
+			binary.BigEndian.PutUint16(attr[0:2], 0x0020)
+			binary.BigEndian.PutUint16(attr[2:4], 8)
+			attr[5] = 0x01
+			binary.BigEndian.PutUint16(attr[6:8], uint16(from.Port+portOffset)^0x2112)
+			ip := from.IP.To4()
+			for i := range 4 {
+				attr[8+i] = ip[i] ^ resp[4+i]
+			}
+
+			conn.WriteToUDP(resp, from)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// TestProbeNATCone verifies that identical mappings from two servers are
+// classified as a cone NAT, with the sender's address decoded correctly.
+func TestProbeNATCone(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	a := startFakeSTUNServer(t, ctx, 0)
+	b := startFakeSTUNServer(t, ctx, 0)
+
+	report, err := transport.ProbeNAT(ctx, "stun:"+a, b)
+	if err != nil {
+		t.Fatalf("ProbeNAT failed: %v", err)
+	}
+
+	if report.Type != transport.NATCone {
+		t.Errorf("NAT type mismatch: got %s, want %s", report.Type, transport.NATCone)
+	}
+	if !report.P2PLikely() || !report.UDPEgress() {
+		t.Errorf("expected P2P likely with UDP egress, got %+v", report)
+	}
+	for _, res := range report.Results {
+		if host, _, _ := net.SplitHostPort(res.Mapped); host != "127.0.0.1" {
+			t.Errorf("%s: unexpected mapped address %q (err=%v)", res.Server, res.Mapped, res.Err)
+		}
+	}
+}
+
+// TestProbeNATSymmetric verifies that differing mappings are classified as a
+// symmetric NAT.
+func TestProbeNATSymmetric(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	a := startFakeSTUNServer(t, ctx, 0)
+	b := startFakeSTUNServer(t, ctx, 1)
+
+	report, err := transport.ProbeNAT(ctx, a, b)
+	if err != nil {
+		t.Fatalf("ProbeNAT failed: %v", err)
+	}
+
+	if report.Type != transport.NATSymmetric {
+		t.Errorf("NAT type mismatch: got %s, want %s", report.Type, transport.NATSymmetric)
+	}
+	if report.P2PLikely() {
+		t.Error("expected P2P to be unlikely behind a symmetric NAT")
+	}
+}
@@ -112,6 +112,17 @@ func TestDecodeTooShort(t *testing.T) {
 	}
 }
 
+// TestDecodeUnknownType verifies that Decode rejects packet types outside
+// TypeConnect..TypeControl.
+func TestDecodeUnknownType(t *testing.T) {
+	for _, typ := range []uint8{0x00, 0x06, 0xFF} {
+		data := protocol.Encode(&protocol.Packet{Type: typ, SocketID: 1, SeqNum: 1})
+		if _, err := protocol.Decode(data); err == nil {
+			t.Errorf("Expected error for type 0x%02x, got nil", typ)
+		}
+	}
+}
+
 // TestDecodeExactHeaderSize verifies that a packet with exactly HeaderSize
 // bytes (no payload) is decoded successfully.
 func TestDecodeExactHeaderSize(t *testing.T) {
@@ -275,3 +286,21 @@ func TestDecodePreservesPayload(t *testing.T) {
 		t.Errorf("Payload was incorrectly aliased: got %v", decoded.Payload)
 	}
 }
+
+// TestAppendEncodeReusesBuffer verifies that AppendEncode into a reused
+// buffer produces the same bytes as Encode for each packet.
+func TestAppendEncodeReusesBuffer(t *testing.T) {
+	packets := []*protocol.Packet{
+		{Type: protocol.TypeData, SocketID: 1, SeqNum: 2, Payload: bytes.Repeat([]byte("x"), 100)},
+		{Type: protocol.TypeClose, SocketID: 0xFFFFFFFF, SeqNum: 3},
+		{Type: protocol.TypeData, SocketID: 4, SeqNum: 5, Payload: []byte("short")},
+	}
+
+	var buf []byte
+	for _, pkt := range packets {
+		buf = protocol.AppendEncode(buf[:0], pkt)
+		if want := protocol.Encode(pkt); !bytes.Equal(buf, want) {
+			t.Errorf("AppendEncode(%+v) = %x, want %x", pkt, buf, want)
+		}
+	}
+}
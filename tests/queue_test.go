@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/1ureka/roj1/internal/signaling"
+)
+
+// TestQueueAdmitsInOrder checks that a Listener queues clients while the host
+// is busy, tells them their place, refuses those beyond the limit and admits
+// the next one in line for the following session.
+func TestQueueAdmitsInOrder(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	l, err := signaling.Listen("127.0.0.1:0", "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	url := fmt.Sprintf("ws://127.0.0.1:%d/ws", l.Port())
+
+	dial := func() *websocket.Conn {
+		t.Helper()
+		conn, _, err := websocket.DefaultDialer.DialContext(ctx, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+
+	// The first client is the host's; the second waits in line.
+	first := dial()
+	time.Sleep(50 * time.Millisecond) // the server places clients after the handshake
+	second := dial()
+	var msg map[string]any
+	if err := second.ReadJSON(&msg); err != nil || msg["type"] != "queued" || msg["position"] != 1.0 {
+		t.Fatalf("second client read %v, %v; want position 1 in the queue", msg, err)
+	}
+
+	// The queue holds one.
+	third := dial()
+	err = third.ReadJSON(&msg)
+	if ce, ok := err.(*websocket.CloseError); !ok || ce.Code != websocket.ClosePolicyViolation || ce.Text != "the queue is full" {
+		t.Errorf("third client read %v; want a full queue refusal", err)
+	}
+
+	// The first session ends without a tunnel; the next takes the second
+	// client, which learns its turn has come before the host speaks.
+	session := func() {
+		sessCtx, stop := context.WithTimeout(ctx, time.Second)
+		defer stop()
+		signaling.EstablishAsHost(sessCtx, "", signaling.Options{Server: l})
+	}
+	first.WriteJSON(map[string]any{"type": "hello", "seq": 1, "version": "1.0.0"})
+	session()
+
+	done := make(chan struct{})
+	go func() {
+		session()
+		close(done)
+	}()
+	defer func() { <-done }()
+	second.WriteJSON(map[string]any{"type": "hello", "seq": 1, "version": "1.0.0"})
+	msg = nil // a map is decoded into, not replaced
+	if err := second.ReadJSON(&msg); err != nil || msg["type"] != "queued" || msg["position"] != nil {
+		t.Fatalf("second client read %v, %v; want its turn", msg, err)
+	}
+	if err := second.ReadJSON(&msg); err != nil || msg["seq"] != 1.0 {
+		t.Errorf("second client read %v, %v; want the host's first message", msg, err)
+	}
+}
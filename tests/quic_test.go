@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/transport"
+)
+
+// quicTransportPair connects two QUIC StreamTransports over loopback UDP.
+func quicTransportPair(t *testing.T, ctx context.Context) (client, host *transport.StreamTransport) {
+	t.Helper()
+	l, err := quic.ListenAddr("127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{testCert(t)},
+		NextProtos:   []string{"roj1-test"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+
+	type accepted struct {
+		conn   *quic.Conn
+		stream *quic.Stream
+	}
+	accepts := make(chan accepted, 1)
+	go func() {
+		var a accepted
+		if conn, err := l.Accept(ctx); err == nil {
+			// The stream is announced by its first byte.
+			if stream, err := conn.AcceptStream(ctx); err == nil {
+				if _, err := io.ReadFull(stream, make([]byte, 1)); err == nil {
+					a = accepted{conn, stream}
+				}
+			}
+		}
+		accepts <- a
+	}()
+
+	clientConn, err := quic.DialAddr(ctx, l.Addr().String(), &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"roj1-test"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	clientStream, err := clientConn.OpenStreamSync(ctx)
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	if _, err := clientStream.Write([]byte{0}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	a := <-accepts
+	if a.conn == nil {
+		t.Fatal("accept failed")
+	}
+
+	return transport.NewQUICTransport(ctx, clientConn, clientStream), transport.NewQUICTransport(ctx, a.conn, a.stream)
+}
+
+// TestQUICTransportTunnel runs the full adapter path over a QUIC stream:
+//
+//	[TCP client] <-> [RunAsClient] <-> [StreamTransport/QUIC] <-> [RunAsHost] <-> [echo server]
+func TestQUICTransportTunnel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+
+	echoAddr := startEchoServer(t, ctx)
+	clientTr, hostTr := quicTransportPair(t, ctx)
+	clientAddr := getFreeAddr(t)
+
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		clientTr.Close()
+		hostTr.Close()
+		wg.Wait()
+	}()
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		adapter.RunAsHost(ctx, hostTr, echoAddr)
+	}()
+	go func() {
+		defer wg.Done()
+		adapter.RunAsClient(ctx, clientTr, clientAddr)
+	}()
+
+	waitForListener(t, clientAddr, 5*time.Second)
+
+	const numConns = 5
+	const dataSize = 2 * 1024 * 1024
+
+	var connWg sync.WaitGroup
+	for i := range numConns {
+		connWg.Add(1)
+		go func(idx int) {
+			defer connWg.Done()
+
+			conn, err := net.Dial("tcp", clientAddr)
+			if err != nil {
+				t.Errorf("[conn %d] dial: %v", idx, err)
+				return
+			}
+			defer conn.Close()
+
+			sent := makeTestData(dataSize, byte(idx))
+			go conn.Write(sent)
+
+			got := make([]byte, dataSize)
+			conn.SetReadDeadline(time.Now().Add(15 * time.Second))
+			if _, err := io.ReadFull(conn, got); err != nil {
+				t.Errorf("[conn %d] read echo: %v", idx, err)
+				return
+			}
+
+			if !bytes.Equal(sent, got) {
+				t.Errorf("[conn %d] echoed data mismatch", idx)
+			}
+		}(i)
+	}
+	connWg.Wait()
+
+	// Closing one end closes the QUIC connection, and the other learns that
+	// the peer closed.
+	clientTr.Close()
+	select {
+	case <-hostTr.Done():
+		if err := hostTr.Err(); err != transport.ErrPeerClosed {
+			t.Errorf("host transport error: got %v, want %v", err, transport.ErrPeerClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("host transport not done after client closed")
+	}
+}
@@ -0,0 +1,179 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/protocol"
+	"github.com/1ureka/roj1/internal/transport"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// rawPeer plays a hostile client: it sends hand-built packets over a Pipe to
+// a host adapter and records what comes back.
+type rawPeer struct {
+	*transport.Pipe
+	packets chan *protocol.Packet
+}
+
+// startRawPeer starts a host adapter with cfg, forwarding to an echo server,
+// and returns the client end of its Pipe.
+func startRawPeer(t *testing.T, ctx context.Context, cfg adapter.HostConfig) (*rawPeer, *adapter.Handle) {
+	t.Helper()
+
+	echoAddr := startEchoServer(t, ctx)
+	a, b := transport.NewPipe()
+	t.Cleanup(func() { a.Close() })
+
+	h, err := adapter.StartAsHostWith(ctx, b, echoAddr, cfg)
+	if err != nil {
+		t.Fatalf("StartAsHostWith: %v", err)
+	}
+
+	p := &rawPeer{Pipe: a, packets: make(chan *protocol.Packet, 1024)}
+	a.OnPacket(func(pkt *protocol.Packet) { p.packets <- pkt })
+	return p, h
+}
+
+// next waits for the next packet for socketID that matches ok, skipping any
+// others.
+func (p *rawPeer) next(t *testing.T, socketID uint32, ok func(*protocol.Packet) bool) *protocol.Packet {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case pkt := <-p.packets:
+			if pkt.SocketID == socketID && ok(pkt) {
+				return pkt
+			}
+		case <-timeout:
+			t.Fatalf("[%08x] no expected packet from the host", socketID)
+			return nil
+		}
+	}
+}
+
+// expect waits for the next packet for socketID of the given type.
+func (p *rawPeer) expect(t *testing.T, socketID uint32, typ uint8) *protocol.Packet {
+	t.Helper()
+	return p.next(t, socketID, func(pkt *protocol.Packet) bool { return pkt.Type == typ })
+}
+
+// TestQuotaMaxSockets checks that a CONNECT beyond MaxSockets is answered
+// with CLOSE, and that a slot is freed once a socket closes.
+func TestQuotaMaxSockets(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	p, _ := startRawPeer(t, ctx, adapter.HostConfig{Quotas: adapter.Quotas{MaxSockets: 2}})
+	rejected := util.Stats.Rejected.Load()
+
+	p.SendConnect(1, 1)
+	p.expect(t, 1, protocol.TypeConnect)
+	p.SendConnect(2, 1)
+	p.expect(t, 2, protocol.TypeConnect)
+
+	p.SendConnect(3, 1)
+	if pkt := p.expect(t, 3, protocol.TypeClose); pkt.SeqNum != 1 {
+		t.Errorf("refusal CLOSE has SeqNum %d, want 1", pkt.SeqNum)
+	}
+	if got := util.Stats.Rejected.Load() - rejected; got != 1 {
+		t.Errorf("Rejected grew by %d, want 1", got)
+	}
+
+	// Closing socket 1 makes room, once the host has cleaned it up.
+	p.SendClose(1, 2)
+	p.expect(t, 1, protocol.TypeClose)
+	// The host answers every CONNECT, either way.
+	deadline := time.Now().Add(5 * time.Second)
+	for id := uint32(4); time.Now().Before(deadline); id++ {
+		p.SendConnect(id, 1)
+		if p.next(t, id, func(*protocol.Packet) bool { return true }).Type == protocol.TypeConnect {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("no socket accepted after one was closed")
+}
+
+// TestQuotaBufferedBytes checks that the socket whose out-of-order data
+// crosses MaxBufferedBytes is closed, and that its bytes are released for
+// other sockets.
+func TestQuotaBufferedBytes(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	const chunk = 16 * 1024
+	p, _ := startRawPeer(t, ctx, adapter.HostConfig{Quotas: adapter.Quotas{MaxBufferedBytes: 4 * chunk}})
+
+	// SeqNum 2 never arrives, so everything after it stays buffered.
+	p.SendConnect(1, 1)
+	for seq := uint32(3); seq < 8; seq++ {
+		p.SendData(1, seq, make([]byte, chunk))
+	}
+	p.expect(t, 1, protocol.TypeClose)
+
+	// A second socket can buffer up to the quota again.
+	data := makeTestData(chunk, 7)
+	p.SendConnect(2, 1)
+	p.SendData(2, 3, data[chunk/2:])
+	p.SendData(2, 2, data[:chunk/2])
+
+	var echoed []byte
+	for len(echoed) < chunk {
+		echoed = append(echoed, p.expect(t, 2, protocol.TypeData).Payload...)
+	}
+	if string(echoed) != string(data) {
+		t.Error("echoed data does not match")
+	}
+}
+
+// TestQuotaPacketRate checks that packets beyond MaxPacketRate are delayed,
+// not dropped.
+func TestQuotaPacketRate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	const rate = 50
+	p, _ := startRawPeer(t, ctx, adapter.HostConfig{Quotas: adapter.Quotas{MaxPacketRate: rate}})
+
+	// Stale CLOSEs are cheap for the host to discard; the first second's
+	// worth passes as a burst, the rest at the quota rate.
+	start := time.Now()
+	for id := uint32(1); id <= 2*rate; id++ {
+		p.SendClose(id, 1)
+	}
+	p.SendConnect(1000, 1)
+	p.expect(t, 1000, protocol.TypeConnect)
+
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("%d packets at %d/s took %v, want about 1s", 2*rate+1, rate, elapsed)
+	}
+}
+
+// TestSetQuotas checks that quotas replaced while the host runs apply to the
+// next CONNECT.
+func TestSetQuotas(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	p, h := startRawPeer(t, ctx, adapter.HostConfig{Quotas: adapter.Quotas{MaxSockets: 1}})
+
+	p.SendConnect(1, 1)
+	p.expect(t, 1, protocol.TypeConnect)
+	p.SendConnect(2, 1)
+	p.expect(t, 2, protocol.TypeClose)
+
+	h.SetQuotas(adapter.Quotas{MaxSockets: 2})
+	p.SendConnect(3, 1)
+	if pkt := p.next(t, 3, func(*protocol.Packet) bool { return true }); pkt.Type != protocol.TypeConnect {
+		t.Errorf("host answered with type %d after raising MaxSockets, want CONNECT", pkt.Type)
+	}
+
+	h.SetQuotas(adapter.Quotas{MaxSockets: 1})
+	p.SendConnect(4, 1)
+	p.expect(t, 4, protocol.TypeClose)
+}
@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/protocol"
+)
+
+// TestReassemblyLimitClose checks that a socket whose out-of-order data
+// crosses MaxSocketBytes is closed when it cannot recover: with the close
+// policy, or while waiting for a gap without retransmission.
+func TestReassemblyLimitClose(t *testing.T) {
+	const chunk = 16 * 1024
+	for _, tc := range []struct {
+		name string
+		cfg  adapter.HostConfig
+	}{
+		{"close", adapter.HostConfig{Nack: true, Reassembly: adapter.Reassembly{MaxSocketBytes: 4 * chunk, Close: true}}},
+		{"no nack", adapter.HostConfig{Reassembly: adapter.Reassembly{MaxSocketBytes: 4 * chunk}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+			defer cancel()
+
+			p, _ := startRawPeer(t, ctx, tc.cfg)
+			p.SendConnect(1, 1)
+			for seq := uint32(3); seq < 8; seq++ {
+				p.SendData(1, seq, make([]byte, chunk))
+			}
+			p.expect(t, 1, protocol.TypeClose)
+		})
+	}
+}
+
+// TestReassemblyEvict checks that with retransmission a socket over
+// MaxSocketBytes evicts the packets furthest ahead and requests them again
+// once the gap before them is filled, delivering all data in order.
+func TestReassemblyEvict(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	const chunk = 16 * 1024
+	p, _ := startRawPeer(t, ctx, adapter.HostConfig{Nack: true, Reassembly: adapter.Reassembly{MaxSocketBytes: 4 * chunk}})
+
+	data := makeTestData(8*chunk, 3)
+	packet := func(seq uint32) []byte { // DATA SeqNum 2..9
+		return data[(seq-2)*chunk : (seq-1)*chunk]
+	}
+
+	p.SendConnect(1, 1)
+	p.expect(t, 1, protocol.TypeConnect)
+	for seq := uint32(3); seq <= 9; seq++ {
+		p.SendData(1, seq, packet(seq))
+	}
+
+	// Answer every NACK, as the peer's retransmit buffer would.
+	var echoed []byte
+	for len(echoed) < len(data) {
+		pkt := p.next(t, 1, func(pkt *protocol.Packet) bool {
+			return pkt.Type != protocol.TypeConnect
+		})
+		switch pkt.Type {
+		case protocol.TypeNack:
+			first, last := protocol.NackRange(pkt.Payload)
+			for seq := first; seq <= last; seq++ {
+				p.SendData(1, seq, packet(seq))
+			}
+		case protocol.TypeData:
+			echoed = append(echoed, pkt.Payload...)
+		default:
+			t.Fatalf("unexpected packet of type %d", pkt.Type)
+		}
+	}
+	if string(echoed) != string(data) {
+		t.Error("echoed data does not match")
+	}
+}
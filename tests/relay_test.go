@@ -0,0 +1,209 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/1ureka/roj1/internal/signaling"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// TestRoomCodes checks room code generation and relay room URLs.
+func TestRoomCodes(t *testing.T) {
+	for range 100 {
+		code, err := signaling.NewRoom()
+		if err != nil || !signaling.ValidRoom(code) {
+			t.Fatalf("NewRoom() = %q, %v; want a valid code", code, err)
+		}
+	}
+	for _, s := range []string{"blue-falcon", "Blue-falcon-421573", "blue-falcon-42", "blue-falcon-042157", "blue-falcon-4215730", "wss://blue-falcon-421573"} {
+		if signaling.ValidRoom(s) {
+			t.Errorf("ValidRoom(%q) = true", s)
+		}
+	}
+
+	for _, tc := range []struct{ base, role, want string }{
+		{"relay.example.com", "client", "wss://relay.example.com/rooms/blue-falcon-421573?role=client"},
+		{"https://relay.example.com/roj1/", "host", "wss://relay.example.com/roj1/rooms/blue-falcon-421573?role=host"},
+		{"http://127.0.0.1:8080", "client", "ws://127.0.0.1:8080/rooms/blue-falcon-421573?role=client"},
+	} {
+		got, err := signaling.RoomURL(tc.base, "blue-falcon-421573", tc.role)
+		if err != nil || got != tc.want {
+			t.Errorf("RoomURL(%q) = %q, %v; want %q", tc.base, got, err, tc.want)
+		}
+	}
+	if _, err := signaling.RoomURL("ftp://relay.example.com", "blue-falcon-421573", "host"); err == nil {
+		t.Error("RoomURL accepted an ftp:// relay")
+	}
+}
+
+// dialStatus dials url and returns the HTTP status of a refused handshake, or
+// 0 once the connection is up.
+func dialStatus(t *testing.T, ctx context.Context, url string) (*websocket.Conn, int) {
+	t.Helper()
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, url, nil)
+	if err == nil {
+		return conn, 0
+	}
+	if resp == nil {
+		t.Fatalf("dial %s: %v", url, err)
+	}
+	return nil, resp.StatusCode
+}
+
+// TestRelayPairsHostAndClient checks that a host waiting in a relay room is
+// reached by the client joining it, and that taken and missing rooms are
+// refused.
+func TestRelayPairsHostAndClient(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	relay := httptest.NewServer(signaling.NewRelay())
+	defer relay.Close()
+
+	code, err := signaling.NewRoom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened := make(chan string, 1)
+	t.Cleanup(util.SubscribeEvents(func(ev util.Event) {
+		if ev.Event == util.EventRoomOpened && ev.Room == code {
+			select {
+			case opened <- ev.Room:
+			default:
+			}
+		}
+	}))
+
+	hostCtx, stopHost := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := signaling.EstablishAsHost(hostCtx, "", signaling.Options{Relay: relay.URL, Room: code})
+		done <- err
+	}()
+
+	select {
+	case <-opened:
+	case <-ctx.Done():
+		t.Fatal("host never opened its room")
+	}
+
+	hostURL, _ := signaling.RoomURL(relay.URL, code, "host")
+	if _, status := dialStatus(t, ctx, hostURL); status != http.StatusConflict {
+		t.Errorf("second host in the room: status %d, want %d", status, http.StatusConflict)
+	}
+
+	missing := "red-owl-110000"
+	if missing == code {
+		missing = "red-owl-120000"
+	}
+	missingURL, _ := signaling.RoomURL(relay.URL, missing, "client")
+	_, err = signaling.EstablishAsClient(ctx, missingURL, signaling.Options{})
+	if !errors.Is(err, signaling.ErrSignaling) || !strings.Contains(err.Error(), "no host is waiting") {
+		t.Errorf("client of a missing room: %v, want the relay's reason", err)
+	}
+	var refused *signaling.HandshakeError
+	if !errors.As(err, &refused) || refused.StatusCode != http.StatusNotFound {
+		t.Errorf("client of a missing room: %v, want a HandshakeError with status %d", err, http.StatusNotFound)
+	}
+
+	clientURL, _ := signaling.RoomURL(relay.URL, code, "client")
+	conn, status := dialStatus(t, ctx, clientURL)
+	if conn == nil {
+		t.Fatalf("joining the room: status %d", status)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]any{"type": "hello", "seq": 1, "version": "1.0.0"})
+	for seen := map[any]bool{}; !seen["hello"] || !seen["offer"]; {
+		var msg map[string]any
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("through the relay, got %v, then %v; want the host's hello and offer", seen, err)
+		}
+		seen[msg["type"]] = true
+	}
+
+	// The room is spent once joined.
+	if _, status := dialStatus(t, ctx, clientURL); status != http.StatusNotFound {
+		t.Errorf("second client in the room: status %d, want %d", status, http.StatusNotFound)
+	}
+
+	stopHost()
+	if err := <-done; err == nil {
+		t.Error("EstablishAsHost succeeded without a tunnel")
+	}
+}
+
+// TestRelayLimitsGuesses checks that a client guessing room codes is slowed
+// down.
+func TestRelayLimitsGuesses(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	relay := httptest.NewServer(signaling.NewRelay())
+	defer relay.Close()
+
+	url, _ := signaling.RoomURL(relay.URL, "red-owl-110000", "client")
+	var status int
+	for range 21 {
+		if _, status = dialStatus(t, ctx, url); status == http.StatusTooManyRequests {
+			break
+		}
+	}
+	if status != http.StatusTooManyRequests {
+		t.Errorf("after many missing rooms: status %d, want %d", status, http.StatusTooManyRequests)
+	}
+}
+
+// TestRelayLimitsRoomsPerAddress checks that one address cannot hold more
+// than a few rooms at a time, and gets its slot back when a room closes.
+func TestRelayLimitsRoomsPerAddress(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	relay := httptest.NewServer(signaling.NewRelay())
+	defer relay.Close()
+
+	var rooms []*websocket.Conn
+	for i := 0; ; i++ {
+		url, _ := signaling.RoomURL(relay.URL, fmt.Sprintf("red-owl-%d", 100000+i), "host")
+		conn, status := dialStatus(t, ctx, url)
+		if conn == nil {
+			if status != http.StatusTooManyRequests || i == 0 {
+				t.Fatalf("room %d: status %d, want %d after a few rooms", i, status, http.StatusTooManyRequests)
+			}
+			break
+		}
+		defer conn.Close()
+		if i == 100 {
+			t.Fatal("100 rooms open from one address")
+		}
+		rooms = append(rooms, conn)
+	}
+
+	rooms[0].Close()
+	url, _ := signaling.RoomURL(relay.URL, "red-owl-999999", "host")
+	for {
+		conn, status := dialStatus(t, ctx, url)
+		if conn != nil {
+			conn.Close()
+			return
+		}
+		if status != http.StatusTooManyRequests {
+			t.Fatalf("after closing a room: status %d", status)
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal("closing a room did not free its slot")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
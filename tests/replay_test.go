@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/1ureka/roj1/internal/signaling"
+)
+
+// TestHostRefusesReplays checks that the host drops a client whose messages
+// belong to another session or repeat a number, telling it why.
+func TestHostRefusesReplays(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		next func(hostNonce string) map[string]any // the client's second message
+	}{
+		{"stale nonce", func(string) map[string]any {
+			return map[string]any{"type": "answer", "sdp": "v=0", "seq": 2, "nonce": "c3RhbGU"}
+		}},
+		{"repeated number", func(nonce string) map[string]any {
+			return map[string]any{"type": "answer", "sdp": "v=0", "seq": 1, "nonce": nonce}
+		}},
+		{"unnumbered", func(nonce string) map[string]any {
+			return map[string]any{"type": "answer", "sdp": "v=0", "nonce": nonce}
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			addr := freeAddr(t)
+			done := make(chan error, 1)
+			go func() {
+				_, _, err := signaling.EstablishAsHost(ctx, addr, signaling.Options{Timeout: 5 * time.Second})
+				done <- err
+			}()
+
+			var conn *websocket.Conn
+			for conn == nil && ctx.Err() == nil { // until the host listens
+				conn, _, _ = websocket.DefaultDialer.DialContext(ctx, fmt.Sprintf("ws://%s/ws", addr), nil)
+				time.Sleep(20 * time.Millisecond)
+			}
+			if conn == nil {
+				t.Fatal("host never listened")
+			}
+			defer conn.Close()
+
+			conn.WriteJSON(map[string]any{"type": "hello", "seq": 1, "version": "1.0.0"})
+			var msg map[string]any
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Fatal(err)
+			}
+			nonce, _ := msg["nonce"].(string)
+			if nonce == "" || msg["seq"] != 1.0 {
+				t.Fatalf("host's first message %v carries no number or nonce", msg)
+			}
+			conn.WriteJSON(tc.next(nonce))
+
+			var err error
+			for err == nil {
+				err = conn.ReadJSON(&msg)
+			}
+			if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+				t.Errorf("after the replayed message, read %v; want a policy violation close", err)
+			}
+			if err := <-done; !errors.Is(err, signaling.ErrReplay) || !errors.Is(err, signaling.ErrSignaling) {
+				t.Errorf("EstablishAsHost error = %v, want ErrReplay", err)
+			}
+		})
+	}
+}
+
+// TestClientRefusesSessionSwitch checks that the client drops a host whose
+// messages change session nonce midway, as when a relay splices in messages
+// captured from an earlier session.
+func TestClientRefusesSessionSwitch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var msg map[string]any
+		conn.ReadJSON(&msg)
+		conn.WriteJSON(map[string]any{"type": "hello", "seq": 1, "nonce": "Zmlyc3Q", "version": "1.0.0"})
+		conn.WriteJSON(map[string]any{"type": "offer", "sdp": "v=0", "seq": 2, "nonce": "c2Vjb25k"})
+		conn.ReadJSON(&msg) // hold the connection until the client gives up
+	}))
+	defer srv.Close()
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+
+	_, err := signaling.EstablishAsClient(ctx, wsURL, signaling.Options{Timeout: 5 * time.Second})
+	if !errors.Is(err, signaling.ErrReplay) || !errors.Is(err, signaling.ErrSignaling) {
+		t.Errorf("EstablishAsClient error = %v, want ErrReplay", err)
+	}
+}
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/transport"
+)
+
+// TestRetarget checks that the client can switch the host's target to a port
+// the host allows, after which new connections reach it and the host
+// announces the new port, and that other ports are refused.
+func TestRetarget(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	echoAddr := startEchoServer(t, ctx)
+	_, rawPort, _ := net.SplitHostPort(startGreeter(t, ctx, "moved"))
+	newPort, _ := strconv.Atoi(rawPort)
+	a, b := transport.NewPipe()
+	defer a.Close()
+
+	if _, err := adapter.StartAsHostWith(ctx, b, echoAddr, adapter.HostConfig{
+		AuthorizeRetarget: func(_ context.Context, port int) error {
+			if port != newPort {
+				return errors.New("not that one")
+			}
+			return nil
+		},
+	}); err != nil {
+		t.Fatalf("StartAsHostWith: %v", err)
+	}
+	h, err := adapter.StartAsClientWith(ctx, a, "127.0.0.1:0", adapter.ClientConfig{})
+	if err != nil {
+		t.Fatalf("StartAsClientWith: %v", err)
+	}
+
+	if err := h.Retarget(ctx, 1); !errors.Is(err, adapter.ErrRetargetDenied) {
+		t.Errorf("Retarget(1) = %v, want ErrRetargetDenied", err)
+	}
+	if err := h.Retarget(ctx, newPort); err != nil {
+		t.Fatalf("Retarget(%d): %v", newPort, err)
+	}
+
+	conn, err := net.Dial("tcp", h.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if got, err := io.ReadAll(conn); err != nil || string(got) != "moved" {
+		t.Errorf("new connection got %q, %v; want the new target's \"moved\"", got, err)
+	}
+
+	waitService(t, h, newPort) // the host announces the new port
+}
+
+// TestRetargetRefused checks that a host without AuthorizeRetarget refuses
+// port changes.
+func TestRetargetRefused(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	echoAddr := startEchoServer(t, ctx)
+	a, b := transport.NewPipe()
+	defer a.Close()
+
+	if _, err := adapter.StartAsHostWith(ctx, b, echoAddr, adapter.HostConfig{}); err != nil {
+		t.Fatalf("StartAsHostWith: %v", err)
+	}
+	h, err := adapter.StartAsClientWith(ctx, a, "", adapter.ClientConfig{})
+	if err != nil {
+		t.Fatalf("StartAsClientWith: %v", err)
+	}
+	if err := h.Retarget(ctx, 8080); !errors.Is(err, adapter.ErrRetargetDenied) {
+		t.Errorf("Retarget = %v, want ErrRetargetDenied", err)
+	}
+}
@@ -0,0 +1,43 @@
+package tests
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+)
+
+// TestReusePort checks that a client adapter with ReusePort binds a port
+// another one with ReusePort still holds, and one without it does not.
+func TestReusePort(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SO_REUSEPORT is not supported on Windows")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	start := func(addr string, reuse bool) (*adapter.Handle, error) {
+		clientTr, hostTr := MockTransports()
+		t.Cleanup(func() { clientTr.Close(); hostTr.Close() })
+		return adapter.StartAsClientWith(ctx, clientTr, addr, adapter.ClientConfig{ReusePort: reuse})
+	}
+
+	old, err := start("127.0.0.1:0", true)
+	if err != nil {
+		t.Fatalf("StartAsClientWith: %v", err)
+	}
+	addr := old.Addr().String()
+
+	if _, err := start(addr, false); err == nil {
+		t.Errorf("a client without ReusePort bound %s", addr)
+	}
+	h, err := start(addr, true)
+	if err != nil {
+		t.Fatalf("a client with ReusePort could not bind %s: %v", addr, err)
+	}
+	if h.Addr().String() != addr {
+		t.Errorf("Addr = %v, want %s", h.Addr(), addr)
+	}
+}
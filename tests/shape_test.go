@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/transport"
+)
+
+// TestParseShaping checks the -shape syntax.
+func TestParseShaping(t *testing.T) {
+	for in, want := range map[string]transport.Shaping{
+		"":                     {},
+		"rtt=100ms":            {RTT: 100 * time.Millisecond},
+		"rtt=100ms,bw=5mbit":   {RTT: 100 * time.Millisecond, Bandwidth: 625_000},
+		" bw=1.5Mbit , rtt=1s": {RTT: time.Second, Bandwidth: 187_500},
+		"bw=800kbit":           {Bandwidth: 100_000},
+	} {
+		got, err := transport.ParseShaping(in)
+		if err != nil || got != want {
+			t.Errorf("ParseShaping(%q) = %+v, %v; want %+v", in, got, err, want)
+		}
+	}
+
+	for _, in := range []string{"rtt", "rtt=fast", "rtt=-1s", "bw=5", "bw=0mbit", "loss=1%"} {
+		if _, err := transport.ParseShaping(in); err == nil {
+			t.Errorf("ParseShaping(%q) succeeded, want error", in)
+		}
+	}
+}
+
+// TestShapedTunnel verifies that shaping adds the round-trip time and caps
+// the bandwidth of connections through the tunnel.
+func TestShapedTunnel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	clientTr, hostTr := streamTransportPair(t, ctx)
+	defer clientTr.Close()
+	defer hostTr.Close()
+
+	// The RTT adds 300ms to the round trip and serializing 64 KiB at 1 MB/s
+	// another 64ms (both directions overlap).
+	shaped := transport.Shape(clientTr, transport.Shaping{RTT: 300 * time.Millisecond, Bandwidth: 1_000_000})
+
+	if _, err := adapter.StartAsHost(ctx, hostTr, startEchoServer(t, ctx)); err != nil {
+		t.Fatalf("StartAsHost: %v", err)
+	}
+	h, err := adapter.StartAsClient(ctx, shaped, "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("StartAsClient: %v", err)
+	}
+
+	start := time.Now()
+	echoOnce(t, h.Addr().String(), 3)
+	if elapsed := time.Since(start); elapsed < 350*time.Millisecond {
+		t.Fatalf("echo took %v through a shaped tunnel, want at least 350ms", elapsed)
+	}
+}
@@ -0,0 +1,132 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/1ureka/roj1/internal/signaling"
+)
+
+// memSignaler is one end of an in-memory Signaler pair that records which
+// method sent each message.
+type memSignaler struct {
+	in, out chan []byte
+	closed  chan struct{} // closed by either end
+	once    *sync.Once
+
+	mu   sync.Mutex
+	sent []string // "<method> <type>"
+}
+
+// memSignalers returns the two ends of an in-memory channel.
+func memSignalers() (*memSignaler, *memSignaler) {
+	a, b := make(chan []byte, 64), make(chan []byte, 64)
+	closed, once := make(chan struct{}), &sync.Once{}
+	return &memSignaler{in: a, out: b, closed: closed, once: once},
+		&memSignaler{in: b, out: a, closed: closed, once: once}
+}
+
+func (s *memSignaler) send(ctx context.Context, method string, msg []byte) error {
+	var m struct{ Type string }
+	json.Unmarshal(msg, &m)
+	s.mu.Lock()
+	s.sent = append(s.sent, method+" "+m.Type)
+	s.mu.Unlock()
+	select {
+	case s.out <- msg:
+		return nil
+	case <-s.closed:
+		return io.ErrClosedPipe
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *memSignaler) SendOffer(ctx context.Context, msg []byte) error {
+	return s.send(ctx, "SendOffer", msg)
+}
+
+func (s *memSignaler) SendAnswer(ctx context.Context, msg []byte) error {
+	return s.send(ctx, "SendAnswer", msg)
+}
+
+func (s *memSignaler) SendCandidate(ctx context.Context, msg []byte) error {
+	return s.send(ctx, "SendCandidate", msg)
+}
+
+func (s *memSignaler) Send(ctx context.Context, msg []byte) error {
+	return s.send(ctx, "Send", msg)
+}
+
+func (s *memSignaler) Recv(ctx context.Context) ([]byte, error) {
+	select {
+	case msg := <-s.in: // what was sent before the close still arrives
+		return msg, nil
+	default:
+	}
+	select {
+	case msg := <-s.in:
+		return msg, nil
+	case <-s.closed:
+		return nil, io.EOF
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *memSignaler) Close() error {
+	s.once.Do(func() { close(s.closed) })
+	return nil
+}
+
+// signalerSession runs a host and a client with the given PINs over an
+// in-memory Signaler pair within ctx and returns both results and ends.
+func signalerSession(t *testing.T, ctx context.Context, hostPIN, clientPIN string) (hostErr, clientErr error, host, client *memSignaler) {
+	t.Helper()
+	host, client = memSignalers()
+	hostErr, clientErr = runSession(t, ctx,
+		sessionSide{opts: signaling.Options{Signaler: host, PIN: hostPIN}},
+		sessionSide{opts: signaling.Options{Signaler: client, PIN: clientPIN}})
+	return hostErr, clientErr, host, client
+}
+
+// TestSignalerCarriesExchange checks that a custom Signaler carries the whole
+// exchange, each message through the method for its kind.
+func TestSignalerCarriesExchange(t *testing.T) {
+	ctx, check := sdpExchange(t)
+	hostErr, clientErr, host, client := signalerSession(t, ctx, "", "")
+	check(hostErr, clientErr)
+
+	var offered bool
+	for _, s := range append(host.sent, client.sent...) {
+		method, typ, _ := strings.Cut(s, " ")
+		want := map[string]string{"offer": "SendOffer", "answer": "SendAnswer", "candidate": "SendCandidate"}[typ]
+		if want == "" {
+			want = "Send"
+		}
+		if method != want {
+			t.Errorf("%s message sent with %s, want %s", typ, method, want)
+		}
+		offered = offered || typ == "offer"
+	}
+	if !offered {
+		t.Errorf("the host sent no offer: %v", host.sent)
+	}
+}
+
+// TestSignalerCloseReason checks that a refusal reaches the peer over a
+// Signaler with its reason.
+func TestSignalerCloseReason(t *testing.T) {
+	hostErr, clientErr, _, _ := signalerSession(t, context.Background(), "482913", "111111")
+	if !errors.Is(hostErr, signaling.ErrPIN) || !errors.Is(hostErr, signaling.ErrSignalingAuth) {
+		t.Errorf("host: %v, want ErrPIN, an ErrSignalingAuth", hostErr)
+	}
+	if clientErr == nil || !strings.Contains(clientErr.Error(), "PIN") {
+		t.Errorf("client: %v, want a PIN refusal", clientErr)
+	}
+}
@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+)
+
+// startBannerServer starts a server that answers each connection with banner
+// and closes it, over TLS if cert is given.
+func startBannerServer(t *testing.T, ctx context.Context, banner string, cert *tls.Certificate) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert != nil {
+		l = tls.NewListener(l, &tls.Config{Certificates: []tls.Certificate{*cert}})
+	}
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.Write([]byte(banner))
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// TestSNIRoutes verifies that TLS connections reach the target mapped to
+// their server name, and that other connections reach the main target.
+func TestSNIRoutes(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cert := testCert(t)
+	clientTr, hostTr := MockTransports()
+	defer clientTr.Close()
+	defer hostTr.Close()
+
+	if _, err := adapter.StartAsHostWith(ctx, hostTr, startBannerServer(t, ctx, "main", nil), adapter.HostConfig{
+		SNIRoutes: map[string]string{
+			"app1.test": startBannerServer(t, ctx, "app1", &cert),
+			"APP2.test": startBannerServer(t, ctx, "app2", &cert),
+		},
+	}); err != nil {
+		t.Fatalf("StartAsHostWith: %v", err)
+	}
+	h, err := adapter.StartAsClientWith(ctx, clientTr, "127.0.0.1:0", adapter.ClientConfig{ConnectTimeout: adapter.DefaultConnectTimeout})
+	if err != nil {
+		t.Fatalf("StartAsClientWith: %v", err)
+	}
+	addr := h.Addr().String()
+
+	for name, want := range map[string]string{"app1.test": "app1", "app2.test": "app2"} {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: name, InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatalf("[%s] TLS dial: %v", name, err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		got, err := io.ReadAll(conn)
+		conn.Close()
+		if err != nil || string(got) != want {
+			t.Errorf("[%s] got %q, %v; want %q", name, got, err, want)
+		}
+	}
+
+	// Not TLS: routed to the main target once the first bytes arrive.
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET / HTTP/1.0\r\n\r\n"))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if got, err := io.ReadAll(conn); err != nil || string(got) != "main" {
+		t.Errorf("plain connection got %q, %v; want %q", got, err, "main")
+	}
+}
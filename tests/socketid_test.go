@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+)
+
+// connectRecorder is a mockTransport that records the socketID of every
+// CONNECT it sends.
+type connectRecorder struct {
+	*mockTransport
+	mu  sync.Mutex
+	ids map[uint32]int
+}
+
+// SendConnect records socketID and forwards the packet to the peer.
+func (c *connectRecorder) SendConnect(socketID, seqNum uint32) {
+	c.mu.Lock()
+	c.ids[socketID]++
+	c.mu.Unlock()
+	c.mockTransport.SendConnect(socketID, seqNum)
+}
+
+// TestSocketIDReconnectStorm opens and closes many short connections in
+// quick succession and checks that every one echoes correctly and got a
+// socketID of its own, even while earlier sockets are still draining.
+func TestSocketIDReconnectStorm(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	echoAddr := startEchoServer(t, ctx)
+	clientMock, hostTr := MockTransports()
+	clientTr := &connectRecorder{mockTransport: clientMock, ids: make(map[uint32]int)}
+	defer clientTr.Close()
+	defer hostTr.Close()
+
+	if _, err := adapter.StartAsHost(ctx, hostTr, echoAddr); err != nil {
+		t.Fatalf("StartAsHost: %v", err)
+	}
+	clientAddr := getFreeAddr(t)
+	if _, err := adapter.StartAsClient(ctx, clientTr, clientAddr); err != nil {
+		t.Fatalf("StartAsClient: %v", err)
+	}
+
+	const rounds, perRound = 5, 20
+	for r := range rounds {
+		var wg sync.WaitGroup
+		for i := range perRound {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := echo(clientAddr, byte(r*perRound+i)); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	clientTr.mu.Lock()
+	defer clientTr.mu.Unlock()
+	if len(clientTr.ids) != rounds*perRound {
+		t.Errorf("got %d distinct socketIDs for %d connections", len(clientTr.ids), rounds*perRound)
+	}
+	for id, n := range clientTr.ids {
+		if n > 1 {
+			t.Errorf("socketID %08x used by %d connections", id, n)
+		}
+	}
+}
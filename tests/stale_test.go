@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/protocol"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// expectNone fails if the host sends anything for socketID within d.
+func (p *rawPeer) expectNone(t *testing.T, socketID uint32, d time.Duration) {
+	t.Helper()
+
+	timeout := time.After(d)
+	for {
+		select {
+		case pkt := <-p.packets:
+			if pkt.SocketID == socketID {
+				t.Fatalf("[%08x] unexpected packet of type %d from the host", socketID, pkt.Type)
+			}
+		case <-timeout:
+			return
+		}
+	}
+}
+
+// TestDuplicateConnect checks that a repeated CONNECT for a live socket is
+// ignored: the target is dialed and answered once.
+func TestDuplicateConnect(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	p, _ := startRawPeer(t, ctx, adapter.HostConfig{})
+	conns := util.Stats.TotalConns.Load()
+
+	p.SendConnect(1, 1)
+	p.SendConnect(1, 1)
+	p.expect(t, 1, protocol.TypeConnect)
+	p.SendData(1, 2, []byte("ping"))
+	if got := p.expect(t, 1, protocol.TypeData); got.SeqNum != 2 {
+		t.Errorf("echo has SeqNum %d, want 2 (one CONNECT answer before it)", got.SeqNum)
+	}
+
+	if got := util.Stats.TotalConns.Load() - conns; got != 1 {
+		t.Errorf("opened %d sockets, want 1", got)
+	}
+}
+
+// TestCloseBeforeConnect checks that a CLOSE overtaking its CONNECT makes the
+// host ignore the socketID, instead of opening a socket that waits forever.
+func TestCloseBeforeConnect(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	p, _ := startRawPeer(t, ctx, adapter.HostConfig{})
+	conns := util.Stats.TotalConns.Load()
+
+	p.SendClose(1, 3)
+	p.SendConnect(1, 1)
+	p.SendData(1, 2, []byte("late"))
+	p.expectNone(t, 1, 300*time.Millisecond)
+
+	if got := util.Stats.TotalConns.Load() - conns; got != 0 {
+		t.Errorf("opened %d sockets, want 0", got)
+	}
+}
+
+// TestPacketsAfterClose checks that packets still in flight for a closed
+// socketID are dropped rather than reopening it.
+func TestPacketsAfterClose(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	p, _ := startRawPeer(t, ctx, adapter.HostConfig{})
+	conns := util.Stats.TotalConns.Load()
+
+	p.SendConnect(1, 1)
+	p.expect(t, 1, protocol.TypeConnect)
+	p.SendClose(1, 2)
+	p.expect(t, 1, protocol.TypeClose)
+
+	// Wait for the host to remove the route, then replay late packets.
+	time.Sleep(100 * time.Millisecond)
+	p.SendData(1, 3, []byte("late"))
+	p.SendConnect(1, 1)
+	p.expectNone(t, 1, 300*time.Millisecond)
+
+	if got := util.Stats.TotalConns.Load() - conns; got != 1 {
+		t.Errorf("opened %d sockets, want 1", got)
+	}
+}
+
+// TestDataBeforeConnect checks that a socket whose stream starts with DATA
+// instead of CONNECT is closed.
+func TestDataBeforeConnect(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	p, _ := startRawPeer(t, ctx, adapter.HostConfig{})
+
+	p.SendData(1, 1, []byte("no connect"))
+	p.expect(t, 1, protocol.TypeClose)
+}
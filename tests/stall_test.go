@@ -0,0 +1,56 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/protocol"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// TestStallReport checks that a socket waiting for a packet that never
+// arrives is reported once as socket_stalled, naming the missing sequence
+// numbers.
+func TestStallReport(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	stalls := make(chan util.Event, 16)
+	t.Cleanup(util.SubscribeEvents(func(ev util.Event) {
+		if ev.Event == util.EventSocketStalled && ev.Socket == "0000057a" {
+			stalls <- ev
+		}
+	}))
+
+	p, _ := startRawPeer(t, ctx, adapter.HostConfig{StallTimeout: 200 * time.Millisecond})
+	p.SendConnect(0x57a, 1)
+	p.expect(t, 0x57a, protocol.TypeConnect)
+	p.SendData(0x57a, 4, []byte("after the gap"))
+
+	select {
+	case ev := <-stalls:
+		if ev.Missing != "2-3" {
+			t.Errorf("missing = %q, want 2-3", ev.Missing)
+		}
+		if want := protocol.HeaderSize + len("after the gap"); ev.Buffered != want {
+			t.Errorf("buffered = %d, want %d", ev.Buffered, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no socket_stalled event")
+	}
+
+	select {
+	case <-stalls:
+		t.Error("stall reported twice")
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	// Filling the gap delivers the data.
+	p.SendData(0x57a, 2, []byte("x"))
+	p.SendData(0x57a, 3, []byte("y"))
+	if got := p.expect(t, 0x57a, protocol.TypeData); string(got.Payload) == "" {
+		t.Error("empty echo after the gap was filled")
+	}
+}
@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/transport"
+)
+
+// Compile-time interface check.
+var _ adapter.Transport = (*transport.StreamTransport)(nil)
+
+// streamTransportPair connects two StreamTransports over a loopback TCP
+// connection.
+func streamTransportPair(t *testing.T, ctx context.Context) (client, host *transport.StreamTransport) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := l.Accept()
+		accepted <- conn
+	}()
+
+	clientConn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	hostConn := <-accepted
+	if hostConn == nil {
+		t.Fatal("accept failed")
+	}
+
+	return transport.NewStreamTransport(ctx, clientConn), transport.NewStreamTransport(ctx, hostConn)
+}
+
+// TestStreamTransportTunnel runs the full adapter path over StreamTransport:
+//
+//	[TCP client] <-> [RunAsClient] <-> [StreamTransport/TCP] <-> [RunAsHost] <-> [echo server]
+func TestStreamTransportTunnel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+
+	echoAddr := startEchoServer(t, ctx)
+	clientTr, hostTr := streamTransportPair(t, ctx)
+	clientAddr := getFreeAddr(t)
+
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		clientTr.Close()
+		hostTr.Close()
+		wg.Wait()
+	}()
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		adapter.RunAsHost(ctx, hostTr, echoAddr)
+	}()
+	go func() {
+		defer wg.Done()
+		adapter.RunAsClient(ctx, clientTr, clientAddr)
+	}()
+
+	waitForListener(t, clientAddr, 5*time.Second)
+
+	const numConns = 5
+	const dataSize = 2 * 1024 * 1024
+
+	var connWg sync.WaitGroup
+	for i := range numConns {
+		connWg.Add(1)
+		go func(idx int) {
+			defer connWg.Done()
+
+			conn, err := net.Dial("tcp", clientAddr)
+			if err != nil {
+				t.Errorf("[conn %d] dial: %v", idx, err)
+				return
+			}
+			defer conn.Close()
+
+			sent := makeTestData(dataSize, byte(idx))
+			go conn.Write(sent)
+
+			got := make([]byte, dataSize)
+			conn.SetReadDeadline(time.Now().Add(15 * time.Second))
+			if _, err := io.ReadFull(conn, got); err != nil {
+				t.Errorf("[conn %d] read echo: %v", idx, err)
+				return
+			}
+
+			if !bytes.Equal(sent, got) {
+				t.Errorf("[conn %d] echoed data mismatch", idx)
+			}
+		}(i)
+	}
+	connWg.Wait()
+
+	// Closing one end shuts down the other, which learns that the peer closed.
+	clientTr.Close()
+	select {
+	case <-hostTr.Done():
+		if err := hostTr.Err(); err != transport.ErrPeerClosed {
+			t.Errorf("host transport error: got %v, want %v", err, transport.ErrPeerClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("host transport not done after client closed")
+	}
+}
@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/transport"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// TestNamedTarget dials the target by name, both per connection and from the
+// background re-resolution cache.
+func TestNamedTarget(t *testing.T) {
+	for name, interval := range map[string]time.Duration{"per dial": 0, "cached": time.Second} {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			_, port, _ := net.SplitHostPort(startEchoServer(t, ctx))
+			clientTr, hostTr := MockTransports()
+			defer clientTr.Close()
+			defer hostTr.Close()
+
+			cfg := adapter.HostConfig{ResolveInterval: interval}
+			if _, err := adapter.StartAsHostWith(ctx, hostTr, net.JoinHostPort("localhost", port), cfg); err != nil {
+				t.Fatalf("StartAsHostWith: %v", err)
+			}
+			h, err := adapter.StartAsClient(ctx, clientTr, "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("StartAsClient: %v", err)
+			}
+			echoOnce(t, h.Addr().String(), 1)
+		})
+	}
+}
+
+// TestTargetUnreachable checks that a host whose target is down reports the
+// failed dial as ErrTargetUnreachable.
+func TestTargetUnreachable(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := l.Addr().String()
+	l.Close()
+
+	warnings := make(chan string, 16)
+	t.Cleanup(util.SubscribeEvents(func(ev util.Event) {
+		if ev.Event == util.EventLog && ev.Level == util.LevelWarning {
+			select {
+			case warnings <- ev.Text:
+			default:
+			}
+		}
+	}))
+
+	a, b := transport.NewPipe()
+	defer a.Close()
+	if _, err := adapter.StartAsHostWith(ctx, b, down, adapter.HostConfig{}); err != nil {
+		t.Fatalf("StartAsHostWith: %v", err)
+	}
+	a.SendConnect(0x7e, 1)
+
+	for {
+		select {
+		case text := <-warnings:
+			if strings.Contains(text, adapter.ErrTargetUnreachable.Error()) {
+				return
+			}
+		case <-ctx.Done():
+			t.Fatal("no warning about the unreachable target")
+		}
+	}
+}
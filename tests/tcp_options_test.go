@@ -0,0 +1,39 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+)
+
+// TestTCPOptions runs echo traffic with non-default socket options on both
+// sides of the tunnel.
+func TestTCPOptions(t *testing.T) {
+	for name, opts := range map[string]adapter.TCPOptions{
+		"tuned":        {Nagle: true, KeepAlive: 30 * time.Second, ReadBuffer: 256 * 1024, WriteBuffer: 256 * 1024},
+		"no keepalive": {KeepAlive: -1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			echoAddr := startEchoServer(t, ctx)
+			clientTr, hostTr := MockTransports()
+			defer clientTr.Close()
+			defer hostTr.Close()
+
+			if _, err := adapter.StartAsHostWith(ctx, hostTr, echoAddr, adapter.HostConfig{TCP: opts}); err != nil {
+				t.Fatalf("StartAsHostWith: %v", err)
+			}
+			clientAddr := getFreeAddr(t)
+			cfg := adapter.ClientConfig{ConnectTimeout: adapter.DefaultConnectTimeout, TCP: opts}
+			if _, err := adapter.StartAsClientWith(ctx, clientTr, clientAddr, cfg); err != nil {
+				t.Fatalf("StartAsClientWith: %v", err)
+			}
+
+			echoOnce(t, clientAddr, 1)
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/transport"
+)
+
+// Compile-time interface check.
+var _ transport.Carrier = (*transport.Pipe)(nil)
+
+// pipeThroughput sends total bytes, split over conns connections, through a
+// client and host adapter linked by a transport.Pipe into a sink, and returns
+// how long it took until every connection was closed end to end.
+func pipeThroughput(tb testing.TB, total int64, conns int) time.Duration {
+	tb.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	perConn := total / int64(conns)
+
+	sink, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatalf("sink: listen failed: %v", err)
+	}
+	defer sink.Close()
+	go func() {
+		for {
+			conn, err := sink.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.CopyN(io.Discard, conn, perConn)
+			}()
+		}
+	}()
+
+	clientTr, hostTr := transport.NewPipe()
+	defer clientTr.Close()
+
+	if _, err := adapter.StartAsHost(ctx, hostTr, sink.Addr().String()); err != nil {
+		tb.Fatalf("StartAsHost: %v", err)
+	}
+	h, err := adapter.StartAsClient(ctx, clientTr, "127.0.0.1:0")
+	if err != nil {
+		tb.Fatalf("StartAsClient: %v", err)
+	}
+
+	payload := makeTestData(64*1024, 0)
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for range conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			conn, err := net.Dial("tcp", h.Addr().String())
+			if err != nil {
+				tb.Errorf("dial: %v", err)
+				return
+			}
+			defer conn.Close()
+
+			for sent := int64(0); sent < perConn; sent += int64(len(payload)) {
+				if _, err := conn.Write(payload[:min(int64(len(payload)), perConn-sent)]); err != nil {
+					tb.Errorf("write: %v", err)
+					return
+				}
+			}
+			io.Copy(io.Discard, conn)
+		}()
+	}
+	wg.Wait()
+
+	return time.Since(start)
+}
+
+// BenchmarkAdapterThroughput measures adapter and protocol throughput over
+// the in-memory transport, with one and several parallel connections.
+func BenchmarkAdapterThroughput(b *testing.B) {
+	const size = 64 << 20
+
+	for _, conns := range []int{1, 4} {
+		b.Run(fmt.Sprintf("conns=%d", conns), func(b *testing.B) {
+			b.SetBytes(size)
+			for b.Loop() {
+				pipeThroughput(b, size, conns)
+			}
+		})
+	}
+}
+
+// TestThroughputFloor fails if adapter throughput over the in-memory
+// transport falls below ROJ1_MIN_THROUGHPUT MiB/s. It is skipped unless the
+// variable is set, since the floor depends on the machine and on -race; CI
+// sets it in a step of its own without -race, to catch regressions in the
+// sender or reassembler.
+func TestThroughputFloor(t *testing.T) {
+	raw := os.Getenv("ROJ1_MIN_THROUGHPUT")
+	if raw == "" {
+		t.Skip("ROJ1_MIN_THROUGHPUT not set")
+	}
+	floor, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		t.Fatalf("invalid ROJ1_MIN_THROUGHPUT %q: %v", raw, err)
+	}
+
+	const size = 256 << 20
+	elapsed := pipeThroughput(t, size, 4)
+	got := float64(size>>20) / elapsed.Seconds()
+	t.Logf("throughput: %.1f MiB/s (floor %.1f)", got, floor)
+	if got < floor {
+		t.Errorf("throughput %.1f MiB/s below floor %.1f MiB/s", got, floor)
+	}
+}
@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+)
+
+// testCert returns a self-signed certificate for 127.0.0.1.
+func testCert(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// startTLSEchoServer starts an echo server that only speaks TLS.
+func startTLSEchoServer(t *testing.T, ctx context.Context, cert tls.Certificate) string {
+	t.Helper()
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// TestTLSTargetAndLocal runs a TLS client against a TLS-only target with
+// plaintext in between: the client adapter terminates TLS and the host
+// adapter originates it again towards the target.
+func TestTLSTargetAndLocal(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cert := testCert(t)
+	echoAddr := startTLSEchoServer(t, ctx, cert)
+	clientTr, hostTr := MockTransports()
+	defer clientTr.Close()
+	defer hostTr.Close()
+
+	if _, err := adapter.StartAsHostWith(ctx, hostTr, echoAddr, adapter.HostConfig{
+		TargetTLS: &tls.Config{InsecureSkipVerify: true},
+	}); err != nil {
+		t.Fatalf("StartAsHostWith: %v", err)
+	}
+	h, err := adapter.StartAsClientWith(ctx, clientTr, "127.0.0.1:0", adapter.ClientConfig{
+		ConnectTimeout: adapter.DefaultConnectTimeout,
+		LocalTLS:       &tls.Config{Certificates: []tls.Certificate{cert}},
+	})
+	if err != nil {
+		t.Fatalf("StartAsClientWith: %v", err)
+	}
+
+	conn, err := tls.Dial("tcp", h.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("TLS dial: %v", err)
+	}
+	defer conn.Close()
+
+	sent := makeTestData(64*1024, 7)
+	go conn.Write(sent)
+
+	got := make([]byte, len(sent))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatalf("read echo: %v", err)
+	}
+	if !bytes.Equal(sent, got) {
+		t.Fatal("echoed data mismatch")
+	}
+}
+
+// TestTLSTargetVerify verifies that the target's certificate is checked by
+// default: an untrusted one closes the connection.
+func TestTLSTargetVerify(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	echoAddr := startTLSEchoServer(t, ctx, testCert(t))
+	clientTr, hostTr := MockTransports()
+	defer clientTr.Close()
+	defer hostTr.Close()
+
+	if _, err := adapter.StartAsHostWith(ctx, hostTr, echoAddr, adapter.HostConfig{
+		TargetTLS: &tls.Config{},
+	}); err != nil {
+		t.Fatalf("StartAsHostWith: %v", err)
+	}
+	d := adapter.NewDialer(ctx, clientTr, adapter.ClientConfig{})
+
+	if conn, err := d.DialContext(ctx, "tcp", ""); err == nil {
+		conn.Close()
+		t.Fatal("DialContext succeeded with an untrusted target certificate")
+	}
+}
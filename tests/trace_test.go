@@ -0,0 +1,51 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/protocol"
+)
+
+// TestTraceSocket checks that the packets of a traced socket are recorded in
+// both directions, and those of other sockets are not.
+func TestTraceSocket(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	const traced = 0x7ace
+	adapter.EnableTrace(traced, false)
+
+	p, _ := startRawPeer(t, ctx, adapter.HostConfig{})
+	for _, id := range []uint32{traced, traced + 1} {
+		p.SendConnect(id, 1)
+		p.expect(t, id, protocol.TypeConnect)
+		p.SendData(id, 2, []byte("hello"))
+		p.expect(t, id, protocol.TypeData)
+		p.SendClose(id, 3)
+		p.expect(t, id, protocol.TypeClose)
+	}
+
+	var got []string
+	for _, e := range adapter.Trace() {
+		if e.SocketID != traced {
+			t.Errorf("untraced socket recorded: %v", e)
+			continue
+		}
+		got = append(got, strings.SplitN(e.String(), " ", 2)[1])
+	}
+	want := []string{
+		"[00007ace] ← CONNECT seq=1 size=0",
+		"[00007ace] → CONNECT seq=1 size=0",
+		"[00007ace] ← DATA seq=2 size=5",
+		"[00007ace] → DATA seq=2 size=5",
+		"[00007ace] ← CLOSE seq=3 size=0",
+		"[00007ace] → CLOSE seq=3 size=0",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("trace:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
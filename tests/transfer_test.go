@@ -0,0 +1,49 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/protocol"
+)
+
+// TestTransferQuota checks that exceeding the transfer quota only warns by
+// default, and holds forwarding with Pause.
+func TestTransferQuota(t *testing.T) {
+	const chunk = 16 * 1024
+
+	for _, pause := range []bool{false, true} {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		p, _ := startRawPeer(t, ctx, adapter.HostConfig{Transfer: adapter.Transfer{Limit: 2 * chunk, Pause: pause}})
+		p.SendConnect(1, 1)
+		p.expect(t, 1, protocol.TypeConnect)
+		for seq := uint32(2); seq < 6; seq++ {
+			p.SendData(1, seq, make([]byte, chunk))
+		}
+
+		// Collect the echo until it stops for half a second.
+		var echoed int
+	collect:
+		for {
+			select {
+			case pkt := <-p.packets:
+				if pkt.Type == protocol.TypeData {
+					echoed += len(pkt.Payload)
+				}
+			case <-time.After(500 * time.Millisecond):
+				break collect
+			}
+		}
+
+		switch {
+		case !pause && echoed != 4*chunk:
+			t.Errorf("without Pause, echoed %d bytes, want %d", echoed, 4*chunk)
+		case pause && echoed >= 2*chunk:
+			t.Errorf("with Pause, echoed %d bytes past a quota of %d", echoed, 2*chunk)
+		}
+	}
+}
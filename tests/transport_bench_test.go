@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/transport"
+)
+
+// transportPair links two real WebRTC Transports in-process, exchanging SDP
+// and ICE candidates directly instead of over signaling.
+func transportPair(b *testing.B, ctx context.Context, cfg transport.Config) (client, host *transport.Transport) {
+	b.Helper()
+
+	host, err := transport.NewTransport(ctx)
+	if err != nil {
+		b.Fatalf("host transport: %v", err)
+	}
+	client, err = transport.NewTransportWith(ctx, cfg)
+	if err != nil {
+		b.Fatalf("client transport: %v", err)
+	}
+
+	// Candidates gathered before the remote description is set are held back.
+	var mu sync.Mutex
+	ready := false
+	var pending []func()
+	trickle := func(from, to *transport.Transport) {
+		from.OnICECandidate(func(c *webrtc.ICECandidate) {
+			if c == nil {
+				return
+			}
+			add := func() { to.AddICECandidate(c.ToJSON()) }
+			mu.Lock()
+			defer mu.Unlock()
+			if !ready {
+				pending = append(pending, add)
+				return
+			}
+			add()
+		})
+	}
+	trickle(host, client)
+	trickle(client, host)
+
+	offer, err := host.CreateOffer()
+	if err != nil {
+		b.Fatalf("create offer: %v", err)
+	}
+	host.SetLocalDescription(offer)
+	client.SetRemoteDescription(offer)
+
+	answer, err := client.CreateAnswer()
+	if err != nil {
+		b.Fatalf("create answer: %v", err)
+	}
+	client.SetLocalDescription(answer)
+	host.SetRemoteDescription(answer)
+
+	mu.Lock()
+	ready = true
+	for _, add := range pending {
+		add()
+	}
+	mu.Unlock()
+
+	for _, tr := range []*transport.Transport{host, client} {
+		select {
+		case <-tr.Ready():
+		case <-time.After(10 * time.Second):
+			b.Fatal("DataChannel did not open")
+		}
+	}
+	return client, host
+}
+
+// BenchmarkTransportModes compares the shared unordered DataChannel (with
+// userspace reassembly) against one ordered DataChannel per socket, moving
+// data through the full adapter path over several concurrent connections.
+func BenchmarkTransportModes(b *testing.B) {
+	modes := []struct {
+		name string
+		cfg  transport.Config
+	}{
+		{"shared", transport.Config{}},
+		{"socketChannels", transport.Config{SocketChannels: true}},
+	}
+
+	for _, mode := range modes {
+		b.Run(mode.name, func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			echoAddr := startEchoServer(b, ctx)
+			clientTr, hostTr := transportPair(b, ctx, mode.cfg)
+			defer clientTr.Close()
+			defer hostTr.Close()
+
+			if _, err := adapter.StartAsHost(ctx, hostTr, echoAddr); err != nil {
+				b.Fatalf("StartAsHost: %v", err)
+			}
+			clientAddr := getFreeAddr(b)
+			if _, err := adapter.StartAsClient(ctx, clientTr, clientAddr); err != nil {
+				b.Fatalf("StartAsClient: %v", err)
+			}
+
+			const numConns = 4
+			const dataSize = 1024 * 1024
+			b.SetBytes(numConns * dataSize)
+			b.ResetTimer()
+
+			for range b.N {
+				var wg sync.WaitGroup
+				for i := range numConns {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+
+						conn, err := net.Dial("tcp", clientAddr)
+						if err != nil {
+							b.Errorf("dial: %v", err)
+							return
+						}
+						defer conn.Close()
+
+						sent := makeTestData(dataSize, byte(i))
+						go conn.Write(sent)
+
+						got := make([]byte, dataSize)
+						conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+						if _, err := io.ReadFull(conn, got); err != nil {
+							b.Errorf("read echo: %v", err)
+							return
+						}
+						if !bytes.Equal(sent, got) {
+							b.Error("echoed data mismatch")
+						}
+					}()
+				}
+				wg.Wait()
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/protocol"
+	"github.com/1ureka/roj1/internal/util"
+)
+
+// TestValidationOversizePayload checks that a DATA payload above
+// MaxPayloadSize is dropped and counted, without disturbing the socket.
+func TestValidationOversizePayload(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	p, _ := startRawPeer(t, ctx, adapter.HostConfig{})
+	violations := util.Stats.Violations.Load()
+
+	p.SendConnect(1, 1)
+	p.expect(t, 1, protocol.TypeConnect)
+	p.SendData(1, 2, make([]byte, protocol.MaxPayloadSize+1))
+
+	// Had the oversize packet been accepted, this would be a duplicate.
+	want := []byte("hello")
+	p.SendData(1, 2, want)
+	if got := p.expect(t, 1, protocol.TypeData).Payload; string(got) != string(want) {
+		t.Errorf("echoed %q, want %q", got, want)
+	}
+	if got := util.Stats.Violations.Load() - violations; got != 1 {
+		t.Errorf("Violations grew by %d, want 1", got)
+	}
+}
+
+// TestValidationStrict checks that in strict mode a new socketID must start
+// with CONNECT.
+func TestValidationStrict(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	p, _ := startRawPeer(t, ctx, adapter.HostConfig{Validation: adapter.Validation{Strict: true}})
+	violations := util.Stats.Violations.Load()
+
+	// Without a socket, a CONNECT with SeqNum 1 would now be answered; the
+	// DATA must not have created one expecting it.
+	p.SendData(1, 2, []byte("early"))
+	p.SendConnect(2, 1)
+	p.expect(t, 2, protocol.TypeConnect)
+
+	if got := util.Stats.Violations.Load() - violations; got != 1 {
+		t.Errorf("Violations grew by %d, want 1", got)
+	}
+
+	p.SendConnect(1, 1)
+	p.expect(t, 1, protocol.TypeConnect)
+}
+
+// TestValidationMaxViolations checks that the adapter shuts down once the
+// peer reaches MaxViolations.
+func TestValidationMaxViolations(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	p, h := startRawPeer(t, ctx, adapter.HostConfig{Validation: adapter.Validation{MaxViolations: 3}})
+
+	for i := range 2 {
+		p.SendData(uint32(i+1), 1, make([]byte, protocol.MaxPayloadSize+1))
+	}
+	p.SendConnect(10, 1)
+	p.expect(t, 10, protocol.TypeConnect)
+
+	select {
+	case <-h.Done():
+		t.Fatal("adapter shut down below MaxViolations")
+	default:
+	}
+
+	p.SendData(3, 1, make([]byte, protocol.MaxPayloadSize+1))
+	select {
+	case <-h.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("adapter still running after MaxViolations")
+	}
+}
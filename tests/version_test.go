@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/1ureka/roj1/internal/signaling"
+)
+
+// fakeHelloHost accepts one signaling connection, records the client's hello
+// and answers with version. Nothing else is sent.
+func fakeHelloHost(t *testing.T, version string) (wsURL string, hello <-chan map[string]any) {
+	t.Helper()
+
+	got := make(chan map[string]any, 1)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var msg map[string]any
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		got <- msg
+		conn.WriteJSON(map[string]any{"type": "hello", "seq": 1, "nonce": "bm9uY2U", "version": version})
+
+		// Hold the connection until the client gives up.
+		conn.ReadJSON(&msg)
+	}))
+	t.Cleanup(srv.Close)
+
+	return "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws", got
+}
+
+// TestStrictVersionRefusesMajorMismatch checks that the client announces its
+// version and, with StrictVersion, refuses a host of another major version.
+func TestStrictVersionRefusesMajorMismatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	wsURL, hello := fakeHelloHost(t, "2.0.0")
+	_, err := signaling.EstablishAsClient(ctx, wsURL, signaling.Options{
+		Version:       "1.4.0",
+		StrictVersion: true,
+	})
+	if !errors.Is(err, signaling.ErrVersion) || !errors.Is(err, signaling.ErrSignaling) {
+		t.Fatalf("EstablishAsClient error = %v, want ErrVersion", err)
+	}
+
+	msg := <-hello
+	if msg["type"] != "hello" || msg["version"] != "1.4.0" {
+		t.Errorf("client's first message = %v, want a hello with its version", msg)
+	}
+}
+
+// TestVersionSameMajorProceeds checks that a host of the same major version
+// is accepted: establishment only stops at the timeout, waiting for offers.
+func TestVersionSameMajorProceeds(t *testing.T) {
+	wsURL, _ := fakeHelloHost(t, "v1.9.3")
+	_, err := signaling.EstablishAsClient(context.Background(), wsURL, signaling.Options{
+		Version:       "1.4.0",
+		StrictVersion: true,
+		Timeout:       500 * time.Millisecond,
+	})
+	if !errors.Is(err, signaling.ErrTimeout) {
+		t.Fatalf("EstablishAsClient error = %v, want ErrTimeout", err)
+	}
+}
@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/1ureka/roj1/internal/adapter"
+	"github.com/1ureka/roj1/internal/protocol"
+	"github.com/1ureka/roj1/internal/transport"
+)
+
+// TestDialRetryWakesTarget checks that with DialRetry a CONNECT to a target
+// that is down waits for it, calling Wake once, instead of being closed.
+func TestDialRetryWakesTarget(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Reserve a port with nothing listening on it.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	var woken atomic.Int32
+	wake := func() {
+		if woken.Add(1) == 1 {
+			// The "start command": bring the target up a little later.
+			time.AfterFunc(300*time.Millisecond, func() {
+				ln, err := net.Listen("tcp", addr)
+				if err != nil {
+					t.Errorf("target listen: %v", err)
+					return
+				}
+				t.Cleanup(func() { ln.Close() })
+				go func() {
+					for {
+						conn, err := ln.Accept()
+						if err != nil {
+							return
+						}
+						go io.Copy(io.Discard, conn)
+					}
+				}()
+			})
+		}
+	}
+
+	a, b := transport.NewPipe()
+	defer a.Close()
+	if _, err := adapter.StartAsHostWith(ctx, b, addr, adapter.HostConfig{
+		DialRetry: 5 * time.Second,
+		Wake:      wake,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &rawPeer{Pipe: a, packets: make(chan *protocol.Packet, 16)}
+	a.OnPacket(func(pkt *protocol.Packet) { p.packets <- pkt })
+	p.SendConnect(1, 1)
+
+	// Control messages (the service announcement) are skipped: they are not
+	// about socket 1.
+	if pkt := p.next(t, 1, func(*protocol.Packet) bool { return true }); pkt.Type != protocol.TypeConnect {
+		t.Fatalf("host answered with type %d, want CONNECT", pkt.Type)
+	}
+	if n := woken.Load(); n != 1 {
+		t.Errorf("Wake called %d times, want 1", n)
+	}
+}
+
+// TestDialRetryGivesUp checks that the socket is closed once DialRetry has
+// elapsed without the target coming up.
+func TestDialRetryGivesUp(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	a, b := transport.NewPipe()
+	defer a.Close()
+	if _, err := adapter.StartAsHostWith(ctx, b, addr, adapter.HostConfig{DialRetry: 300 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	p := &rawPeer{Pipe: a, packets: make(chan *protocol.Packet, 16)}
+	a.OnPacket(func(pkt *protocol.Packet) { p.packets <- pkt })
+
+	start := time.Now()
+	p.SendConnect(1, 1)
+	p.expect(t, 1, protocol.TypeClose)
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("gave up after %v, want about 300ms", elapsed)
+	}
+}
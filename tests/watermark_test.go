@@ -0,0 +1,31 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/1ureka/roj1/internal/transport"
+)
+
+// TestWaterMarkValidation checks which high/low water mark combinations a
+// transport accepts; zero fields fall back to defaults.
+func TestWaterMarkValidation(t *testing.T) {
+	tests := []struct {
+		high, low int
+		ok        bool
+	}{
+		{0, 0, true},
+		{4 << 20, 0, true},
+		{0, 1 << 20, true},
+		{1 << 20, 256 << 10, true},
+		{16 << 10, 0, true},
+		{64 << 10, 64 << 10, false},
+		{64 << 10, 128 << 10, false},
+		{0, -1, false},
+	}
+	for _, tt := range tests {
+		err := transport.Config{HighWaterMark: tt.high, LowWaterMark: tt.low}.Validate()
+		if (err == nil) != tt.ok {
+			t.Errorf("high=%d low=%d: got err %v, want ok=%v", tt.high, tt.low, err, tt.ok)
+		}
+	}
+}
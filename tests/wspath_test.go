@@ -0,0 +1,50 @@
+package tests
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/1ureka/roj1/internal/signaling"
+)
+
+// TestWSPathPrefix checks that a Listener with a custom path accepts clients
+// there only, and serves its other endpoints under the same prefix.
+func TestWSPathPrefix(t *testing.T) {
+	l, err := signaling.Listen("127.0.0.1:0", "/team-a/ws", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	l.Handle("/status", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "ok") }))
+	base := fmt.Sprintf("127.0.0.1:%d", l.Port())
+
+	if conn, _, err := websocket.DefaultDialer.Dial("ws://"+base+"/ws", nil); err == nil {
+		conn.Close()
+		t.Error("the default path accepted a client")
+	}
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+base+"/team-a/ws", nil)
+	if err != nil {
+		t.Fatalf("dialing the custom path: %v", err)
+	}
+	conn.Close()
+
+	resp, err := http.Get("http://" + base + "/team-a/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Errorf("GET /team-a/status = %d %q, want 200 \"ok\"", resp.StatusCode, body)
+	}
+
+	for _, p := range []string{"ws", "/a/../ws", "/ws?x=1", "/ws/"} {
+		if _, err := signaling.Listen("127.0.0.1:0", p, 0); err == nil {
+			t.Errorf("Listen accepted the path %q", p)
+		}
+	}
+}